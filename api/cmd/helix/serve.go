@@ -151,7 +151,7 @@ func getFilestore(ctx context.Context, cfg *config.ServerConfig) (filestore.File
 		if _, err := os.Stat(cfg.FileStore.GCSKeyFile); os.IsNotExist(err) {
 			return nil, fmt.Errorf("gcs key file does not exist")
 		}
-		gcs, err := filestore.NewGCSStorage(ctx, cfg.FileStore.GCSKeyFile, cfg.FileStore.GCSBucket)
+		gcs, err := filestore.NewGCSStorage(ctx, cfg.FileStore.GCSBucket, cfg.FileStore.GCSKeyFile)
 		if err != nil {
 			return nil, err
 		}
@@ -168,6 +168,33 @@ func getFilestore(ctx context.Context, cfg *config.ServerConfig) (filestore.File
 	return store, nil
 }
 
+// newExtractor returns the text extractor of the provider, the builtin extractor
+// falls back to the configured external extractor for the formats it can't read
+func newExtractor(cfg *config.ServerConfig, provider types.Extractor) (extract.Extractor, error) {
+	switch provider {
+	case types.ExtractorTika:
+		return extract.NewTikaExtractor(cfg.TextExtractor.Tika.URL), nil
+	case types.ExtractorUnstructured:
+		return extract.NewDefaultExtractor(cfg.TextExtractor.Unstructured.URL), nil
+	case types.ExtractorBuiltin:
+		var fallback extract.Extractor
+		if fallbackProvider := cfg.TextExtractor.Builtin.Fallback; fallbackProvider != "" {
+			if fallbackProvider == types.ExtractorBuiltin {
+				return nil, fmt.Errorf("builtin extractor can't be its own fallback")
+			}
+
+			var err error
+			fallback, err = newExtractor(cfg, fallbackProvider)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return extract.NewBuiltinExtractor(fallback), nil
+	default:
+		return nil, fmt.Errorf("unknown extractor: %s", provider)
+	}
+}
+
 func serve(cmd *cobra.Command, cfg *config.ServerConfig) error {
 	system.SetupLogging()
 
@@ -225,15 +252,9 @@ func serve(cmd *cobra.Command, cfg *config.ServerConfig) error {
 		gse = gptscript.NewExecutor(cfg, ps)
 	}
 
-	var extractor extract.Extractor
-
-	switch cfg.TextExtractor.Provider {
-	case types.ExtractorTika:
-		extractor = extract.NewTikaExtractor(cfg.TextExtractor.Tika.URL)
-	case types.ExtractorUnstructured:
-		extractor = extract.NewDefaultExtractor(cfg.TextExtractor.Unstructured.URL)
-	default:
-		return fmt.Errorf("unknown extractor: %s", cfg.TextExtractor.Provider)
+	extractor, err := newExtractor(cfg, cfg.TextExtractor.Provider)
+	if err != nil {
+		return err
 	}
 
 	// Must use the same allocator for both new LLM requests and old sessions
@@ -321,6 +342,18 @@ func serve(cmd *cobra.Command, cfg *config.ServerConfig) error {
 			DeleteURL: cfg.RAG.Llamaindex.RAGDeleteURL,
 		})
 		log.Info().Msgf("Using Llamaindex for RAG")
+	case "pgvector":
+		ragClient, err = rag.NewPGVector(cfg, providerManager, store.DB())
+		if err != nil {
+			return fmt.Errorf("failed to create pgvector RAG client: %v", err)
+		}
+		log.Info().Msgf("Using pgvector for RAG")
+	case "embedded":
+		ragClient, err = rag.NewEmbedded(cfg, providerManager)
+		if err != nil {
+			return fmt.Errorf("failed to create embedded RAG client: %v", err)
+		}
+		log.Info().Msgf("Using embedded vector store for RAG")
 	default:
 		return fmt.Errorf("unknown RAG provider: %s", cfg.RAG.DefaultRagProvider)
 	}
@@ -360,7 +393,13 @@ func serve(cmd *cobra.Command, cfg *config.ServerConfig) error {
 		return fmt.Errorf("failed to create browser pool: %w", err)
 	}
 
-	knowledgeReconciler, err := knowledge.New(cfg, store, fs, extractor, ragClient, browserPool)
+	// Without an embeddings provider the semantic text splitter is not available
+	var splitterEmbedder rag.Embedder
+	if provider, model := cfg.RAG.SemanticSplitterEmbeddings(); provider != "" {
+		splitterEmbedder = rag.NewEmbedder(providerManager, provider, model)
+	}
+
+	knowledgeReconciler, err := knowledge.New(cfg, store, fs, extractor, ragClient, splitterEmbedder, appController, browserPool)
 	if err != nil {
 		return err
 	}
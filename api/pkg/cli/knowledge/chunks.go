@@ -0,0 +1,65 @@
+package knowledge
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/helixml/helix/api/pkg/client"
+)
+
+func init() {
+	chunksCmd.Flags().String("version", "", "Knowledge version, the current version if not set")
+	chunksCmd.Flags().Int("offset", 0, "Number of chunks to skip")
+	chunksCmd.Flags().Int("limit", 10, "Number of chunks to show")
+
+	rootCmd.AddCommand(chunksCmd)
+}
+
+var chunksCmd = &cobra.Command{
+	Use:   "chunks [knowledge name or ID] [document ID]",
+	Short: "Show the indexed chunks of a knowledge document",
+	Long:  ``,
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiClient, err := client.NewClientFromEnv()
+		if err != nil {
+			return err
+		}
+
+		knowledge, err := lookupKnowledge(cmd.Context(), apiClient, args[0])
+		if err != nil {
+			return fmt.Errorf("failed to lookup knowledge: %w", err)
+		}
+
+		version, _ := cmd.Flags().GetString("version")
+		offset, _ := cmd.Flags().GetInt("offset")
+		limit, _ := cmd.Flags().GetInt("limit")
+
+		resp, err := apiClient.ListKnowledgeChunks(cmd.Context(), &client.KnowledgeChunksFilter{
+			KnowledgeID: knowledge.ID,
+			DocumentID:  args[1],
+			Version:     version,
+			Offset:      offset,
+			Limit:       limit,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list knowledge chunks: %w", err)
+		}
+
+		out := cmd.OutOrStdout()
+
+		for _, chunk := range resp.Chunks {
+			fmt.Fprintf(out, "--- %s chunk %d", chunk.Source, chunk.ContentOffset)
+			if section := chunk.Metadata["section"]; section != "" {
+				fmt.Fprintf(out, " (%s)", section)
+			}
+			fmt.Fprintf(out, "\n%s\n\n", strings.TrimSpace(chunk.Content))
+		}
+
+		fmt.Fprintf(out, "Showing %d-%d of %d chunks\n", min(offset+1, resp.Total), offset+len(resp.Chunks), resp.Total)
+
+		return nil
+	},
+}
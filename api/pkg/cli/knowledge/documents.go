@@ -0,0 +1,150 @@
+package knowledge
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/helixml/helix/api/pkg/client"
+)
+
+func init() {
+	documentsCmd.Flags().String("version", "", "Knowledge version, the current version if not set")
+
+	documentsRemoveCmd.Flags().Bool("exclude", false, "Exclude the document from the following refreshes too")
+
+	documentsCmd.AddCommand(documentsRemoveCmd)
+	documentsCmd.AddCommand(documentsReindexCmd)
+
+	rootCmd.AddCommand(documentsCmd)
+}
+
+var documentsCmd = &cobra.Command{
+	Use:     "documents [knowledge name or ID]",
+	Aliases: []string{"docs"},
+	Short:   "List documents of a specific knowledge",
+	Long:    ``,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiClient, err := client.NewClientFromEnv()
+		if err != nil {
+			return err
+		}
+
+		knowledge, err := lookupKnowledge(cmd.Context(), apiClient, args[0])
+		if err != nil {
+			return fmt.Errorf("failed to lookup knowledge: %w", err)
+		}
+
+		version, _ := cmd.Flags().GetString("version")
+
+		documents, err := apiClient.ListKnowledgeDocuments(cmd.Context(), &client.KnowledgeDocumentsFilter{
+			KnowledgeID: knowledge.ID,
+			Version:     version,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list knowledge documents: %w", err)
+		}
+
+		table := tablewriter.NewWriter(cmd.OutOrStdout())
+
+		header := []string{"ID", "Source", "Document ID", "Status", "Skipped", "Excluded"}
+
+		table.SetHeader(header)
+
+		table.SetAutoWrapText(false)
+		table.SetAutoFormatHeaders(true)
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetCenterSeparator("")
+		table.SetColumnSeparator("")
+		table.SetRowSeparator("")
+		table.SetHeaderLine(false)
+		table.SetBorder(false)
+		table.SetTablePadding(" ")
+		table.SetNoWhiteSpace(false)
+
+		for _, d := range documents {
+			status := ""
+			if d.StatusCode > 0 {
+				status = strconv.Itoa(d.StatusCode)
+			}
+
+			row := []string{
+				d.ID,
+				d.Source,
+				d.DocumentID,
+				status,
+				d.SkipReason,
+				strconv.FormatBool(d.Excluded),
+			}
+
+			table.Append(row)
+		}
+
+		table.Render()
+
+		return nil
+	},
+}
+
+var documentsRemoveCmd = &cobra.Command{
+	Use:     "remove [knowledge name or ID] [document ID]",
+	Aliases: []string{"rm"},
+	Short:   "Delete a document from the current knowledge version",
+	Long:    `Deletes the chunks of the document, the next refresh indexes the document again unless it's excluded with --exclude.`,
+	Args:    cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiClient, err := client.NewClientFromEnv()
+		if err != nil {
+			return err
+		}
+
+		knowledge, err := lookupKnowledge(cmd.Context(), apiClient, args[0])
+		if err != nil {
+			return fmt.Errorf("failed to lookup knowledge: %w", err)
+		}
+
+		exclude, _ := cmd.Flags().GetBool("exclude")
+
+		if err := apiClient.DeleteKnowledgeDocument(cmd.Context(), knowledge.ID, args[1], exclude); err != nil {
+			return err
+		}
+
+		if exclude {
+			fmt.Printf("Document %s deleted and excluded\n", args[1])
+		} else {
+			fmt.Printf("Document %s deleted\n", args[1])
+		}
+
+		return nil
+	},
+}
+
+var documentsReindexCmd = &cobra.Command{
+	Use:   "reindex [knowledge name or ID] [document ID]",
+	Short: "Re-index a document of the current knowledge version",
+	Long:  `Fetches the document from the knowledge source again and replaces its chunks, excluded documents are included again.`,
+	Args:  cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiClient, err := client.NewClientFromEnv()
+		if err != nil {
+			return err
+		}
+
+		knowledge, err := lookupKnowledge(cmd.Context(), apiClient, args[0])
+		if err != nil {
+			return fmt.Errorf("failed to lookup knowledge: %w", err)
+		}
+
+		if err := apiClient.ReindexKnowledgeDocument(cmd.Context(), knowledge.ID, args[1]); err != nil {
+			return err
+		}
+
+		fmt.Printf("Document %s is being re-indexed, check the knowledge state for progress\n", args[1])
+
+		return nil
+	},
+}
@@ -0,0 +1,176 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+
+	"github.com/helixml/helix/api/pkg/client"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+func init() {
+	evalCmd.Flags().StringP("file", "f", "", "YAML file with the eval cases (question and expected_sources), the eval set of the knowledge if not set")
+	evalCmd.Flags().StringArray("version", nil, "Knowledge version to evaluate (can be repeated), the current version if neither versions nor variants are set")
+	evalCmd.Flags().String("variants", "", "YAML file with the RAG settings variants (name and rag_settings) to index side by side and evaluate")
+	evalCmd.Flags().IntP("top-k", "k", 0, "Number of retrieved chunks to consider, the results count of the knowledge if not set")
+	evalCmd.Flags().BoolP("verbose", "v", false, "Show the results of each question")
+
+	rootCmd.AddCommand(evalCmd)
+}
+
+var evalCmd = &cobra.Command{
+	Use:   "eval [knowledge name or ID]",
+	Short: "Evaluate the retrieval quality of a knowledge",
+	Long: `Runs the golden set of questions against the knowledge and reports recall@k, MRR and hit rate.
+Compare versions with --version, or RAG settings variants with --variants before applying them to the knowledge.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		apiClient, err := client.NewClientFromEnv()
+		if err != nil {
+			return err
+		}
+
+		knowledge, err := lookupKnowledge(cmd.Context(), apiClient, args[0])
+		if err != nil {
+			return fmt.Errorf("failed to lookup knowledge: %w", err)
+		}
+
+		file, _ := cmd.Flags().GetString("file")
+		versions, _ := cmd.Flags().GetStringArray("version")
+		variantsFile, _ := cmd.Flags().GetString("variants")
+		k, _ := cmd.Flags().GetInt("top-k")
+		verbose, _ := cmd.Flags().GetBool("verbose")
+
+		req := &types.KnowledgeEvalRequest{
+			K:        k,
+			Versions: versions,
+		}
+
+		if file != "" {
+			if err := readYAMLFile(file, &req.Cases); err != nil {
+				return err
+			}
+		}
+
+		if variantsFile != "" {
+			if err := readYAMLFile(variantsFile, &req.Variants); err != nil {
+				return err
+			}
+		}
+
+		job, err := apiClient.EvaluateKnowledge(cmd.Context(), knowledge.ID, req)
+		if err != nil {
+			return err
+		}
+
+		resp, err := waitForEvalJob(cmd.Context(), apiClient, job)
+		if err != nil {
+			return err
+		}
+
+		table := tablewriter.NewWriter(cmd.OutOrStdout())
+
+		header := []string{"Version", "Variant", "Recall@" + strconv.Itoa(resp.K), "MRR", "Hit rate"}
+
+		table.SetHeader(header)
+
+		table.SetAutoWrapText(false)
+		table.SetAutoFormatHeaders(false)
+		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+		table.SetAlignment(tablewriter.ALIGN_LEFT)
+		table.SetCenterSeparator("")
+		table.SetColumnSeparator("")
+		table.SetRowSeparator("")
+		table.SetHeaderLine(false)
+		table.SetBorder(false)
+		table.SetTablePadding(" ")
+		table.SetNoWhiteSpace(false)
+
+		for _, result := range resp.Results {
+			row := []string{
+				result.Version,
+				result.Variant,
+				fmt.Sprintf("%.3f", result.RecallAtK),
+				fmt.Sprintf("%.3f", result.MRR),
+				fmt.Sprintf("%.3f", result.HitRate),
+			}
+
+			table.Append(row)
+		}
+
+		table.Render()
+
+		if !verbose {
+			return nil
+		}
+
+		out := cmd.OutOrStdout()
+
+		for _, result := range resp.Results {
+			name := result.Version
+			if result.Variant != "" {
+				name = "variant " + result.Variant
+			}
+
+			fmt.Fprintf(out, "\n%s\n", name)
+			for _, c := range result.Cases {
+				fmt.Fprintf(out, "  %s\n    recall %.2f, reciprocal rank %.2f\n    retrieved: %s\n",
+					c.Question, c.Recall, c.ReciprocalRank, strings.Join(c.Retrieved, ", "))
+			}
+		}
+
+		return nil
+	},
+}
+
+// evalJobPollInterval is how often the eval job is checked, indexing
+// the variants can take minutes
+const evalJobPollInterval = 2 * time.Second
+
+func waitForEvalJob(ctx context.Context, apiClient client.Client, job *types.KnowledgeEvalJob) (*types.KnowledgeEvalResponse, error) {
+	var err error
+
+	for job.State == types.KnowledgeEvalJobStateRunning {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(evalJobPollInterval):
+		}
+
+		job, err = apiClient.GetKnowledgeEvalJob(ctx, job.KnowledgeID, job.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if job.Progress.Message != "" {
+			fmt.Fprintf(os.Stderr, "%s: %s (%d%%)\n", job.Progress.Step, job.Progress.Message, job.Progress.Progress)
+		}
+	}
+
+	if job.State == types.KnowledgeEvalJobStateError {
+		return nil, fmt.Errorf("knowledge eval failed: %s", job.Error)
+	}
+
+	return job.Result, nil
+}
+
+func readYAMLFile(path string, v interface{}) error {
+	bts, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if err := yaml.Unmarshal(bts, v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	return nil
+}
@@ -12,6 +12,7 @@ func init() {
 	searchCmd.Flags().String("app", "", "App ID to search within")
 	searchCmd.Flags().String("knowledge", "", "Knowledge ID to search within")
 	searchCmd.Flags().String("prompt", "", "Search prompt")
+	searchCmd.Flags().StringArray("filter", nil, "Metadata filter, key=value, key!=value or key^=prefix (can be repeated)")
 
 	_ = searchCmd.MarkFlagRequired("app")
 	_ = searchCmd.MarkFlagRequired("prompt")
@@ -32,11 +33,13 @@ var searchCmd = &cobra.Command{
 		appID, _ := cmd.Flags().GetString("app")
 		knowledgeID, _ := cmd.Flags().GetString("knowledge")
 		prompt, _ := cmd.Flags().GetString("prompt")
+		filters, _ := cmd.Flags().GetStringArray("filter")
 
 		results, err := apiClient.SearchKnowledge(cmd.Context(), &client.KnowledgeSearchQuery{
 			AppID:       appID,
 			KnowledgeID: knowledgeID,
 			Prompt:      prompt,
+			Filters:     filters,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to search knowledge: %w", err)
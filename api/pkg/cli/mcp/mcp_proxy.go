@@ -153,37 +153,32 @@ func (mcps *ModelContextProtocolServer) getModelContextProtocolTools(app *types.
 
 		// Each API tool has a list of actions, adding them separately
 		for _, action := range tool.Config.API.Actions {
-			parameters, err := tools.GetParametersFromSchema(tool.Config.API.Schema, action.Name)
+			inputSchema, err := tools.GetArgumentsSchema(tool.Config.API.Schema, action.Name)
 			if err != nil {
 				log.Error().
 					Err(err).
 					Str("tool", tool.Name).
 					Str("action", action.Name).
-					Msg("failed to get parameters from schema")
+					Msg("failed to get arguments schema")
 				continue
 			}
 
-			var mcpParams []mcp.ToolOption
-
-			mcpParams = append(mcpParams, mcp.WithDescription(action.Description))
+			mcpTool := mcp.NewTool(action.Name,
+				mcp.WithDescription(action.Description),
+			)
 
-			for _, param := range parameters {
-				if param.Required {
-					mcpParams = append(mcpParams, mcp.WithString(param.Name,
-						mcp.Required(),
-						mcp.Description(param.Description),
-					))
-				} else {
-					mcpParams = append(mcpParams, mcp.WithString(param.Name,
-						mcp.Description(param.Description),
-					))
+			// Typed arguments, including the request body
+			if properties, ok := inputSchema["properties"].(map[string]any); ok {
+				mcpTool.InputSchema.Properties = properties
+			}
+			if required, ok := inputSchema["required"].([]any); ok {
+				for _, name := range required {
+					if s, ok := name.(string); ok {
+						mcpTool.InputSchema.Required = append(mcpTool.InputSchema.Required, s)
+					}
 				}
 			}
 
-			mcpTool := mcp.NewTool(action.Name,
-				mcpParams...,
-			)
-
 			log.Info().Any("tool", action).Msg("adding tool")
 
 			mcpTools = append(mcpTools, &helixMCPTool{
@@ -248,21 +243,8 @@ func (mcps *ModelContextProtocolServer) getAPIToolHandler(appID string, tool *ty
 			Str("action", action).
 			Msg("api tool handler")
 
-		params := make(map[string]string)
-
-		for k, v := range request.Params.Arguments {
-			val, ok := v.(string)
-			if !ok {
-				log.Error().
-					Str("tool", tool.Name).
-					Str("action", action).
-					Str("param", k).
-					Any("value", v).
-					Msg("param is not a string")
-				continue
-			}
-			params[k] = val
-		}
+		// Validated against the operation schema by the API
+		params := request.Params.Arguments
 
 		resp, err := mcps.apiClient.RunAPIAction(ctx, appID, action, params)
 		if err != nil {
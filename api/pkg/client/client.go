@@ -24,7 +24,7 @@ type Client interface {
 	DeleteApp(ctx context.Context, appID string, deleteKnowledge bool) error
 	ListApps(ctx context.Context, f *AppFilter) ([]*types.App, error)
 
-	RunAPIAction(ctx context.Context, appID string, action string, parameters map[string]string) (*types.RunAPIActionResponse, error)
+	RunAPIAction(ctx context.Context, appID string, action string, parameters map[string]any) (*types.RunAPIActionResponse, error)
 
 	ListKnowledge(ctx context.Context, f *KnowledgeFilter) ([]*types.Knowledge, error)
 	GetKnowledge(ctx context.Context, id string) (*types.Knowledge, error)
@@ -38,6 +38,12 @@ type Client interface {
 	DeleteSecret(ctx context.Context, id string) error
 
 	ListKnowledgeVersions(ctx context.Context, f *KnowledgeVersionsFilter) ([]*types.KnowledgeVersion, error)
+	ListKnowledgeDocuments(ctx context.Context, f *KnowledgeDocumentsFilter) ([]*types.KnowledgeDocument, error)
+	ListKnowledgeChunks(ctx context.Context, f *KnowledgeChunksFilter) (*types.ListIndexResponse, error)
+	DeleteKnowledgeDocument(ctx context.Context, knowledgeID, documentID string, exclude bool) error
+	ReindexKnowledgeDocument(ctx context.Context, knowledgeID, documentID string) error
+	EvaluateKnowledge(ctx context.Context, knowledgeID string, req *types.KnowledgeEvalRequest) (*types.KnowledgeEvalJob, error)
+	GetKnowledgeEvalJob(ctx context.Context, knowledgeID, jobID string) (*types.KnowledgeEvalJob, error)
 
 	FilestoreList(ctx context.Context, path string) ([]filestore.Item, error)
 	FilestoreUpload(ctx context.Context, path string, file io.Reader) error
@@ -1,10 +1,13 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 
 	"github.com/helixml/helix/api/pkg/types"
 )
@@ -72,10 +75,113 @@ func (c *HelixClient) ListKnowledgeVersions(ctx context.Context, f *KnowledgeVer
 	return knowledge, nil
 }
 
+type KnowledgeDocumentsFilter struct {
+	KnowledgeID string
+	Version     string // Current version if empty
+}
+
+func (c *HelixClient) ListKnowledgeDocuments(ctx context.Context, f *KnowledgeDocumentsFilter) ([]*types.KnowledgeDocument, error) {
+	path := fmt.Sprintf("/knowledge/%s/documents", f.KnowledgeID)
+	if f.Version != "" {
+		path += "?version=" + url.QueryEscape(f.Version)
+	}
+
+	var documents []*types.KnowledgeDocument
+	err := c.makeRequest(ctx, http.MethodGet, path, nil, &documents)
+	if err != nil {
+		return nil, err
+	}
+
+	return documents, nil
+}
+
+type KnowledgeChunksFilter struct {
+	KnowledgeID string
+	DocumentID  string
+	Version     string // Current version if empty
+	Offset      int
+	Limit       int
+}
+
+func (c *HelixClient) ListKnowledgeChunks(ctx context.Context, f *KnowledgeChunksFilter) (*types.ListIndexResponse, error) {
+	params := url.Values{}
+	params.Add("offset", strconv.Itoa(f.Offset))
+	params.Add("limit", strconv.Itoa(f.Limit))
+	if f.Version != "" {
+		params.Add("version", f.Version)
+	}
+
+	path := fmt.Sprintf("/knowledge/%s/documents/%s/chunks?%s", f.KnowledgeID, f.DocumentID, params.Encode())
+
+	var resp *types.ListIndexResponse
+	err := c.makeRequest(ctx, http.MethodGet, path, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// DeleteKnowledgeDocument deletes the document from the current version, excluded
+// documents are not indexed again by the following refreshes
+func (c *HelixClient) DeleteKnowledgeDocument(ctx context.Context, knowledgeID, documentID string, exclude bool) error {
+	path := fmt.Sprintf("/knowledge/%s/documents/%s", knowledgeID, documentID)
+	if exclude {
+		path += "?exclude=true"
+	}
+
+	err := c.makeRequest(ctx, http.MethodDelete, path, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete knowledge document, %w", err)
+	}
+	return nil
+}
+
+// ReindexKnowledgeDocument starts re-indexing the document, the knowledge is
+// in the indexing state until it's done
+func (c *HelixClient) ReindexKnowledgeDocument(ctx context.Context, knowledgeID, documentID string) error {
+	path := fmt.Sprintf("/knowledge/%s/documents/%s/reindex", knowledgeID, documentID)
+
+	err := c.makeRequest(ctx, http.MethodPost, path, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to re-index knowledge document, %w", err)
+	}
+	return nil
+}
+
+// EvaluateKnowledge starts the eval job that runs the golden set against the knowledge
+// versions or the RAG settings variants, poll it with GetKnowledgeEvalJob
+func (c *HelixClient) EvaluateKnowledge(ctx context.Context, knowledgeID string, req *types.KnowledgeEvalRequest) (*types.KnowledgeEvalJob, error) {
+	bts, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var job types.KnowledgeEvalJob
+	err = c.makeRequest(ctx, http.MethodPost, fmt.Sprintf("/knowledge/%s/eval", knowledgeID), bytes.NewBuffer(bts), &job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate knowledge, %w", err)
+	}
+
+	return &job, nil
+}
+
+func (c *HelixClient) GetKnowledgeEvalJob(ctx context.Context, knowledgeID, jobID string) (*types.KnowledgeEvalJob, error) {
+	var job types.KnowledgeEvalJob
+	err := c.makeRequest(ctx, http.MethodGet, fmt.Sprintf("/knowledge/%s/eval/%s", knowledgeID, jobID), nil, &job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get knowledge eval job, %w", err)
+	}
+
+	return &job, nil
+}
+
 type KnowledgeSearchQuery struct {
 	AppID       string
 	KnowledgeID string
 	Prompt      string
+	// Filters are metadata filter expressions: key=value, key!=value or key^=prefix
+	Filters []string
 }
 
 func (c *HelixClient) SearchKnowledge(ctx context.Context, f *KnowledgeSearchQuery) ([]*types.KnowledgeSearchResult, error) {
@@ -87,6 +193,9 @@ func (c *HelixClient) SearchKnowledge(ctx context.Context, f *KnowledgeSearchQue
 	if f.KnowledgeID != "" {
 		params.Add("knowledge_id", f.KnowledgeID)
 	}
+	for _, filter := range f.Filters {
+		params.Add("filter", filter)
+	}
 
 	path := "/search?" + params.Encode()
 	err := c.makeRequest(ctx, http.MethodGet, path, nil, &result)
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
 	"time"
 
@@ -91,6 +92,36 @@ type Tools struct {
 	// IsActionableTemplate is used to determine whether Helix should
 	// use a tool or not. Leave empty for default
 	IsActionableTemplate string `envconfig:"TOOLS_IS_ACTIONABLE_TEMPLATE"` // Either plain text, base64 or path to a file
+
+	// MCPStdioServers are the stdio MCP servers the apps can launch by name, for example
+	// {"github": ["npx", "-y", "@modelcontextprotocol/server-github"]}. The servers run
+	// on the API host so stdio is disabled if empty.
+	MCPStdioServers MCPStdioServers `envconfig:"TOOLS_MCP_STDIO_SERVERS"`
+}
+
+// MCPStdioServers maps the names of the stdio MCP servers to their command lines
+type MCPStdioServers map[string][]string
+
+// Decode implements envconfig.Decoder, the servers are set as a JSON object
+func (s *MCPStdioServers) Decode(value string) error {
+	if value == "" {
+		*s = nil
+		return nil
+	}
+
+	var servers map[string][]string
+	if err := json.Unmarshal([]byte(value), &servers); err != nil {
+		return fmt.Errorf("invalid stdio MCP servers, expected a JSON object of the command lines by name: %w", err)
+	}
+
+	for name, command := range servers {
+		if len(command) == 0 || command[0] == "" {
+			return fmt.Errorf("stdio MCP server %q has no command", name)
+		}
+	}
+
+	*s = servers
+	return nil
 }
 
 // Keycloak is used for authentication. You can find keycloak documentation
@@ -161,6 +192,10 @@ type DataPrepText struct {
 
 type TextExtractor struct {
 	Provider types.Extractor `envconfig:"TEXT_EXTRACTION_PROVIDER" default:"tika"`
+	// CacheEnabled keeps the extracted texts in the filestore, keyed by the file contents
+	CacheEnabled bool `envconfig:"TEXT_EXTRACTION_CACHE_ENABLED" default:"true" description:"Reuse the extracted text of unchanged files when re-indexing knowledge."`
+	// CacheMaxSizeMB limits the size of the cache, the oldest entries are evicted first
+	CacheMaxSizeMB int `envconfig:"TEXT_EXTRACTION_CACHE_MAX_SIZE_MB" default:"1024" description:"The size the text extraction cache is trimmed to, in megabytes."`
 	// the URL we post documents to so we can get the text back from them
 	Unstructured struct {
 		URL string `envconfig:"TEXT_EXTRACTION_URL" default:"http://llamaindex:5000/api/v1/extract" description:"The URL to extract text from a document."`
@@ -169,22 +204,54 @@ type TextExtractor struct {
 	Tika struct {
 		URL string `envconfig:"TEXT_EXTRACTION_TIKA_URL" default:"http://tika:9998" description:"The URL to extract text from a document."`
 	}
+
+	Builtin struct {
+		Fallback types.Extractor `envconfig:"TEXT_EXTRACTION_BUILTIN_FALLBACK" description:"The extractor (tika or unstructured) used for the formats the builtin extractor can't handle, unset to fail instead."`
+	}
 }
 
 type RAG struct {
 	IndexingConcurrency int `envconfig:"RAG_INDEXING_CONCURRENCY" default:"1" description:"The number of concurrent indexing tasks."`
 
 	// DefaultRagProvider is the default RAG provider to use if not specified
-	DefaultRagProvider string `envconfig:"RAG_DEFAULT_PROVIDER" default:"typesense" description:"The default RAG provider to use if not specified."`
+	DefaultRagProvider string `envconfig:"RAG_DEFAULT_PROVIDER" default:"typesense" description:"The default RAG provider to use if not specified (typesense, llamaindex, pgvector, embedded)."`
 
 	MaxVersions int `envconfig:"RAG_MAX_VERSIONS" default:"3" description:"The maximum number of versions to keep for a knowledge."`
 
+	// AmbientCredentials lets the S3 and GCS knowledge sources without credentials use the
+	// cloud credentials of the server, only enable it if every user may read those buckets
+	AmbientCredentials bool `envconfig:"RAG_AMBIENT_CREDENTIALS" default:"false" description:"Whether S3 and GCS knowledge sources without credentials can use the AWS/GCP credentials of the server."`
+
 	// Typesense is used to store RAG records in a Typesense index
 	Typesense struct {
 		URL    string `envconfig:"RAG_TYPESENSE_URL" default:"http://typesense:8108" description:"The URL to the Typesense server."`
 		APIKey string `envconfig:"RAG_TYPESENSE_API_KEY" default:"typesense" description:"The API key to the Typesense server."`
 	}
 
+	// PGVector stores the embeddings in the Helix Postgres database, the
+	// database must have the pgvector extension available
+	PGVector struct {
+		Provider        types.Provider `envconfig:"RAG_PGVECTOR_PROVIDER" default:"openai" description:"The provider to use for generating embeddings (openai, togetherai)."`
+		EmbeddingsModel string         `envconfig:"RAG_PGVECTOR_EMBEDDINGS_MODEL" default:"text-embedding-3-small" description:"The model to use for generating embeddings."`
+		Dimensions      int            `envconfig:"RAG_PGVECTOR_DIMENSIONS" default:"1536" description:"The number of dimensions of the embeddings model."`
+	}
+
+	// Embedded keeps the chunks on the local disk and searches them in the API
+	// process, no external services are needed
+	Embedded struct {
+		Path            string         `envconfig:"RAG_EMBEDDED_PATH" description:"Where to store the chunks, defaults to the 'rag' directory under FILESTORE_LOCALFS_PATH."`
+		Provider        types.Provider `envconfig:"RAG_EMBEDDED_PROVIDER" description:"Optional provider for generating embeddings (openai, togetherai), uses the built-in hashing embeddings if empty."`
+		EmbeddingsModel string         `envconfig:"RAG_EMBEDDED_EMBEDDINGS_MODEL" default:"text-embedding-3-small" description:"The model to use for generating embeddings when a provider is set."`
+		CacheMaxChunks  int            `envconfig:"RAG_EMBEDDED_CACHE_MAX_CHUNKS" default:"200000" description:"The maximum number of chunks kept in memory, the least recently queried knowledge is evicted first. 0 for no limit."`
+	}
+
+	// SemanticSplitter generates the embeddings used to find where to split
+	// the documents with the semantic text splitter
+	SemanticSplitter struct {
+		Provider        types.Provider `envconfig:"RAG_SEMANTIC_SPLITTER_PROVIDER" description:"Optional provider for generating embeddings (openai, togetherai), defaults to the provider of the pgvector or embedded RAG backend. The semantic text splitter is not available without a provider."`
+		EmbeddingsModel string         `envconfig:"RAG_SEMANTIC_SPLITTER_EMBEDDINGS_MODEL" default:"text-embedding-3-small" description:"The model to use for generating embeddings when a provider is set."`
+	}
+
 	Llamaindex struct {
 		// the URL we can post a chunk of text to for RAG indexing
 		RAGIndexingURL string `envconfig:"RAG_INDEX_URL" default:"http://llamaindex:5000/api/v1/rag/chunk" description:"The URL to index text with RAG."`
@@ -195,6 +262,11 @@ type RAG struct {
 		RAGDeleteURL string `envconfig:"RAG_DELETE_URL" default:"http://llamaindex:5000/api/v1/rag" description:"The URL to delete RAG records."`
 	}
 
+	// Git limits the repositories cloned for the git knowledge sources
+	Git struct {
+		MaxSizeMB int `envconfig:"RAG_GIT_MAX_SIZE_MB" default:"500" description:"The maximum size of the objects cloned from a git repository, 0 for no limit."`
+	}
+
 	Crawler struct {
 		ChromeURL       string `envconfig:"RAG_CRAWLER_CHROME_URL" default:"http://chrome:9222" description:"The URL to the Chrome instance."`
 		LauncherEnabled bool   `envconfig:"RAG_CRAWLER_LAUNCHER_ENABLED" default:"true" description:"Whether to use the Launcher to start the browser."`
@@ -208,6 +280,22 @@ type RAG struct {
 	}
 }
 
+// SemanticSplitterEmbeddings returns the embeddings provider and model of the semantic
+// text splitter, by default the ones of the pgvector or embedded RAG backend. The provider
+// is empty if no embeddings are configured.
+func (r *RAG) SemanticSplitterEmbeddings() (types.Provider, string) {
+	switch {
+	case r.SemanticSplitter.Provider != "":
+		return r.SemanticSplitter.Provider, r.SemanticSplitter.EmbeddingsModel
+	case r.DefaultRagProvider == "pgvector":
+		return r.PGVector.Provider, r.PGVector.EmbeddingsModel
+	case r.DefaultRagProvider == "embedded":
+		return r.Embedded.Provider, r.Embedded.EmbeddingsModel
+	}
+
+	return "", ""
+}
+
 type Controller struct {
 	FilestorePresignSecret string `envconfig:"FILESTORE_PRESIGN_SECRET" description:""`
 	// this is an "env" prefix like "dev"
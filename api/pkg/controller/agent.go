@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+	openai "github.com/sashabaranov/go-openai"
+
+	oai "github.com/helixml/helix/api/pkg/openai"
+	"github.com/helixml/helix/api/pkg/tools"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+const (
+	defaultAgentMaxIterations = 5
+	defaultAgentTokenBudget   = 32000
+
+	// approxCharsPerToken is used to estimate the tokens of the tool results
+	approxCharsPerToken = 4
+)
+
+// runAgent plans and runs the tools one after another, each step sees the results of the
+// previous steps in the history. The results are added to the returned request so that
+// the assistant answers the user with them. The tokens used by the LLM calls of the planner
+// and the tools are counted against the token budget.
+func (c *Controller) runAgent(ctx context.Context, req openai.ChatCompletionRequest, opts *ChatCompletionOptions, assistant *types.AssistantConfig) (openai.ChatCompletionRequest, error) {
+	vals, ok := oai.GetContextValues(ctx)
+	if !ok {
+		vals = &oai.ContextValues{}
+	}
+
+	maxIterations := assistant.Agent.MaxIterations
+	if maxIterations <= 0 {
+		maxIterations = defaultAgentMaxIterations
+	}
+
+	tokenBudget := assistant.Agent.TokenBudget
+	if tokenBudget <= 0 {
+		tokenBudget = defaultAgentTokenBudget
+	}
+
+	usage := &oai.UsageCounter{}
+	ctx = oai.SetUsageCounter(ctx, usage)
+
+	for step := 1; step <= maxIterations; step++ {
+		c.emitAgentStepInfo(ctx, "is_actionable", step, "Checking if we should use tools")
+
+		history := types.HistoryFromChatCompletionRequest(req)
+
+		actions, err := c.planToolActions(ctx, vals, assistant, history, opts)
+		if err != nil {
+			return req, err
+		}
+
+		if len(actions) == 0 {
+			c.emitAgentStepInfo(ctx, "is_actionable", step, "No more tools needed, answering")
+			return req, nil
+		}
+
+		// The actions of a step don't depend on each other, they run in parallel
+		// and their results are added in the call order
+		responses, err := c.runToolActions(ctx, vals, assistant, history, actions)
+		if err != nil {
+			return req, err
+		}
+
+		for idx, action := range actions {
+			req = addActionResult(req, action, responses[idx], tokenBudget)
+		}
+
+		used := usage.Usage().TotalTokens
+
+		log.Info().
+			Str("assistant_id", assistant.ID).
+			Int("step", step).
+			Int("actions", len(actions)).
+			Int("used_tokens", used).
+			Msg("agent step completed")
+
+		if used >= tokenBudget {
+			c.emitAgentStepInfo(ctx, "agent", step, "Token budget used up, answering")
+			return req, nil
+		}
+	}
+
+	c.emitAgentStepInfo(ctx, "agent", maxIterations, fmt.Sprintf("Reached the maximum of %d steps, answering", maxIterations))
+
+	return req, nil
+}
+
+// addActionResult adds the result of the action to the request history, a single result
+// is cut to the estimated tokens of the whole budget
+func addActionResult(req openai.ChatCompletionRequest, action *toolAction, resp *tools.RunActionResponse, tokenBudget int) openai.ChatCompletionRequest {
+	result, _ := truncateToTokens(getActionResult(resp), tokenBudget)
+
+	req.Messages = insertBeforeLastUserMessage(req.Messages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: fmt.Sprintf("I have called the '%s' action, it returned:\n%s", action.action, result),
+	})
+
+	return req
+}
+
+func (c *Controller) emitAgentStepInfo(ctx context.Context, name string, step int, message string) {
+	if err := c.emitStepInfo(ctx, &types.StepInfo{
+		Name:    name,
+		Type:    types.StepInfoTypeToolUse,
+		Message: fmt.Sprintf("Step %d: %s", step, message),
+	}); err != nil {
+		log.Debug().Err(err).Msg("failed to emit step info")
+	}
+}
+
+// getActionResult prefers the raw response as the interpreted message can
+// leave out the details, such as IDs, needed by the next tool calls
+func getActionResult(resp *tools.RunActionResponse) string {
+	if resp.RawMessage != "" {
+		return resp.RawMessage
+	}
+	return resp.Message
+}
+
+// truncateToTokens cuts the text to the estimated number of tokens, returns
+// the text together with its estimated number of tokens
+func truncateToTokens(text string, maxTokens int) (string, int) {
+	runes := []rune(text)
+	maxChars := maxTokens * approxCharsPerToken
+
+	if len(runes) <= maxChars {
+		return text, (len(runes) + approxCharsPerToken - 1) / approxCharsPerToken
+	}
+
+	return string(runes[:maxChars]) + "\n[truncated]", maxTokens
+}
+
+// insertBeforeLastUserMessage keeps the user message last, the planner and the tools
+// take the last message as the user input
+func insertBeforeLastUserMessage(messages []openai.ChatCompletionMessage, message openai.ChatCompletionMessage) []openai.ChatCompletionMessage {
+	idx := len(messages)
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == openai.ChatMessageRoleUser {
+			idx = i
+			break
+		}
+	}
+
+	inserted := make([]openai.ChatCompletionMessage, 0, len(messages)+1)
+	inserted = append(inserted, messages[:idx]...)
+	inserted = append(inserted, message)
+	inserted = append(inserted, messages[idx:]...)
+
+	return inserted
+}
@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	oai "github.com/helixml/helix/api/pkg/openai"
+	"github.com/helixml/helix/api/pkg/store"
+	"github.com/helixml/helix/api/pkg/tools"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+func (suite *ControllerSuite) setupAgentApp(agent *types.AssistantAgent) *tools.MockPlanner {
+	return suite.setupToolsApp(types.AssistantConfig{Agent: agent})
+}
+
+// setupToolsApp sets up an app with the assistant and, unless it has tools, a CRM API tool.
+// The planner is mocked.
+func (suite *ControllerSuite) setupToolsApp(assistant types.AssistantConfig) *tools.MockPlanner {
+	assistant.ID = "0"
+	if assistant.Tools == nil {
+		assistant.Tools = []*types.Tool{
+			{
+				Name:     "crm",
+				ToolType: types.ToolTypeAPI,
+				Config: types.ToolConfig{
+					API: &types.ToolAPIConfig{
+						Actions: []*types.ToolAPIAction{
+							{Name: "getCustomer"},
+							{Name: "listOrders"},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	planner := tools.NewMockPlanner(gomock.NewController(suite.T()))
+	suite.controller.ToolsPlanner = planner
+
+	app := &types.App{
+		ID:     "app_id",
+		Global: true,
+		Config: types.AppConfig{
+			Helix: types.AppHelixConfig{
+				Assistants: []types.AssistantConfig{assistant},
+			},
+		},
+	}
+
+	suite.store.EXPECT().GetAppWithTools(suite.ctx, "app_id").Return(app, nil).AnyTimes()
+	suite.store.EXPECT().ListSecrets(gomock.Any(), &store.ListSecretsQuery{
+		Owner: suite.user.ID,
+	}).Return([]*types.Secret{}, nil).AnyTimes()
+
+	return planner
+}
+
+func (suite *ControllerSuite) Test_Agent_MultipleSteps() {
+	planner := suite.setupAgentApp(&types.AssistantAgent{Enabled: true})
+
+	req := openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: "What did Bob order?"},
+		},
+	}
+
+	gomock.InOrder(
+		planner.EXPECT().IsActionable(gomock.Any(), "", "", gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _, _ string, _ []*types.Tool, history []*types.ToolHistoryMessage, _ ...tools.Option) (*tools.IsActionableResponse, error) {
+				suite.Len(history, 1)
+				return &tools.IsActionableResponse{NeedsTool: tools.NeedsToolYes, API: "getCustomer"}, nil
+			}),
+		planner.EXPECT().RunAction(gomock.Any(), "", "", gomock.Any(), gomock.Any(), "getCustomer").
+			Return(&tools.RunActionResponse{Message: "Found Bob", RawMessage: `{"id": "cus_1"}`}, nil),
+		planner.EXPECT().IsActionable(gomock.Any(), "", "", gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, _, _ string, _ []*types.Tool, history []*types.ToolHistoryMessage, _ ...tools.Option) (*tools.IsActionableResponse, error) {
+				suite.Require().Len(history, 2)
+				suite.Contains(history[0].Content, `{"id": "cus_1"}`)
+				suite.Equal("What did Bob order?", history[1].Content)
+				return &tools.IsActionableResponse{NeedsTool: tools.NeedsToolYes, API: "listOrders"}, nil
+			}),
+		planner.EXPECT().RunAction(gomock.Any(), "", "", gomock.Any(), gomock.Any(), "listOrders").
+			Return(&tools.RunActionResponse{RawMessage: `[{"item": "bike"}]`}, nil),
+		planner.EXPECT().IsActionable(gomock.Any(), "", "", gomock.Any(), gomock.Any()).
+			Return(&tools.IsActionableResponse{NeedsTool: tools.NeedsToolNo}, nil),
+	)
+
+	suite.openAiClient.EXPECT().CreateChatCompletion(suite.ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			suite.Require().Len(req.Messages, 3)
+			suite.Contains(req.Messages[0].Content, "'getCustomer'")
+			suite.Contains(req.Messages[1].Content, "'listOrders'")
+			suite.Equal(openai.ChatMessageRoleUser, req.Messages[2].Role)
+
+			return openai.ChatCompletionResponse{
+				Choices: []openai.ChatCompletionChoice{
+					{Message: openai.ChatCompletionMessage{Content: "Bob ordered a bike"}},
+				},
+			}, nil
+		})
+
+	resp, _, err := suite.controller.ChatCompletion(suite.ctx, suite.user, req, &ChatCompletionOptions{
+		AppID:       "app_id",
+		AssistantID: "0",
+	})
+	suite.Require().NoError(err)
+	suite.Equal("Bob ordered a bike", resp.Choices[0].Message.Content)
+}
+
+func (suite *ControllerSuite) Test_Agent_MaxIterations() {
+	planner := suite.setupAgentApp(&types.AssistantAgent{Enabled: true, MaxIterations: 2})
+
+	req := openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: "What did Bob order?"},
+		},
+	}
+
+	planner.EXPECT().IsActionable(gomock.Any(), "", "", gomock.Any(), gomock.Any()).
+		Return(&tools.IsActionableResponse{NeedsTool: tools.NeedsToolYes, API: "getCustomer"}, nil).
+		Times(2)
+	planner.EXPECT().RunAction(gomock.Any(), "", "", gomock.Any(), gomock.Any(), "getCustomer").
+		Return(&tools.RunActionResponse{RawMessage: `{"id": "cus_1"}`}, nil).
+		Times(2)
+
+	suite.openAiClient.EXPECT().CreateChatCompletion(suite.ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			suite.Len(req.Messages, 3)
+
+			return openai.ChatCompletionResponse{
+				Choices: []openai.ChatCompletionChoice{
+					{Message: openai.ChatCompletionMessage{Content: "Bob is cus_1"}},
+				},
+			}, nil
+		})
+
+	_, _, err := suite.controller.ChatCompletion(suite.ctx, suite.user, req, &ChatCompletionOptions{
+		AppID:       "app_id",
+		AssistantID: "0",
+	})
+	suite.Require().NoError(err)
+}
+
+func (suite *ControllerSuite) Test_Agent_TokenBudget() {
+	planner := suite.setupAgentApp(&types.AssistantAgent{Enabled: true, TokenBudget: 1000})
+
+	req := openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: "List Bob's orders"},
+		},
+	}
+
+	// The planner and the tool report the usage of their LLM calls, the second
+	// step goes over the budget and the agent answers without planning again
+	gomock.InOrder(
+		planner.EXPECT().IsActionable(gomock.Any(), "", "", gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, _, _ string, _ []*types.Tool, _ []*types.ToolHistoryMessage, _ ...tools.Option) (*tools.IsActionableResponse, error) {
+				oai.AddUsage(ctx, openai.Usage{TotalTokens: 400})
+				return &tools.IsActionableResponse{NeedsTool: tools.NeedsToolYes, API: "getCustomer"}, nil
+			}),
+		planner.EXPECT().RunAction(gomock.Any(), "", "", gomock.Any(), gomock.Any(), "getCustomer").DoAndReturn(
+			func(ctx context.Context, _, _ string, _ *types.Tool, _ []*types.ToolHistoryMessage, _ string) (*tools.RunActionResponse, error) {
+				oai.AddUsage(ctx, openai.Usage{TotalTokens: 300})
+				return &tools.RunActionResponse{RawMessage: `{"id": "cus_1"}`}, nil
+			}),
+		planner.EXPECT().IsActionable(gomock.Any(), "", "", gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, _, _ string, _ []*types.Tool, _ []*types.ToolHistoryMessage, _ ...tools.Option) (*tools.IsActionableResponse, error) {
+				oai.AddUsage(ctx, openai.Usage{TotalTokens: 500})
+				return &tools.IsActionableResponse{NeedsTool: tools.NeedsToolYes, API: "listOrders"}, nil
+			}),
+		planner.EXPECT().RunAction(gomock.Any(), "", "", gomock.Any(), gomock.Any(), "listOrders").
+			Return(&tools.RunActionResponse{RawMessage: strings.Repeat("order ", 1000)}, nil),
+	)
+
+	suite.openAiClient.EXPECT().CreateChatCompletion(suite.ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			suite.Require().Len(req.Messages, 3)
+			suite.Contains(req.Messages[0].Content, "cus_1")
+			// A single result is cut to the budget
+			suite.Contains(req.Messages[1].Content, "[truncated]")
+
+			return openai.ChatCompletionResponse{
+				Choices: []openai.ChatCompletionChoice{
+					{Message: openai.ChatCompletionMessage{Content: "Bob has many orders"}},
+				},
+			}, nil
+		})
+
+	_, _, err := suite.controller.ChatCompletion(suite.ctx, suite.user, req, &ChatCompletionOptions{
+		AppID:       "app_id",
+		AssistantID: "0",
+	})
+	suite.Require().NoError(err)
+}
+
+func Test_truncateToTokens(t *testing.T) {
+	text, tokens := truncateToTokens("hello world", 10)
+	assert.Equal(t, "hello world", text)
+	assert.Equal(t, 3, tokens)
+
+	text, tokens = truncateToTokens("hello world", 2)
+	assert.Equal(t, "hello wo\n[truncated]", text)
+	assert.Equal(t, 2, tokens)
+}
+
+func Test_insertBeforeLastUserMessage(t *testing.T) {
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "hi"},
+		{Role: openai.ChatMessageRoleAssistant, Content: "hello"},
+		{Role: openai.ChatMessageRoleUser, Content: "what's up?"},
+	}
+
+	inserted := insertBeforeLastUserMessage(messages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: "result",
+	})
+
+	assert.Equal(t, []string{"hi", "hello", "result", "what's up?"}, []string{
+		inserted[0].Content, inserted[1].Content, inserted[2].Content, inserted[3].Content,
+	})
+	assert.Equal(t, "what's up?", messages[2].Content)
+}
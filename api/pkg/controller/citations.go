@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+// docIDMarkerRegexp matches the references the prompt templates ask for, such as
+// [DOC_ID:f6962c8007] or [DOC_ID:f6962c8007, DOC_ID:a3f0c2d1e5]
+var docIDMarkerRegexp = regexp.MustCompile(` ?\[DOC_ID:[^\]]*\]`)
+
+// getCitations returns the retrieved chunks the answer refers to with the [DOC_ID:...] markers
+// in the order they are first referenced. The markers of the documents that were not retrieved
+// are made up by the model, they are removed from the returned answer.
+func getCitations(answer string, sources []*types.SessionRAGResult) (string, []*types.Citation) {
+	if !strings.Contains(answer, "DOC_ID:") {
+		return answer, nil
+	}
+
+	chunks := make(map[string][]*types.SessionRAGResult)
+	for _, source := range sources {
+		chunks[source.DocumentID] = append(chunks[source.DocumentID], source)
+	}
+
+	var (
+		citations []*types.Citation
+		cited     = make(map[string]bool)
+		invalid   []string
+	)
+
+	answer = docIDMarkerRegexp.ReplaceAllStringFunc(answer, func(marker string) string {
+		var valid []string
+
+		for _, documentID := range parseDocIDMarker(marker) {
+			if len(chunks[documentID]) == 0 {
+				invalid = append(invalid, documentID)
+				continue
+			}
+
+			valid = append(valid, "DOC_ID:"+documentID)
+
+			if cited[documentID] {
+				continue
+			}
+			cited[documentID] = true
+
+			for _, chunk := range chunks[documentID] {
+				citations = append(citations, newCitation(chunk))
+			}
+		}
+
+		// The space before the marker goes with it
+		if len(valid) == 0 {
+			return ""
+		}
+
+		var space string
+		if strings.HasPrefix(marker, " ") {
+			space = " "
+		}
+		return space + "[" + strings.Join(valid, ", ") + "]"
+	})
+
+	if len(invalid) > 0 {
+		log.Warn().
+			Strs("document_ids", invalid).
+			Msg("answer refers to documents that were not retrieved, removing the references")
+	}
+
+	return answer, dedupeCitations(citations)
+}
+
+// parseDocIDMarker returns the document IDs of a [DOC_ID:...] marker
+func parseDocIDMarker(marker string) []string {
+	var documentIDs []string
+
+	inner := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(marker), "["), "]")
+	for _, id := range strings.Split(inner, ",") {
+		id = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(id), "DOC_ID:"))
+		if id != "" {
+			documentIDs = append(documentIDs, id)
+		}
+	}
+
+	return documentIDs
+}
+
+func newCitation(chunk *types.SessionRAGResult) *types.Citation {
+	citation := &types.Citation{
+		DocumentID:    chunk.DocumentID,
+		Source:        chunk.Source,
+		ContentOffset: chunk.ContentOffset,
+		Section:       chunk.Metadata["section"],
+	}
+
+	if citation.Source == "" {
+		citation.Source = chunk.Filename
+	}
+
+	if page, err := strconv.Atoi(chunk.Metadata["page"]); err == nil {
+		citation.Page = page
+	}
+
+	return citation
+}
+
+// dedupeCitations drops the chunks that were retrieved more than once, for
+// example by the rewritten queries or from several knowledge sources
+func dedupeCitations(citations []*types.Citation) []*types.Citation {
+	type key struct {
+		documentID string
+		offset     int
+	}
+
+	seen := make(map[key]bool)
+	deduped := citations[:0]
+
+	for _, citation := range citations {
+		k := key{documentID: citation.DocumentID, offset: citation.ContentOffset}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		deduped = append(deduped, citation)
+	}
+
+	if len(deduped) == 0 {
+		return nil
+	}
+	return deduped
+}
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+func Test_getCitations(t *testing.T) {
+	sources := []*types.SessionRAGResult{
+		{DocumentID: "doc_1", Filename: "guide.md", ContentOffset: 0, Metadata: map[string]string{"section": "Guide"}},
+		{DocumentID: "doc_1", Filename: "guide.md", ContentOffset: 3, Metadata: map[string]string{"section": "Guide > Setup"}},
+		{DocumentID: "doc_2", Source: "https://example.com/faq", ContentOffset: 1},
+		// Found by another knowledge too
+		{DocumentID: "doc_2", Source: "https://example.com/faq", ContentOffset: 1},
+	}
+
+	t.Run("NoReferences", func(t *testing.T) {
+		answer, citations := getCitations("The answer is 42.", sources)
+		assert.Equal(t, "The answer is 42.", answer)
+		assert.Nil(t, citations)
+	})
+
+	t.Run("ReferencedDocuments", func(t *testing.T) {
+		answer, citations := getCitations("Install it first [DOC_ID:doc_2], see [DOC_ID:doc_1, DOC_ID:doc_2].", sources)
+		assert.Equal(t, "Install it first [DOC_ID:doc_2], see [DOC_ID:doc_1, DOC_ID:doc_2].", answer)
+		assert.Equal(t, []*types.Citation{
+			{DocumentID: "doc_2", Source: "https://example.com/faq", ContentOffset: 1},
+			{DocumentID: "doc_1", Source: "guide.md", ContentOffset: 0, Section: "Guide"},
+			{DocumentID: "doc_1", Source: "guide.md", ContentOffset: 3, Section: "Guide > Setup"},
+		}, citations)
+	})
+
+	t.Run("MadeUpReferences", func(t *testing.T) {
+		answer, citations := getCitations("According to [DOC_ID:f6962c8007], the answer is 42 [DOC_ID:doc_9, DOC_ID:doc_2].", sources)
+		assert.Equal(t, "According to, the answer is 42 [DOC_ID:doc_2].", answer)
+		assert.Equal(t, []*types.Citation{
+			{DocumentID: "doc_2", Source: "https://example.com/faq", ContentOffset: 1},
+		}, citations)
+	})
+
+	t.Run("NoSources", func(t *testing.T) {
+		answer, citations := getCitations("The answer is 42 [DOC_ID:doc_1].", nil)
+		assert.Equal(t, "The answer is 42.", answer)
+		assert.Nil(t, citations)
+	})
+}
@@ -154,6 +154,7 @@ func (c *Controller) convertDocumentsToText(ctx context.Context, session *types.
 				}
 
 				extractRequest.Content = bts
+				extractRequest.Filename = file
 			}
 
 			extractedText, err := c.Options.Extractor.Extract(c.Ctx, extractRequest)
@@ -4,21 +4,25 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/helixml/helix/api/pkg/data"
 	"github.com/helixml/helix/api/pkg/model"
 	oai "github.com/helixml/helix/api/pkg/openai"
 	"github.com/helixml/helix/api/pkg/openai/manager"
+	"github.com/helixml/helix/api/pkg/openai/transport"
 	"github.com/helixml/helix/api/pkg/prompts"
 	"github.com/helixml/helix/api/pkg/pubsub"
 	"github.com/helixml/helix/api/pkg/rag"
 	"github.com/helixml/helix/api/pkg/store"
+	"github.com/helixml/helix/api/pkg/system"
 	"github.com/helixml/helix/api/pkg/tools"
 	"github.com/helixml/helix/api/pkg/types"
 	"gopkg.in/yaml.v2"
 
 	"github.com/rs/zerolog/log"
 	openai "github.com/sashabaranov/go-openai"
+	"github.com/sourcegraph/conc/pool"
 )
 
 type ChatCompletionOptions struct {
@@ -30,17 +34,37 @@ type ChatCompletionOptions struct {
 	QueryParams map[string]string
 }
 
+// ChatCompletionStream streams the chat completion, the citations of the knowledge
+// used in the answer are known once the whole answer has been received
+type ChatCompletionStream struct {
+	*openai.ChatCompletionStream
+
+	sources []*types.SessionRAGResult
+}
+
+// Citations returns the answer without the references to the documents that
+// were not retrieved and the citations of the chunks the answer refers to
+func (s *ChatCompletionStream) Citations(answer string) (string, []*types.Citation) {
+	return getCitations(answer, s.sources)
+}
+
 // ChatCompletion is used by the OpenAI compatible API. Doesn't handle any historical sessions, etc.
-// Runs the OpenAI with tools/app configuration and returns the response.
+// Runs the OpenAI with tools/app configuration and returns the response with the citations of the knowledge.
 // Returns the updated request because the controller mutates it when doing e.g. tools calls and RAG
-func (c *Controller) ChatCompletion(ctx context.Context, user *types.User, req openai.ChatCompletionRequest, opts *ChatCompletionOptions) (*openai.ChatCompletionResponse, *openai.ChatCompletionRequest, error) {
+func (c *Controller) ChatCompletion(ctx context.Context, user *types.User, req openai.ChatCompletionRequest, opts *ChatCompletionOptions) (*types.ChatCompletionResponse, *openai.ChatCompletionRequest, error) {
 	assistant, err := c.loadAssistant(ctx, user, opts)
 	if err != nil {
 		log.Info().Msg("no assistant found")
 		return nil, nil, err
 	}
 
-	if len(assistant.Tools) > 0 {
+	if len(assistant.Tools) > 0 && assistant.Agent != nil && assistant.Agent.Enabled {
+		// The assistant answers with the results of the tools it called
+		req, err = c.runAgent(ctx, req, opts, assistant)
+		if err != nil {
+			return nil, nil, fmt.Errorf("agent failed: %w", err)
+		}
+	} else if len(assistant.Tools) > 0 {
 		// Check whether the app is configured for the call,
 		// if yes, execute the tools and return the response
 		toolResp, ok, err := c.evaluateToolUsage(ctx, user, req, opts)
@@ -49,7 +73,7 @@ func (c *Controller) ChatCompletion(ctx context.Context, user *types.User, req o
 		}
 
 		if ok {
-			return toolResp, &req, nil
+			return &types.ChatCompletionResponse{ChatCompletionResponse: *toolResp}, &req, nil
 		}
 	}
 
@@ -74,7 +98,7 @@ func (c *Controller) ChatCompletion(ctx context.Context, user *types.User, req o
 		opts.Provider = assistant.Provider
 	}
 
-	err = c.enrichPromptWithKnowledge(ctx, user, &req, assistant, opts)
+	sources, err := c.enrichPromptWithKnowledge(ctx, user, &req, assistant, opts)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to enrich prompt with knowledge: %w", err)
 	}
@@ -90,12 +114,29 @@ func (c *Controller) ChatCompletion(ctx context.Context, user *types.User, req o
 		return nil, nil, err
 	}
 
-	return &resp, &req, nil
+	return withCitations(resp, sources), &req, nil
+}
+
+// withCitations adds the citations of the retrieved chunks the choices refer to
+func withCitations(resp openai.ChatCompletionResponse, sources []*types.SessionRAGResult) *types.ChatCompletionResponse {
+	var citations []*types.Citation
+
+	for idx := range resp.Choices {
+		answer, choiceCitations := getCitations(resp.Choices[idx].Message.Content, sources)
+
+		resp.Choices[idx].Message.Content = answer
+		citations = append(citations, choiceCitations...)
+	}
+
+	return &types.ChatCompletionResponse{
+		ChatCompletionResponse: resp,
+		Citations:              dedupeCitations(citations),
+	}
 }
 
 // ChatCompletionStream is used by the OpenAI compatible API. Doesn't handle any historical sessions, etc.
 // Runs the OpenAI with tools/app configuration and returns the stream.
-func (c *Controller) ChatCompletionStream(ctx context.Context, user *types.User, req openai.ChatCompletionRequest, opts *ChatCompletionOptions) (*openai.ChatCompletionStream, *openai.ChatCompletionRequest, error) {
+func (c *Controller) ChatCompletionStream(ctx context.Context, user *types.User, req openai.ChatCompletionRequest, opts *ChatCompletionOptions) (*ChatCompletionStream, *openai.ChatCompletionRequest, error) {
 	req.Stream = true
 
 	assistant, err := c.loadAssistant(ctx, user, opts)
@@ -104,7 +145,13 @@ func (c *Controller) ChatCompletionStream(ctx context.Context, user *types.User,
 		return nil, nil, err
 	}
 
-	if len(assistant.Tools) > 0 {
+	if len(assistant.Tools) > 0 && assistant.Agent != nil && assistant.Agent.Enabled {
+		// The assistant answers with the results of the tools it called
+		req, err = c.runAgent(ctx, req, opts, assistant)
+		if err != nil {
+			return nil, nil, fmt.Errorf("agent failed: %w", err)
+		}
+	} else if len(assistant.Tools) > 0 {
 		// Check whether the app is configured for the call,
 		// if yes, execute the tools and return the response
 		toolRespStream, ok, err := c.evaluateToolUsageStream(ctx, user, req, opts)
@@ -113,7 +160,7 @@ func (c *Controller) ChatCompletionStream(ctx context.Context, user *types.User,
 		}
 
 		if ok {
-			return toolRespStream, &req, nil
+			return &ChatCompletionStream{ChatCompletionStream: toolRespStream}, &req, nil
 		}
 	}
 
@@ -139,7 +186,7 @@ func (c *Controller) ChatCompletionStream(ctx context.Context, user *types.User,
 	}
 
 	// Check for knowledge
-	err = c.enrichPromptWithKnowledge(ctx, user, &req, assistant, opts)
+	sources, err := c.enrichPromptWithKnowledge(ctx, user, &req, assistant, opts)
 	if err != nil {
 		return nil, nil, fmt.Errorf("failed to enrich prompt with knowledge: %w", err)
 	}
@@ -155,7 +202,7 @@ func (c *Controller) ChatCompletionStream(ctx context.Context, user *types.User,
 		return nil, nil, err
 	}
 
-	return stream, &req, nil
+	return &ChatCompletionStream{ChatCompletionStream: stream, sources: sources}, &req, nil
 }
 
 func (c *Controller) getClient(ctx context.Context, provider types.Provider) (oai.Client, error) {
@@ -174,13 +221,26 @@ func (c *Controller) getClient(ctx context.Context, provider types.Provider) (oa
 
 }
 
+// defaultMaxParallelToolCalls is used when the assistant doesn't limit the parallel tool calls
+const defaultMaxParallelToolCalls = 4
+
+// toolAction is an action chosen by the planner, the actions chosen with native
+// function calling carry the arguments of the tool call too
+type toolAction struct {
+	// id tells apart the LLM calls and the step infos of the actions running in parallel
+	id       string
+	tool     *types.Tool
+	action   string
+	toolCall *openai.ToolCall
+}
+
 func (c *Controller) evaluateToolUsage(ctx context.Context, user *types.User, req openai.ChatCompletionRequest, opts *ChatCompletionOptions) (*openai.ChatCompletionResponse, bool, error) {
 	vals, ok := oai.GetContextValues(ctx)
 	if !ok {
 		vals = &oai.ContextValues{}
 	}
 
-	selectedTool, isActionable, ok, err := c.selectAndConfigureTool(ctx, user, req, opts)
+	assistant, actions, ok, err := c.selectAndConfigureTools(ctx, user, req, opts)
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to select and configure tool: %w", err)
 	}
@@ -191,40 +251,16 @@ func (c *Controller) evaluateToolUsage(ctx context.Context, user *types.User, re
 
 	history := types.HistoryFromChatCompletionRequest(req)
 
-	if err := c.emitStepInfo(ctx, &types.StepInfo{
-		Name:    selectedTool.Name,
-		Type:    types.StepInfoTypeToolUse,
-		Message: "Running action",
-	}); err != nil {
-		log.Debug().Err(err).Msg("failed to emit run action step info")
-	}
-
-	resp, err := c.ToolsPlanner.RunAction(ctx, vals.SessionID, vals.InteractionID, selectedTool, history, isActionable.API)
+	responses, err := c.runToolActions(ctx, vals, assistant, history, actions)
 	if err != nil {
-		if emitErr := c.emitStepInfo(ctx, &types.StepInfo{
-			Name:    selectedTool.Name,
-			Type:    types.StepInfoTypeToolUse,
-			Message: fmt.Sprintf("Action failed: %s", err),
-		}); emitErr != nil {
-			log.Debug().Err(err).Msg("failed to emit run action step info")
-		}
-
-		return nil, false, fmt.Errorf("failed to perform action: %w", err)
-	}
-
-	if err := c.emitStepInfo(ctx, &types.StepInfo{
-		Name:    selectedTool.Name,
-		Type:    types.StepInfoTypeToolUse,
-		Message: "Action completed",
-	}); err != nil {
-		log.Debug().Err(err).Msg("failed to emit run action step info")
+		return nil, false, err
 	}
 
 	return &openai.ChatCompletionResponse{
 		Choices: []openai.ChatCompletionChoice{
 			{
 				Message: openai.ChatCompletionMessage{
-					Content: resp.Message,
+					Content: joinActionMessages(responses),
 				},
 			},
 		},
@@ -237,7 +273,7 @@ func (c *Controller) evaluateToolUsageStream(ctx context.Context, user *types.Us
 		vals = &oai.ContextValues{}
 	}
 
-	selectedTool, isActionable, ok, err := c.selectAndConfigureTool(ctx, user, req, opts)
+	assistant, actions, ok, err := c.selectAndConfigureTools(ctx, user, req, opts)
 	if err != nil {
 		return nil, false, fmt.Errorf("failed to select and configure tool: %w", err)
 	}
@@ -248,26 +284,51 @@ func (c *Controller) evaluateToolUsageStream(ctx context.Context, user *types.Us
 
 	history := types.HistoryFromChatCompletionRequest(req)
 
+	// The answers of several tool calls are streamed together once all of them are done
+	if len(actions) > 1 {
+		responses, err := c.runToolActions(ctx, vals, assistant, history, actions)
+		if err != nil {
+			return nil, false, err
+		}
+
+		stream, err := newMessageStream(joinActionMessages(responses))
+		if err != nil {
+			return nil, false, err
+		}
+
+		return stream, true, nil
+	}
+
+	action := actions[0]
+	ctx = oai.SetToolCallID(ctx, action.id)
+
 	if err := c.emitStepInfo(ctx, &types.StepInfo{
-		Name:    selectedTool.Name,
-		Type:    types.StepInfoTypeToolUse,
-		Message: "Running action",
+		Name:       action.tool.Name,
+		Type:       types.StepInfoTypeToolUse,
+		Message:    "Running action",
+		ToolCallID: action.id,
 	}); err != nil {
 		log.Debug().Err(err).Msg("failed to emit step info")
 	}
 
-	stream, err := c.ToolsPlanner.RunActionStream(ctx, vals.SessionID, vals.InteractionID, selectedTool, history, isActionable.API)
+	var stream *openai.ChatCompletionStream
+	if action.toolCall != nil {
+		stream, err = c.ToolsPlanner.RunToolCallStream(ctx, vals.SessionID, vals.InteractionID, action.tool, history, *action.toolCall)
+	} else {
+		stream, err = c.ToolsPlanner.RunActionStream(ctx, vals.SessionID, vals.InteractionID, action.tool, history, action.action)
+	}
 	if err != nil {
 		log.Warn().
 			Err(err).
-			Str("tool", selectedTool.Name).
-			Str("action", isActionable.API).
+			Str("tool", action.tool.Name).
+			Str("action", action.action).
 			Msg("failed to perform action")
 
 		if emitErr := c.emitStepInfo(ctx, &types.StepInfo{
-			Name:    selectedTool.Name,
-			Type:    types.StepInfoTypeToolUse,
-			Message: fmt.Sprintf("Action failed: %s", err),
+			Name:       action.tool.Name,
+			Type:       types.StepInfoTypeToolUse,
+			Message:    fmt.Sprintf("Action failed: %s", err),
+			ToolCallID: action.id,
 		}); emitErr != nil {
 			log.Debug().Err(err).Msg("failed to emit step info")
 		}
@@ -276,9 +337,10 @@ func (c *Controller) evaluateToolUsageStream(ctx context.Context, user *types.Us
 	}
 
 	if err := c.emitStepInfo(ctx, &types.StepInfo{
-		Name:    selectedTool.Name,
-		Type:    types.StepInfoTypeToolUse,
-		Message: "Action completed",
+		Name:       action.tool.Name,
+		Type:       types.StepInfoTypeToolUse,
+		Message:    "Action completed",
+		ToolCallID: action.id,
 	}); err != nil {
 		log.Debug().Err(err).Msg("failed to emit step info")
 	}
@@ -286,7 +348,121 @@ func (c *Controller) evaluateToolUsageStream(ctx context.Context, user *types.Us
 	return stream, true, nil
 }
 
-func (c *Controller) selectAndConfigureTool(ctx context.Context, user *types.User, req openai.ChatCompletionRequest, opts *ChatCompletionOptions) (*types.Tool, *tools.IsActionableResponse, bool, error) {
+// runToolActions runs the independent actions concurrently, up to the assistant's limit of
+// parallel tool calls. The responses are returned in the call order.
+func (c *Controller) runToolActions(ctx context.Context, vals *oai.ContextValues, assistant *types.AssistantConfig, history []*types.ToolHistoryMessage, actions []*toolAction) ([]*tools.RunActionResponse, error) {
+	responses := make([]*tools.RunActionResponse, len(actions))
+
+	p := pool.New().WithErrors().WithMaxGoroutines(getMaxParallelToolCalls(assistant))
+	for idx, action := range actions {
+		p.Go(func() error {
+			resp, err := c.runToolAction(ctx, vals, history, action)
+			if err != nil {
+				return err
+			}
+			responses[idx] = resp
+			return nil
+		})
+	}
+
+	if err := p.Wait(); err != nil {
+		return nil, err
+	}
+
+	return responses, nil
+}
+
+func getMaxParallelToolCalls(assistant *types.AssistantConfig) int {
+	if assistant != nil && assistant.MaxParallelToolCalls > 0 {
+		return assistant.MaxParallelToolCalls
+	}
+	return defaultMaxParallelToolCalls
+}
+
+// joinActionMessages merges the answers of the actions into a single message
+func joinActionMessages(responses []*tools.RunActionResponse) string {
+	messages := make([]string, 0, len(responses))
+	for _, resp := range responses {
+		messages = append(messages, resp.Message)
+	}
+	return strings.Join(messages, "\n\n")
+}
+
+// runToolAction runs a single action, its LLM calls and step infos are
+// tagged with the action ID
+func (c *Controller) runToolAction(ctx context.Context, vals *oai.ContextValues, history []*types.ToolHistoryMessage, action *toolAction) (*tools.RunActionResponse, error) {
+	ctx = oai.SetToolCallID(ctx, action.id)
+
+	if err := c.emitStepInfo(ctx, &types.StepInfo{
+		Name:       action.tool.Name,
+		Type:       types.StepInfoTypeToolUse,
+		Message:    fmt.Sprintf("Running action %s", action.action),
+		ToolCallID: action.id,
+	}); err != nil {
+		log.Debug().Err(err).Msg("failed to emit run action step info")
+	}
+
+	var (
+		resp *tools.RunActionResponse
+		err  error
+	)
+	if action.toolCall != nil {
+		resp, err = c.ToolsPlanner.RunToolCall(ctx, vals.SessionID, vals.InteractionID, action.tool, history, *action.toolCall)
+	} else {
+		resp, err = c.ToolsPlanner.RunAction(ctx, vals.SessionID, vals.InteractionID, action.tool, history, action.action)
+	}
+	if err != nil {
+		if emitErr := c.emitStepInfo(ctx, &types.StepInfo{
+			Name:       action.tool.Name,
+			Type:       types.StepInfoTypeToolUse,
+			Message:    fmt.Sprintf("Action %s failed: %s", action.action, err),
+			ToolCallID: action.id,
+		}); emitErr != nil {
+			log.Debug().Err(err).Msg("failed to emit run action step info")
+		}
+
+		return nil, fmt.Errorf("failed to perform action %s: %w", action.action, err)
+	}
+
+	if err := c.emitStepInfo(ctx, &types.StepInfo{
+		Name:       action.tool.Name,
+		Type:       types.StepInfoTypeToolUse,
+		Message:    fmt.Sprintf("Action %s completed", action.action),
+		ToolCallID: action.id,
+	}); err != nil {
+		log.Debug().Err(err).Msg("failed to emit run action step info")
+	}
+
+	return resp, nil
+}
+
+// newMessageStream streams the already complete message
+func newMessageStream(message string) (*openai.ChatCompletionStream, error) {
+	stream, writer, err := transport.NewOpenAIStreamingAdapter(openai.ChatCompletionRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create streaming adapter: %w", err)
+	}
+
+	go func() {
+		defer writer.Close()
+
+		if err := transport.WriteChatCompletionStream(writer, &openai.ChatCompletionStreamResponse{
+			Choices: []openai.ChatCompletionStreamChoice{
+				{
+					Delta: openai.ChatCompletionStreamChoiceDelta{
+						Content: message,
+					},
+				},
+			},
+		}); err != nil {
+			log.Error().Err(err).Msg("failed streaming the tool actions answer")
+		}
+	}()
+
+	return stream, nil
+}
+
+func (c *Controller) selectAndConfigureTools(ctx context.Context, user *types.User, req openai.ChatCompletionRequest, opts *ChatCompletionOptions) (*types.AssistantConfig, []*toolAction, bool, error) {
 	assistant, err := c.loadAssistant(ctx, user, opts)
 	if err != nil {
 		log.Info().Msg("no assistant found")
@@ -299,18 +475,7 @@ func (c *Controller) selectAndConfigureTool(ctx context.Context, user *types.Use
 			Str("assistant_name", assistant.Name).
 			Str("assistant_model", assistant.Model).
 			Msg("assistant has no tools")
-		return nil, nil, false, nil
-	}
-
-	var options []tools.Option
-
-	// If assistant has configured an actionable template, use it
-	if assistant != nil && assistant.IsActionableTemplate != "" {
-		options = append(options, tools.WithIsActionableTemplate(assistant.IsActionableTemplate))
-	}
-	// If assistant has configured a model, use it
-	if assistant != nil && assistant.Model != "" {
-		options = append(options, tools.WithModel(assistant.Model))
+		return assistant, nil, false, nil
 	}
 
 	history := types.HistoryFromChatCompletionRequest(req)
@@ -328,13 +493,12 @@ func (c *Controller) selectAndConfigureTool(ctx context.Context, user *types.Use
 		log.Debug().Err(err).Msg("failed to emit step info")
 	}
 
-	isActionable, err := c.ToolsPlanner.IsActionable(ctx, vals.SessionID, vals.InteractionID, assistant.Tools, history, options...)
+	actions, err := c.planToolActions(ctx, vals, assistant, history, opts)
 	if err != nil {
-		log.Error().Err(err).Msg("failed to evaluate if the message is actionable, skipping to general knowledge")
-		return nil, nil, false, fmt.Errorf("failed to evaluate if the message is actionable: %w", err)
+		return nil, nil, false, err
 	}
 
-	if !isActionable.Actionable() {
+	if len(actions) == 0 {
 		if err := c.emitStepInfo(ctx, &types.StepInfo{
 			Name:    "is_actionable",
 			Type:    types.StepInfoTypeToolUse,
@@ -343,14 +507,110 @@ func (c *Controller) selectAndConfigureTool(ctx context.Context, user *types.Use
 			log.Debug().Err(err).Msg("failed to emit step info")
 		}
 
-		return nil, nil, false, nil
+		return assistant, nil, false, nil
 	}
 
-	selectedTool, ok := tools.GetToolFromAction(assistant.Tools, isActionable.API)
-	if !ok {
-		return nil, nil, false, fmt.Errorf("tool not found for action: %s", isActionable.API)
+	return assistant, actions, true, nil
+}
+
+// planToolActions asks the planner which actions are needed to answer the last message,
+// no actions are returned when the assistant should answer without the tools
+func (c *Controller) planToolActions(ctx context.Context, vals *oai.ContextValues, assistant *types.AssistantConfig, history []*types.ToolHistoryMessage, opts *ChatCompletionOptions) ([]*toolAction, error) {
+	options := getPlannerOptions(assistant)
+
+	if assistant.ToolCalling == types.ToolCallingNative {
+		calls, functions, err := c.ToolsPlanner.SelectToolCalls(ctx, vals.SessionID, vals.InteractionID, assistant.Tools, history, options...)
+		if err == nil {
+			return getToolCallActions(assistant, calls, functions, opts)
+		}
+
+		log.Warn().
+			Err(err).
+			Str("assistant_id", assistant.ID).
+			Msg("native tool calling failed, falling back to the is_actionable prompt")
+	}
+
+	isActionable, err := c.ToolsPlanner.IsActionable(ctx, vals.SessionID, vals.InteractionID, assistant.Tools, history, options...)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to evaluate if the message is actionable, skipping to general knowledge")
+		return nil, fmt.Errorf("failed to evaluate if the message is actionable: %w", err)
+	}
+
+	if !isActionable.Actionable() {
+		return nil, nil
+	}
+
+	var actions []*toolAction
+
+	for _, action := range isActionable.Actions() {
+		selectedTool, ok := tools.GetToolFromAction(assistant.Tools, action)
+		if !ok {
+			return nil, fmt.Errorf("tool not found for action: %s", action)
+		}
+
+		configureTool(assistant, selectedTool, opts)
+
+		actions = append(actions, &toolAction{
+			id:     system.GenerateToolCallID(),
+			tool:   selectedTool,
+			action: action,
+		})
+	}
+
+	return actions, nil
+}
+
+// getToolCallActions looks up the tools and actions of the called functions by the function
+// names, the actions of different tools can have the same name
+func getToolCallActions(assistant *types.AssistantConfig, calls []openai.ToolCall, functions map[string]*tools.ToolFunction, opts *ChatCompletionOptions) ([]*toolAction, error) {
+	actions := make([]*toolAction, 0, len(calls))
+
+	for idx := range calls {
+		call := calls[idx]
+
+		function, ok := functions[call.Function.Name]
+		if !ok {
+			return nil, fmt.Errorf("tool not found for function: %s", call.Function.Name)
+		}
+
+		selectedTool := function.Tool
+		configureTool(assistant, selectedTool, opts)
+
+		// The tools run the action, not the function
+		call.Function.Name = function.Action
+
+		id := call.ID
+		if id == "" {
+			id = system.GenerateToolCallID()
+		}
+
+		actions = append(actions, &toolAction{
+			id:       id,
+			tool:     selectedTool,
+			action:   call.Function.Name,
+			toolCall: &call,
+		})
+	}
+
+	return actions, nil
+}
+
+func getPlannerOptions(assistant *types.AssistantConfig) []tools.Option {
+	var options []tools.Option
+
+	// If assistant has configured an actionable template, use it
+	if assistant != nil && assistant.IsActionableTemplate != "" {
+		options = append(options, tools.WithIsActionableTemplate(assistant.IsActionableTemplate))
+	}
+	// If assistant has configured a model, use it
+	if assistant != nil && assistant.Model != "" {
+		options = append(options, tools.WithModel(assistant.Model))
 	}
 
+	return options
+}
+
+func configureTool(assistant *types.AssistantConfig, selectedTool *types.Tool, opts *ChatCompletionOptions) {
 	// If assistant has configured a model, give the hint to the tool that it should use that model too
 	if assistant != nil && assistant.Model != "" {
 		if selectedTool.Config.API != nil && selectedTool.Config.API.Model == "" {
@@ -363,6 +623,10 @@ func (c *Controller) selectAndConfigureTool(ctx context.Context, user *types.Use
 
 			selectedTool.Config.API.Model = assistant.Model
 		}
+
+		if selectedTool.Config.MCP != nil && selectedTool.Config.MCP.Model == "" {
+			selectedTool.Config.MCP.Model = assistant.Model
+		}
 	}
 
 	if len(opts.QueryParams) > 0 && selectedTool.Config.API != nil {
@@ -372,8 +636,6 @@ func (c *Controller) selectAndConfigureTool(ctx context.Context, user *types.Use
 			selectedTool.Config.API.Query[k] = v
 		}
 	}
-
-	return selectedTool, isActionable, true, nil
 }
 
 func (c *Controller) loadAssistant(ctx context.Context, user *types.User, opts *ChatCompletionOptions) (*types.AssistantConfig, error) {
@@ -461,41 +723,43 @@ func enrichAppWithSecrets(app *types.App, secrets []*types.Secret) (*types.App,
 	return &enrichedApp, nil
 }
 
-func (c *Controller) enrichPromptWithKnowledge(ctx context.Context, user *types.User, req *openai.ChatCompletionRequest, assistant *types.AssistantConfig, opts *ChatCompletionOptions) error {
+// enrichPromptWithKnowledge extends the last message with the retrieved knowledge and
+// returns the retrieved chunks, the answer can cite them
+func (c *Controller) enrichPromptWithKnowledge(ctx context.Context, user *types.User, req *openai.ChatCompletionRequest, assistant *types.AssistantConfig, opts *ChatCompletionOptions) ([]*types.SessionRAGResult, error) {
 	// Check for an extra RAG context
-	ragResults, err := c.evaluateRAG(ctx, user, *req, opts)
+	ragResults, ragSources, err := c.evaluateRAG(ctx, user, *req, opts)
 	if err != nil {
-		return fmt.Errorf("failed to load RAG: %w", err)
+		return nil, fmt.Errorf("failed to load RAG: %w", err)
 	}
 
-	knowledgeResults, knowledge, err := c.evaluateKnowledge(ctx, *req, assistant, opts)
+	knowledgeResults, knowledge, knowledgeSources, err := c.evaluateKnowledge(ctx, *req, assistant, opts)
 	if err != nil {
-		return fmt.Errorf("failed to load knowledge: %w", err)
+		return nil, fmt.Errorf("failed to load knowledge: %w", err)
 	}
 
 	if len(ragResults) > 0 || len(knowledgeResults) > 0 {
 		// Extend last message with the RAG results
 		err := extendMessageWithKnowledge(req, ragResults, knowledge, knowledgeResults)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 
-	return nil
+	return append(ragSources, knowledgeSources...), nil
 }
 
-func (c *Controller) evaluateRAG(ctx context.Context, user *types.User, req openai.ChatCompletionRequest, opts *ChatCompletionOptions) ([]*prompts.RagContent, error) {
+func (c *Controller) evaluateRAG(ctx context.Context, user *types.User, req openai.ChatCompletionRequest, opts *ChatCompletionOptions) ([]*prompts.RagContent, []*types.SessionRAGResult, error) {
 	if opts.RAGSourceID == "" {
-		return []*prompts.RagContent{}, nil
+		return []*prompts.RagContent{}, nil, nil
 	}
 
 	entity, err := c.Options.Store.GetDataEntity(ctx, opts.RAGSourceID)
 	if err != nil {
-		return nil, fmt.Errorf("error getting data entity: %w", err)
+		return nil, nil, fmt.Errorf("error getting data entity: %w", err)
 	}
 
 	if entity.Owner != user.ID {
-		return nil, fmt.Errorf("you do not have access to the data entity with the id: %s", entity.ID)
+		return nil, nil, fmt.Errorf("you do not have access to the data entity with the id: %s", entity.ID)
 	}
 
 	ragResults, err := c.Options.RAG.Query(ctx, &types.SessionRAGQuery{
@@ -506,7 +770,7 @@ func (c *Controller) evaluateRAG(ctx context.Context, user *types.User, req open
 		MaxResults:        entity.Config.RAGSettings.ResultsCount,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("error querying RAG: %w", err)
+		return nil, nil, fmt.Errorf("error querying RAG: %w", err)
 	}
 
 	ragContent := make([]*prompts.RagContent, 0, len(ragResults))
@@ -517,28 +781,32 @@ func (c *Controller) evaluateRAG(ctx context.Context, user *types.User, req open
 		})
 	}
 
-	return ragContent, nil
+	return ragContent, ragResults, nil
 }
 
 func (c *Controller) evaluateKnowledge(
 	ctx context.Context,
 	req openai.ChatCompletionRequest,
 	assistant *types.AssistantConfig,
-	opts *ChatCompletionOptions) ([]*prompts.BackgroundKnowledge, *types.Knowledge, error) {
+	opts *ChatCompletionOptions) ([]*prompts.BackgroundKnowledge, *types.Knowledge, []*types.SessionRAGResult, error) {
 	var (
 		backgroundKnowledge []*prompts.BackgroundKnowledge
 		usedKnowledge       *types.Knowledge
+		sources             []*types.SessionRAGResult
 	)
 
 	prompt := getLastMessage(req)
 
+	// Knowledge with the same rewrite settings share the rewritten queries
+	rewrittenQueries := make(map[types.RAGQueryRewriteSettings][]string)
+
 	for _, k := range assistant.Knowledge {
 		knowledge, err := c.Options.Store.LookupKnowledge(ctx, &store.LookupKnowledgeQuery{
 			Name:  k.Name,
 			AppID: opts.AppID,
 		})
 		if err != nil {
-			return nil, nil, fmt.Errorf("error getting knowledge: %w", err)
+			return nil, nil, nil, fmt.Errorf("error getting knowledge: %w", err)
 		}
 		switch {
 		// If the knowledge is a content, add it to the background knowledge
@@ -551,9 +819,10 @@ func (c *Controller) evaluateKnowledge(
 
 			usedKnowledge = knowledge
 		default:
-			ragClient, err := c.GetRagClient(ctx, knowledge)
-			if err != nil {
-				return nil, nil, fmt.Errorf("error getting RAG client: %w", err)
+			queries := []string{prompt}
+
+			if knowledge.RAGSettings.QueryRewrite.Enabled {
+				queries = c.rewriteQuery(ctx, req, knowledge, opts, rewrittenQueries)
 			}
 
 			if err := c.emitStepInfo(ctx, &types.StepInfo{
@@ -564,15 +833,9 @@ func (c *Controller) evaluateKnowledge(
 				log.Debug().Err(err).Msg("failed to emit step info")
 			}
 
-			ragResults, err := ragClient.Query(ctx, &types.SessionRAGQuery{
-				Prompt:            prompt,
-				DataEntityID:      knowledge.GetDataEntityID(),
-				DistanceThreshold: knowledge.RAGSettings.Threshold,
-				DistanceFunction:  knowledge.RAGSettings.DistanceFunction,
-				MaxResults:        knowledge.RAGSettings.ResultsCount,
-			})
+			ragResults, err := c.QueryKnowledge(ctx, knowledge, nil, queries...)
 			if err != nil {
-				return nil, nil, fmt.Errorf("error querying RAG: %w", err)
+				return nil, nil, nil, err
 			}
 
 			if err := c.emitStepInfo(ctx, &types.StepInfo{
@@ -594,11 +857,12 @@ func (c *Controller) evaluateKnowledge(
 
 			if len(ragResults) > 0 {
 				usedKnowledge = knowledge
+				sources = append(sources, ragResults...)
 			}
 		}
 	}
 
-	return backgroundKnowledge, usedKnowledge, nil
+	return backgroundKnowledge, usedKnowledge, sources, nil
 }
 
 func (c *Controller) emitStepInfo(ctx context.Context, stepInfo *types.StepInfo) error {
@@ -625,6 +889,7 @@ func (c *Controller) emitStepInfo(ctx context.Context, stepInfo *types.StepInfo)
 		Str("queue", queue).
 		Str("step_name", stepInfo.Name).
 		Str("step_message", stepInfo.Message).
+		Str("tool_call_id", stepInfo.ToolCallID).
 		Msg("emitting step info")
 
 	// TODO: save in the database too
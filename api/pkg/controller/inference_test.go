@@ -2,8 +2,11 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/helixml/helix/api/pkg/config"
 	"github.com/helixml/helix/api/pkg/extract"
@@ -15,10 +18,12 @@ import (
 	"github.com/helixml/helix/api/pkg/rag"
 	"github.com/helixml/helix/api/pkg/scheduler"
 	"github.com/helixml/helix/api/pkg/store"
+	"github.com/helixml/helix/api/pkg/tools"
 	"github.com/helixml/helix/api/pkg/types"
 	"go.uber.org/mock/gomock"
 
 	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -110,11 +115,13 @@ func (suite *ControllerSuite) Test_BasicInference() {
 
 	resp, _, err := suite.controller.ChatCompletion(suite.ctx, suite.user, req, &ChatCompletionOptions{})
 	suite.NoError(err)
-	suite.Equal(&openai.ChatCompletionResponse{
-		Choices: []openai.ChatCompletionChoice{
-			{
-				Message: openai.ChatCompletionMessage{
-					Content: "Hello",
+	suite.Equal(&types.ChatCompletionResponse{
+		ChatCompletionResponse: openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{
+				{
+					Message: openai.ChatCompletionMessage{
+						Content: "Hello",
+					},
 				},
 			},
 		},
@@ -186,15 +193,365 @@ func (suite *ControllerSuite) Test_BasicInferenceWithKnowledge() {
 		AssistantID: "0",
 	})
 	suite.NoError(err)
-	suite.Equal(&openai.ChatCompletionResponse{
+	suite.Equal(&types.ChatCompletionResponse{
+		ChatCompletionResponse: openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{
+				{
+					Message: openai.ChatCompletionMessage{
+						Content: "Hello",
+					},
+				},
+			},
+		},
+	}, resp)
+}
+
+func (suite *ControllerSuite) Test_QueryKnowledge_Filters() {
+	knowledge := &types.Knowledge{
+		ID: "knowledge_id",
+	}
+
+	filters := []*types.RAGFilter{
+		{Key: "extension", Operator: types.RAGFilterOperatorEquals, Value: "pdf"},
+	}
+
+	suite.rag.EXPECT().Query(suite.ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, q *types.SessionRAGQuery) ([]*types.SessionRAGResult, error) {
+			suite.Equal(filters, q.Filters)
+
+			return []*types.SessionRAGResult{
+				{DocumentID: "doc_1", Metadata: map[string]string{"extension": "pdf"}},
+			}, nil
+		})
+
+	results, err := suite.controller.QueryKnowledge(suite.ctx, knowledge, filters, "reports")
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+}
+
+func (suite *ControllerSuite) Test_QueryKnowledge_Rerank() {
+	knowledge := &types.Knowledge{
+		ID: "knowledge_id",
+		RAGSettings: types.RAGSettings{
+			ResultsCount: 2,
+			Rerank: types.RAGRerankSettings{
+				Enabled: true,
+				Model:   "rerank-model",
+			},
+		},
+	}
+
+	suite.rag.EXPECT().Query(suite.ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, q *types.SessionRAGQuery) ([]*types.SessionRAGResult, error) {
+			suite.Equal(rag.DefaultRerankMinCandidates, q.MaxResults)
+
+			return []*types.SessionRAGResult{
+				{DocumentID: "doc_1", Content: "one"},
+				{DocumentID: "doc_2", Content: "two"},
+				{DocumentID: "doc_3", Content: "three"},
+			}, nil
+		})
+
+	suite.openAiClient.EXPECT().CreateChatCompletion(suite.ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			suite.Equal("rerank-model", req.Model)
+
+			return openai.ChatCompletionResponse{
+				Choices: []openai.ChatCompletionChoice{
+					{
+						Message: openai.ChatCompletionMessage{
+							Content: `{"scores": [2, 9, 5]}`,
+						},
+					},
+				},
+			}, nil
+		})
+
+	results, err := suite.controller.QueryKnowledge(suite.ctx, knowledge, nil, "which one?")
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 2)
+
+	suite.Equal("doc_2", results[0].DocumentID)
+	suite.InDelta(0.9, results[0].RerankScore, 0.0001)
+	suite.Equal("doc_3", results[1].DocumentID)
+	suite.InDelta(0.5, results[1].RerankScore, 0.0001)
+}
+
+func (suite *ControllerSuite) Test_QueryKnowledge_RerankFailed() {
+	knowledge := &types.Knowledge{
+		ID: "knowledge_id",
+		RAGSettings: types.RAGSettings{
+			ResultsCount: 1,
+			Rerank: types.RAGRerankSettings{
+				Enabled: true,
+				Model:   "rerank-model",
+			},
+		},
+	}
+
+	suite.rag.EXPECT().Query(suite.ctx, gomock.Any()).Return([]*types.SessionRAGResult{
+		{DocumentID: "doc_1", Content: "one"},
+		{DocumentID: "doc_2", Content: "two"},
+	}, nil)
+
+	suite.openAiClient.EXPECT().CreateChatCompletion(suite.ctx, gomock.Any()).Return(openai.ChatCompletionResponse{
 		Choices: []openai.ChatCompletionChoice{
 			{
 				Message: openai.ChatCompletionMessage{
-					Content: "Hello",
+					Content: "I can't do that",
 				},
 			},
 		},
-	}, resp)
+	}, nil)
+
+	// Falls back to the retrieval order
+	results, err := suite.controller.QueryKnowledge(suite.ctx, knowledge, nil, "which one?")
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	suite.Equal("doc_1", results[0].DocumentID)
+}
+
+func (suite *ControllerSuite) Test_SearchKnowledge() {
+	knowledge := &types.Knowledge{
+		ID:      "knowledge_id",
+		Version: "v1",
+		RAGSettings: types.RAGSettings{
+			ResultsCount: 1,
+			QueryRewrite: types.RAGQueryRewriteSettings{
+				Enabled:    true,
+				Model:      "rewrite-model",
+				SubQueries: 1,
+			},
+			Rerank: types.RAGRerankSettings{
+				Enabled: true,
+				Model:   "rerank-model",
+			},
+		},
+	}
+
+	gomock.InOrder(
+		suite.openAiClient.EXPECT().CreateChatCompletion(suite.ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+				suite.Equal("rewrite-model", req.Model)
+
+				return openai.ChatCompletionResponse{
+					Choices: []openai.ChatCompletionChoice{
+						{Message: openai.ChatCompletionMessage{Content: "runner GPUs\nH100 memory"}},
+					},
+				}, nil
+			}),
+		suite.openAiClient.EXPECT().CreateChatCompletion(suite.ctx, gomock.Any()).DoAndReturn(
+			func(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+				suite.Equal("rerank-model", req.Model)
+
+				return openai.ChatCompletionResponse{
+					Choices: []openai.ChatCompletionChoice{
+						{Message: openai.ChatCompletionMessage{Content: `{"scores": [1, 8]}`}},
+					},
+				}, nil
+			}),
+	)
+
+	// Both rewritten queries are searched and fused before reranking
+	suite.rag.EXPECT().Query(suite.ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, q *types.SessionRAGQuery) ([]*types.SessionRAGResult, error) {
+			suite.Equal("knowledge_id-v1", q.DataEntityID)
+
+			if q.Prompt == "runner GPUs" {
+				return []*types.SessionRAGResult{{DocumentID: "doc_1", Content: "runners"}}, nil
+			}
+			suite.Equal("H100 memory", q.Prompt)
+			return []*types.SessionRAGResult{{DocumentID: "doc_2", Content: "h100"}}, nil
+		}).Times(2)
+
+	results, err := suite.controller.SearchKnowledge(suite.ctx, knowledge, "How much memory do the runner GPUs have?")
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	suite.Equal("doc_2", results[0].DocumentID)
+}
+
+func (suite *ControllerSuite) Test_EvaluateKnowledge_QueryRewrite() {
+	req := openai.ChatCompletionRequest{
+		Model: "chat-model",
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "You are a helpful assistant."},
+			{Role: openai.ChatMessageRoleUser, Content: "Which GPUs do the runners have?"},
+			{Role: openai.ChatMessageRoleAssistant, Content: "The runners have an A100 and an H100."},
+			{Role: openai.ChatMessageRoleUser, Content: "What about the second one?"},
+		},
+	}
+
+	knowledge := &types.Knowledge{
+		ID:    "knowledge_id",
+		Name:  "knowledge_name",
+		AppID: "app_id",
+		RAGSettings: types.RAGSettings{
+			ResultsCount: 2,
+			QueryRewrite: types.RAGQueryRewriteSettings{
+				Enabled:    true,
+				SubQueries: 1,
+			},
+		},
+	}
+
+	suite.store.EXPECT().LookupKnowledge(suite.ctx, &store.LookupKnowledgeQuery{
+		Name:  "knowledge_name",
+		AppID: "app_id",
+	}).Return(knowledge, nil)
+
+	suite.openAiClient.EXPECT().CreateChatCompletion(suite.ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, rewriteReq openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			suite.Equal("chat-model", rewriteReq.Model)
+			suite.Contains(rewriteReq.Messages[0].Content, "assistant: The runners have an A100 and an H100.")
+			suite.NotContains(rewriteReq.Messages[0].Content, "You are a helpful assistant.")
+
+			return openai.ChatCompletionResponse{
+				Choices: []openai.ChatCompletionChoice{
+					{
+						Message: openai.ChatCompletionMessage{
+							Content: "1. H100 GPU runner specifications\n2. H100 memory",
+						},
+					},
+				},
+			}, nil
+		})
+
+	suite.rag.EXPECT().Query(suite.ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, q *types.SessionRAGQuery) ([]*types.SessionRAGResult, error) {
+			switch q.Prompt {
+			case "H100 GPU runner specifications":
+				return []*types.SessionRAGResult{
+					{DocumentID: "doc_1", Content: "specs"},
+					{DocumentID: "doc_2", Content: "memory"},
+				}, nil
+			case "H100 memory":
+				return []*types.SessionRAGResult{
+					{DocumentID: "doc_2", Content: "memory"},
+					{DocumentID: "doc_3", Content: "pricing"},
+				}, nil
+			}
+			suite.Failf("unexpected query", "query: %s", q.Prompt)
+			return nil, nil
+		}).Times(2)
+
+	results, used, sources, err := suite.controller.evaluateKnowledge(suite.ctx, req, &types.AssistantConfig{
+		Knowledge: []*types.AssistantKnowledge{
+			{Name: "knowledge_name"},
+		},
+	}, &ChatCompletionOptions{AppID: "app_id"})
+	suite.Require().NoError(err)
+	suite.Equal(knowledge, used)
+
+	// Fused and cut to the results count, found by both queries first
+	suite.Require().Len(results, 2)
+	suite.Equal("doc_2", results[0].DocumentID)
+	suite.Equal("doc_1", results[1].DocumentID)
+
+	// The retrieved chunks can be cited
+	suite.Require().Len(sources, 2)
+	suite.Equal("doc_2", sources[0].DocumentID)
+}
+
+func (suite *ControllerSuite) Test_BasicInferenceWithCitations() {
+	req := openai.ChatCompletionRequest{
+		Model: openai.GPT4TurboPreview,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: "How much memory does the H100 have?",
+			},
+		},
+	}
+
+	app := &types.App{
+		ID:     "app_id",
+		Global: true,
+		Config: types.AppConfig{
+			Helix: types.AppHelixConfig{
+				Assistants: []types.AssistantConfig{
+					{
+						ID: "0",
+						Knowledge: []*types.AssistantKnowledge{
+							{
+								Name: "knowledge_name",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	suite.store.EXPECT().GetAppWithTools(suite.ctx, "app_id").Return(app, nil)
+	suite.store.EXPECT().ListSecrets(gomock.Any(), &store.ListSecretsQuery{
+		Owner: suite.user.ID,
+	}).Return([]*types.Secret{}, nil)
+
+	knowledge := &types.Knowledge{
+		ID:    "knowledge_id",
+		AppID: "app_id",
+		RAGSettings: types.RAGSettings{
+			ResultsCount: 3,
+		},
+		Source: types.KnowledgeSource{
+			Web: &types.KnowledgeSourceWeb{
+				URLs: []string{"https://example.com/docs"},
+			},
+		},
+	}
+
+	suite.store.EXPECT().LookupKnowledge(suite.ctx, &store.LookupKnowledgeQuery{
+		Name:  "knowledge_name",
+		AppID: "app_id",
+	}).Return(knowledge, nil)
+
+	suite.rag.EXPECT().Query(suite.ctx, gomock.Any()).Return([]*types.SessionRAGResult{
+		{
+			DocumentID:    "doc_1",
+			Source:        "https://example.com/docs/h100.pdf",
+			ContentOffset: 4,
+			Content:       "The H100 has 80GB of memory.",
+			Metadata:      map[string]string{"section": "Specs > Memory", "page": "2"},
+		},
+		{
+			DocumentID: "doc_2",
+			Source:     "https://example.com/docs/a100",
+			Content:    "The A100 has 40GB of memory.",
+		},
+	}, nil)
+
+	suite.openAiClient.EXPECT().CreateChatCompletion(suite.ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			suite.Contains(req.Messages[len(req.Messages)-1].Content, "DocumentID: doc_1")
+
+			return openai.ChatCompletionResponse{
+				Choices: []openai.ChatCompletionChoice{
+					{
+						Message: openai.ChatCompletionMessage{
+							Content: "The H100 has 80GB of memory [DOC_ID:doc_1] and is fast [DOC_ID:doc_9].",
+						},
+					},
+				},
+			}, nil
+		})
+
+	resp, _, err := suite.controller.ChatCompletion(suite.ctx, suite.user, req, &ChatCompletionOptions{
+		AppID:       "app_id",
+		AssistantID: "0",
+	})
+	suite.Require().NoError(err)
+
+	// The made up reference is removed
+	suite.Equal("The H100 has 80GB of memory [DOC_ID:doc_1] and is fast.", resp.Choices[0].Message.Content)
+	suite.Equal([]*types.Citation{
+		{
+			DocumentID:    "doc_1",
+			Source:        "https://example.com/docs/h100.pdf",
+			ContentOffset: 4,
+			Section:       "Specs > Memory",
+			Page:          2,
+		},
+	}, resp.Citations)
 }
 
 func (suite *ControllerSuite) Test_EvaluateSecrets() {
@@ -240,6 +597,174 @@ func (suite *ControllerSuite) Test_EvaluateSecrets() {
 	suite.Equal(app.Config.Helix.Assistants[0].Tools[0].Config.API.Headers["X-Secret-Key"], "secret_value")
 }
 
+func (suite *ControllerSuite) Test_NativeToolCalling() {
+	planner := suite.setupToolsApp(types.AssistantConfig{ToolCalling: types.ToolCallingNative})
+
+	req := openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: "Who is customer cus_1 and what did they order?"},
+		},
+	}
+
+	calls := []openai.ToolCall{
+		{ID: "call_1", Function: openai.FunctionCall{Name: "getCustomer", Arguments: `{"id": "cus_1"}`}},
+		{ID: "call_2", Function: openai.FunctionCall{Name: "listOrders", Arguments: `{"customer_id": "cus_1"}`}},
+	}
+
+	planner.EXPECT().SelectToolCalls(suite.ctx, "", "", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, _ string, assistantTools []*types.Tool, _ []*types.ToolHistoryMessage, _ ...tools.Option) ([]openai.ToolCall, map[string]*tools.ToolFunction, error) {
+			return calls, map[string]*tools.ToolFunction{
+				"getCustomer": {Tool: assistantTools[0], Action: "getCustomer"},
+				"listOrders":  {Tool: assistantTools[0], Action: "listOrders"},
+			}, nil
+		})
+	planner.EXPECT().RunToolCall(gomock.Any(), "", "", gomock.Any(), gomock.Any(), calls[0]).
+		Return(&tools.RunActionResponse{Message: "Customer is Bob"}, nil)
+	planner.EXPECT().RunToolCall(gomock.Any(), "", "", gomock.Any(), gomock.Any(), calls[1]).
+		Return(&tools.RunActionResponse{Message: "Bob ordered a bike"}, nil)
+
+	resp, _, err := suite.controller.ChatCompletion(suite.ctx, suite.user, req, &ChatCompletionOptions{
+		AppID:       "app_id",
+		AssistantID: "0",
+	})
+	suite.Require().NoError(err)
+	suite.Equal("Customer is Bob\n\nBob ordered a bike", resp.Choices[0].Message.Content)
+}
+
+func (suite *ControllerSuite) Test_NativeToolCalling_SameActionName() {
+	searchTool := func(name string) *types.Tool {
+		return &types.Tool{
+			Name:     name,
+			ToolType: types.ToolTypeAPI,
+			Config: types.ToolConfig{
+				API: &types.ToolAPIConfig{
+					Actions: []*types.ToolAPIAction{{Name: "search"}},
+				},
+			},
+		}
+	}
+
+	planner := suite.setupToolsApp(types.AssistantConfig{
+		ToolCalling: types.ToolCallingNative,
+		Tools:       []*types.Tool{searchTool("crm"), searchTool("wiki")},
+	})
+
+	req := openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: "Search the wiki for the holidays"},
+		},
+	}
+
+	// The model calls the search of the second tool
+	planner.EXPECT().SelectToolCalls(suite.ctx, "", "", gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, _ string, assistantTools []*types.Tool, _ []*types.ToolHistoryMessage, _ ...tools.Option) ([]openai.ToolCall, map[string]*tools.ToolFunction, error) {
+			_, functions, err := tools.GetToolFunctions(assistantTools)
+			suite.Require().NoError(err)
+			suite.Require().Len(functions, 2)
+
+			return []openai.ToolCall{
+				{ID: "call_1", Function: openai.FunctionCall{Name: "search_2", Arguments: `{"q": "holidays"}`}},
+			}, functions, nil
+		})
+	planner.EXPECT().RunToolCall(gomock.Any(), "", "", gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, _, _ string, tool *types.Tool, _ []*types.ToolHistoryMessage, call openai.ToolCall) (*tools.RunActionResponse, error) {
+			suite.Equal("wiki", tool.Name)
+			suite.Equal("search", call.Function.Name)
+			suite.Equal(`{"q": "holidays"}`, call.Function.Arguments)
+			return &tools.RunActionResponse{Message: "Holidays are in August"}, nil
+		})
+
+	resp, _, err := suite.controller.ChatCompletion(suite.ctx, suite.user, req, &ChatCompletionOptions{
+		AppID:       "app_id",
+		AssistantID: "0",
+	})
+	suite.Require().NoError(err)
+	suite.Equal("Holidays are in August", resp.Choices[0].Message.Content)
+}
+
+func (suite *ControllerSuite) Test_NativeToolCalling_Fallback() {
+	planner := suite.setupToolsApp(types.AssistantConfig{ToolCalling: types.ToolCallingNative})
+
+	req := openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: "Who is customer cus_1?"},
+		},
+	}
+
+	planner.EXPECT().SelectToolCalls(suite.ctx, "", "", gomock.Any(), gomock.Any()).
+		Return(nil, nil, errors.New("tools are not supported by the model"))
+	planner.EXPECT().IsActionable(suite.ctx, "", "", gomock.Any(), gomock.Any()).
+		Return(&tools.IsActionableResponse{NeedsTool: tools.NeedsToolYes, API: "getCustomer"}, nil)
+	planner.EXPECT().RunAction(gomock.Any(), "", "", gomock.Any(), gomock.Any(), "getCustomer").
+		Return(&tools.RunActionResponse{Message: "Customer is Bob"}, nil)
+
+	resp, _, err := suite.controller.ChatCompletion(suite.ctx, suite.user, req, &ChatCompletionOptions{
+		AppID:       "app_id",
+		AssistantID: "0",
+	})
+	suite.Require().NoError(err)
+	suite.Equal("Customer is Bob", resp.Choices[0].Message.Content)
+}
+
+func (suite *ControllerSuite) Test_ParallelToolCalls() {
+	planner := suite.setupToolsApp(types.AssistantConfig{MaxParallelToolCalls: 2})
+
+	req := openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: "Who is customer cus_1 and what are the latest orders?"},
+		},
+	}
+
+	planner.EXPECT().IsActionable(suite.ctx, "", "", gomock.Any(), gomock.Any()).
+		Return(&tools.IsActionableResponse{NeedsTool: tools.NeedsToolYes, APIs: []string{"getCustomer", "listOrders"}}, nil)
+
+	var (
+		toolCallIDs sync.Map
+		ordersDone  = make(chan struct{})
+	)
+
+	// getCustomer only completes after listOrders, the answers are still merged in the call order
+	planner.EXPECT().RunAction(gomock.Any(), "", "", gomock.Any(), gomock.Any(), "getCustomer").DoAndReturn(
+		func(ctx context.Context, _, _ string, _ *types.Tool, _ []*types.ToolHistoryMessage, _ string) (*tools.RunActionResponse, error) {
+			id, _ := oai.GetToolCallID(ctx)
+			toolCallIDs.Store("getCustomer", id)
+
+			select {
+			case <-ordersDone:
+			case <-time.After(5 * time.Second):
+				return nil, errors.New("actions are not running in parallel")
+			}
+			return &tools.RunActionResponse{Message: "Customer is Bob"}, nil
+		})
+	planner.EXPECT().RunAction(gomock.Any(), "", "", gomock.Any(), gomock.Any(), "listOrders").DoAndReturn(
+		func(ctx context.Context, _, _ string, _ *types.Tool, _ []*types.ToolHistoryMessage, _ string) (*tools.RunActionResponse, error) {
+			id, _ := oai.GetToolCallID(ctx)
+			toolCallIDs.Store("listOrders", id)
+
+			close(ordersDone)
+			return &tools.RunActionResponse{Message: "Bob ordered a bike"}, nil
+		})
+
+	resp, _, err := suite.controller.ChatCompletion(suite.ctx, suite.user, req, &ChatCompletionOptions{
+		AppID:       "app_id",
+		AssistantID: "0",
+	})
+	suite.Require().NoError(err)
+	suite.Equal("Customer is Bob\n\nBob ordered a bike", resp.Choices[0].Message.Content)
+
+	customerID, _ := toolCallIDs.Load("getCustomer")
+	ordersID, _ := toolCallIDs.Load("listOrders")
+	suite.NotEmpty(customerID)
+	suite.NotEmpty(ordersID)
+	suite.NotEqual(customerID, ordersID)
+}
+
+func Test_getMaxParallelToolCalls(t *testing.T) {
+	assert.Equal(t, defaultMaxParallelToolCalls, getMaxParallelToolCalls(nil))
+	assert.Equal(t, defaultMaxParallelToolCalls, getMaxParallelToolCalls(&types.AssistantConfig{}))
+	assert.Equal(t, 1, getMaxParallelToolCalls(&types.AssistantConfig{MaxParallelToolCalls: 1}))
+}
+
 func Test_setSystemPrompt(t *testing.T) {
 	type args struct {
 		req          *openai.ChatCompletionRequest
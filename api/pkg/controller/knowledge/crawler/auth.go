@@ -0,0 +1,305 @@
+package crawler
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-rod/rod"
+	"github.com/go-rod/rod/lib/proto"
+	"github.com/rs/zerolog/log"
+
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+const defaultLoginTimeout = 60 * time.Second
+
+// session is the authentication state of a crawl. The browser is an incognito context so
+// the cookies are isolated from the other crawls, the cookie jar is shared by the colly
+// collector and the sitemap requests.
+type session struct {
+	browser *rod.Browser
+	jar     http.CookieJar
+	// headers are only sent to the hosts of the crawl
+	headers map[string]string
+	hosts   []string
+}
+
+func hasAuth(auth *types.KnowledgeSourceWebAuth) bool {
+	return auth.Username != "" || auth.Password != "" || len(auth.Headers) > 0 || len(auth.Cookies) > 0 || auth.Login != nil
+}
+
+// getAuthHeaders returns the static headers, including basic auth
+func getAuthHeaders(auth *types.KnowledgeSourceWebAuth) map[string]string {
+	headers := make(map[string]string, len(auth.Headers)+1)
+
+	// Basic auth is only used without a form login, the login page usually
+	// asks for the same credentials
+	if (auth.Username != "" || auth.Password != "") && auth.Login == nil {
+		credentials := base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+		headers["Authorization"] = "Basic " + credentials
+	}
+
+	for k, v := range auth.Headers {
+		headers[k] = v
+	}
+
+	return headers
+}
+
+// newSession sets up the cookies and runs the form login, nil is returned
+// when the web source doesn't have any authentication
+func (d *Default) newSession(ctx context.Context, b *rod.Browser, hosts []string) (*session, error) {
+	auth := &d.knowledge.Source.Web.Auth
+	if !hasAuth(auth) {
+		return nil, nil
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	incognito, err := b.Incognito()
+	if err != nil {
+		return nil, fmt.Errorf("error creating browser context: %w", err)
+	}
+
+	s := &session{
+		browser: incognito,
+		jar:     jar,
+		headers: getAuthHeaders(auth),
+		hosts:   hosts,
+	}
+
+	err = s.setCookies(auth.Cookies, hosts)
+	if err != nil {
+		s.close()
+		return nil, err
+	}
+
+	if auth.Login != nil {
+		err = d.login(ctx, s, auth.Login)
+		if err != nil {
+			s.close()
+			return nil, fmt.Errorf("login failed: %w", err)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *session) setCookies(cookies []*types.KnowledgeSourceWebCookie, hosts []string) error {
+	if len(cookies) == 0 {
+		return nil
+	}
+
+	params := make([]*proto.NetworkCookieParam, 0, len(cookies))
+
+	for _, c := range cookies {
+		domain := c.Domain
+		if domain == "" && len(hosts) > 0 {
+			domain = hosts[0]
+		}
+
+		path := c.Path
+		if path == "" {
+			path = "/"
+		}
+
+		params = append(params, &proto.NetworkCookieParam{
+			Name:   c.Name,
+			Value:  c.Value,
+			Domain: domain,
+			Path:   path,
+		})
+
+		s.jar.SetCookies(cookieURL(domain), []*http.Cookie{{
+			Name:   c.Name,
+			Value:  c.Value,
+			Domain: domain,
+			Path:   path,
+		}})
+	}
+
+	err := s.browser.SetCookies(params)
+	if err != nil {
+		return fmt.Errorf("error setting cookies: %w", err)
+	}
+
+	return nil
+}
+
+// syncCookies copies the cookies of the browser, set by the login, into the cookie jar
+func (s *session) syncCookies() error {
+	cookies, err := s.browser.GetCookies()
+	if err != nil {
+		return fmt.Errorf("error getting cookies: %w", err)
+	}
+
+	for _, c := range cookies {
+		cookie := &http.Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Secure:   c.Secure,
+			HttpOnly: c.HTTPOnly,
+		}
+		// Host only cookies don't have the leading dot in the browser
+		if strings.HasPrefix(c.Domain, ".") {
+			cookie.Domain = c.Domain
+		}
+
+		s.jar.SetCookies(cookieURL(c.Domain), []*http.Cookie{cookie})
+	}
+
+	return nil
+}
+
+// cookieURL returns an URL the cookie jar accepts for the cookie domain
+func cookieURL(domain string) *url.URL {
+	return &url.URL{Scheme: "https", Host: strings.TrimPrefix(domain, "."), Path: "/"}
+}
+
+func (s *session) allowedHost(host string) bool {
+	return slices.Contains(s.hosts, host)
+}
+
+// prepareRequest adds the headers to the requests made outside the browser
+func (s *session) prepareRequest(req *http.Request) {
+	if !s.allowedHost(req.URL.Host) {
+		return
+	}
+
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+}
+
+// newPage opens a page in the session browser context, the headers are added to
+// the requests to the crawled hosts only. The returned function closes the page.
+func (s *session) newPage(u string) (*rod.Page, func(), error) {
+	page, err := s.browser.Page(proto.TargetCreateTarget{})
+	if err != nil {
+		return nil, nil, fmt.Errorf("error creating page: %w", err)
+	}
+
+	var router *rod.HijackRouter
+
+	cleanup := func() {
+		if router != nil {
+			_ = router.Stop()
+		}
+		_ = page.Close()
+	}
+
+	if len(s.headers) > 0 {
+		router = page.HijackRequests()
+		err = router.Add("*", "", s.hijack)
+		if err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("error adding request headers: %w", err)
+		}
+		go router.Run()
+	}
+
+	err = page.Navigate(u)
+	if err != nil {
+		cleanup()
+		return nil, nil, fmt.Errorf("error navigating to %s: %w", u, err)
+	}
+
+	return page, cleanup, nil
+}
+
+func (s *session) hijack(h *rod.Hijack) {
+	if !s.allowedHost(h.Request.URL().Host) {
+		h.ContinueRequest(&proto.FetchContinueRequest{})
+		return
+	}
+
+	headers := make([]*proto.FetchHeaderEntry, 0, len(h.Request.Headers())+len(s.headers))
+	for k, v := range h.Request.Headers() {
+		if s.hasHeader(k) {
+			continue
+		}
+		headers = append(headers, &proto.FetchHeaderEntry{Name: k, Value: v.Str()})
+	}
+	for k, v := range s.headers {
+		headers = append(headers, &proto.FetchHeaderEntry{Name: k, Value: v})
+	}
+
+	h.ContinueRequest(&proto.FetchContinueRequest{Headers: headers})
+}
+
+func (s *session) hasHeader(name string) bool {
+	for k := range s.headers {
+		if strings.EqualFold(k, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *session) close() {
+	if err := s.browser.Close(); err != nil {
+		log.Warn().Err(err).Msg("failed to close the crawl browser context")
+	}
+}
+
+// login runs the login steps on the login page, the session cookies set by the
+// site end up in the browser context
+func (d *Default) login(ctx context.Context, s *session, login *types.KnowledgeSourceWebLogin) error {
+	log.Info().
+		Str("knowledge_id", d.knowledge.ID).
+		Str("login_url", login.URL).
+		Msg("logging in before crawling")
+
+	page, cleanup, err := s.newPage(login.URL)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	page = page.Context(ctx).Timeout(d.loginTimeout)
+
+	err = page.WaitLoad()
+	if err != nil {
+		return fmt.Errorf("error waiting for the login page to load: %w", err)
+	}
+
+	for idx, step := range login.Steps {
+		el, err := page.Element(step.Selector)
+		if err != nil {
+			return fmt.Errorf("step %d: element %q not found: %w", idx+1, step.Selector, err)
+		}
+
+		switch step.Action {
+		case types.WebLoginActionFill:
+			err = el.Input(step.Value)
+		case types.WebLoginActionClick:
+			err = el.Click(proto.InputMouseButtonLeft, 1)
+		case types.WebLoginActionWait:
+			// The element was found
+		default:
+			err = fmt.Errorf("unknown action %q", step.Action)
+		}
+		if err != nil {
+			return fmt.Errorf("step %d: %w", idx+1, err)
+		}
+	}
+
+	// Let the page follow the redirects after submitting the form
+	err = page.WaitStable(time.Second)
+	if err != nil {
+		return fmt.Errorf("error waiting for the login to complete: %w", err)
+	}
+
+	return s.syncCookies()
+}
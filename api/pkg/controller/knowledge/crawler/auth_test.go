@@ -0,0 +1,56 @@
+package crawler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+func TestGetAuthHeaders(t *testing.T) {
+	headers := getAuthHeaders(&types.KnowledgeSourceWebAuth{
+		Username: "user",
+		Password: "pass",
+		Headers:  map[string]string{"X-Api-Key": "key"},
+	})
+	require.Equal(t, map[string]string{
+		"Authorization": "Basic dXNlcjpwYXNz",
+		"X-Api-Key":     "key",
+	}, headers)
+
+	// The credentials are used by the login steps instead
+	headers = getAuthHeaders(&types.KnowledgeSourceWebAuth{
+		Username: "user",
+		Password: "pass",
+		Login:    &types.KnowledgeSourceWebLogin{URL: "https://wiki.example.com/login"},
+	})
+	require.Empty(t, headers)
+}
+
+func TestHasAuth(t *testing.T) {
+	require.False(t, hasAuth(&types.KnowledgeSourceWebAuth{}))
+	require.True(t, hasAuth(&types.KnowledgeSourceWebAuth{Username: "user"}))
+	require.True(t, hasAuth(&types.KnowledgeSourceWebAuth{
+		Cookies: []*types.KnowledgeSourceWebCookie{{Name: "session", Value: "abc"}},
+	}))
+}
+
+func TestSession_prepareRequest(t *testing.T) {
+	s := &session{
+		headers: map[string]string{"Authorization": "Bearer token"},
+		hosts:   []string{"wiki.example.com"},
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "https://wiki.example.com/sitemap.xml", http.NoBody)
+	require.NoError(t, err)
+	s.prepareRequest(req)
+	require.Equal(t, "Bearer token", req.Header.Get("Authorization"))
+
+	// Credentials are never sent to other hosts
+	req, err = http.NewRequest(http.MethodGet, "https://cdn.example.com/sitemap.xml", http.NoBody)
+	require.NoError(t, err)
+	s.prepareRequest(req)
+	require.Empty(t, req.Header.Get("Authorization"))
+}
@@ -0,0 +1,331 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/helixml/helix/api/pkg/filestore"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+const (
+	// Checkpoints older than this are ignored, the site is crawled again from the start
+	checkpointMaxAge = 24 * time.Hour
+	// How often the progress is checkpointed during a crawl
+	checkpointInterval = 30 * time.Second
+	// Pages crawled between the checkpoints, whichever comes first
+	checkpointPages = 20
+)
+
+// Checkpointer persists the progress of a crawl, so a crawl interrupted by
+// a restart resumes where it stopped instead of starting over
+type Checkpointer interface {
+	// Load returns nil if there's no checkpoint
+	Load(ctx context.Context) (*Checkpoint, error)
+	// LoadDocuments returns the documents saved with the checkpoint
+	LoadDocuments(ctx context.Context, checkpoint *Checkpoint) ([]*types.CrawledDocument, error)
+	// Save stores the documents crawled since the previous save and the checkpoint
+	Save(ctx context.Context, checkpoint *Checkpoint, documents []*types.CrawledDocument) error
+	Delete(ctx context.Context) error
+}
+
+// Checkpoint holds the pages crawled so far and the links found on them that were not
+// crawled yet, the frontier to resume from. The contents of the pages are not part of
+// the checkpoint, they are appended in segments so every save only writes the new pages.
+type Checkpoint struct {
+	// ConfigHash of the web source the checkpoint was made with
+	ConfigHash string            `json:"config_hash"`
+	StartedAt  time.Time         `json:"started_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
+	Pages      []*CheckpointPage `json:"pages"`
+	Frontier   []string          `json:"frontier"`
+	// Segments is the number of document segments saved
+	Segments int `json:"segments"`
+}
+
+type CheckpointPage struct {
+	URL string `json:"url"`
+	// ContentHash of the saved document, pages without a matching
+	// document in the segments are crawled again on resume
+	ContentHash string `json:"content_hash"`
+}
+
+func getContentHash(content string) string {
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])[:10]
+}
+
+// getCheckpointConfigHash changes when the crawl configuration changes, the
+// checkpoint is then discarded
+func getCheckpointConfigHash(web *types.KnowledgeSourceWeb) string {
+	bts, err := json.Marshal(struct {
+		URLs     []string
+		Includes []string
+		Excludes []string
+		Crawler  *types.WebsiteCrawler
+	}{web.URLs, web.Includes, web.Excludes, web.Crawler})
+	if err != nil {
+		return ""
+	}
+
+	hash := sha256.Sum256(bts)
+	return hex.EncodeToString(hash[:])[:10]
+}
+
+// FilestoreCheckpointer keeps the checkpoint and the document segments
+// as JSON files in a folder of the filestore
+type FilestoreCheckpointer struct {
+	fs   filestore.FileStore
+	path string
+}
+
+func NewFilestoreCheckpointer(fs filestore.FileStore, path string) *FilestoreCheckpointer {
+	return &FilestoreCheckpointer{
+		fs:   fs,
+		path: path,
+	}
+}
+
+func (c *FilestoreCheckpointer) Load(ctx context.Context) (*Checkpoint, error) {
+	bts, err := filestore.ReadFile(ctx, c.fs, c.getCheckpointPath())
+	if err != nil {
+		if filestore.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var checkpoint Checkpoint
+	err = json.Unmarshal(bts, &checkpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode checkpoint: %w", err)
+	}
+
+	return &checkpoint, nil
+}
+
+func (c *FilestoreCheckpointer) LoadDocuments(ctx context.Context, checkpoint *Checkpoint) ([]*types.CrawledDocument, error) {
+	var documents []*types.CrawledDocument
+
+	for segment := 1; segment <= checkpoint.Segments; segment++ {
+		bts, err := filestore.ReadFile(ctx, c.fs, c.getSegmentPath(segment))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read checkpoint segment %d: %w", segment, err)
+		}
+
+		var segmentDocuments []*types.CrawledDocument
+		err = json.Unmarshal(bts, &segmentDocuments)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode checkpoint segment %d: %w", segment, err)
+		}
+
+		documents = append(documents, segmentDocuments...)
+	}
+
+	return documents, nil
+}
+
+func (c *FilestoreCheckpointer) Save(ctx context.Context, checkpoint *Checkpoint, documents []*types.CrawledDocument) error {
+	// The segment is written first, a checkpoint never points to a missing segment.
+	// If the checkpoint fails to save, the segment is overwritten by the next save.
+	if len(documents) > 0 {
+		bts, err := json.Marshal(documents)
+		if err != nil {
+			return err
+		}
+
+		_, err = c.fs.WriteFile(ctx, c.getSegmentPath(checkpoint.Segments+1), bytes.NewReader(bts))
+		if err != nil {
+			return fmt.Errorf("failed to write checkpoint segment: %w", err)
+		}
+
+		checkpoint.Segments++
+	}
+
+	bts, err := json.Marshal(checkpoint)
+	if err == nil {
+		_, err = c.fs.WriteFile(ctx, c.getCheckpointPath(), bytes.NewReader(bts))
+	}
+	if err != nil {
+		if len(documents) > 0 {
+			checkpoint.Segments--
+		}
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+func (c *FilestoreCheckpointer) Delete(ctx context.Context) error {
+	// Deleting a missing folder is not an error in any of the filestores
+	return c.fs.Delete(ctx, strings.TrimSuffix(c.path, "/")+"/")
+}
+
+func (c *FilestoreCheckpointer) getCheckpointPath() string {
+	return path.Join(c.path, "checkpoint.json")
+}
+
+func (c *FilestoreCheckpointer) getSegmentPath(segment int) string {
+	return path.Join(c.path, fmt.Sprintf("documents-%05d.json", segment))
+}
+
+// crawlCheckpoint records the crawled documents and saves them periodically
+type crawlCheckpoint struct {
+	mu           sync.Mutex
+	checkpointer Checkpointer
+	checkpoint   *Checkpoint
+	// documents of the interrupted crawl, set when resuming
+	documents []*types.CrawledDocument
+	// crawled pages and all the links found so far, the frontier
+	// is the links that were not crawled yet
+	visited   map[string]bool
+	links     map[string]bool
+	unsaved   []*types.CrawledDocument
+	lastSaved time.Time
+}
+
+// loadCrawlCheckpoint returns the checkpoint of the interrupted crawl, or a new one when there's
+// nothing to resume. Checkpoints of a different configuration or too old are discarded.
+func loadCrawlCheckpoint(ctx context.Context, checkpointer Checkpointer, web *types.KnowledgeSourceWeb) (*crawlCheckpoint, bool) {
+	configHash := getCheckpointConfigHash(web)
+
+	c := &crawlCheckpoint{
+		checkpointer: checkpointer,
+		checkpoint: &Checkpoint{
+			ConfigHash: configHash,
+			StartedAt:  time.Now(),
+		},
+		visited:   make(map[string]bool),
+		links:     make(map[string]bool),
+		lastSaved: time.Now(),
+	}
+
+	if checkpointer == nil {
+		return c, false
+	}
+
+	existing, err := checkpointer.Load(ctx)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to load crawl checkpoint, starting over")
+		return c, false
+	}
+
+	if existing == nil || existing.ConfigHash != configHash || time.Since(existing.UpdatedAt) > checkpointMaxAge {
+		return c, false
+	}
+
+	documents, err := checkpointer.LoadDocuments(ctx, existing)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to load crawl checkpoint documents, starting over")
+		return c, false
+	}
+
+	c.resume(existing, documents)
+
+	return c, len(c.documents) > 0
+}
+
+// resume keeps the pages of the checkpoint that have their document saved,
+// the others are added back to the frontier
+func (c *crawlCheckpoint) resume(existing *Checkpoint, documents []*types.CrawledDocument) {
+	byURL := make(map[string]*types.CrawledDocument, len(documents))
+	for _, doc := range documents {
+		byURL[doc.SourceURL] = doc
+	}
+
+	var (
+		pages    []*CheckpointPage
+		frontier []string
+	)
+
+	for _, page := range existing.Pages {
+		doc, ok := byURL[page.URL]
+		if !ok || c.visited[page.URL] || getContentHash(doc.Content) != page.ContentHash {
+			frontier = append(frontier, page.URL)
+			continue
+		}
+
+		pages = append(pages, page)
+		c.documents = append(c.documents, doc)
+		c.visited[page.URL] = true
+	}
+
+	for _, link := range append(frontier, existing.Frontier...) {
+		if !c.links[link] && !c.visited[link] {
+			c.links[link] = true
+			c.checkpoint.Frontier = append(c.checkpoint.Frontier, link)
+		}
+	}
+
+	c.checkpoint.StartedAt = existing.StartedAt
+	c.checkpoint.Pages = pages
+	c.checkpoint.Segments = existing.Segments
+}
+
+func (c *crawlCheckpoint) add(ctx context.Context, doc *types.CrawledDocument, links []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.checkpoint.Pages = append(c.checkpoint.Pages, &CheckpointPage{
+		URL:         doc.SourceURL,
+		ContentHash: getContentHash(doc.Content),
+	})
+	c.visited[doc.SourceURL] = true
+
+	for _, link := range links {
+		if !c.links[link] {
+			c.links[link] = true
+			c.checkpoint.Frontier = append(c.checkpoint.Frontier, link)
+		}
+	}
+
+	c.unsaved = append(c.unsaved, doc)
+
+	if len(c.unsaved) >= checkpointPages || time.Since(c.lastSaved) >= checkpointInterval {
+		c.saveLocked(ctx)
+	}
+}
+
+func (c *crawlCheckpoint) save(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.saveLocked(ctx)
+}
+
+func (c *crawlCheckpoint) saveLocked(ctx context.Context) {
+	if c.checkpointer == nil {
+		return
+	}
+
+	// The crawled links are dropped from the frontier
+	frontier := c.checkpoint.Frontier[:0]
+	for _, link := range c.checkpoint.Frontier {
+		if !c.visited[link] {
+			frontier = append(frontier, link)
+		}
+	}
+	c.checkpoint.Frontier = frontier
+
+	c.checkpoint.UpdatedAt = time.Now()
+
+	// Saved even when the crawl is cancelled, that's when the checkpoint matters the most
+	err := c.checkpointer.Save(context.WithoutCancel(ctx), c.checkpoint, c.unsaved)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to save crawl checkpoint")
+		return
+	}
+
+	c.lastSaved = time.Now()
+	c.unsaved = nil
+}
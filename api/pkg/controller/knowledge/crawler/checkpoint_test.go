@@ -0,0 +1,288 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/helixml/helix/api/pkg/filestore"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+func testWebSource() *types.KnowledgeSourceWeb {
+	return &types.KnowledgeSourceWeb{
+		URLs: []string{"https://example.com/docs"},
+		Crawler: &types.WebsiteCrawler{
+			Enabled:  true,
+			MaxDepth: 10,
+		},
+	}
+}
+
+func TestFilestoreCheckpointer(t *testing.T) {
+	ctx := context.Background()
+	fs := filestore.NewFileSystemStorage(t.TempDir(), "http://localhost", "secret")
+
+	checkpointer := NewFilestoreCheckpointer(fs, "checkpoints/knowledge_id")
+
+	checkpoint, err := checkpointer.Load(ctx)
+	require.NoError(t, err)
+	require.Nil(t, checkpoint)
+
+	// Deleting a missing checkpoint is fine
+	require.NoError(t, checkpointer.Delete(ctx))
+
+	saved := &Checkpoint{
+		ConfigHash: "hash",
+		Pages:      []*CheckpointPage{{URL: "https://example.com/docs", ContentHash: getContentHash("docs")}},
+		Frontier:   []string{"https://example.com/docs/a"},
+	}
+
+	err = checkpointer.Save(ctx, saved, []*types.CrawledDocument{
+		{SourceURL: "https://example.com/docs", Content: "docs"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, saved.Segments)
+
+	// Only the new documents are written
+	saved.Pages = append(saved.Pages, &CheckpointPage{URL: "https://example.com/docs/a", ContentHash: getContentHash("a")})
+	err = checkpointer.Save(ctx, saved, []*types.CrawledDocument{
+		{SourceURL: "https://example.com/docs/a", Content: "a"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, saved.Segments)
+
+	// Nothing new, only the checkpoint is written
+	require.NoError(t, checkpointer.Save(ctx, saved, nil))
+	require.Equal(t, 2, saved.Segments)
+
+	bts, err := filestore.ReadFile(ctx, fs, "checkpoints/knowledge_id/checkpoint.json")
+	require.NoError(t, err)
+	require.NotContains(t, string(bts), `"docs"`, "contents are not part of the checkpoint")
+
+	checkpoint, err = checkpointer.Load(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, checkpoint)
+	require.Equal(t, "hash", checkpoint.ConfigHash)
+	require.Len(t, checkpoint.Pages, 2)
+	require.Equal(t, []string{"https://example.com/docs/a"}, checkpoint.Frontier)
+
+	documents, err := checkpointer.LoadDocuments(ctx, checkpoint)
+	require.NoError(t, err)
+	require.Len(t, documents, 2)
+	require.Equal(t, "docs", documents[0].Content)
+	require.Equal(t, "a", documents[1].Content)
+
+	require.NoError(t, checkpointer.Delete(ctx))
+
+	checkpoint, err = checkpointer.Load(ctx)
+	require.NoError(t, err)
+	require.Nil(t, checkpoint)
+}
+
+func TestFilestoreCheckpointer_LoadError(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	fs := filestore.NewMockFileStore(ctrl)
+
+	fs.EXPECT().OpenFile(gomock.Any(), "checkpoints/knowledge_id/checkpoint.json").
+		Return(nil, errors.New("failed to create S3 object reader: connection refused"))
+
+	// Only a missing checkpoint means there's nothing to resume
+	_, err := NewFilestoreCheckpointer(fs, "checkpoints/knowledge_id").Load(context.Background())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "connection refused")
+}
+
+func Test_getCheckpointConfigHash(t *testing.T) {
+	web := testWebSource()
+	hash := getCheckpointConfigHash(web)
+	require.Equal(t, hash, getCheckpointConfigHash(testWebSource()))
+
+	web.Excludes = []string{"/blog"}
+	require.NotEqual(t, hash, getCheckpointConfigHash(web))
+
+	web = testWebSource()
+	web.Crawler.MaxDepth = 20
+	require.NotEqual(t, hash, getCheckpointConfigHash(web))
+}
+
+type memoryCheckpointer struct {
+	checkpoint *Checkpoint
+	segments   [][]*types.CrawledDocument
+	saves      int
+}
+
+func (m *memoryCheckpointer) Load(_ context.Context) (*Checkpoint, error) {
+	return m.checkpoint, nil
+}
+
+func (m *memoryCheckpointer) LoadDocuments(_ context.Context, checkpoint *Checkpoint) ([]*types.CrawledDocument, error) {
+	var documents []*types.CrawledDocument
+	for _, segment := range m.segments[:checkpoint.Segments] {
+		documents = append(documents, segment...)
+	}
+	return documents, nil
+}
+
+func (m *memoryCheckpointer) Save(_ context.Context, checkpoint *Checkpoint, documents []*types.CrawledDocument) error {
+	if len(documents) > 0 {
+		m.segments = append(m.segments[:checkpoint.Segments], documents)
+		checkpoint.Segments++
+	}
+	m.checkpoint = checkpoint
+	m.saves++
+	return nil
+}
+
+func (m *memoryCheckpointer) Delete(_ context.Context) error {
+	m.checkpoint = nil
+	m.segments = nil
+	return nil
+}
+
+func Test_loadCrawlCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	web := testWebSource()
+
+	pages := []*CheckpointPage{
+		{URL: "https://example.com/docs", ContentHash: getContentHash("docs")},
+	}
+	segments := [][]*types.CrawledDocument{
+		{{SourceURL: "https://example.com/docs", Content: "docs"}},
+	}
+
+	t.Run("NoCheckpointer", func(t *testing.T) {
+		c, resumed := loadCrawlCheckpoint(ctx, nil, web)
+		require.False(t, resumed)
+		require.Equal(t, getCheckpointConfigHash(web), c.checkpoint.ConfigHash)
+
+		// Nothing to save to
+		c.add(ctx, &types.CrawledDocument{SourceURL: "https://example.com/docs"}, nil)
+		c.save(ctx)
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		started := time.Now().Add(-time.Hour)
+		checkpointer := &memoryCheckpointer{
+			checkpoint: &Checkpoint{
+				ConfigHash: getCheckpointConfigHash(web),
+				StartedAt:  started,
+				UpdatedAt:  time.Now().Add(-time.Minute),
+				Pages:      pages,
+				Frontier:   []string{"https://example.com/docs/a"},
+				Segments:   1,
+			},
+			segments: segments,
+		}
+
+		c, resumed := loadCrawlCheckpoint(ctx, checkpointer, web)
+		require.True(t, resumed)
+		require.Equal(t, started, c.checkpoint.StartedAt)
+		require.Len(t, c.documents, 1)
+		require.Equal(t, "docs", c.documents[0].Content)
+		require.Equal(t, []string{"https://example.com/docs/a"}, c.checkpoint.Frontier)
+
+		// Saving again appends a segment
+		c.add(ctx, &types.CrawledDocument{SourceURL: "https://example.com/docs/a", Content: "a"}, nil)
+		c.save(ctx)
+		require.Len(t, checkpointer.segments, 2)
+		require.Empty(t, checkpointer.checkpoint.Frontier)
+	})
+
+	t.Run("MissingDocument", func(t *testing.T) {
+		checkpointer := &memoryCheckpointer{
+			checkpoint: &Checkpoint{
+				ConfigHash: getCheckpointConfigHash(web),
+				UpdatedAt:  time.Now(),
+				Pages: append(pages, &CheckpointPage{
+					URL:         "https://example.com/docs/b",
+					ContentHash: getContentHash("b"),
+				}),
+				Segments: 1,
+			},
+			segments: segments,
+		}
+
+		// The page without a saved document is crawled again
+		c, resumed := loadCrawlCheckpoint(ctx, checkpointer, web)
+		require.True(t, resumed)
+		require.Len(t, c.documents, 1)
+		require.Len(t, c.checkpoint.Pages, 1)
+		require.Equal(t, []string{"https://example.com/docs/b"}, c.checkpoint.Frontier)
+	})
+
+	t.Run("ConfigChanged", func(t *testing.T) {
+		checkpointer := &memoryCheckpointer{
+			checkpoint: &Checkpoint{
+				ConfigHash: "other",
+				UpdatedAt:  time.Now(),
+				Pages:      pages,
+				Segments:   1,
+			},
+			segments: segments,
+		}
+
+		c, resumed := loadCrawlCheckpoint(ctx, checkpointer, web)
+		require.False(t, resumed)
+		require.Empty(t, c.documents)
+		require.Empty(t, c.checkpoint.Pages)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		checkpointer := &memoryCheckpointer{
+			checkpoint: &Checkpoint{
+				ConfigHash: getCheckpointConfigHash(web),
+				UpdatedAt:  time.Now().Add(-checkpointMaxAge - time.Minute),
+				Pages:      pages,
+				Segments:   1,
+			},
+			segments: segments,
+		}
+
+		_, resumed := loadCrawlCheckpoint(ctx, checkpointer, web)
+		require.False(t, resumed)
+	})
+}
+
+func Test_crawlCheckpoint_add(t *testing.T) {
+	ctx := context.Background()
+	checkpointer := &memoryCheckpointer{}
+
+	c, resumed := loadCrawlCheckpoint(ctx, checkpointer, testWebSource())
+	require.False(t, resumed)
+
+	for i := 0; i < checkpointPages-1; i++ {
+		c.add(ctx, &types.CrawledDocument{SourceURL: fmt.Sprintf("https://example.com/docs/%d", i)}, nil)
+	}
+	require.Equal(t, 0, checkpointer.saves)
+
+	// Saved every few pages
+	c.add(ctx, &types.CrawledDocument{SourceURL: "https://example.com/docs"}, []string{
+		"https://example.com/docs/1", "https://example.com/docs/next",
+	})
+	require.Equal(t, 1, checkpointer.saves)
+	require.Len(t, checkpointer.checkpoint.Pages, checkpointPages)
+	require.Len(t, checkpointer.segments, 1)
+	require.Len(t, checkpointer.segments[0], checkpointPages)
+	require.Equal(t, []string{"https://example.com/docs/next"}, checkpointer.checkpoint.Frontier)
+
+	// Only the pages crawled since the previous save are written
+	c.add(ctx, &types.CrawledDocument{SourceURL: "https://example.com/docs/next"}, nil)
+	c.save(ctx)
+	require.Equal(t, 2, checkpointer.saves)
+	require.Len(t, checkpointer.segments, 2)
+	require.Len(t, checkpointer.segments[1], 1)
+	require.Empty(t, checkpointer.checkpoint.Frontier)
+}
+
+func Test_getCrawlProgress(t *testing.T) {
+	require.Equal(t, 0, getCrawlProgress(0, 10))
+	require.Equal(t, 50, getCrawlProgress(5, 10))
+	require.Equal(t, 100, getCrawlProgress(12, 10))
+	require.Equal(t, 0, getCrawlProgress(5, 0))
+}
@@ -14,7 +14,9 @@ type Crawler interface {
 	Crawl(ctx context.Context) ([]*types.CrawledDocument, error)
 }
 
-func NewCrawler(browserPool *browser.Browser, k *types.Knowledge, updateProgress func(progress types.KnowledgeProgress)) (Crawler, error) {
+// NewCrawler returns the crawler configured for the knowledge, previous are the pages
+// of the version being refreshed, nil for the first crawl. The checkpointer is optional.
+func NewCrawler(browserPool *browser.Browser, k *types.Knowledge, previous *types.CrawledSources, checkpointer Checkpointer, updateProgress func(progress types.KnowledgeProgress)) (Crawler, error) {
 	switch {
 	case k.Source.Web.Crawler.Firecrawl != nil:
 		log.Info().
@@ -27,6 +29,6 @@ func NewCrawler(browserPool *browser.Browser, k *types.Knowledge, updateProgress
 			Str("knowledge_id", k.ID).
 			Str("knowledge_name", k.Name).
 			Msgf("Using default Helix crawler")
-		return NewDefault(browserPool, k, updateProgress)
+		return NewDefault(browserPool, k, previous, checkpointer, updateProgress)
 	}
 }
@@ -3,8 +3,10 @@ package crawler
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"net/url"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -26,6 +28,7 @@ const (
 	defaultMaxDepth    = 100 // How many pages to crawl before stopping
 	defaultParallelism = 5   // How many pages to crawl in parallel
 	defaultUserAgent   = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36"
+	maxSitemapURLs     = 50000 // Limit of a single sitemap file in the protocol
 )
 
 // Default crawler for web sources, uses colly to crawl the website
@@ -38,21 +41,45 @@ type Default struct {
 
 	browser *browser.Browser
 
-	pageTimeout time.Duration
+	pageTimeout  time.Duration
+	loginTimeout time.Duration
+
+	// session is set during the crawl of the sites behind authentication
+	session *session
+
+	// httpClient is used for robots.txt and sitemaps, pages are rendered in the browser
+	httpClient *http.Client
+
+	// previous pages of the knowledge by URL, pages with a sitemap lastmod that
+	// is not newer than in the previous crawl are not fetched again
+	previous map[string]*types.CrawledURL
+
+	// checkpointer is optional, without it interrupted crawls start over
+	checkpointer Checkpointer
 
 	updateProgress func(progress types.KnowledgeProgress)
 }
 
-func NewDefault(browser *browser.Browser, k *types.Knowledge, updateProgress func(progress types.KnowledgeProgress)) (*Default, error) {
+func NewDefault(browser *browser.Browser, k *types.Knowledge, previous *types.CrawledSources, checkpointer Checkpointer, updateProgress func(progress types.KnowledgeProgress)) (*Default, error) {
 	crawler := &Default{
 		knowledge:      k,
 		converter:      md.NewConverter("", true, nil),
 		parser:         readability.NewParser(),
 		browser:        browser,
 		pageTimeout:    15 * time.Second,
+		loginTimeout:   defaultLoginTimeout,
+		httpClient:     &http.Client{Timeout: 30 * time.Second},
+		previous:       make(map[string]*types.CrawledURL),
+		checkpointer:   checkpointer,
 		updateProgress: updateProgress,
 	}
 
+	if previous != nil {
+		for _, u := range previous.URLs {
+			crawler.previous[u.URL] = u
+		}
+	}
+
 	return crawler, nil
 }
 
@@ -114,10 +141,19 @@ func (d *Default) Crawl(ctx context.Context) ([]*types.CrawledDocument, error) {
 		collyOptions = append(collyOptions, colly.IgnoreRobotsTxt())
 	}
 
-	if len(d.knowledge.Source.Web.Excludes) > 0 {
-		// Create the regex for the excludes
-		excludesRegex := regexp.MustCompile(strings.Join(d.knowledge.Source.Web.Excludes, "|"))
-		collyOptions = append(collyOptions, colly.DisallowedURLFilters(excludesRegex))
+	excludes, err := CompileURLPatterns(d.knowledge.Source.Web.Excludes)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(excludes) > 0 {
+		collyOptions = append(collyOptions, colly.DisallowedURLFilters(excludes...))
+	}
+
+	// Includes only apply to the discovered pages, the URLs are always crawled
+	includes, err := CompileURLPatterns(d.knowledge.Source.Web.Includes)
+	if err != nil {
+		return nil, err
 	}
 
 	collector := colly.NewCollector(collyOptions...)
@@ -127,6 +163,25 @@ func (d *Default) Crawl(ctx context.Context) ([]*types.CrawledDocument, error) {
 		return nil, fmt.Errorf("error getting browser: %w", err)
 	}
 
+	d.session, err = d.newSession(ctx, b, domains)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.session != nil {
+		defer d.session.close()
+
+		// Same session cookies and headers for the link discovery and the sitemaps
+		collector.SetCookieJar(d.session.jar)
+		d.httpClient.Jar = d.session.jar
+
+		collector.OnRequest(func(r *colly.Request) {
+			for k, v := range d.session.headers {
+				r.Headers.Set(k, v)
+			}
+		})
+	}
+
 	for _, domain := range domains {
 		if err := collector.Limit(&colly.LimitRule{
 			DomainGlob:  fmt.Sprintf("*%s*", domain),
@@ -146,8 +201,46 @@ func (d *Default) Crawl(ctx context.Context) ([]*types.CrawledDocument, error) {
 
 	crawledURLs := make(map[string]bool)
 
+	// Pages found in the sitemaps, with their lastmod
+	lastModified := make(map[string]time.Time)
+
+	// Pages of the interrupted crawl are kept, the links found on them
+	// that were not crawled yet are visited after the start URLs
+	checkpoint, resumed := loadCrawlCheckpoint(ctx, d.checkpointer, d.knowledge.Source.Web)
+
+	var frontier []string
+	if resumed {
+		started = checkpoint.checkpoint.StartedAt
+
+		for _, doc := range checkpoint.documents {
+			crawledDocs = append(crawledDocs, doc)
+			crawledURLs[doc.SourceURL] = true
+		}
+		frontier = append(frontier, checkpoint.checkpoint.Frontier...)
+		pageQueueCounter.Store(int32(len(crawledDocs)))
+
+		log.Info().
+			Str("knowledge_id", d.knowledge.ID).
+			Int("pages", len(crawledDocs)).
+			Msg("resuming the crawl from the checkpoint")
+
+		d.updateProgress(types.KnowledgeProgress{
+			Step:           "Crawling",
+			Progress:       getCrawlProgress(int32(len(crawledDocs)), maxPages),
+			ElapsedSeconds: int(time.Since(started).Seconds()),
+			Message:        fmt.Sprintf("Resuming crawl, %d pages already visited", len(crawledDocs)),
+			StartedAt:      started,
+		})
+	}
+
 	collector.OnHTML("html", func(e *colly.HTMLElement) {
+		// Pages of a cancelled crawl are not recorded, they are crawled again on resume
+		if ctx.Err() != nil {
+			return
+		}
+
 		visited := pageQueueCounter.Load()
+		links := getPageLinks(e, includes)
 
 		log.Info().
 			Str("knowledge_id", d.knowledge.ID).
@@ -162,19 +255,33 @@ func (d *Default) Crawl(ctx context.Context) ([]*types.CrawledDocument, error) {
 				Str("url", e.Request.URL.String()).
 				Msg("error crawling URL")
 
+			if ctx.Err() != nil {
+				return
+			}
+
 			// Errored pages still count as visited
-			crawledMu.Lock()
-			crawledDocs = append(crawledDocs, &types.CrawledDocument{
+			errored := &types.CrawledDocument{
 				SourceURL:  e.Request.URL.String(),
 				StatusCode: 0,
 				DurationMs: 0,
 				Message:    err.Error(),
-			})
+			}
+
+			crawledMu.Lock()
+			crawledDocs = append(crawledDocs, errored)
 			crawledMu.Unlock()
 
+			checkpoint.add(ctx, errored, links)
+
 			return
 		}
 
+		crawledMu.Lock()
+		if lastMod, ok := lastModified[e.Request.URL.String()]; ok {
+			doc.LastModified = &lastMod
+		}
+		crawledMu.Unlock()
+
 		log.Info().
 			Str("knowledge_id", d.knowledge.ID).
 			Str("url", e.Request.URL.String()).
@@ -186,9 +293,11 @@ func (d *Default) Crawl(ctx context.Context) ([]*types.CrawledDocument, error) {
 		crawledDocs = append(crawledDocs, doc)
 		crawledMu.Unlock()
 
+		checkpoint.add(ctx, doc, links)
+
 		d.updateProgress(types.KnowledgeProgress{
 			Step:           "Crawling",
-			Progress:       0, // We don't know the progress here
+			Progress:       getCrawlProgress(visited, maxPages),
 			ElapsedSeconds: int(time.Since(started).Seconds()),
 			Message:        fmt.Sprintf("Visited %d pages", visited),
 			StartedAt:      started,
@@ -198,6 +307,11 @@ func (d *Default) Crawl(ctx context.Context) ([]*types.CrawledDocument, error) {
 	// Add this new OnHTML callback to find and visit links
 	collector.OnHTML("a[href]", func(e *colly.HTMLElement) {
 		link := e.Attr("href")
+		absoluteURL := e.Request.AbsoluteURL(link)
+
+		if len(includes) > 0 && !matchAny(includes, absoluteURL) {
+			return
+		}
 
 		if pageQueueCounter.Load() > maxPages {
 			log.Trace().
@@ -210,7 +324,7 @@ func (d *Default) Crawl(ctx context.Context) ([]*types.CrawledDocument, error) {
 		}
 
 		crawledMu.Lock()
-		alreadyCrawled := crawledURLs[link]
+		alreadyCrawled := crawledURLs[absoluteURL]
 		crawledMu.Unlock()
 
 		// This link has been seen, nothing to do
@@ -223,18 +337,13 @@ func (d *Default) Crawl(ctx context.Context) ([]*types.CrawledDocument, error) {
 
 		// Add link to the seen list
 		crawledMu.Lock()
-		crawledURLs[link] = true
+		crawledURLs[absoluteURL] = true
 		crawledMu.Unlock()
 
 		// Schedule the link to be crawled
 		err := e.Request.Visit(e.Request.AbsoluteURL(link))
 		if err != nil {
-			if strings.Contains(err.Error(), "URL already visited") {
-				// Common error if duplicate URLs are visited
-				return
-			}
-			if strings.Contains(err.Error(), "Forbidden domain") {
-				// Common error when domain links to another domain (we can ignore these)
+			if isIgnoredVisitError(err) {
 				return
 			}
 			log.Warn().
@@ -257,15 +366,108 @@ func (d *Default) Crawl(ctx context.Context) ([]*types.CrawledDocument, error) {
 		Int("max_pages", int(maxPages)).
 		Msg("starting to crawl the website")
 
+	// Sitemap pages are crawled first, sites with poor internal linking
+	// are still fully covered
+	for _, page := range d.getSitemapURLs(ctx, userAgent) {
+		if pageQueueCounter.Load() >= maxPages || ctx.Err() != nil {
+			break
+		}
+
+		if !d.allowed(page.Loc, domains, excludes, includes) {
+			continue
+		}
+
+		crawledMu.Lock()
+		alreadyCrawled := crawledURLs[page.Loc]
+		crawledURLs[page.Loc] = true
+		if !page.LastMod.IsZero() {
+			lastModified[page.Loc] = page.LastMod
+		}
+		crawledMu.Unlock()
+
+		if alreadyCrawled {
+			continue
+		}
+
+		pageQueueCounter.Add(1)
+
+		if d.unchanged(page) {
+			lastMod := page.LastMod
+			unchanged := &types.CrawledDocument{
+				SourceURL:    page.Loc,
+				LastModified: &lastMod,
+				Unchanged:    true,
+			}
+
+			crawledMu.Lock()
+			crawledDocs = append(crawledDocs, unchanged)
+			crawledMu.Unlock()
+
+			checkpoint.add(ctx, unchanged, nil)
+			continue
+		}
+
+		err := collector.Visit(page.Loc)
+		if err != nil && !isIgnoredVisitError(err) {
+			log.Warn().Err(err).Str("url", page.Loc).Msg("Error visiting sitemap URL")
+		}
+	}
+
 	for _, url := range d.knowledge.Source.Web.URLs {
+		if ctx.Err() != nil {
+			break
+		}
+
+		crawledMu.Lock()
+		alreadyCrawled := crawledURLs[url]
+		crawledMu.Unlock()
+
+		// Already crawled or kept unchanged through the sitemap
+		if alreadyCrawled {
+			continue
+		}
+
 		err := collector.Visit(url)
 		if err != nil {
+			if isIgnoredVisitError(err) {
+				continue
+			}
 			log.Warn().Err(err).Str("url", url).Msg("Error visiting URL")
 			// Continue with the next URL instead of returning
 			continue
 		}
 	}
 
+	for _, link := range frontier {
+		if pageQueueCounter.Load() >= maxPages || ctx.Err() != nil {
+			break
+		}
+
+		crawledMu.Lock()
+		alreadyCrawled := crawledURLs[link]
+		crawledURLs[link] = true
+		crawledMu.Unlock()
+
+		if alreadyCrawled {
+			continue
+		}
+
+		pageQueueCounter.Add(1)
+
+		err := collector.Visit(link)
+		if err != nil && !isIgnoredVisitError(err) {
+			log.Warn().Err(err).Str("url", link).Msg("Error visiting checkpointed link")
+		}
+	}
+
+	// The final checkpoint is kept until the pages are indexed,
+	// a crawl interrupted while indexing doesn't crawl again
+	checkpoint.save(ctx)
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
 	log.Info().
 		Str("knowledge_id", d.knowledge.ID).
 		Str("knowledge_name", d.knowledge.Name).
@@ -277,17 +479,134 @@ func (d *Default) Crawl(ctx context.Context) ([]*types.CrawledDocument, error) {
 	return crawledDocs, nil
 }
 
+// getPageLinks returns the links of the page matching the includes, they are
+// the frontier of the crawl when resuming from a checkpoint
+func getPageLinks(e *colly.HTMLElement, includes []*regexp.Regexp) []string {
+	var links []string
+	seen := make(map[string]bool)
+
+	e.ForEach("a[href]", func(_ int, el *colly.HTMLElement) {
+		link := e.Request.AbsoluteURL(el.Attr("href"))
+		if link == "" || seen[link] {
+			return
+		}
+		if len(includes) > 0 && !matchAny(includes, link) {
+			return
+		}
+		seen[link] = true
+		links = append(links, link)
+	})
+
+	return links
+}
+
+// getCrawlProgress returns the percentage of the page budget visited
+func getCrawlProgress(visited, maxPages int32) int {
+	if maxPages <= 0 {
+		return 0
+	}
+	return int(min(100, visited*100/maxPages))
+}
+
+// getSitemapURLs returns the pages listed in the configured sitemaps, or in the sitemaps
+// discovered for the URLs. Sitemaps are only used when the crawler is enabled.
+func (d *Default) getSitemapURLs(ctx context.Context, userAgent string) []*sitemapURL {
+	crawler := d.knowledge.Source.Web.Crawler
+	if !crawler.Enabled {
+		return nil
+	}
+
+	sitemaps := crawler.Sitemaps
+
+	fetcher := newSitemapFetcher(d.httpClient, userAgent, maxSitemapURLs)
+	if d.session != nil {
+		fetcher.prepareRequest = d.session.prepareRequest
+	}
+
+	if len(sitemaps) == 0 && !crawler.IgnoreSitemap {
+		discovered := make(map[string]bool)
+		for _, u := range d.knowledge.Source.Web.URLs {
+			for _, sitemap := range fetcher.discoverSitemaps(ctx, u) {
+				if !discovered[sitemap] {
+					discovered[sitemap] = true
+					sitemaps = append(sitemaps, sitemap)
+				}
+			}
+		}
+	}
+
+	for _, sitemap := range sitemaps {
+		fetcher.fetch(ctx, sitemap, 0)
+	}
+
+	if len(fetcher.urls) > 0 {
+		log.Info().
+			Str("knowledge_id", d.knowledge.ID).
+			Strs("sitemaps", sitemaps).
+			Int("pages", len(fetcher.urls)).
+			Msg("found pages in the sitemaps")
+	}
+
+	return fetcher.urls
+}
+
+// allowed checks the sitemap pages against the crawl rules, links are
+// checked by colly and the includes in the link callback
+func (d *Default) allowed(u string, domains []string, excludes, includes []*regexp.Regexp) bool {
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return false
+	}
+
+	if !slices.Contains(domains, parsed.Host) {
+		return false
+	}
+
+	if matchAny(excludes, u) {
+		return false
+	}
+
+	return len(includes) == 0 || matchAny(includes, u)
+}
+
+// unchanged returns true if the page has a lastmod that is not newer than the lastmod
+// of the previous crawl, the previous crawl must have succeeded
+func (d *Default) unchanged(page *sitemapURL) bool {
+	if page.LastMod.IsZero() {
+		return false
+	}
+
+	previous, ok := d.previous[page.Loc]
+	if !ok || previous.LastModified == nil || previous.DocumentID == "" || previous.Message != "" {
+		return false
+	}
+
+	return !page.LastMod.After(*previous.LastModified)
+}
+
+func isIgnoredVisitError(err error) bool {
+	// Common error if duplicate URLs are visited
+	if strings.Contains(err.Error(), "URL already visited") {
+		return true
+	}
+	// Common error when domain links to another domain (we can ignore these)
+	if strings.Contains(err.Error(), "Forbidden domain") {
+		return true
+	}
+	return false
+}
+
 func (d *Default) crawlWithBrowser(ctx context.Context, b *rod.Browser, url string) (*types.CrawledDocument, error) {
 
 	log.Info().Str("url", url).Msg("crawling with browser")
 
 	start := time.Now()
 
-	page, err := d.browser.GetPage(b, proto.TargetCreateTarget{URL: url})
+	page, cleanup, err := d.getPage(b, url)
 	if err != nil {
 		return nil, fmt.Errorf("error getting page for %s: %w", url, err)
 	}
-	defer d.browser.PutPage(page)
+	defer cleanup()
 
 	if d.knowledge.Source.Web.Crawler.UserAgent != "" {
 		if err := page.SetUserAgent(&proto.NetworkSetUserAgentOverride{
@@ -340,6 +659,21 @@ func (d *Default) crawlWithBrowser(ctx context.Context, b *rod.Browser, url stri
 	return doc, nil
 }
 
+// getPage returns a page from the pool, or a page of the session browser context
+// for the sites behind authentication
+func (d *Default) getPage(b *rod.Browser, url string) (*rod.Page, func(), error) {
+	if d.session != nil {
+		return d.session.newPage(url)
+	}
+
+	page, err := d.browser.GetPage(b, proto.TargetCreateTarget{URL: url})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return page, func() { d.browser.PutPage(page) }, nil
+}
+
 func (d *Default) convertToMarkdown(ctx context.Context, doc *types.CrawledDocument) (*types.CrawledDocument, error) {
 	if !d.knowledge.Source.Web.Crawler.Readability {
 		markdown, err := d.converter.ConvertString(doc.Content)
@@ -39,7 +39,7 @@ func TestDefault_Crawl(t *testing.T) {
 		t.Logf("progress: %+v", progress)
 	}
 
-	d, err := NewDefault(browserManager, k, updateProgress)
+	d, err := NewDefault(browserManager, k, nil, nil, updateProgress)
 	require.NoError(t, err)
 
 	docs, err := d.Crawl(context.Background())
@@ -99,7 +99,7 @@ func TestDefault_CrawlSingle(t *testing.T) {
 		t.Logf("progress: %+v", progress)
 	}
 
-	d, err := NewDefault(browserManager, k, updateProgress)
+	d, err := NewDefault(browserManager, k, nil, nil, updateProgress)
 	require.NoError(t, err)
 
 	docs, err := d.Crawl(context.Background())
@@ -130,7 +130,7 @@ func TestDefault_CrawlSingle_Slow(t *testing.T) {
 		t.Logf("progress: %+v", progress)
 	}
 
-	d, err := NewDefault(browserManager, k, updateProgress)
+	d, err := NewDefault(browserManager, k, nil, nil, updateProgress)
 	require.NoError(t, err)
 
 	// Setting very short timeout to force the page to timeout
@@ -167,7 +167,7 @@ func TestDefault_ParseWithCodeBlock_WithReadability(t *testing.T) {
 		t.Logf("progress: %+v", progress)
 	}
 
-	d, err := NewDefault(browserManager, k, updateProgress)
+	d, err := NewDefault(browserManager, k, nil, nil, updateProgress)
 	require.NoError(t, err)
 
 	content, err := os.ReadFile("../readability/testdata/example_code_block.html")
@@ -205,7 +205,7 @@ func TestDefault_ConvertHTMLToMarkdown(t *testing.T) {
 		t.Logf("progress: %+v", progress)
 	}
 
-	d, err := NewDefault(browserManager, k, updateProgress)
+	d, err := NewDefault(browserManager, k, nil, nil, updateProgress)
 	require.NoError(t, err)
 
 	ctx := context.Background()
@@ -50,6 +50,7 @@ func (f *Firecrawl) Crawl(_ context.Context) ([]*types.CrawledDocument, error) {
 	crawlParams := map[string]any{
 		"crawlerOptions": map[string]any{
 			"excludes": f.knowledge.Source.Web.Excludes,
+			"includes": f.knowledge.Source.Web.Includes,
 		},
 	}
 
@@ -0,0 +1,66 @@
+package crawler
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// globPrefix marks a pattern as a glob instead of a regular expression,
+// for example "glob:https://docs.example.com/guides/**"
+const globPrefix = "glob:"
+
+// CompileURLPatterns compiles the include and exclude patterns of the web source. Patterns are
+// regular expressions matched anywhere in the URL, or globs matched against the whole URL
+// when prefixed with "glob:". In globs "*" doesn't cross "/", "**" matches anything.
+func CompileURLPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+
+	for _, pattern := range patterns {
+		expr := pattern
+		if glob, ok := strings.CutPrefix(pattern, globPrefix); ok {
+			expr = globToRegexp(glob)
+		}
+
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+
+	return compiled, nil
+}
+
+func globToRegexp(glob string) string {
+	var sb strings.Builder
+	sb.WriteString("^")
+
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				sb.WriteString(".*")
+				i++
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	sb.WriteString("$")
+	return sb.String()
+}
+
+func matchAny(patterns []*regexp.Regexp, u string) bool {
+	for _, re := range patterns {
+		if re.MatchString(u) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package crawler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompileURLPatterns(t *testing.T) {
+	patterns, err := CompileURLPatterns([]string{
+		"glob:https://docs.example.com/guides/*",
+		"glob:https://docs.example.com/api/**/*.html",
+		"/blog/20[0-9]{2}/",
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		url   string
+		match bool
+	}{
+		{"https://docs.example.com/guides/setup", true},
+		{"https://docs.example.com/guides/setup/advanced", false},
+		{"https://docs.example.com/api/v1/users/list.html", true},
+		{"https://docs.example.com/api/v1/users/list.md", false},
+		{"https://example.com/blog/2024/post", true},
+		{"https://example.com/blog/archive", false},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.match, matchAny(patterns, tt.url), tt.url)
+	}
+
+	_, err = CompileURLPatterns([]string{"glob:https://example.com/*", "(unclosed"})
+	require.Error(t, err)
+}
+
+func TestDefault_allowed(t *testing.T) {
+	excludes, err := CompileURLPatterns([]string{"/private/"})
+	require.NoError(t, err)
+
+	includes, err := CompileURLPatterns([]string{"glob:https://example.com/docs/**"})
+	require.NoError(t, err)
+
+	d := &Default{}
+	domains := []string{"example.com"}
+
+	require.True(t, d.allowed("https://example.com/docs/a", domains, excludes, includes))
+	require.False(t, d.allowed("https://example.com/blog/a", domains, excludes, includes))
+	require.False(t, d.allowed("https://example.com/docs/private/a", domains, excludes, includes))
+	require.False(t, d.allowed("https://other.com/docs/a", domains, excludes, includes))
+	require.True(t, d.allowed("https://example.com/blog/a", domains, excludes, nil))
+}
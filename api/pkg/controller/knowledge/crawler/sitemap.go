@@ -0,0 +1,228 @@
+package crawler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// Sitemap indexes can reference other indexes, stop following them after a few levels
+	maxSitemapDepth = 3
+	// Upper bound of the sitemap files fetched for a single crawl
+	maxSitemapFiles = 50
+	// Sitemaps are limited to 50MB uncompressed by the protocol
+	maxSitemapSize = 50 * 1024 * 1024
+)
+
+// sitemapURL is a page listed in a sitemap, LastMod is zero when not provided
+type sitemapURL struct {
+	Loc     string
+	LastMod time.Time
+}
+
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// sitemapDocument covers both the <urlset> and the <sitemapindex> documents
+type sitemapDocument struct {
+	XMLName  xml.Name
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+// sitemapFetcher collects the pages from the sitemaps, following sitemap indexes
+type sitemapFetcher struct {
+	httpClient *http.Client
+	userAgent  string
+	maxURLs    int
+	// prepareRequest adds the authentication to the requests, optional
+	prepareRequest func(req *http.Request)
+
+	fetched map[string]bool
+	seen    map[string]bool
+	urls    []*sitemapURL
+}
+
+func newSitemapFetcher(httpClient *http.Client, userAgent string, maxURLs int) *sitemapFetcher {
+	return &sitemapFetcher{
+		httpClient: httpClient,
+		userAgent:  userAgent,
+		maxURLs:    maxURLs,
+		fetched:    make(map[string]bool),
+		seen:       make(map[string]bool),
+	}
+}
+
+// discoverSitemaps returns the sitemaps listed in the robots.txt of the site,
+// falling back to the conventional /sitemap.xml location
+func (f *sitemapFetcher) discoverSitemaps(ctx context.Context, siteURL string) []string {
+	u, err := url.Parse(siteURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+
+	root := &url.URL{Scheme: u.Scheme, Host: u.Host}
+
+	body, err := f.get(ctx, root.JoinPath("robots.txt").String())
+	if err != nil {
+		log.Debug().Err(err).Str("url", siteURL).Msg("failed to get robots.txt")
+	}
+
+	sitemaps := parseRobotsSitemaps(body)
+	if len(sitemaps) > 0 {
+		return sitemaps
+	}
+
+	return []string{root.JoinPath("sitemap.xml").String()}
+}
+
+// fetch reads the sitemap and the sitemaps it references, errors are logged
+// and the sitemap is skipped as sitemaps are optional
+func (f *sitemapFetcher) fetch(ctx context.Context, sitemap string, depth int) {
+	if depth > maxSitemapDepth || f.fetched[sitemap] || len(f.fetched) >= maxSitemapFiles || f.full() {
+		return
+	}
+	f.fetched[sitemap] = true
+
+	body, err := f.get(ctx, sitemap)
+	if err != nil {
+		log.Debug().Err(err).Str("sitemap", sitemap).Msg("failed to get sitemap")
+		return
+	}
+
+	doc, err := parseSitemap(body)
+	if err != nil {
+		log.Warn().Err(err).Str("sitemap", sitemap).Msg("failed to parse sitemap")
+		return
+	}
+
+	for _, entry := range doc.URLs {
+		loc := strings.TrimSpace(entry.Loc)
+		if loc == "" || f.seen[loc] {
+			continue
+		}
+		if f.full() {
+			return
+		}
+		f.seen[loc] = true
+
+		f.urls = append(f.urls, &sitemapURL{
+			Loc:     loc,
+			LastMod: parseLastMod(entry.LastMod),
+		})
+	}
+
+	for _, entry := range doc.Sitemaps {
+		f.fetch(ctx, strings.TrimSpace(entry.Loc), depth+1)
+	}
+}
+
+func (f *sitemapFetcher) full() bool {
+	return f.maxURLs > 0 && len(f.urls) >= f.maxURLs
+}
+
+func (f *sitemapFetcher) get(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.userAgent)
+	if f.prepareRequest != nil {
+		f.prepareRequest(req)
+	}
+
+	resp, err := f.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSitemapSize))
+	if err != nil {
+		return nil, err
+	}
+
+	// Compressed sitemaps (sitemap.xml.gz) are usually served as application/octet-stream
+	if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress: %w", err)
+		}
+		defer gz.Close()
+
+		return io.ReadAll(io.LimitReader(gz, maxSitemapSize))
+	}
+
+	return body, nil
+}
+
+func parseSitemap(body []byte) (*sitemapDocument, error) {
+	var doc sitemapDocument
+	err := xml.Unmarshal(body, &doc)
+	if err != nil {
+		return nil, err
+	}
+
+	switch doc.XMLName.Local {
+	case "urlset", "sitemapindex":
+		return &doc, nil
+	default:
+		return nil, fmt.Errorf("unexpected sitemap root element %q", doc.XMLName.Local)
+	}
+}
+
+// parseRobotsSitemaps returns the values of the "Sitemap:" directives
+func parseRobotsSitemaps(robots []byte) []string {
+	var sitemaps []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(robots))
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(key), "sitemap") {
+			continue
+		}
+
+		if value = strings.TrimSpace(value); value != "" {
+			sitemaps = append(sitemaps, value)
+		}
+	}
+
+	return sitemaps
+}
+
+// lastmod uses the W3C datetime format, the date alone is the most common
+var lastModLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	time.DateOnly,
+	"2006-01",
+	"2006",
+}
+
+func parseLastMod(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range lastModLayouts {
+		t, err := time.Parse(layout, value)
+		if err == nil {
+			return t.UTC()
+		}
+	}
+	return time.Time{}
+}
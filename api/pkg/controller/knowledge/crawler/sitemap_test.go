@@ -0,0 +1,107 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+func TestSitemapFetcher(t *testing.T) {
+	var serverURL string
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(w, "User-agent: *\nDisallow: /private\nSitemap: %s/sitemap_index.xml\n", serverURL)
+	})
+	mux.HandleFunc("/sitemap_index.xml", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>%[1]s/sitemap_docs.xml.gz</loc></sitemap>
+  <sitemap><loc>%[1]s/missing.xml</loc></sitemap>
+</sitemapindex>`, serverURL)
+	})
+	mux.HandleFunc("/sitemap_docs.xml.gz", func(w http.ResponseWriter, _ *http.Request) {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		fmt.Fprintf(gz, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>%[1]s/docs/a</loc><lastmod>2024-05-01</lastmod></url>
+  <url><loc> %[1]s/docs/b </loc><lastmod>2024-05-02T10:00:00+02:00</lastmod></url>
+  <url><loc>%[1]s/docs/a</loc></url>
+  <url><loc>%[1]s/docs/c</loc></url>
+</urlset>`, serverURL)
+		gz.Close()
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(buf.Bytes())
+	})
+
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	serverURL = ts.URL
+
+	ctx := context.Background()
+
+	f := newSitemapFetcher(ts.Client(), defaultUserAgent, 0)
+
+	sitemaps := f.discoverSitemaps(ctx, ts.URL+"/docs/")
+	require.Equal(t, []string{ts.URL + "/sitemap_index.xml"}, sitemaps)
+
+	f.fetch(ctx, sitemaps[0], 0)
+
+	require.Len(t, f.urls, 3)
+	require.Equal(t, ts.URL+"/docs/a", f.urls[0].Loc)
+	require.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), f.urls[0].LastMod)
+	require.Equal(t, ts.URL+"/docs/b", f.urls[1].Loc)
+	require.Equal(t, time.Date(2024, 5, 2, 8, 0, 0, 0, time.UTC), f.urls[1].LastMod)
+	require.True(t, f.urls[2].LastMod.IsZero())
+
+	limited := newSitemapFetcher(ts.Client(), defaultUserAgent, 2)
+	limited.fetch(ctx, sitemaps[0], 0)
+	require.Len(t, limited.urls, 2)
+}
+
+func TestSitemapFetcher_DiscoverFallback(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	defer ts.Close()
+
+	f := newSitemapFetcher(ts.Client(), defaultUserAgent, 0)
+
+	require.Equal(t, []string{ts.URL + "/sitemap.xml"}, f.discoverSitemaps(context.Background(), ts.URL+"/docs/page"))
+
+	// Missing sitemaps are ignored
+	f.fetch(context.Background(), ts.URL+"/sitemap.xml", 0)
+	require.Empty(t, f.urls)
+}
+
+func TestParseSitemap_Invalid(t *testing.T) {
+	_, err := parseSitemap([]byte(`<html><body>Not found</body></html>`))
+	require.Error(t, err)
+}
+
+func TestDefault_unchanged(t *testing.T) {
+	lastMod := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	d := &Default{
+		previous: map[string]*types.CrawledURL{
+			"https://example.com/a": {URL: "https://example.com/a", DocumentID: "doc_a", LastModified: &lastMod},
+			"https://example.com/b": {URL: "https://example.com/b", DocumentID: "doc_b"},
+			"https://example.com/c": {URL: "https://example.com/c", DocumentID: "doc_c", LastModified: &lastMod, Message: "timeout"},
+		},
+	}
+
+	require.True(t, d.unchanged(&sitemapURL{Loc: "https://example.com/a", LastMod: lastMod}))
+	require.False(t, d.unchanged(&sitemapURL{Loc: "https://example.com/a", LastMod: lastMod.Add(time.Hour)}))
+	require.False(t, d.unchanged(&sitemapURL{Loc: "https://example.com/a"}))
+	require.False(t, d.unchanged(&sitemapURL{Loc: "https://example.com/b", LastMod: lastMod}), "no previous lastmod")
+	require.False(t, d.unchanged(&sitemapURL{Loc: "https://example.com/c", LastMod: lastMod}), "previous crawl failed")
+	require.False(t, d.unchanged(&sitemapURL{Loc: "https://example.com/new", LastMod: lastMod}))
+}
@@ -134,6 +134,14 @@ func (r *Reconciler) getCronTask(ctx context.Context, knowledgeID string) gocron
 			Str("knowledge_id", knowledgeID).
 			Msg("running knowledge refresh cron job")
 
+		if !r.lockKnowledge(knowledgeID) {
+			log.Info().
+				Str("knowledge_id", knowledgeID).
+				Msg("knowledge is being indexed, skipping the refresh")
+			return
+		}
+		defer r.unlockKnowledge(knowledgeID)
+
 		knowledge, err := r.store.GetKnowledge(ctx, knowledgeID)
 		if err != nil {
 			log.Error().
@@ -4,10 +4,12 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"path/filepath"
 	"sync"
 	"time"
 
 	gocron "github.com/go-co-op/gocron/v2"
+	git "github.com/go-git/go-git/v5"
 	"github.com/rs/zerolog/log"
 
 	"github.com/helixml/helix/api/pkg/config"
@@ -23,26 +25,45 @@ import (
 type Manager interface {
 	NextRun(ctx context.Context, knowledgeID string) (time.Time, error)
 	GetStatus(knowledgeID string) types.KnowledgeProgress // Ephemeral progress status for the knowledge
+	DeleteDocument(ctx context.Context, k *types.Knowledge, documentGroupID string, exclude bool) error
+	ReindexDocument(ctx context.Context, k *types.Knowledge, documentGroupID string) error
+	Evaluate(ctx context.Context, k *types.Knowledge, req *types.KnowledgeEvalRequest) (*types.KnowledgeEvalJob, error)
+	GetEvalJob(knowledgeID, jobID string) (*types.KnowledgeEvalJob, error)
 }
 
 var _ Manager = &Reconciler{}
 
+// Searcher runs a question against the knowledge the same way as the chat does, with the
+// query rewrite, the fusion and the reranking of the knowledge settings
+type Searcher interface {
+	SearchKnowledge(ctx context.Context, k *types.Knowledge, question string) ([]*types.SessionRAGResult, error)
+}
+
 type Reconciler struct {
-	config       *config.ServerConfig
-	store        store.Store
-	filestore    filestore.FileStore
-	extractor    extract.Extractor // Unstructured.io or equivalent
-	httpClient   *http.Client
-	ragClient    rag.RAG                                   // Default server RAG client
-	newRagClient func(settings *types.RAGSettings) rag.RAG // Custom RAG server client constructor
-	newCrawler   func(k *types.Knowledge) (crawler.Crawler, error)
-	progressMu   *sync.RWMutex
-	progress     map[string]types.KnowledgeProgress
-	cron         gocron.Scheduler
-	wg           sync.WaitGroup
+	config             *config.ServerConfig
+	store              store.Store
+	filestore          filestore.FileStore
+	extractor          extract.Extractor // Unstructured.io or equivalent
+	extractionCache    *extractionCache  // Nil if the extracted texts are not cached
+	httpClient         *http.Client
+	ragClient          rag.RAG                                   // Default server RAG client
+	embedder           rag.Embedder                              // Embeddings for the semantic text splitter, nil if not configured
+	searcher           Searcher                                  // Runs the eval questions
+	newRagClient       func(settings *types.RAGSettings) rag.RAG // Custom RAG server client constructor
+	newCrawler         func(k *types.Knowledge, previous *types.CrawledSources, checkpointer crawler.Checkpointer) (crawler.Crawler, error)
+	newS3Storage       func(source *types.KnowledgeSourceS3) (filestore.FileStore, error)
+	newGCSStorage      func(ctx context.Context, source *types.KnowledgeSourceGCS) (filestore.FileStore, error)
+	cloneGitRepository func(ctx context.Context, source *types.KnowledgeSourceGithub, depth int) (*git.Repository, error)
+	progressMu         *sync.RWMutex
+	progress           map[string]types.KnowledgeProgress
+	indexing           sync.Map // Knowledge IDs being written to, see lockKnowledge
+	evalJobsMu         sync.RWMutex
+	evalJobs           map[string]*types.KnowledgeEvalJob
+	cron               gocron.Scheduler
+	wg                 sync.WaitGroup
 }
 
-func New(config *config.ServerConfig, store store.Store, filestore filestore.FileStore, extractor extract.Extractor, ragClient rag.RAG, b *browser.Browser) (*Reconciler, error) {
+func New(config *config.ServerConfig, store store.Store, filestore filestore.FileStore, extractor extract.Extractor, ragClient rag.RAG, embedder rag.Embedder, searcher Searcher, b *browser.Browser) (*Reconciler, error) {
 	s, err := gocron.NewScheduler()
 	if err != nil {
 		return nil, fmt.Errorf("failed to create scheduler: %w", err)
@@ -56,27 +77,45 @@ func New(config *config.ServerConfig, store store.Store, filestore filestore.Fil
 		extractor:  extractor,
 		httpClient: http.DefaultClient,
 		ragClient:  ragClient,
+		embedder:   embedder,
+		searcher:   searcher,
 		newRagClient: func(settings *types.RAGSettings) rag.RAG {
 			return rag.NewLlamaindex(settings)
 		},
 		// newCrawler: ,
-		progressMu: &sync.RWMutex{},
-		progress:   make(map[string]types.KnowledgeProgress),
+		newS3Storage:  newS3Storage,
+		newGCSStorage: newGCSStorage,
+		progressMu:    &sync.RWMutex{},
+		progress:      make(map[string]types.KnowledgeProgress),
+		evalJobs:      make(map[string]*types.KnowledgeEvalJob),
+	}
+
+	if config.TextExtractor.CacheEnabled {
+		r.extractionCache = newExtractionCache(filestore, config.Controller.FilePrefixGlobal, extractor, int64(config.TextExtractor.CacheMaxSizeMB)*1024*1024)
 	}
 
-	r.newCrawler = func(k *types.Knowledge) (crawler.Crawler, error) {
+	r.cloneGitRepository = r.cloneGitSource
+
+	r.newCrawler = func(k *types.Knowledge, previous *types.CrawledSources, checkpointer crawler.Checkpointer) (crawler.Crawler, error) {
 		// Provide an ability for the crawler to update the progress
 		updateProgress := func(progress types.KnowledgeProgress) {
 			r.updateKnowledgeProgress(k.ID, progress)
 		}
 
 		// Construct the crawler
-		return crawler.NewCrawler(b, k, updateProgress)
+		return crawler.NewCrawler(b, k, previous, checkpointer, updateProgress)
 	}
 
 	return r, nil
 }
 
+// newCrawlCheckpointer stores the checkpoints of the knowledge crawls outside of the user
+// directories, they are deleted once the knowledge is indexed
+func (r *Reconciler) newCrawlCheckpointer(k *types.Knowledge) *crawler.FilestoreCheckpointer {
+	path := filepath.Join(r.config.Controller.FilePrefixGlobal, "knowledge-checkpoints", k.ID)
+	return crawler.NewFilestoreCheckpointer(r.filestore, path)
+}
+
 func (r *Reconciler) Start(ctx context.Context) error {
 	err := r.reset(ctx)
 	if err != nil {
@@ -104,6 +143,8 @@ func (r *Reconciler) Start(ctx context.Context) error {
 		r.runCronManager(ctx)
 	}()
 
+	go r.runExtractionCacheEviction(ctx)
+
 	wg.Wait()
 
 	return nil
@@ -185,9 +226,25 @@ func (r *Reconciler) updateKnowledgeProgress(knowledgeID string, progress types.
 	r.progressMu.Lock()
 	defer r.progressMu.Unlock()
 
+	// Extraction cache stats are kept for the rest of the indexing
+	if progress.ExtractionCache == nil {
+		progress.ExtractionCache = r.progress[knowledgeID].ExtractionCache
+	}
+
 	r.progress[knowledgeID] = progress
 }
 
+// lockKnowledge returns false if the knowledge is already being indexed, refreshed or has a
+// document re-indexed. Only one of them can write to the knowledge at a time.
+func (r *Reconciler) lockKnowledge(knowledgeID string) bool {
+	_, locked := r.indexing.LoadOrStore(knowledgeID, struct{}{})
+	return !locked
+}
+
+func (r *Reconciler) unlockKnowledge(knowledgeID string) {
+	r.indexing.Delete(knowledgeID)
+}
+
 func (r *Reconciler) resetKnowledgeProgress(knowledgeID string) {
 	r.progressMu.Lock()
 	defer r.progressMu.Unlock()
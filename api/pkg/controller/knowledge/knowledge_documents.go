@@ -0,0 +1,455 @@
+package knowledge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/helixml/helix/api/pkg/filestore"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+// ErrDocumentNotFound is returned when the knowledge has no document with the ID
+var ErrDocumentNotFound = errors.New("document not found in the knowledge")
+
+// ErrKnowledgeBusy is returned when the knowledge is being indexed
+var ErrKnowledgeBusy = errors.New("knowledge is being indexed, please wait")
+
+const (
+	skipReasonExcluded = "excluded"
+	skipReasonDeleted  = "deleted"
+)
+
+// GetDocuments returns the documents of the crawled sources, the exclusions are
+// taken from the knowledge as they apply to all the versions
+func GetDocuments(k *types.Knowledge, sources *types.CrawledSources) []*types.KnowledgeDocument {
+	if sources == nil {
+		return []*types.KnowledgeDocument{}
+	}
+
+	documents := make([]*types.KnowledgeDocument, 0, len(sources.URLs))
+	for _, u := range sources.URLs {
+		documents = append(documents, &types.KnowledgeDocument{
+			ID:          getDocumentGroupID(u.URL),
+			Source:      u.URL,
+			DocumentID:  u.DocumentID,
+			StatusCode:  u.StatusCode,
+			Message:     u.Message,
+			SkipReason:  u.SkipReason,
+			DuplicateOf: u.DuplicateOf,
+			Excluded:    k.ExcludedDocuments.Contains(u.URL),
+		})
+	}
+
+	return documents
+}
+
+// markExcludedData skips the documents the user excluded, they are still listed
+// in the crawled sources so that they can be re-included later. Returns the
+// number of excluded documents.
+func markExcludedData(k *types.Knowledge, data []*indexerData) int {
+	count := 0
+	for _, d := range data {
+		if k.ExcludedDocuments.Contains(d.Source) {
+			d.SkipReason = skipReasonExcluded
+			d.DuplicateOf = ""
+			count++
+		}
+	}
+	return count
+}
+
+// getCrawledSource returns the crawled source of the current version by its document group ID
+func getCrawledSource(k *types.Knowledge, documentGroupID string) (*types.CrawledURL, error) {
+	if k.CrawledSources != nil {
+		for _, u := range k.CrawledSources.URLs {
+			if getDocumentGroupID(u.URL) == documentGroupID {
+				return u, nil
+			}
+		}
+	}
+	return nil, ErrDocumentNotFound
+}
+
+// DeleteDocument removes the chunks of the document from the current version. Excluded
+// documents are also skipped by the following refreshes, otherwise the next refresh
+// indexes the document again.
+func (r *Reconciler) DeleteDocument(ctx context.Context, k *types.Knowledge, documentGroupID string, exclude bool) error {
+	if _, err := getCrawledSource(k, documentGroupID); err != nil {
+		return err
+	}
+
+	// A refresh would write the crawled sources it started with back
+	if !r.lockKnowledge(k.ID) {
+		return ErrKnowledgeBusy
+	}
+	defer r.unlockKnowledge(k.ID)
+
+	// Loaded again, a refresh or re-index could have finished since the request loaded it
+	latest, err := r.store.GetKnowledge(ctx, k.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get knowledge, error: %w", err)
+	}
+	*k = *latest
+
+	crawled, err := getCrawledSource(k, documentGroupID)
+	if err != nil {
+		return err
+	}
+
+	err = r.getRagClient(k).DeleteDocuments(ctx, &types.DeleteDocumentsRequest{
+		DataEntityID:     k.GetDataEntityID(),
+		DocumentGroupIDs: []string{documentGroupID},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete document chunks, error: %w", err)
+	}
+
+	crawled.DocumentID = ""
+	crawled.SkipReason = skipReasonDeleted
+
+	if exclude {
+		crawled.SkipReason = skipReasonExcluded
+		if !k.ExcludedDocuments.Contains(crawled.URL) {
+			k.ExcludedDocuments = append(k.ExcludedDocuments, crawled.URL)
+		}
+	}
+
+	_, err = r.store.UpdateKnowledge(ctx, k)
+	if err != nil {
+		return fmt.Errorf("failed to update knowledge, error: %w", err)
+	}
+
+	log.Info().
+		Str("knowledge_id", k.ID).
+		Str("source", crawled.URL).
+		Bool("exclude", exclude).
+		Msg("deleted knowledge document")
+
+	return nil
+}
+
+// ReindexDocument fetches the document from the knowledge source again and replaces its chunks
+// in the current version in the background, the knowledge is in the indexing state until then.
+// Excluded documents are included again.
+func (r *Reconciler) ReindexDocument(ctx context.Context, k *types.Knowledge, documentGroupID string) error {
+	if k.Version == "" {
+		return fmt.Errorf("knowledge is not indexed yet")
+	}
+
+	if _, err := getCrawledSource(k, documentGroupID); err != nil {
+		return err
+	}
+
+	// Holds off the refreshes, they would replace the version being written to
+	if !r.lockKnowledge(k.ID) {
+		return ErrKnowledgeBusy
+	}
+
+	k.State = types.KnowledgeStateIndexing
+	k.Message = ""
+
+	if _, err := r.store.UpdateKnowledge(ctx, k); err != nil {
+		r.unlockKnowledge(k.ID)
+		return fmt.Errorf("failed to update knowledge, error: %w", err)
+	}
+
+	r.wg.Add(1)
+
+	go func() {
+		defer r.wg.Done()
+		defer r.unlockKnowledge(k.ID)
+
+		// The request is done by the time the document is indexed
+		err := r.reindexDocument(context.WithoutCancel(ctx), k.ID, documentGroupID)
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Str("knowledge_id", k.ID).
+				Str("document_id", documentGroupID).
+				Msg("failed to re-index knowledge document")
+		}
+	}()
+
+	return nil
+}
+
+func (r *Reconciler) reindexDocument(ctx context.Context, knowledgeID, documentGroupID string) error {
+	// Loaded again, the knowledge of the request is still used by the handler
+	k, err := r.store.GetKnowledge(ctx, knowledgeID)
+	if err != nil {
+		return fmt.Errorf("failed to get knowledge, error: %w", err)
+	}
+
+	crawled, err := getCrawledSource(k, documentGroupID)
+	if err == nil {
+		var data []*indexerData
+
+		data, err = r.indexDocument(ctx, k, crawled)
+		if err == nil {
+			d := data[0]
+
+			crawled.DocumentID = getDocumentID(d.Data)
+			crawled.MetadataHash = getMetadataHash(d.Metadata)
+			crawled.StatusCode = d.StatusCode
+			crawled.Message = d.Message
+			crawled.SkipReason = ""
+			crawled.DuplicateOf = ""
+			if crawled.Fingerprint != "" {
+				crawled.Fingerprint = getFingerprint(d.Data)
+			}
+
+			excluded := k.ExcludedDocuments[:0]
+			for _, source := range k.ExcludedDocuments {
+				if source != crawled.URL {
+					excluded = append(excluded, source)
+				}
+			}
+			k.ExcludedDocuments = excluded
+		}
+	}
+
+	r.resetKnowledgeProgress(k.ID)
+
+	// The rest of the version is still served so it goes back to ready either way
+	k.State = types.KnowledgeStateReady
+	k.Message = ""
+
+	if err != nil {
+		k.Message = fmt.Sprintf("failed to re-index document '%s': %s", documentGroupID, err)
+		if crawled != nil {
+			k.Message = fmt.Sprintf("failed to re-index document '%s': %s", crawled.URL, err)
+		}
+	}
+
+	if _, updateErr := r.store.UpdateKnowledge(ctx, k); updateErr != nil {
+		return fmt.Errorf("failed to update knowledge, error: %w", updateErr)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	log.Info().
+		Str("knowledge_id", k.ID).
+		Str("source", crawled.URL).
+		Msg("re-indexed knowledge document")
+
+	return nil
+}
+
+// indexDocument fetches the document and replaces its chunks in the current version
+func (r *Reconciler) indexDocument(ctx context.Context, k *types.Knowledge, crawled *types.CrawledURL) ([]*indexerData, error) {
+	data, err := r.getDocumentData(ctx, k, crawled.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get document data, error: %w", err)
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("document is no longer in the knowledge source")
+	}
+
+	err = r.getRagClient(k).DeleteDocuments(ctx, &types.DeleteDocumentsRequest{
+		DataEntityID:     k.GetDataEntityID(),
+		DocumentGroupIDs: []string{getDocumentGroupID(crawled.URL)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete document chunks, error: %w", err)
+	}
+
+	startedAt := time.Now()
+
+	if k.RAGSettings.DisableChunking {
+		err = r.indexDataDirectly(ctx, k, k.Version, data, startedAt)
+	} else {
+		err = r.indexDataWithChunking(ctx, k, k.Version, data, startedAt)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to index document, error: %w", err)
+	}
+
+	return data, nil
+}
+
+// getDocumentData fetches a single document from the knowledge source. Web pages are
+// fetched the same way as when the knowledge is refreshed, files are read together
+// with their metadata sidecar file.
+func (r *Reconciler) getDocumentData(ctx context.Context, k *types.Knowledge, source string) ([]*indexerData, error) {
+	switch {
+	case k.Source.Web != nil:
+		return r.getWebDocument(ctx, k, source)
+	case k.Source.Filestore != nil:
+		data, err := readFilestoreDocument(ctx, r.filestore, source)
+		if err != nil || len(data) == 0 {
+			return nil, err
+		}
+		return r.extractFiles(ctx, k, data)
+	case k.Source.S3 != nil:
+		return r.getS3Document(ctx, k, source)
+	case k.Source.GCS != nil:
+		return r.getGCSDocument(ctx, k, source)
+	case k.Source.Git != nil:
+		return r.getGitFiles(ctx, k, source)
+	}
+
+	return nil, fmt.Errorf("re-indexing a single document is not supported for this knowledge source")
+}
+
+// getWebDocument fetches a single page of the web source. With the crawler enabled the page
+// is crawled with the same auth and readability settings as the refreshes, but the links and
+// the sitemaps are not followed.
+func (r *Reconciler) getWebDocument(ctx context.Context, k *types.Knowledge, source string) ([]*indexerData, error) {
+	web := *k.Source.Web
+	web.URLs = []string{source}
+
+	page := *k
+	page.Source.Web = &web
+
+	if !crawlerEnabled(&page) {
+		return r.extractDataFromWeb(ctx, &page)
+	}
+
+	settings := *web.Crawler
+	settings.MaxDepth = 1
+	settings.Sitemaps = nil
+	settings.IgnoreSitemap = true
+	web.Crawler = &settings
+
+	evaluated, err := r.evalWebAuth(ctx, &page)
+	if err != nil {
+		return nil, err
+	}
+
+	// Not checkpointed, the checkpoint of an interrupted refresh is still resumed
+	crawler, err := r.newCrawler(evaluated, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create crawler: %w", err)
+	}
+
+	docs, err := crawler.Crawl(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to crawl: %w", err)
+	}
+
+	// Firecrawl doesn't limit the depth, the other pages are dropped. The default
+	// crawler returns the page under its final URL if it was redirected.
+	var doc *types.CrawledDocument
+	for _, d := range docs {
+		if d.SourceURL == source {
+			doc = d
+			break
+		}
+	}
+	if doc == nil && len(docs) == 1 {
+		doc = docs[0]
+	}
+
+	if doc == nil {
+		return nil, nil
+	}
+
+	if doc.Content == "" && doc.Message != "" {
+		return nil, fmt.Errorf("failed to crawl %s: %s", source, doc.Message)
+	}
+
+	return []*indexerData{
+		{
+			Data:            []byte(doc.Content),
+			Source:          source,
+			DocumentGroupID: getDocumentGroupID(source),
+			StatusCode:      doc.StatusCode,
+			DurationMs:      doc.DurationMs,
+			Message:         doc.Message,
+			LastModified:    doc.LastModified,
+		},
+	}, nil
+}
+
+func (r *Reconciler) getS3Document(ctx context.Context, k *types.Knowledge, source string) ([]*indexerData, error) {
+	s3Source, err := r.evalS3Source(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := fmt.Sprintf("s3://%s/", s3Source.Bucket)
+	if !strings.HasPrefix(source, prefix) {
+		return nil, nil
+	}
+
+	s3, err := r.newS3Storage(s3Source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	data, err := readFilestoreDocument(ctx, s3, strings.TrimPrefix(source, prefix))
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+
+	for _, d := range data {
+		d.Source = prefix + d.Source
+		d.DocumentGroupID = getDocumentGroupID(d.Source)
+	}
+
+	return r.extractFiles(ctx, k, data)
+}
+
+func (r *Reconciler) getGCSDocument(ctx context.Context, k *types.Knowledge, source string) ([]*indexerData, error) {
+	gcsSource, err := r.evalGCSSource(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := fmt.Sprintf("gs://%s/", gcsSource.Bucket)
+	if !strings.HasPrefix(source, prefix) {
+		return nil, nil
+	}
+
+	gcs, err := r.newGCSStorage(ctx, gcsSource)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+
+	data, err := readFilestoreDocument(ctx, gcs, strings.TrimPrefix(source, prefix))
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+
+	for _, d := range data {
+		d.Source = prefix + d.Source
+		d.DocumentGroupID = getDocumentGroupID(d.Source)
+	}
+
+	return r.extractFiles(ctx, k, data)
+}
+
+// readFilestoreDocument reads the file together with its metadata sidecar file, if any.
+// Nothing is returned if the file doesn't exist anymore.
+func readFilestoreDocument(ctx context.Context, fs filestore.FileStore, path string) ([]*indexerData, error) {
+	var data []*indexerData
+
+	for _, p := range []string{path, path + metadataSidecarSuffix} {
+		bts, err := filestore.ReadFile(ctx, fs, p)
+		if err != nil {
+			if !filestore.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to read file at %s, error: %w", p, err)
+			}
+			if p == path {
+				return nil, nil
+			}
+			continue
+		}
+
+		data = append(data, &indexerData{
+			Data:            bts,
+			Source:          p,
+			DocumentGroupID: getDocumentGroupID(p),
+		})
+	}
+
+	return data, nil
+}
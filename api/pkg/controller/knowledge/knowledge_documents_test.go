@@ -0,0 +1,180 @@
+package knowledge
+
+import (
+	"go.uber.org/mock/gomock"
+
+	"github.com/helixml/helix/api/pkg/controller/knowledge/crawler"
+	"github.com/helixml/helix/api/pkg/extract"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+func newDocumentsKnowledge() *types.Knowledge {
+	return &types.Knowledge{
+		ID:      "knowledge_id",
+		Version: "v1",
+		State:   types.KnowledgeStateReady,
+		RAGSettings: types.RAGSettings{
+			TextSplitter: types.TextSplitterTypeText,
+			ChunkSize:    2048,
+		},
+		Source: types.KnowledgeSource{
+			Web: &types.KnowledgeSourceWeb{
+				URLs: []string{"https://example.com"},
+				Crawler: &types.WebsiteCrawler{
+					Enabled: true,
+				},
+			},
+		},
+		CrawledSources: &types.CrawledSources{
+			URLs: []*types.CrawledURL{
+				{URL: "https://example.com", DocumentID: "aaa"},
+				{URL: "https://example.com/pricing", DocumentID: "bbb"},
+			},
+		},
+	}
+}
+
+func (suite *IndexerSuite) TestDeleteDocument_Exclude() {
+	k := newDocumentsKnowledge()
+	groupID := getDocumentGroupID("https://example.com/pricing")
+
+	suite.store.EXPECT().GetKnowledge(gomock.Any(), "knowledge_id").Return(newDocumentsKnowledge(), nil)
+
+	suite.rag.EXPECT().DeleteDocuments(gomock.Any(), &types.DeleteDocumentsRequest{
+		DataEntityID:     "knowledge_id-v1",
+		DocumentGroupIDs: []string{groupID},
+	}).Return(nil)
+
+	suite.store.EXPECT().UpdateKnowledge(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ interface{}, k *types.Knowledge) (*types.Knowledge, error) {
+			suite.Equal(types.ExcludedDocuments{"https://example.com/pricing"}, k.ExcludedDocuments)
+			return k, nil
+		})
+
+	err := suite.reconciler.DeleteDocument(suite.ctx, k, groupID, true)
+	suite.Require().NoError(err)
+
+	documents := GetDocuments(k, k.CrawledSources)
+	suite.Require().Len(documents, 2)
+	suite.False(documents[0].Excluded)
+	suite.True(documents[1].Excluded)
+	suite.Equal(skipReasonExcluded, documents[1].SkipReason)
+	suite.Equal("", documents[1].DocumentID)
+
+	// Excluded documents are skipped by the refresh
+	data := []*indexerData{
+		{Source: "https://example.com", Data: []byte("home")},
+		{Source: "https://example.com/pricing", Data: []byte("pricing")},
+	}
+	suite.Equal(1, markExcludedData(k, data))
+	suite.Len(getIndexedData(data), 1)
+}
+
+func (suite *IndexerSuite) TestDeleteDocument_NotFound() {
+	err := suite.reconciler.DeleteDocument(suite.ctx, newDocumentsKnowledge(), "unknown", false)
+	suite.ErrorIs(err, ErrDocumentNotFound)
+}
+
+func (suite *IndexerSuite) TestDeleteDocument_Busy() {
+	k := newDocumentsKnowledge()
+
+	// The refresh of the knowledge is running
+	suite.Require().True(suite.reconciler.lockKnowledge(k.ID))
+	defer suite.reconciler.unlockKnowledge(k.ID)
+
+	err := suite.reconciler.DeleteDocument(suite.ctx, k, getDocumentGroupID("https://example.com/pricing"), false)
+	suite.ErrorIs(err, ErrKnowledgeBusy)
+}
+
+func (suite *IndexerSuite) TestReindexDocument() {
+	k := newDocumentsKnowledge()
+	k.ExcludedDocuments = types.ExcludedDocuments{"https://example.com/pricing"}
+	k.Source.Web.Crawler.Readability = true
+	k.Source.Web.Crawler.MaxDepth = 10
+	groupID := getDocumentGroupID("https://example.com/pricing")
+
+	// Only the page is crawled, with the settings of the refreshes
+	suite.reconciler.newCrawler = func(k *types.Knowledge, previous *types.CrawledSources, checkpointer crawler.Checkpointer) (crawler.Crawler, error) {
+		suite.Equal([]string{"https://example.com/pricing"}, k.Source.Web.URLs)
+		suite.Equal(1, k.Source.Web.Crawler.MaxDepth)
+		suite.True(k.Source.Web.Crawler.IgnoreSitemap)
+		suite.True(k.Source.Web.Crawler.Readability)
+		suite.Nil(previous)
+		suite.Nil(checkpointer)
+		return suite.crawler, nil
+	}
+
+	suite.crawler.EXPECT().Crawl(gomock.Any()).Return([]*types.CrawledDocument{
+		{SourceURL: "https://example.com/pricing", Content: "new pricing", StatusCode: 200},
+	}, nil)
+
+	suite.rag.EXPECT().DeleteDocuments(gomock.Any(), &types.DeleteDocumentsRequest{
+		DataEntityID:     "knowledge_id-v1",
+		DocumentGroupIDs: []string{groupID},
+	}).Return(nil)
+
+	suite.rag.EXPECT().Index(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ interface{}, chunks ...*types.SessionRAGIndexChunk) error {
+			suite.Require().Len(chunks, 1)
+			suite.Equal("knowledge_id-v1", chunks[0].DataEntityID)
+			suite.Equal("new pricing", chunks[0].Content)
+			return nil
+		})
+
+	// The document is indexed in the background on the stored knowledge
+	stored := newDocumentsKnowledge()
+	stored.Source.Web.Crawler.Readability = true
+	stored.Source.Web.Crawler.MaxDepth = 10
+	stored.ExcludedDocuments = types.ExcludedDocuments{"https://example.com/pricing"}
+
+	suite.store.EXPECT().GetKnowledge(gomock.Any(), "knowledge_id").Return(stored, nil)
+	suite.store.EXPECT().UpdateKnowledgeState(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	gomock.InOrder(
+		suite.store.EXPECT().UpdateKnowledge(gomock.Any(), k).DoAndReturn(
+			func(_ interface{}, k *types.Knowledge) (*types.Knowledge, error) {
+				suite.Equal(types.KnowledgeStateIndexing, k.State)
+				return k, nil
+			}),
+		suite.store.EXPECT().UpdateKnowledge(gomock.Any(), stored).Return(stored, nil),
+	)
+
+	err := suite.reconciler.ReindexDocument(suite.ctx, k, groupID)
+	suite.Require().NoError(err)
+
+	suite.reconciler.wg.Wait()
+
+	suite.Equal(types.KnowledgeStateReady, stored.State)
+	suite.Empty(stored.Message)
+	suite.Empty(stored.ExcludedDocuments)
+	suite.Equal(getDocumentID([]byte("new pricing")), stored.CrawledSources.URLs[1].DocumentID)
+	suite.Equal(200, stored.CrawledSources.URLs[1].StatusCode)
+}
+
+func (suite *IndexerSuite) TestGetDocumentData_WebWithoutCrawler() {
+	k := newDocumentsKnowledge()
+	k.Source.Web.Crawler = nil
+	groupID := getDocumentGroupID("https://example.com/pricing")
+
+	suite.extractor.EXPECT().Extract(gomock.Any(), &extract.Request{
+		URL: "https://example.com/pricing",
+	}).Return("new pricing", nil)
+
+	data, err := suite.reconciler.getDocumentData(suite.ctx, k, "https://example.com/pricing")
+	suite.Require().NoError(err)
+	suite.Require().Len(data, 1)
+	suite.Equal(groupID, data[0].DocumentGroupID)
+	suite.Equal("new pricing", string(data[0].Data))
+}
+
+func (suite *IndexerSuite) TestReindexDocument_Busy() {
+	k := newDocumentsKnowledge()
+
+	// The refresh of the knowledge is running
+	suite.Require().True(suite.reconciler.lockKnowledge(k.ID))
+	defer suite.reconciler.unlockKnowledge(k.ID)
+
+	err := suite.reconciler.ReindexDocument(suite.ctx, k, getDocumentGroupID("https://example.com/pricing"))
+	suite.ErrorIs(err, ErrKnowledgeBusy)
+	suite.Equal(types.KnowledgeStateReady, k.State)
+}
@@ -0,0 +1,220 @@
+package knowledge
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/bits"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+const (
+	// At most 3 of the 64 fingerprint bits differ, lower values also match
+	// pages that only share their boilerplate
+	defaultDuplicateSimilarity = 0.95
+	// Words hashed together into the fingerprint features
+	simhashShingleSize = 3
+)
+
+// fingerprint is the SimHash of a crawled page
+type fingerprint struct {
+	data *indexerData
+	// documentID is the hash of the contents, same for the exact duplicates
+	documentID string
+	hash       uint64
+	// position in the crawl, the earliest page is kept when several match
+	position int
+}
+
+func getDuplicateSimilarity(crawler *types.WebsiteCrawler) float64 {
+	if crawler == nil || crawler.DuplicateSimilarity <= 0 {
+		return defaultDuplicateSimilarity
+	}
+	return crawler.DuplicateSimilarity
+}
+
+// getFingerprint returns the SimHash of the contents as stored in the crawled sources
+func getFingerprint(contents []byte) string {
+	return strconv.FormatUint(simhash(string(contents)), 16)
+}
+
+// markDuplicates skips the pages that are near duplicates of a page crawled before them, the
+// pages are compared with the SimHash of their contents. Unchanged pages that were not fetched
+// again are compared with the fingerprint stored in the previous crawl. Pages without contents
+// or fingerprint (errors) are ignored. Returns the number of duplicates.
+func markDuplicates(data []*indexerData, similarity float64) int {
+	var (
+		index      = newFingerprintIndex(similarity)
+		duplicates int
+	)
+
+	for i, d := range data {
+		if d.SkipReason != "" {
+			continue
+		}
+
+		current := &fingerprint{data: d, position: i}
+
+		switch {
+		case len(d.Data) > 0:
+			current.hash = simhash(string(d.Data))
+			current.documentID = getDocumentID(d.Data)
+		case d.Fingerprint != "" && d.DocumentID != "":
+			hash, err := strconv.ParseUint(d.Fingerprint, 16, 64)
+			if err != nil {
+				continue
+			}
+			current.hash = hash
+			current.documentID = d.DocumentID
+		default:
+			continue
+		}
+
+		original, score := index.findDuplicate(current)
+		if original == nil {
+			// Stored with the crawled sources for the next refresh
+			d.Fingerprint = strconv.FormatUint(current.hash, 16)
+			index.add(current)
+			continue
+		}
+
+		if original.documentID == current.documentID {
+			d.SkipReason = "duplicate"
+		} else {
+			d.SkipReason = fmt.Sprintf("near duplicate (%.0f%% similar)", score*100)
+		}
+		d.DuplicateOf = original.data.Source
+		duplicates++
+	}
+
+	return duplicates
+}
+
+// fingerprintIndex finds the similar fingerprints without comparing all of them. Fingerprints
+// that differ in at most k bits are identical in at least one of k+1 bands of bits, so only
+// the fingerprints sharing a band are compared.
+type fingerprintIndex struct {
+	similarity float64
+	bands      int
+	buckets    map[fingerprintBand][]*fingerprint
+}
+
+type fingerprintBand struct {
+	band  int
+	value uint64
+}
+
+func newFingerprintIndex(similarity float64) *fingerprintIndex {
+	// Bits that can differ, with a bit of tolerance for the float rounding
+	maxDistance := int((1-similarity)*64 + 1e-9)
+
+	return &fingerprintIndex{
+		similarity: similarity,
+		bands:      min(max(maxDistance+1, 1), 64),
+		buckets:    make(map[fingerprintBand][]*fingerprint),
+	}
+}
+
+func (idx *fingerprintIndex) getBands(hash uint64) []fingerprintBand {
+	bands := make([]fingerprintBand, 0, idx.bands)
+
+	for band := 0; band < idx.bands; band++ {
+		from := band * 64 / idx.bands
+		to := (band + 1) * 64 / idx.bands
+
+		mask := uint64(1)<<(to-from) - 1
+		if to-from == 64 {
+			mask = ^uint64(0)
+		}
+
+		bands = append(bands, fingerprintBand{band: band, value: (hash >> from) & mask})
+	}
+
+	return bands
+}
+
+func (idx *fingerprintIndex) add(f *fingerprint) {
+	for _, band := range idx.getBands(f.hash) {
+		idx.buckets[band] = append(idx.buckets[band], f)
+	}
+}
+
+// findDuplicate returns the earliest similar page
+func (idx *fingerprintIndex) findDuplicate(current *fingerprint) (*fingerprint, float64) {
+	var (
+		found *fingerprint
+		score float64
+	)
+
+	for _, band := range idx.getBands(current.hash) {
+		for _, f := range idx.buckets[band] {
+			if found != nil && f.position >= found.position {
+				continue
+			}
+
+			s := simhashSimilarity(f.hash, current.hash)
+			if s >= idx.similarity {
+				found, score = f, s
+			}
+		}
+	}
+
+	return found, score
+}
+
+// simhash returns the 64 bit SimHash of the text, the features are the shingles of
+// consecutive words so that similar texts have fingerprints with few differing bits
+func simhash(text string) uint64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+
+	size := simhashShingleSize
+	if len(words) < size {
+		size = 1
+	}
+
+	var weights [64]int
+
+	for i := 0; i+size <= len(words); i++ {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(strings.Join(words[i:i+size], " ")))
+		feature := h.Sum64()
+
+		for bit := 0; bit < 64; bit++ {
+			if feature&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+
+	var fingerprint uint64
+	for bit := 0; bit < 64; bit++ {
+		if weights[bit] > 0 {
+			fingerprint |= 1 << bit
+		}
+	}
+
+	return fingerprint
+}
+
+// simhashSimilarity is the share of the matching bits of the fingerprints
+func simhashSimilarity(a, b uint64) float64 {
+	return 1 - float64(bits.OnesCount64(a^b))/64
+}
+
+// getIndexedData returns the data without the skipped documents
+func getIndexedData(data []*indexerData) []*indexerData {
+	indexed := make([]*indexerData, 0, len(data))
+	for _, d := range data {
+		if d.SkipReason == "" {
+			indexed = append(indexed, d)
+		}
+	}
+	return indexed
+}
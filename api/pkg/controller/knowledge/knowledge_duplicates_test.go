@@ -0,0 +1,153 @@
+package knowledge
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+const testArticle = `# Shark species
+
+Tiger sharks are large macropredators, capable of attaining a length over five metres.
+They are found in many tropical and warm temperate waters, and are especially common
+around central Pacific islands. Their name derives from the dark stripes down their body,
+which resemble a tiger's pattern, but fade as the shark matures. The tiger shark is a
+solitary, mostly nocturnal hunter. It is notable for having the widest food spectrum of
+all sharks, with a range of prey that includes crustaceans, fish, seals, birds, squid,
+turtles, sea snakes, dolphins, and even other smaller sharks.`
+
+func Test_markDuplicates(t *testing.T) {
+	data := []*indexerData{
+		{Source: "https://example.com/sharks", Data: []byte(testArticle)},
+		// Print view with a different footer
+		{Source: "https://example.com/sharks?print=1", Data: []byte(testArticle + "\n\nPrinted from example.com")},
+		{Source: "https://example.com/sharks/", Data: []byte(testArticle)},
+		{Source: "https://example.com/music", Data: []byte("Taylor Swift released The Tortured Poets Department and went on the Eras tour across five continents.")},
+		// Errors are not compared
+		{Source: "https://example.com/error", Message: "timeout"},
+		{Source: "https://example.com/error2", Message: "timeout"},
+	}
+
+	// The footer flips more bits of the short test page than the default allows
+	duplicates := markDuplicates(data, 0.9)
+	require.Equal(t, 2, duplicates)
+
+	require.Empty(t, data[0].SkipReason)
+
+	require.True(t, strings.HasPrefix(data[1].SkipReason, "near duplicate"), data[1].SkipReason)
+	require.Equal(t, "https://example.com/sharks", data[1].DuplicateOf)
+
+	require.Equal(t, "duplicate", data[2].SkipReason)
+	require.Equal(t, "https://example.com/sharks", data[2].DuplicateOf)
+
+	for _, d := range data[3:] {
+		require.Empty(t, d.SkipReason, d.Source)
+	}
+
+	indexed := getIndexedData(data)
+	require.Len(t, indexed, 4)
+
+	crawled := getCrawledSources(data)
+	require.Len(t, crawled, 6)
+	require.Equal(t, "duplicate", crawled[2].SkipReason)
+	require.Equal(t, "https://example.com/sharks", crawled[2].DuplicateOf)
+	require.Empty(t, crawled[2].DocumentID, "skipped pages are not carried over")
+}
+
+func Test_markDuplicates_ExactOnly(t *testing.T) {
+	data := []*indexerData{
+		{Source: "https://example.com/sharks", Data: []byte(testArticle)},
+		{Source: "https://example.com/sharks?print=1", Data: []byte(testArticle + "\n\nPrinted from example.com")},
+		{Source: "https://example.com/sharks/", Data: []byte(testArticle)},
+	}
+
+	duplicates := markDuplicates(data, 1)
+	require.Equal(t, 1, duplicates)
+	require.Empty(t, data[1].SkipReason)
+	require.Equal(t, "duplicate", data[2].SkipReason)
+}
+
+func Test_markDuplicates_CarriedOver(t *testing.T) {
+	data := []*indexerData{
+		// Unchanged since the previous crawl, not fetched again
+		{
+			Source:      "https://example.com/sharks",
+			DocumentID:  getDocumentID([]byte(testArticle)),
+			Fingerprint: getFingerprint([]byte(testArticle)),
+			Unchanged:   true,
+		},
+		{Source: "https://example.com/sharks/", Data: []byte(testArticle)},
+		{Source: "https://example.com/sharks?print=1", Data: []byte(testArticle + "\n\nPrinted from example.com")},
+		// Carried over pages without fingerprint are not compared
+		{Source: "https://example.com/old", DocumentID: getDocumentID([]byte(testArticle)), Unchanged: true},
+	}
+
+	// The footer flips more bits of the short test page than the default allows
+	duplicates := markDuplicates(data, 0.9)
+	require.Equal(t, 2, duplicates)
+
+	require.Empty(t, data[0].SkipReason)
+	require.Equal(t, "duplicate", data[1].SkipReason)
+	require.Equal(t, "https://example.com/sharks", data[1].DuplicateOf)
+	require.True(t, strings.HasPrefix(data[2].SkipReason, "near duplicate"), data[2].SkipReason)
+	require.Empty(t, data[3].SkipReason)
+
+	// The fingerprints of the indexed pages are kept for the next refresh
+	crawled := getCrawledSources(data)
+	require.Equal(t, getFingerprint([]byte(testArticle)), crawled[0].Fingerprint)
+	require.Empty(t, crawled[1].Fingerprint)
+}
+
+func Test_fingerprintIndex(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+
+	for _, similarity := range []float64{1, defaultDuplicateSimilarity, 0.9, 0.8, 0.5} {
+		index := newFingerprintIndex(similarity)
+		maxDistance := int((1-similarity)*64 + 1e-9)
+
+		var originals []*fingerprint
+		for i := 0; i < 100; i++ {
+			f := &fingerprint{hash: rnd.Uint64(), position: i}
+			originals = append(originals, f)
+			index.add(f)
+		}
+
+		// Every fingerprint within the distance is found, no matter which bits differ
+		for _, original := range originals {
+			hash := original.hash
+			for _, bit := range rnd.Perm(64)[:maxDistance] {
+				hash ^= 1 << bit
+			}
+
+			found, score := index.findDuplicate(&fingerprint{hash: hash})
+			require.NotNil(t, found, "similarity %v", similarity)
+			require.GreaterOrEqual(t, score, similarity)
+			require.LessOrEqual(t, found.position, original.position)
+		}
+	}
+}
+
+func Test_simhashSimilarity(t *testing.T) {
+	a := simhash(testArticle)
+	require.Equal(t, a, simhash(strings.ToUpper(testArticle)), "case is ignored")
+	require.InDelta(t, 1, simhashSimilarity(a, a), 0)
+
+	other := simhash("Taylor Swift released The Tortured Poets Department and went on the Eras tour.")
+	require.Less(t, simhashSimilarity(a, other), defaultDuplicateSimilarity)
+}
+
+func Test_newFingerprintIndex_DefaultSimilarity(t *testing.T) {
+	// Up to 3 differing bits, 4 would already be below the default
+	require.Equal(t, 4, newFingerprintIndex(defaultDuplicateSimilarity).bands)
+	require.Less(t, 1-4.0/64, defaultDuplicateSimilarity)
+}
+
+func Test_getDuplicateSimilarity(t *testing.T) {
+	require.Equal(t, defaultDuplicateSimilarity, getDuplicateSimilarity(nil))
+	require.Equal(t, defaultDuplicateSimilarity, getDuplicateSimilarity(&types.WebsiteCrawler{}))
+	require.Equal(t, 0.8, getDuplicateSimilarity(&types.WebsiteCrawler{DuplicateSimilarity: 0.8}))
+}
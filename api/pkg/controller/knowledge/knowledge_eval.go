@@ -0,0 +1,436 @@
+package knowledge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/helixml/helix/api/pkg/rag"
+	"github.com/helixml/helix/api/pkg/store"
+	"github.com/helixml/helix/api/pkg/system"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+// ErrInvalidEvalRequest is returned when the eval request can't be run as requested
+var ErrInvalidEvalRequest = errors.New("invalid eval request")
+
+// ErrEvalJobNotFound is returned when the eval job doesn't exist or has expired
+var ErrEvalJobNotFound = errors.New("eval job not found")
+
+// ErrTooManyEvalJobs is returned when the knowledge or its owner already has the maximum
+// number of eval jobs running
+var ErrTooManyEvalJobs = errors.New("too many eval jobs running, please wait for them to finish")
+
+var evalVariantNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+const (
+	// evalJobTTL is how long the finished eval jobs can be polled for
+	evalJobTTL = time.Hour
+	// Variants index the whole knowledge source, the running jobs are limited
+	maxRunningEvalJobsPerKnowledge = 1
+	maxRunningEvalJobsPerOwner     = 3
+)
+
+// Evaluate starts the eval job that runs the golden set against the knowledge versions and
+// the RAG settings variants and reports the retrieval metrics of each of them. Variants are
+// indexed from the knowledge source into temporary indexes of a knowledge copy, the knowledge
+// keeps serving the requests and can be refreshed in the meantime. The questions are searched
+// the same way as in the chat, with the query rewrite and the reranking of the settings.
+func (r *Reconciler) Evaluate(ctx context.Context, k *types.Knowledge, req *types.KnowledgeEvalRequest) (*types.KnowledgeEvalJob, error) {
+	cases := req.Cases
+	if len(cases) == 0 {
+		cases = k.EvalSet
+	}
+
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("%w, knowledge has no eval set and no cases were provided", ErrInvalidEvalRequest)
+	}
+
+	if err := ValidateEvalSet(cases); err != nil {
+		return nil, fmt.Errorf("%w, %s", ErrInvalidEvalRequest, err)
+	}
+
+	versions := req.Versions
+	if len(versions) == 0 && len(req.Variants) == 0 {
+		if k.Version == "" {
+			return nil, fmt.Errorf("%w, knowledge is not indexed yet", ErrInvalidEvalRequest)
+		}
+		versions = []string{k.Version}
+	}
+
+	if err := r.checkEvalVersions(ctx, k, versions); err != nil {
+		return nil, err
+	}
+
+	if err := validateEvalVariants(req.Variants); err != nil {
+		return nil, fmt.Errorf("%w, %s", ErrInvalidEvalRequest, err)
+	}
+
+	if len(versions) > 0 {
+		if err := validateEvalSettings(&k.RAGSettings); err != nil {
+			return nil, fmt.Errorf("%w, %s", ErrInvalidEvalRequest, err)
+		}
+	}
+
+	if r.searcher == nil {
+		return nil, fmt.Errorf("knowledge eval is not available")
+	}
+
+	topK := req.K
+	if topK <= 0 {
+		topK = k.RAGSettings.ResultsCount
+	}
+	if topK <= 0 {
+		topK = rag.DefaultMaxResults
+	}
+
+	now := time.Now()
+	job := &types.KnowledgeEvalJob{
+		ID:          system.GenerateKnowledgeEvalID(),
+		KnowledgeID: k.ID,
+		Owner:       k.Owner,
+		Created:     now,
+		Updated:     now,
+		State:       types.KnowledgeEvalJobStateRunning,
+	}
+
+	if err := r.addEvalJob(job); err != nil {
+		return nil, err
+	}
+
+	knowledge := *k
+	variants := req.Variants
+
+	r.wg.Add(1)
+
+	go func() {
+		defer r.wg.Done()
+		defer r.resetKnowledgeProgress(job.ID)
+
+		// The request is done by the time the variants are indexed
+		resp, err := r.runEval(context.WithoutCancel(ctx), &knowledge, job.ID, cases, versions, variants, topK)
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Str("knowledge_id", knowledge.ID).
+				Str("job_id", job.ID).
+				Msg("knowledge eval failed")
+		}
+
+		r.finishEvalJob(job.ID, resp, err)
+	}()
+
+	return r.GetEvalJob(k.ID, job.ID)
+}
+
+func (r *Reconciler) runEval(ctx context.Context, k *types.Knowledge, jobID string, cases types.KnowledgeEvalSet, versions []string, variants []*types.KnowledgeEvalVariant, topK int) (*types.KnowledgeEvalResponse, error) {
+	resp := &types.KnowledgeEvalResponse{K: topK}
+
+	for _, version := range versions {
+		versionKnowledge := *k
+		versionKnowledge.Version = version
+
+		result, err := r.evaluateIndex(ctx, &versionKnowledge, cases, topK)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate version '%s', error: %w", version, err)
+		}
+		result.Version = version
+		resp.Results = append(resp.Results, result)
+	}
+
+	for _, variant := range variants {
+		result, err := r.evaluateVariant(ctx, k, jobID, variant, cases, topK)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate variant '%s', error: %w", variant.Name, err)
+		}
+		result.Variant = variant.Name
+		resp.Results = append(resp.Results, result)
+	}
+
+	return resp, nil
+}
+
+// GetEvalJob returns the eval job of the knowledge, the jobs are kept in memory
+// until evalJobTTL after they are finished
+func (r *Reconciler) GetEvalJob(knowledgeID, jobID string) (*types.KnowledgeEvalJob, error) {
+	r.evalJobsMu.RLock()
+	defer r.evalJobsMu.RUnlock()
+
+	job, ok := r.evalJobs[jobID]
+	if !ok || job.KnowledgeID != knowledgeID {
+		return nil, ErrEvalJobNotFound
+	}
+
+	result := *job
+	if result.State == types.KnowledgeEvalJobStateRunning {
+		result.Progress = r.GetStatus(jobID)
+	}
+
+	return &result, nil
+}
+
+func (r *Reconciler) addEvalJob(job *types.KnowledgeEvalJob) error {
+	r.evalJobsMu.Lock()
+	defer r.evalJobsMu.Unlock()
+
+	var knowledgeJobs, ownerJobs int
+
+	for id, existing := range r.evalJobs {
+		if existing.State != types.KnowledgeEvalJobStateRunning {
+			if time.Since(existing.Updated) > evalJobTTL {
+				delete(r.evalJobs, id)
+			}
+			continue
+		}
+
+		if existing.KnowledgeID == job.KnowledgeID {
+			knowledgeJobs++
+		}
+		if existing.Owner == job.Owner {
+			ownerJobs++
+		}
+	}
+
+	if knowledgeJobs >= maxRunningEvalJobsPerKnowledge || ownerJobs >= maxRunningEvalJobsPerOwner {
+		return ErrTooManyEvalJobs
+	}
+
+	r.evalJobs[job.ID] = job
+
+	return nil
+}
+
+func (r *Reconciler) finishEvalJob(jobID string, resp *types.KnowledgeEvalResponse, err error) {
+	r.evalJobsMu.Lock()
+	defer r.evalJobsMu.Unlock()
+
+	job, ok := r.evalJobs[jobID]
+	if !ok {
+		return
+	}
+
+	job.Updated = time.Now()
+
+	if err != nil {
+		job.State = types.KnowledgeEvalJobStateError
+		job.Error = err.Error()
+		return
+	}
+
+	job.State = types.KnowledgeEvalJobStateComplete
+	job.Result = resp
+}
+
+func (r *Reconciler) checkEvalVersions(ctx context.Context, k *types.Knowledge, versions []string) error {
+	if len(versions) == 0 {
+		return nil
+	}
+
+	existing, err := r.store.ListKnowledgeVersions(ctx, &store.ListKnowledgeVersionQuery{
+		KnowledgeID: k.ID,
+		State:       types.KnowledgeStateReady,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list knowledge versions, error: %w", err)
+	}
+
+	ready := make(map[string]bool, len(existing))
+	for _, v := range existing {
+		ready[v.Version] = true
+	}
+
+	for _, version := range versions {
+		if !ready[version] {
+			return fmt.Errorf("%w, knowledge version '%s' not found", ErrInvalidEvalRequest, version)
+		}
+	}
+
+	return nil
+}
+
+func validateEvalVariants(variants []*types.KnowledgeEvalVariant) error {
+	names := make(map[string]bool, len(variants))
+
+	for _, variant := range variants {
+		if !evalVariantNameRegexp.MatchString(variant.Name) {
+			return fmt.Errorf("variant name '%s' must only contain letters, digits, '-' and '_'", variant.Name)
+		}
+
+		if err := validateEvalSettings(&variant.RAGSettings); err != nil {
+			return fmt.Errorf("variant '%s': %s", variant.Name, err)
+		}
+
+		if names[variant.Name] {
+			return fmt.Errorf("duplicate variant name '%s'", variant.Name)
+		}
+		names[variant.Name] = true
+	}
+
+	return nil
+}
+
+// validateEvalSettings checks that the questions can be searched as in the chat, the sub-queries
+// are generated with the model of the chat request unless the rewrite settings name one
+func validateEvalSettings(settings *types.RAGSettings) error {
+	rewrite := settings.QueryRewrite
+	if rewrite.Enabled && rewrite.SubQueries > 0 && rewrite.Model == "" {
+		return fmt.Errorf("query rewrite model must be set to evaluate the sub-queries")
+	}
+	return nil
+}
+
+// evaluateVariant indexes the knowledge source with the variant settings, evaluates it and
+// deletes the index. The variant is indexed from a copy of the knowledge with the ID of the
+// eval job, so that its index, crawl checkpoint and progress are separate from the knowledge.
+func (r *Reconciler) evaluateVariant(ctx context.Context, k *types.Knowledge, jobID string, variant *types.KnowledgeEvalVariant, cases types.KnowledgeEvalSet, topK int) (*types.KnowledgeEvalResult, error) {
+	variantKnowledge := *k
+	variantKnowledge.ID = jobID
+	variantKnowledge.RAGSettings = variant.RAGSettings
+	// Without a version nothing is carried over from the current version,
+	// the whole source is fetched and indexed with the variant settings
+	variantKnowledge.Version = ""
+
+	version := "eval-" + variant.Name
+	dataEntityID := types.GetDataEntityID(jobID, version)
+	ragClient := r.getRagClient(&variantKnowledge)
+
+	defer func() {
+		err := ragClient.Delete(context.Background(), &types.DeleteIndexRequest{DataEntityID: dataEntityID})
+		if err != nil {
+			log.Warn().
+				Err(err).
+				Str("knowledge_id", k.ID).
+				Str("data_entity_id", dataEntityID).
+				Msg("failed to delete eval variant index")
+		}
+	}()
+
+	if err := r.indexEvalVariant(ctx, &variantKnowledge, version); err != nil {
+		return nil, err
+	}
+
+	variantKnowledge.Version = version
+
+	return r.evaluateIndex(ctx, &variantKnowledge, cases, topK)
+}
+
+func (r *Reconciler) indexEvalVariant(ctx context.Context, variantKnowledge *types.Knowledge, version string) error {
+	data, err := r.getIndexingData(ctx, variantKnowledge)
+
+	// The checkpoint is only used by the crawls of the variant
+	if crawlerEnabled(variantKnowledge) {
+		if err := r.newCrawlCheckpointer(variantKnowledge).Delete(ctx); err != nil {
+			log.Warn().Err(err).Str("job_id", variantKnowledge.ID).Msg("failed to delete crawl checkpoint")
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to get indexing data, error: %w", err)
+	}
+
+	if err := checkContents(data); err != nil {
+		return err
+	}
+
+	markExcludedData(variantKnowledge, data)
+	data = getIndexedData(data)
+
+	startedAt := time.Now()
+
+	if variantKnowledge.RAGSettings.DisableChunking {
+		return r.indexDataDirectly(ctx, variantKnowledge, version, data, startedAt)
+	}
+	return r.indexDataWithChunking(ctx, variantKnowledge, version, data, startedAt)
+}
+
+// evaluateIndex runs the cases against the version of the knowledge, the top k chunks
+// of each question are grouped into the documents they come from
+func (r *Reconciler) evaluateIndex(ctx context.Context, k *types.Knowledge, cases types.KnowledgeEvalSet, topK int) (*types.KnowledgeEvalResult, error) {
+	result := &types.KnowledgeEvalResult{}
+
+	// The chat keeps the results_count best chunks
+	evaluated := *k
+	evaluated.RAGSettings.ResultsCount = topK
+
+	for _, c := range cases {
+		retrieved, err := r.searcher.SearchKnowledge(ctx, &evaluated, c.Question)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query '%s', error: %w", c.Question, err)
+		}
+
+		caseResult := evaluateCase(c, retrieved, topK)
+		result.Cases = append(result.Cases, caseResult)
+
+		result.RecallAtK += caseResult.Recall
+		result.MRR += caseResult.ReciprocalRank
+		if caseResult.ReciprocalRank > 0 {
+			result.HitRate++
+		}
+	}
+
+	count := float64(len(cases))
+	result.RecallAtK /= count
+	result.MRR /= count
+	result.HitRate /= count
+
+	return result, nil
+}
+
+// evaluateCase scores the retrieved chunks of a question, the documents are ranked by
+// their best chunk among the top k chunks
+func evaluateCase(c *types.KnowledgeEvalCase, retrieved []*types.SessionRAGResult, topK int) *types.KnowledgeEvalCaseResult {
+	result := &types.KnowledgeEvalCaseResult{
+		Question:  c.Question,
+		Retrieved: []string{},
+	}
+
+	seen := make(map[string]bool)
+	for _, chunk := range retrieved[:min(len(retrieved), topK)] {
+		source := chunk.Source
+		if source == "" {
+			source = chunk.Filename
+		}
+
+		if !seen[source] {
+			seen[source] = true
+			result.Retrieved = append(result.Retrieved, source)
+		}
+	}
+
+	found := 0
+	for _, expected := range c.ExpectedSources {
+		for _, source := range result.Retrieved {
+			if matchEvalSource(source, expected) {
+				found++
+				break
+			}
+		}
+	}
+	result.Recall = float64(found) / float64(len(c.ExpectedSources))
+
+	for rank, source := range result.Retrieved {
+		for _, expected := range c.ExpectedSources {
+			if matchEvalSource(source, expected) {
+				result.ReciprocalRank = 1 / float64(rank+1)
+				return result
+			}
+		}
+	}
+
+	return result
+}
+
+// matchEvalSource matches the full source or its trailing path segments, so that
+// the golden set doesn't depend on the filestore prefix or the URL host
+func matchEvalSource(source, expected string) bool {
+	expected = strings.TrimPrefix(expected, "/")
+	if expected == "" {
+		return false
+	}
+	return source == expected || strings.HasSuffix(source, "/"+expected)
+}
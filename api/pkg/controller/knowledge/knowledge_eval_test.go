@@ -0,0 +1,275 @@
+package knowledge
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+
+	"github.com/helixml/helix/api/pkg/rag"
+	"github.com/helixml/helix/api/pkg/store"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+// ragSearcher queries the RAG client directly, the query rewrite and the
+// reranking are covered by the controller tests
+type ragSearcher struct {
+	rag rag.RAG
+}
+
+func (s *ragSearcher) SearchKnowledge(ctx context.Context, k *types.Knowledge, question string) ([]*types.SessionRAGResult, error) {
+	return s.rag.Query(ctx, &types.SessionRAGQuery{
+		Prompt:       question,
+		DataEntityID: k.GetDataEntityID(),
+		MaxResults:   k.RAGSettings.ResultsCount,
+	})
+}
+
+func Test_evaluateCase(t *testing.T) {
+	c := &types.KnowledgeEvalCase{
+		Question:        "How do I install it?",
+		ExpectedSources: []string{"docs/install.md", "docs/linux.md"},
+	}
+
+	retrieved := []*types.SessionRAGResult{
+		{Source: "users/u1/apps/a1/docs/readme.md"},
+		{Source: "users/u1/apps/a1/docs/install.md"},
+		{Source: "users/u1/apps/a1/docs/install.md"},
+		{Source: "users/u1/apps/a1/docs/reinstall.md"},
+		{Source: "users/u1/apps/a1/docs/linux.md"},
+	}
+
+	result := evaluateCase(c, retrieved, 4)
+	assert.Equal(t, []string{
+		"users/u1/apps/a1/docs/readme.md",
+		"users/u1/apps/a1/docs/install.md",
+		"users/u1/apps/a1/docs/reinstall.md",
+	}, result.Retrieved)
+	assert.Equal(t, 0.5, result.Recall)
+	assert.Equal(t, 0.5, result.ReciprocalRank)
+
+	result = evaluateCase(c, retrieved, 5)
+	assert.Equal(t, 1.0, result.Recall)
+
+	result = evaluateCase(c, retrieved[:1], 5)
+	assert.Equal(t, 0.0, result.Recall)
+	assert.Equal(t, 0.0, result.ReciprocalRank)
+}
+
+func (suite *IndexerSuite) TestEvaluate_Versions() {
+	k := &types.Knowledge{
+		ID:      "knowledge_id",
+		Version: "v2",
+		EvalSet: types.KnowledgeEvalSet{
+			{Question: "pricing", ExpectedSources: []string{"https://example.com/pricing"}},
+			{Question: "install", ExpectedSources: []string{"https://example.com/install"}},
+		},
+	}
+
+	suite.store.EXPECT().ListKnowledgeVersions(gomock.Any(), &store.ListKnowledgeVersionQuery{
+		KnowledgeID: "knowledge_id",
+		State:       types.KnowledgeStateReady,
+	}).Return([]*types.KnowledgeVersion{{Version: "v1"}, {Version: "v2"}}, nil)
+
+	suite.rag.EXPECT().Query(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ interface{}, q *types.SessionRAGQuery) ([]*types.SessionRAGResult, error) {
+			suite.Equal(3, q.MaxResults)
+
+			switch {
+			case q.DataEntityID == "knowledge_id-v1":
+				// Only finds the pricing page, second
+				if q.Prompt == "pricing" {
+					return []*types.SessionRAGResult{
+						{Source: "https://example.com/"},
+						{Source: "https://example.com/pricing"},
+					}, nil
+				}
+				return nil, nil
+			default:
+				return []*types.SessionRAGResult{{Source: "https://example.com/" + q.Prompt}}, nil
+			}
+		}).Times(4)
+
+	job, err := suite.reconciler.Evaluate(suite.ctx, k, &types.KnowledgeEvalRequest{
+		K:        3,
+		Versions: []string{"v1", "v2"},
+	})
+	suite.Require().NoError(err)
+
+	resp := suite.waitForEvalJob(job)
+	suite.Require().Len(resp.Results, 2)
+
+	suite.Equal("v1", resp.Results[0].Version)
+	suite.Equal(0.5, resp.Results[0].RecallAtK)
+	suite.Equal(0.25, resp.Results[0].MRR)
+	suite.Equal(0.5, resp.Results[0].HitRate)
+
+	suite.Equal("v2", resp.Results[1].Version)
+	suite.Equal(1.0, resp.Results[1].RecallAtK)
+	suite.Equal(1.0, resp.Results[1].MRR)
+	suite.Equal(1.0, resp.Results[1].HitRate)
+}
+
+func (suite *IndexerSuite) TestEvaluate_UnknownVersion() {
+	k := &types.Knowledge{
+		ID:      "knowledge_id",
+		Version: "v2",
+	}
+
+	suite.store.EXPECT().ListKnowledgeVersions(gomock.Any(), gomock.Any()).Return([]*types.KnowledgeVersion{{Version: "v2"}}, nil)
+
+	_, err := suite.reconciler.Evaluate(suite.ctx, k, &types.KnowledgeEvalRequest{
+		Cases:    types.KnowledgeEvalSet{{Question: "pricing", ExpectedSources: []string{"pricing"}}},
+		Versions: []string{"v1"},
+	})
+	suite.ErrorIs(err, ErrInvalidEvalRequest)
+}
+
+func (suite *IndexerSuite) TestEvaluate_QueryRewriteWithoutModel() {
+	k := &types.Knowledge{
+		ID:      "knowledge_id",
+		Version: "v1",
+		EvalSet: types.KnowledgeEvalSet{{Question: "pricing", ExpectedSources: []string{"pricing"}}},
+	}
+
+	_, err := suite.reconciler.Evaluate(suite.ctx, k, &types.KnowledgeEvalRequest{
+		Variants: []*types.KnowledgeEvalVariant{
+			{
+				Name: "rewrite",
+				RAGSettings: types.RAGSettings{
+					QueryRewrite: types.RAGQueryRewriteSettings{Enabled: true, SubQueries: 2},
+				},
+			},
+		},
+	})
+	suite.ErrorIs(err, ErrInvalidEvalRequest)
+}
+
+func (suite *IndexerSuite) TestEvaluate_TooManyJobs() {
+	running := func(knowledgeID string) *types.KnowledgeEvalJob {
+		return &types.KnowledgeEvalJob{
+			ID:          "job_" + knowledgeID,
+			KnowledgeID: knowledgeID,
+			Owner:       "user_id",
+			State:       types.KnowledgeEvalJobStateRunning,
+		}
+	}
+
+	suite.Require().NoError(suite.reconciler.addEvalJob(running("knowledge_1")))
+
+	// One job at a time for the knowledge
+	err := suite.reconciler.addEvalJob(&types.KnowledgeEvalJob{ID: "job", KnowledgeID: "knowledge_1", Owner: "user_id"})
+	suite.ErrorIs(err, ErrTooManyEvalJobs)
+
+	suite.Require().NoError(suite.reconciler.addEvalJob(running("knowledge_2")))
+	suite.Require().NoError(suite.reconciler.addEvalJob(running("knowledge_3")))
+
+	// And a few for the owner
+	err = suite.reconciler.addEvalJob(&types.KnowledgeEvalJob{ID: "job", KnowledgeID: "knowledge_4", Owner: "user_id"})
+	suite.ErrorIs(err, ErrTooManyEvalJobs)
+
+	suite.NoError(suite.reconciler.addEvalJob(&types.KnowledgeEvalJob{ID: "job", KnowledgeID: "knowledge_4", Owner: "other_user_id"}))
+
+	// Finished jobs don't count
+	suite.reconciler.finishEvalJob("job_knowledge_1", &types.KnowledgeEvalResponse{}, nil)
+	suite.NoError(suite.reconciler.addEvalJob(running("knowledge_1")))
+}
+
+func (suite *IndexerSuite) TestEvaluate_Variant() {
+	k := &types.Knowledge{
+		ID:      "knowledge_id",
+		Version: "v1",
+		State:   types.KnowledgeStateReady,
+		Source: types.KnowledgeSource{
+			Web: &types.KnowledgeSourceWeb{
+				URLs: []string{"https://example.com/pricing"},
+			},
+		},
+		EvalSet: types.KnowledgeEvalSet{
+			{Question: "pricing", ExpectedSources: []string{"https://example.com/pricing"}},
+		},
+	}
+
+	var dataEntityID string
+
+	suite.extractor.EXPECT().Extract(gomock.Any(), gomock.Any()).Return("pricing page", nil)
+
+	// The variant is indexed from a copy with the ID of the job, the
+	// knowledge itself is not changed
+	suite.rag.EXPECT().Index(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ interface{}, chunks ...*types.SessionRAGIndexChunk) error {
+			dataEntityID = chunks[0].DataEntityID
+			return nil
+		})
+
+	suite.rag.EXPECT().Query(gomock.Any(), gomock.Any()).Return([]*types.SessionRAGResult{
+		{Source: "https://example.com/pricing"},
+	}, nil)
+
+	suite.rag.EXPECT().Delete(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ interface{}, req *types.DeleteIndexRequest) error {
+			suite.Equal(dataEntityID, req.DataEntityID)
+			return nil
+		})
+
+	job, err := suite.reconciler.Evaluate(suite.ctx, k, &types.KnowledgeEvalRequest{
+		Variants: []*types.KnowledgeEvalVariant{
+			{Name: "small", RAGSettings: types.RAGSettings{ChunkSize: 256}},
+		},
+	})
+	suite.Require().NoError(err)
+	suite.Equal(types.KnowledgeEvalJobStateRunning, job.State)
+
+	resp := suite.waitForEvalJob(job)
+	suite.Require().Len(resp.Results, 1)
+	suite.Equal("small", resp.Results[0].Variant)
+	suite.Equal(1.0, resp.Results[0].HitRate)
+
+	suite.Equal(job.ID+"-eval-small", dataEntityID)
+	suite.Equal(types.KnowledgeStateReady, k.State)
+}
+
+func (suite *IndexerSuite) TestEvaluate_VariantFailed() {
+	k := &types.Knowledge{
+		ID:      "knowledge_id",
+		Version: "v1",
+		Source: types.KnowledgeSource{
+			Web: &types.KnowledgeSourceWeb{
+				URLs: []string{"https://example.com/pricing"},
+			},
+		},
+		EvalSet: types.KnowledgeEvalSet{
+			{Question: "pricing", ExpectedSources: []string{"https://example.com/pricing"}},
+		},
+	}
+
+	suite.extractor.EXPECT().Extract(gomock.Any(), gomock.Any()).Return("", errors.New("unavailable"))
+	suite.rag.EXPECT().Delete(gomock.Any(), gomock.Any()).Return(nil)
+
+	job, err := suite.reconciler.Evaluate(suite.ctx, k, &types.KnowledgeEvalRequest{
+		Variants: []*types.KnowledgeEvalVariant{{Name: "small"}},
+	})
+	suite.Require().NoError(err)
+
+	suite.reconciler.wg.Wait()
+
+	job, err = suite.reconciler.GetEvalJob("knowledge_id", job.ID)
+	suite.Require().NoError(err)
+	suite.Equal(types.KnowledgeEvalJobStateError, job.State)
+	suite.Contains(job.Error, "failed to evaluate variant 'small'")
+
+	_, err = suite.reconciler.GetEvalJob("other_knowledge_id", job.ID)
+	suite.ErrorIs(err, ErrEvalJobNotFound)
+}
+
+func (suite *IndexerSuite) waitForEvalJob(job *types.KnowledgeEvalJob) *types.KnowledgeEvalResponse {
+	suite.reconciler.wg.Wait()
+
+	job, err := suite.reconciler.GetEvalJob(job.KnowledgeID, job.ID)
+	suite.Require().NoError(err)
+	suite.Require().Equal(types.KnowledgeEvalJobStateComplete, job.State, job.Error)
+
+	return job.Result
+}
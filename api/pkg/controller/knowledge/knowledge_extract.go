@@ -2,14 +2,18 @@ package knowledge
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/helixml/helix/api/pkg/extract"
 	"github.com/helixml/helix/api/pkg/filestore"
+	"github.com/helixml/helix/api/pkg/rag"
 	"github.com/helixml/helix/api/pkg/types"
 	"github.com/rs/zerolog/log"
 )
@@ -22,6 +26,12 @@ func (r *Reconciler) getIndexingData(ctx context.Context, k *types.Knowledge) ([
 		return r.extractDataFromWeb(ctx, k)
 	case k.Source.Filestore != nil:
 		return r.extractDataFromHelixFilestore(ctx, k)
+	case k.Source.S3 != nil:
+		return r.extractDataFromS3(ctx, k)
+	case k.Source.GCS != nil:
+		return r.extractDataFromGCS(ctx, k)
+	case k.Source.Git != nil:
+		return r.extractDataFromGit(ctx, k)
 	default:
 		return nil, fmt.Errorf("unknown source: %+v", k.Source)
 	}
@@ -32,6 +42,11 @@ func (r *Reconciler) extractDataFromWeb(ctx context.Context, k *types.Knowledge)
 		return nil, fmt.Errorf("no web source defined")
 	}
 
+	k, err := r.evalWebAuth(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+
 	if crawlerEnabled(k) {
 		return r.extractDataFromWebWithCrawler(ctx, k)
 	}
@@ -94,6 +109,99 @@ func (r *Reconciler) extractDataFromWeb(ctx context.Context, k *types.Knowledge)
 	return result, nil
 }
 
+// evalWebAuth returns a copy of the knowledge with the secret references in the web
+// authentication resolved. The login steps can also reference ${username} and ${password}.
+func (r *Reconciler) evalWebAuth(ctx context.Context, k *types.Knowledge) (*types.Knowledge, error) {
+	auth := k.Source.Web.Auth
+
+	if !hasSecretReferences(&auth) {
+		return k, nil
+	}
+
+	secrets, err := r.getSecrets(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, field := range []*string{&auth.Username, &auth.Password} {
+		*field, err = evalSecrets(*field, secrets)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	headers := make(map[string]string, len(auth.Headers))
+	for name, value := range auth.Headers {
+		headers[name], err = evalSecrets(value, secrets)
+		if err != nil {
+			return nil, err
+		}
+	}
+	auth.Headers = headers
+
+	cookies := make([]*types.KnowledgeSourceWebCookie, 0, len(auth.Cookies))
+	for _, c := range auth.Cookies {
+		cookie := *c
+		cookie.Value, err = evalSecrets(c.Value, secrets)
+		if err != nil {
+			return nil, err
+		}
+		cookies = append(cookies, &cookie)
+	}
+	auth.Cookies = cookies
+
+	if auth.Login != nil {
+		loginSecrets := make(map[string]string, len(secrets)+2)
+		for name, value := range secrets {
+			loginSecrets[name] = value
+		}
+		loginSecrets["username"] = auth.Username
+		loginSecrets["password"] = auth.Password
+
+		login := *auth.Login
+		login.Steps = make([]*types.KnowledgeSourceWebLoginStep, 0, len(auth.Login.Steps))
+		for _, step := range auth.Login.Steps {
+			evaluated := *step
+			evaluated.Value, err = evalSecrets(step.Value, loginSecrets)
+			if err != nil {
+				return nil, err
+			}
+			login.Steps = append(login.Steps, &evaluated)
+		}
+		auth.Login = &login
+	}
+
+	web := *k.Source.Web
+	web.Auth = auth
+
+	evaluated := *k
+	evaluated.Source.Web = &web
+
+	return &evaluated, nil
+}
+
+func hasSecretReferences(auth *types.KnowledgeSourceWebAuth) bool {
+	values := []string{auth.Username, auth.Password}
+	for _, value := range auth.Headers {
+		values = append(values, value)
+	}
+	for _, c := range auth.Cookies {
+		values = append(values, c.Value)
+	}
+	if auth.Login != nil {
+		for _, step := range auth.Login.Steps {
+			values = append(values, step.Value)
+		}
+	}
+
+	for _, value := range values {
+		if strings.Contains(value, "$") {
+			return true
+		}
+	}
+	return false
+}
+
 func crawlerEnabled(k *types.Knowledge) bool {
 	if k.Source.Web == nil {
 		return false
@@ -119,7 +227,12 @@ func (r *Reconciler) extractDataFromWebWithCrawler(ctx context.Context, k *types
 		return nil, fmt.Errorf("no crawler defined")
 	}
 
-	crawler, err := r.newCrawler(k)
+	previous, err := r.getPreviousCrawl(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+
+	crawler, err := r.newCrawler(k, previous, r.newCrawlCheckpointer(k))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create crawler: %w", err)
 	}
@@ -132,19 +245,88 @@ func (r *Reconciler) extractDataFromWebWithCrawler(ctx context.Context, k *types
 	data := make([]*indexerData, 0, len(result))
 
 	for _, doc := range result {
-		data = append(data, &indexerData{
+		d := &indexerData{
 			Data:            []byte(doc.Content),
 			Source:          doc.SourceURL,
 			DocumentGroupID: getDocumentGroupID(doc.SourceURL),
 			StatusCode:      doc.StatusCode,
 			DurationMs:      doc.DurationMs,
 			Message:         doc.Message,
-		})
+			LastModified:    doc.LastModified,
+			Unchanged:       doc.Unchanged,
+		}
+
+		// The page wasn't fetched, keep the previous hash so the next
+		// refresh can still compare the contents
+		if doc.Unchanged && previous != nil {
+			for _, u := range previous.URLs {
+				if u.URL == doc.SourceURL {
+					d.DocumentID = u.DocumentID
+					d.StatusCode = u.StatusCode
+					d.Fingerprint = u.Fingerprint
+					break
+				}
+			}
+		}
+
+		data = append(data, d)
+	}
+
+	if !k.Source.Web.Crawler.KeepDuplicates {
+		duplicates := markDuplicates(data, getDuplicateSimilarity(k.Source.Web.Crawler))
+		if duplicates > 0 {
+			log.Info().
+				Str("knowledge_id", k.ID).
+				Int("duplicates", duplicates).
+				Msg("skipping near duplicate pages")
+		}
 	}
 
 	return data, nil
 }
 
+// getPreviousCrawl returns the pages of the current version if its chunks can be carried
+// over into the new version, the crawler then skips the pages that didn't change since.
+// If the RAG backend fails to copy them, the skipped pages are fetched again when indexing.
+func (r *Reconciler) getPreviousCrawl(ctx context.Context, k *types.Knowledge) (*types.CrawledSources, error) {
+	previous, err := r.getCurrentVersion(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+
+	if previous == nil || previous.CrawledSources == nil {
+		return nil, nil
+	}
+
+	// Everything is re-indexed with the new settings
+	if previous.CrawledSources.RAGSettingsHash != getRAGSettingsHash(k) {
+		return nil, nil
+	}
+
+	return previous.CrawledSources, nil
+}
+
+// fetchWebPage downloads a single page of the web source, the same way pages are
+// fetched when the crawler is disabled. The web auth must already be evaluated.
+func (r *Reconciler) fetchWebPage(ctx context.Context, k *types.Knowledge, u string) ([]byte, error) {
+	if k.RAGSettings.DisableChunking {
+		bts, err := r.downloadDirectly(ctx, k, u)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download data from %s, error: %w", u, err)
+		}
+		return bts, nil
+	}
+
+	extracted, err := r.extractor.Extract(ctx, &extract.Request{
+		URL: u,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract data from %s, error: %w", u, err)
+	}
+
+	return []byte(extracted), nil
+}
+
 func (r *Reconciler) downloadDirectly(ctx context.Context, k *types.Knowledge, u string) ([]byte, error) {
 	// Extractor and indexer disabled, downloading directly
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
@@ -157,6 +339,10 @@ func (r *Reconciler) downloadDirectly(ctx context.Context, k *types.Knowledge, u
 		req.SetBasicAuth(k.Source.Web.Auth.Username, k.Source.Web.Auth.Password)
 	}
 
+	for name, value := range k.Source.Web.Auth.Headers {
+		req.Header.Set(name, value)
+	}
+
 	resp, err := r.httpClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to download, error: %w", err)
@@ -172,7 +358,11 @@ func (r *Reconciler) downloadDirectly(ctx context.Context, k *types.Knowledge, u
 }
 
 func (r *Reconciler) extractDataFromHelixFilestore(ctx context.Context, k *types.Knowledge) ([]*indexerData, error) {
-	data, err := r.getFilestoreFiles(ctx, r.filestore, k)
+	userPrefix := filestore.GetUserPrefix(r.config.Controller.FilePrefixGlobal, k.Owner)
+
+	path := filepath.Join(userPrefix, k.Source.Filestore.Path)
+
+	data, err := r.getFilestoreFiles(ctx, r.filestore, path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get filestore files: %w", err)
 	}
@@ -181,6 +371,12 @@ func (r *Reconciler) extractDataFromHelixFilestore(ctx context.Context, k *types
 		return nil, ErrNoFilesFound
 	}
 
+	logDataFound(k, data, "filestore data found")
+
+	return r.extractFiles(ctx, k, data)
+}
+
+func logDataFound(k *types.Knowledge, data []*indexerData, msg string) {
 	var totalSize int64
 
 	for _, d := range data {
@@ -191,7 +387,12 @@ func (r *Reconciler) extractDataFromHelixFilestore(ctx context.Context, k *types
 		Str("knowledge_id", k.ID).
 		Int64("total_size", totalSize).
 		Int64("count", int64(len(data))).
-		Msg("filestore data found")
+		Msg(msg)
+}
+
+// extractFiles runs the raw file contents through the text extractor
+func (r *Reconciler) extractFiles(ctx context.Context, k *types.Knowledge, data []*indexerData) ([]*indexerData, error) {
+	data = applySidecarMetadata(k, data)
 
 	// Optional mode to disable text extractor and chunking,
 	// useful when the indexing server will know how to handle
@@ -201,27 +402,118 @@ func (r *Reconciler) extractDataFromHelixFilestore(ctx context.Context, k *types
 	}
 
 	// Chunking enabled, extracting text
-	var extractedData []*indexerData
+	var (
+		extractedData []*indexerData
+		stats         types.ExtractionCacheStats
+		startedAt     = time.Now()
+	)
 
-	for _, d := range data {
-		extractedText, err := r.extractor.Extract(ctx, &extract.Request{
-			Content: d.Data,
-		})
+	for idx, d := range data {
+		r.updateExtractionProgress(k, startedAt, idx, len(data), &stats)
+
+		extractedText, err := r.extractFile(ctx, &stats, d.Data, d.Source)
 		if err != nil {
-			return nil, fmt.Errorf("failed to extract data from %s, error: %w", d.Source, err)
+			return nil, err
 		}
 
 		extractedData = append(extractedData, &indexerData{
 			Data:            []byte(extractedText),
 			Source:          d.Source,
 			DocumentGroupID: getDocumentGroupID(d.Source),
+			Metadata:        d.Metadata,
 		})
 	}
 
+	r.updateExtractionProgress(k, startedAt, len(data), len(data), &stats)
+	logExtractionCacheStats(k, &stats)
+
 	return extractedData, nil
 }
 
-func (r *Reconciler) getFilestoreFiles(ctx context.Context, fs filestore.FileStore, k *types.Knowledge) ([]*indexerData, error) {
+// metadataSidecarSuffix is the suffix of the files holding the custom metadata
+// of a document, for example "report.pdf.metadata.json" for "report.pdf"
+const metadataSidecarSuffix = ".metadata.json"
+
+// applySidecarMetadata attaches the key/values from the sidecar files to their documents,
+// the sidecar files themselves are not indexed
+func applySidecarMetadata(k *types.Knowledge, data []*indexerData) []*indexerData {
+	sidecars := make(map[string]*indexerData)
+	for _, d := range data {
+		if strings.HasSuffix(d.Source, metadataSidecarSuffix) {
+			sidecars[strings.TrimSuffix(d.Source, metadataSidecarSuffix)] = d
+		}
+	}
+
+	if len(sidecars) == 0 {
+		return data
+	}
+
+	documents := make([]*indexerData, 0, len(data)-len(sidecars))
+
+	for _, d := range data {
+		if strings.HasSuffix(d.Source, metadataSidecarSuffix) {
+			continue
+		}
+
+		sidecar, ok := sidecars[d.Source]
+		if ok {
+			metadata, err := parseSidecarMetadata(sidecar.Data)
+			if err != nil {
+				log.Warn().
+					Err(err).
+					Str("knowledge_id", k.ID).
+					Str("source", sidecar.Source).
+					Msg("failed to parse metadata file, ignoring")
+			} else {
+				d.Metadata = metadata
+			}
+
+			// The chunks have to be re-indexed with the new metadata
+			if !sidecar.Unchanged {
+				d.Unchanged = false
+			}
+		}
+
+		documents = append(documents, d)
+	}
+
+	return documents
+}
+
+// parseSidecarMetadata reads a flat JSON object, non-string values are
+// converted to their JSON representation
+func parseSidecarMetadata(bts []byte) (map[string]string, error) {
+	var raw map[string]any
+	err := json.Unmarshal(bts, &raw)
+	if err != nil {
+		return nil, fmt.Errorf("metadata must be a JSON object: %w", err)
+	}
+
+	metadata := make(map[string]string, len(raw))
+
+	for key, value := range raw {
+		if !rag.ValidMetadataKey(key) {
+			return nil, fmt.Errorf("invalid metadata key %q", key)
+		}
+
+		switch v := value.(type) {
+		case string:
+			metadata[key] = v
+		case nil:
+			continue
+		default:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return nil, err
+			}
+			metadata[key] = string(encoded)
+		}
+	}
+
+	return metadata, nil
+}
+
+func (r *Reconciler) getFilestoreFiles(ctx context.Context, fs filestore.FileStore, path string) ([]*indexerData, error) {
 	var result []*indexerData
 
 	var recursiveList func(path string) error
@@ -245,6 +537,7 @@ func (r *Reconciler) getFilestoreFiles(ctx context.Context, fs filestore.FileSto
 				}
 
 				bts, err := io.ReadAll(r)
+				r.Close()
 				if err != nil {
 					return fmt.Errorf("failed to read file at %s, error: %w", item.Path, err)
 				}
@@ -259,10 +552,6 @@ func (r *Reconciler) getFilestoreFiles(ctx context.Context, fs filestore.FileSto
 		return nil
 	}
 
-	userPrefix := filestore.GetUserPrefix(r.config.Controller.FilePrefixGlobal, k.Owner)
-
-	path := filepath.Join(userPrefix, k.Source.Filestore.Path)
-
 	err := recursiveList(path)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,238 @@
+package knowledge
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/helixml/helix/api/pkg/extract"
+	"github.com/helixml/helix/api/pkg/filestore"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+const (
+	// How often the extraction cache is trimmed to its size limit
+	extractionCacheEvictionInterval = time.Hour
+)
+
+// extractionCache keeps the extracted texts in the filestore, keyed by the SHA-256 of
+// the file contents and extension and the extractor identity. Files that didn't change since the
+// last refresh are then not sent to the extractor again.
+type extractionCache struct {
+	fs filestore.FileStore
+	// root holds the directories of all the extractor identities
+	root string
+	// path is the directory of the current extractor, a different
+	// extractor or configuration uses another directory
+	path string
+	// maxSize in bytes, zero means no limit
+	maxSize int64
+}
+
+func newExtractionCache(fs filestore.FileStore, prefix string, extractor extract.Extractor, maxSize int64) *extractionCache {
+	identity := sha256.Sum256([]byte(extract.Identity(extractor)))
+	root := filepath.Join(prefix, "extraction-cache")
+
+	return &extractionCache{
+		fs:      fs,
+		root:    root,
+		path:    filepath.Join(root, hex.EncodeToString(identity[:])[:16]),
+		maxSize: maxSize,
+	}
+}
+
+// filePath includes the extension of the file name, the extractors use it to
+// tell the text formats apart (markdown, CSV, HTML)
+func (c *extractionCache) filePath(content []byte, filename string) string {
+	h := sha256.New()
+	h.Write([]byte(getFileExtension(filename)))
+	h.Write([]byte{0})
+	h.Write(content)
+	key := hex.EncodeToString(h.Sum(nil))
+
+	// Spread the files across the directories
+	return filepath.Join(c.path, key[:2], key+".txt")
+}
+
+// get returns false if the text is not cached, failing reads are treated as misses
+func (c *extractionCache) get(ctx context.Context, content []byte, filename string) (string, bool) {
+	path := c.filePath(content, filename)
+
+	bts, err := filestore.ReadFile(ctx, c.fs, path)
+	if err != nil {
+		if !filestore.IsNotExist(err) {
+			log.Warn().Err(err).Str("path", path).Msg("failed to read cached extraction")
+		}
+		return "", false
+	}
+
+	return string(bts), true
+}
+
+func (c *extractionCache) set(ctx context.Context, content []byte, filename, text string) {
+	path := c.filePath(content, filename)
+
+	_, err := c.fs.WriteFile(ctx, path, strings.NewReader(text))
+	if err != nil {
+		log.Warn().Err(err).Str("path", path).Msg("failed to cache extraction")
+	}
+}
+
+// evict deletes the directories of the other extractors, they are never read again, and the
+// oldest entries until the cache is within its size limit. Returns the number of deleted entries.
+func (c *extractionCache) evict(ctx context.Context) (int, error) {
+	identities, err := c.fs.List(ctx, c.root)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list extraction cache: %w", err)
+	}
+
+	for _, identity := range identities {
+		if identity.Directory && identity.Path != c.path {
+			if err := c.fs.Delete(ctx, identity.Path+"/"); err != nil {
+				return 0, fmt.Errorf("failed to delete extraction cache %s: %w", identity.Path, err)
+			}
+		}
+	}
+
+	if c.maxSize <= 0 {
+		return 0, nil
+	}
+
+	shards, err := c.fs.List(ctx, c.path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list extraction cache: %w", err)
+	}
+
+	var (
+		entries []filestore.Item
+		size    int64
+	)
+
+	for _, shard := range shards {
+		if !shard.Directory {
+			continue
+		}
+
+		items, err := c.fs.List(ctx, shard.Path)
+		if err != nil {
+			return 0, fmt.Errorf("failed to list extraction cache: %w", err)
+		}
+
+		for _, item := range items {
+			if !item.Directory {
+				entries = append(entries, item)
+				size += item.Size
+			}
+		}
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Created < entries[j].Created
+	})
+
+	deleted := 0
+	for _, entry := range entries {
+		if size <= c.maxSize {
+			break
+		}
+
+		if err := c.fs.Delete(ctx, entry.Path); err != nil && !filestore.IsNotExist(err) {
+			return deleted, fmt.Errorf("failed to delete cached extraction %s: %w", entry.Path, err)
+		}
+
+		size -= entry.Size
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// runExtractionCacheEviction trims the extraction cache periodically
+func (r *Reconciler) runExtractionCacheEviction(ctx context.Context) {
+	if r.extractionCache == nil {
+		return
+	}
+
+	for {
+		deleted, err := r.extractionCache.evict(ctx)
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to evict extraction cache entries")
+		} else if deleted > 0 {
+			log.Info().Int("deleted", deleted).Msg("evicted extraction cache entries")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(extractionCacheEvictionInterval):
+		}
+	}
+}
+
+// getFileExtension returns the lower case extension, query strings of URLs are ignored
+func getFileExtension(filename string) string {
+	return strings.ToLower(path.Ext(strings.SplitN(filename, "?", 2)[0]))
+}
+
+// extractFile runs the file through the text extractor unless its text is already cached
+func (r *Reconciler) extractFile(ctx context.Context, stats *types.ExtractionCacheStats, content []byte, filename string) (string, error) {
+	if r.extractionCache != nil {
+		if text, ok := r.extractionCache.get(ctx, content, filename); ok {
+			stats.Hits++
+			return text, nil
+		}
+	}
+
+	text, err := r.extractor.Extract(ctx, &extract.Request{
+		Content:  content,
+		Filename: filename,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to extract data from %s, error: %w", filename, err)
+	}
+
+	if r.extractionCache != nil {
+		stats.Misses++
+		r.extractionCache.set(ctx, content, filename, text)
+	}
+
+	return text, nil
+}
+
+// updateExtractionProgress reports the extracted files, the cache hits and misses
+// stay in the progress until the indexing finishes
+func (r *Reconciler) updateExtractionProgress(k *types.Knowledge, startedAt time.Time, extracted, total int, stats *types.ExtractionCacheStats) {
+	progress := types.KnowledgeProgress{
+		Step:           "Extracting",
+		ElapsedSeconds: int(time.Since(startedAt).Seconds()),
+		Message:        fmt.Sprintf("extracting data %d/%d", extracted, total),
+		StartedAt:      startedAt,
+	}
+
+	if total > 0 {
+		progress.Progress = int(float32(extracted) / float32(total) * 100)
+	}
+
+	if r.extractionCache != nil {
+		cached := *stats
+		progress.ExtractionCache = &cached
+	}
+
+	r.updateKnowledgeProgress(k.ID, progress)
+}
+
+func logExtractionCacheStats(k *types.Knowledge, stats *types.ExtractionCacheStats) {
+	log.Info().
+		Str("knowledge_id", k.ID).
+		Int("hits", stats.Hits).
+		Int("misses", stats.Misses).
+		Msg("extraction cache stats")
+}
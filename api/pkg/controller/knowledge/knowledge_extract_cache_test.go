@@ -0,0 +1,151 @@
+package knowledge
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/helixml/helix/api/pkg/config"
+	"github.com/helixml/helix/api/pkg/extract"
+	"github.com/helixml/helix/api/pkg/filestore"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+func Test_extractFiles_Cache(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	extractor := extract.NewMockExtractor(ctrl)
+	fs := filestore.NewFileSystemStorage(t.TempDir(), "", "")
+
+	cfg := &config.ServerConfig{}
+	cfg.TextExtractor.CacheEnabled = true
+
+	r, err := New(cfg, nil, fs, extractor, nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	k := &types.Knowledge{ID: "knowledge_id"}
+
+	getData := func(report string) []*indexerData {
+		return []*indexerData{
+			{Source: "docs/report.pdf", Data: []byte(report)},
+			{Source: "docs/handbook.pdf", Data: []byte("%PDF handbook")},
+		}
+	}
+
+	// First refresh, everything is extracted
+	extractor.EXPECT().Extract(gomock.Any(), &extract.Request{
+		Content:  []byte("%PDF report v1"),
+		Filename: "docs/report.pdf",
+	}).Return("report v1", nil)
+	extractor.EXPECT().Extract(gomock.Any(), &extract.Request{
+		Content:  []byte("%PDF handbook"),
+		Filename: "docs/handbook.pdf",
+	}).Return("handbook", nil)
+
+	data, err := r.extractFiles(context.Background(), k, getData("%PDF report v1"))
+	require.NoError(t, err)
+	require.Equal(t, "report v1", string(data[0].Data))
+	require.Equal(t, "handbook", string(data[1].Data))
+	require.Equal(t, &types.ExtractionCacheStats{Hits: 0, Misses: 2}, r.GetStatus(k.ID).ExtractionCache)
+
+	// Second refresh, only the changed file is extracted
+	extractor.EXPECT().Extract(gomock.Any(), &extract.Request{
+		Content:  []byte("%PDF report v2"),
+		Filename: "docs/report.pdf",
+	}).Return("report v2", nil)
+
+	data, err = r.extractFiles(context.Background(), k, getData("%PDF report v2"))
+	require.NoError(t, err)
+	require.Equal(t, "report v2", string(data[0].Data))
+	require.Equal(t, "handbook", string(data[1].Data))
+	require.Equal(t, &types.ExtractionCacheStats{Hits: 1, Misses: 1}, r.GetStatus(k.ID).ExtractionCache)
+
+	// The stats are kept while indexing
+	r.updateKnowledgeProgress(k.ID, types.KnowledgeProgress{Step: "Indexing"})
+	require.Equal(t, &types.ExtractionCacheStats{Hits: 1, Misses: 1}, r.GetStatus(k.ID).ExtractionCache)
+}
+
+func Test_extractionCache_Identity(t *testing.T) {
+	fs := filestore.NewFileSystemStorage(t.TempDir(), "", "")
+
+	tika := newExtractionCache(fs, "", extract.NewTikaExtractor("http://tika:9998"), 0)
+	builtin := newExtractionCache(fs, "", extract.NewBuiltinExtractor(nil), 0)
+	builtinWithFallback := newExtractionCache(fs, "", extract.NewBuiltinExtractor(extract.NewTikaExtractor("http://tika:9998")), 0)
+
+	tika.set(context.Background(), []byte("content"), "notes.pdf", "tika text")
+
+	text, ok := tika.get(context.Background(), []byte("content"), "notes.pdf")
+	require.True(t, ok)
+	require.Equal(t, "tika text", text)
+
+	// Different extractors don't share the cached texts
+	_, ok = builtin.get(context.Background(), []byte("content"), "notes.pdf")
+	require.False(t, ok)
+	_, ok = builtinWithFallback.get(context.Background(), []byte("content"), "notes.pdf")
+	require.False(t, ok)
+
+	require.NotEqual(t, builtin.path, builtinWithFallback.path)
+}
+
+func Test_extractionCache_Extension(t *testing.T) {
+	ctx := context.Background()
+	fs := filestore.NewFileSystemStorage(t.TempDir(), "", "")
+	cache := newExtractionCache(fs, "", extract.NewBuiltinExtractor(nil), 0)
+
+	content := []byte("name,team\nalice,ops\n")
+	cache.set(ctx, content, "people.csv", "| name | team |")
+
+	// Same contents in a file that is extracted as plain text
+	_, ok := cache.get(ctx, content, "people.txt")
+	require.False(t, ok)
+
+	text, ok := cache.get(ctx, content, "archive/PEOPLE.CSV")
+	require.True(t, ok)
+	require.Equal(t, "| name | team |", text)
+}
+
+func Test_extractionCache_Evict(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fs := filestore.NewFileSystemStorage(dir, "", "")
+
+	// Room for two of the texts
+	cache := newExtractionCache(fs, "", extract.NewBuiltinExtractor(nil), 12)
+	tika := newExtractionCache(fs, "", extract.NewTikaExtractor("http://tika:9998"), 0)
+
+	tika.set(ctx, []byte("content"), "notes.pdf", "tika text")
+
+	for i, content := range []string{"oldest", "older", "newest"} {
+		cache.set(ctx, []byte(content), "notes.pdf", "text "+strconv.Itoa(i))
+
+		// Created is the modification time of the file
+		modTime := time.Now().Add(time.Duration(i-3) * time.Hour)
+		require.NoError(t, os.Chtimes(filepath.Join(dir, cache.filePath([]byte(content), "notes.pdf")), modTime, modTime))
+	}
+
+	deleted, err := cache.evict(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, deleted)
+
+	_, ok := cache.get(ctx, []byte("oldest"), "notes.pdf")
+	require.False(t, ok)
+
+	for _, content := range []string{"older", "newest"} {
+		_, ok := cache.get(ctx, []byte(content), "notes.pdf")
+		require.True(t, ok, content)
+	}
+
+	// The texts of the other extractors are never read again
+	_, ok = tika.get(ctx, []byte("content"), "notes.pdf")
+	require.False(t, ok)
+
+	// Within the limit
+	deleted, err = cache.evict(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 0, deleted)
+}
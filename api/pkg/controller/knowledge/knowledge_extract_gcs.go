@@ -0,0 +1,69 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/helixml/helix/api/pkg/filestore"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+func (r *Reconciler) extractDataFromGCS(ctx context.Context, k *types.Knowledge) ([]*indexerData, error) {
+	source, err := r.evalGCSSource(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+
+	gcs, err := r.newGCSStorage(ctx, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+
+	data, err := r.getFilestoreFiles(ctx, gcs, source.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get GCS files: %w", err)
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: gs://%s/%s", ErrNoFilesFound, source.Bucket, source.Path)
+	}
+
+	for _, d := range data {
+		d.Source = fmt.Sprintf("gs://%s/%s", source.Bucket, d.Source)
+		d.DocumentGroupID = getDocumentGroupID(d.Source)
+	}
+
+	logDataFound(k, data, "gcs data found")
+
+	return r.extractFiles(ctx, k, data)
+}
+
+// evalGCSSource returns a copy of the GCS source with the service
+// account key resolved from the secrets
+func (r *Reconciler) evalGCSSource(ctx context.Context, k *types.Knowledge) (*types.KnowledgeSourceGCS, error) {
+	if k.Source.GCS == nil {
+		return nil, fmt.Errorf("no gcs source defined")
+	}
+
+	secrets, err := r.getSecrets(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+
+	source := *k.Source.GCS
+
+	source.ServiceAccountKey, err = evalSecrets(source.ServiceAccountKey, secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	if source.ServiceAccountKey == "" && !r.config.RAG.AmbientCredentials {
+		return nil, fmt.Errorf("gcs service account key is required")
+	}
+
+	return &source, nil
+}
+
+func newGCSStorage(ctx context.Context, source *types.KnowledgeSourceGCS) (filestore.FileStore, error) {
+	return filestore.NewGCSStorageWithCredentials(ctx, source.Bucket, []byte(source.ServiceAccountKey))
+}
@@ -0,0 +1,431 @@
+package knowledge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/rs/zerolog/log"
+	crypto_ssh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+// ErrGitRepositoryTooLarge is returned when the cloned objects exceed RAG_GIT_MAX_SIZE_MB
+var ErrGitRepositoryTooLarge = errors.New("git repository is too large")
+
+// scpLikeGitURL matches the user@host:path form, for example git@github.com:helixml/helix.git
+var scpLikeGitURL = regexp.MustCompile(`^[A-Za-z0-9._-]+@[A-Za-z0-9][A-Za-z0-9.-]*:[^/]`)
+
+// extractDataFromGit clones the repository and reads the files that match the path
+// and extension filters. Files that were indexed in the current knowledge version and
+// didn't change since its commit are marked as unchanged so their chunks can be carried
+// forward instead of being re-indexed.
+func (r *Reconciler) extractDataFromGit(ctx context.Context, k *types.Knowledge) ([]*indexerData, error) {
+	return r.getGitFiles(ctx, k, "")
+}
+
+// getGitFiles reads the files of the repository, only the document and its metadata
+// sidecar file if the document is set
+func (r *Reconciler) getGitFiles(ctx context.Context, k *types.Knowledge, document string) ([]*indexerData, error) {
+	source, err := r.evalGitSource(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+
+	var previous *types.KnowledgeVersion
+
+	// A single document is always indexed
+	if document == "" {
+		previous, err = r.getCurrentVersion(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// The history is only needed to diff against the previously indexed commit
+	depth := 1
+	if previous != nil && previous.CrawledSources != nil && previous.CrawledSources.Commit != "" {
+		depth = 0
+	}
+
+	repo, err := r.cloneGitRepository(ctx, source, depth)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get HEAD of %s: %w", source.URL, err)
+	}
+
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit %s: %w", head.Hash(), err)
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree of commit %s: %w", head.Hash(), err)
+	}
+
+	var (
+		changed map[string]bool
+		indexed map[string]bool
+	)
+
+	if document == "" {
+		changed, err = getGitChangedFiles(ctx, k, repo, previous, tree)
+		if err != nil {
+			return nil, err
+		}
+
+		// Files that git didn't change but were not indexed before, for example
+		// after the filters changed, have no chunks to carry over
+		indexed = getIndexedSources(previous)
+	}
+
+	branch := source.Branch
+	if branch == "" {
+		branch = head.Name().Short()
+	}
+
+	var (
+		data      []*indexerData
+		stats     types.ExtractionCacheStats
+		startedAt = time.Now()
+	)
+
+	err = tree.Files().ForEach(func(f *object.File) error {
+		if !matchGitFilters(source, f.Name) {
+			return nil
+		}
+
+		fileURL := getGitFileURL(source.URL, branch, f.Name)
+
+		if document != "" && fileURL != document && fileURL != document+metadataSidecarSuffix {
+			return nil
+		}
+
+		binary, err := f.IsBinary()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", f.Name, err)
+		}
+
+		// Binary files such as PDFs are only indexed if their extension
+		// is explicitly listed in the filters
+		if binary && !hasGitExtensionFilter(source, f.Name) {
+			return nil
+		}
+
+		contents, err := f.Contents()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", f.Name, err)
+		}
+
+		if binary && !k.RAGSettings.DisableChunking {
+			contents, err = r.extractFile(ctx, &stats, []byte(contents), f.Name)
+			if err != nil {
+				return err
+			}
+		}
+
+		data = append(data, &indexerData{
+			Source:          fileURL,
+			DocumentGroupID: getDocumentGroupID(fileURL),
+			Data:            []byte(contents),
+			Commit:          commit.Hash.String(),
+			Unchanged:       changed != nil && !changed[f.Name] && indexed[fileURL],
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the binary files go through the extractor
+	if extracted := stats.Hits + stats.Misses; extracted > 0 {
+		r.updateExtractionProgress(k, startedAt, extracted, extracted, &stats)
+		logExtractionCacheStats(k, &stats)
+	}
+
+	data = applySidecarMetadata(k, data)
+
+	// The caller checks whether the document is still there
+	if document != "" {
+		return data, nil
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("no files found in %s matching the filters", source.URL)
+	}
+
+	logDataFound(k, data, "git data found")
+
+	return data, nil
+}
+
+// getGitChangedFiles returns the files that changed between the commit of the current
+// knowledge version and the tree. Nil map means that everything has to be indexed.
+func getGitChangedFiles(ctx context.Context, k *types.Knowledge, repo *git.Repository, previous *types.KnowledgeVersion, tree *object.Tree) (map[string]bool, error) {
+	if previous == nil || previous.CrawledSources == nil || previous.CrawledSources.Commit == "" {
+		return nil, nil
+	}
+
+	previousCommit, err := repo.CommitObject(plumbing.NewHash(previous.CrawledSources.Commit))
+	if err != nil {
+		// History was rewritten or the branch was changed, index everything
+		log.Warn().
+			Err(err).
+			Str("knowledge_id", k.ID).
+			Str("commit", previous.CrawledSources.Commit).
+			Msg("previously indexed commit not found, re-indexing all files")
+		return nil, nil
+	}
+
+	previousTree, err := previousCommit.Tree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree of commit %s: %w", previousCommit.Hash, err)
+	}
+
+	changes, err := object.DiffTreeWithOptions(ctx, previousTree, tree, object.DefaultDiffTreeOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff commit %s: %w", previousCommit.Hash, err)
+	}
+
+	changed := make(map[string]bool)
+
+	for _, change := range changes {
+		if change.From.Name != "" {
+			changed[change.From.Name] = true
+		}
+		if change.To.Name != "" {
+			changed[change.To.Name] = true
+		}
+	}
+
+	return changed, nil
+}
+
+// getIndexedSources returns the sources that have documents in the version
+func getIndexedSources(version *types.KnowledgeVersion) map[string]bool {
+	indexed := make(map[string]bool)
+	if version == nil || version.CrawledSources == nil {
+		return indexed
+	}
+
+	for _, u := range version.CrawledSources.URLs {
+		if u.DocumentID != "" {
+			indexed[u.URL] = true
+		}
+	}
+
+	return indexed
+}
+
+// evalGitSource returns a copy of the git source with the deploy key
+// resolved from the secrets
+func (r *Reconciler) evalGitSource(ctx context.Context, k *types.Knowledge) (*types.KnowledgeSourceGithub, error) {
+	if k.Source.Git == nil {
+		return nil, fmt.Errorf("no git source defined")
+	}
+
+	source := *k.Source.Git
+
+	if source.URL == "" {
+		source.URL = fmt.Sprintf("https://github.com/%s/%s.git", source.Owner, source.Repository)
+	}
+
+	if source.KeyPair == nil {
+		return &source, nil
+	}
+
+	secrets, err := r.getSecrets(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+
+	keyPair := *source.KeyPair
+
+	keyPair.PrivateKey, err = evalSecrets(keyPair.PrivateKey, secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	source.KeyPair = &keyPair
+
+	return &source, nil
+}
+
+// validateGitURL only allows the remote protocols, local paths and file:// URLs
+// would read the repositories on the Helix server
+func validateGitURL(u string) error {
+	if strings.HasPrefix(u, "https://") || strings.HasPrefix(u, "ssh://") || scpLikeGitURL.MatchString(u) {
+		return nil
+	}
+
+	return fmt.Errorf("git url must start with https:// or ssh://, or be in the user@host:path form")
+}
+
+// cloneGitSource clones the repository of a knowledge source with the limits of
+// the server configuration
+func (r *Reconciler) cloneGitSource(ctx context.Context, source *types.KnowledgeSourceGithub, depth int) (*git.Repository, error) {
+	if err := validateGitURL(source.URL); err != nil {
+		return nil, err
+	}
+
+	return cloneGitRepository(ctx, source, depth, int64(r.config.RAG.Git.MaxSizeMB)*1024*1024)
+}
+
+// cloneGitRepository clones the repository into memory, depth 0 fetches the whole
+// history and maxSize 0 doesn't limit the size of the objects
+func cloneGitRepository(ctx context.Context, source *types.KnowledgeSourceGithub, depth int, maxSize int64) (*git.Repository, error) {
+	opts := &git.CloneOptions{
+		URL:          source.URL,
+		SingleBranch: true,
+		Tags:         git.NoTags,
+		Depth:        depth,
+	}
+
+	if source.Branch != "" {
+		opts.ReferenceName = plumbing.NewBranchReferenceName(source.Branch)
+	}
+
+	if source.KeyPair != nil && source.KeyPair.PrivateKey != "" {
+		auth, err := getGitSSHAuth(source)
+		if err != nil {
+			return nil, err
+		}
+		opts.Auth = auth
+	}
+
+	storage := &limitedGitStorage{Storage: memory.NewStorage(), maxSize: maxSize}
+
+	// Only the objects are needed, no need to check out the files
+	repo, err := git.CloneContext(ctx, storage, nil, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clone %s: %w", source.URL, err)
+	}
+
+	return repo, nil
+}
+
+// limitedGitStorage stops the clone once the objects exceed the max size,
+// the repository is kept in memory
+type limitedGitStorage struct {
+	*memory.Storage
+	size    int64
+	maxSize int64
+}
+
+func (s *limitedGitStorage) SetEncodedObject(obj plumbing.EncodedObject) (plumbing.Hash, error) {
+	s.size += obj.Size()
+	if s.maxSize > 0 && s.size > s.maxSize {
+		return plumbing.ZeroHash, fmt.Errorf("%w, the limit is %d MB", ErrGitRepositoryTooLarge, s.maxSize/1024/1024)
+	}
+
+	return s.Storage.SetEncodedObject(obj)
+}
+
+func getGitSSHAuth(source *types.KnowledgeSourceGithub) (*ssh.PublicKeys, error) {
+	auth, err := ssh.NewPublicKeys("git", []byte(source.KeyPair.PrivateKey), "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse deploy key: %w", err)
+	}
+
+	switch {
+	case source.InsecureSkipHostKeyCheck:
+		auth.HostKeyCallback = crypto_ssh.InsecureIgnoreHostKey()
+	case source.KnownHosts != "":
+		auth.HostKeyCallback, err = getKnownHostsCallback(source.KnownHosts)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		// Leaving the callback empty makes go-git verify the host against the
+		// known_hosts of the server ($SSH_KNOWN_HOSTS or ~/.ssh/known_hosts)
+	}
+
+	return auth, nil
+}
+
+// getKnownHostsCallback verifies the host keys against the known_hosts entries,
+// the knownhosts package only reads them from files
+func getKnownHostsCallback(knownHosts string) (crypto_ssh.HostKeyCallback, error) {
+	f, err := os.CreateTemp("", "known_hosts")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create known_hosts file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(knownHosts)
+	f.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to write known_hosts file: %w", err)
+	}
+
+	callback, err := knownhosts.New(f.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse known_hosts: %w", err)
+	}
+
+	return callback, nil
+}
+
+// matchGitFilters checks the file against the path prefixes and extensions,
+// empty filters match everything
+func matchGitFilters(source *types.KnowledgeSourceGithub, name string) bool {
+	if len(source.FilterPaths) > 0 {
+		matched := false
+		for _, p := range source.FilterPaths {
+			p = strings.Trim(p, "/")
+			if p == "" || name == p || strings.HasPrefix(name, p+"/") {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(source.FilterExtensions) == 0 {
+		return true
+	}
+
+	return hasGitExtensionFilter(source, name)
+}
+
+func hasGitExtensionFilter(source *types.KnowledgeSourceGithub, name string) bool {
+	ext := path.Ext(name)
+
+	for _, e := range source.FilterExtensions {
+		if ext != "" && strings.EqualFold(ext, "."+strings.TrimPrefix(e, ".")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getGitFileURL builds a link to the file, for http(s) remotes we use the
+// /blob/<branch>/<path> format understood by GitHub, GitLab and Gitea
+func getGitFileURL(repoURL, branch, name string) string {
+	if strings.HasPrefix(repoURL, "http://") || strings.HasPrefix(repoURL, "https://") {
+		return fmt.Sprintf("%s/blob/%s/%s", strings.TrimSuffix(strings.TrimSuffix(repoURL, "/"), ".git"), branch, name)
+	}
+
+	return fmt.Sprintf("%s/%s", strings.TrimSuffix(repoURL, "/"), name)
+}
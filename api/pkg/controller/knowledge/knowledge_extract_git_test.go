@@ -0,0 +1,335 @@
+package knowledge
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"go.uber.org/mock/gomock"
+	crypto_ssh "golang.org/x/crypto/ssh"
+
+	"github.com/helixml/helix/api/pkg/store"
+	"github.com/helixml/helix/api/pkg/system"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+// testGitRepo is a bare repository with a working copy that
+// pushes commits to it
+type testGitRepo struct {
+	suite *ExtractorSuite
+
+	bareDir string
+	workDir string
+	repo    *git.Repository
+}
+
+func (suite *ExtractorSuite) newTestGitRepo() *testGitRepo {
+	bareDir := suite.T().TempDir()
+	_, err := git.PlainInit(bareDir, true)
+	suite.Require().NoError(err)
+
+	workDir := suite.T().TempDir()
+	repo, err := git.PlainInit(workDir, false)
+	suite.Require().NoError(err)
+
+	_, err = repo.CreateRemote(&config.RemoteConfig{
+		Name: "origin",
+		URLs: []string{bareDir},
+	})
+	suite.Require().NoError(err)
+
+	// Local paths are rejected outside of the tests
+	suite.reconciler.cloneGitRepository = func(ctx context.Context, source *types.KnowledgeSourceGithub, depth int) (*git.Repository, error) {
+		return cloneGitRepository(ctx, source, depth, 0)
+	}
+
+	return &testGitRepo{
+		suite:   suite,
+		bareDir: bareDir,
+		workDir: workDir,
+		repo:    repo,
+	}
+}
+
+// commit writes the files, commits and pushes them, returns the commit hash
+func (r *testGitRepo) commit(files map[string]string) string {
+	wt, err := r.repo.Worktree()
+	r.suite.Require().NoError(err)
+
+	for name, content := range files {
+		path := filepath.Join(r.workDir, name)
+		r.suite.Require().NoError(os.MkdirAll(filepath.Dir(path), 0o755))
+		r.suite.Require().NoError(os.WriteFile(path, []byte(content), 0o644))
+
+		_, err = wt.Add(name)
+		r.suite.Require().NoError(err)
+	}
+
+	hash, err := wt.Commit("update", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@helix.ml", When: time.Now()},
+	})
+	r.suite.Require().NoError(err)
+
+	err = r.repo.Push(&git.PushOptions{RemoteName: "origin"})
+	r.suite.Require().NoError(err)
+
+	return hash.String()
+}
+
+func (suite *ExtractorSuite) Test_getIndexingData_Git() {
+	repo := suite.newTestGitRepo()
+	commit := repo.commit(map[string]string{
+		"README.md":        "# Project",
+		"docs/intro.md":    "Introduction",
+		"docs/setup.txt":   "Setup",
+		"docs/logo.png":    "\x89PNG\x00\x00binary",
+		"src/main.go":      "package main",
+		"docsite/index.md": "Not the docs folder",
+	})
+
+	knowledge := &types.Knowledge{
+		ID: "knowledge_id",
+		Source: types.KnowledgeSource{
+			Git: &types.KnowledgeSourceGithub{
+				URL:              repo.bareDir,
+				FilterPaths:      []string{"docs/"},
+				FilterExtensions: []string{"md", ".txt"},
+			},
+		},
+	}
+
+	data, err := suite.reconciler.getIndexingData(suite.ctx, knowledge)
+	suite.Require().NoError(err)
+	suite.Require().Equal(2, len(data))
+
+	suite.Equal(repo.bareDir+"/docs/intro.md", data[0].Source)
+	suite.Equal("Introduction", string(data[0].Data))
+	suite.Equal(getDocumentGroupID(repo.bareDir+"/docs/intro.md"), data[0].DocumentGroupID)
+	suite.Equal(commit, data[0].Commit)
+	suite.False(data[0].Unchanged)
+
+	suite.Equal(repo.bareDir+"/docs/setup.txt", data[1].Source)
+	suite.Equal("Setup", string(data[1].Data))
+}
+
+func (suite *ExtractorSuite) Test_getIndexingData_Git_SkipsBinaryFiles() {
+	repo := suite.newTestGitRepo()
+	repo.commit(map[string]string{
+		"main.go":  "package main",
+		"logo.png": "\x89PNG\x00\x00binary",
+	})
+
+	knowledge := &types.Knowledge{
+		ID: "knowledge_id",
+		Source: types.KnowledgeSource{
+			Git: &types.KnowledgeSourceGithub{
+				URL: repo.bareDir,
+			},
+		},
+	}
+
+	data, err := suite.reconciler.getIndexingData(suite.ctx, knowledge)
+	suite.Require().NoError(err)
+	suite.Require().Equal(1, len(data))
+	suite.Equal(repo.bareDir+"/main.go", data[0].Source)
+}
+
+func (suite *ExtractorSuite) Test_getIndexingData_Git_ChangedSinceLastCommit() {
+	repo := suite.newTestGitRepo()
+	firstCommit := repo.commit(map[string]string{
+		"a.md":     "first",
+		"b.md":     "second",
+		"notes.md": "excluded by the filters of the previous version",
+	})
+	secondCommit := repo.commit(map[string]string{
+		"b.md": "second, updated",
+		"c.md": "third",
+	})
+
+	knowledge := &types.Knowledge{
+		ID:      "knowledge_id",
+		Version: "v1",
+		Source: types.KnowledgeSource{
+			Git: &types.KnowledgeSourceGithub{
+				URL: repo.bareDir,
+			},
+		},
+	}
+
+	suite.store.EXPECT().ListKnowledgeVersions(gomock.Any(), &store.ListKnowledgeVersionQuery{
+		KnowledgeID: "knowledge_id",
+		State:       types.KnowledgeStateReady,
+	}).Return([]*types.KnowledgeVersion{
+		{
+			KnowledgeID: "knowledge_id",
+			Version:     "v1",
+			State:       types.KnowledgeStateReady,
+			CrawledSources: &types.CrawledSources{
+				Commit: firstCommit,
+				URLs: []*types.CrawledURL{
+					{URL: repo.bareDir + "/a.md", DocumentID: getDocumentID([]byte("first"))},
+					{URL: repo.bareDir + "/b.md", DocumentID: getDocumentID([]byte("second"))},
+				},
+			},
+		},
+	}, nil)
+
+	data, err := suite.reconciler.getIndexingData(suite.ctx, knowledge)
+	suite.Require().NoError(err)
+	suite.Require().Equal(4, len(data))
+
+	unchanged := make(map[string]bool)
+	for _, d := range data {
+		suite.Equal(secondCommit, d.Commit)
+		unchanged[filepath.Base(d.Source)] = d.Unchanged
+	}
+
+	// notes.md didn't change in git but has no chunks to carry over
+	suite.Equal(map[string]bool{
+		"a.md":     true,
+		"b.md":     false,
+		"c.md":     false,
+		"notes.md": false,
+	}, unchanged)
+}
+
+func (suite *ExtractorSuite) Test_getDocumentData_Git() {
+	repo := suite.newTestGitRepo()
+	repo.commit(map[string]string{
+		"a.md":               "first",
+		"b.md":               "second",
+		"b.md.metadata.json": `{"team": "docs"}`,
+	})
+
+	knowledge := &types.Knowledge{
+		ID:      "knowledge_id",
+		Version: "v1",
+		Source: types.KnowledgeSource{
+			Git: &types.KnowledgeSourceGithub{
+				URL: repo.bareDir,
+			},
+		},
+	}
+
+	// Only the document and its metadata are read, without diffing the indexed commit
+	data, err := suite.reconciler.getDocumentData(suite.ctx, knowledge, repo.bareDir+"/b.md")
+	suite.Require().NoError(err)
+	suite.Require().Equal(1, len(data))
+	suite.Equal("second", string(data[0].Data))
+	suite.Equal(map[string]string{"team": "docs"}, data[0].Metadata)
+
+	data, err = suite.reconciler.getDocumentData(suite.ctx, knowledge, repo.bareDir+"/deleted.md")
+	suite.Require().NoError(err)
+	suite.Empty(data)
+}
+
+func (suite *ExtractorSuite) Test_getIndexingData_Git_LocalPath() {
+	knowledge := &types.Knowledge{
+		ID: "knowledge_id",
+		Source: types.KnowledgeSource{
+			Git: &types.KnowledgeSourceGithub{
+				URL: "file:///etc",
+			},
+		},
+	}
+
+	_, err := suite.reconciler.getIndexingData(suite.ctx, knowledge)
+	suite.Require().Error(err)
+	suite.Contains(err.Error(), "git url must start with https:// or ssh://")
+}
+
+func (suite *ExtractorSuite) Test_cloneGitRepository_MaxSize() {
+	repo := suite.newTestGitRepo()
+	repo.commit(map[string]string{"a.md": strings.Repeat("a", 2048)})
+
+	_, err := cloneGitRepository(suite.ctx, &types.KnowledgeSourceGithub{URL: repo.bareDir}, 1, 1024)
+	suite.Require().Error(err)
+	suite.ErrorIs(err, ErrGitRepositoryTooLarge)
+
+	_, err = cloneGitRepository(suite.ctx, &types.KnowledgeSourceGithub{URL: repo.bareDir}, 1, 1024*1024)
+	suite.Require().NoError(err)
+}
+
+func (suite *ExtractorSuite) Test_evalGitSource_DeployKey() {
+	keyPair, err := system.GenerateEcdsaKeypair()
+	suite.Require().NoError(err)
+
+	knowledge := &types.Knowledge{
+		ID:    "knowledge_id",
+		Owner: "user_id",
+		Source: types.KnowledgeSource{
+			Git: &types.KnowledgeSourceGithub{
+				Owner:      "helixml",
+				Repository: "docs",
+				KeyPair: &types.KeyPair{
+					Type:       "ecdsa",
+					PrivateKey: "${DEPLOY_KEY}",
+				},
+			},
+		},
+	}
+
+	suite.store.EXPECT().ListSecrets(gomock.Any(), &store.ListSecretsQuery{
+		Owner: "user_id",
+	}).Return([]*types.Secret{
+		{Name: "DEPLOY_KEY", Value: []byte(keyPair.PrivateKey)},
+	}, nil)
+
+	source, err := suite.reconciler.evalGitSource(suite.ctx, knowledge)
+	suite.Require().NoError(err)
+
+	suite.Equal("https://github.com/helixml/docs.git", source.URL)
+	suite.Equal(keyPair.PrivateKey, source.KeyPair.PrivateKey)
+	suite.Equal("${DEPLOY_KEY}", knowledge.Source.Git.KeyPair.PrivateKey, "source must not be modified")
+
+	auth, err := getGitSSHAuth(source)
+	suite.Require().NoError(err)
+	suite.Equal("ssh-public-keys", auth.Name())
+	suite.Nil(auth.HostKeyCallback, "the known_hosts of the server are used by default")
+}
+
+func (suite *ExtractorSuite) Test_getGitSSHAuth_KnownHosts() {
+	deployKey, err := system.GenerateEcdsaKeypair()
+	suite.Require().NoError(err)
+
+	hostKeyPair, err := system.GenerateEcdsaKeypair()
+	suite.Require().NoError(err)
+	hostKey, _, _, _, err := crypto_ssh.ParseAuthorizedKey([]byte(hostKeyPair.PublicKey))
+	suite.Require().NoError(err)
+
+	otherKeyPair, err := system.GenerateEcdsaKeypair()
+	suite.Require().NoError(err)
+	otherKey, _, _, _, err := crypto_ssh.ParseAuthorizedKey([]byte(otherKeyPair.PublicKey))
+	suite.Require().NoError(err)
+
+	auth, err := getGitSSHAuth(&types.KnowledgeSourceGithub{
+		KeyPair:    deployKey,
+		KnownHosts: "github.com " + hostKeyPair.PublicKey + "\n",
+	})
+	suite.Require().NoError(err)
+
+	addr := &net.TCPAddr{IP: net.IPv4(140, 82, 121, 3), Port: 22}
+	suite.NoError(auth.HostKeyCallback("github.com:22", addr, hostKey))
+	suite.Error(auth.HostKeyCallback("github.com:22", addr, otherKey))
+	suite.Error(auth.HostKeyCallback("gitlab.com:22", addr, hostKey))
+
+	// Host key verification is only skipped when explicitly asked for
+	auth, err = getGitSSHAuth(&types.KnowledgeSourceGithub{
+		KeyPair:                  deployKey,
+		InsecureSkipHostKeyCheck: true,
+	})
+	suite.Require().NoError(err)
+	suite.NoError(auth.HostKeyCallback("gitlab.com:22", addr, otherKey))
+
+	_, err = getGitSSHAuth(&types.KnowledgeSourceGithub{
+		KeyPair:    deployKey,
+		KnownHosts: "not a known hosts line",
+	})
+	suite.Error(err)
+}
@@ -0,0 +1,86 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/helixml/helix/api/pkg/filestore"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+func (r *Reconciler) extractDataFromS3(ctx context.Context, k *types.Knowledge) ([]*indexerData, error) {
+	source, err := r.evalS3Source(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+
+	s3, err := r.newS3Storage(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	data, err := r.getFilestoreFiles(ctx, s3, source.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get S3 files: %w", err)
+	}
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("%w: s3://%s/%s", ErrNoFilesFound, source.Bucket, source.Path)
+	}
+
+	// Use full object URLs as sources so they can be referenced in the answers
+	for _, d := range data {
+		d.Source = fmt.Sprintf("s3://%s/%s", source.Bucket, d.Source)
+		d.DocumentGroupID = getDocumentGroupID(d.Source)
+	}
+
+	logDataFound(k, data, "s3 data found")
+
+	return r.extractFiles(ctx, k, data)
+}
+
+// evalS3Source returns a copy of the S3 source with the secret
+// references resolved
+func (r *Reconciler) evalS3Source(ctx context.Context, k *types.Knowledge) (*types.KnowledgeSourceS3, error) {
+	if k.Source.S3 == nil {
+		return nil, fmt.Errorf("no s3 source defined")
+	}
+
+	secrets, err := r.getSecrets(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+
+	source := *k.Source.S3
+
+	for _, field := range []*string{&source.Endpoint, &source.AccessKeyID, &source.SecretAccessKey} {
+		*field, err = evalSecrets(*field, secrets)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if source.AccessKeyID == "" && source.SecretAccessKey == "" {
+		if !r.config.RAG.AmbientCredentials {
+			return nil, fmt.Errorf("s3 access key id and secret access key are required")
+		}
+		// The server credentials are only ever sent to AWS
+		if source.Endpoint != "" {
+			return nil, fmt.Errorf("s3 endpoint requires an access key id and secret access key")
+		}
+	} else if source.AccessKeyID == "" || source.SecretAccessKey == "" {
+		return nil, fmt.Errorf("s3 access key id and secret access key are required")
+	}
+
+	return &source, nil
+}
+
+func newS3Storage(source *types.KnowledgeSourceS3) (filestore.FileStore, error) {
+	return filestore.NewS3Storage(filestore.S3Options{
+		Endpoint:        source.Endpoint,
+		Region:          source.Region,
+		Bucket:          source.Bucket,
+		AccessKeyID:     source.AccessKeyID,
+		SecretAccessKey: source.SecretAccessKey,
+	})
+}
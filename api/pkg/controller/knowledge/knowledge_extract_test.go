@@ -3,9 +3,14 @@ package knowledge
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/fsouza/fake-gcs-server/fakestorage"
 
 	"github.com/helixml/helix/api/pkg/config"
 	"github.com/helixml/helix/api/pkg/controller/knowledge/browser"
@@ -17,6 +22,7 @@ import (
 	"github.com/helixml/helix/api/pkg/types"
 	"go.uber.org/mock/gomock"
 
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -55,13 +61,13 @@ func (suite *ExtractorSuite) SetupTest() {
 
 	var err error
 
-	suite.reconciler, err = New(suite.cfg, suite.store, suite.filestore, suite.extractor, suite.rag, b)
+	suite.reconciler, err = New(suite.cfg, suite.store, suite.filestore, suite.extractor, suite.rag, nil, nil, b)
 	suite.Require().NoError(err)
 	suite.reconciler.newRagClient = func(_ *types.RAGSettings) rag.RAG {
 		return suite.rag
 	}
 
-	suite.reconciler.newCrawler = func(_ *types.Knowledge) (crawler.Crawler, error) {
+	suite.reconciler.newCrawler = func(_ *types.Knowledge, _ *types.CrawledSources, _ crawler.Checkpointer) (crawler.Crawler, error) {
 		return suite.crawler, nil
 	}
 }
@@ -93,6 +99,113 @@ func (suite *ExtractorSuite) Test_getIndexingData_CrawlerEnabled() {
 	suite.Contains(string(data[0].Data), "Hello, world!")
 }
 
+func (suite *ExtractorSuite) Test_getIndexingData_CrawlerUnchangedPages() {
+	knowledge := &types.Knowledge{
+		ID:      "knowledge_id",
+		Version: "v1",
+		Source: types.KnowledgeSource{
+			Web: &types.KnowledgeSourceWeb{
+				URLs: []string{"https://example.com"},
+				Crawler: &types.WebsiteCrawler{
+					Enabled: true,
+				},
+			},
+		},
+	}
+
+	lastModified := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	previous := &types.CrawledSources{
+		RAGSettingsHash: getRAGSettingsHash(knowledge),
+		URLs: []*types.CrawledURL{
+			{URL: "https://example.com/a", StatusCode: 200, DocumentID: "doc_a", LastModified: &lastModified},
+		},
+	}
+
+	suite.store.EXPECT().ListKnowledgeVersions(gomock.Any(), gomock.Any()).Return([]*types.KnowledgeVersion{
+		{KnowledgeID: "knowledge_id", Version: "v1", CrawledSources: previous},
+	}, nil)
+
+	suite.reconciler.newCrawler = func(_ *types.Knowledge, p *types.CrawledSources, _ crawler.Checkpointer) (crawler.Crawler, error) {
+		suite.Equal(previous, p)
+		return suite.crawler, nil
+	}
+
+	suite.crawler.EXPECT().Crawl(gomock.Any()).Return([]*types.CrawledDocument{
+		{SourceURL: "https://example.com/a", LastModified: &lastModified, Unchanged: true},
+		{SourceURL: "https://example.com", Content: "Hello, world!"},
+	}, nil)
+
+	data, err := suite.reconciler.getIndexingData(suite.ctx, knowledge)
+	suite.Require().NoError(err)
+	suite.Require().Equal(2, len(data))
+
+	suite.True(data[0].Unchanged)
+	suite.Equal("doc_a", data[0].DocumentID)
+	suite.Equal(&lastModified, data[0].LastModified)
+
+	sources := getCrawledSources(data)
+	suite.Equal("doc_a", sources[0].DocumentID)
+	suite.Equal(200, sources[0].StatusCode)
+	suite.Equal(&lastModified, sources[0].LastModified)
+}
+
+func (suite *ExtractorSuite) Test_getIndexingData_CrawlerAuthSecrets() {
+	knowledge := &types.Knowledge{
+		ID:    "knowledge_id",
+		Owner: "user_id",
+		Source: types.KnowledgeSource{
+			Web: &types.KnowledgeSourceWeb{
+				URLs: []string{"https://wiki.example.com"},
+				Auth: types.KnowledgeSourceWebAuth{
+					Username: "bot",
+					Password: "${WIKI_PASSWORD}",
+					Headers:  map[string]string{"X-Api-Key": "${WIKI_KEY}"},
+					Cookies:  []*types.KnowledgeSourceWebCookie{{Name: "tenant", Value: "acme"}},
+					Login: &types.KnowledgeSourceWebLogin{
+						URL: "https://wiki.example.com/login",
+						Steps: []*types.KnowledgeSourceWebLoginStep{
+							{Action: types.WebLoginActionFill, Selector: "#user", Value: "${username}"},
+							{Action: types.WebLoginActionFill, Selector: "#pass", Value: "${password}"},
+						},
+					},
+				},
+				Crawler: &types.WebsiteCrawler{
+					Enabled: true,
+				},
+			},
+		},
+	}
+
+	suite.store.EXPECT().ListSecrets(gomock.Any(), &store.ListSecretsQuery{
+		Owner: "user_id",
+	}).Return([]*types.Secret{
+		{Name: "WIKI_PASSWORD", Value: []byte("hunter2")},
+		{Name: "WIKI_KEY", Value: []byte("key")},
+	}, nil)
+
+	suite.reconciler.newCrawler = func(k *types.Knowledge, _ *types.CrawledSources, _ crawler.Checkpointer) (crawler.Crawler, error) {
+		auth := k.Source.Web.Auth
+		suite.Equal("hunter2", auth.Password)
+		suite.Equal("key", auth.Headers["X-Api-Key"])
+		suite.Equal("acme", auth.Cookies[0].Value)
+		suite.Equal("bot", auth.Login.Steps[0].Value)
+		suite.Equal("hunter2", auth.Login.Steps[1].Value)
+		return suite.crawler, nil
+	}
+
+	suite.crawler.EXPECT().Crawl(gomock.Any()).Return([]*types.CrawledDocument{
+		{SourceURL: "https://wiki.example.com", Content: "Welcome"},
+	}, nil)
+
+	_, err := suite.reconciler.getIndexingData(suite.ctx, knowledge)
+	suite.Require().NoError(err)
+
+	// The stored knowledge keeps the references
+	suite.Equal("${WIKI_PASSWORD}", knowledge.Source.Web.Auth.Password)
+	suite.Equal("${password}", knowledge.Source.Web.Auth.Login.Steps[1].Value)
+}
+
 func (suite *ExtractorSuite) Test_getIndexingData_CrawlerDisabled_ExtractDisabled() {
 	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
 		fmt.Fprintln(w, "Hello, world!")
@@ -147,3 +260,310 @@ func (suite *ExtractorSuite) Test_getIndexingData_CrawlerDisabled_ExtractEnabled
 	suite.Equal("https://example.com", data[0].Source)
 	suite.Contains(string(data[0].Data), "Hello, world!")
 }
+
+func (suite *ExtractorSuite) Test_getIndexingData_CrawlerAuthUnknownSecret() {
+	knowledge := &types.Knowledge{
+		ID:    "knowledge_id",
+		Owner: "user_id",
+		Source: types.KnowledgeSource{
+			Web: &types.KnowledgeSourceWeb{
+				URLs: []string{"https://wiki.example.com"},
+				Auth: types.KnowledgeSourceWebAuth{
+					Username: "bot",
+					Password: "${WIKI_PASSWORD}",
+				},
+				Crawler: &types.WebsiteCrawler{
+					Enabled: true,
+				},
+			},
+		},
+	}
+
+	suite.store.EXPECT().ListSecrets(gomock.Any(), gomock.Any()).Return([]*types.Secret{
+		{Name: "WIKI_KEY", Value: []byte("key")},
+	}, nil)
+
+	// The crawler must not log in with an empty password
+	suite.reconciler.newCrawler = func(_ *types.Knowledge, _ *types.CrawledSources, _ crawler.Checkpointer) (crawler.Crawler, error) {
+		suite.Fail("crawler must not be created")
+		return suite.crawler, nil
+	}
+
+	_, err := suite.reconciler.getIndexingData(suite.ctx, knowledge)
+	suite.Require().Error(err)
+	suite.Contains(err.Error(), "secret not found: WIKI_PASSWORD")
+}
+
+func (suite *ExtractorSuite) Test_getIndexingData_S3() {
+	knowledge := &types.Knowledge{
+		ID:    "knowledge_id",
+		Owner: "user_id",
+		AppID: "app_id",
+		Source: types.KnowledgeSource{
+			S3: &types.KnowledgeSourceS3{
+				Bucket:          "runbooks",
+				Path:            "ops",
+				Endpoint:        "http://minio:9000",
+				AccessKeyID:     "${S3_ACCESS_KEY}",
+				SecretAccessKey: "${S3_SECRET_KEY}",
+			},
+		},
+	}
+
+	suite.store.EXPECT().ListSecrets(gomock.Any(), &store.ListSecretsQuery{
+		Owner: "user_id",
+	}).Return([]*types.Secret{
+		{Name: "S3_ACCESS_KEY", Value: []byte("access")},
+		{Name: "S3_SECRET_KEY", Value: []byte("secret")},
+		{Name: "S3_SECRET_KEY", Value: []byte("other-app-secret"), AppID: "other_app_id"},
+	}, nil)
+
+	suite.reconciler.newS3Storage = func(source *types.KnowledgeSourceS3) (filestore.FileStore, error) {
+		suite.Equal("http://minio:9000", source.Endpoint)
+		suite.Equal("access", source.AccessKeyID)
+		suite.Equal("secret", source.SecretAccessKey)
+
+		return suite.filestore, nil
+	}
+
+	suite.filestore.EXPECT().List(gomock.Any(), "ops").Return([]filestore.Item{
+		{Path: "ops/restart.md"},
+		{Path: "ops/db/", Directory: true},
+	}, nil)
+	suite.filestore.EXPECT().List(gomock.Any(), "ops/db/").Return([]filestore.Item{
+		{Path: "ops/db/backup.pdf"},
+	}, nil)
+
+	suite.filestore.EXPECT().OpenFile(gomock.Any(), "ops/restart.md").
+		Return(io.NopCloser(strings.NewReader("restart it")), nil)
+	suite.filestore.EXPECT().OpenFile(gomock.Any(), "ops/db/backup.pdf").
+		Return(io.NopCloser(strings.NewReader("%PDF backup")), nil)
+
+	suite.extractor.EXPECT().Extract(gomock.Any(), &extract.Request{
+		Content:  []byte("restart it"),
+		Filename: "s3://runbooks/ops/restart.md",
+	}).Return("restart it", nil)
+	suite.extractor.EXPECT().Extract(gomock.Any(), &extract.Request{
+		Content:  []byte("%PDF backup"),
+		Filename: "s3://runbooks/ops/db/backup.pdf",
+	}).Return("backup", nil)
+
+	data, err := suite.reconciler.getIndexingData(suite.ctx, knowledge)
+	suite.Require().NoError(err)
+	suite.Require().Equal(2, len(data))
+
+	suite.Equal("s3://runbooks/ops/restart.md", data[0].Source)
+	suite.Equal("restart it", string(data[0].Data))
+	suite.Equal(getDocumentGroupID("s3://runbooks/ops/restart.md"), data[0].DocumentGroupID)
+
+	suite.Equal("s3://runbooks/ops/db/backup.pdf", data[1].Source)
+	suite.Equal("backup", string(data[1].Data))
+}
+
+func (suite *ExtractorSuite) Test_getIndexingData_S3_Empty() {
+	knowledge := &types.Knowledge{
+		ID:    "knowledge_id",
+		Owner: "user_id",
+		Source: types.KnowledgeSource{
+			S3: &types.KnowledgeSourceS3{
+				Bucket:          "runbooks",
+				Path:            "ops",
+				AccessKeyID:     "access",
+				SecretAccessKey: "secret",
+			},
+		},
+	}
+
+	suite.store.EXPECT().ListSecrets(gomock.Any(), gomock.Any()).Return(nil, nil)
+
+	suite.reconciler.newS3Storage = func(_ *types.KnowledgeSourceS3) (filestore.FileStore, error) {
+		return suite.filestore, nil
+	}
+
+	suite.filestore.EXPECT().List(gomock.Any(), "ops").Return([]filestore.Item{}, nil)
+
+	_, err := suite.reconciler.getIndexingData(suite.ctx, knowledge)
+	suite.Require().Error(err)
+	suite.ErrorIs(err, ErrNoFilesFound)
+	suite.Contains(err.Error(), "s3://runbooks/ops")
+}
+
+func (suite *ExtractorSuite) Test_getIndexingData_S3_Credentials() {
+	knowledge := &types.Knowledge{
+		ID:    "knowledge_id",
+		Owner: "user_id",
+		Source: types.KnowledgeSource{
+			S3: &types.KnowledgeSourceS3{
+				Bucket: "runbooks",
+				Path:   "ops",
+			},
+		},
+	}
+
+	suite.store.EXPECT().ListSecrets(gomock.Any(), gomock.Any()).Return(nil, nil).AnyTimes()
+
+	suite.reconciler.newS3Storage = func(_ *types.KnowledgeSourceS3) (filestore.FileStore, error) {
+		return suite.filestore, nil
+	}
+
+	// The server credentials are not used unless enabled
+	_, err := suite.reconciler.getIndexingData(suite.ctx, knowledge)
+	suite.Require().Error(err)
+	suite.Contains(err.Error(), "access key id and secret access key are required")
+
+	// and then only for AWS
+	suite.cfg.RAG.AmbientCredentials = true
+	knowledge.Source.S3.Endpoint = "http://attacker.example.com"
+
+	_, err = suite.reconciler.getIndexingData(suite.ctx, knowledge)
+	suite.Require().Error(err)
+	suite.Contains(err.Error(), "endpoint requires an access key id")
+
+	// Unknown secrets are not replaced with empty values
+	knowledge.Source.S3.AccessKeyID = "${S3_ACCESS_KEY}"
+	knowledge.Source.S3.SecretAccessKey = "${S3_SECRET_KEY}"
+
+	_, err = suite.reconciler.getIndexingData(suite.ctx, knowledge)
+	suite.Require().Error(err)
+	suite.Contains(err.Error(), "secret not found: S3_ACCESS_KEY")
+}
+
+func (suite *ExtractorSuite) Test_getIndexingData_GCS() {
+	knowledge := &types.Knowledge{
+		ID:    "knowledge_id",
+		Owner: "user_id",
+		AppID: "app_id",
+		Source: types.KnowledgeSource{
+			GCS: &types.KnowledgeSourceGCS{
+				Bucket:            "handbook",
+				Path:              "hr",
+				ServiceAccountKey: "${GCS_KEY}",
+			},
+		},
+	}
+
+	suite.store.EXPECT().ListSecrets(gomock.Any(), &store.ListSecretsQuery{
+		Owner: "user_id",
+	}).Return([]*types.Secret{
+		{Name: "GCS_KEY", Value: []byte(`{"type": "service_account"}`)},
+	}, nil)
+
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{
+			ObjectAttrs: fakestorage.ObjectAttrs{BucketName: "handbook", Name: "hr/holidays.md"},
+			Content:     []byte("25 days"),
+		},
+		{
+			ObjectAttrs: fakestorage.ObjectAttrs{BucketName: "handbook", Name: "hr/policies/remote.md"},
+			Content:     []byte("work from anywhere"),
+		},
+		{
+			ObjectAttrs: fakestorage.ObjectAttrs{BucketName: "handbook", Name: "eng/oncall.md"},
+			Content:     []byte("not indexed"),
+		},
+	})
+	defer server.Stop()
+
+	suite.reconciler.newGCSStorage = func(_ context.Context, source *types.KnowledgeSourceGCS) (filestore.FileStore, error) {
+		suite.Equal(`{"type": "service_account"}`, source.ServiceAccountKey)
+
+		return filestore.NewGCSStorageFromClient(server.Client(), source.Bucket), nil
+	}
+
+	suite.extractor.EXPECT().Extract(gomock.Any(), &extract.Request{
+		Content:  []byte("25 days"),
+		Filename: "gs://handbook/hr/holidays.md",
+	}).Return("25 days", nil)
+	suite.extractor.EXPECT().Extract(gomock.Any(), &extract.Request{
+		Content:  []byte("work from anywhere"),
+		Filename: "gs://handbook/hr/policies/remote.md",
+	}).Return("work from anywhere", nil)
+
+	data, err := suite.reconciler.getIndexingData(suite.ctx, knowledge)
+	suite.Require().NoError(err)
+	suite.Require().Equal(2, len(data))
+
+	suite.Equal("gs://handbook/hr/holidays.md", data[0].Source)
+	suite.Equal("25 days", string(data[0].Data))
+	suite.Equal(getDocumentGroupID("gs://handbook/hr/holidays.md"), data[0].DocumentGroupID)
+
+	suite.Equal("gs://handbook/hr/policies/remote.md", data[1].Source)
+	suite.Equal("work from anywhere", string(data[1].Data))
+}
+
+func (suite *ExtractorSuite) Test_getIndexingData_GCS_Empty() {
+	knowledge := &types.Knowledge{
+		ID:    "knowledge_id",
+		Owner: "user_id",
+		Source: types.KnowledgeSource{
+			GCS: &types.KnowledgeSourceGCS{
+				Bucket: "handbook",
+				Path:   "hr",
+			},
+		},
+	}
+
+	suite.cfg.RAG.AmbientCredentials = true
+
+	suite.store.EXPECT().ListSecrets(gomock.Any(), gomock.Any()).Return(nil, nil)
+
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{
+			ObjectAttrs: fakestorage.ObjectAttrs{BucketName: "handbook", Name: "eng/oncall.md"},
+			Content:     []byte("not indexed"),
+		},
+	})
+	defer server.Stop()
+
+	suite.reconciler.newGCSStorage = func(_ context.Context, source *types.KnowledgeSourceGCS) (filestore.FileStore, error) {
+		return filestore.NewGCSStorageFromClient(server.Client(), source.Bucket), nil
+	}
+
+	_, err := suite.reconciler.getIndexingData(suite.ctx, knowledge)
+	suite.Require().Error(err)
+	suite.ErrorIs(err, ErrNoFilesFound)
+}
+
+func (suite *ExtractorSuite) Test_getIndexingData_GCS_Credentials() {
+	knowledge := &types.Knowledge{
+		ID:    "knowledge_id",
+		Owner: "user_id",
+		Source: types.KnowledgeSource{
+			GCS: &types.KnowledgeSourceGCS{
+				Bucket: "handbook",
+				Path:   "hr",
+			},
+		},
+	}
+
+	suite.store.EXPECT().ListSecrets(gomock.Any(), gomock.Any()).Return(nil, nil)
+
+	suite.reconciler.newGCSStorage = func(_ context.Context, _ *types.KnowledgeSourceGCS) (filestore.FileStore, error) {
+		suite.Fail("application default credentials must not be used")
+		return nil, nil
+	}
+
+	_, err := suite.reconciler.getIndexingData(suite.ctx, knowledge)
+	suite.Require().Error(err)
+	suite.Contains(err.Error(), "gcs service account key is required")
+}
+
+func Test_applySidecarMetadata(t *testing.T) {
+	data := applySidecarMetadata(&types.Knowledge{ID: "knowledge_id"}, []*indexerData{
+		{Source: "docs/report.pdf", Unchanged: true},
+		{Source: "docs/report.pdf.metadata.json", Data: []byte(`{"team": "sales", "year": 2024, "draft": false}`)},
+		{Source: "docs/notes.md", Unchanged: true},
+		{Source: "docs/notes.md.metadata.json", Data: []byte(`{"bad key": "value"}`), Unchanged: true},
+		{Source: "docs/orphan.txt.metadata.json", Data: []byte(`{"team": "ops"}`)},
+	})
+
+	require.Len(t, data, 2)
+
+	require.Equal(t, "docs/report.pdf", data[0].Source)
+	require.Equal(t, map[string]string{"team": "sales", "year": "2024", "draft": "false"}, data[0].Metadata)
+	require.False(t, data[0].Unchanged, "changed metadata requires re-indexing")
+
+	require.Equal(t, "docs/notes.md", data[1].Source)
+	require.Nil(t, data[1].Metadata, "invalid metadata is ignored")
+	require.True(t, data[1].Unchanged)
+}
@@ -4,9 +4,14 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
+	"path"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/dustin/go-humanize"
@@ -32,6 +37,11 @@ func (r *Reconciler) index(ctx context.Context) error {
 	}
 
 	for _, k := range data {
+		// A document of the knowledge is being re-indexed, it's picked up once done
+		if !r.lockKnowledge(k.ID) {
+			continue
+		}
+
 		r.wg.Add(1)
 
 		k.State = types.KnowledgeStateIndexing
@@ -54,10 +64,19 @@ func (r *Reconciler) index(ctx context.Context) error {
 
 		go func(knowledge *types.Knowledge) {
 			defer r.wg.Done()
+			defer r.unlockKnowledge(knowledge.ID)
 
 			version := system.GenerateVersion()
 
 			err := r.indexKnowledge(ctx, knowledge, version)
+
+			// Interrupted crawls keep the checkpoint to resume from after the restart
+			if crawlerEnabled(knowledge) && ctx.Err() == nil {
+				if err := r.newCrawlCheckpointer(knowledge).Delete(ctx); err != nil {
+					log.Warn().Err(err).Str("knowledge_id", knowledge.ID).Msg("failed to delete crawl checkpoint")
+				}
+			}
+
 			if err != nil {
 				log.
 					Warn().
@@ -110,6 +129,9 @@ func (r *Reconciler) indexKnowledge(ctx context.Context, k *types.Knowledge, ver
 
 	start := time.Now()
 
+	// Clear the progress left by a failed run
+	r.resetKnowledgeProgress(k.ID)
+
 	if err := r.updateProgress(k, types.KnowledgeStateIndexing, "retrieving data for indexing"); err != nil {
 		return fmt.Errorf("failed to update progress when retrieving data: %v", err)
 	}
@@ -125,7 +147,15 @@ func (r *Reconciler) indexKnowledge(ctx context.Context, k *types.Knowledge, ver
 		return err
 	}
 
+	if excluded := markExcludedData(k, data); excluded > 0 {
+		log.Info().
+			Str("knowledge_id", k.ID).
+			Int("excluded", excluded).
+			Msg("skipping excluded documents")
+	}
+
 	crawledSources := getCrawledSources(data)
+	data = getIndexedData(data)
 
 	elapsed := time.Since(start)
 	log.Info().
@@ -136,7 +166,9 @@ func (r *Reconciler) indexKnowledge(ctx context.Context, k *types.Knowledge, ver
 
 	k.Message = "indexing data"
 	k.CrawledSources = &types.CrawledSources{
-		URLs: crawledSources,
+		URLs:            crawledSources,
+		Commit:          getCommit(data),
+		RAGSettingsHash: getRAGSettingsHash(k),
 	}
 
 	r.updateKnowledgeProgress(k.ID, types.KnowledgeProgress{
@@ -295,12 +327,202 @@ func (r *Reconciler) getRagClient(k *types.Knowledge) rag.RAG {
 }
 
 func (r *Reconciler) indexData(ctx context.Context, k *types.Knowledge, version string, data []*indexerData, startedAt time.Time) error {
+	data, err := r.copyUnchangedData(ctx, k, version, data)
+	if err != nil {
+		return err
+	}
+
+	if len(data) == 0 {
+		// Everything was carried over from the previous version
+		if err := r.updateProgress(k, types.KnowledgeStateIndexing, "indexing data completed"); err != nil {
+			return fmt.Errorf("failed to update progress when completed data indexing: %v", err)
+		}
+		return nil
+	}
+
 	if k.RAGSettings.DisableChunking {
 		return r.indexDataDirectly(ctx, k, version, data, startedAt)
 	}
 	return r.indexDataWithChunking(ctx, k, version, data, startedAt)
 }
 
+// copyUnchangedData carries the chunks of the unchanged documents over from the current
+// knowledge version into the new one and returns the data that still has to be indexed.
+// Documents are unchanged when the previous version has the same source with the same
+// content hash. Documents that are no longer present are not copied, so they are dropped.
+// If the RAG settings changed or the RAG backend can't copy, everything is re-indexed,
+// after a failed copy the documents that were already copied are deleted first.
+func (r *Reconciler) copyUnchangedData(ctx context.Context, k *types.Knowledge, version string, data []*indexerData) ([]*indexerData, error) {
+	previous, err := r.getCurrentVersion(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+
+	if previous == nil || previous.CrawledSources == nil {
+		return data, nil
+	}
+
+	if previous.CrawledSources.RAGSettingsHash != getRAGSettingsHash(k) {
+		log.Info().
+			Str("knowledge_id", k.ID).
+			Msg("RAG settings changed since the last version, re-indexing all documents")
+		return data, nil
+	}
+
+	markUnchangedData(previous.CrawledSources, data)
+
+	var (
+		unchanged []string
+		changed   []*indexerData
+	)
+
+	for _, d := range data {
+		if d.Unchanged {
+			unchanged = append(unchanged, d.DocumentGroupID)
+		} else {
+			changed = append(changed, d)
+		}
+	}
+
+	if len(unchanged) == 0 {
+		return data, nil
+	}
+
+	err = r.getRagClient(k).Copy(ctx, &types.CopyIndexRequest{
+		FromDataEntityID: previous.GetDataEntityID(),
+		ToDataEntityID:   types.GetDataEntityID(k.ID, version),
+		DocumentGroupIDs: unchanged,
+	})
+	if err != nil {
+		if errors.Is(err, rag.ErrNotSupported) {
+			log.Info().
+				Str("knowledge_id", k.ID).
+				Msg("RAG backend can't copy documents, re-indexing all documents")
+		} else {
+			log.Warn().
+				Err(err).
+				Str("knowledge_id", k.ID).
+				Msg("failed to copy unchanged documents, re-indexing all documents")
+
+			// The copy is done in batches, the ones that made it would be duplicated
+			err = r.getRagClient(k).DeleteDocuments(ctx, &types.DeleteDocumentsRequest{
+				DataEntityID:     types.GetDataEntityID(k.ID, version),
+				DocumentGroupIDs: unchanged,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to delete partially copied documents: %w", err)
+			}
+		}
+		return r.refetchUnchangedData(ctx, k, data)
+	}
+
+	log.Info().
+		Str("knowledge_id", k.ID).
+		Int("unchanged", len(unchanged)).
+		Int("changed", len(changed)).
+		Int("removed", countRemoved(previous.CrawledSources, data)).
+		Msg("carried unchanged documents over from the previous version")
+
+	return changed, nil
+}
+
+// refetchUnchangedData clears the unchanged flag so everything is indexed again. Pages
+// that the crawler skipped because they didn't change have no contents, those are
+// fetched again.
+func (r *Reconciler) refetchUnchangedData(ctx context.Context, k *types.Knowledge, data []*indexerData) ([]*indexerData, error) {
+	var err error
+	if k.Source.Web != nil {
+		k, err = r.evalWebAuth(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, d := range data {
+		if !d.Unchanged {
+			continue
+		}
+
+		d.Unchanged = false
+
+		if len(d.Data) > 0 || k.Source.Web == nil {
+			continue
+		}
+
+		bts, err := r.fetchWebPage(ctx, k, d.Source)
+		if err != nil {
+			return nil, err
+		}
+
+		d.Data = bts
+		d.DocumentID = ""
+	}
+
+	return data, nil
+}
+
+// markUnchangedData marks the documents that have the same contents as in the
+// previous version. Sources that already know they are unchanged (git) stay marked.
+func markUnchangedData(previous *types.CrawledSources, data []*indexerData) {
+	hashes := make(map[string]*types.CrawledURL, len(previous.URLs))
+	for _, u := range previous.URLs {
+		if u.DocumentID != "" {
+			hashes[u.URL] = u
+		}
+	}
+
+	for _, d := range data {
+		if d.Unchanged || len(d.Data) == 0 {
+			continue
+		}
+
+		u, ok := hashes[d.Source]
+		if ok && u.DocumentID == getDocumentID(d.Data) && u.MetadataHash == getMetadataHash(d.Metadata) {
+			d.Unchanged = true
+		}
+	}
+}
+
+// countRemoved returns how many documents of the previous version are no longer present
+func countRemoved(previous *types.CrawledSources, data []*indexerData) int {
+	sources := make(map[string]bool, len(data))
+	for _, d := range data {
+		sources[d.Source] = true
+	}
+
+	count := 0
+	for _, u := range previous.URLs {
+		if !sources[u.URL] {
+			count++
+		}
+	}
+	return count
+}
+
+// getCurrentVersion returns the version the knowledge is currently serving,
+// nil if it was never indexed
+func (r *Reconciler) getCurrentVersion(ctx context.Context, k *types.Knowledge) (*types.KnowledgeVersion, error) {
+	if k.Version == "" {
+		return nil, nil
+	}
+
+	versions, err := r.store.ListKnowledgeVersions(ctx, &store.ListKnowledgeVersionQuery{
+		KnowledgeID: k.ID,
+		State:       types.KnowledgeStateReady,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list knowledge versions, error: %w", err)
+	}
+
+	for _, v := range versions {
+		if v.Version == k.Version {
+			return v, nil
+		}
+	}
+
+	return nil, nil
+}
+
 func (r *Reconciler) indexDataDirectly(ctx context.Context, k *types.Knowledge, version string, data []*indexerData, startedAt time.Time) error {
 	ragClient := r.getRagClient(k)
 
@@ -333,6 +555,7 @@ func (r *Reconciler) indexDataDirectly(ctx context.Context, k *types.Knowledge,
 			DocumentGroupID: getDocumentGroupID(d.Source),
 			ContentOffset:   0,
 			Content:         string(d.Data),
+			Metadata:        getDocumentMetadata(d, startedAt),
 		})
 		if err != nil {
 			// return fmt.Errorf("failed to index data from source %s, error: %w", d.Source, err)
@@ -356,7 +579,7 @@ func (r *Reconciler) indexDataDirectly(ctx context.Context, k *types.Knowledge,
 // indexDataWithChunking we expect to be operating on text data, first we split,
 // then index with the rag server
 func (r *Reconciler) indexDataWithChunking(ctx context.Context, k *types.Knowledge, version string, data []*indexerData, startedAt time.Time) error {
-	chunks, err := splitData(k, data)
+	chunks, err := splitData(ctx, k, data, r.embedder)
 	if err != nil {
 		return fmt.Errorf("failed to split data, error: %w", err)
 	}
@@ -374,9 +597,14 @@ func (r *Reconciler) indexDataWithChunking(ctx context.Context, k *types.Knowled
 
 	batches := convertChunksIntoBatches(chunks, 50)
 
+	metadata := make(map[string]map[string]string, len(data))
+	for _, d := range data {
+		metadata[d.DocumentGroupID] = getDocumentMetadata(d, startedAt)
+	}
+
 	for idx, batch := range batches {
 		// Convert the chunks into index chunks
-		indexChunks := convertTextSplitterChunks(k, version, batch)
+		indexChunks := convertTextSplitterChunks(k, version, batch, metadata)
 
 		percentage := int(float32(idx) / float32(len(batches)) * 100)
 
@@ -404,6 +632,11 @@ func (r *Reconciler) indexDataWithChunking(ctx context.Context, k *types.Knowled
 }
 
 func (r *Reconciler) updateProgress(k *types.Knowledge, state types.KnowledgeState, message string) error {
+	// Eval copies are not stored, the eval job reports their progress
+	if strings.HasPrefix(k.ID, system.KnowledgeEvalPrefix) {
+		return nil
+	}
+
 	return r.store.UpdateKnowledgeState(context.Background(), k.ID, state, message)
 }
 
@@ -421,6 +654,84 @@ func getDocumentGroupID(sourceURL string) string {
 	return hashString[:10]
 }
 
+// getRAGSettingsHash is stored with each version, chunks can only be carried
+// over to the new version if they were indexed with the same settings
+func getRAGSettingsHash(k *types.Knowledge) string {
+	// Only the settings used when indexing, changing the query
+	// settings doesn't require re-indexing the documents
+	settings := k.RAGSettings
+	settings.Threshold = 0
+	settings.ResultsCount = 0
+	settings.PromptTemplate = ""
+	settings.QueryRewrite = types.RAGQueryRewriteSettings{}
+	settings.Rerank = types.RAGRerankSettings{}
+
+	bts, err := json.Marshal(settings)
+	if err != nil {
+		return ""
+	}
+
+	hash := sha256.Sum256(bts)
+	return hex.EncodeToString(hash[:])[:10]
+}
+
+// getDocumentMetadata returns the metadata attached to all the chunks of the document,
+// it can be used to filter the chunks when querying. The sidecar metadata overrides
+// the generated keys.
+func getDocumentMetadata(d *indexerData, crawledAt time.Time) map[string]string {
+	metadata := map[string]string{
+		"crawled_at": crawledAt.UTC().Format(time.DateOnly),
+	}
+
+	documentPath := d.Source
+
+	u, err := url.Parse(d.Source)
+	if err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		metadata["host"] = u.Host
+
+		documentPath = u.Path
+		if documentPath == "" {
+			documentPath = "/"
+		}
+	}
+
+	metadata["path"] = documentPath
+
+	if ext := strings.TrimPrefix(strings.ToLower(path.Ext(documentPath)), "."); ext != "" {
+		metadata["extension"] = ext
+	}
+
+	for k, v := range d.Metadata {
+		metadata[k] = v
+	}
+
+	return metadata
+}
+
+func getMetadataHash(metadata map[string]string) string {
+	if len(metadata) == 0 {
+		return ""
+	}
+
+	// Map keys are sorted when encoded
+	bts, err := json.Marshal(metadata)
+	if err != nil {
+		return ""
+	}
+
+	hash := sha256.Sum256(bts)
+	return hex.EncodeToString(hash[:])[:10]
+}
+
+func getCommit(data []*indexerData) string {
+	for _, d := range data {
+		if d.Commit != "" {
+			return d.Commit
+		}
+	}
+	return ""
+}
+
 // indexerData contains the raw contents of a website, file, etc.
 // This might be a text/html/pdf but it could also be something else
 // for example an sqlite database.
@@ -431,6 +742,25 @@ type indexerData struct {
 	StatusCode      int
 	DurationMs      int64
 	Message         string
+	// Commit is set for the files read from a git repository
+	Commit string
+	// Unchanged is set when the document is identical to the one in the
+	// current version, its chunks are copied instead of re-indexed
+	Unchanged bool
+	// Metadata read from the sidecar file of the document
+	Metadata map[string]string
+	// LastModified is the sitemap lastmod of the page
+	LastModified *time.Time
+	// DocumentID is set for the unchanged pages that were not fetched again,
+	// otherwise it's the hash of the data
+	DocumentID string
+	// SkipReason is set for the documents that are not indexed, for example
+	// the near duplicates of other pages
+	SkipReason  string
+	DuplicateOf string
+	// Fingerprint is the SimHash of the contents, set by the duplicate
+	// detection or kept from the previous crawl for the unchanged pages
+	Fingerprint string
 }
 
 func convertChunksIntoBatches(chunks []*text.DataPrepTextSplitterChunk, batchSize int) [][]*text.DataPrepTextSplitterChunk {
@@ -444,7 +774,7 @@ func convertChunksIntoBatches(chunks []*text.DataPrepTextSplitterChunk, batchSiz
 	return batches
 }
 
-func convertTextSplitterChunks(k *types.Knowledge, version string, chunks []*text.DataPrepTextSplitterChunk) []*types.SessionRAGIndexChunk {
+func convertTextSplitterChunks(k *types.Knowledge, version string, chunks []*text.DataPrepTextSplitterChunk, metadata map[string]map[string]string) []*types.SessionRAGIndexChunk {
 
 	indexChunks := make([]*types.SessionRAGIndexChunk, 0, len(chunks))
 
@@ -457,19 +787,44 @@ func convertTextSplitterChunks(k *types.Knowledge, version string, chunks []*tex
 			DocumentGroupID: chunk.DocumentGroupID,
 			ContentOffset:   chunk.Index,
 			Content:         chunk.Text,
+			Metadata:        getChunkMetadata(chunk, metadata[chunk.DocumentGroupID]),
 		})
 	}
 
 	return indexChunks
 }
 
+// getChunkMetadata adds the section, the symbol and the page of the chunk to the metadata of its document
+func getChunkMetadata(chunk *text.DataPrepTextSplitterChunk, documentMetadata map[string]string) map[string]string {
+	if chunk.Section == "" && chunk.Symbol == "" && chunk.Page == 0 {
+		return documentMetadata
+	}
+
+	metadata := make(map[string]string, len(documentMetadata)+3)
+	for k, v := range documentMetadata {
+		metadata[k] = v
+	}
+
+	if chunk.Section != "" {
+		metadata["section"] = chunk.Section
+	}
+	if chunk.Symbol != "" {
+		metadata["symbol"] = chunk.Symbol
+	}
+	if chunk.Page > 0 {
+		metadata["page"] = strconv.Itoa(chunk.Page)
+	}
+
+	return metadata
+}
+
 func checkContents(data []*indexerData) error {
 	if len(data) == 0 {
 		return fmt.Errorf("couldn't extract any data for indexing, check your data source or configuration")
 	}
 
 	for _, d := range data {
-		if len(d.Data) > 0 {
+		if len(d.Data) > 0 || d.DocumentID != "" {
 			return nil
 		}
 	}
@@ -481,11 +836,24 @@ func getCrawledSources(data []*indexerData) []*types.CrawledURL {
 	var crawledSources []*types.CrawledURL
 
 	for _, d := range data {
+		documentID := d.DocumentID
+		// Skipped pages are not indexed, there's nothing to carry over on refresh
+		if documentID == "" && d.SkipReason == "" {
+			documentID = getDocumentID(d.Data)
+		}
+
 		crawledSources = append(crawledSources, &types.CrawledURL{
 			URL:        d.Source,
 			StatusCode: d.StatusCode,
 			DurationMs: d.DurationMs,
 			Message:    d.Message,
+			DocumentID: documentID,
+			// Sidecar metadata can change without the contents
+			MetadataHash: getMetadataHash(d.Metadata),
+			LastModified: d.LastModified,
+			SkipReason:   d.SkipReason,
+			DuplicateOf:  d.DuplicateOf,
+			Fingerprint:  d.Fingerprint,
 		})
 	}
 
@@ -2,6 +2,7 @@ package knowledge
 
 import (
 	"context"
+	"errors"
 	"reflect"
 	"strings"
 	"testing"
@@ -16,6 +17,7 @@ import (
 	"github.com/helixml/helix/api/pkg/rag"
 	"github.com/helixml/helix/api/pkg/store"
 	"github.com/helixml/helix/api/pkg/types"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"go.uber.org/mock/gomock"
 )
@@ -57,14 +59,14 @@ func (suite *IndexerSuite) SetupTest() {
 
 	b := &browser.Browser{}
 
-	suite.reconciler, err = New(suite.cfg, suite.store, suite.filestore, suite.extractor, suite.rag, b)
+	suite.reconciler, err = New(suite.cfg, suite.store, suite.filestore, suite.extractor, suite.rag, nil, &ragSearcher{rag: suite.rag}, b)
 	suite.Require().NoError(err)
 
 	suite.reconciler.newRagClient = func(_ *types.RAGSettings) rag.RAG {
 		return suite.rag
 	}
 
-	suite.reconciler.newCrawler = func(_ *types.Knowledge) (crawler.Crawler, error) {
+	suite.reconciler.newCrawler = func(_ *types.Knowledge, _ *types.CrawledSources, _ crawler.Checkpointer) (crawler.Crawler, error) {
 		return suite.crawler, nil
 	}
 }
@@ -164,6 +166,9 @@ func (suite *IndexerSuite) TestIndex() {
 		KnowledgeID: knowledge.ID,
 	}).Return([]*types.KnowledgeVersion{}, nil)
 
+	// The crawl checkpoint is deleted once indexed
+	suite.filestore.EXPECT().Delete(gomock.Any(), "knowledge-checkpoints/knowledge_id/").Return(nil)
+
 	// Start indexing
 	err := suite.reconciler.index(suite.ctx)
 	suite.NoError(err)
@@ -378,6 +383,9 @@ func (suite *IndexerSuite) TestIndex_UpdateLimitsWhenAbove() {
 		KnowledgeID: knowledge.ID,
 	}).Return([]*types.KnowledgeVersion{}, nil)
 
+	// Nothing to clean up, deleting a missing checkpoint is not an error
+	suite.filestore.EXPECT().Delete(gomock.Any(), "knowledge-checkpoints/knowledge_id/").Return(nil)
+
 	// Start indexing
 	err := suite.reconciler.index(suite.ctx)
 	suite.NoError(err)
@@ -484,3 +492,265 @@ func Test_convertChunksIntoBatches(t *testing.T) {
 		})
 	}
 }
+
+func (suite *IndexerSuite) Test_copyUnchangedData() {
+	knowledge := &types.Knowledge{
+		ID:      "knowledge_id",
+		Version: "v1",
+	}
+
+	suite.store.EXPECT().ListKnowledgeVersions(gomock.Any(), &store.ListKnowledgeVersionQuery{
+		KnowledgeID: "knowledge_id",
+		State:       types.KnowledgeStateReady,
+	}).Return([]*types.KnowledgeVersion{
+		{
+			KnowledgeID: "knowledge_id",
+			Version:     "v1",
+			CrawledSources: &types.CrawledSources{
+				RAGSettingsHash: getRAGSettingsHash(knowledge),
+			},
+		},
+	}, nil)
+
+	suite.rag.EXPECT().Copy(gomock.Any(), &types.CopyIndexRequest{
+		FromDataEntityID: "knowledge_id-v1",
+		ToDataEntityID:   "knowledge_id-v2",
+		DocumentGroupIDs: []string{"unchanged_group"},
+	}).Return(nil)
+
+	data, err := suite.reconciler.copyUnchangedData(suite.ctx, knowledge, "v2", []*indexerData{
+		{Source: "a.md", DocumentGroupID: "unchanged_group", Unchanged: true},
+		{Source: "b.md", DocumentGroupID: "changed_group"},
+	})
+	suite.Require().NoError(err)
+	suite.Require().Equal(1, len(data))
+	suite.Equal("b.md", data[0].Source)
+}
+
+func (suite *IndexerSuite) Test_copyUnchangedData_SettingsChanged() {
+	knowledge := &types.Knowledge{
+		ID:      "knowledge_id",
+		Version: "v1",
+		RAGSettings: types.RAGSettings{
+			ChunkSize: 1024,
+		},
+	}
+
+	suite.store.EXPECT().ListKnowledgeVersions(gomock.Any(), gomock.Any()).Return([]*types.KnowledgeVersion{
+		{
+			KnowledgeID: "knowledge_id",
+			Version:     "v1",
+			CrawledSources: &types.CrawledSources{
+				RAGSettingsHash: "previous",
+			},
+		},
+	}, nil)
+
+	data, err := suite.reconciler.copyUnchangedData(suite.ctx, knowledge, "v2", []*indexerData{
+		{Source: "a.md", DocumentGroupID: "unchanged_group", Unchanged: true},
+		{Source: "b.md", DocumentGroupID: "changed_group"},
+	})
+	suite.Require().NoError(err)
+	suite.Equal(2, len(data), "all documents should be re-indexed")
+}
+
+func (suite *IndexerSuite) Test_copyUnchangedData_NotSupported() {
+	knowledge := &types.Knowledge{
+		ID:      "knowledge_id",
+		Version: "v1",
+	}
+
+	suite.store.EXPECT().ListKnowledgeVersions(gomock.Any(), gomock.Any()).Return([]*types.KnowledgeVersion{
+		{
+			KnowledgeID: "knowledge_id",
+			Version:     "v1",
+			CrawledSources: &types.CrawledSources{
+				RAGSettingsHash: getRAGSettingsHash(knowledge),
+			},
+		},
+	}, nil)
+
+	suite.rag.EXPECT().Copy(gomock.Any(), gomock.Any()).Return(rag.ErrNotSupported)
+
+	data, err := suite.reconciler.copyUnchangedData(suite.ctx, knowledge, "v2", []*indexerData{
+		{Source: "a.md", DocumentGroupID: "unchanged_group", Unchanged: true},
+		{Source: "b.md", DocumentGroupID: "changed_group"},
+	})
+	suite.Require().NoError(err)
+	suite.Equal(2, len(data), "all documents should be re-indexed")
+}
+
+func (suite *IndexerSuite) Test_copyUnchangedData_CopyFailed() {
+	knowledge := &types.Knowledge{
+		ID:      "knowledge_id",
+		Version: "v1",
+		Source: types.KnowledgeSource{
+			Web: &types.KnowledgeSourceWeb{
+				URLs:    []string{"https://example.com"},
+				Crawler: &types.WebsiteCrawler{Enabled: true},
+			},
+		},
+	}
+
+	suite.store.EXPECT().ListKnowledgeVersions(gomock.Any(), gomock.Any()).Return([]*types.KnowledgeVersion{
+		{
+			KnowledgeID: "knowledge_id",
+			Version:     "v1",
+			CrawledSources: &types.CrawledSources{
+				RAGSettingsHash: getRAGSettingsHash(knowledge),
+			},
+		},
+	}, nil)
+
+	suite.rag.EXPECT().Copy(gomock.Any(), gomock.Any()).Return(errors.New("connection refused"))
+	suite.rag.EXPECT().DeleteDocuments(gomock.Any(), &types.DeleteDocumentsRequest{
+		DataEntityID:     "knowledge_id-v2",
+		DocumentGroupIDs: []string{"unchanged_group"},
+	}).Return(nil)
+
+	// The crawler skipped the unchanged page, it has to be fetched again
+	suite.extractor.EXPECT().Extract(gomock.Any(), &extract.Request{
+		URL: "https://example.com/a",
+	}).Return("page a", nil)
+
+	data, err := suite.reconciler.copyUnchangedData(suite.ctx, knowledge, "v2", []*indexerData{
+		{Source: "https://example.com/a", DocumentGroupID: "unchanged_group", DocumentID: "previous", Unchanged: true},
+		{Source: "https://example.com/b", DocumentGroupID: "changed_group", Data: []byte("page b")},
+	})
+	suite.Require().NoError(err)
+	suite.Require().Equal(2, len(data), "all documents should be re-indexed")
+
+	suite.False(data[0].Unchanged)
+	suite.Equal("page a", string(data[0].Data))
+	suite.Equal("", data[0].DocumentID)
+}
+
+func (suite *IndexerSuite) Test_copyUnchangedData_SecondBatchFailed() {
+	knowledge := &types.Knowledge{
+		ID:      "knowledge_id",
+		Version: "v1",
+		Source: types.KnowledgeSource{
+			Filestore: &types.KnowledgeSourceHelixFilestore{Path: "docs"},
+		},
+	}
+
+	suite.store.EXPECT().ListKnowledgeVersions(gomock.Any(), gomock.Any()).Return([]*types.KnowledgeVersion{
+		{
+			KnowledgeID: "knowledge_id",
+			Version:     "v1",
+			CrawledSources: &types.CrawledSources{
+				RAGSettingsHash: getRAGSettingsHash(knowledge),
+			},
+		},
+	}, nil).Times(2)
+
+	unchanged := []string{"group_a", "group_b"}
+
+	// The first batch landed in the new version before the second one failed,
+	// the copied chunks are deleted before everything is indexed again
+	gomock.InOrder(
+		suite.rag.EXPECT().Copy(gomock.Any(), &types.CopyIndexRequest{
+			FromDataEntityID: "knowledge_id-v1",
+			ToDataEntityID:   "knowledge_id-v2",
+			DocumentGroupIDs: unchanged,
+		}).Return(errors.New("error importing copied documents: batch 2 failed")),
+		suite.rag.EXPECT().DeleteDocuments(gomock.Any(), &types.DeleteDocumentsRequest{
+			DataEntityID:     "knowledge_id-v2",
+			DocumentGroupIDs: unchanged,
+		}).Return(nil),
+	)
+
+	data, err := suite.reconciler.copyUnchangedData(suite.ctx, knowledge, "v2", []*indexerData{
+		{Source: "a.md", DocumentGroupID: "group_a", Data: []byte("a"), Unchanged: true},
+		{Source: "b.md", DocumentGroupID: "group_b", Data: []byte("b"), Unchanged: true},
+	})
+	suite.Require().NoError(err)
+	suite.Require().Equal(2, len(data))
+	suite.False(data[0].Unchanged)
+	suite.False(data[1].Unchanged)
+
+	// If the partial copy can't be cleaned up the version is not indexed
+	suite.rag.EXPECT().Copy(gomock.Any(), gomock.Any()).Return(errors.New("batch 2 failed"))
+	suite.rag.EXPECT().DeleteDocuments(gomock.Any(), gomock.Any()).Return(errors.New("connection refused"))
+
+	_, err = suite.reconciler.copyUnchangedData(suite.ctx, knowledge, "v2", []*indexerData{
+		{Source: "a.md", DocumentGroupID: "group_a", Data: []byte("a"), Unchanged: true},
+	})
+	suite.Require().Error(err)
+	suite.Contains(err.Error(), "failed to delete partially copied documents")
+}
+
+func (suite *IndexerSuite) Test_copyUnchangedData_ContentHash() {
+	knowledge := &types.Knowledge{
+		ID:      "knowledge_id",
+		Version: "v1",
+	}
+
+	suite.store.EXPECT().ListKnowledgeVersions(gomock.Any(), gomock.Any()).Return([]*types.KnowledgeVersion{
+		{
+			KnowledgeID: "knowledge_id",
+			Version:     "v1",
+			CrawledSources: &types.CrawledSources{
+				RAGSettingsHash: getRAGSettingsHash(knowledge),
+				URLs: []*types.CrawledURL{
+					{URL: "https://example.com/a", DocumentID: getDocumentID([]byte("page a"))},
+					{URL: "https://example.com/b", DocumentID: getDocumentID([]byte("page b"))},
+					{URL: "https://example.com/deleted", DocumentID: getDocumentID([]byte("deleted"))},
+				},
+			},
+		},
+	}, nil)
+
+	// Only the unchanged page is carried over, the deleted one is dropped
+	suite.rag.EXPECT().Copy(gomock.Any(), &types.CopyIndexRequest{
+		FromDataEntityID: "knowledge_id-v1",
+		ToDataEntityID:   "knowledge_id-v2",
+		DocumentGroupIDs: []string{getDocumentGroupID("https://example.com/a")},
+	}).Return(nil)
+
+	data, err := suite.reconciler.copyUnchangedData(suite.ctx, knowledge, "v2", []*indexerData{
+		{Source: "https://example.com/a", DocumentGroupID: getDocumentGroupID("https://example.com/a"), Data: []byte("page a")},
+		{Source: "https://example.com/b", DocumentGroupID: getDocumentGroupID("https://example.com/b"), Data: []byte("page b updated")},
+		{Source: "https://example.com/c", DocumentGroupID: getDocumentGroupID("https://example.com/c"), Data: []byte("page c")},
+	})
+	suite.Require().NoError(err)
+	suite.Require().Equal(2, len(data))
+	suite.Equal("https://example.com/b", data[0].Source)
+	suite.Equal("https://example.com/c", data[1].Source)
+}
+
+func Test_getDocumentMetadata(t *testing.T) {
+	crawledAt := time.Date(2024, 3, 15, 23, 30, 0, 0, time.FixedZone("PST", -8*60*60))
+
+	metadata := getDocumentMetadata(&indexerData{
+		Source: "https://docs.example.com/guides/Setup.HTML",
+	}, crawledAt)
+	require.Equal(t, map[string]string{
+		"host":       "docs.example.com",
+		"path":       "/guides/Setup.HTML",
+		"extension":  "html",
+		"crawled_at": "2024-03-16",
+	}, metadata)
+
+	metadata = getDocumentMetadata(&indexerData{
+		Source:   "apps/app_id/reports/q1",
+		Metadata: map[string]string{"team": "sales", "path": "custom"},
+	}, crawledAt)
+	require.Equal(t, map[string]string{
+		"path":       "custom",
+		"team":       "sales",
+		"crawled_at": "2024-03-16",
+	}, metadata)
+}
+
+func Test_getMetadataHash(t *testing.T) {
+	require.Equal(t, "", getMetadataHash(nil))
+	require.Equal(t,
+		getMetadataHash(map[string]string{"a": "1", "b": "2"}),
+		getMetadataHash(map[string]string{"b": "2", "a": "1"}),
+	)
+	require.NotEqual(t,
+		getMetadataHash(map[string]string{"a": "1"}),
+		getMetadataHash(map[string]string{"a": "2"}),
+	)
+}
@@ -0,0 +1,61 @@
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/drone/envsubst"
+
+	"github.com/helixml/helix/api/pkg/store"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+// getSecrets loads the secrets of the knowledge owner. Secrets that are bound
+// to a different app are not available to the knowledge.
+func (r *Reconciler) getSecrets(ctx context.Context, k *types.Knowledge) (map[string]string, error) {
+	secrets, err := r.store.ListSecrets(ctx, &store.ListSecretsQuery{
+		Owner: k.Owner,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+
+	envs := make(map[string]string)
+
+	for _, secret := range secrets {
+		if secret.AppID != "" && secret.AppID != k.AppID {
+			continue
+		}
+		envs[secret.Name] = string(secret.Value)
+	}
+
+	return envs, nil
+}
+
+// evalSecrets substitutes ${SECRET_NAME} references in the value
+// with the secret values, unknown secrets are an error
+func evalSecrets(value string, secrets map[string]string) (string, error) {
+	if !strings.Contains(value, "$") {
+		return value, nil
+	}
+
+	var missing []string
+
+	evaluated, err := envsubst.Eval(value, func(k string) string {
+		secret, ok := secrets[k]
+		if !ok {
+			missing = append(missing, k)
+		}
+		return secret
+	})
+	if err != nil {
+		return "", fmt.Errorf("secret substitution failed: %w", err)
+	}
+
+	if len(missing) > 0 {
+		return "", fmt.Errorf("secret not found: %s", strings.Join(missing, ", "))
+	}
+
+	return evaluated, nil
+}
@@ -1,6 +1,7 @@
 package knowledge
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/helixml/helix/api/pkg/dataprep/text"
@@ -10,7 +11,7 @@ import (
 	"github.com/tmc/langchaingo/textsplitter"
 )
 
-func splitData(k *types.Knowledge, data []*indexerData) ([]*text.DataPrepTextSplitterChunk, error) {
+func splitData(ctx context.Context, k *types.Knowledge, data []*indexerData, embedder text.Embedder) ([]*text.DataPrepTextSplitterChunk, error) {
 	var chunks []*text.DataPrepTextSplitterChunk
 
 	switch k.RAGSettings.TextSplitter {
@@ -34,7 +35,55 @@ func splitData(k *types.Knowledge, data []*indexerData) ([]*text.DataPrepTextSpl
 			}
 		}
 
+		setChunkPages(splitter.Chunks)
+
 		return splitter.Chunks, nil
+	case types.TextSplitterTypeSemantic, types.TextSplitterTypeCode, types.TextSplitterTypeTable:
+		log.Info().
+			Str("knowledge_id", k.ID).
+			Int("chunk_size", k.RAGSettings.ChunkSize).
+			Msgf("splitting data with %s text splitter", k.RAGSettings.TextSplitter)
+
+		if k.RAGSettings.TextSplitter == types.TextSplitterTypeSemantic && embedder == nil {
+			return nil, fmt.Errorf("semantic text splitter requires an embeddings provider, set RAG_SEMANTIC_SPLITTER_PROVIDER")
+		}
+
+		var (
+			semantic = text.NewSemanticSplitter(embedder, k.RAGSettings.ChunkSize)
+			code     = text.NewCodeSplitter(k.RAGSettings.ChunkSize, k.RAGSettings.ChunkOverflow)
+			table    = text.NewTableSplitter(k.RAGSettings.ChunkSize, k.RAGSettings.ChunkOverflow)
+		)
+
+		for _, d := range data {
+			var (
+				parts []text.Part
+				err   error
+			)
+
+			switch k.RAGSettings.TextSplitter {
+			case types.TextSplitterTypeSemantic:
+				parts, err = semantic.Split(ctx, string(d.Data))
+			case types.TextSplitterTypeCode:
+				parts, err = code.Split(d.Source, string(d.Data))
+			case types.TextSplitterTypeTable:
+				parts, err = table.Split(string(d.Data))
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to split %s, error %w", d.Source, err)
+			}
+
+			for idx, part := range parts {
+				chunks = append(chunks, &text.DataPrepTextSplitterChunk{
+					Filename:        d.Source,
+					Index:           idx,
+					Text:            part.Text,
+					DocumentID:      getDocumentID(d.Data),
+					DocumentGroupID: d.DocumentGroupID,
+					Section:         part.Section,
+					Symbol:          part.Symbol,
+				})
+			}
+		}
 	default:
 		log.Info().
 			Str("knowledge_id", k.ID).
@@ -54,6 +103,8 @@ func splitData(k *types.Knowledge, data []*indexerData) ([]*text.DataPrepTextSpl
 				return nil, fmt.Errorf("failed to split %s, error %w", d.Source, err)
 			}
 
+			sections := text.MarkdownSections(parts)
+
 			for idx, part := range parts {
 				chunks = append(chunks, &text.DataPrepTextSplitterChunk{
 					Filename:        d.Source,
@@ -61,10 +112,35 @@ func splitData(k *types.Knowledge, data []*indexerData) ([]*text.DataPrepTextSpl
 					Text:            part,
 					DocumentID:      getDocumentID(d.Data),
 					DocumentGroupID: d.DocumentGroupID,
+					Section:         sections[idx],
 				})
 			}
 		}
 	}
 
+	setChunkPages(chunks)
+
 	return chunks, nil
 }
+
+// setChunkPages sets the pages of the chunks of the paginated documents, the
+// chunks of each document have to be consecutive and in the document order
+func setChunkPages(chunks []*text.DataPrepTextSplitterChunk) {
+	for start := 0; start < len(chunks); {
+		end := start + 1
+		for end < len(chunks) && chunks[end].Filename == chunks[start].Filename {
+			end++
+		}
+
+		parts := make([]string, 0, end-start)
+		for _, chunk := range chunks[start:end] {
+			parts = append(parts, chunk.Text)
+		}
+
+		for idx, page := range text.Pages(parts) {
+			chunks[start+idx].Page = page
+		}
+
+		start = end
+	}
+}
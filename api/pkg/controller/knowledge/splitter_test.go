@@ -1,6 +1,7 @@
 package knowledge
 
 import (
+	"context"
 	"os"
 	"testing"
 
@@ -18,10 +19,10 @@ func TestSplitData_Markdown(t *testing.T) {
 	k.RAGSettings.ChunkOverflow = 20
 	k.RAGSettings.TextSplitter = types.TextSplitterTypeMarkdown
 
-	chunks, err := splitData(k, []*indexerData{{
+	chunks, err := splitData(context.Background(), k, []*indexerData{{
 		Source: "example_code.md",
 		Data:   contents,
-	}})
+	}}, nil)
 	require.NoError(t, err)
 
 	assert.Equal(t, 1, len(chunks))
@@ -29,3 +30,41 @@ func TestSplitData_Markdown(t *testing.T) {
 	assert.Contains(t, chunks[0].Text, "For example if the payload fragment looks like this:")
 	assert.Contains(t, chunks[0].Text, "local encoded_payload, err = json.encode(json_payload)")
 }
+
+func TestSplitData_Pages(t *testing.T) {
+	k := &types.Knowledge{}
+	k.RAGSettings.ChunkSize = 40
+	k.RAGSettings.TextSplitter = types.TextSplitterTypeTable
+
+	chunks, err := splitData(context.Background(), k, []*indexerData{
+		{
+			Source: "report.pdf",
+			Data:   []byte("<!-- page 1 -->\n# Report\n\n<!-- page 2 -->\n## Revenue\n\nRevenue grew by ten percent.\n\n## Costs\n\nCosts stayed flat."),
+		},
+		{
+			Source: "notes.md",
+			Data:   []byte("# Notes\n\nNothing to add."),
+		},
+	}, nil)
+	require.NoError(t, err)
+
+	pages := make([]int, 0, len(chunks))
+	for _, chunk := range chunks {
+		pages = append(pages, chunk.Page)
+	}
+
+	assert.Equal(t, []int{1, 1, 2, 2, 0}, pages)
+	assert.Equal(t, "Report > Costs", chunks[3].Section)
+}
+
+func TestSplitData_SemanticWithoutEmbeddings(t *testing.T) {
+	k := &types.Knowledge{}
+	k.RAGSettings.ChunkSize = 2000
+	k.RAGSettings.TextSplitter = types.TextSplitterTypeSemantic
+
+	_, err := splitData(context.Background(), k, []*indexerData{
+		{Source: "notes.md", Data: []byte("# Notes\n\nNothing to add.")},
+	}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "requires an embeddings provider")
+}
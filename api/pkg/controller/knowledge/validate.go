@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/helixml/helix/api/pkg/config"
+	"github.com/helixml/helix/api/pkg/controller/knowledge/crawler"
 	"github.com/helixml/helix/api/pkg/types"
 
 	"github.com/robfig/cron/v3"
@@ -32,11 +33,54 @@ func Validate(cfg *config.ServerConfig, k *types.AssistantKnowledge) error {
 		}
 	}
 
+	switch k.RAGSettings.TextSplitter {
+	case "", types.TextSplitterTypeMarkdown, types.TextSplitterTypeText,
+		types.TextSplitterTypeSemantic, types.TextSplitterTypeCode, types.TextSplitterTypeTable:
+	default:
+		return fmt.Errorf("unknown text splitter '%s'", k.RAGSettings.TextSplitter)
+	}
+
+	if k.RAGSettings.TextSplitter == types.TextSplitterTypeSemantic {
+		if provider, _ := cfg.RAG.SemanticSplitterEmbeddings(); provider == "" {
+			return fmt.Errorf("semantic text splitter requires an embeddings provider, set RAG_SEMANTIC_SPLITTER_PROVIDER")
+		}
+	}
+
+	if err := ValidateEvalSet(k.EvalSet); err != nil {
+		return err
+	}
+
 	// At least one knowledge source must be specified
-	if k.Source.Web == nil && k.Source.Filestore == nil && k.Source.Content == nil {
+	if k.Source.Web == nil && k.Source.Filestore == nil && k.Source.S3 == nil && k.Source.GCS == nil && k.Source.Git == nil && k.Source.Content == nil {
 		return fmt.Errorf("at least one knowledge source must be specified")
 	}
 
+	if k.Source.S3 != nil && k.Source.S3.Bucket == "" {
+		return fmt.Errorf("s3 bucket is required")
+	}
+
+	if k.Source.S3 != nil && k.Source.S3.AccessKeyID == "" && !cfg.RAG.AmbientCredentials {
+		return fmt.Errorf("s3 access key id and secret access key are required")
+	}
+
+	if k.Source.GCS != nil && k.Source.GCS.Bucket == "" {
+		return fmt.Errorf("gcs bucket is required")
+	}
+
+	if k.Source.GCS != nil && k.Source.GCS.ServiceAccountKey == "" && !cfg.RAG.AmbientCredentials {
+		return fmt.Errorf("gcs service account key is required")
+	}
+
+	if k.Source.Git != nil && k.Source.Git.URL == "" && (k.Source.Git.Owner == "" || k.Source.Git.Repository == "") {
+		return fmt.Errorf("git url or owner and repository are required")
+	}
+
+	if k.Source.Git != nil && k.Source.Git.URL != "" {
+		if err := validateGitURL(k.Source.Git.URL); err != nil {
+			return err
+		}
+	}
+
 	if k.Source.Web != nil {
 		if len(k.Source.Web.URLs) == 0 {
 			return fmt.Errorf("at least one url is required")
@@ -53,12 +97,44 @@ func Validate(cfg *config.ServerConfig, k *types.AssistantKnowledge) error {
 			}
 		}
 
+		if _, err := crawler.CompileURLPatterns(k.Source.Web.Excludes); err != nil {
+			return fmt.Errorf("invalid excludes: %w", err)
+		}
+
+		if _, err := crawler.CompileURLPatterns(k.Source.Web.Includes); err != nil {
+			return fmt.Errorf("invalid includes: %w", err)
+		}
+
+		if login := k.Source.Web.Auth.Login; login != nil {
+			if !strings.HasPrefix(login.URL, "http://") && !strings.HasPrefix(login.URL, "https://") {
+				return fmt.Errorf("login url must start with http:// or https://")
+			}
+
+			for idx, step := range login.Steps {
+				switch step.Action {
+				case types.WebLoginActionFill, types.WebLoginActionClick, types.WebLoginActionWait:
+				default:
+					return fmt.Errorf("login step %d: unknown action '%s'", idx+1, step.Action)
+				}
+
+				if step.Selector == "" {
+					return fmt.Errorf("login step %d: selector is required", idx+1)
+				}
+			}
+		}
+
 		if k.Source.Web.Crawler != nil && k.Source.Web.Crawler.Firecrawl != nil {
 			if k.Source.Web.Crawler.Firecrawl.APIKey == "" {
 				return fmt.Errorf("firecrawl api key is required")
 			}
 		}
 
+		if k.Source.Web.Crawler != nil {
+			if similarity := k.Source.Web.Crawler.DuplicateSimilarity; similarity < 0 || similarity > 1 {
+				return fmt.Errorf("duplicate similarity must be between 0 and 1")
+			}
+		}
+
 		// Checking max depth and max pages
 		if k.Source.Web.Crawler != nil {
 			// If limits are set, we need to ensure they are not exceeded
@@ -71,3 +147,17 @@ func Validate(cfg *config.ServerConfig, k *types.AssistantKnowledge) error {
 
 	return nil
 }
+
+func ValidateEvalSet(evalSet types.KnowledgeEvalSet) error {
+	for idx, c := range evalSet {
+		if strings.TrimSpace(c.Question) == "" {
+			return fmt.Errorf("eval case %d: question is required", idx+1)
+		}
+
+		if len(c.ExpectedSources) == 0 {
+			return fmt.Errorf("eval case %d: at least one expected source is required", idx+1)
+		}
+	}
+
+	return nil
+}
@@ -149,6 +149,215 @@ func TestValidate(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "Valid include patterns",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				Source: types.KnowledgeSource{
+					Web: &types.KnowledgeSourceWeb{
+						URLs:     []string{"https://docs.example.com"},
+						Includes: []string{"glob:https://docs.example.com/guides/**", "/api/v[0-9]+/"},
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "Invalid include pattern",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				Source: types.KnowledgeSource{
+					Web: &types.KnowledgeSourceWeb{
+						URLs:     []string{"https://docs.example.com"},
+						Includes: []string{"/guides/(unclosed"},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Invalid duplicate similarity",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				Source: types.KnowledgeSource{
+					Web: &types.KnowledgeSourceWeb{
+						URLs: []string{"https://docs.example.com"},
+						Crawler: &types.WebsiteCrawler{
+							Enabled:             true,
+							DuplicateSimilarity: 1.5,
+						},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Valid login steps",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				Source: types.KnowledgeSource{
+					Web: &types.KnowledgeSourceWeb{
+						URLs: []string{"https://wiki.example.com"},
+						Auth: types.KnowledgeSourceWebAuth{
+							Login: &types.KnowledgeSourceWebLogin{
+								URL: "https://wiki.example.com/login",
+								Steps: []*types.KnowledgeSourceWebLoginStep{
+									{Action: types.WebLoginActionFill, Selector: "#username", Value: "${username}"},
+									{Action: types.WebLoginActionClick, Selector: "button[type=submit]"},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "Invalid login step action",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				Source: types.KnowledgeSource{
+					Web: &types.KnowledgeSourceWeb{
+						URLs: []string{"https://wiki.example.com"},
+						Auth: types.KnowledgeSourceWebAuth{
+							Login: &types.KnowledgeSourceWebLogin{
+								URL: "https://wiki.example.com/login",
+								Steps: []*types.KnowledgeSourceWebLoginStep{
+									{Action: "type", Selector: "#username"},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Valid S3 bucket",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				Source: types.KnowledgeSource{
+					S3: &types.KnowledgeSourceS3{
+						Bucket:          "runbooks",
+						Path:            "docs/",
+						AccessKeyID:     "${AWS_ACCESS_KEY_ID}",
+						SecretAccessKey: "${AWS_SECRET_ACCESS_KEY}",
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "S3 without credentials",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				Source: types.KnowledgeSource{
+					S3: &types.KnowledgeSourceS3{
+						Bucket: "runbooks",
+						Path:   "docs/",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Missing S3 bucket",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				Source: types.KnowledgeSource{
+					S3: &types.KnowledgeSourceS3{
+						Path: "docs/",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Valid GCS bucket",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				Source: types.KnowledgeSource{
+					GCS: &types.KnowledgeSourceGCS{
+						Bucket:            "handbook",
+						ServiceAccountKey: "${GCS_KEY}",
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "GCS without service account key",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				Source: types.KnowledgeSource{
+					GCS: &types.KnowledgeSourceGCS{
+						Bucket: "handbook",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Missing GCS bucket",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				Source: types.KnowledgeSource{
+					GCS: &types.KnowledgeSourceGCS{
+						Path: "hr/",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Valid git URL",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				Source: types.KnowledgeSource{
+					Git: &types.KnowledgeSourceGithub{
+						URL: "git@github.com:helixml/helix.git",
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "Local git path",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				Source: types.KnowledgeSource{
+					Git: &types.KnowledgeSourceGithub{
+						URL: "file:///var/lib/helix",
+					},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Valid git owner and repository",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				Source: types.KnowledgeSource{
+					Git: &types.KnowledgeSourceGithub{
+						Owner:      "helixml",
+						Repository: "helix",
+					},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "Missing git repository",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				Source: types.KnowledgeSource{
+					Git: &types.KnowledgeSourceGithub{
+						Owner: "helixml",
+					},
+				},
+			},
+			expectError: true,
+		},
 		{
 			name: "Valid content",
 			knowledge: &types.AssistantKnowledge{
@@ -159,6 +368,71 @@ func TestValidate(t *testing.T) {
 			},
 			expectError: false,
 		},
+		{
+			name: "Valid code text splitter",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				RAGSettings: types.RAGSettings{
+					TextSplitter: types.TextSplitterTypeCode,
+				},
+				Source: types.KnowledgeSource{
+					Content: &basicContent,
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "Unknown text splitter",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				RAGSettings: types.RAGSettings{
+					TextSplitter: "sentences",
+				},
+				Source: types.KnowledgeSource{
+					Content: &basicContent,
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Semantic text splitter without embeddings",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				RAGSettings: types.RAGSettings{
+					TextSplitter: types.TextSplitterTypeSemantic,
+				},
+				Source: types.KnowledgeSource{
+					Content: &basicContent,
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "Valid eval set",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				Source: types.KnowledgeSource{
+					Content: &basicContent,
+				},
+				EvalSet: types.KnowledgeEvalSet{
+					{Question: "How do I install it?", ExpectedSources: []string{"docs/install.md"}},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "Eval case without expected sources",
+			knowledge: &types.AssistantKnowledge{
+				Name: "Test",
+				Source: types.KnowledgeSource{
+					Content: &basicContent,
+				},
+				EvalSet: types.KnowledgeEvalSet{
+					{Question: "How do I install it?"},
+				},
+			},
+			expectError: true,
+		},
 	}
 
 	serverConfig := config.ServerConfig{}
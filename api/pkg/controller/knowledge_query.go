@@ -0,0 +1,304 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/sourcegraph/conc/pool"
+
+	"github.com/helixml/helix/api/pkg/prompts"
+	"github.com/helixml/helix/api/pkg/rag"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+const (
+	// Number of previous messages given to the model when rewriting the query
+	queryRewriteHistoryLength = 10
+	// Messages are truncated in the history, long answers rarely matter for the query
+	queryRewriteMaxMessageLength = 1000
+)
+
+// QueryKnowledge searches the knowledge for the chunks relevant to the queries. The results
+// of multiple queries are fused with reciprocal rank fusion. If reranking is enabled, a larger
+// candidate set is retrieved and rescored with the rerank model against the first query,
+// keeping the best results_count. Only the chunks matching all the metadata filters are returned.
+func (c *Controller) QueryKnowledge(ctx context.Context, knowledge *types.Knowledge, filters []*types.RAGFilter, queries ...string) ([]*types.SessionRAGResult, error) {
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("no query provided")
+	}
+
+	ragClient, err := c.GetRagClient(ctx, knowledge)
+	if err != nil {
+		return nil, fmt.Errorf("error getting RAG client: %w", err)
+	}
+
+	settings := knowledge.RAGSettings
+
+	maxResults := settings.ResultsCount
+	if settings.Rerank.Enabled {
+		maxResults = rag.GetRerankCandidatesCount(&settings)
+	}
+
+	resultSets := make([][]*types.SessionRAGResult, len(queries))
+
+	p := pool.New().WithErrors()
+	for idx, query := range queries {
+		p.Go(func() error {
+			ragResults, err := ragClient.Query(ctx, &types.SessionRAGQuery{
+				Prompt:            query,
+				DataEntityID:      knowledge.GetDataEntityID(),
+				DistanceThreshold: settings.Threshold,
+				DistanceFunction:  settings.DistanceFunction,
+				MaxResults:        maxResults,
+				Filters:           filters,
+			})
+			if err != nil {
+				return fmt.Errorf("error querying RAG: %w", err)
+			}
+			resultSets[idx] = ragResults
+			return nil
+		})
+	}
+
+	err = p.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	ragResults := resultSets[0]
+	if len(resultSets) > 1 {
+		ragResults = rag.ReciprocalRankFusion(resultSets...)
+	}
+
+	if settings.Rerank.Enabled {
+		reranked, err := c.rerank(ctx, knowledge, queries[0], ragResults)
+		if err != nil {
+			// Reranking is an optional improvement, fall back to the retrieval order
+			log.Warn().
+				Err(err).
+				Str("knowledge_id", knowledge.ID).
+				Msg("failed to rerank knowledge results, using the retrieval order")
+		} else {
+			ragResults = reranked
+		}
+	}
+
+	if settings.Rerank.Enabled || len(resultSets) > 1 {
+		resultsCount := settings.ResultsCount
+		if resultsCount == 0 {
+			resultsCount = rag.DefaultMaxResults
+		}
+
+		if len(ragResults) > resultsCount {
+			ragResults = ragResults[:resultsCount]
+		}
+	}
+
+	return ragResults, nil
+}
+
+// SearchKnowledge runs a single question against the knowledge the same way as the chat does,
+// with the query rewrite, the fusion of the queries and the reranking of the knowledge settings.
+// There is no chat request, the rewrite uses its own model and defaults to the inference provider.
+func (c *Controller) SearchKnowledge(ctx context.Context, knowledge *types.Knowledge, question string) ([]*types.SessionRAGResult, error) {
+	queries := []string{question}
+
+	if knowledge.RAGSettings.QueryRewrite.Enabled {
+		req := openai.ChatCompletionRequest{
+			Model: knowledge.RAGSettings.QueryRewrite.Model,
+			Messages: []openai.ChatCompletionMessage{
+				{
+					Role:    openai.ChatMessageRoleUser,
+					Content: question,
+				},
+			},
+		}
+
+		queries = c.rewriteQuery(ctx, req, knowledge, &ChatCompletionOptions{}, make(map[types.RAGQueryRewriteSettings][]string))
+	}
+
+	return c.QueryKnowledge(ctx, knowledge, nil, queries...)
+}
+
+func (c *Controller) rerank(ctx context.Context, knowledge *types.Knowledge, prompt string, results []*types.SessionRAGResult) ([]*types.SessionRAGResult, error) {
+	settings := knowledge.RAGSettings.Rerank
+	if settings.Provider == "" {
+		settings.Provider = c.Options.Config.Inference.Provider
+	}
+
+	reranker, err := rag.NewReranker(c.Options.ProviderManager, &settings)
+	if err != nil {
+		return nil, err
+	}
+
+	return reranker.Rerank(ctx, prompt, results)
+}
+
+// rewriteQuery turns the last user message into standalone search queries using the
+// conversation history. The queries are cached by the rewrite settings, on failure
+// the last message is used as is.
+func (c *Controller) rewriteQuery(
+	ctx context.Context,
+	req openai.ChatCompletionRequest,
+	knowledge *types.Knowledge,
+	opts *ChatCompletionOptions,
+	cache map[types.RAGQueryRewriteSettings][]string) []string {
+	settings := knowledge.RAGSettings.QueryRewrite
+	prompt := getLastMessage(req)
+
+	if queries, ok := cache[settings]; ok {
+		return queries
+	}
+
+	history := getQueryRewriteHistory(req)
+
+	// Nothing to resolve or expand
+	if len(history) == 0 && settings.SubQueries == 0 {
+		return []string{prompt}
+	}
+
+	if err := c.emitStepInfo(ctx, &types.StepInfo{
+		Name:    knowledge.Name,
+		Type:    types.StepInfoTypeRAG,
+		Message: "Rewriting the search query",
+	}); err != nil {
+		log.Debug().Err(err).Msg("failed to emit step info")
+	}
+
+	queries, err := c.generateQueries(ctx, req, settings, opts, history)
+	if err != nil {
+		log.Warn().
+			Err(err).
+			Str("knowledge_id", knowledge.ID).
+			Msg("failed to rewrite the search query, using the last message")
+		queries = []string{prompt}
+	} else if err := c.emitStepInfo(ctx, &types.StepInfo{
+		Name:    knowledge.Name,
+		Type:    types.StepInfoTypeRAG,
+		Message: fmt.Sprintf("Searching for: %s", strings.Join(queries, "; ")),
+	}); err != nil {
+		log.Debug().Err(err).Msg("failed to emit step info")
+	}
+
+	cache[settings] = queries
+
+	return queries
+}
+
+func (c *Controller) generateQueries(
+	ctx context.Context,
+	req openai.ChatCompletionRequest,
+	settings types.RAGQueryRewriteSettings,
+	opts *ChatCompletionOptions,
+	history []string) ([]string, error) {
+	provider := settings.Provider
+	if provider == "" {
+		provider = opts.Provider
+	}
+
+	model := settings.Model
+	if model == "" {
+		model = req.Model
+	}
+
+	client, err := c.getClient(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := prompts.QueryRewritePrompt(&prompts.QueryRewritePromptRequest{
+		History:    history,
+		Question:   getLastMessage(req),
+		SubQueries: settings.SubQueries,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to build the query rewrite prompt: %w", err)
+	}
+
+	resp, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: content,
+			},
+		},
+		Temperature: 0,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewrite the query: %w", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from the query rewrite model")
+	}
+
+	queries := parseRewrittenQueries(resp.Choices[0].Message.Content, settings.SubQueries+1)
+	if len(queries) == 0 {
+		return nil, fmt.Errorf("query rewrite model returned no queries")
+	}
+
+	return queries, nil
+}
+
+// getQueryRewriteHistory returns the conversation before the last message, without
+// the system prompt
+func getQueryRewriteHistory(req openai.ChatCompletionRequest) []string {
+	if len(req.Messages) < 2 {
+		return nil
+	}
+
+	var history []string
+
+	for _, m := range req.Messages[:len(req.Messages)-1] {
+		if m.Role == openai.ChatMessageRoleSystem || m.Content == "" {
+			continue
+		}
+
+		content := m.Content
+		if len(content) > queryRewriteMaxMessageLength {
+			content = content[:queryRewriteMaxMessageLength] + "..."
+		}
+
+		history = append(history, fmt.Sprintf("%s: %s", m.Role, content))
+	}
+
+	if len(history) > queryRewriteHistoryLength {
+		history = history[len(history)-queryRewriteHistoryLength:]
+	}
+
+	return history
+}
+
+var queryListMarker = regexp.MustCompile(`^(\d+[.)]|[-*•])\s*`)
+
+// parseRewrittenQueries reads one query per line, ignoring list markers,
+// quotes and duplicates
+func parseRewrittenQueries(answer string, maxQueries int) []string {
+	var (
+		queries []string
+		seen    = make(map[string]bool)
+	)
+
+	for _, line := range strings.Split(answer, "\n") {
+		query := strings.TrimSpace(line)
+		query = queryListMarker.ReplaceAllString(query, "")
+		query = strings.Trim(query, "\"'` ")
+
+		if query == "" || seen[strings.ToLower(query)] {
+			continue
+		}
+		seen[strings.ToLower(query)] = true
+
+		queries = append(queries, query)
+		if len(queries) == maxQueries {
+			break
+		}
+	}
+
+	return queries
+}
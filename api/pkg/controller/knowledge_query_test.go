@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseRewrittenQueries(t *testing.T) {
+	queries := parseRewrittenQueries("1. \"H100 specifications\"\n\n- H100 memory\n* h100 MEMORY\n2) H100 pricing", 2)
+	require.Equal(t, []string{"H100 specifications", "H100 memory"}, queries)
+
+	require.Empty(t, parseRewrittenQueries("\n  \n", 3))
+}
+
+func Test_getQueryRewriteHistory(t *testing.T) {
+	req := openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "system prompt"},
+			{Role: openai.ChatMessageRoleUser, Content: "first question"},
+			{Role: openai.ChatMessageRoleAssistant, Content: strings.Repeat("a", queryRewriteMaxMessageLength+10)},
+			{Role: openai.ChatMessageRoleUser, Content: "last question"},
+		},
+	}
+
+	history := getQueryRewriteHistory(req)
+	require.Len(t, history, 2)
+	require.Equal(t, "user: first question", history[0])
+	require.Equal(t, "assistant: "+strings.Repeat("a", queryRewriteMaxMessageLength)+"...", history[1])
+
+	require.Empty(t, getQueryRewriteHistory(openai.ChatCompletionRequest{
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleUser, Content: "only question"},
+		},
+	}))
+}
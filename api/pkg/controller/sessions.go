@@ -661,26 +661,31 @@ func (c *Controller) checkForActions(session *types.Session) (*types.Session, er
 		return session, nil
 	}
 
+	actions := isActionable.Actions()
+
 	log.Info().
-		Str("api", isActionable.API).
+		Strs("apis", actions).
 		Str("actionable", isActionable.NeedsTool).
 		Str("justification", isActionable.Justification).
 		Str("history", fmt.Sprintf("%+v", messageHistory)).
 		Msg("checked for actionable")
 
-	if !isActionable.Actionable() {
+	if !isActionable.Actionable() || len(actions) == 0 {
 		return session, nil
 	}
 
+	// Session interactions run a single action
+	action := actions[0]
+
 	lastInteraction.Mode = types.SessionModeAction
 
 	lastInteraction.Mode = types.SessionModeAction
-	lastInteraction.Metadata["tool_action"] = isActionable.API
+	lastInteraction.Metadata["tool_action"] = action
 	lastInteraction.Metadata["tool_action_justification"] = isActionable.Justification
 
-	actionTool, ok := tools.GetToolFromAction(activeTools, isActionable.API)
+	actionTool, ok := tools.GetToolFromAction(activeTools, action)
 	if !ok {
-		return nil, fmt.Errorf("tool not found for action: %s", isActionable.API)
+		return nil, fmt.Errorf("tool not found for action: %s", action)
 	}
 
 	lastInteraction.Metadata["tool_id"] = actionTool.ID
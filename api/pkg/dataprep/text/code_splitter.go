@@ -0,0 +1,636 @@
+package text
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+type codeLanguage string
+
+const (
+	codeLanguageGo     codeLanguage = "go"
+	codeLanguagePython codeLanguage = "python"
+	// Languages with C like syntax, the blocks are delimited by braces
+	codeLanguageBraces codeLanguage = "braces"
+)
+
+var codeExtensions = map[string]codeLanguage{
+	".go":    codeLanguageGo,
+	".py":    codeLanguagePython,
+	".pyi":   codeLanguagePython,
+	".ts":    codeLanguageBraces,
+	".tsx":   codeLanguageBraces,
+	".mts":   codeLanguageBraces,
+	".cts":   codeLanguageBraces,
+	".js":    codeLanguageBraces,
+	".jsx":   codeLanguageBraces,
+	".mjs":   codeLanguageBraces,
+	".cjs":   codeLanguageBraces,
+	".java":  codeLanguageBraces,
+	".kt":    codeLanguageBraces,
+	".kts":   codeLanguageBraces,
+	".scala": codeLanguageBraces,
+	".c":     codeLanguageBraces,
+	".h":     codeLanguageBraces,
+	".cc":    codeLanguageBraces,
+	".cpp":   codeLanguageBraces,
+	".hpp":   codeLanguageBraces,
+	".cs":    codeLanguageBraces,
+	".rs":    codeLanguageBraces,
+	".swift": codeLanguageBraces,
+	".php":   codeLanguageBraces,
+	".dart":  codeLanguageBraces,
+}
+
+// CodeSplitter chunks the source files by their functions, methods and types, each chunk
+// records the symbol it belongs to. Declarations larger than the chunk size are split
+// by their methods (for classes) or by lines. Files that are not source code are split
+// with the markdown splitter.
+type CodeSplitter struct {
+	chunkSize int
+	markdown  *MarkdownSplitter
+}
+
+func NewCodeSplitter(chunkSize, chunkOverflow int) *CodeSplitter {
+	return &CodeSplitter{
+		chunkSize: chunkSize,
+		markdown:  NewMarkdownSplitter(chunkSize, chunkOverflow),
+	}
+}
+
+// IsCode returns true if the code splitter recognizes the language of the file,
+// the filename can also be a URL
+func IsCode(filename string) bool {
+	return getCodeLanguage(filename) != ""
+}
+
+func getCodeLanguage(filename string) codeLanguage {
+	if u, err := url.Parse(filename); err == nil && u.Scheme != "" {
+		filename = u.Path
+	}
+	return codeExtensions[strings.ToLower(path.Ext(filename))]
+}
+
+// codeSegment is a range of lines of the source file, from start up to end exclusive
+type codeSegment struct {
+	symbol   string
+	start    int
+	end      int
+	children []*codeSegment
+}
+
+func (s *CodeSplitter) Split(filename, text string) ([]Part, error) {
+	lines := strings.Split(text, "\n")
+
+	var segments []*codeSegment
+
+	switch getCodeLanguage(filename) {
+	case codeLanguageGo:
+		var ok bool
+		segments, ok = goSegments(text, lines)
+		if !ok {
+			// Doesn't compile, braces are good enough
+			segments = braceSegments(lines)
+		}
+	case codeLanguagePython:
+		segments = indentSegments(lines, 0, len(lines), "")
+	case codeLanguageBraces:
+		segments = braceSegments(lines)
+	default:
+		return s.splitMarkdown(text)
+	}
+
+	var parts []Part
+	for _, segment := range segments {
+		parts = append(parts, s.segmentParts(lines, segment, "")...)
+	}
+
+	return mergeSmallParts(parts, s.chunkSize), nil
+}
+
+func (s *CodeSplitter) splitMarkdown(text string) ([]Part, error) {
+	texts, err := s.markdown.SplitText(text)
+	if err != nil {
+		return nil, err
+	}
+
+	sections := MarkdownSections(texts)
+
+	parts := make([]Part, 0, len(texts))
+	for idx, t := range texts {
+		parts = append(parts, Part{
+			Text:    t,
+			Section: sections[idx],
+		})
+	}
+	return parts, nil
+}
+
+// segmentParts returns the segment as a single part if it fits, otherwise it's split by
+// its children or by lines. Methods are named after their class, "Class.method".
+func (s *CodeSplitter) segmentParts(lines []string, segment *codeSegment, parent string) []Part {
+	symbol := segment.symbol
+	if parent != "" {
+		symbol = parent
+		if segment.symbol != "" {
+			symbol = parent + "." + segment.symbol
+		}
+	}
+
+	// Blank lines around the declarations are dropped, the indentation is kept
+	text := strings.TrimRight(strings.Join(lines[segment.start:segment.end], "\n"), " \t\n")
+	text = strings.TrimLeft(text, "\n")
+	if text == "" {
+		return nil
+	}
+
+	if len(text) <= s.chunkSize {
+		return []Part{{Text: text, Symbol: symbol}}
+	}
+
+	if len(segment.children) > 0 {
+		var parts []Part
+
+		// The lines around the children, for example the fields of the class,
+		// belong to the class itself
+		start := segment.start
+		for _, child := range segment.children {
+			parts = append(parts, s.segmentParts(lines, &codeSegment{symbol: "", start: start, end: child.start}, symbol)...)
+			parts = append(parts, s.segmentParts(lines, child, symbol)...)
+			start = child.end
+		}
+		parts = append(parts, s.segmentParts(lines, &codeSegment{symbol: "", start: start, end: segment.end}, symbol)...)
+
+		return parts
+	}
+
+	var parts []Part
+	for _, t := range splitLines(text, s.chunkSize) {
+		parts = append(parts, Part{Text: t, Symbol: symbol})
+	}
+	return parts
+}
+
+// mergeSmallParts joins the neighbouring parts that are too small to be useful on their
+// own: the leftovers such as the closing brace of a class, the consecutive lines that are
+// not declarations (package clause and imports) and the runs of short declarations
+func mergeSmallParts(parts []Part, chunkSize int) []Part {
+	var merged []Part
+
+	for _, part := range parts {
+		if len(merged) > 0 {
+			last := &merged[len(merged)-1]
+			fits := len(last.Text)+2+len(part.Text) <= chunkSize
+
+			leftover := len(strings.TrimSpace(part.Text)) < 16 && strings.HasPrefix(last.Symbol, part.Symbol)
+			undeclared := last.Symbol == "" && part.Symbol == ""
+			short := last.Symbol != "" && part.Symbol != "" && len(last.Text) < chunkSize/8 && len(part.Text) < chunkSize/8
+
+			if fits && (leftover || undeclared || short) {
+				separator := "\n\n"
+				if leftover && !undeclared {
+					separator = "\n"
+				}
+
+				last.Text += separator + part.Text
+				last.Symbol = joinSymbols(last.Symbol, part.Symbol)
+				continue
+			}
+		}
+		merged = append(merged, part)
+	}
+
+	return merged
+}
+
+// joinSymbols names the merged parts, the class declaration followed by
+// its first method is named after the method
+func joinSymbols(a, b string) string {
+	switch {
+	case a == "" || strings.HasPrefix(b, a+"."):
+		return b
+	case b == "" || strings.HasPrefix(a, b):
+		return a
+	default:
+		return a + ", " + b
+	}
+}
+
+// goSegments uses the Go parser to find the declarations, methods are named after their receiver
+func goSegments(text string, lines []string) ([]*codeSegment, bool) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", text, parser.ParseComments)
+	if err != nil {
+		return nil, false
+	}
+
+	var (
+		segments []*codeSegment
+		previous = 0
+	)
+
+	for _, decl := range file.Decls {
+		pos := decl.Pos()
+		symbol := ""
+
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Doc != nil {
+				pos = d.Doc.Pos()
+			}
+			symbol = d.Name.Name
+			if d.Recv != nil && len(d.Recv.List) > 0 {
+				if receiver := goReceiverName(d.Recv.List[0].Type); receiver != "" {
+					symbol = receiver + "." + symbol
+				}
+			}
+		case *ast.GenDecl:
+			if d.Doc != nil {
+				pos = d.Doc.Pos()
+			}
+			symbol = goGenDeclName(d)
+		}
+
+		start := fset.Position(pos).Line - 1
+		end := fset.Position(decl.End()).Line
+
+		// Package clause, imports and the comments between the declarations
+		if start > previous {
+			segments = append(segments, &codeSegment{start: previous, end: start})
+		}
+
+		segments = append(segments, &codeSegment{symbol: symbol, start: start, end: end})
+		previous = end
+	}
+
+	if previous < len(lines) {
+		segments = append(segments, &codeSegment{start: previous, end: len(lines)})
+	}
+
+	return segments, true
+}
+
+func goReceiverName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.StarExpr:
+		return goReceiverName(t.X)
+	case *ast.IndexExpr:
+		return goReceiverName(t.X)
+	case *ast.IndexListExpr:
+		return goReceiverName(t.X)
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
+
+func goGenDeclName(d *ast.GenDecl) string {
+	var names []string
+
+	for _, spec := range d.Specs {
+		switch s := spec.(type) {
+		case *ast.TypeSpec:
+			names = append(names, s.Name.Name)
+		case *ast.ValueSpec:
+			for _, name := range s.Names {
+				names = append(names, name.Name)
+			}
+		}
+	}
+
+	return strings.Join(names, ", ")
+}
+
+var pythonDeclRegexp = regexp.MustCompile(`^(?:async\s+)?(?:def|class)\s+([A-Za-z_]\w*)`)
+
+// indentSegments splits the lines of an indentation based language (Python) at the
+// declarations of the given indentation, classes get their methods as children
+func indentSegments(lines []string, from, to int, indent string) []*codeSegment {
+	var (
+		segments []*codeSegment
+		current  = &codeSegment{start: from}
+	)
+
+	startSegment := func(i int, symbol string) {
+		// Decorators and comments right above belong to the declaration
+		start := i
+		for start > current.start {
+			previous := strings.TrimSpace(lines[start-1])
+			if !strings.HasPrefix(previous, "@") && !strings.HasPrefix(previous, "#") {
+				break
+			}
+			start--
+		}
+
+		current.end = start
+		if current.end > current.start {
+			segments = append(segments, current)
+		}
+		current = &codeSegment{symbol: symbol, start: start}
+	}
+
+	for i := from; i < to; i++ {
+		line := lines[i]
+		if strings.TrimSpace(line) == "" || !strings.HasPrefix(line, indent) {
+			continue
+		}
+
+		rest := line[len(indent):]
+		if rest == "" || rest[0] == ' ' || rest[0] == '\t' {
+			// Body of the current declaration
+			continue
+		}
+
+		if match := pythonDeclRegexp.FindStringSubmatch(rest); match != nil {
+			startSegment(i, match[1])
+			continue
+		}
+
+		// Statements after a declaration don't belong to it
+		if current.symbol != "" && !strings.HasPrefix(rest, "@") && !strings.HasPrefix(rest, "#") && !strings.HasPrefix(rest, ")") {
+			startSegment(i, "")
+		}
+	}
+
+	current.end = to
+	segments = append(segments, current)
+
+	for _, segment := range segments {
+		if segment.symbol == "" || !isPythonClass(lines, segment) {
+			continue
+		}
+
+		bodyIndent := pythonBodyIndent(lines, segment)
+		if bodyIndent != "" {
+			children := indentSegments(lines, segment.start, segment.end, bodyIndent)
+			for _, child := range children {
+				if child.symbol != "" {
+					segment.children = append(segment.children, child)
+				}
+			}
+		}
+	}
+
+	return segments
+}
+
+func isPythonClass(lines []string, segment *codeSegment) bool {
+	for i := segment.start; i < segment.end; i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, "@") || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		return strings.HasPrefix(trimmed, "class ")
+	}
+	return false
+}
+
+// pythonBodyIndent returns the indentation of the first statement in the class body
+func pythonBodyIndent(lines []string, segment *codeSegment) string {
+	declIndent := -1
+
+	for i := segment.start; i < segment.end; i++ {
+		line := lines[i]
+		trimmed := strings.TrimLeft(line, " \t")
+		if trimmed == "" {
+			continue
+		}
+
+		indent := line[:len(line)-len(trimmed)]
+		if declIndent < 0 {
+			if strings.HasPrefix(trimmed, "class ") {
+				declIndent = len(indent)
+			}
+			continue
+		}
+
+		if len(indent) > declIndent {
+			return indent
+		}
+	}
+
+	return ""
+}
+
+var (
+	// Modifiers that can precede the declarations
+	braceModifiers = `(?:(?:export|default|declare|public|private|protected|internal|static|final|abstract|sealed|open|override|virtual|async|unsafe|extern|inline|data|partial|readonly|pub(?:\([^)]*\))?)\s+)*`
+	// Declarations starting with a keyword, the name follows the keyword
+	braceKeywordDeclRegexp = regexp.MustCompile(`^` + braceModifiers + `(?:function\*?|class|interface|enum|struct|trait|fn|fun|func|type|namespace|module|record|object|protocol|extension|union)\s+([A-Za-z_$][\w$]*)`)
+	// Rust implementation blocks, named after the type
+	braceImplRegexp = regexp.MustCompile(`^` + braceModifiers + `impl(?:<[^>]*>)?\s+([\w:]+)(?:<[^>]*>)?(?:\s+for\s+([\w:]+))?`)
+	// JavaScript variables such as the arrow functions
+	braceVariableRegexp = regexp.MustCompile(`^` + braceModifiers + `(?:const|let|var)\s+([A-Za-z_$][\w$]*)\s*(?::[^=]+)?=`)
+	// Functions and methods declared with their return type or without a keyword,
+	// the name is the identifier before the parameters
+	braceFunctionRegexp = regexp.MustCompile(`^` + braceModifiers + `(?:get\s+|set\s+|\*\s*)?(?:[\w<>\[\],.*&:~?]+\s+)*?([A-Za-z_$~][\w$]*)\s*(?:<[^>()]*>)?\s*\([^;]*$`)
+	// Blocks that group the methods
+	braceContainerRegexp = regexp.MustCompile(`\b(?:class|interface|struct|trait|impl|object|enum|namespace|module|extension|protocol)\b`)
+)
+
+var braceControlKeywords = map[string]bool{
+	"if": true, "for": true, "while": true, "switch": true, "catch": true, "return": true,
+	"new": true, "else": true, "do": true, "try": true, "throw": true, "using": true, "lock": true,
+	"foreach": true, "synchronized": true, "match": true, "loop": true, "sizeof": true,
+}
+
+// braceDeclarationName returns the name declared on the line, if any
+func braceDeclarationName(line string) string {
+	if match := braceImplRegexp.FindStringSubmatch(line); match != nil {
+		if match[2] != "" {
+			return match[2]
+		}
+		return match[1]
+	}
+
+	for _, re := range []*regexp.Regexp{braceKeywordDeclRegexp, braceVariableRegexp, braceFunctionRegexp} {
+		if match := re.FindStringSubmatch(line); match != nil && !braceControlKeywords[match[1]] {
+			return match[1]
+		}
+	}
+
+	return ""
+}
+
+// braceDepths returns the nesting depth of the brackets at the start of each line,
+// brackets in the strings and comments are ignored
+func braceDepths(lines []string) []int {
+	depths := make([]int, len(lines)+1)
+
+	var (
+		depth        int
+		inComment    bool
+		stringQuote  byte
+		templateText bool
+	)
+
+	for i, line := range lines {
+		depths[i] = depth
+
+		for j := 0; j < len(line); j++ {
+			c := line[j]
+
+			switch {
+			case inComment:
+				if c == '*' && j+1 < len(line) && line[j+1] == '/' {
+					inComment = false
+					j++
+				}
+			case stringQuote != 0:
+				if c == '\\' {
+					j++
+				} else if c == stringQuote {
+					stringQuote = 0
+					templateText = false
+				}
+			case c == '/' && j+1 < len(line) && line[j+1] == '/':
+				j = len(line)
+			case c == '/' && j+1 < len(line) && line[j+1] == '*':
+				inComment = true
+				j++
+			case c == '"' || c == '\'' || c == '`':
+				// Rust lifetimes and chars like 'a' are not strings spanning lines
+				if c == '\'' && !strings.Contains(line[j+1:], "'") {
+					continue
+				}
+				stringQuote = c
+				templateText = c == '`'
+			case c == '{' || c == '(' || c == '[':
+				depth++
+			case c == '}' || c == ')' || c == ']':
+				if depth > 0 {
+					depth--
+				}
+			}
+		}
+
+		// Only the template literals and block comments span multiple lines
+		if stringQuote != 0 && !templateText {
+			stringQuote = 0
+		}
+	}
+
+	depths[len(lines)] = depth
+	return depths
+}
+
+func braceSegments(lines []string) []*codeSegment {
+	return braceSegmentsWithDepths(lines, braceDepths(lines), 0, len(lines), 0)
+}
+
+// braceSegmentsWithDepths splits the lines at the declarations of the given depth,
+// the classes and other containers get their methods as children
+func braceSegmentsWithDepths(lines []string, depths []int, from, to, level int) []*codeSegment {
+	var (
+		segments []*codeSegment
+		current  = &codeSegment{start: from}
+		// Comments and annotations waiting for the next declaration
+		pending = -1
+	)
+
+	startSegment := func(i int, symbol string) {
+		start := i
+		if pending >= 0 {
+			start = pending
+		}
+
+		current.end = start
+		if current.end > current.start {
+			segments = append(segments, current)
+		}
+		current = &codeSegment{symbol: symbol, start: start}
+		pending = -1
+	}
+
+	for i := from; i < to; i++ {
+		trimmed := strings.TrimSpace(lines[i])
+
+		if depths[i] != level {
+			continue
+		}
+
+		if trimmed == "" {
+			pending = -1
+			continue
+		}
+
+		if isBracePrefixLine(trimmed) {
+			if pending < 0 {
+				pending = i
+			}
+			continue
+		}
+
+		if name := braceDeclarationName(trimmed); name != "" {
+			startSegment(i, name)
+			continue
+		}
+
+		// Statements after a declaration that was closed don't belong to it,
+		// the lines continuing the declaration itself do
+		if current.symbol != "" && i > current.start && depths[i-1] == level && !isBraceContinuationLine(trimmed) && closesBlock(lines[i-1]) {
+			startSegment(i, "")
+			continue
+		}
+
+		pending = -1
+	}
+
+	current.end = to
+	segments = append(segments, current)
+
+	for _, segment := range segments {
+		if segment.symbol == "" || !braceContainerRegexp.MatchString(declarationLine(lines, segment)) {
+			continue
+		}
+
+		for _, child := range braceSegmentsWithDepths(lines, depths, segment.start, segment.end, level+1) {
+			if child.symbol != "" {
+				segment.children = append(segment.children, child)
+			}
+		}
+	}
+
+	return segments
+}
+
+// declarationLine skips the comments and annotations above the declaration
+func declarationLine(lines []string, segment *codeSegment) string {
+	for i := segment.start; i < segment.end; i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed != "" && !isBracePrefixLine(trimmed) {
+			return trimmed
+		}
+	}
+	return ""
+}
+
+// isBracePrefixLine returns true for the comments, annotations and attributes
+// that belong to the declaration below them
+func isBracePrefixLine(line string) bool {
+	for _, prefix := range []string{"//", "/*", "*", "@", "#[", "#!["} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]")
+}
+
+func isBraceContinuationLine(line string) bool {
+	for _, prefix := range []string{".", "=>", "->", "?", ":", "&&", "||", "+", "extends", "implements", "where", "else", "catch", "finally"} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func closesBlock(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasSuffix(trimmed, "}") || strings.HasSuffix(trimmed, "};") || strings.HasSuffix(trimmed, ";") || strings.HasSuffix(trimmed, ")")
+}
@@ -0,0 +1,186 @@
+package text
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getSymbols(parts []Part) []string {
+	symbols := make([]string, 0, len(parts))
+	for _, part := range parts {
+		symbols = append(symbols, part.Symbol)
+	}
+	return symbols
+}
+
+func TestCodeSplitter_Go(t *testing.T) {
+	src := `package shop
+
+import "fmt"
+
+// Cart holds the items
+type Cart struct {
+	Items []string
+}
+
+// Add puts the item in the cart
+func (c *Cart) Add(item string) {
+	c.Items = append(c.Items, item)
+	fmt.Println("added", item, "to the cart, now with", len(c.Items), "items in total")
+}
+
+func Checkout(c *Cart) error {
+	if len(c.Items) == 0 {
+		return fmt.Errorf("the cart is empty, add some items before checking out")
+	}
+	return nil
+}
+`
+
+	parts, err := NewCodeSplitter(200, 0).Split("shop/cart.go", src)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"", "Cart", "Cart.Add", "Checkout"}, getSymbols(parts))
+	assert.Equal(t, "package shop\n\nimport \"fmt\"", parts[0].Text)
+	assert.True(t, strings.HasPrefix(parts[2].Text, "// Add puts the item in the cart\nfunc (c *Cart) Add"))
+	assert.True(t, strings.HasSuffix(parts[3].Text, "return nil\n}"))
+}
+
+func TestCodeSplitter_Python(t *testing.T) {
+	src := `import os
+
+
+class Storage:
+    """Stores the files on the disk"""
+
+    def __init__(self, path):
+        self.path = path
+
+    @property
+    def size(self):
+        total = 0
+        for name in os.listdir(self.path):
+            total += os.path.getsize(os.path.join(self.path, name))
+        return total
+
+
+def main():
+    print(Storage("/tmp").size)
+
+
+if __name__ == "__main__":
+    main()
+`
+
+	// Class fits in the chunk
+	parts, err := NewCodeSplitter(1000, 0).Split("storage.py", src)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "Storage", "main", ""}, getSymbols(parts))
+
+	// Class is split by its methods, the decorators stay with the methods
+	parts, err = NewCodeSplitter(200, 0).Split("storage.py", src)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "Storage", "Storage.__init__", "Storage.size", "main", ""}, getSymbols(parts))
+	assert.Equal(t, "class Storage:\n    \"\"\"Stores the files on the disk\"\"\"", parts[1].Text)
+	assert.True(t, strings.HasPrefix(parts[3].Text, "    @property\n    def size(self):"))
+}
+
+func TestCodeSplitter_TypeScript(t *testing.T) {
+	src := `import { api } from './api'
+
+const TIMEOUT = 1000
+
+/**
+ * Client calls the sessions API
+ */
+export class SessionClient {
+  private base = '/api/v1/sessions'
+
+  async list(): Promise<Session[]> {
+    const res = await api.get(this.base, { timeout: TIMEOUT })
+    return res.data.filter((s: Session) => s.name !== '')
+  }
+
+  async get(id: string): Promise<Session> {
+    const res = await api.get(` + "`${this.base}/${id}`" + `, { timeout: TIMEOUT })
+    return res.data
+  }
+}
+
+export const useSessions = () => {
+  return new SessionClient()
+}
+
+export function formatSession(s: Session): string {
+  return s.name
+}
+`
+
+	parts, err := NewCodeSplitter(220, 0).Split("https://github.com/helixml/helix/blob/main/frontend/src/sessions.ts", src)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"", "TIMEOUT", "SessionClient", "SessionClient.list", "SessionClient.get", "useSessions", "formatSession"}, getSymbols(parts))
+	assert.True(t, strings.HasPrefix(parts[2].Text, "/**\n * Client calls the sessions API"))
+	assert.True(t, strings.HasSuffix(parts[4].Text, "return res.data\n  }\n}"))
+}
+
+func TestCodeSplitter_Braces(t *testing.T) {
+	java := `package shop;
+
+public class Inventory {
+    private final Map<String, Integer> stock = new HashMap<>();
+
+    @Override
+    public String toString() {
+        return "Inventory with " + stock.size() + " products in stock at the moment";
+    }
+
+    public void restock(String product, int count) {
+        stock.merge(product, count, Integer::sum);
+        if (stock.get(product) > 1000) {
+            throw new IllegalStateException("too many items of " + product);
+        }
+    }
+}
+`
+
+	parts, err := NewCodeSplitter(250, 0).Split("Inventory.java", java)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "Inventory", "Inventory.toString", "Inventory.restock"}, getSymbols(parts))
+
+	rust := `use std::fmt;
+
+/// A point on the map
+pub struct Point {
+    x: i64,
+    y: i64,
+}
+
+impl fmt::Display for Point {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        write!(f, "({}, {})", self.x, self.y)
+    }
+}
+
+pub fn distance(a: &Point, b: &Point) -> i64 {
+    (a.x - b.x).abs() + (a.y - b.y).abs()
+}
+`
+
+	parts, err = NewCodeSplitter(1000, 0).Split("src/point.rs", rust)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "Point", "Point", "distance"}, getSymbols(parts))
+	assert.True(t, strings.HasPrefix(parts[1].Text, "/// A point on the map"))
+}
+
+func TestCodeSplitter_NotCode(t *testing.T) {
+	parts, err := NewCodeSplitter(1000, 0).Split("docs/README.md", "# Shop\n\n## Install\n\nRun `make install`.")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(parts))
+	assert.Equal(t, []string{"", ""}, getSymbols(parts))
+	assert.Equal(t, "Shop", parts[0].Section)
+	assert.Equal(t, "Shop > Install", parts[1].Section)
+}
@@ -0,0 +1,321 @@
+package text
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Embedder generates the embeddings of the texts, the semantic splitter
+// compares the neighbouring sentences with them
+type Embedder interface {
+	Embed(ctx context.Context, inputs []string) ([][]float32, error)
+}
+
+// semanticBreakpointPercentile is the percentile of the distances between the
+// sentences of a document above which the document is split
+const semanticBreakpointPercentile = 95
+
+// SemanticSplitter splits the documents where the meaning changes: the sentences are
+// embedded together with their neighbours and the chunks end where the distance between
+// the consecutive sentences is among the largest in the document. Headings always start
+// a new chunk and the chunks never exceed the chunk size.
+type SemanticSplitter struct {
+	embedder  Embedder
+	chunkSize int
+}
+
+func NewSemanticSplitter(embedder Embedder, chunkSize int) *SemanticSplitter {
+	return &SemanticSplitter{
+		embedder:  embedder,
+		chunkSize: chunkSize,
+	}
+}
+
+// semanticUnit is a sentence, a heading or a block that can't be split
+// such as a code block or a table
+type semanticUnit struct {
+	text    string
+	section string
+	// separator joins the unit to the previous one in the same chunk
+	separator string
+	heading   bool
+}
+
+func (s *SemanticSplitter) Split(ctx context.Context, text string) ([]Part, error) {
+	units := splitSemanticUnits(text)
+	if len(units) == 0 {
+		return nil, nil
+	}
+
+	breakpoints, err := s.breakpoints(ctx, units)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		parts   []Part
+		current strings.Builder
+		section string
+	)
+
+	flush := func() {
+		if strings.TrimSpace(current.String()) != "" {
+			parts = append(parts, Part{
+				Text:    strings.TrimSpace(current.String()),
+				Section: section,
+			})
+		}
+		current.Reset()
+	}
+
+	for idx, unit := range units {
+		// Headings stay with the text under them
+		breakpoint := breakpoints[idx] && !units[idx-1].heading
+
+		if current.Len() > 0 && (unit.heading || breakpoint || current.Len()+len(unit.separator)+len(unit.text) > s.chunkSize) {
+			flush()
+		}
+
+		if current.Len() == 0 {
+			section = unit.section
+		} else {
+			current.WriteString(unit.separator)
+		}
+
+		// Sentence longer than a chunk
+		if len(unit.text) > s.chunkSize {
+			for _, piece := range splitLines(unit.text, s.chunkSize) {
+				current.WriteString(piece)
+				flush()
+			}
+			continue
+		}
+
+		current.WriteString(unit.text)
+	}
+	flush()
+
+	return parts, nil
+}
+
+// breakpoints returns the units that start a new chunk because they're too far from the previous one
+func (s *SemanticSplitter) breakpoints(ctx context.Context, units []*semanticUnit) ([]bool, error) {
+	breakpoints := make([]bool, len(units))
+	if len(units) < 3 {
+		return breakpoints, nil
+	}
+
+	// Each sentence is embedded with its neighbours, single
+	// sentences are too short to be compared reliably
+	inputs := make([]string, len(units))
+	for idx := range units {
+		var window []string
+		for j := max(0, idx-1); j <= min(len(units)-1, idx+1); j++ {
+			window = append(window, units[j].text)
+		}
+		inputs[idx] = strings.Join(window, " ")
+	}
+
+	embeddings, err := s.embedder.Embed(ctx, inputs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed the sentences: %w", err)
+	}
+
+	if len(embeddings) != len(units) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(units), len(embeddings))
+	}
+
+	// The headings start new chunks anyway, the distances around them
+	// would only push the threshold up for the rest of the document
+	var (
+		distances = make([]float64, len(units)-1)
+		compared  []float64
+	)
+	for idx := range distances {
+		distances[idx] = 1 - cosineSimilarity(embeddings[idx], embeddings[idx+1])
+		if !units[idx].heading && !units[idx+1].heading {
+			compared = append(compared, distances[idx])
+		}
+	}
+
+	if len(compared) == 0 {
+		return breakpoints, nil
+	}
+
+	threshold := percentile(compared, semanticBreakpointPercentile)
+
+	for idx, distance := range distances {
+		if distance > threshold {
+			breakpoints[idx+1] = true
+		}
+	}
+
+	return breakpoints, nil
+}
+
+// splitSemanticUnits splits the paragraphs into sentences, the headings, code
+// blocks and tables are kept as they are
+func splitSemanticUnits(text string) []*semanticUnit {
+	var (
+		units     []*semanticUnit
+		tracker   headingTracker
+		paragraph []string
+		fence     []string
+		separator = ""
+	)
+
+	add := func(unit *semanticUnit) {
+		unit.separator = separator
+		units = append(units, unit)
+		separator = " "
+	}
+
+	flushParagraph := func() {
+		if len(paragraph) == 0 {
+			return
+		}
+
+		if isTableRow(strings.TrimSpace(paragraph[0])) {
+			add(&semanticUnit{text: strings.Join(paragraph, "\n"), section: tracker.path()})
+		} else {
+			for _, sentence := range splitSentences(strings.Join(paragraph, " ")) {
+				add(&semanticUnit{text: sentence, section: tracker.path()})
+			}
+		}
+
+		paragraph = nil
+		separator = "\n\n"
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if fence != nil {
+			fence = append(fence, line)
+			if isCodeFence(trimmed) {
+				tracker.feed(line)
+				add(&semanticUnit{text: strings.Join(fence, "\n"), section: tracker.path()})
+				fence = nil
+				separator = "\n\n"
+			}
+			continue
+		}
+
+		if isCodeFence(trimmed) {
+			flushParagraph()
+			tracker.feed(line)
+			fence = []string{line}
+			continue
+		}
+
+		if trimmed == "" {
+			flushParagraph()
+			continue
+		}
+
+		if tracker.feed(line) {
+			flushParagraph()
+			add(&semanticUnit{text: trimmed, section: tracker.path(), heading: true})
+			separator = "\n\n"
+			continue
+		}
+
+		// Tables and lists keep their lines
+		if len(paragraph) > 0 && (isTableRow(trimmed) != isTableRow(strings.TrimSpace(paragraph[0])) || isListItem(trimmed)) {
+			flushParagraph()
+			separator = "\n"
+		}
+
+		paragraph = append(paragraph, trimmed)
+	}
+
+	// Unterminated code block
+	if fence != nil {
+		add(&semanticUnit{text: strings.Join(fence, "\n"), section: tracker.path()})
+	}
+	flushParagraph()
+
+	return units
+}
+
+func isListItem(line string) bool {
+	if strings.HasPrefix(line, "- ") || strings.HasPrefix(line, "* ") || strings.HasPrefix(line, "+ ") {
+		return true
+	}
+
+	digits := strings.IndexFunc(line, func(r rune) bool { return !unicode.IsDigit(r) })
+	return digits > 0 && (strings.HasPrefix(line[digits:], ". ") || strings.HasPrefix(line[digits:], ") "))
+}
+
+// splitSentences cuts the text after the sentence terminators followed by a space and
+// an uppercase letter or a digit, so the abbreviations and decimals are left alone
+func splitSentences(text string) []string {
+	var (
+		sentences []string
+		start     int
+	)
+
+	runes := []rune(text)
+	for i := 0; i < len(runes)-2; i++ {
+		if runes[i] != '.' && runes[i] != '!' && runes[i] != '?' {
+			continue
+		}
+
+		if !unicode.IsSpace(runes[i+1]) {
+			continue
+		}
+
+		next := runes[i+2]
+		if !unicode.IsUpper(next) && !unicode.IsDigit(next) && next != '"' && next != '(' {
+			continue
+		}
+
+		// Initials such as "J. Smith"
+		if i > 0 && unicode.IsUpper(runes[i-1]) && (i == 1 || unicode.IsSpace(runes[i-2])) {
+			continue
+		}
+
+		if sentence := strings.TrimSpace(string(runes[start : i+1])); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		start = i + 1
+	}
+
+	if sentence := strings.TrimSpace(string(runes[start:])); sentence != "" {
+		sentences = append(sentences, sentence)
+	}
+
+	return sentences
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, normA, normB float64
+
+	for i := 0; i < len(a) && i < len(b); i++ {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// percentile returns the value below which the given percentage of the values fall
+func percentile(values []float64, p float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
@@ -0,0 +1,77 @@
+package text
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// topicEmbedder embeds the texts by the topics they mention
+type topicEmbedder struct {
+	topics []string
+}
+
+func (e *topicEmbedder) Embed(_ context.Context, inputs []string) ([][]float32, error) {
+	embeddings := make([][]float32, 0, len(inputs))
+
+	for _, input := range inputs {
+		embedding := make([]float32, len(e.topics))
+		for idx, topic := range e.topics {
+			embedding[idx] = float32(strings.Count(strings.ToLower(input), topic))
+		}
+		embeddings = append(embeddings, embedding)
+	}
+
+	return embeddings, nil
+}
+
+func TestSemanticSplitter(t *testing.T) {
+	doc := `# Pets
+
+Cats sleep most of the day. Cats are curious. A cat can jump five times its height. Cats purr when they are happy.
+Dogs need daily walks. Dogs are loyal. A dog can learn many commands. Dogs bark at strangers.
+
+## Care
+
+Feed your pet twice a day.`
+
+	splitter := NewSemanticSplitter(&topicEmbedder{topics: []string{"cat", "dog", "feed"}}, 1000)
+
+	parts, err := splitter.Split(context.Background(), doc)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(parts))
+
+	assert.Equal(t, "# Pets\n\nCats sleep most of the day. Cats are curious. A cat can jump five times its height. Cats purr when they are happy.", parts[0].Text)
+	assert.Equal(t, "Pets", parts[0].Section)
+
+	assert.Equal(t, "Dogs need daily walks. Dogs are loyal. A dog can learn many commands. Dogs bark at strangers.", parts[1].Text)
+	assert.Equal(t, "Pets", parts[1].Section)
+
+	// Headings always start a new chunk
+	assert.Equal(t, "## Care\n\nFeed your pet twice a day.", parts[2].Text)
+	assert.Equal(t, "Pets > Care", parts[2].Section)
+}
+
+func TestSemanticSplitter_ChunkSize(t *testing.T) {
+	sentences := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 20)
+
+	parts, err := NewSemanticSplitter(&topicEmbedder{topics: []string{"fox"}}, 100).Split(context.Background(), sentences)
+	require.NoError(t, err)
+	require.Equal(t, 10, len(parts))
+
+	for _, part := range parts {
+		assert.Equal(t, "The quick brown fox jumps over the lazy dog. The quick brown fox jumps over the lazy dog.", part.Text)
+	}
+}
+
+func Test_splitSentences(t *testing.T) {
+	assert.Equal(t, []string{
+		"The price is 3.5 dollars, e.g. cheap.",
+		"Ask J. Smith about it!",
+		"Really?",
+		"2024 was a good year.",
+	}, splitSentences("The price is 3.5 dollars, e.g. cheap. Ask J. Smith about it! Really? 2024 was a good year."))
+}
@@ -13,6 +13,12 @@ type DataPrepTextSplitterChunk struct {
 	Text            string
 	DocumentID      string
 	DocumentGroupID string
+	// Section is the path of the headings the chunk is under, if known
+	Section string
+	// Symbol is the function, method or type of a chunk of source code
+	Symbol string
+	// Page is the page of the paginated document the chunk starts on, if known
+	Page int
 	// some qapair generators create a chunk to process _per prompt_ from a
 	// suite of prompts, this is where they store which prompt this chunk will
 	// be processed by
@@ -0,0 +1,165 @@
+package text
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Part is a piece of a document produced by the structure aware splitters,
+// it records where in the document it was found so answers can cite it
+type Part struct {
+	Text string
+	// Section is the path of the headings the part is under, for example "Setup > Install"
+	Section string
+	// Symbol is the function, method or type the part of source code belongs to
+	Symbol string
+}
+
+// SectionSeparator joins the headings of the section path
+const SectionSeparator = " > "
+
+var markdownHeadingRegexp = regexp.MustCompile(`^(#{1,6})\s+(.+?)\s*#*\s*$`)
+
+// headingTracker follows the markdown headings of a document, the
+// lines have to be fed in the document order
+type headingTracker struct {
+	headings []string
+	inFence  bool
+}
+
+// feed updates the path with the line and returns true if the line is a heading
+func (h *headingTracker) feed(line string) bool {
+	trimmed := strings.TrimSpace(line)
+
+	if isCodeFence(trimmed) {
+		h.inFence = !h.inFence
+		return false
+	}
+
+	if h.inFence {
+		return false
+	}
+
+	match := markdownHeadingRegexp.FindStringSubmatch(trimmed)
+	if match == nil {
+		return false
+	}
+
+	level := len(match[1])
+	if len(h.headings) >= level {
+		h.headings = h.headings[:level-1]
+	}
+	for len(h.headings) < level-1 {
+		h.headings = append(h.headings, "")
+	}
+	h.headings = append(h.headings, match[2])
+
+	return true
+}
+
+func (h *headingTracker) path() string {
+	var headings []string
+	for _, heading := range h.headings {
+		if heading != "" {
+			headings = append(headings, heading)
+		}
+	}
+	return strings.Join(headings, SectionSeparator)
+}
+
+// section feeds the text and returns the path in effect at its first line of
+// content, chunks starting with a heading belong to that heading
+func (h *headingTracker) section(text string) string {
+	section := ""
+	found := false
+
+	for _, line := range strings.Split(text, "\n") {
+		heading := h.feed(line)
+		if !found && !heading && strings.TrimSpace(line) != "" {
+			section = h.path()
+			found = true
+		}
+	}
+
+	if !found {
+		return h.path()
+	}
+	return section
+}
+
+func isCodeFence(line string) bool {
+	return strings.HasPrefix(line, "```") || strings.HasPrefix(line, "~~~")
+}
+
+// MarkdownSections returns the heading path of each of the consecutive parts of a markdown document
+func MarkdownSections(parts []string) []string {
+	var tracker headingTracker
+
+	sections := make([]string, 0, len(parts))
+	for _, part := range parts {
+		sections = append(sections, tracker.section(part))
+	}
+	return sections
+}
+
+// pageMarkerRegexp matches the page markers the builtin extractor starts the pages with
+var pageMarkerRegexp = regexp.MustCompile(`<!-- page (\d+) -->`)
+
+// Pages returns the page each of the consecutive parts of a document starts on, zero if
+// the document has no page markers. A part starting with a marker is on that page, the
+// text before the first marker of a part belongs to the page of the previous part
+func Pages(parts []string) []int {
+	var page int
+
+	pages := make([]int, 0, len(parts))
+	for _, part := range parts {
+		markers := pageMarkerRegexp.FindAllStringSubmatchIndex(part, -1)
+
+		if len(markers) > 0 && strings.TrimSpace(part[:markers[0][0]]) == "" {
+			page, _ = strconv.Atoi(part[markers[0][2]:markers[0][3]])
+		}
+		pages = append(pages, page)
+
+		if len(markers) > 0 {
+			last := markers[len(markers)-1]
+			page, _ = strconv.Atoi(part[last[2]:last[3]])
+		}
+	}
+	return pages
+}
+
+// splitLines cuts the text into pieces of whole lines no longer than the chunk size,
+// lines longer than the chunk size are cut on the spaces
+func splitLines(text string, chunkSize int) []string {
+	var (
+		parts   []string
+		current strings.Builder
+	)
+
+	flush := func() {
+		if strings.TrimSpace(current.String()) != "" {
+			parts = append(parts, strings.TrimRight(current.String(), "\n"))
+		}
+		current.Reset()
+	}
+
+	for _, line := range strings.SplitAfter(text, "\n") {
+		if current.Len() > 0 && current.Len()+len(line) > chunkSize {
+			flush()
+		}
+
+		if len(line) > chunkSize {
+			pieces, err := chunkWithOverflow(line, chunkSize, 0)
+			if err == nil {
+				parts = append(parts, pieces[:len(pieces)-1]...)
+				line = pieces[len(pieces)-1]
+			}
+		}
+
+		current.WriteString(line)
+	}
+	flush()
+
+	return parts
+}
@@ -0,0 +1,40 @@
+package text
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPages(t *testing.T) {
+	parts := []string{
+		"<!-- page 1 -->\n# Report",
+		"Summary of the year",
+		"end of the summary\n\n<!-- page 2 -->\nRevenue",
+		"<!-- page 3 -->\nCosts\n\n<!-- page 4 -->\nOutlook",
+		"Next year",
+	}
+
+	assert.Equal(t, []int{1, 1, 1, 3, 4}, Pages(parts))
+	assert.Equal(t, []int{0, 0}, Pages([]string{"# Readme", "Install"}))
+}
+
+func TestMarkdownSections(t *testing.T) {
+	parts := []string{
+		"# Guide\n\nIntro",
+		"## Setup\n\nRun it",
+		"More setup",
+		"```\n# not a heading\n```",
+		"### Linux\n\nInstall the package",
+		"## Usage",
+	}
+
+	assert.Equal(t, []string{
+		"Guide",
+		"Guide > Setup",
+		"Guide > Setup",
+		"Guide > Setup",
+		"Guide > Setup > Linux",
+		"Guide > Usage",
+	}, MarkdownSections(parts))
+}
@@ -0,0 +1,144 @@
+package text
+
+import (
+	"regexp"
+	"strings"
+)
+
+var tableSeparatorRegexp = regexp.MustCompile(`^\|?\s*:?-{3,}:?\s*(\|\s*:?-{3,}:?\s*)*\|?$`)
+
+// TableSplitter keeps the rows of the markdown tables together with their header row,
+// large tables are split between the rows and the header is repeated in every chunk.
+// The text around the tables is split with the markdown splitter.
+type TableSplitter struct {
+	chunkSize int
+	markdown  *MarkdownSplitter
+}
+
+func NewTableSplitter(chunkSize, chunkOverflow int) *TableSplitter {
+	return &TableSplitter{
+		chunkSize: chunkSize,
+		markdown:  NewMarkdownSplitter(chunkSize, chunkOverflow),
+	}
+}
+
+// tableBlock is either a table or the text between the tables
+type tableBlock struct {
+	lines []string
+	table bool
+}
+
+func (s *TableSplitter) Split(text string) ([]Part, error) {
+	var (
+		parts   []Part
+		tracker headingTracker
+	)
+
+	for _, block := range splitTableBlocks(text) {
+		if !block.table {
+			texts, err := s.markdown.SplitText(strings.Join(block.lines, "\n"))
+			if err != nil {
+				return nil, err
+			}
+
+			for _, t := range texts {
+				parts = append(parts, Part{
+					Text:    t,
+					Section: tracker.section(t),
+				})
+			}
+			continue
+		}
+
+		section := tracker.path()
+		for _, t := range s.splitTable(block.lines) {
+			parts = append(parts, Part{
+				Text:    t,
+				Section: section,
+			})
+		}
+	}
+
+	return parts, nil
+}
+
+// splitTable groups the rows up to the chunk size, each group starts with the header
+func (s *TableSplitter) splitTable(lines []string) []string {
+	// A table has at least the header and the separator rows
+	if len(lines) < 2 {
+		return []string{strings.Join(lines, "\n")}
+	}
+
+	header := lines[0] + "\n" + lines[1]
+
+	var (
+		tables  []string
+		current = header
+		rows    = 0
+	)
+
+	for _, row := range lines[2:] {
+		if rows > 0 && len(current)+1+len(row) > s.chunkSize {
+			tables = append(tables, current)
+			current = header
+			rows = 0
+		}
+
+		current += "\n" + row
+		rows++
+	}
+
+	return append(tables, current)
+}
+
+// splitTableBlocks separates the markdown tables from the rest of the text,
+// tables in code blocks are left alone
+func splitTableBlocks(text string) []*tableBlock {
+	lines := strings.Split(text, "\n")
+
+	var (
+		blocks  []*tableBlock
+		current = &tableBlock{}
+		inFence bool
+	)
+
+	flush := func() {
+		if len(current.lines) > 0 {
+			blocks = append(blocks, current)
+		}
+		current = &tableBlock{}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+
+		if isCodeFence(trimmed) {
+			inFence = !inFence
+		}
+
+		if inFence || !isTableRow(trimmed) || i+1 >= len(lines) || !tableSeparatorRegexp.MatchString(strings.TrimSpace(lines[i+1])) {
+			current.lines = append(current.lines, lines[i])
+			continue
+		}
+
+		flush()
+		current.table = true
+
+		// The separator row doesn't need the leading pipe of the other rows
+		current.lines = append(current.lines, trimmed, strings.TrimSpace(lines[i+1]))
+
+		for i += 2; i < len(lines) && isTableRow(strings.TrimSpace(lines[i])); i++ {
+			current.lines = append(current.lines, strings.TrimSpace(lines[i]))
+		}
+		i--
+
+		flush()
+	}
+	flush()
+
+	return blocks
+}
+
+func isTableRow(line string) bool {
+	return strings.HasPrefix(line, "|") && strings.Count(line, "|") >= 2
+}
@@ -0,0 +1,72 @@
+package text
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableSplitter(t *testing.T) {
+	var rows []string
+	for i := 1; i <= 10; i++ {
+		rows = append(rows, fmt.Sprintf("| SKU-%03d | Widget number %d | %d.99 |", i, i, i))
+	}
+
+	doc := "# Catalog\n\nAll the prices include VAT.\n\n## Widgets\n\n" +
+		"| SKU | Name | Price |\n| --- | --- | ---: |\n" + strings.Join(rows, "\n") +
+		"\n\nPrices change every month.\n\n```\n| not | a table |\n| --- | --- |\n```"
+
+	parts, err := NewTableSplitter(150, 0).Split(doc)
+	require.NoError(t, err)
+
+	var tables []Part
+	for _, part := range parts {
+		if strings.HasPrefix(part.Text, "| SKU | Name | Price |") {
+			tables = append(tables, part)
+		}
+	}
+
+	// Each chunk of the table starts with the header
+	require.Equal(t, 5, len(tables))
+
+	var tableRows int
+	for _, table := range tables {
+		assert.Equal(t, "Catalog > Widgets", table.Section)
+		assert.LessOrEqual(t, len(table.Text), 150)
+
+		lines := strings.Split(table.Text, "\n")
+		assert.Equal(t, "| --- | --- | ---: |", lines[1])
+		tableRows += len(lines) - 2
+	}
+	assert.Equal(t, 10, tableRows)
+
+	assert.Equal(t, "Catalog", parts[0].Section)
+	assert.Contains(t, parts[0].Text, "All the prices include VAT.")
+
+	// Tables in the code blocks are just text
+	last := parts[len(parts)-1]
+	assert.Contains(t, last.Text, "| not | a table |")
+	assert.Equal(t, "Catalog > Widgets", last.Section)
+}
+
+func TestTableSplitter_SeparatorWithoutPipes(t *testing.T) {
+	parts, err := NewTableSplitter(150, 0).Split("intro\n\n| a | b |\n--- | ---\n| 1 | 2 |\n")
+	require.NoError(t, err)
+
+	var tables []string
+	for _, part := range parts {
+		if strings.HasPrefix(part.Text, "| a | b |") {
+			tables = append(tables, part.Text)
+		}
+	}
+	assert.Equal(t, []string{"| a | b |\n--- | ---\n| 1 | 2 |"}, tables)
+}
+
+func TestTableSplitter_splitTable(t *testing.T) {
+	s := NewTableSplitter(150, 0)
+	assert.Equal(t, []string{"| a | b |"}, s.splitTable([]string{"| a | b |"}))
+	assert.Equal(t, []string{"| a | b |\n| --- | --- |"}, s.splitTable([]string{"| a | b |", "| --- | --- |"}))
+}
@@ -0,0 +1,311 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	md "github.com/JohannesKaufmann/html-to-markdown"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// Largest document downloaded by the builtin extractor
+	maxBuiltinDownloadSize = 256 * 1024 * 1024
+	// How long a download can take, including reading the body
+	builtinDownloadTimeout = 5 * time.Minute
+	// builtinExtractorVersion is part of the identity, bump it when the extracted
+	// text changes so the cached extractions are discarded
+	builtinExtractorVersion = 1
+)
+
+// ErrUnsupportedFormat is returned by the builtin extractor without a fallback
+// for the formats it can't read, for example scanned PDFs or legacy Office files
+var ErrUnsupportedFormat = errors.New("unsupported document format")
+
+// ErrFileTooLarge is returned when the downloaded document is over the size limit
+var ErrFileTooLarge = errors.New("file too large")
+
+// PageMarker starts the text of each page of the paginated documents (PDFs and
+// presentations), it's an HTML comment so it's not rendered in markdown
+func PageMarker(page int) string {
+	return fmt.Sprintf("<!-- page %d -->", page)
+}
+
+type documentFormat string
+
+const (
+	formatUnknown  documentFormat = ""
+	formatPDF      documentFormat = "pdf"
+	formatDOCX     documentFormat = "docx"
+	formatPPTX     documentFormat = "pptx"
+	formatXLSX     documentFormat = "xlsx"
+	formatHTML     documentFormat = "html"
+	formatMarkdown documentFormat = "markdown"
+	formatCSV      documentFormat = "csv"
+	formatJSON     documentFormat = "json"
+	formatText     documentFormat = "text"
+)
+
+// BuiltinExtractor extracts the text of the common document formats in-process,
+// the other formats are sent to the fallback extractor if one is configured
+type BuiltinExtractor struct {
+	fallback        Extractor
+	httpClient      *http.Client
+	maxDownloadSize int64
+}
+
+func NewBuiltinExtractor(fallback Extractor) *BuiltinExtractor {
+	return &BuiltinExtractor{
+		fallback: fallback,
+		httpClient: &http.Client{
+			Timeout: builtinDownloadTimeout,
+		},
+		maxDownloadSize: maxBuiltinDownloadSize,
+	}
+}
+
+func (e *BuiltinExtractor) Identity() string {
+	identity := fmt.Sprintf("builtin:v%d", builtinExtractorVersion)
+	if e.fallback != nil {
+		identity += "+" + Identity(e.fallback)
+	}
+	return identity
+}
+
+func (e *BuiltinExtractor) Extract(ctx context.Context, extractReq *Request) (string, error) {
+	if extractReq.URL == "" && len(extractReq.Content) == 0 {
+		return "", fmt.Errorf("no URL or content provided")
+	}
+
+	content := extractReq.Content
+	filename := extractReq.Filename
+	contentType := ""
+
+	if extractReq.URL != "" {
+		var err error
+		content, contentType, err = e.download(ctx, extractReq.URL)
+		if err != nil {
+			return "", err
+		}
+		if filename == "" {
+			filename = extractReq.URL
+		}
+	}
+
+	format := detectFormat(content, filename, contentType)
+
+	text, err := extractFormat(format, content)
+	if err == nil {
+		return text, nil
+	}
+
+	log.Debug().
+		Err(err).
+		Str("filename", filename).
+		Str("format", string(format)).
+		Msg("builtin extractor can't handle the document")
+
+	if e.fallback == nil {
+		return "", err
+	}
+
+	return e.fallback.Extract(ctx, &Request{
+		Content:  content,
+		Filename: filename,
+	})
+}
+
+func (e *BuiltinExtractor) download(ctx context.Context, u string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, "", fmt.Errorf("error downloading %s: %s", u, resp.Status)
+	}
+
+	if resp.ContentLength > e.maxDownloadSize {
+		return nil, "", fmt.Errorf("%w: %s is %d bytes, the limit is %d bytes", ErrFileTooLarge, u, resp.ContentLength, e.maxDownloadSize)
+	}
+
+	// Reading one byte over the limit tells a document of exactly
+	// the limit apart from a larger one
+	bts, err := io.ReadAll(io.LimitReader(resp.Body, e.maxDownloadSize+1))
+	if err != nil {
+		return nil, "", err
+	}
+
+	if int64(len(bts)) > e.maxDownloadSize {
+		return nil, "", fmt.Errorf("%w: %s is over the limit of %d bytes", ErrFileTooLarge, u, e.maxDownloadSize)
+	}
+
+	return bts, resp.Header.Get("Content-Type"), nil
+}
+
+func extractFormat(format documentFormat, content []byte) (string, error) {
+	switch format {
+	case formatPDF:
+		return extractPDF(content)
+	case formatDOCX:
+		return extractDOCX(content)
+	case formatPPTX:
+		return extractPPTX(content)
+	case formatXLSX:
+		return extractXLSX(content)
+	case formatHTML:
+		return md.NewConverter("", true, nil).ConvertString(string(content))
+	case formatCSV:
+		return extractCSV(content)
+	case formatJSON:
+		return extractJSON(content)
+	case formatMarkdown, formatText:
+		return strings.ReplaceAll(string(content), "\r\n", "\n"), nil
+	default:
+		return "", ErrUnsupportedFormat
+	}
+}
+
+// detectFormat sniffs the binary formats from the content, the text formats
+// are told apart by the file extension or the content type
+func detectFormat(content []byte, filename, contentType string) documentFormat {
+	switch {
+	case bytes.HasPrefix(bytes.TrimLeft(content, "\x00\t\n\f\r "), []byte("%PDF-")):
+		return formatPDF
+	case bytes.HasPrefix(content, []byte("PK\x03\x04")):
+		return detectOfficeFormat(content)
+	}
+
+	if !utf8.Valid(content) || bytes.IndexByte(content, 0) >= 0 {
+		return formatUnknown
+	}
+
+	ext := strings.ToLower(path.Ext(strings.SplitN(filename, "?", 2)[0]))
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch {
+	case ext == ".html" || ext == ".htm" || mediaType == "text/html":
+		return formatHTML
+	case ext == ".md" || ext == ".markdown" || mediaType == "text/markdown":
+		return formatMarkdown
+	case ext == ".csv" || mediaType == "text/csv":
+		return formatCSV
+	case ext == ".json" || mediaType == "application/json":
+		return formatJSON
+	}
+
+	// No hints, content checks only
+	trimmed := bytes.TrimSpace(content)
+	lower := bytes.ToLower(trimmed[:min(len(trimmed), 512)])
+
+	switch {
+	case bytes.HasPrefix(lower, []byte("<!doctype html")) || bytes.HasPrefix(lower, []byte("<html")):
+		return formatHTML
+	case (bytes.HasPrefix(trimmed, []byte("{")) || bytes.HasPrefix(trimmed, []byte("["))) && json.Valid(trimmed):
+		return formatJSON
+	}
+
+	return formatText
+}
+
+// detectOfficeFormat tells the Office Open XML documents apart by their main part
+func detectOfficeFormat(content []byte) documentFormat {
+	r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return formatUnknown
+	}
+
+	for _, f := range r.File {
+		switch f.Name {
+		case "word/document.xml":
+			return formatDOCX
+		case "ppt/presentation.xml":
+			return formatPPTX
+		case "xl/workbook.xml":
+			return formatXLSX
+		}
+	}
+
+	return formatUnknown
+}
+
+func extractCSV(content []byte) (string, error) {
+	r := csv.NewReader(bytes.NewReader(content))
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+
+	rows, err := r.ReadAll()
+	if err != nil {
+		return "", fmt.Errorf("failed to read CSV: %w", err)
+	}
+
+	return markdownTable(rows), nil
+}
+
+func extractJSON(content []byte) (string, error) {
+	var buf bytes.Buffer
+	err := json.Indent(&buf, bytes.TrimSpace(content), "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to read JSON: %w", err)
+	}
+
+	return buf.String(), nil
+}
+
+// markdownTable renders the rows as a markdown table, the first row is the header
+func markdownTable(rows [][]string) string {
+	columns := 0
+	for _, row := range rows {
+		columns = max(columns, len(row))
+	}
+	if columns == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+
+	writeRow := func(row []string) {
+		sb.WriteString("|")
+		for i := 0; i < columns; i++ {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+			cell = strings.ReplaceAll(cell, "|", "\\|")
+			cell = strings.Join(strings.Fields(cell), " ")
+			sb.WriteString(" ")
+			sb.WriteString(cell)
+			sb.WriteString(" |")
+		}
+		sb.WriteString("\n")
+	}
+
+	writeRow(rows[0])
+	sb.WriteString("|")
+	sb.WriteString(strings.Repeat(" --- |", columns))
+	sb.WriteString("\n")
+
+	for _, row := range rows[1:] {
+		writeRow(row)
+	}
+
+	return sb.String()
+}
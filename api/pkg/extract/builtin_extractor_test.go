@@ -0,0 +1,313 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func zipDocument(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+
+	for name, content := range files {
+		f, err := w.Create(name)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+func TestBuiltin_ExtractPDF(t *testing.T) {
+	extractor := NewBuiltinExtractor(nil)
+
+	t.Run("Manual", func(t *testing.T) {
+		bts, err := os.ReadFile("./testdata/cb750.pdf")
+		require.NoError(t, err)
+
+		text, err := extractor.Extract(context.Background(), &Request{Content: bts})
+		require.NoError(t, err)
+
+		assert.True(t, strings.HasPrefix(text, PageMarker(1)))
+		assert.Contains(t, text, PageMarker(2))
+		assert.Contains(t, text, "## Checking the Engine Oil")
+		assert.Contains(t, text, "Inspect the brake pads from in front")
+		assert.Contains(t, text, "Check that the side stand operates")
+	})
+
+	t.Run("HR_Guide", func(t *testing.T) {
+		bts, err := os.ReadFile("./testdata/hr_guide.pdf")
+		require.NoError(t, err)
+
+		text, err := extractor.Extract(context.Background(), &Request{Content: bts})
+		require.NoError(t, err)
+
+		// Headings wrapped on two lines are joined
+		assert.Contains(t, text, "# Policy and Procedure Template")
+		assert.Contains(t, text, "to thriving communities. And in doing so, you help build a stronger, more resilient")
+		// Ligatures are split
+		assert.Contains(t, text, "This policy applies to bona fide non-occupational illnesses and injuries")
+	})
+}
+
+func TestBuiltin_ExtractDOCX(t *testing.T) {
+	docx := zipDocument(t, map[string]string{
+		"word/styles.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+  <w:style w:type="paragraph" w:styleId="berschrift1"><w:name w:val="heading 1"/></w:style>
+  <w:style w:type="paragraph" w:styleId="Sub"><w:name w:val="Subsection"/><w:pPr><w:outlineLvl w:val="1"/></w:pPr></w:style>
+</w:styles>`,
+		"word/document.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+  <w:body>
+    <w:p><w:pPr><w:pStyle w:val="berschrift1"/></w:pPr><w:r><w:t>Leave policy</w:t></w:r></w:p>
+    <w:p><w:r><w:t xml:space="preserve">Employees get </w:t></w:r><w:r><w:t>25 days.</w:t></w:r></w:p>
+    <w:p><w:pPr><w:pStyle w:val="Sub"/></w:pPr><w:r><w:t>Carry over</w:t></w:r></w:p>
+    <w:p><w:pPr><w:numPr><w:ilvl w:val="0"/></w:numPr></w:pPr><w:r><w:t>Up to 5 days</w:t></w:r></w:p>
+    <w:tbl>
+      <w:tr><w:tc><w:p><w:r><w:t>Years</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Days</w:t></w:r></w:p></w:tc></w:tr>
+      <w:tr><w:tc><w:p><w:r><w:t>5+</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>30</w:t></w:r></w:p></w:tc></w:tr>
+    </w:tbl>
+  </w:body>
+</w:document>`,
+	})
+
+	text, err := NewBuiltinExtractor(nil).Extract(context.Background(), &Request{Content: docx})
+	require.NoError(t, err)
+
+	assert.Equal(t, `# Leave policy
+
+Employees get 25 days.
+
+## Carry over
+
+- Up to 5 days
+
+| Years | Days |
+| --- | --- |
+| 5+ | 30 |`, text)
+}
+
+func TestBuiltin_ExtractPPTX(t *testing.T) {
+	slide := func(title, body string) string {
+		return `<?xml version="1.0" encoding="UTF-8"?>
+<p:sld xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main" xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main">
+  <p:cSld><p:spTree>
+    <p:sp><p:nvSpPr><p:nvPr><p:ph type="title"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>` + title + `</a:t></a:r></a:p></p:txBody></p:sp>
+    <p:sp><p:nvSpPr><p:nvPr><p:ph idx="1"/></p:nvPr></p:nvSpPr><p:txBody><a:p><a:r><a:t>` + body + `</a:t></a:r></a:p></p:txBody></p:sp>
+  </p:spTree></p:cSld>
+</p:sld>`
+	}
+
+	pptx := zipDocument(t, map[string]string{
+		"ppt/presentation.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<p:presentation xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+  <p:sldIdLst><p:sldId id="256" r:id="rId3"/><p:sldId id="257" r:id="rId2"/></p:sldIdLst>
+</p:presentation>`,
+		"ppt/_rels/presentation.xml.rels": `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+  <Relationship Id="rId2" Target="slides/slide1.xml"/>
+  <Relationship Id="rId3" Target="slides/slide2.xml"/>
+</Relationships>`,
+		"ppt/slides/slide1.xml": slide("Roadmap", "Ship the builtin extractor"),
+		"ppt/slides/slide2.xml": slide("Agenda", "Planning"),
+	})
+
+	text, err := NewBuiltinExtractor(nil).Extract(context.Background(), &Request{Content: pptx})
+	require.NoError(t, err)
+
+	// Slides in the presentation order
+	assert.Equal(t, PageMarker(1)+`
+
+# Agenda
+
+Planning
+
+`+PageMarker(2)+`
+
+# Roadmap
+
+Ship the builtin extractor`, text)
+}
+
+func TestBuiltin_ExtractXLSX(t *testing.T) {
+	xlsx := zipDocument(t, map[string]string{
+		"xl/workbook.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+  <sheets><sheet name="Prices" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`,
+		"xl/_rels/workbook.xml.rels": `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+  <Relationship Id="rId1" Target="worksheets/sheet1.xml"/>
+</Relationships>`,
+		"xl/sharedStrings.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+  <si><t>Item</t></si><si><t>Price</t></si><si><r><t>Coffee</t></r><r><t xml:space="preserve"> beans</t></r></si>
+</sst>`,
+		"xl/worksheets/sheet1.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+  <sheetData>
+    <row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c></row>
+    <row r="2"><c r="A2" t="s"><v>2</v></c><c r="C2"><v>12.5</v></c></row>
+    <row r="3"><c r="A3" t="inlineStr"><is><t>Tea</t></is></c><c r="B3" t="b"><v>1</v></c></row>
+  </sheetData>
+</worksheet>`,
+	})
+
+	text, err := NewBuiltinExtractor(nil).Extract(context.Background(), &Request{Content: xlsx})
+	require.NoError(t, err)
+
+	assert.Equal(t, `## Prices
+
+| Item | Price |  |
+| --- | --- | --- |
+| Coffee beans |  | 12.5 |
+| Tea | TRUE |  |`, text)
+}
+
+func TestBuiltin_ExtractText(t *testing.T) {
+	extractor := NewBuiltinExtractor(nil)
+
+	tests := []struct {
+		name     string
+		request  *Request
+		expected string
+	}{
+		{
+			name:     "CSV",
+			request:  &Request{Content: []byte("name,team\nalice,ops|sre\n"), Filename: "people.csv"},
+			expected: "| name | team |\n| --- | --- |\n| alice | ops\\|sre |\n",
+		},
+		{
+			name:     "JSON",
+			request:  &Request{Content: []byte(`{"name":"alice","teams":["ops"]}`)},
+			expected: "{\n  \"name\": \"alice\",\n  \"teams\": [\n    \"ops\"\n  ]\n}",
+		},
+		{
+			name:     "HTML",
+			request:  &Request{Content: []byte("<html><body><h1>Title</h1><p>Hello <b>world</b></p></body></html>")},
+			expected: "# Title\n\nHello **world**",
+		},
+		{
+			name:     "Markdown",
+			request:  &Request{Content: []byte("# Title\r\n\r\nBody"), Filename: "docs/readme.md"},
+			expected: "# Title\n\nBody",
+		},
+		{
+			name:     "Text",
+			request:  &Request{Content: []byte("plain text")},
+			expected: "plain text",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, err := extractor.Extract(context.Background(), tt.request)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, text)
+		})
+	}
+}
+
+func TestBuiltin_ExtractURL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte("<h2>Sharks</h2><p>Tiger sharks</p>"))
+	}))
+	defer ts.Close()
+
+	text, err := NewBuiltinExtractor(nil).Extract(context.Background(), &Request{URL: ts.URL + "/sharks"})
+	require.NoError(t, err)
+	assert.Equal(t, "## Sharks\n\nTiger sharks", text)
+}
+
+func TestBuiltin_ExtractURL_TooLarge(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Streamed without the content length
+		if r.URL.Path == "/chunked" {
+			w.Header().Set("Transfer-Encoding", "chunked")
+		}
+		_, _ = w.Write([]byte("Tiger sharks are large macropredators"))
+	}))
+	defer ts.Close()
+
+	extractor := NewBuiltinExtractor(nil)
+	extractor.maxDownloadSize = 16
+
+	for _, path := range []string{"/sharks", "/chunked"} {
+		_, err := extractor.Extract(context.Background(), &Request{URL: ts.URL + path})
+		require.ErrorIs(t, err, ErrFileTooLarge, path)
+	}
+
+	// Exactly at the limit
+	extractor.maxDownloadSize = int64(len("Tiger sharks are large macropredators"))
+	text, err := extractor.Extract(context.Background(), &Request{URL: ts.URL + "/chunked"})
+	require.NoError(t, err)
+	assert.Equal(t, "Tiger sharks are large macropredators", text)
+}
+
+func TestBuiltin_Fallback(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	fallback := NewMockExtractor(ctrl)
+
+	// Legacy Word document
+	doc := []byte("\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1 binary")
+
+	fallback.EXPECT().Extract(gomock.Any(), &Request{
+		Content:  doc,
+		Filename: "old.doc",
+	}).Return("legacy text", nil)
+
+	text, err := NewBuiltinExtractor(fallback).Extract(context.Background(), &Request{Content: doc, Filename: "old.doc"})
+	require.NoError(t, err)
+	assert.Equal(t, "legacy text", text)
+
+	// Scanned PDFs don't have a text layer
+	scanned := []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n" +
+		"2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 1 >>\nendobj\n" +
+		"3 0 obj\n<< /Type /Page /Parent 2 0 R >>\nendobj\ntrailer\n<< /Root 1 0 R >>\n%%EOF")
+
+	fallback.EXPECT().Extract(gomock.Any(), &Request{Content: scanned}).Return("ocr text", nil)
+
+	text, err = NewBuiltinExtractor(fallback).Extract(context.Background(), &Request{Content: scanned})
+	require.NoError(t, err)
+	assert.Equal(t, "ocr text", text)
+
+	_, err = NewBuiltinExtractor(nil).Extract(context.Background(), &Request{Content: doc})
+	require.ErrorIs(t, err, ErrUnsupportedFormat)
+}
+
+func TestBuiltin_ExtractPDF_Minimal(t *testing.T) {
+	content := "BT /F1 24 Tf 72 720 Td (Shark report) Tj ET\n" +
+		"BT /F1 12 Tf 72 690 Td [(Tiger sharks eat) -300 (everything.)] TJ ET\n" +
+		"BT /F1 12 Tf 72 676 Td (Even echidnas.) Tj ET"
+
+	pdf := "%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n" +
+		"2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 1 >>\nendobj\n" +
+		"3 0 obj\n<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>\nendobj\n" +
+		"4 0 obj\n<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>\nendobj\n" +
+		"5 0 obj\n<< /Length 6 0 R >>\nstream\n" + content + "\nendstream\nendobj\n" +
+		"trailer\n<< /Root 1 0 R >>\n%%EOF"
+
+	text, err := extractPDF([]byte(pdf))
+	require.NoError(t, err)
+
+	assert.Equal(t, PageMarker(1)+`
+
+# Shark report
+
+Tiger sharks eat everything.
+Even echidnas.`, text)
+}
@@ -0,0 +1,662 @@
+package extract
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Office Open XML documents are zip files of XML parts, the text is read from the
+// parts with a token decoder so that the namespaces and unknown elements don't matter
+
+// Largest decompressed part read from a document
+const maxOfficePartSize = 128 * 1024 * 1024
+
+type officeDocument struct {
+	files map[string]*zip.File
+}
+
+func openOfficeDocument(content []byte) (*officeDocument, error) {
+	r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open document: %w", err)
+	}
+
+	doc := &officeDocument{files: make(map[string]*zip.File, len(r.File))}
+	for _, f := range r.File {
+		doc.files[f.Name] = f
+	}
+
+	return doc, nil
+}
+
+// read returns the part, nil if the document doesn't have it
+func (d *officeDocument) read(name string) ([]byte, error) {
+	f, ok := d.files[name]
+	if !ok {
+		return nil, nil
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer rc.Close()
+
+	return io.ReadAll(io.LimitReader(rc, maxOfficePartSize))
+}
+
+// relationships returns the targets of the relationships of the part by ID,
+// resolved to the part names
+func (d *officeDocument) relationships(part string) map[string]string {
+	dir, file := path.Split(part)
+
+	data, err := d.read(dir + "_rels/" + file + ".rels")
+	if err != nil || data == nil {
+		return nil
+	}
+
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := xml.Unmarshal(data, &rels); err != nil {
+		return nil
+	}
+
+	targets := make(map[string]string, len(rels.Relationships))
+	for _, rel := range rels.Relationships {
+		if target, ok := strings.CutPrefix(rel.Target, "/"); ok {
+			targets[rel.ID] = target
+		} else {
+			targets[rel.ID] = path.Join(dir, rel.Target)
+		}
+	}
+
+	return targets
+}
+
+func attr(el xml.StartElement, name string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// tableBuilder collects the cells of a table while reading the document
+type tableBuilder struct {
+	rows [][]string
+	row  []string
+	cell strings.Builder
+}
+
+func (t *tableBuilder) addText(text string) {
+	if t.cell.Len() > 0 && text != "" {
+		t.cell.WriteString(" ")
+	}
+	t.cell.WriteString(text)
+}
+
+func (t *tableBuilder) endCell() {
+	t.row = append(t.row, strings.TrimSpace(t.cell.String()))
+	t.cell.Reset()
+}
+
+func (t *tableBuilder) endRow() {
+	t.rows = append(t.rows, t.row)
+	t.row = nil
+}
+
+var headingStyleName = regexp.MustCompile(`^heading\s*(\d)$`)
+
+// extractDOCX returns the paragraphs of the document, the paragraphs with a heading
+// style are markdown headings and the tables are markdown tables
+func extractDOCX(content []byte) (string, error) {
+	doc, err := openOfficeDocument(content)
+	if err != nil {
+		return "", err
+	}
+
+	body, err := doc.read("word/document.xml")
+	if err != nil {
+		return "", err
+	}
+
+	headings := docxHeadingStyles(doc)
+
+	var (
+		out       strings.Builder
+		paragraph strings.Builder
+		tables    []*tableBuilder
+		heading   int
+		listItem  bool
+		inText    bool
+	)
+
+	dec := xml.NewDecoder(bytes.NewReader(body))
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read document: %w", err)
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "p":
+				paragraph.Reset()
+				heading = 0
+				listItem = false
+			case "pStyle":
+				heading = headings[attr(el, "val")]
+			case "outlineLvl":
+				if lvl, err := strconv.Atoi(attr(el, "val")); err == nil && lvl < 6 {
+					heading = lvl + 1
+				}
+			case "numPr":
+				listItem = true
+			case "t":
+				inText = true
+			case "tab":
+				paragraph.WriteString("\t")
+			case "br", "cr":
+				paragraph.WriteString("\n")
+			case "tbl":
+				tables = append(tables, &tableBuilder{})
+			}
+		case xml.CharData:
+			if inText {
+				paragraph.Write(el)
+			}
+		case xml.EndElement:
+			switch el.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text := strings.TrimSpace(paragraph.String())
+				paragraph.Reset()
+
+				if len(tables) > 0 {
+					tables[len(tables)-1].addText(strings.Join(strings.Fields(text), " "))
+					continue
+				}
+				if text == "" {
+					continue
+				}
+
+				switch {
+				case heading > 0:
+					out.WriteString(strings.Repeat("#", heading) + " ")
+				case listItem:
+					out.WriteString("- ")
+				}
+				out.WriteString(text)
+				out.WriteString("\n\n")
+			case "tc":
+				if len(tables) > 0 {
+					tables[len(tables)-1].endCell()
+				}
+			case "tr":
+				if len(tables) > 0 {
+					tables[len(tables)-1].endRow()
+				}
+			case "tbl":
+				if len(tables) == 0 {
+					continue
+				}
+				table := tables[len(tables)-1]
+				tables = tables[:len(tables)-1]
+
+				// Nested tables are flattened into the cell of the outer table
+				if len(tables) > 0 {
+					for _, row := range table.rows {
+						tables[len(tables)-1].addText(strings.Join(row, " "))
+					}
+					continue
+				}
+
+				if len(table.rows) > 0 {
+					out.WriteString(markdownTable(table.rows))
+					out.WriteString("\n")
+				}
+			}
+		}
+	}
+
+	return strings.TrimSpace(out.String()), nil
+}
+
+// docxHeadingStyles returns the heading level of the paragraph styles by ID
+func docxHeadingStyles(doc *officeDocument) map[string]int {
+	headings := map[string]int{"Title": 1}
+	for i := 1; i <= 6; i++ {
+		headings[fmt.Sprintf("Heading%d", i)] = i
+	}
+
+	data, err := doc.read("word/styles.xml")
+	if err != nil || data == nil {
+		return headings
+	}
+
+	var styles struct {
+		Styles []struct {
+			ID   string `xml:"styleId,attr"`
+			Name struct {
+				Val string `xml:"val,attr"`
+			} `xml:"name"`
+			PPr struct {
+				OutlineLvl *struct {
+					Val int `xml:"val,attr"`
+				} `xml:"outlineLvl"`
+			} `xml:"pPr"`
+		} `xml:"style"`
+	}
+	if err := xml.Unmarshal(data, &styles); err != nil {
+		return headings
+	}
+
+	for _, style := range styles.Styles {
+		name := strings.ToLower(style.Name.Val)
+
+		switch {
+		case name == "title":
+			headings[style.ID] = 1
+		case headingStyleName.MatchString(name):
+			level, _ := strconv.Atoi(headingStyleName.FindStringSubmatch(name)[1])
+			headings[style.ID] = level
+		case style.PPr.OutlineLvl != nil && style.PPr.OutlineLvl.Val < 6:
+			headings[style.ID] = style.PPr.OutlineLvl.Val + 1
+		}
+	}
+
+	return headings
+}
+
+var slidePartName = regexp.MustCompile(`^ppt/slides/slide(\d+)\.xml$`)
+
+// extractPPTX returns the text of the slides, each slide starts with a page
+// marker and the slide title is a heading
+func extractPPTX(content []byte) (string, error) {
+	doc, err := openOfficeDocument(content)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+
+	for idx, slide := range pptxSlides(doc) {
+		data, err := doc.read(slide)
+		if err != nil {
+			return "", err
+		}
+
+		text, err := extractSlide(data)
+		if err != nil {
+			return "", err
+		}
+
+		if idx > 0 {
+			out.WriteString("\n\n")
+		}
+		out.WriteString(PageMarker(idx + 1))
+		out.WriteString("\n\n")
+		out.WriteString(text)
+	}
+
+	return strings.TrimSpace(out.String()), nil
+}
+
+// pptxSlides returns the slide parts in the presentation order, falling back
+// to the order of the slide numbers
+func pptxSlides(doc *officeDocument) []string {
+	var slides []string
+
+	data, _ := doc.read("ppt/presentation.xml")
+	rels := doc.relationships("ppt/presentation.xml")
+
+	var presentation struct {
+		Slides []struct {
+			RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sldIdLst>sldId"`
+	}
+	if data != nil && xml.Unmarshal(data, &presentation) == nil {
+		for _, s := range presentation.Slides {
+			if target, ok := rels[s.RelID]; ok {
+				if _, exists := doc.files[target]; exists {
+					slides = append(slides, target)
+				}
+			}
+		}
+	}
+
+	if len(slides) > 0 {
+		return slides
+	}
+
+	numbered := make(map[int]string)
+	for name := range doc.files {
+		if m := slidePartName.FindStringSubmatch(name); m != nil {
+			n, _ := strconv.Atoi(m[1])
+			numbered[n] = name
+		}
+	}
+
+	numbers := make([]int, 0, len(numbered))
+	for n := range numbered {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	for _, n := range numbers {
+		slides = append(slides, numbered[n])
+	}
+
+	return slides
+}
+
+func extractSlide(data []byte) (string, error) {
+	var (
+		out       strings.Builder
+		paragraph strings.Builder
+		tables    []*tableBuilder
+		title     bool
+		inText    bool
+	)
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read slide: %w", err)
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "sp":
+				title = false
+			case "ph":
+				switch attr(el, "type") {
+				case "title", "ctrTitle":
+					title = true
+				}
+			case "p":
+				paragraph.Reset()
+			case "t":
+				inText = true
+			case "br":
+				paragraph.WriteString("\n")
+			case "tbl":
+				tables = append(tables, &tableBuilder{})
+			}
+		case xml.CharData:
+			if inText {
+				paragraph.Write(el)
+			}
+		case xml.EndElement:
+			switch el.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text := strings.TrimSpace(paragraph.String())
+				paragraph.Reset()
+
+				if len(tables) > 0 {
+					tables[len(tables)-1].addText(text)
+					continue
+				}
+				if text == "" {
+					continue
+				}
+
+				if title {
+					out.WriteString("# ")
+				}
+				out.WriteString(text)
+				out.WriteString("\n\n")
+			case "tc":
+				if len(tables) > 0 {
+					tables[len(tables)-1].endCell()
+				}
+			case "tr":
+				if len(tables) > 0 {
+					tables[len(tables)-1].endRow()
+				}
+			case "tbl":
+				if len(tables) == 0 {
+					continue
+				}
+				table := tables[len(tables)-1]
+				tables = tables[:len(tables)-1]
+
+				if len(table.rows) > 0 {
+					out.WriteString(markdownTable(table.rows))
+					out.WriteString("\n")
+				}
+			}
+		}
+	}
+
+	return strings.TrimSpace(out.String()), nil
+}
+
+// Columns beyond this are ignored, stray cells far to the right would make huge tables
+const maxSheetColumns = 256
+
+// extractXLSX returns each sheet as a heading with the sheet name followed by a
+// markdown table, the first row is used as the header
+func extractXLSX(content []byte) (string, error) {
+	doc, err := openOfficeDocument(content)
+	if err != nil {
+		return "", err
+	}
+
+	sharedStrings, err := xlsxSharedStrings(doc)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := doc.read("xl/workbook.xml")
+	if err != nil {
+		return "", err
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name  string `xml:"name,attr"`
+			RelID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := xml.Unmarshal(data, &workbook); err != nil {
+		return "", fmt.Errorf("failed to read workbook: %w", err)
+	}
+
+	rels := doc.relationships("xl/workbook.xml")
+
+	var out strings.Builder
+
+	for _, sheet := range workbook.Sheets {
+		data, err := doc.read(rels[sheet.RelID])
+		if err != nil {
+			return "", err
+		}
+		if data == nil {
+			continue
+		}
+
+		rows, err := xlsxRows(data, sharedStrings)
+		if err != nil {
+			return "", fmt.Errorf("failed to read sheet %s: %w", sheet.Name, err)
+		}
+		if len(rows) == 0 {
+			continue
+		}
+
+		out.WriteString("## ")
+		out.WriteString(sheet.Name)
+		out.WriteString("\n\n")
+		out.WriteString(markdownTable(rows))
+		out.WriteString("\n")
+	}
+
+	return strings.TrimSpace(out.String()), nil
+}
+
+func xlsxSharedStrings(doc *officeDocument) ([]string, error) {
+	data, err := doc.read("xl/sharedStrings.xml")
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var (
+		values   []string
+		current  strings.Builder
+		inText   bool
+		phonetic bool
+	)
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read shared strings: %w", err)
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "si":
+				current.Reset()
+			case "rPh":
+				phonetic = true
+			case "t":
+				inText = !phonetic
+			}
+		case xml.CharData:
+			if inText {
+				current.Write(el)
+			}
+		case xml.EndElement:
+			switch el.Name.Local {
+			case "t":
+				inText = false
+			case "rPh":
+				phonetic = false
+			case "si":
+				values = append(values, current.String())
+			}
+		}
+	}
+}
+
+// xlsxRows returns the non-empty rows of the sheet with the cells in their columns
+func xlsxRows(data []byte, sharedStrings []string) ([][]string, error) {
+	var (
+		rows      [][]string
+		row       []string
+		cellType  string
+		column    int
+		value     strings.Builder
+		inValue   bool
+		nextIndex int
+	)
+
+	dec := xml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			switch el.Name.Local {
+			case "row":
+				row = nil
+				nextIndex = 0
+			case "c":
+				cellType = attr(el, "t")
+				column = nextIndex
+				if ref := attr(el, "r"); ref != "" {
+					column = columnIndex(ref)
+				}
+				value.Reset()
+			case "v", "t":
+				inValue = true
+			}
+		case xml.CharData:
+			if inValue {
+				value.Write(el)
+			}
+		case xml.EndElement:
+			switch el.Name.Local {
+			case "v", "t":
+				inValue = false
+			case "c":
+				nextIndex = column + 1
+
+				text := value.String()
+				switch cellType {
+				case "s":
+					idx, err := strconv.Atoi(strings.TrimSpace(text))
+					if err == nil && idx >= 0 && idx < len(sharedStrings) {
+						text = sharedStrings[idx]
+					}
+				case "b":
+					text = map[string]string{"0": "FALSE", "1": "TRUE"}[text]
+				}
+
+				if strings.TrimSpace(text) == "" || column >= maxSheetColumns {
+					continue
+				}
+				for len(row) <= column {
+					row = append(row, "")
+				}
+				row[column] = text
+			case "row":
+				if len(row) > 0 {
+					rows = append(rows, row)
+				}
+			}
+		}
+	}
+}
+
+// columnIndex returns the zero based column of a cell reference such as "AB12"
+func columnIndex(ref string) int {
+	column := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		column = column*26 + int(c-'A'+1)
+	}
+	return column - 1
+}
@@ -0,0 +1,831 @@
+package extract
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+var errPDFNoText = errors.New("no text layer found in the PDF document")
+
+const (
+	// Limit of nested form XObjects
+	maxPDFFormDepth = 8
+	// Glyph width used when the font doesn't define it, in thousandths of em
+	defaultGlyphWidth = 500
+)
+
+// extractPDF returns the text layer of the PDF as markdown, pages start with a
+// page marker and the lines set in a larger font than the body are headings
+func extractPDF(data []byte) (string, error) {
+	doc, err := parsePDF(data)
+	if err != nil {
+		return "", err
+	}
+
+	pages, err := doc.pages()
+	if err != nil {
+		return "", err
+	}
+
+	fonts := make(map[pdfRef]*pdfFont)
+
+	pageLines := make([][]*pdfLine, 0, len(pages))
+	for _, page := range pages {
+		w := &pdfTextWriter{}
+		interp := &pdfInterpreter{doc: doc, fonts: fonts, writer: w}
+		interp.run(doc.contents(page.dict["Contents"]), page.resources, 0)
+		pageLines = append(pageLines, w.lines)
+	}
+
+	body := bodyFontSize(pageLines)
+
+	var (
+		sb      strings.Builder
+		hasText bool
+	)
+
+	for idx, lines := range pageLines {
+		if idx > 0 {
+			sb.WriteString("\n\n")
+		}
+		sb.WriteString(PageMarker(idx + 1))
+		sb.WriteString("\n")
+
+		var (
+			out         []string
+			lastHeading int
+		)
+
+		for _, line := range lines {
+			text := strings.TrimSpace(line.text.String())
+			if text == "" {
+				continue
+			}
+
+			heading := headingLevel(line.size, body, text)
+
+			switch {
+			case heading > 0 && heading == lastHeading && !line.paragraph:
+				// Headings wrapped on multiple lines
+				out[len(out)-1] += " " + text
+			case heading > 0:
+				out = append(out, "", strings.Repeat("#", heading)+" "+text)
+			case len(out) == 0 || line.paragraph || lastHeading > 0:
+				out = append(out, "", text)
+			default:
+				out = append(out, text)
+			}
+
+			lastHeading = heading
+		}
+
+		if len(out) > 0 {
+			hasText = true
+			sb.WriteString(strings.Join(out, "\n"))
+			sb.WriteString("\n")
+		}
+	}
+
+	if !hasText {
+		return "", errPDFNoText
+	}
+
+	return ligatures.Replace(strings.TrimSpace(sb.String())), nil
+}
+
+// ligatures are split so the words can be searched
+var ligatures = strings.NewReplacer("ﬀ", "ff", "ﬁ", "fi", "ﬂ", "fl", "ﬃ", "ffi", "ﬄ", "ffl", "ﬅ", "st", "ﬆ", "st")
+
+// bodyFontSize is the font size of the most characters
+func bodyFontSize(pages [][]*pdfLine) float64 {
+	counts := make(map[float64]int)
+	for _, lines := range pages {
+		for _, line := range lines {
+			counts[math.Round(line.size*2)/2] += line.text.Len()
+		}
+	}
+
+	var (
+		body float64
+		max  int
+	)
+	for size, count := range counts {
+		if count > max || (count == max && size < body) {
+			body, max = size, count
+		}
+	}
+
+	return body
+}
+
+func headingLevel(size, body float64, text string) int {
+	if body <= 0 || size < body*1.15 || len(text) > 150 {
+		return 0
+	}
+
+	if strings.IndexFunc(text, unicode.IsLetter) < 0 {
+		return 0
+	}
+
+	switch {
+	case size >= body*1.6:
+		return 1
+	case size >= body*1.3:
+		return 2
+	default:
+		return 3
+	}
+}
+
+type pdfLine struct {
+	text strings.Builder
+	size float64
+	y    float64
+	// paragraph is set when the line is separated by more than a line from the previous one
+	paragraph bool
+}
+
+// pdfTextWriter assembles the shown strings into lines, using their positions
+// to add the spaces and the line breaks that are not in the text itself
+type pdfTextWriter struct {
+	lines []*pdfLine
+
+	lastX, lastY float64
+}
+
+func (w *pdfTextWriter) write(text string, x, y, endX, size float64) {
+	if text == "" {
+		return
+	}
+
+	if size <= 0 {
+		size = 1
+	}
+
+	var line *pdfLine
+	if len(w.lines) > 0 {
+		line = w.lines[len(w.lines)-1]
+	}
+
+	if line == nil || math.Abs(y-w.lastY) > size*0.5 {
+		next := &pdfLine{size: size, y: y}
+		if line != nil && math.Abs(line.y-y) > math.Max(line.size, size)*1.8 {
+			next.paragraph = true
+		}
+		w.lines = append(w.lines, next)
+		line = next
+	} else if x-w.lastX > size*0.15 || x < w.lastX-size {
+		current := line.text.String()
+		if !strings.HasSuffix(current, " ") && !strings.HasPrefix(text, " ") {
+			line.text.WriteString(" ")
+		}
+	}
+
+	if strings.TrimSpace(text) != "" && size > line.size {
+		line.size = size
+	}
+
+	line.text.WriteString(text)
+
+	w.lastX = endX
+	w.lastY = y
+}
+
+type pdfTextState struct {
+	// ctm is the current transformation matrix, saved and restored
+	// with the text parameters by the q and Q operators
+	ctm [6]float64
+
+	font        *pdfFont
+	size        float64
+	charSpacing float64
+	wordSpacing float64
+	scale       float64
+	leading     float64
+
+	tm  [6]float64
+	tlm [6]float64
+}
+
+type pdfInterpreter struct {
+	doc    *pdfDocument
+	fonts  map[pdfRef]*pdfFont
+	writer *pdfTextWriter
+	state  pdfTextState
+	saved  []pdfTextState
+}
+
+var identityMatrix = [6]float64{1, 0, 0, 1, 0, 0}
+
+func (p *pdfInterpreter) run(content []byte, resources pdfDict, depth int) {
+	if depth > maxPDFFormDepth {
+		return
+	}
+
+	if depth == 0 {
+		p.state = pdfTextState{scale: 100, ctm: identityMatrix, tm: identityMatrix, tlm: identityMatrix}
+	}
+
+	l := &pdfLexer{data: content}
+
+	var operands []any
+
+	for {
+		obj, err := l.readObject(0)
+		if err != nil {
+			return
+		}
+
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		p.operator(l, string(op), operands, resources, depth)
+		operands = operands[:0]
+	}
+}
+
+func (p *pdfInterpreter) operator(l *pdfLexer, op string, operands []any, resources pdfDict, depth int) {
+	s := &p.state
+
+	num := func(i int) float64 {
+		if i < len(operands) {
+			if f, ok := operands[i].(float64); ok {
+				return f
+			}
+		}
+		return 0
+	}
+
+	switch op {
+	case "q":
+		p.saved = append(p.saved, *s)
+	case "Q":
+		if len(p.saved) > 0 {
+			tm, tlm := s.tm, s.tlm
+			*s = p.saved[len(p.saved)-1]
+			s.tm, s.tlm = tm, tlm
+			p.saved = p.saved[:len(p.saved)-1]
+		}
+	case "cm":
+		if len(operands) >= 6 {
+			var m [6]float64
+			for i := range m {
+				m[i] = num(i)
+			}
+			s.ctm = multiplyMatrix(m, s.ctm)
+		}
+	case "BT":
+		s.tm = identityMatrix
+		s.tlm = identityMatrix
+	case "Tf":
+		if len(operands) >= 2 {
+			if name, ok := operands[0].(pdfName); ok {
+				s.font = p.font(resources, name)
+			}
+			s.size = num(1)
+		}
+	case "Tc":
+		s.charSpacing = num(0)
+	case "Tw":
+		s.wordSpacing = num(0)
+	case "Tz":
+		s.scale = num(0)
+	case "TL":
+		s.leading = num(0)
+	case "Td":
+		p.moveLine(num(0), num(1))
+	case "TD":
+		s.leading = -num(1)
+		p.moveLine(num(0), num(1))
+	case "Tm":
+		if len(operands) >= 6 {
+			for i := range s.tm {
+				s.tm[i] = num(i)
+			}
+			s.tlm = s.tm
+		}
+	case "T*":
+		p.moveLine(0, -s.leading)
+	case "Tj":
+		if len(operands) > 0 {
+			p.show(operands[0])
+		}
+	case "'":
+		p.moveLine(0, -s.leading)
+		if len(operands) > 0 {
+			p.show(operands[0])
+		}
+	case "\"":
+		if len(operands) >= 3 {
+			s.wordSpacing = num(0)
+			s.charSpacing = num(1)
+			p.moveLine(0, -s.leading)
+			p.show(operands[2])
+		}
+	case "TJ":
+		if len(operands) == 0 {
+			return
+		}
+		arr, _ := operands[0].(pdfArray)
+		for _, item := range arr {
+			switch v := item.(type) {
+			case pdfString:
+				p.show(v)
+			case float64:
+				p.advance(-v / 1000 * s.size * s.scale / 100)
+			}
+		}
+	case "Do":
+		if len(operands) > 0 {
+			if name, ok := operands[0].(pdfName); ok {
+				p.form(resources, name, depth)
+			}
+		}
+	case "ID":
+		// Inline image data, skipped until the EI operator
+		for l.pos+2 < len(l.data) {
+			if isPDFSpace(l.data[l.pos]) && l.data[l.pos+1] == 'E' && l.data[l.pos+2] == 'I' &&
+				(l.pos+3 == len(l.data) || isPDFSpace(l.data[l.pos+3])) {
+				l.pos += 3
+				return
+			}
+			l.pos++
+		}
+		l.pos = len(l.data)
+	}
+}
+
+func (p *pdfInterpreter) moveLine(tx, ty float64) {
+	m := p.state.tlm
+	m[4] += tx*m[0] + ty*m[2]
+	m[5] += tx*m[1] + ty*m[3]
+	p.state.tlm = m
+	p.state.tm = m
+}
+
+// advance moves the text position by the displacement in text space units
+func (p *pdfInterpreter) advance(tx float64) {
+	p.state.tm[4] += tx * p.state.tm[0]
+	p.state.tm[5] += tx * p.state.tm[1]
+}
+
+func (p *pdfInterpreter) show(obj any) {
+	str, ok := obj.(pdfString)
+	if !ok {
+		return
+	}
+
+	s := &p.state
+
+	font := s.font
+	if font == nil {
+		font = defaultPDFFont
+	}
+
+	var (
+		text  strings.Builder
+		width float64
+	)
+
+	for _, code := range font.codes(str) {
+		text.WriteString(font.text(code))
+
+		w := font.width(code)/1000*s.size + s.charSpacing
+		if code == ' ' && font.codeBytes == 1 {
+			w += s.wordSpacing
+		}
+		width += w * s.scale / 100
+	}
+
+	// Positions and sizes are compared in the device space
+	trm := multiplyMatrix(s.tm, s.ctm)
+	x, y := trm[4], trm[5]
+	size := s.size * math.Hypot(trm[2], trm[3])
+
+	p.advance(width)
+
+	endX := multiplyMatrix(s.tm, s.ctm)[4]
+
+	p.writer.write(text.String(), x, y, endX, math.Abs(size))
+}
+
+// multiplyMatrix returns m1 × m2 of the PDF matrices [a b c d e f]
+func multiplyMatrix(m1, m2 [6]float64) [6]float64 {
+	return [6]float64{
+		m1[0]*m2[0] + m1[1]*m2[2],
+		m1[0]*m2[1] + m1[1]*m2[3],
+		m1[2]*m2[0] + m1[3]*m2[2],
+		m1[2]*m2[1] + m1[3]*m2[3],
+		m1[4]*m2[0] + m1[5]*m2[2] + m2[4],
+		m1[4]*m2[1] + m1[5]*m2[3] + m2[5],
+	}
+}
+
+func (p *pdfInterpreter) font(resources pdfDict, name pdfName) *pdfFont {
+	fonts := p.doc.dict(resources["Font"])
+	if fonts == nil {
+		return nil
+	}
+
+	ref, isRef := fonts[name].(pdfRef)
+	if isRef {
+		if f, ok := p.fonts[ref]; ok {
+			return f
+		}
+	}
+
+	f := loadPDFFont(p.doc, p.doc.dict(fonts[name]))
+	if isRef {
+		p.fonts[ref] = f
+	}
+
+	return f
+}
+
+// form runs the content of the form XObject, forms are often used for repeated
+// content such as the headers and the footers
+func (p *pdfInterpreter) form(resources pdfDict, name pdfName, depth int) {
+	xobjects := p.doc.dict(resources["XObject"])
+	if xobjects == nil {
+		return
+	}
+
+	stream, ok := p.doc.resolve(xobjects[name]).(*pdfStream)
+	if !ok || stream.dict["Subtype"] != pdfName("Form") {
+		return
+	}
+
+	data, err := p.doc.decodeStream(stream)
+	if err != nil {
+		return
+	}
+
+	formResources := p.doc.dict(stream.dict["Resources"])
+	if formResources == nil {
+		formResources = resources
+	}
+
+	saved, savedStack := p.state, p.saved
+
+	if matrix, ok := p.doc.resolve(stream.dict["Matrix"]).(pdfArray); ok && len(matrix) == 6 {
+		var m [6]float64
+		for i := range m {
+			m[i], _ = p.doc.resolve(matrix[i]).(float64)
+		}
+		p.state.ctm = multiplyMatrix(m, p.state.ctm)
+	}
+
+	p.run(data, formResources, depth+1)
+	p.state, p.saved = saved, savedStack
+}
+
+// pdfFont maps the character codes of the strings to text and glyph widths
+type pdfFont struct {
+	// codeBytes is 2 for the composite fonts
+	codeBytes    int
+	toUnicode    map[int]string
+	encoding     *[256]string
+	widths       map[int]float64
+	defaultWidth float64
+}
+
+var defaultPDFFont = &pdfFont{
+	codeBytes:    1,
+	encoding:     &winAnsiEncoding,
+	defaultWidth: defaultGlyphWidth,
+}
+
+func loadPDFFont(doc *pdfDocument, dict pdfDict) *pdfFont {
+	if dict == nil {
+		return nil
+	}
+
+	f := &pdfFont{
+		codeBytes:    1,
+		widths:       make(map[int]float64),
+		defaultWidth: defaultGlyphWidth,
+	}
+
+	if dict["Subtype"] == pdfName("Type0") {
+		f.codeBytes = 2
+		f.defaultWidth = 1000
+
+		if descendants, ok := doc.resolve(dict["DescendantFonts"]).(pdfArray); ok && len(descendants) > 0 {
+			f.loadCIDWidths(doc, doc.dict(descendants[0]))
+		}
+	} else {
+		f.encoding = loadSimpleEncoding(doc, dict)
+		f.loadSimpleWidths(doc, dict)
+	}
+
+	if stream, ok := doc.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := doc.decodeStream(stream); err == nil {
+			f.toUnicode = parseToUnicode(data)
+		}
+	}
+
+	return f
+}
+
+func (f *pdfFont) loadSimpleWidths(doc *pdfDocument, dict pdfDict) {
+	if descriptor := doc.dict(dict["FontDescriptor"]); descriptor != nil {
+		if missing, ok := doc.resolve(descriptor["MissingWidth"]).(float64); ok && missing > 0 {
+			f.defaultWidth = missing
+		}
+	}
+
+	first, _ := doc.resolve(dict["FirstChar"]).(float64)
+	widths, _ := doc.resolve(dict["Widths"]).(pdfArray)
+
+	for i, w := range widths {
+		if width, ok := doc.resolve(w).(float64); ok {
+			f.widths[int(first)+i] = width
+		}
+	}
+}
+
+// loadCIDWidths reads the W array of the descendant font, entries are either
+// "first [w1 w2 ...]" or "first last w"
+func (f *pdfFont) loadCIDWidths(doc *pdfDocument, dict pdfDict) {
+	if dict == nil {
+		return
+	}
+
+	if dw, ok := doc.resolve(dict["DW"]).(float64); ok {
+		f.defaultWidth = dw
+	}
+
+	w, _ := doc.resolve(dict["W"]).(pdfArray)
+
+	for i := 0; i+1 < len(w); {
+		first, ok := doc.resolve(w[i]).(float64)
+		if !ok {
+			return
+		}
+
+		switch next := doc.resolve(w[i+1]).(type) {
+		case pdfArray:
+			for j, width := range next {
+				if v, ok := doc.resolve(width).(float64); ok {
+					f.widths[int(first)+j] = v
+				}
+			}
+			i += 2
+		case float64:
+			if i+2 >= len(w) {
+				return
+			}
+			width, _ := doc.resolve(w[i+2]).(float64)
+			for code := int(first); code <= int(next) && code-int(first) < 65536; code++ {
+				f.widths[code] = width
+			}
+			i += 3
+		default:
+			return
+		}
+	}
+}
+
+func (f *pdfFont) codes(str pdfString) []int {
+	if f.codeBytes == 2 {
+		codes := make([]int, 0, len(str)/2)
+		for i := 0; i+1 < len(str); i += 2 {
+			codes = append(codes, int(str[i])<<8|int(str[i+1]))
+		}
+		return codes
+	}
+
+	codes := make([]int, len(str))
+	for i, b := range str {
+		codes[i] = int(b)
+	}
+	return codes
+}
+
+func (f *pdfFont) text(code int) string {
+	if text, ok := f.toUnicode[code]; ok {
+		return text
+	}
+
+	if f.encoding != nil && code < 256 {
+		return f.encoding[code]
+	}
+
+	// Composite fonts without a ToUnicode map can't be decoded
+	return ""
+}
+
+func (f *pdfFont) width(code int) float64 {
+	if w, ok := f.widths[code]; ok && w > 0 {
+		return w
+	}
+	return f.defaultWidth
+}
+
+// parseToUnicode reads the bfchar and bfrange mappings of a ToUnicode CMap
+func parseToUnicode(data []byte) map[int]string {
+	mapping := make(map[int]string)
+
+	l := &pdfLexer{data: data}
+
+	var operands []any
+
+	for {
+		obj, err := l.readObject(0)
+		if err != nil {
+			return mapping
+		}
+
+		kw, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch kw {
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok := operands[i].(pdfString)
+				if !ok {
+					continue
+				}
+				if dst, ok := operands[i+1].(pdfString); ok {
+					mapping[bytesToCode(src)] = utf16String(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(pdfString)
+				hi, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 {
+					continue
+				}
+				addBFRange(mapping, bytesToCode(lo), bytesToCode(hi), operands[i+2])
+			}
+		}
+
+		operands = operands[:0]
+	}
+}
+
+func addBFRange(mapping map[int]string, lo, hi int, dst any) {
+	if hi < lo || hi-lo > 65535 {
+		return
+	}
+
+	switch v := dst.(type) {
+	case pdfString:
+		if len(v) == 0 {
+			return
+		}
+		for code := lo; code <= hi; code++ {
+			// The last byte is incremented through the range
+			next := append(pdfString(nil), v...)
+			next[len(next)-1] += byte(code - lo)
+			mapping[code] = utf16String(next)
+		}
+	case pdfArray:
+		for i, item := range v {
+			if s, ok := item.(pdfString); ok && lo+i <= hi {
+				mapping[lo+i] = utf16String(s)
+			}
+		}
+	}
+}
+
+func bytesToCode(b []byte) int {
+	code := 0
+	for _, c := range b {
+		code = code<<8 | int(c)
+	}
+	return code
+}
+
+func utf16String(b []byte) string {
+	if len(b)%2 == 1 {
+		return string(b)
+	}
+
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+
+	return string(utf16.Decode(units))
+}
+
+// loadSimpleEncoding returns the code to text table of a simple font, the
+// Differences array overrides the codes of the base encoding
+func loadSimpleEncoding(doc *pdfDocument, dict pdfDict) *[256]string {
+	encoding := winAnsiEncoding
+
+	switch v := doc.resolve(dict["Encoding"]).(type) {
+	case pdfDict:
+		code := 0
+		differences, _ := doc.resolve(v["Differences"]).(pdfArray)
+		for _, item := range differences {
+			switch d := item.(type) {
+			case float64:
+				code = int(d)
+			case pdfName:
+				if code >= 0 && code < 256 {
+					encoding[code] = glyphText(string(d))
+				}
+				code++
+			}
+		}
+	}
+
+	return &encoding
+}
+
+// winAnsiEncoding is also used for the standard and the Mac encodings, they only
+// differ in a few symbols
+var winAnsiEncoding = func() [256]string {
+	var table [256]string
+
+	for c := 0x20; c < 0x7f; c++ {
+		table[c] = string(rune(c))
+	}
+	for c := 0xa0; c <= 0xff; c++ {
+		table[c] = string(rune(c))
+	}
+	table[0xa0] = " "
+	table['\t'] = " "
+
+	for code, r := range map[int]rune{
+		0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡', 0x88: 'ˆ',
+		0x89: '‰', 0x8a: 'Š', 0x8b: '‹', 0x8c: 'Œ', 0x8e: 'Ž', 0x91: '‘', 0x92: '’', 0x93: '“',
+		0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—', 0x98: '˜', 0x99: '™', 0x9a: 'š', 0x9b: '›',
+		0x9c: 'œ', 0x9e: 'ž', 0x9f: 'Ÿ',
+	} {
+		table[code] = string(r)
+	}
+
+	return table
+}()
+
+// glyphNames covers the glyph names of the Differences arrays that are not
+// single characters or uniXXXX names
+var glyphNames = map[string]string{
+	"space": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#", "dollar": "$", "percent": "%",
+	"ampersand": "&", "quotesingle": "'", "quoteright": "’", "quoteleft": "‘", "parenleft": "(",
+	"parenright": ")", "asterisk": "*", "plus": "+", "comma": ",", "hyphen": "-", "minus": "−",
+	"period": ".", "slash": "/", "zero": "0", "one": "1", "two": "2", "three": "3", "four": "4",
+	"five": "5", "six": "6", "seven": "7", "eight": "8", "nine": "9", "colon": ":", "semicolon": ";",
+	"less": "<", "equal": "=", "greater": ">", "question": "?", "at": "@", "bracketleft": "[",
+	"backslash": "\\", "bracketright": "]", "asciicircum": "^", "underscore": "_", "grave": "`",
+	"braceleft": "{", "bar": "|", "braceright": "}", "asciitilde": "~", "bullet": "•",
+	"endash": "–", "emdash": "—", "quotedblleft": "“", "quotedblright": "”", "quotesinglbase": "‚",
+	"quotedblbase": "„", "ellipsis": "…", "dagger": "†", "daggerdbl": "‡", "degree": "°",
+	"copyright": "©", "registered": "®", "trademark": "™", "section": "§", "paragraph": "¶",
+	"fi": "fi", "fl": "fl", "ff": "ff", "ffi": "ffi", "ffl": "ffl", "nbspace": " ", "Euro": "€",
+	"sterling": "£", "yen": "¥", "cent": "¢", "multiply": "×", "divide": "÷", "periodcentered": "·",
+	"eacute": "é", "egrave": "è", "ecircumflex": "ê", "edieresis": "ë", "aacute": "á", "agrave": "à",
+	"acircumflex": "â", "adieresis": "ä", "atilde": "ã", "aring": "å", "ccedilla": "ç", "iacute": "í",
+	"igrave": "ì", "icircumflex": "î", "idieresis": "ï", "ntilde": "ñ", "oacute": "ó", "ograve": "ò",
+	"ocircumflex": "ô", "odieresis": "ö", "otilde": "õ", "oslash": "ø", "uacute": "ú", "ugrave": "ù",
+	"ucircumflex": "û", "udieresis": "ü", "germandbls": "ß", "Eacute": "É", "Adieresis": "Ä",
+	"Odieresis": "Ö", "Udieresis": "Ü",
+}
+
+func glyphText(name string) string {
+	// Variants such as "a.sc" or "one.oldstyle"
+	if idx := strings.IndexByte(name, '.'); idx > 0 {
+		name = name[:idx]
+	}
+
+	// Ligatures such as "f_f_i"
+	if strings.Contains(name, "_") {
+		var sb strings.Builder
+		for _, part := range strings.Split(name, "_") {
+			sb.WriteString(glyphText(part))
+		}
+		return sb.String()
+	}
+
+	if len(name) == 1 {
+		return name
+	}
+
+	if text, ok := glyphNames[name]; ok {
+		return text
+	}
+
+	for _, prefix := range []string{"uni", "u"} {
+		if hexCode, ok := strings.CutPrefix(name, prefix); ok && len(hexCode) >= 4 {
+			if code, err := strconv.ParseUint(hexCode[:4], 16, 32); err == nil {
+				return string(rune(code))
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,720 @@
+package extract
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/ascii85"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+)
+
+// Minimal PDF object parser, enough to read the page tree, the fonts and the
+// content streams of unencrypted documents. Objects are found by scanning the
+// file instead of reading the cross-reference tables, which also covers the
+// documents with broken offsets.
+
+const (
+	// Upper bound of a decoded stream, protects against compression bombs
+	maxPDFStreamSize = 64 * 1024 * 1024
+	// Limit of nested arrays and dictionaries
+	maxPDFNesting = 64
+)
+
+var (
+	errPDFEncrypted = errors.New("encrypted PDF documents are not supported")
+	errPDFNoPages   = errors.New("no pages found in the PDF document")
+)
+
+type (
+	pdfName    string
+	pdfKeyword string
+	pdfString  []byte
+	pdfArray   []any
+	pdfDict    map[pdfName]any
+)
+
+type pdfRef struct {
+	num int
+	gen int
+}
+
+type pdfStream struct {
+	dict pdfDict
+	raw  []byte
+}
+
+type pdfDocument struct {
+	objects map[int]any
+	trailer pdfDict
+}
+
+var pdfObjectHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+func parsePDF(data []byte) (*pdfDocument, error) {
+	if !bytes.HasPrefix(bytes.TrimLeft(data, "\x00\t\n\f\r "), []byte("%PDF-")) {
+		return nil, fmt.Errorf("not a PDF document")
+	}
+
+	doc := &pdfDocument{
+		objects: make(map[int]any),
+		trailer: pdfDict{},
+	}
+
+	// Later definitions override the earlier ones, as with incremental updates
+	for pos := 0; pos < len(data); {
+		loc := pdfObjectHeader.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+
+		num, _ := strconv.Atoi(string(data[pos+loc[2] : pos+loc[3]]))
+		start := pos + loc[1]
+
+		l := &pdfLexer{data: data, pos: start}
+		obj, err := l.readObject(0)
+		if err != nil {
+			pos = start
+			continue
+		}
+		doc.objects[num] = obj
+		pos = l.pos
+	}
+
+	// Trailers of the files with cross-reference tables
+	for pos := 0; ; {
+		idx := bytes.Index(data[pos:], []byte("trailer"))
+		if idx < 0 {
+			break
+		}
+		l := &pdfLexer{data: data, pos: pos + idx + len("trailer")}
+		if obj, err := l.readObject(0); err == nil {
+			if dict, ok := obj.(pdfDict); ok {
+				doc.mergeTrailer(dict)
+			}
+		}
+		pos += idx + len("trailer")
+	}
+
+	// Cross-reference streams hold the trailer entries, objects streams the
+	// objects of the files saved with compression
+	var objectStreams []*pdfStream
+	for _, obj := range doc.objects {
+		stream, ok := obj.(*pdfStream)
+		if !ok {
+			continue
+		}
+		switch stream.dict["Type"] {
+		case pdfName("XRef"):
+			doc.mergeTrailer(stream.dict)
+		case pdfName("ObjStm"):
+			objectStreams = append(objectStreams, stream)
+		}
+	}
+
+	for _, stream := range objectStreams {
+		doc.readObjectStream(stream)
+	}
+
+	if _, ok := doc.trailer["Encrypt"]; ok {
+		return nil, errPDFEncrypted
+	}
+
+	return doc, nil
+}
+
+func (doc *pdfDocument) mergeTrailer(dict pdfDict) {
+	for k, v := range dict {
+		switch k {
+		case "Root", "Encrypt", "Info":
+			doc.trailer[k] = v
+		}
+	}
+}
+
+// readObjectStream adds the objects of the stream that are not defined directly in the file
+func (doc *pdfDocument) readObjectStream(stream *pdfStream) {
+	data, err := doc.decodeStream(stream)
+	if err != nil {
+		return
+	}
+
+	n, _ := doc.resolve(stream.dict["N"]).(float64)
+	first, _ := doc.resolve(stream.dict["First"]).(float64)
+	if n <= 0 || first <= 0 || int(first) > len(data) {
+		return
+	}
+
+	header := &pdfLexer{data: data[:int(first)]}
+	for i := 0; i < int(n); i++ {
+		num, err1 := header.readObject(0)
+		offset, err2 := header.readObject(0)
+		if err1 != nil || err2 != nil {
+			return
+		}
+
+		objNum, ok1 := num.(float64)
+		objOffset, ok2 := offset.(float64)
+		if !ok1 || !ok2 {
+			return
+		}
+
+		if _, ok := doc.objects[int(objNum)]; ok {
+			continue
+		}
+
+		l := &pdfLexer{data: data, pos: int(first) + int(objOffset)}
+		obj, err := l.readObject(0)
+		if err != nil {
+			continue
+		}
+		doc.objects[int(objNum)] = obj
+	}
+}
+
+// resolve follows the references, direct objects are returned as is
+func (doc *pdfDocument) resolve(obj any) any {
+	for i := 0; i < 32; i++ {
+		ref, ok := obj.(pdfRef)
+		if !ok {
+			return obj
+		}
+		obj = doc.objects[ref.num]
+	}
+	return nil
+}
+
+func (doc *pdfDocument) dict(obj any) pdfDict {
+	switch v := doc.resolve(obj).(type) {
+	case pdfDict:
+		return v
+	case *pdfStream:
+		return v.dict
+	}
+	return nil
+}
+
+func (doc *pdfDocument) catalog() pdfDict {
+	if root := doc.dict(doc.trailer["Root"]); root != nil {
+		return root
+	}
+
+	for _, obj := range doc.objects {
+		if dict, ok := obj.(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+			return dict
+		}
+	}
+
+	return nil
+}
+
+// pdfPage is a page with the resources inherited from the page tree
+type pdfPage struct {
+	dict      pdfDict
+	resources pdfDict
+}
+
+func (doc *pdfDocument) pages() ([]*pdfPage, error) {
+	catalog := doc.catalog()
+	if catalog == nil {
+		return nil, errPDFNoPages
+	}
+
+	var pages []*pdfPage
+	visited := make(map[any]bool)
+
+	var walk func(node any, resources pdfDict, depth int)
+	walk = func(node any, resources pdfDict, depth int) {
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref] {
+				return
+			}
+			visited[ref] = true
+		}
+
+		dict := doc.dict(node)
+		if dict == nil || depth > maxPDFNesting {
+			return
+		}
+
+		if res := doc.dict(dict["Resources"]); res != nil {
+			resources = res
+		}
+
+		kids, ok := doc.resolve(dict["Kids"]).(pdfArray)
+		if !ok {
+			if dict["Type"] == pdfName("Page") || dict["Contents"] != nil {
+				pages = append(pages, &pdfPage{dict: dict, resources: resources})
+			}
+			return
+		}
+
+		for _, kid := range kids {
+			walk(kid, resources, depth+1)
+		}
+	}
+
+	walk(catalog["Pages"], nil, 0)
+
+	if len(pages) == 0 {
+		return nil, errPDFNoPages
+	}
+
+	return pages, nil
+}
+
+// contents returns the concatenated content streams of the page
+func (doc *pdfDocument) contents(obj any) []byte {
+	var buf bytes.Buffer
+
+	switch v := doc.resolve(obj).(type) {
+	case *pdfStream:
+		data, _ := doc.decodeStream(v)
+		buf.Write(data)
+	case pdfArray:
+		for _, item := range v {
+			if stream, ok := doc.resolve(item).(*pdfStream); ok {
+				data, _ := doc.decodeStream(stream)
+				buf.Write(data)
+				buf.WriteByte('\n')
+			}
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func (doc *pdfDocument) decodeStream(stream *pdfStream) ([]byte, error) {
+	var filters []any
+
+	switch f := doc.resolve(stream.dict["Filter"]).(type) {
+	case pdfName:
+		filters = []any{f}
+	case pdfArray:
+		filters = f
+	}
+
+	data := stream.raw
+
+	for _, filter := range filters {
+		var err error
+
+		switch doc.resolve(filter) {
+		case pdfName("FlateDecode"), pdfName("Fl"):
+			data, err = inflate(data)
+		case pdfName("ASCIIHexDecode"), pdfName("AHx"):
+			data, err = decodeASCIIHex(data)
+		case pdfName("ASCII85Decode"), pdfName("A85"):
+			data, err = decodeASCII85(data)
+		default:
+			// Images and the rarely used filters
+			return nil, fmt.Errorf("unsupported filter %v", filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+// inflate returns the data decompressed so far on errors, truncated
+// streams are common and the beginning is still usable
+func inflate(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	out, err := io.ReadAll(io.LimitReader(r, maxPDFStreamSize))
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+
+	return out, nil
+}
+
+func decodeASCIIHex(data []byte) ([]byte, error) {
+	if idx := bytes.IndexByte(data, '>'); idx >= 0 {
+		data = data[:idx]
+	}
+
+	digits := make([]byte, 0, len(data)+1)
+	for _, c := range data {
+		if isPDFSpace(c) {
+			continue
+		}
+		digits = append(digits, c)
+	}
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	return hex.DecodeString(string(digits))
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if idx := bytes.Index(data, []byte("~>")); idx >= 0 {
+		data = data[:idx]
+	}
+
+	out := make([]byte, 4*len(data))
+	n, _, err := ascii85.Decode(out, data, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return out[:n], nil
+}
+
+// pdfLexer reads the objects of the PDF syntax, also used for the content streams
+// where the operators are returned as keywords
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+var errPDFEOF = errors.New("unexpected end of PDF data")
+
+func isPDFSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// readObject reads the next object, references "1 0 R" are combined from the
+// integers and streams are read after their dictionary
+func (l *pdfLexer) readObject(depth int) (any, error) {
+	obj, err := l.readToken(depth)
+	if err != nil {
+		return nil, err
+	}
+
+	switch v := obj.(type) {
+	case float64:
+		if v != float64(int(v)) || v < 0 {
+			return v, nil
+		}
+		// Look ahead for the generation number and the R keyword
+		save := l.pos
+		gen, err := l.readToken(depth)
+		if g, ok := gen.(float64); ok && err == nil {
+			if kw, err := l.readToken(depth); err == nil && kw == pdfKeyword("R") {
+				return pdfRef{num: int(v), gen: int(g)}, nil
+			}
+		}
+		l.pos = save
+		return v, nil
+	case pdfDict:
+		save := l.pos
+		l.skipSpace()
+		if bytes.HasPrefix(l.data[l.pos:], []byte("stream")) {
+			return l.readStream(v), nil
+		}
+		l.pos = save
+		return v, nil
+	}
+
+	return obj, nil
+}
+
+func (l *pdfLexer) readStream(dict pdfDict) *pdfStream {
+	l.pos += len("stream")
+	if l.pos < len(l.data) && l.data[l.pos] == '\r' {
+		l.pos++
+	}
+	if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+		l.pos++
+	}
+
+	start := l.pos
+
+	// Direct lengths are trusted if the stream ends there, indirect
+	// lengths aren't resolved and the end keyword is searched instead
+	if length, ok := dict["Length"].(float64); ok {
+		end := start + int(length)
+		if end >= start && end <= len(l.data) {
+			rest := bytes.TrimLeft(l.data[end:], "\x00\t\n\f\r ")
+			if bytes.HasPrefix(rest, []byte("endstream")) {
+				l.pos = len(l.data) - len(rest) + len("endstream")
+				return &pdfStream{dict: dict, raw: l.data[start:end]}
+			}
+		}
+	}
+
+	idx := bytes.Index(l.data[start:], []byte("endstream"))
+	if idx < 0 {
+		l.pos = len(l.data)
+		return &pdfStream{dict: dict, raw: l.data[start:]}
+	}
+
+	end := start + idx
+	l.pos = end + len("endstream")
+
+	return &pdfStream{dict: dict, raw: bytes.TrimRight(l.data[start:end], "\r\n")}
+}
+
+func (l *pdfLexer) readToken(depth int) (any, error) {
+	if depth > maxPDFNesting {
+		return nil, fmt.Errorf("PDF objects nested too deeply")
+	}
+
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errPDFEOF
+	}
+
+	c := l.data[l.pos]
+
+	switch {
+	case c == '/':
+		return l.readName(), nil
+	case c == '(':
+		return l.readLiteralString(), nil
+	case c == '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return l.readDict(depth + 1)
+		}
+		return l.readHexString(), nil
+	case c == '[':
+		l.pos++
+		return l.readArray(depth + 1)
+	case c == ']' || c == '}' || c == ')':
+		l.pos++
+		return pdfKeyword(c), nil
+	case c == '>':
+		l.pos++
+		if l.pos < len(l.data) && l.data[l.pos] == '>' {
+			l.pos++
+			return pdfKeyword(">>"), nil
+		}
+		return pdfKeyword(">"), nil
+	case c == '{':
+		l.pos++
+		return pdfKeyword("{"), nil
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return l.readNumber(), nil
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	if l.pos == start {
+		// Stray delimiter
+		l.pos++
+	}
+
+	switch word := string(l.data[start:l.pos]); word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	default:
+		return pdfKeyword(word), nil
+	}
+}
+
+func (l *pdfLexer) readNumber() any {
+	start := l.pos
+	l.pos++
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if (c < '0' || c > '9') && c != '.' {
+			break
+		}
+		l.pos++
+	}
+
+	f, err := strconv.ParseFloat(string(l.data[start:l.pos]), 64)
+	if err != nil {
+		return float64(0)
+	}
+	return f
+}
+
+func (l *pdfLexer) readName() pdfName {
+	l.pos++ // "/"
+
+	var name []byte
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isPDFSpace(c) || isPDFDelimiter(c) {
+			break
+		}
+		if c == '#' && l.pos+2 < len(l.data) {
+			if b, err := hex.DecodeString(string(l.data[l.pos+1 : l.pos+3])); err == nil {
+				name = append(name, b[0])
+				l.pos += 3
+				continue
+			}
+		}
+		name = append(name, c)
+		l.pos++
+	}
+
+	return pdfName(name)
+}
+
+func (l *pdfLexer) readLiteralString() pdfString {
+	l.pos++ // "("
+
+	var (
+		out   []byte
+		depth = 1
+	)
+
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			e := l.data[l.pos]
+			l.pos++
+
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				// Line continuation
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					out = append(out, byte(v))
+				} else {
+					out = append(out, e)
+				}
+			}
+			continue
+		}
+
+		out = append(out, c)
+	}
+
+	return out
+}
+
+func (l *pdfLexer) readHexString() pdfString {
+	l.pos++ // "<"
+
+	end := bytes.IndexByte(l.data[l.pos:], '>')
+	if end < 0 {
+		end = len(l.data) - l.pos
+	}
+
+	decoded, _ := decodeASCIIHex(l.data[l.pos : l.pos+end])
+	l.pos += end + 1
+
+	return decoded
+}
+
+func (l *pdfLexer) readArray(depth int) (pdfArray, error) {
+	var arr pdfArray
+
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return arr, errPDFEOF
+		}
+		if l.data[l.pos] == ']' {
+			l.pos++
+			return arr, nil
+		}
+
+		obj, err := l.readObject(depth)
+		if err != nil {
+			return arr, err
+		}
+		arr = append(arr, obj)
+	}
+}
+
+func (l *pdfLexer) readDict(depth int) (pdfDict, error) {
+	dict := pdfDict{}
+
+	for {
+		key, err := l.readToken(depth)
+		if err != nil {
+			return dict, err
+		}
+		if key == pdfKeyword(">>") {
+			return dict, nil
+		}
+
+		name, ok := key.(pdfName)
+		if !ok {
+			// Malformed entry, skip it
+			continue
+		}
+
+		value, err := l.readObject(depth)
+		if err != nil {
+			return dict, err
+		}
+		if kw, ok := value.(pdfKeyword); ok && kw == ">>" {
+			return dict, nil
+		}
+		dict[name] = value
+	}
+}
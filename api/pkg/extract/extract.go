@@ -15,6 +15,8 @@ import (
 type Request struct {
 	URL     string `json:"url"`
 	Content []byte `json:"content"`
+	// Filename is optional, the extension helps to tell the text formats apart
+	Filename string `json:"filename,omitempty"`
 }
 
 //go:generate mockgen -source $GOFILE -destination extractor_mocks.go -package $GOPACKAGE
@@ -23,6 +25,21 @@ type Extractor interface {
 	Extract(ctx context.Context, req *Request) (string, error)
 }
 
+// Identifier is implemented by the extractors to tell apart their outputs, the
+// identity changes when the same document would be extracted differently
+type Identifier interface {
+	Identity() string
+}
+
+// Identity returns the identity of the extractor, the extractors that don't
+// implement Identifier are identified by their type
+func Identity(e Extractor) string {
+	if identifier, ok := e.(Identifier); ok {
+		return identifier.Identity()
+	}
+	return fmt.Sprintf("%T", e)
+}
+
 // DefaultExtractor is the default, llamaindex based text extractor
 // that can download URLs and uses unstructured.io under the hood
 type DefaultExtractor struct {
@@ -37,6 +54,10 @@ func NewDefaultExtractor(extractorURL string) *DefaultExtractor {
 	}
 }
 
+func (e *DefaultExtractor) Identity() string {
+	return "unstructured:" + e.extractorURL
+}
+
 func (e *DefaultExtractor) Extract(ctx context.Context, extractReq *Request) (string, error) {
 	if extractReq.URL == "" && len(extractReq.Content) == 0 {
 		return "", fmt.Errorf("no URL or content provided")
@@ -33,6 +33,10 @@ func NewTikaExtractor(extractorURL string) *TikaExtractor {
 	}
 }
 
+func (e *TikaExtractor) Identity() string {
+	return "tika:" + e.extractorURL
+}
+
 func (e *TikaExtractor) Extract(ctx context.Context, extractReq *Request) (string, error) {
 	resp, err := retry.DoWithData(func() (string, error) {
 		return e.extract(ctx, extractReq)
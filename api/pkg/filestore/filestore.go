@@ -2,8 +2,14 @@ package filestore
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"path/filepath"
+
+	"cloud.google.com/go/storage"
+	"github.com/minio/minio-go/v7"
 )
 
 type Item struct {
@@ -38,7 +44,8 @@ type Config struct {
 //go:generate mockgen -source $GOFILE -destination filestore_mocks.go -package $GOPACKAGE
 
 type FileStore interface {
-	// list the items at a certain path
+	// list the items directly under a certain path (not recursive),
+	// the item name is the base name and the path is the full path
 	List(ctx context.Context, path string) ([]Item, error)
 	Get(ctx context.Context, path string) (Item, error)
 	SignedURL(ctx context.Context, path string) (string, error)
@@ -58,3 +65,38 @@ type FileStore interface {
 func GetUserPrefix(filestorePrefix, userID string) string {
 	return filepath.Join(filestorePrefix, "users", userID)
 }
+
+// ReadFile reads the whole file, use IsNotExist to tell a missing file apart from other errors
+func ReadFile(ctx context.Context, store FileStore, path string) ([]byte, error) {
+	r, err := store.OpenFile(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	bts, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	return bts, nil
+}
+
+// IsNotExist reports whether the error means that the file doesn't exist, the
+// filestores wrap the errors of their backends
+func IsNotExist(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, storage.ErrObjectNotExist) {
+		return true
+	}
+
+	var s3Err minio.ErrorResponse
+	if errors.As(err, &s3Err) {
+		return s3Err.Code == "NoSuchKey"
+	}
+
+	return false
+}
@@ -0,0 +1,36 @@
+package filestore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/storage"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFile(t *testing.T) {
+	ctx := context.Background()
+	fs := NewFileSystemStorage(t.TempDir(), "http://localhost", "secret")
+
+	_, err := ReadFile(ctx, fs, "missing.json")
+	require.Error(t, err)
+	require.True(t, IsNotExist(err))
+
+	_, err = fs.WriteFile(ctx, "file.json", strings.NewReader("{}"))
+	require.NoError(t, err)
+
+	bts, err := ReadFile(ctx, fs, "file.json")
+	require.NoError(t, err)
+	require.Equal(t, "{}", string(bts))
+}
+
+func TestIsNotExist(t *testing.T) {
+	require.False(t, IsNotExist(nil))
+	require.False(t, IsNotExist(fmt.Errorf("connection refused")))
+	require.True(t, IsNotExist(fmt.Errorf("failed to create GCS object reader: %w", storage.ErrObjectNotExist)))
+	require.True(t, IsNotExist(fmt.Errorf("failed to open S3 object: %w", minio.ErrorResponse{Code: "NoSuchKey"})))
+	require.False(t, IsNotExist(fmt.Errorf("failed to open S3 object: %w", minio.ErrorResponse{Code: "AccessDenied"})))
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -27,14 +28,42 @@ func NewGCSStorage(ctx context.Context, bucketName, serviceAccountKeyFile string
 		return nil, fmt.Errorf("failed to create storage client: %w", err)
 	}
 
+	return NewGCSStorageFromClient(client, bucketName), nil
+}
+
+// NewGCSStorageWithCredentials creates a GCS storage from the service account key JSON.
+// If the key is empty, application default credentials are used. STORAGE_EMULATOR_HOST
+// is respected so it can be pointed to a fake GCS server.
+func NewGCSStorageWithCredentials(ctx context.Context, bucketName string, serviceAccountKey []byte) (*GCSStorage, error) {
+	var opts []option.ClientOption
+	if len(serviceAccountKey) > 0 {
+		opts = append(opts, option.WithCredentialsJSON(serviceAccountKey))
+	}
+
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage client: %w", err)
+	}
+
+	return NewGCSStorageFromClient(client, bucketName), nil
+}
+
+func NewGCSStorageFromClient(client *storage.Client, bucketName string) *GCSStorage {
 	return &GCSStorage{
 		client: client,
 		bucket: client.Bucket(bucketName),
-	}, nil
+	}
 }
 
+// List returns the objects and "directories" directly under the prefix,
+// same as listing a directory on the local filesystem
 func (s *GCSStorage) List(ctx context.Context, prefix string) ([]Item, error) {
-	it := s.bucket.Objects(ctx, &storage.Query{Prefix: prefix})
+	prefix = strings.TrimPrefix(prefix, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	it := s.bucket.Objects(ctx, &storage.Query{Prefix: prefix, Delimiter: "/"})
 	items := []Item{}
 
 	for {
@@ -43,37 +72,50 @@ func (s *GCSStorage) List(ctx context.Context, prefix string) ([]Item, error) {
 			break
 		}
 		if err != nil {
-			return []Item{}, nil
+			return nil, fmt.Errorf("error listing GCS objects: %w", err)
+		}
+
+		// Synthetic directory entry
+		if attrs.Prefix != "" {
+			items = append(items, Item{
+				Directory: true,
+				Name:      path.Base(attrs.Prefix),
+				Path:      attrs.Prefix,
+			})
+			continue
 		}
 
-		item := Item{
-			Directory: strings.HasSuffix(attrs.Name, "/"),
-			Name:      attrs.Name,
-			Path:      attrs.Name,
-			URL:       attrs.MediaLink,
-			Created:   attrs.Created.Unix(),
-			Size:      attrs.Size,
+		// Skip the folder placeholder object itself
+		if attrs.Name == prefix {
+			continue
 		}
-		items = append(items, item)
+
+		items = append(items, toGCSItem(attrs))
 	}
 
 	return items, nil
 }
 
-func (s *GCSStorage) Get(ctx context.Context, path string) (Item, error) {
-	attrs, err := s.bucket.Object(path).Attrs(ctx)
-	if err != nil {
-		return Item{}, fmt.Errorf("error fetching GCS object attributes: %w", err)
-	}
-
+// toGCSItem uses the base name as the item name, same as the other filestores,
+// the frontend joins it with the current folder
+func toGCSItem(attrs *storage.ObjectAttrs) Item {
 	return Item{
 		Directory: strings.HasSuffix(attrs.Name, "/"),
-		Name:      attrs.Name,
+		Name:      path.Base(attrs.Name),
 		Path:      attrs.Name,
 		URL:       attrs.MediaLink,
 		Created:   attrs.Created.Unix(),
 		Size:      attrs.Size,
-	}, nil
+	}
+}
+
+func (s *GCSStorage) Get(ctx context.Context, path string) (Item, error) {
+	attrs, err := s.bucket.Object(path).Attrs(ctx)
+	if err != nil {
+		return Item{}, fmt.Errorf("error fetching GCS object attributes: %w", err)
+	}
+
+	return toGCSItem(attrs), nil
 }
 
 func (s *GCSStorage) SignedURL(_ context.Context, path string) (string, error) {
@@ -96,14 +138,7 @@ func (s *GCSStorage) WriteFile(ctx context.Context, path string, r io.Reader) (I
 	if err != nil {
 		return Item{}, fmt.Errorf("error fetching GCS object attributes after upload: %w", err)
 	}
-	return Item{
-		Directory: strings.HasSuffix(attrs.Name, "/"),
-		Name:      attrs.Name,
-		Path:      attrs.Name,
-		URL:       attrs.MediaLink,
-		Created:   attrs.Created.Unix(),
-		Size:      attrs.Size,
-	}, nil
+	return toGCSItem(attrs), nil
 }
 
 func (s *GCSStorage) OpenFile(ctx context.Context, path string) (io.ReadCloser, error) {
@@ -264,14 +299,7 @@ func (s *GCSStorage) CreateFolder(ctx context.Context, path string) (Item, error
 			if err != nil {
 				return Item{}, fmt.Errorf("error fetching GCS object attributes after folder creation: %w", err)
 			}
-			return Item{
-				Directory: strings.HasSuffix(attrs.Name, "/"),
-				Name:      attrs.Name,
-				Path:      attrs.Name,
-				URL:       attrs.MediaLink,
-				Created:   attrs.Created.Unix(),
-				Size:      attrs.Size,
-			}, nil
+			return toGCSItem(attrs), nil
 		}
 		return Item{}, fmt.Errorf("failed to create GCS folder: %w", err)
 	}
@@ -279,14 +307,7 @@ func (s *GCSStorage) CreateFolder(ctx context.Context, path string) (Item, error
 	if err != nil {
 		return Item{}, fmt.Errorf("error fetching GCS object attributes after folder creation: %w", err)
 	}
-	return Item{
-		Directory: strings.HasSuffix(attrs.Name, "/"),
-		Name:      attrs.Name,
-		Path:      attrs.Name,
-		URL:       attrs.MediaLink,
-		Created:   attrs.Created.Unix(),
-		Size:      attrs.Size,
-	}, nil
+	return toGCSItem(attrs), nil
 }
 
 func (s *GCSStorage) CopyFile(ctx context.Context, fromPath string, toPath string) error {
@@ -0,0 +1,120 @@
+package filestore
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"github.com/stretchr/testify/suite"
+)
+
+type GCSSuite struct {
+	suite.Suite
+
+	ctx    context.Context
+	server *fakestorage.Server
+	gcs    *GCSStorage
+}
+
+func TestGCSSuite(t *testing.T) {
+	suite.Run(t, new(GCSSuite))
+}
+
+func (suite *GCSSuite) SetupTest() {
+	suite.ctx = context.Background()
+
+	suite.server = fakestorage.NewServer([]fakestorage.Object{
+		{
+			ObjectAttrs: fakestorage.ObjectAttrs{BucketName: "docs", Name: "guides/intro.md"},
+			Content:     []byte("# Intro"),
+		},
+		{
+			ObjectAttrs: fakestorage.ObjectAttrs{BucketName: "docs", Name: "guides/setup/linux.md"},
+			Content:     []byte("# Linux"),
+		},
+		{
+			ObjectAttrs: fakestorage.ObjectAttrs{BucketName: "docs", Name: "readme.md"},
+			Content:     []byte("# Readme"),
+		},
+		// Folder placeholder, as created by CreateFolder or the GCS console
+		{
+			ObjectAttrs: fakestorage.ObjectAttrs{BucketName: "docs", Name: "guides/"},
+		},
+	})
+
+	suite.gcs = NewGCSStorageFromClient(suite.server.Client(), "docs")
+}
+
+func (suite *GCSSuite) TearDownTest() {
+	suite.server.Stop()
+}
+
+func (suite *GCSSuite) TestList() {
+	items, err := suite.gcs.List(suite.ctx, "guides")
+	suite.Require().NoError(err)
+	suite.Require().Len(items, 2)
+
+	suite.Equal("guides/intro.md", items[0].Path)
+	suite.Equal("intro.md", items[0].Name)
+	suite.False(items[0].Directory)
+	suite.Equal(int64(7), items[0].Size)
+
+	suite.Equal("guides/setup/", items[1].Path)
+	suite.Equal("setup", items[1].Name)
+	suite.True(items[1].Directory)
+}
+
+// TestList_NotRecursive pins the semantics the file browser and the knowledge
+// sources rely on: only direct children, base names, no placeholder objects
+func (suite *GCSSuite) TestList_NotRecursive() {
+	items, err := suite.gcs.List(suite.ctx, "/guides/")
+	suite.Require().NoError(err)
+
+	var names []string
+	for _, item := range items {
+		names = append(names, item.Name)
+		suite.NotEqual("guides/", item.Path)
+		suite.NotEqual("guides/setup/linux.md", item.Path)
+	}
+	suite.Equal([]string{"intro.md", "setup"}, names)
+
+	items, err = suite.gcs.List(suite.ctx, "guides/setup")
+	suite.Require().NoError(err)
+	suite.Require().Len(items, 1)
+	suite.Equal("linux.md", items[0].Name)
+	suite.Equal("guides/setup/linux.md", items[0].Path)
+}
+
+func (suite *GCSSuite) TestGet() {
+	item, err := suite.gcs.Get(suite.ctx, "guides/setup/linux.md")
+	suite.Require().NoError(err)
+	suite.Equal("linux.md", item.Name)
+	suite.Equal("guides/setup/linux.md", item.Path)
+	suite.False(item.Directory)
+}
+
+func (suite *GCSSuite) TestReadFile_NotExist() {
+	_, err := ReadFile(suite.ctx, suite.gcs, "guides/missing.md")
+	suite.Require().Error(err)
+	suite.True(IsNotExist(err))
+}
+
+func (suite *GCSSuite) TestList_Root() {
+	items, err := suite.gcs.List(suite.ctx, "")
+	suite.Require().NoError(err)
+	suite.Require().Len(items, 2)
+
+	suite.Equal("readme.md", items[0].Path)
+	suite.Equal("guides/", items[1].Path)
+}
+
+func (suite *GCSSuite) TestOpenFile() {
+	r, err := suite.gcs.OpenFile(suite.ctx, "guides/setup/linux.md")
+	suite.Require().NoError(err)
+	defer r.Close()
+
+	bts, err := io.ReadAll(r)
+	suite.Require().NoError(err)
+	suite.Equal("# Linux", string(bts))
+}
@@ -0,0 +1,316 @@
+package filestore
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Compile-time interface check:
+var _ FileStore = (*S3Storage)(nil)
+
+const defaultS3Endpoint = "https://s3.amazonaws.com"
+
+// S3Options configures the connection to AWS S3 or any S3-compatible
+// storage such as MinIO.
+type S3Options struct {
+	// Endpoint of the S3 API, for example http://minio:9000. Defaults to AWS S3.
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Static credentials, if not set we fall back to the AWS environment variables,
+	// the shared credentials file and finally the IAM role of the instance.
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+type S3Storage struct {
+	client *minio.Client
+	bucket string
+}
+
+func NewS3Storage(opts S3Options) (*S3Storage, error) {
+	endpoint := opts.Endpoint
+	if endpoint == "" {
+		endpoint = defaultS3Endpoint
+	}
+
+	if !strings.HasPrefix(endpoint, "http://") && !strings.HasPrefix(endpoint, "https://") {
+		endpoint = "https://" + endpoint
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint '%s': %w", opts.Endpoint, err)
+	}
+
+	var creds *credentials.Credentials
+
+	if opts.AccessKeyID != "" || opts.SecretAccessKey != "" {
+		creds = credentials.NewStaticV4(opts.AccessKeyID, opts.SecretAccessKey, "")
+	} else {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{
+				Client: &http.Client{
+					Transport: http.DefaultTransport,
+				},
+			},
+		})
+	}
+
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:  creds,
+		Secure: u.Scheme == "https",
+		Region: opts.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 client: %w", err)
+	}
+
+	return &S3Storage{
+		client: client,
+		bucket: opts.Bucket,
+	}, nil
+}
+
+func (s *S3Storage) List(ctx context.Context, prefix string) ([]Item, error) {
+	prefix = strings.TrimPrefix(prefix, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	items := []Item{}
+
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    prefix,
+		Recursive: false,
+	}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("error listing S3 objects: %w", obj.Err)
+		}
+
+		// Skip the folder placeholder object itself
+		if obj.Key == prefix {
+			continue
+		}
+
+		items = append(items, s.toItem(obj))
+	}
+
+	return items, nil
+}
+
+func (s *S3Storage) Get(ctx context.Context, path string) (Item, error) {
+	obj, err := s.client.StatObject(ctx, s.bucket, path, minio.StatObjectOptions{})
+	if err != nil {
+		return Item{}, fmt.Errorf("error fetching S3 object attributes: %w", err)
+	}
+
+	return s.toItem(obj), nil
+}
+
+func (s *S3Storage) SignedURL(ctx context.Context, path string) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, path, 20*time.Minute, url.Values{})
+	if err != nil {
+		return "", fmt.Errorf("failed to sign S3 URL: %w", err)
+	}
+
+	return u.String(), nil
+}
+
+func (s *S3Storage) WriteFile(ctx context.Context, path string, r io.Reader) (Item, error) {
+	_, err := s.client.PutObject(ctx, s.bucket, path, r, -1, minio.PutObjectOptions{})
+	if err != nil {
+		return Item{}, fmt.Errorf("failed to upload S3 object: %w", err)
+	}
+
+	return s.Get(ctx, path)
+}
+
+func (s *S3Storage) OpenFile(ctx context.Context, path string) (io.ReadCloser, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, path, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 object reader: %w", err)
+	}
+
+	// GetObject is lazy, stat the object to surface errors such as
+	// missing keys or bad credentials straight away
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		return nil, fmt.Errorf("failed to open S3 object: %w", err)
+	}
+
+	return obj, nil
+}
+
+func (s *S3Storage) DownloadFolder(ctx context.Context, path string) (io.Reader, error) {
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	defer tarWriter.Close()
+
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    path,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+
+		reader, err := s.OpenFile(ctx, obj.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := tarWriter.WriteHeader(&tar.Header{
+			Name: obj.Key,
+			Mode: 0600,
+			Size: obj.Size,
+		}); err != nil {
+			reader.Close()
+			return nil, err
+		}
+
+		if _, err := io.Copy(tarWriter, reader); err != nil {
+			reader.Close()
+			return nil, err
+		}
+		reader.Close()
+	}
+
+	return &buf, nil
+}
+
+func (s *S3Storage) UploadFolder(ctx context.Context, path string, r io.Reader) error {
+	tarReader := tar.NewReader(r)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading tar header: %w", err)
+		}
+
+		// Skip directories
+		if header.Typeflag == tar.TypeDir {
+			continue
+		}
+
+		objPath := path + "/" + header.Name
+
+		_, err = s.client.PutObject(ctx, s.bucket, objPath, tarReader, header.Size, minio.PutObjectOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to upload S3 object: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *S3Storage) Rename(ctx context.Context, path string, newPath string) (Item, error) {
+	// For directories, move each object under the prefix
+	if strings.HasSuffix(path, "/") {
+		for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+			Prefix:    path,
+			Recursive: true,
+		}) {
+			if obj.Err != nil {
+				return Item{}, fmt.Errorf("error iterating over S3 objects during rename: %w", obj.Err)
+			}
+
+			newObjPath := strings.Replace(obj.Key, path, newPath, 1)
+			if err := s.move(ctx, obj.Key, newObjPath); err != nil {
+				return Item{}, err
+			}
+		}
+	} else {
+		if err := s.move(ctx, path, newPath); err != nil {
+			return Item{}, err
+		}
+	}
+
+	return s.Get(ctx, newPath)
+}
+
+func (s *S3Storage) move(ctx context.Context, from, to string) error {
+	if err := s.CopyFile(ctx, from, to); err != nil {
+		return err
+	}
+
+	if err := s.client.RemoveObject(ctx, s.bucket, from, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to delete original S3 object after renaming: %w", err)
+	}
+
+	return nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, path string) error {
+	if !strings.HasSuffix(path, "/") {
+		if err := s.client.RemoveObject(ctx, s.bucket, path, minio.RemoveObjectOptions{}); err != nil {
+			return fmt.Errorf("failed to delete S3 object: %w", err)
+		}
+		return nil
+	}
+
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{
+		Prefix:    path,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return fmt.Errorf("error iterating over S3 objects during delete: %w", obj.Err)
+		}
+
+		if err := s.client.RemoveObject(ctx, s.bucket, obj.Key, minio.RemoveObjectOptions{}); err != nil {
+			return fmt.Errorf("error deleting S3 object: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (s *S3Storage) CreateFolder(ctx context.Context, path string) (Item, error) {
+	folder := strings.TrimSuffix(path, "/") + "/"
+
+	_, err := s.client.PutObject(ctx, s.bucket, folder, bytes.NewReader(nil), 0, minio.PutObjectOptions{})
+	if err != nil {
+		return Item{}, fmt.Errorf("failed to create S3 folder: %w", err)
+	}
+
+	return s.Get(ctx, folder)
+}
+
+func (s *S3Storage) CopyFile(ctx context.Context, from string, to string) error {
+	_, err := s.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: s.bucket, Object: to},
+		minio.CopySrcOptions{Bucket: s.bucket, Object: from},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to copy S3 object: %w", err)
+	}
+
+	return nil
+}
+
+func (s *S3Storage) toItem(obj minio.ObjectInfo) Item {
+	return Item{
+		Directory: strings.HasSuffix(obj.Key, "/"),
+		Name:      path.Base(obj.Key),
+		Path:      obj.Key,
+		URL:       s.client.EndpointURL().JoinPath(s.bucket, obj.Key).String(),
+		Created:   obj.LastModified.Unix(),
+		Size:      obj.Size,
+	}
+}
@@ -0,0 +1,99 @@
+package filestore
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/suite"
+
+	"github.com/helixml/helix/api/pkg/system"
+)
+
+type S3Suite struct {
+	suite.Suite
+
+	ctx context.Context
+	s3  *S3Storage
+}
+
+func TestS3Suite(t *testing.T) {
+	suite.Run(t, new(S3Suite))
+}
+
+func (suite *S3Suite) SetupTest() {
+	endpoint := os.Getenv("S3_ENDPOINT")
+	if endpoint == "" {
+		suite.T().Skip("S3_ENDPOINT not set, skipping S3 tests (run a local MinIO to enable them)")
+	}
+
+	suite.ctx = context.Background()
+
+	s3, err := NewS3Storage(S3Options{
+		Endpoint:        endpoint,
+		Bucket:          "test-" + system.GenerateID(),
+		AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+	})
+	suite.Require().NoError(err)
+
+	err = s3.client.MakeBucket(suite.ctx, s3.bucket, minio.MakeBucketOptions{})
+	suite.Require().NoError(err)
+
+	suite.s3 = s3
+}
+
+func (suite *S3Suite) TestWriteListOpen() {
+	_, err := suite.s3.WriteFile(suite.ctx, "docs/intro.md", strings.NewReader("# Intro"))
+	suite.Require().NoError(err)
+
+	_, err = suite.s3.WriteFile(suite.ctx, "docs/guides/setup.md", strings.NewReader("# Setup"))
+	suite.Require().NoError(err)
+
+	items, err := suite.s3.List(suite.ctx, "docs")
+	suite.Require().NoError(err)
+	suite.Require().Len(items, 2)
+
+	suite.Equal("docs/guides/", items[0].Path)
+	suite.True(items[0].Directory)
+	suite.Equal("guides", items[0].Name)
+
+	suite.Equal("docs/intro.md", items[1].Path)
+	suite.False(items[1].Directory)
+	suite.Equal(int64(7), items[1].Size)
+
+	r, err := suite.s3.OpenFile(suite.ctx, "docs/guides/setup.md")
+	suite.Require().NoError(err)
+	defer r.Close()
+
+	bts, err := io.ReadAll(r)
+	suite.Require().NoError(err)
+	suite.Equal("# Setup", string(bts))
+}
+
+func (suite *S3Suite) TestOpenFile_NotFound() {
+	_, err := suite.s3.OpenFile(suite.ctx, "missing.md")
+	suite.Error(err)
+}
+
+func (suite *S3Suite) TestRenameAndDelete() {
+	_, err := suite.s3.WriteFile(suite.ctx, "a.txt", strings.NewReader("a"))
+	suite.Require().NoError(err)
+
+	item, err := suite.s3.Rename(suite.ctx, "a.txt", "b.txt")
+	suite.Require().NoError(err)
+	suite.Equal("b.txt", item.Path)
+
+	_, err = suite.s3.Get(suite.ctx, "a.txt")
+	suite.Error(err)
+
+	err = suite.s3.Delete(suite.ctx, "b.txt")
+	suite.Require().NoError(err)
+
+	items, err := suite.s3.List(suite.ctx, "")
+	suite.Require().NoError(err)
+	suite.Empty(items)
+}
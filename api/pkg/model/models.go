@@ -305,6 +305,16 @@ func GetDefaultOllamaModels() ([]*OllamaGenericText, error) {
 			Description:   "Fast and good for everyday tasks, from Google - 8bit quantized, 8K context",
 			Hide:          true,
 		},
+		// Embedding model, served through /v1/embeddings. Hidden as it can't
+		// be used for chat
+		{
+			ID:            "nomic-embed-text:v1.5", // https://ollama.com/library/nomic-embed-text:v1.5
+			Name:          "Nomic Embed Text",
+			Memory:        MB * 1024,
+			ContextLength: 8192,
+			Description:   "Text embeddings model, 768 dimensions, 8K context",
+			Hide:          true,
+		},
 	}
 
 	return models, nil
@@ -2,6 +2,9 @@ package openai
 
 import (
 	"context"
+	"sync"
+
+	openai "github.com/sashabaranov/go-openai"
 
 	"github.com/helixml/helix/api/pkg/types"
 )
@@ -10,12 +13,16 @@ type (
 	contextValuesKeyType int
 	contextAppIDKeyType  int
 	stepKeyType          int
+	toolCallIDKeyType    int
+	usageCounterKeyType  int
 )
 
 var (
 	contextValuesKey contextValuesKeyType
 	contextAppIDKey  contextAppIDKeyType
 	stepKey          stepKeyType
+	toolCallIDKey    toolCallIDKeyType
+	usageCounterKey  usageCounterKeyType
 )
 
 const (
@@ -86,3 +93,55 @@ func GetStep(ctx context.Context) (*Step, bool) {
 
 	return step, true
 }
+
+// SetToolCallID sets the tool call the LLM calls are made for, the calls of
+// the tools running in parallel are logged under their own tool call
+func SetToolCallID(ctx context.Context, toolCallID string) context.Context {
+	return context.WithValue(ctx, toolCallIDKey, toolCallID)
+}
+
+func GetToolCallID(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+
+	toolCallID, ok := ctx.Value(toolCallIDKey).(string)
+	return toolCallID, ok
+}
+
+// UsageCounter sums the token usage of the LLM calls made with the context, the calls
+// report their usage with AddUsage
+type UsageCounter struct {
+	mu    sync.Mutex
+	usage openai.Usage
+}
+
+func (c *UsageCounter) Usage() openai.Usage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.usage
+}
+
+func SetUsageCounter(ctx context.Context, counter *UsageCounter) context.Context {
+	return context.WithValue(ctx, usageCounterKey, counter)
+}
+
+// AddUsage adds the usage of an LLM call to the counter of the context, if any
+func AddUsage(ctx context.Context, usage openai.Usage) {
+	if ctx == nil {
+		return
+	}
+
+	counter, ok := ctx.Value(usageCounterKey).(*UsageCounter)
+	if !ok {
+		return
+	}
+
+	counter.mu.Lock()
+	defer counter.mu.Unlock()
+
+	counter.usage.PromptTokens += usage.PromptTokens
+	counter.usage.CompletionTokens += usage.CompletionTokens
+	counter.usage.TotalTokens += usage.TotalTokens
+}
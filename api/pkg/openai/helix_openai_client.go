@@ -65,6 +65,41 @@ func ListModels(_ context.Context) ([]model.OpenAIModel, error) {
 }
 
 func (c *InternalHelixServer) CreateChatCompletion(requestCtx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	runnerResp, err := c.runRequest(requestCtx, &types.RunnerLLMInferenceRequest{
+		Request: &request,
+	})
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+
+	if runnerResp.Response == nil {
+		return openai.ChatCompletionResponse{}, nil
+	}
+
+	return *runnerResp.Response, nil
+}
+
+// CreateEmbeddings schedules the embeddings model on a runner, same as the chat models
+func (c *InternalHelixServer) CreateEmbeddings(requestCtx context.Context, request openai.EmbeddingRequest) (openai.EmbeddingResponse, error) {
+	runnerResp, err := c.runRequest(requestCtx, &types.RunnerLLMInferenceRequest{
+		Request: &openai.ChatCompletionRequest{
+			Model: string(request.Model),
+		},
+		EmbeddingRequest: &request,
+	})
+	if err != nil {
+		return openai.EmbeddingResponse{}, err
+	}
+
+	if runnerResp.EmbeddingResponse == nil {
+		return openai.EmbeddingResponse{}, fmt.Errorf("runner returned no embeddings")
+	}
+
+	return *runnerResp.EmbeddingResponse, nil
+}
+
+// runRequest enqueues the request for the runners and waits for the (non-streaming) response
+func (c *InternalHelixServer) runRequest(requestCtx context.Context, req *types.RunnerLLMInferenceRequest) (*types.RunnerLLMInferenceResponse, error) {
 	ctx, cancel := context.WithTimeout(requestCtx, chatCompletionTimeout)
 	defer cancel()
 
@@ -75,15 +110,15 @@ func (c *InternalHelixServer) CreateChatCompletion(requestCtx context.Context, r
 	// ownerID, sessionID, interactionID := GetContextValues(ctx)
 	vals, ok := GetContextValues(ctx)
 	if !ok {
-		return openai.ChatCompletionResponse{}, fmt.Errorf("ownerID not set in context, use 'openai.SetContextValues()' before calling this method")
+		return nil, fmt.Errorf("ownerID not set in context, use 'openai.SetContextValues()' before calling this method")
 	}
 
 	if vals.OwnerID == "" {
-		return openai.ChatCompletionResponse{}, fmt.Errorf("ownerID not set in context, use 'openai.SetContextValues()' before calling this method")
+		return nil, fmt.Errorf("ownerID not set in context, use 'openai.SetContextValues()' before calling this method")
 	}
 
 	var (
-		resp      openai.ChatCompletionResponse
+		resp      types.RunnerLLMInferenceResponse
 		respError error
 	)
 
@@ -97,9 +132,7 @@ func (c *InternalHelixServer) CreateChatCompletion(requestCtx context.Context, r
 
 		defer close(doneCh)
 
-		if runnerResp.Response != nil {
-			resp = *runnerResp.Response
-		}
+		resp = runnerResp
 
 		if runnerResp.Error != "" {
 			respError = fmt.Errorf("runner error: %s", runnerResp.Error)
@@ -108,7 +141,7 @@ func (c *InternalHelixServer) CreateChatCompletion(requestCtx context.Context, r
 		return nil
 	})
 	if err != nil {
-		return openai.ChatCompletionResponse{}, fmt.Errorf("failed to subscribe to runner responses: %w", err)
+		return nil, fmt.Errorf("failed to subscribe to runner responses: %w", err)
 	}
 
 	defer func() {
@@ -117,17 +150,16 @@ func (c *InternalHelixServer) CreateChatCompletion(requestCtx context.Context, r
 		}
 	}()
 
+	req.RequestID = requestID
+	req.CreatedAt = time.Now()
+	req.OwnerID = vals.OwnerID
+	req.SessionID = vals.SessionID
+	req.InteractionID = vals.InteractionID
+
 	// Enqueue the request, it will be picked up by the runner
-	err = c.enqueueRequest(&types.RunnerLLMInferenceRequest{
-		RequestID:     requestID,
-		CreatedAt:     time.Now(),
-		OwnerID:       vals.OwnerID,
-		SessionID:     vals.SessionID,
-		InteractionID: vals.InteractionID,
-		Request:       &request,
-	})
+	err = c.enqueueRequest(req)
 	if err != nil {
-		return openai.ChatCompletionResponse{}, fmt.Errorf("error enqueuing request: %w", err)
+		return nil, fmt.Errorf("error enqueuing request: %w", err)
 	}
 
 	// Wait for the response or until the context is done (timeout)
@@ -139,7 +171,7 @@ func (c *InternalHelixServer) CreateChatCompletion(requestCtx context.Context, r
 		if err != nil {
 			log.Error().Err(err).Msg("error releasing allocation")
 		}
-		return openai.ChatCompletionResponse{}, fmt.Errorf("request was cancelled")
+		return nil, fmt.Errorf("request was cancelled")
 	case <-ctx.Done():
 		// If this happens, we have timed out
 		log.Warn().
@@ -149,7 +181,7 @@ func (c *InternalHelixServer) CreateChatCompletion(requestCtx context.Context, r
 		if err != nil {
 			log.Error().Err(err).Msg("error releasing allocation")
 		}
-		return openai.ChatCompletionResponse{}, fmt.Errorf("timeout waiting for runner response")
+		return nil, fmt.Errorf("timeout waiting for runner response")
 	}
 
 	if respError != nil {
@@ -157,10 +189,10 @@ func (c *InternalHelixServer) CreateChatCompletion(requestCtx context.Context, r
 		if err != nil {
 			log.Error().Err(err).Msg("error releasing allocation")
 		}
-		return openai.ChatCompletionResponse{}, respError
+		return nil, respError
 	}
 
-	return resp, nil
+	return &resp, nil
 }
 
 func (c *InternalHelixServer) CreateChatCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (*openai.ChatCompletionStream, error) {
@@ -55,6 +55,54 @@ func (m *LoggingMiddleware) ListModels(ctx context.Context) ([]model.OpenAIModel
 	return m.client.ListModels(ctx)
 }
 
+func (m *LoggingMiddleware) CreateEmbeddings(ctx context.Context, request openai.EmbeddingRequest) (openai.EmbeddingResponse, error) {
+	start := time.Now()
+	resp, err := m.client.CreateEmbeddings(ctx, request)
+	if err != nil {
+		return resp, err
+	}
+
+	m.wg.Add(1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Error().Msgf("Recovered from panic: %v", r)
+			}
+		}()
+
+		defer m.wg.Done()
+
+		m.logCall(ctx, string(request.Model), &request, newEmbeddingsLogResponse(&resp), resp.Usage, time.Since(start).Milliseconds())
+	}()
+
+	return resp, nil
+}
+
+// embeddingsLogResponse is logged instead of the embeddings response,
+// the vectors are large and of no use when looking at the calls
+type embeddingsLogResponse struct {
+	Object     string       `json:"object"`
+	Model      string       `json:"model"`
+	Embeddings int          `json:"embeddings"`
+	Dimensions int          `json:"dimensions"`
+	Usage      openai.Usage `json:"usage"`
+}
+
+func newEmbeddingsLogResponse(resp *openai.EmbeddingResponse) *embeddingsLogResponse {
+	logResp := &embeddingsLogResponse{
+		Object:     resp.Object,
+		Model:      string(resp.Model),
+		Embeddings: len(resp.Data),
+		Usage:      resp.Usage,
+	}
+
+	if len(resp.Data) > 0 {
+		logResp.Dimensions = len(resp.Data[0].Embedding)
+	}
+
+	return logResp
+}
+
 func (m *LoggingMiddleware) CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
 	start := time.Now()
 	resp, err := m.client.CreateChatCompletion(ctx, request)
@@ -174,6 +222,11 @@ func appendChunk(resp *openai.ChatCompletionResponse, chunk *openai.ChatCompleti
 }
 
 func (m *LoggingMiddleware) logLLMCall(ctx context.Context, req *openai.ChatCompletionRequest, resp *openai.ChatCompletionResponse, durationMs int64) {
+	m.logCall(ctx, req.Model, req, resp, resp.Usage, durationMs)
+}
+
+// logCall stores the request and response of any of the calls, chat completions or embeddings
+func (m *LoggingMiddleware) logCall(ctx context.Context, model string, req, resp any, usage openai.Usage, durationMs int64) {
 	reqBts, err := json.MarshalIndent(req, "", "  ")
 	if err != nil {
 		log.Error().Err(err).Msg("failed to marshal LLM request")
@@ -205,31 +258,35 @@ func (m *LoggingMiddleware) logLLMCall(ctx context.Context, req *openai.ChatComp
 		log.Debug().Msg("failed to get app_id")
 	}
 
+	// Only set for the tool calls
+	toolCallID, _ := oai.GetToolCallID(ctx)
+
 	log.Debug().
 		Str("owner_id", vals.OwnerID).
 		Str("app_id", appID).
-		Str("model", req.Model).
+		Str("model", model).
 		Str("provider", string(m.provider)).
 		Str("step", string(step.Step)).
-		Int("prompt_tokens", resp.Usage.PromptTokens).
-		Int("completion_tokens", resp.Usage.CompletionTokens).
-		Int("total_tokens", resp.Usage.TotalTokens).
+		Int("prompt_tokens", usage.PromptTokens).
+		Int("completion_tokens", usage.CompletionTokens).
+		Int("total_tokens", usage.TotalTokens).
 		Msg("logging LLM call")
 
 	llmCall := &types.LLMCall{
 		AppID:            appID,
 		SessionID:        vals.SessionID,
 		InteractionID:    vals.InteractionID,
-		Model:            req.Model,
+		Model:            model,
 		Step:             step.Step,
+		ToolCallID:       toolCallID,
 		OriginalRequest:  vals.OriginalRequest,
 		Request:          reqBts,
 		Response:         respBts,
 		Provider:         string(m.provider),
 		DurationMs:       durationMs,
-		PromptTokens:     int64(resp.Usage.PromptTokens),
-		CompletionTokens: int64(resp.Usage.CompletionTokens),
-		TotalTokens:      int64(resp.Usage.TotalTokens),
+		PromptTokens:     int64(usage.PromptTokens),
+		CompletionTokens: int64(usage.CompletionTokens),
+		TotalTokens:      int64(usage.TotalTokens),
 		UserID:           vals.OwnerID,
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), logCallTimeout)
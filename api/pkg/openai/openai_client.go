@@ -27,6 +27,8 @@ type Client interface {
 	CreateChatCompletion(ctx context.Context, request openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
 	CreateChatCompletionStream(ctx context.Context, request openai.ChatCompletionRequest) (*openai.ChatCompletionStream, error)
 
+	CreateEmbeddings(ctx context.Context, request openai.EmbeddingRequest) (openai.EmbeddingResponse, error)
+
 	ListModels(ctx context.Context) ([]model.OpenAIModel, error)
 
 	APIKey() string
@@ -85,6 +87,27 @@ func (c *RetryableClient) CreateChatCompletionStream(ctx context.Context, reques
 	return c.apiClient.CreateChatCompletionStream(ctx, request)
 }
 
+func (c *RetryableClient) CreateEmbeddings(ctx context.Context, request openai.EmbeddingRequest) (resp openai.EmbeddingResponse, err error) {
+	err = retry.Do(func() error {
+		resp, err = c.apiClient.CreateEmbeddings(ctx, request)
+		if err != nil {
+			if strings.Contains(err.Error(), "401 Unauthorized") {
+				return retry.Unrecoverable(err)
+			}
+
+			return err
+		}
+
+		return nil
+	},
+		retry.Attempts(retries),
+		retry.Delay(delayBetweenRetries),
+		retry.Context(ctx),
+	)
+
+	return
+}
+
 // TODO: just use OpenAI client's ListModels function and separate this from TogetherAI
 func (c *RetryableClient) ListModels(ctx context.Context) ([]model.OpenAIModel, error) {
 	url := c.baseURL + "/models"
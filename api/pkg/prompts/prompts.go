@@ -102,3 +102,21 @@ func KnowledgePrompt(req *KnowledgePromptRequest) (string, error) {
 	}
 	return buf.String(), nil
 }
+
+type QueryRewritePromptRequest struct {
+	History    []string // previous turns of the conversation, formatted as "role: content"
+	Question   string
+	SubQueries int // number of additional queries to generate
+}
+
+// QueryRewritePrompt asks the model to turn the last question of the conversation
+// into standalone search queries, one per line
+func QueryRewritePrompt(req *QueryRewritePromptRequest) (string, error) {
+	tmpl := template.Must(template.New("QueryRewritePrompt").Parse(templates.QueryRewriteTemplate))
+	var buf bytes.Buffer
+	err := tmpl.Execute(&buf, req)
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
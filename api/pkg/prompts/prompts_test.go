@@ -175,3 +175,31 @@ func TestTextFinetuneSystemPrompt(t *testing.T) {
 		}
 	})
 }
+
+func TestQueryRewritePrompt(t *testing.T) {
+	prompt, err := QueryRewritePrompt(&QueryRewritePromptRequest{
+		History:    []string{"user: list the helix runners", "assistant: there are two, A100 and H100"},
+		Question:   "what about the second one?",
+		SubQueries: 2,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, expected := range []string{"assistant: there are two, A100 and H100", "what about the second one?", "write 2 additional search queries"} {
+		if !strings.Contains(prompt, expected) {
+			t.Errorf("prompt does not contain %q", expected)
+		}
+	}
+
+	prompt, err = QueryRewritePrompt(&QueryRewritePromptRequest{
+		Question: "what are runners?",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if strings.Contains(prompt, "additional search queries") || strings.Contains(prompt, "Conversation history") {
+		t.Errorf("prompt contains the optional sections")
+	}
+}
@@ -12,3 +12,6 @@ var RagTemplate string
 
 //go:embed finetuning.tmpl
 var FinetuningTemplate string
+
+//go:embed query_rewrite.tmpl
+var QueryRewriteTemplate string
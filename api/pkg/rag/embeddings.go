@@ -0,0 +1,157 @@
+package rag
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/helixml/helix/api/pkg/openai/manager"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+const (
+	// Max number of inputs sent in a single embeddings request
+	embeddingsBatchSize = 100
+
+	// How many candidates are fetched from each of the vector and the
+	// keyword searches before they are fused
+	hybridMinCandidates = 20
+	// Reciprocal rank fusion constant, dampens the impact of the top ranks
+	hybridRRFConstant = 60
+)
+
+// Embedder generates the embeddings for the RAG backends that store the vectors
+// themselves, the semantic text splitter uses it to find the topic changes
+type Embedder interface {
+	Embed(ctx context.Context, inputs []string) ([][]float32, error)
+}
+
+// NewEmbedder returns the embeddings of the provider model, or the built-in
+// hashing embeddings if no provider is set
+func NewEmbedder(providerManager manager.ProviderManager, provider types.Provider, model string) Embedder {
+	if provider == "" {
+		return &hashEmbedder{dimensions: embeddedHashDimensions}
+	}
+
+	return &providerEmbedder{
+		providerManager: providerManager,
+		provider:        provider,
+		model:           model,
+	}
+}
+
+// providerEmbedder generates the embeddings through one of the configured
+// OpenAI compatible providers
+type providerEmbedder struct {
+	providerManager manager.ProviderManager
+	provider        types.Provider
+	model           string
+	dimensions      int
+}
+
+func (e *providerEmbedder) Embed(ctx context.Context, inputs []string) ([][]float32, error) {
+	client, err := e.providerManager.GetClient(ctx, &manager.GetClientRequest{
+		Provider: e.provider,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get embeddings client: %w", err)
+	}
+
+	embeddings := make([][]float32, 0, len(inputs))
+
+	for start := 0; start < len(inputs); start += embeddingsBatchSize {
+		end := min(start+embeddingsBatchSize, len(inputs))
+
+		resp, err := client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+			Input: inputs[start:end],
+			Model: openai.EmbeddingModel(e.model),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate embeddings: %w", err)
+		}
+
+		if len(resp.Data) != end-start {
+			return nil, fmt.Errorf("expected %d embeddings, got %d", end-start, len(resp.Data))
+		}
+
+		for _, data := range resp.Data {
+			if e.dimensions > 0 && len(data.Embedding) != e.dimensions {
+				return nil, fmt.Errorf("embeddings model '%s' returned %d dimensions, expected %d",
+					e.model, len(data.Embedding), e.dimensions)
+			}
+			embeddings = append(embeddings, data.Embedding)
+		}
+	}
+
+	return embeddings, nil
+}
+
+// hashEmbedder generates embeddings locally by hashing the words and their
+// character trigrams into a fixed size vector. It doesn't capture meaning like
+// a trained model does but needs no external services.
+type hashEmbedder struct {
+	dimensions int
+}
+
+func (e *hashEmbedder) Embed(_ context.Context, inputs []string) ([][]float32, error) {
+	embeddings := make([][]float32, 0, len(inputs))
+
+	for _, input := range inputs {
+		embedding := make([]float32, e.dimensions)
+
+		for _, token := range tokenize(input) {
+			e.add(embedding, token, 1)
+
+			padded := "^" + token + "$"
+			for i := 0; i+3 <= len(padded); i++ {
+				e.add(embedding, padded[i:i+3], 0.5)
+			}
+		}
+
+		embeddings = append(embeddings, normalize(embedding))
+	}
+
+	return embeddings, nil
+}
+
+func (e *hashEmbedder) add(embedding []float32, feature string, weight float32) {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(feature))
+	sum := h.Sum32()
+
+	// The top bit decides the sign so that the collisions cancel out on average
+	if sum&(1<<31) != 0 {
+		weight = -weight
+	}
+	embedding[int(sum%uint32(e.dimensions))] += weight
+}
+
+func normalize(embedding []float32) []float32 {
+	var sum float64
+	for _, v := range embedding {
+		sum += float64(v) * float64(v)
+	}
+
+	if sum == 0 {
+		return embedding
+	}
+
+	norm := float32(math.Sqrt(sum))
+	for i := range embedding {
+		embedding[i] /= norm
+	}
+	return embedding
+}
+
+// tokenize splits the text into lowercase words, used by both the hashing
+// embeddings and the keyword scoring
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
@@ -0,0 +1,93 @@
+package rag
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+var metadataKeyRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// ValidMetadataKey checks the key can be safely used in the filter
+// expressions of all the backends
+func ValidMetadataKey(key string) bool {
+	return metadataKeyRegexp.MatchString(key)
+}
+
+// ParseFilter parses the filter expressions used by the CLI and the search API:
+// "key=value", "key!=value" or "key^=prefix"
+func ParseFilter(expr string) (*types.RAGFilter, error) {
+	// Longest operators first, "!=" and "^=" also contain "="
+	for _, operator := range []types.RAGFilterOperator{
+		types.RAGFilterOperatorNotEquals,
+		types.RAGFilterOperatorStartsWith,
+		types.RAGFilterOperatorEquals,
+	} {
+		key, value, found := strings.Cut(expr, string(operator))
+		if !found {
+			continue
+		}
+
+		// "a!=b" also contains "=", the key can't end with the first operator character
+		if strings.ContainsAny(key, "!^=") {
+			continue
+		}
+
+		filter := &types.RAGFilter{
+			Key:      strings.TrimSpace(key),
+			Operator: operator,
+			Value:    strings.TrimSpace(value),
+		}
+
+		if err := ValidateFilter(filter); err != nil {
+			return nil, err
+		}
+
+		return filter, nil
+	}
+
+	return nil, fmt.Errorf("invalid filter '%s', use key=value, key!=value or key^=prefix", expr)
+}
+
+// ValidateFilter checks the filter before it is passed to the backends
+func ValidateFilter(filter *types.RAGFilter) error {
+	if !ValidMetadataKey(filter.Key) {
+		return fmt.Errorf("invalid filter key '%s', only letters, numbers, '_', '.' and '-' are allowed", filter.Key)
+	}
+
+	switch filter.Operator {
+	case types.RAGFilterOperatorEquals, types.RAGFilterOperatorNotEquals, types.RAGFilterOperatorStartsWith:
+		return nil
+	default:
+		return fmt.Errorf("invalid filter operator '%s' for key '%s'", filter.Operator, filter.Key)
+	}
+}
+
+// MatchFilters checks the chunk metadata against all the filters, used by
+// the backends that filter in memory
+func MatchFilters(metadata map[string]string, filters []*types.RAGFilter) bool {
+	for _, filter := range filters {
+		value, ok := metadata[filter.Key]
+
+		switch filter.Operator {
+		case types.RAGFilterOperatorEquals:
+			if !ok || value != filter.Value {
+				return false
+			}
+		case types.RAGFilterOperatorNotEquals:
+			if ok && value == filter.Value {
+				return false
+			}
+		case types.RAGFilterOperatorStartsWith:
+			if !ok || !strings.HasPrefix(value, filter.Value) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,53 @@
+package rag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+func TestParseFilter(t *testing.T) {
+	for expr, expected := range map[string]*types.RAGFilter{
+		"extension=pdf":         {Key: "extension", Operator: types.RAGFilterOperatorEquals, Value: "pdf"},
+		"extension != md":       {Key: "extension", Operator: types.RAGFilterOperatorNotEquals, Value: "md"},
+		"path^=/docs/":          {Key: "path", Operator: types.RAGFilterOperatorStartsWith, Value: "/docs/"},
+		"team=a=b":              {Key: "team", Operator: types.RAGFilterOperatorEquals, Value: "a=b"},
+		"crawled_at=2024-01-02": {Key: "crawled_at", Operator: types.RAGFilterOperatorEquals, Value: "2024-01-02"},
+		"tag=":                  {Key: "tag", Operator: types.RAGFilterOperatorEquals, Value: ""},
+	} {
+		filter, err := ParseFilter(expr)
+		require.NoError(t, err, expr)
+		require.Equal(t, expected, filter, expr)
+	}
+
+	for _, expr := range []string{"extension", "=pdf", "bad key=pdf", "`key`=value"} {
+		_, err := ParseFilter(expr)
+		require.Error(t, err, expr)
+	}
+}
+
+func TestMatchFilters(t *testing.T) {
+	metadata := map[string]string{
+		"extension": "pdf",
+		"path":      "/docs/api/index.html",
+	}
+
+	require.True(t, MatchFilters(metadata, nil))
+	require.True(t, MatchFilters(metadata, []*types.RAGFilter{
+		{Key: "extension", Operator: types.RAGFilterOperatorEquals, Value: "pdf"},
+		{Key: "path", Operator: types.RAGFilterOperatorStartsWith, Value: "/docs/"},
+		{Key: "team", Operator: types.RAGFilterOperatorNotEquals, Value: "sales"},
+	}))
+
+	require.False(t, MatchFilters(metadata, []*types.RAGFilter{
+		{Key: "extension", Operator: types.RAGFilterOperatorNotEquals, Value: "pdf"},
+	}))
+	require.False(t, MatchFilters(metadata, []*types.RAGFilter{
+		{Key: "team", Operator: types.RAGFilterOperatorEquals, Value: "sales"},
+	}))
+	require.False(t, MatchFilters(nil, []*types.RAGFilter{
+		{Key: "path", Operator: types.RAGFilterOperatorStartsWith, Value: ""},
+	}))
+}
@@ -0,0 +1,51 @@
+package rag
+
+import (
+	"sort"
+
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+// ReciprocalRankFusion merges the results of several queries into a single
+// ranking. Each chunk scores 1/(k+rank) for every list it appears in so the
+// chunks found by multiple queries move up.
+func ReciprocalRankFusion(resultSets ...[]*types.SessionRAGResult) []*types.SessionRAGResult {
+	type fused struct {
+		result *types.SessionRAGResult
+		score  float64
+		order  int
+	}
+
+	var (
+		byKey  = make(map[string]*fused)
+		merged []*fused
+	)
+
+	for _, results := range resultSets {
+		for rank, result := range results {
+			key := result.DocumentID + "\x00" + result.Content
+
+			f, ok := byKey[key]
+			if !ok {
+				f = &fused{result: result, order: len(merged)}
+				byKey[key] = f
+				merged = append(merged, f)
+			}
+			f.score += 1.0 / float64(hybridRRFConstant+rank+1)
+		}
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool {
+		if merged[i].score != merged[j].score {
+			return merged[i].score > merged[j].score
+		}
+		return merged[i].order < merged[j].order
+	})
+
+	fusedResults := make([]*types.SessionRAGResult, 0, len(merged))
+	for _, f := range merged {
+		fusedResults = append(fusedResults, f.result)
+	}
+
+	return fusedResults
+}
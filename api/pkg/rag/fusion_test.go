@@ -0,0 +1,33 @@
+package rag
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+func TestReciprocalRankFusion(t *testing.T) {
+	a := &types.SessionRAGResult{DocumentID: "doc_a", Content: "a"}
+	b := &types.SessionRAGResult{DocumentID: "doc_b", Content: "b"}
+	c := &types.SessionRAGResult{DocumentID: "doc_c", Content: "c"}
+
+	fused := ReciprocalRankFusion(
+		[]*types.SessionRAGResult{a, b},
+		// Same chunk returned by the second query as a different instance
+		[]*types.SessionRAGResult{c, {DocumentID: "doc_b", Content: "b"}},
+	)
+
+	require.Len(t, fused, 3)
+	// Found by both queries
+	require.Equal(t, "doc_b", fused[0].DocumentID)
+	// Both at the top of one list, first seen wins
+	require.Equal(t, "doc_a", fused[1].DocumentID)
+	require.Equal(t, "doc_c", fused[2].DocumentID)
+}
+
+func TestReciprocalRankFusion_Empty(t *testing.T) {
+	require.Empty(t, ReciprocalRankFusion())
+	require.Empty(t, ReciprocalRankFusion(nil, nil))
+}
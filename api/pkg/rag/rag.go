@@ -2,14 +2,42 @@ package rag
 
 import (
 	"context"
+	"errors"
 
 	"github.com/helixml/helix/api/pkg/types"
 )
 
 //go:generate mockgen -source $GOFILE -destination rag_mocks.go -package $GOPACKAGE
 
+// ErrNotSupported is returned by the RAG backends that can't perform the operation,
+// callers are expected to fall back to a different approach
+var ErrNotSupported = errors.New("operation not supported by the RAG backend")
+
 type RAG interface {
 	Index(ctx context.Context, req ...*types.SessionRAGIndexChunk) error
 	Query(ctx context.Context, q *types.SessionRAGQuery) ([]*types.SessionRAGResult, error)
 	Delete(ctx context.Context, req *types.DeleteIndexRequest) error
+	// Copy copies the indexed chunks of the documents into another data entity
+	// without re-embedding them, used to carry unchanged documents over to
+	// the new knowledge version
+	Copy(ctx context.Context, req *types.CopyIndexRequest) error
+	// List returns the indexed chunks without their embeddings, used to
+	// inspect what was indexed for a knowledge version
+	List(ctx context.Context, req *types.ListIndexRequest) (*types.ListIndexResponse, error)
+	// DeleteDocuments deletes the chunks of the documents, the rest of
+	// the data entity stays indexed
+	DeleteDocuments(ctx context.Context, req *types.DeleteDocumentsRequest) error
+}
+
+// defaultListLimit is the page size when listing the chunks without a limit
+const defaultListLimit = 50
+
+// getListPage returns the bounds of the requested page of the listed chunks
+func getListPage(total, offset, limit int) (int, int) {
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+
+	start := min(max(offset, 0), total)
+	return start, min(start+limit, total)
 }
@@ -0,0 +1,714 @@
+package rag
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/helixml/helix/api/pkg/config"
+	"github.com/helixml/helix/api/pkg/openai/manager"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+const (
+	embeddedHashDimensions = 512
+
+	// BM25 parameters, the usual defaults
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+// Static check
+var _ RAG = &Embedded{}
+
+// Embedded is a RAG backend that runs inside the API process. Chunks and their
+// embeddings are stored on local disk, one file per data entity, and searched by
+// brute force which is fast enough for the size of a single knowledge or session.
+// Vector similarity is combined with BM25 keyword scoring.
+//
+// The file of an entity is a sequence of length prefixed gob batches so that indexing
+// only appends the new chunks. The most recently used entities are kept in memory.
+type Embedded struct {
+	path            string
+	embedder        Embedder
+	maxCachedChunks int // Zero means no limit
+
+	mu           sync.Mutex
+	entities     map[string]*embeddedEntity
+	cachedChunks int
+	lastUsed     uint64
+}
+
+type embeddedEntity struct {
+	chunks []*embeddedChunk
+	// Keyword statistics, rebuilt when the chunks change
+	docFreq   map[string]int
+	avgLength float64
+	// lastUsed orders the cached entities for eviction, guarded by the Embedded lock
+	lastUsed uint64
+}
+
+type embeddedChunk struct {
+	Chunk     types.SessionRAGIndexChunk
+	Embedding []float32
+
+	termFreq map[string]int
+	length   int
+}
+
+func NewEmbedded(cfg *config.ServerConfig, providerManager manager.ProviderManager) (*Embedded, error) {
+	path := cfg.RAG.Embedded.Path
+	if path == "" {
+		path = filepath.Join(cfg.FileStore.LocalFSPath, "rag")
+	}
+
+	err := os.MkdirAll(path, 0755)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedded RAG directory: %w", err)
+	}
+
+	e := NewEmbedder(providerManager, cfg.RAG.Embedded.Provider, cfg.RAG.Embedded.EmbeddingsModel)
+
+	return newEmbedded(path, e, cfg.RAG.Embedded.CacheMaxChunks), nil
+}
+
+func newEmbedded(path string, e Embedder, maxCachedChunks int) *Embedded {
+	return &Embedded{
+		path:            path,
+		embedder:        e,
+		maxCachedChunks: maxCachedChunks,
+		entities:        make(map[string]*embeddedEntity),
+	}
+}
+
+func (e *Embedded) Index(ctx context.Context, indexReqs ...*types.SessionRAGIndexChunk) error {
+	if len(indexReqs) == 0 {
+		return fmt.Errorf("no index requests provided")
+	}
+
+	indexChunks := make([]*types.SessionRAGIndexChunk, 0, len(indexReqs))
+	for _, indexReq := range indexReqs {
+		if indexReq.DataEntityID == "" {
+			return fmt.Errorf("data entity ID cannot be empty")
+		}
+		// Embedding providers reject empty inputs
+		if strings.TrimSpace(indexReq.Content) == "" {
+			continue
+		}
+		indexChunks = append(indexChunks, indexReq)
+	}
+
+	if len(indexChunks) == 0 {
+		return nil
+	}
+
+	contents := make([]string, 0, len(indexChunks))
+	for _, indexReq := range indexChunks {
+		contents = append(contents, indexReq.Content)
+	}
+
+	embeddings, err := e.embedder.Embed(ctx, contents)
+	if err != nil {
+		return err
+	}
+
+	// Group by the data entity, a batch normally belongs to a single one
+	chunks := make(map[string][]*embeddedChunk)
+	for idx, indexReq := range indexChunks {
+		chunks[indexReq.DataEntityID] = append(chunks[indexReq.DataEntityID], newEmbeddedChunk(*indexReq, embeddings[idx]))
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for dataEntityID, newChunks := range chunks {
+		err = e.appendChunks(dataEntityID, newChunks)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Query ranks the chunks by fusing the vector similarity and the BM25 ranks (reciprocal
+// rank fusion). Vector matches further away than the distance threshold are ignored,
+// keyword matches are kept regardless as they are often exact names or identifiers.
+func (e *Embedded) Query(ctx context.Context, q *types.SessionRAGQuery) ([]*types.SessionRAGResult, error) {
+	if q.Prompt == "" {
+		return nil, fmt.Errorf("prompt cannot be empty")
+	}
+
+	if q.DataEntityID == "" {
+		return nil, fmt.Errorf("data entity ID cannot be empty")
+	}
+
+	distanceFn, err := getEmbeddedDistanceFunction(q.DistanceFunction)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, filter := range q.Filters {
+		if err := ValidateFilter(filter); err != nil {
+			return nil, err
+		}
+	}
+
+	maxResults := q.MaxResults
+	if maxResults == 0 {
+		maxResults = DefaultMaxResults
+	}
+
+	threshold := q.DistanceThreshold
+	if threshold == 0 {
+		threshold = DefaultThreshold
+	}
+
+	embeddings, err := e.embedder.Embed(ctx, []string{q.Prompt})
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	entity, err := e.loadEntity(q.DataEntityID)
+	e.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := max(maxResults*4, hybridMinCandidates)
+
+	distances := make([]float64, len(entity.chunks))
+	var vectorMatches []int
+
+	for idx, chunk := range entity.chunks {
+		if !MatchFilters(chunk.Chunk.Metadata, q.Filters) {
+			continue
+		}
+
+		distances[idx] = distanceFn(embeddings[0], chunk.Embedding)
+		if distances[idx] < threshold {
+			vectorMatches = append(vectorMatches, idx)
+		}
+	}
+
+	sort.SliceStable(vectorMatches, func(i, j int) bool {
+		return distances[vectorMatches[i]] < distances[vectorMatches[j]]
+	})
+
+	keywordScores := entity.bm25(tokenize(q.Prompt))
+	var keywordMatches []int
+
+	for idx, score := range keywordScores {
+		if score > 0 && MatchFilters(entity.chunks[idx].Chunk.Metadata, q.Filters) {
+			keywordMatches = append(keywordMatches, idx)
+		}
+	}
+
+	sort.SliceStable(keywordMatches, func(i, j int) bool {
+		return keywordScores[keywordMatches[i]] > keywordScores[keywordMatches[j]]
+	})
+
+	scores := make(map[int]float64)
+	for _, matches := range [][]int{vectorMatches, keywordMatches} {
+		for rank, idx := range matches[:min(len(matches), candidates)] {
+			scores[idx] += 1.0 / float64(hybridRRFConstant+rank+1)
+		}
+	}
+
+	ranked := make([]int, 0, len(scores))
+	for idx := range scores {
+		ranked = append(ranked, idx)
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if scores[ranked[i]] == scores[ranked[j]] {
+			return ranked[i] < ranked[j]
+		}
+		return scores[ranked[i]] > scores[ranked[j]]
+	})
+
+	results := make([]*types.SessionRAGResult, 0, min(len(ranked), maxResults))
+	for _, idx := range ranked[:min(len(ranked), maxResults)] {
+		chunk := entity.chunks[idx].Chunk
+		results = append(results, &types.SessionRAGResult{
+			DocumentID:      chunk.DocumentID,
+			DocumentGroupID: chunk.DocumentGroupID,
+			Source:          chunk.Source,
+			Filename:        chunk.Filename,
+			ContentOffset:   chunk.ContentOffset,
+			Content:         chunk.Content,
+			Distance:        distances[idx],
+			Metadata:        chunk.Metadata,
+		})
+	}
+
+	log.Info().Int("num_results", len(results)).Msg("embedded RAG results")
+
+	return results, nil
+}
+
+func (e *Embedded) Delete(_ context.Context, r *types.DeleteIndexRequest) error {
+	filename, err := e.getFilename(r.DataEntityID)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.uncacheEntity(r.DataEntityID)
+
+	err = os.Remove(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("error deleting chunks: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteDocuments rewrites the entity without the chunks of the documents
+func (e *Embedded) DeleteDocuments(_ context.Context, r *types.DeleteDocumentsRequest) error {
+	groups := make(map[string]bool, len(r.DocumentGroupIDs))
+	for _, id := range r.DocumentGroupIDs {
+		groups[id] = true
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	entity, err := e.loadEntity(r.DataEntityID)
+	if err != nil {
+		return err
+	}
+
+	chunks := make([]*embeddedChunk, 0, len(entity.chunks))
+	for _, chunk := range entity.chunks {
+		if !groups[chunk.Chunk.DocumentGroupID] {
+			chunks = append(chunks, chunk)
+		}
+	}
+
+	if len(chunks) == len(entity.chunks) {
+		return nil
+	}
+
+	return e.saveEntity(r.DataEntityID, chunks)
+}
+
+func (e *Embedded) List(_ context.Context, r *types.ListIndexRequest) (*types.ListIndexResponse, error) {
+	e.mu.Lock()
+	entity, err := e.loadEntity(r.DataEntityID)
+	e.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var matching []types.SessionRAGIndexChunk
+	for _, chunk := range entity.chunks {
+		if r.DocumentGroupID == "" || chunk.Chunk.DocumentGroupID == r.DocumentGroupID {
+			matching = append(matching, chunk.Chunk)
+		}
+	}
+
+	sort.SliceStable(matching, func(i, j int) bool {
+		if matching[i].DocumentID != matching[j].DocumentID {
+			return matching[i].DocumentID < matching[j].DocumentID
+		}
+		return matching[i].ContentOffset < matching[j].ContentOffset
+	})
+
+	start, end := getListPage(len(matching), r.Offset, r.Limit)
+
+	resp := &types.ListIndexResponse{
+		Chunks: make([]*types.SessionRAGResult, 0, end-start),
+		Total:  len(matching),
+	}
+
+	for _, chunk := range matching[start:end] {
+		resp.Chunks = append(resp.Chunks, &types.SessionRAGResult{
+			DocumentID:      chunk.DocumentID,
+			DocumentGroupID: chunk.DocumentGroupID,
+			Source:          chunk.Source,
+			Filename:        chunk.Filename,
+			ContentOffset:   chunk.ContentOffset,
+			Content:         chunk.Content,
+			Metadata:        chunk.Metadata,
+		})
+	}
+
+	return resp, nil
+}
+
+// Copy duplicates the chunks, embeddings included, under the new data entity ID
+func (e *Embedded) Copy(_ context.Context, r *types.CopyIndexRequest) error {
+	groups := make(map[string]bool, len(r.DocumentGroupIDs))
+	for _, id := range r.DocumentGroupIDs {
+		groups[id] = true
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	from, err := e.loadEntity(r.FromDataEntityID)
+	if err != nil {
+		return err
+	}
+
+	var chunks []*embeddedChunk
+	for _, chunk := range from.chunks {
+		if !groups[chunk.Chunk.DocumentGroupID] {
+			continue
+		}
+
+		copied := chunk.Chunk
+		copied.DataEntityID = r.ToDataEntityID
+		chunks = append(chunks, newEmbeddedChunk(copied, chunk.Embedding))
+	}
+
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	return e.appendChunks(r.ToDataEntityID, chunks)
+}
+
+// loadEntity returns the cached entity or reads it from the disk, an entity
+// that was never indexed is empty. Must be called with the lock held.
+func (e *Embedded) loadEntity(dataEntityID string) (*embeddedEntity, error) {
+	if entity, ok := e.entities[dataEntityID]; ok {
+		e.lastUsed++
+		entity.lastUsed = e.lastUsed
+		return entity, nil
+	}
+
+	filename, err := e.getFilename(dataEntityID)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// Nothing indexed yet, not cached so that queries for unknown
+			// entities don't fill up the memory
+			return newEmbeddedEntity(nil), nil
+		}
+		return nil, fmt.Errorf("error opening chunks file: %w", err)
+	}
+	defer f.Close()
+
+	chunks, err := readChunks(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("error reading chunks file '%s': %w", filename, err)
+	}
+
+	for _, chunk := range chunks {
+		chunk.analyze()
+	}
+
+	entity := newEmbeddedEntity(chunks)
+	e.cacheEntity(dataEntityID, entity)
+
+	return entity, nil
+}
+
+// saveEntity replaces the chunks, they are written to a temporary file first so that
+// a crash doesn't leave a partially written file behind. Must be called with the lock held.
+func (e *Embedded) saveEntity(dataEntityID string, chunks []*embeddedChunk) error {
+	filename, err := e.getFilename(dataEntityID)
+	if err != nil {
+		return err
+	}
+
+	batch, err := encodeChunks(chunks)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(e.path, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("error creating chunks file: %w", err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.Write(batch)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("error writing chunks file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing chunks file: %w", err)
+	}
+
+	err = os.Rename(f.Name(), filename)
+	if err != nil {
+		return fmt.Errorf("error writing chunks file: %w", err)
+	}
+
+	e.cacheEntity(dataEntityID, newEmbeddedEntity(chunks))
+
+	return nil
+}
+
+// appendChunks adds a batch to the end of the file, the cached entity is dropped and
+// read again on the next query. Must be called with the lock held.
+func (e *Embedded) appendChunks(dataEntityID string, chunks []*embeddedChunk) error {
+	filename, err := e.getFilename(dataEntityID)
+	if err != nil {
+		return err
+	}
+
+	batch, err := encodeChunks(chunks)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("error opening chunks file: %w", err)
+	}
+
+	_, err = f.Write(batch)
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("error writing chunks file: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("error writing chunks file: %w", err)
+	}
+
+	e.uncacheEntity(dataEntityID)
+
+	return nil
+}
+
+// cacheEntity keeps the entity in memory and evicts the least recently used
+// entities above the limit. Must be called with the lock held.
+func (e *Embedded) cacheEntity(dataEntityID string, entity *embeddedEntity) {
+	e.uncacheEntity(dataEntityID)
+
+	// Too large to keep, it's read from the disk every time
+	if e.maxCachedChunks > 0 && len(entity.chunks) > e.maxCachedChunks {
+		return
+	}
+
+	e.lastUsed++
+	entity.lastUsed = e.lastUsed
+	e.entities[dataEntityID] = entity
+	e.cachedChunks += len(entity.chunks)
+
+	for e.maxCachedChunks > 0 && e.cachedChunks > e.maxCachedChunks {
+		var oldest string
+		for id, cached := range e.entities {
+			if oldest == "" || cached.lastUsed < e.entities[oldest].lastUsed {
+				oldest = id
+			}
+		}
+		e.uncacheEntity(oldest)
+	}
+}
+
+// uncacheEntity must be called with the lock held
+func (e *Embedded) uncacheEntity(dataEntityID string) {
+	if entity, ok := e.entities[dataEntityID]; ok {
+		e.cachedChunks -= len(entity.chunks)
+		delete(e.entities, dataEntityID)
+	}
+}
+
+// encodeChunks encodes a batch of the chunks file, a gob prefixed with its length
+func encodeChunks(chunks []*embeddedChunk) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(make([]byte, 4))
+
+	err := gob.NewEncoder(&buf).Encode(chunks)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding chunks: %w", err)
+	}
+
+	batch := buf.Bytes()
+	binary.BigEndian.PutUint32(batch, uint32(len(batch)-4))
+
+	return batch, nil
+}
+
+// readChunks reads all the batches of a chunks file. A batch cut short by a crash
+// while appending is skipped, the version it belonged to never became ready.
+func readChunks(r io.Reader) ([]*embeddedChunk, error) {
+	var (
+		chunks []*embeddedChunk
+		header [4]byte
+	)
+
+	for {
+		_, err := io.ReadFull(r, header[:])
+		if errors.Is(err, io.EOF) {
+			return chunks, nil
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			log.Warn().Msg("skipping a partially written batch of chunks")
+			return chunks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		batch := make([]byte, binary.BigEndian.Uint32(header[:]))
+
+		_, err = io.ReadFull(r, batch)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			log.Warn().Msg("skipping a partially written batch of chunks")
+			return chunks, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var batchChunks []*embeddedChunk
+
+		err = gob.NewDecoder(bytes.NewReader(batch)).Decode(&batchChunks)
+		if err != nil {
+			return nil, err
+		}
+
+		chunks = append(chunks, batchChunks...)
+	}
+}
+
+func (e *Embedded) getFilename(dataEntityID string) (string, error) {
+	if dataEntityID == "" {
+		return "", fmt.Errorf("data entity ID cannot be empty")
+	}
+
+	if strings.ContainsAny(dataEntityID, `/\`) || strings.HasPrefix(dataEntityID, ".") {
+		return "", fmt.Errorf("invalid data entity ID '%s'", dataEntityID)
+	}
+
+	return filepath.Join(e.path, dataEntityID+".gob"), nil
+}
+
+func newEmbeddedChunk(chunk types.SessionRAGIndexChunk, embedding []float32) *embeddedChunk {
+	c := &embeddedChunk{
+		Chunk:     chunk,
+		Embedding: embedding,
+	}
+	c.analyze()
+	return c
+}
+
+func (c *embeddedChunk) analyze() {
+	tokens := tokenize(c.Chunk.Content)
+
+	c.termFreq = make(map[string]int)
+	for _, token := range tokens {
+		c.termFreq[token]++
+	}
+	c.length = len(tokens)
+}
+
+func newEmbeddedEntity(chunks []*embeddedChunk) *embeddedEntity {
+	entity := &embeddedEntity{
+		chunks:  chunks,
+		docFreq: make(map[string]int),
+	}
+
+	var totalLength int
+	for _, chunk := range chunks {
+		totalLength += chunk.length
+		for term := range chunk.termFreq {
+			entity.docFreq[term]++
+		}
+	}
+
+	if len(chunks) > 0 {
+		entity.avgLength = float64(totalLength) / float64(len(chunks))
+	}
+
+	return entity
+}
+
+// bm25 scores every chunk against the query terms
+func (e *embeddedEntity) bm25(terms []string) []float64 {
+	scores := make([]float64, len(e.chunks))
+	if e.avgLength == 0 {
+		return scores
+	}
+
+	n := float64(len(e.chunks))
+
+	for _, term := range terms {
+		df := float64(e.docFreq[term])
+		if df == 0 {
+			continue
+		}
+
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+		for idx, chunk := range e.chunks {
+			tf := float64(chunk.termFreq[term])
+			if tf == 0 {
+				continue
+			}
+
+			norm := 1 - bm25B + bm25B*float64(chunk.length)/e.avgLength
+			scores[idx] += idf * tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+		}
+	}
+
+	return scores
+}
+
+// getEmbeddedDistanceFunction returns the distance for the RAG settings distance function,
+// inner product is negated so that lower is better for all of them (same as pgvector)
+func getEmbeddedDistanceFunction(distanceFunction string) (func(a, b []float32) float64, error) {
+	switch distanceFunction {
+	case "", "cosine":
+		return func(a, b []float32) float64 {
+			var dot, normA, normB float64
+			for i := range min(len(a), len(b)) {
+				dot += float64(a[i]) * float64(b[i])
+				normA += float64(a[i]) * float64(a[i])
+				normB += float64(b[i]) * float64(b[i])
+			}
+			if normA == 0 || normB == 0 {
+				return 1
+			}
+			return 1 - dot/(math.Sqrt(normA)*math.Sqrt(normB))
+		}, nil
+	case "l2":
+		return func(a, b []float32) float64 {
+			var sum float64
+			for i := range min(len(a), len(b)) {
+				d := float64(a[i]) - float64(b[i])
+				sum += d * d
+			}
+			return math.Sqrt(sum)
+		}, nil
+	case "inner_product":
+		return func(a, b []float32) float64 {
+			var dot float64
+			for i := range min(len(a), len(b)) {
+				dot += float64(a[i]) * float64(b[i])
+			}
+			return -dot
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown distance function '%s', use one of cosine, l2 or inner_product", distanceFunction)
+	}
+}
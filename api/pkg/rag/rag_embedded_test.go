@@ -0,0 +1,332 @@
+package rag
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+
+	"github.com/helixml/helix/api/pkg/system"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+type EmbeddedTestSuite struct {
+	suite.Suite
+
+	ctx      context.Context
+	path     string
+	embedded *Embedded
+}
+
+func TestEmbeddedTestSuite(t *testing.T) {
+	suite.Run(t, new(EmbeddedTestSuite))
+}
+
+func (suite *EmbeddedTestSuite) SetupTest() {
+	suite.ctx = context.Background()
+	suite.path = suite.T().TempDir()
+	suite.embedded = newEmbedded(suite.path, &hashEmbedder{dimensions: embeddedHashDimensions}, 0)
+}
+
+func (suite *EmbeddedTestSuite) index(dataEntityID string) {
+	err := suite.embedded.Index(suite.ctx,
+		&types.SessionRAGIndexChunk{
+			DataEntityID:    dataEntityID,
+			Source:          "sharks.txt",
+			DocumentID:      "doc_1",
+			DocumentGroupID: "group_1",
+			Content:         "Tiger sharks are opportunistic predators that eat whatever they can overpower.",
+			Metadata:        map[string]string{"path": "/animals/sharks.txt"},
+		},
+		&types.SessionRAGIndexChunk{
+			DataEntityID:    dataEntityID,
+			Source:          "music.txt",
+			DocumentID:      "doc_2",
+			DocumentGroupID: "group_2",
+			Content:         "Taylor Swift released The Tortured Poets Department and went on the Eras tour.",
+			Metadata:        map[string]string{"path": "/music/swift.txt"},
+		},
+		&types.SessionRAGIndexChunk{
+			DataEntityID:    dataEntityID,
+			Source:          "empty.txt",
+			DocumentGroupID: "group_3",
+			Content:         "  ",
+		},
+	)
+	suite.Require().NoError(err)
+}
+
+func (suite *EmbeddedTestSuite) TestIndexAndQuery() {
+	dataEntityID := system.GenerateDataEntityID()
+	suite.index(dataEntityID)
+
+	results, err := suite.embedded.Query(suite.ctx, &types.SessionRAGQuery{
+		Prompt:       "what do tiger sharks eat?",
+		DataEntityID: dataEntityID,
+		MaxResults:   3,
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	suite.Equal("sharks.txt", results[0].Source)
+	suite.Equal("group_1", results[0].DocumentGroupID)
+
+	results, err = suite.embedded.Query(suite.ctx, &types.SessionRAGQuery{
+		Prompt:       "Eras tour",
+		DataEntityID: dataEntityID,
+		MaxResults:   3,
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	suite.Equal("music.txt", results[0].Source)
+}
+
+func (suite *EmbeddedTestSuite) TestQuery_VectorMatch() {
+	dataEntityID := system.GenerateDataEntityID()
+	suite.index(dataEntityID)
+
+	// No exact words in common, matched by the trigrams only
+	results, err := suite.embedded.Query(suite.ctx, &types.SessionRAGQuery{
+		Prompt:            "opportunist predator",
+		DataEntityID:      dataEntityID,
+		DistanceThreshold: 0.9,
+		MaxResults:        1,
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	suite.Equal("sharks.txt", results[0].Source)
+	suite.Less(results[0].Distance, 0.9)
+}
+
+func (suite *EmbeddedTestSuite) TestQuery_Filters() {
+	dataEntityID := system.GenerateDataEntityID()
+	suite.index(dataEntityID)
+
+	results, err := suite.embedded.Query(suite.ctx, &types.SessionRAGQuery{
+		Prompt:       "sharks Swift",
+		DataEntityID: dataEntityID,
+		MaxResults:   3,
+		Filters: []*types.RAGFilter{
+			{Key: "path", Operator: types.RAGFilterOperatorStartsWith, Value: "/music/"},
+		},
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	suite.Equal("music.txt", results[0].Source)
+	suite.Equal("/music/swift.txt", results[0].Metadata["path"])
+
+	results, err = suite.embedded.Query(suite.ctx, &types.SessionRAGQuery{
+		Prompt:       "sharks",
+		DataEntityID: dataEntityID,
+		Filters: []*types.RAGFilter{
+			{Key: "path", Operator: types.RAGFilterOperatorNotEquals, Value: "/animals/sharks.txt"},
+		},
+	})
+	suite.Require().NoError(err)
+	suite.Empty(results)
+
+	_, err = suite.embedded.Query(suite.ctx, &types.SessionRAGQuery{
+		Prompt:       "sharks",
+		DataEntityID: dataEntityID,
+		Filters: []*types.RAGFilter{
+			{Key: "path", Operator: "~"},
+		},
+	})
+	suite.Error(err)
+}
+
+func (suite *EmbeddedTestSuite) TestQuery_UnknownEntity() {
+	results, err := suite.embedded.Query(suite.ctx, &types.SessionRAGQuery{
+		Prompt:       "sharks",
+		DataEntityID: "unknown",
+	})
+	suite.Require().NoError(err)
+	suite.Empty(results)
+}
+
+func (suite *EmbeddedTestSuite) TestPersistence() {
+	dataEntityID := system.GenerateDataEntityID()
+	suite.index(dataEntityID)
+
+	// A new instance loads the chunks from the disk
+	reopened := newEmbedded(suite.path, &hashEmbedder{dimensions: embeddedHashDimensions}, 0)
+
+	results, err := reopened.Query(suite.ctx, &types.SessionRAGQuery{
+		Prompt:       "sharks",
+		DataEntityID: dataEntityID,
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	suite.Equal("sharks.txt", results[0].Source)
+}
+
+func (suite *EmbeddedTestSuite) TestDelete() {
+	dataEntityID := system.GenerateDataEntityID()
+	suite.index(dataEntityID)
+
+	err := suite.embedded.Delete(suite.ctx, &types.DeleteIndexRequest{DataEntityID: dataEntityID})
+	suite.Require().NoError(err)
+
+	reopened := newEmbedded(suite.path, &hashEmbedder{dimensions: embeddedHashDimensions}, 0)
+
+	for _, e := range []*Embedded{suite.embedded, reopened} {
+		results, err := e.Query(suite.ctx, &types.SessionRAGQuery{
+			Prompt:       "sharks",
+			DataEntityID: dataEntityID,
+		})
+		suite.Require().NoError(err)
+		suite.Empty(results)
+	}
+}
+
+func (suite *EmbeddedTestSuite) TestCopy() {
+	from := system.GenerateDataEntityID()
+	to := system.GenerateDataEntityID()
+	suite.index(from)
+
+	err := suite.embedded.Copy(suite.ctx, &types.CopyIndexRequest{
+		FromDataEntityID: from,
+		ToDataEntityID:   to,
+		DocumentGroupIDs: []string{"group_2"},
+	})
+	suite.Require().NoError(err)
+
+	results, err := suite.embedded.Query(suite.ctx, &types.SessionRAGQuery{
+		Prompt:       "sharks Swift",
+		DataEntityID: to,
+		MaxResults:   10,
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	suite.Equal("music.txt", results[0].Source)
+}
+
+func (suite *EmbeddedTestSuite) TestList() {
+	dataEntityID := system.GenerateDataEntityID()
+	suite.index(dataEntityID)
+
+	err := suite.embedded.Index(suite.ctx, &types.SessionRAGIndexChunk{
+		DataEntityID:    dataEntityID,
+		Source:          "sharks.txt",
+		DocumentID:      "doc_1",
+		DocumentGroupID: "group_1",
+		ContentOffset:   1,
+		Content:         "Great white sharks can grow to six meters.",
+	})
+	suite.Require().NoError(err)
+
+	resp, err := suite.embedded.List(suite.ctx, &types.ListIndexRequest{DataEntityID: dataEntityID})
+	suite.Require().NoError(err)
+	suite.Equal(3, resp.Total)
+	suite.Require().Len(resp.Chunks, 3)
+	suite.Equal("doc_1", resp.Chunks[0].DocumentID)
+	suite.Equal(0, resp.Chunks[0].ContentOffset)
+	suite.Equal(1, resp.Chunks[1].ContentOffset)
+	suite.Equal("doc_2", resp.Chunks[2].DocumentID)
+
+	resp, err = suite.embedded.List(suite.ctx, &types.ListIndexRequest{
+		DataEntityID:    dataEntityID,
+		DocumentGroupID: "group_1",
+		Offset:          1,
+		Limit:           5,
+	})
+	suite.Require().NoError(err)
+	suite.Equal(2, resp.Total)
+	suite.Require().Len(resp.Chunks, 1)
+	suite.Equal("Great white sharks can grow to six meters.", resp.Chunks[0].Content)
+}
+
+func (suite *EmbeddedTestSuite) TestDeleteDocuments() {
+	dataEntityID := system.GenerateDataEntityID()
+	suite.index(dataEntityID)
+
+	err := suite.embedded.DeleteDocuments(suite.ctx, &types.DeleteDocumentsRequest{
+		DataEntityID:     dataEntityID,
+		DocumentGroupIDs: []string{"group_1"},
+	})
+	suite.Require().NoError(err)
+
+	resp, err := suite.embedded.List(suite.ctx, &types.ListIndexRequest{DataEntityID: dataEntityID})
+	suite.Require().NoError(err)
+	suite.Require().Len(resp.Chunks, 1)
+	suite.Equal("doc_2", resp.Chunks[0].DocumentID)
+
+	// Deletion is persisted
+	reopened := newEmbedded(suite.path, &hashEmbedder{dimensions: embeddedHashDimensions}, 0)
+	resp, err = reopened.List(suite.ctx, &types.ListIndexRequest{DataEntityID: dataEntityID})
+	suite.Require().NoError(err)
+	suite.Equal(1, resp.Total)
+}
+
+func (suite *EmbeddedTestSuite) TestInvalidDataEntityID() {
+	err := suite.embedded.Index(suite.ctx, &types.SessionRAGIndexChunk{
+		DataEntityID: "../escape",
+		Content:      "sharks",
+	})
+	suite.Error(err)
+}
+
+func (suite *EmbeddedTestSuite) TestIndex_AppendsBatches() {
+	dataEntityID := system.GenerateDataEntityID()
+	suite.index(dataEntityID)
+
+	// Cached by the query, the next batch has to show up too
+	resp, err := suite.embedded.List(suite.ctx, &types.ListIndexRequest{DataEntityID: dataEntityID})
+	suite.Require().NoError(err)
+	suite.Equal(2, resp.Total)
+
+	err = suite.embedded.Index(suite.ctx, &types.SessionRAGIndexChunk{
+		DataEntityID:    dataEntityID,
+		Source:          "whales.txt",
+		DocumentID:      "doc_3",
+		DocumentGroupID: "group_4",
+		Content:         "Blue whales eat krill.",
+	})
+	suite.Require().NoError(err)
+
+	resp, err = suite.embedded.List(suite.ctx, &types.ListIndexRequest{DataEntityID: dataEntityID})
+	suite.Require().NoError(err)
+	suite.Equal(3, resp.Total)
+
+	// A batch cut short by a crash is skipped
+	filename, err := suite.embedded.getFilename(dataEntityID)
+	suite.Require().NoError(err)
+
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0644)
+	suite.Require().NoError(err)
+	_, err = f.Write([]byte{0, 0, 1, 0, 1, 2})
+	suite.Require().NoError(err)
+	suite.Require().NoError(f.Close())
+
+	reopened := newEmbedded(suite.path, &hashEmbedder{dimensions: embeddedHashDimensions}, 0)
+
+	resp, err = reopened.List(suite.ctx, &types.ListIndexRequest{DataEntityID: dataEntityID})
+	suite.Require().NoError(err)
+	suite.Equal(3, resp.Total)
+}
+
+func (suite *EmbeddedTestSuite) TestCache_MaxChunks() {
+	embedded := newEmbedded(suite.path, &hashEmbedder{dimensions: embeddedHashDimensions}, 3)
+
+	first := system.GenerateDataEntityID()
+	second := system.GenerateDataEntityID()
+	suite.index(first)
+	suite.index(second)
+
+	for _, id := range []string{first, second} {
+		_, err := embedded.List(suite.ctx, &types.ListIndexRequest{DataEntityID: id})
+		suite.Require().NoError(err)
+	}
+
+	// Each entity has 2 chunks, only the most recently used one fits
+	suite.NotContains(embedded.entities, first)
+	suite.Contains(embedded.entities, second)
+	suite.Equal(2, embedded.cachedChunks)
+
+	// Evicted entities are read from the disk again
+	resp, err := embedded.List(suite.ctx, &types.ListIndexRequest{DataEntityID: first})
+	suite.Require().NoError(err)
+	suite.Equal(2, resp.Total)
+	suite.Contains(embedded.entities, first)
+	suite.NotContains(embedded.entities, second)
+}
@@ -21,6 +21,10 @@ const (
 
 	DefaultChunkSize     = 2048
 	DefaultChunkOverflow = 20
+
+	// llamaindexFilterOverFetch multiplies the results requested from the service for
+	// filtered queries, the filters are applied on the returned results
+	llamaindexFilterOverFetch = 5
 )
 
 // Static check
@@ -117,6 +121,12 @@ func (l *Llamaindex) Query(ctx context.Context, q *types.SessionRAGQuery) ([]*ty
 		return nil, fmt.Errorf("data entity ID cannot be empty")
 	}
 
+	for _, filter := range q.Filters {
+		if err := ValidateFilter(filter); err != nil {
+			return nil, err
+		}
+	}
+
 	// Set defaults
 	if q.DistanceFunction == "" {
 		q.DistanceFunction = DefaultDistanceFunction
@@ -130,7 +140,15 @@ func (l *Llamaindex) Query(ctx context.Context, q *types.SessionRAGQuery) ([]*ty
 		q.MaxResults = DefaultMaxResults
 	}
 
-	bts, err := json.Marshal(q)
+	// The service may not support the filters, more results are requested so that
+	// enough of them remain after filtering. Matching chunks ranked below the
+	// over-fetched results are still missed.
+	query := *q
+	if len(q.Filters) > 0 {
+		query.MaxResults = q.MaxResults * llamaindexFilterOverFetch
+	}
+
+	bts, err := json.Marshal(&query)
 	if err != nil {
 		return nil, err
 	}
@@ -172,6 +190,18 @@ func (l *Llamaindex) Query(ctx context.Context, q *types.SessionRAGQuery) ([]*ty
 		}
 	}
 
+	// The filters are sent with the query, they are applied again to the returned
+	// metadata in case the service doesn't support them
+	if len(q.Filters) > 0 {
+		filtered := make([]*types.SessionRAGResult, 0, len(queryResp))
+		for _, result := range queryResp {
+			if MatchFilters(result.Metadata, q.Filters) {
+				filtered = append(filtered, result)
+			}
+		}
+		queryResp = filtered[:min(len(filtered), q.MaxResults)]
+	}
+
 	logger.Trace().Msg("query results")
 
 	return queryResp, nil
@@ -223,3 +253,16 @@ func (l *Llamaindex) Delete(ctx context.Context, r *types.DeleteIndexRequest) er
 
 	return nil
 }
+
+// Copy is not supported by the llamaindex API, documents have to be re-indexed
+func (l *Llamaindex) Copy(_ context.Context, _ *types.CopyIndexRequest) error {
+	return ErrNotSupported
+}
+
+func (l *Llamaindex) List(_ context.Context, _ *types.ListIndexRequest) (*types.ListIndexResponse, error) {
+	return nil, ErrNotSupported
+}
+
+func (l *Llamaindex) DeleteDocuments(_ context.Context, _ *types.DeleteDocumentsRequest) error {
+	return ErrNotSupported
+}
@@ -2,6 +2,9 @@ package rag
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 
@@ -86,3 +89,40 @@ func TestRAG(t *testing.T) {
 		require.Len(t, results, 0)
 	})
 }
+
+func TestLlamaindexQuery_Filters(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var q types.SessionRAGQuery
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&q))
+		require.Len(t, q.Filters, 1)
+		require.Equal(t, "extension", q.Filters[0].Key)
+		require.Equal(t, 2*llamaindexFilterOverFetch, q.MaxResults, "filtered queries are over-fetched")
+
+		// Service ignoring the filters
+		_, _ = w.Write([]byte(`[
+			{"document_id": "doc_1", "content": "a", "metadata": {"extension": "pdf"}},
+			{"document_id": "doc_2", "content": "b", "metadata": {"extension": "md"}},
+			{"document_id": "doc_3", "content": "c"},
+			{"document_id": "doc_4", "content": "d", "metadata": {"extension": "pdf"}},
+			{"document_id": "doc_5", "content": "e", "metadata": {"extension": "pdf"}}
+		]`))
+	}))
+	defer ts.Close()
+
+	indexer := NewLlamaindex(&types.RAGSettings{
+		QueryURL: ts.URL,
+	})
+
+	results, err := indexer.Query(context.Background(), &types.SessionRAGQuery{
+		DataEntityID: "entity",
+		Prompt:       "hello",
+		MaxResults:   2,
+		Filters: []*types.RAGFilter{
+			{Key: "extension", Operator: types.RAGFilterOperatorEquals, Value: "pdf"},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "doc_1", results[0].DocumentID)
+	require.Equal(t, "doc_4", results[1].DocumentID)
+}
@@ -41,6 +41,20 @@ func (m *MockRAG) EXPECT() *MockRAGMockRecorder {
 	return m.recorder
 }
 
+// Copy mocks base method.
+func (m *MockRAG) Copy(ctx context.Context, req *types.CopyIndexRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Copy", ctx, req)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Copy indicates an expected call of Copy.
+func (mr *MockRAGMockRecorder) Copy(ctx, req any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Copy", reflect.TypeOf((*MockRAG)(nil).Copy), ctx, req)
+}
+
 // Delete mocks base method.
 func (m *MockRAG) Delete(ctx context.Context, req *types.DeleteIndexRequest) error {
 	m.ctrl.T.Helper()
@@ -55,6 +69,20 @@ func (mr *MockRAGMockRecorder) Delete(ctx, req any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockRAG)(nil).Delete), ctx, req)
 }
 
+// DeleteDocuments mocks base method.
+func (m *MockRAG) DeleteDocuments(ctx context.Context, req *types.DeleteDocumentsRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteDocuments", ctx, req)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteDocuments indicates an expected call of DeleteDocuments.
+func (mr *MockRAGMockRecorder) DeleteDocuments(ctx, req any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteDocuments", reflect.TypeOf((*MockRAG)(nil).DeleteDocuments), ctx, req)
+}
+
 // Index mocks base method.
 func (m *MockRAG) Index(ctx context.Context, req ...*types.SessionRAGIndexChunk) error {
 	m.ctrl.T.Helper()
@@ -74,6 +102,21 @@ func (mr *MockRAGMockRecorder) Index(ctx any, req ...any) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Index", reflect.TypeOf((*MockRAG)(nil).Index), varargs...)
 }
 
+// List mocks base method.
+func (m *MockRAG) List(ctx context.Context, req *types.ListIndexRequest) (*types.ListIndexResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, req)
+	ret0, _ := ret[0].(*types.ListIndexResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockRAGMockRecorder) List(ctx, req any) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockRAG)(nil).List), ctx, req)
+}
+
 // Query mocks base method.
 func (m *MockRAG) Query(ctx context.Context, q *types.SessionRAGQuery) ([]*types.SessionRAGResult, error) {
 	m.ctrl.T.Helper()
@@ -0,0 +1,463 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/helixml/helix/api/pkg/config"
+	"github.com/helixml/helix/api/pkg/openai/manager"
+	"github.com/helixml/helix/api/pkg/types"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	pgVectorTable = "rag_embeddings"
+)
+
+// Static check
+var _ RAG = &PGVector{}
+
+// PGVector stores the chunks and their embeddings in Postgres using the pgvector
+// extension. Queries combine vector similarity with Postgres full-text search.
+type PGVector struct {
+	db         *gorm.DB
+	embedder   Embedder
+	dimensions int
+	table      string
+}
+
+func NewPGVector(cfg *config.ServerConfig, providerManager manager.ProviderManager, db *gorm.DB) (*PGVector, error) {
+	p := &PGVector{
+		db: db,
+		embedder: &providerEmbedder{
+			providerManager: providerManager,
+			provider:        cfg.RAG.PGVector.Provider,
+			model:           cfg.RAG.PGVector.EmbeddingsModel,
+			// The column has a fixed size, set with RAG_PGVECTOR_DIMENSIONS
+			dimensions: cfg.RAG.PGVector.Dimensions,
+		},
+		dimensions: cfg.RAG.PGVector.Dimensions,
+		// Includes the schema prefix if one is configured for the store
+		table: db.NamingStrategy.TableName(pgVectorTable),
+	}
+
+	err := p.ensureTable(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pgvector table: %w", err)
+	}
+
+	return p, nil
+}
+
+func (p *PGVector) ensureTable(ctx context.Context) error {
+	indexPrefix := strings.ReplaceAll(p.table, ".", "_")
+
+	statements := []string{
+		"CREATE EXTENSION IF NOT EXISTS vector",
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+			data_entity_id TEXT NOT NULL,
+			document_id TEXT NOT NULL DEFAULT '',
+			document_group_id TEXT NOT NULL DEFAULT '',
+			source TEXT NOT NULL DEFAULT '',
+			filename TEXT NOT NULL DEFAULT '',
+			content_offset INTEGER NOT NULL DEFAULT 0,
+			content TEXT NOT NULL,
+			metadata JSONB NOT NULL DEFAULT '{}',
+			content_tsv TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', content)) STORED,
+			embedding VECTOR(%d) NOT NULL,
+			created TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`, p.table, p.dimensions),
+		// Tables created before the metadata was added
+		fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}'", p.table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_data_entity_id_idx ON %s (data_entity_id, document_group_id)", indexPrefix, p.table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_content_tsv_idx ON %s USING GIN (content_tsv)", indexPrefix, p.table),
+	}
+
+	for _, stmt := range statements {
+		if err := p.db.WithContext(ctx).Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *PGVector) Index(ctx context.Context, indexReqs ...*types.SessionRAGIndexChunk) error {
+	if len(indexReqs) == 0 {
+		return fmt.Errorf("no index requests provided")
+	}
+
+	chunks := make([]*types.SessionRAGIndexChunk, 0, len(indexReqs))
+	for _, indexReq := range indexReqs {
+		if indexReq.DataEntityID == "" {
+			return fmt.Errorf("data entity ID cannot be empty")
+		}
+		// Embedding providers reject empty inputs
+		if strings.TrimSpace(indexReq.Content) == "" {
+			continue
+		}
+		chunks = append(chunks, indexReq)
+	}
+
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	contents := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		contents = append(contents, chunk.Content)
+	}
+
+	embeddings, err := p.embedder.Embed(ctx, contents)
+	if err != nil {
+		return err
+	}
+
+	var (
+		values []string
+		args   []interface{}
+	)
+
+	for idx, chunk := range chunks {
+		metadata, err := json.Marshal(chunk.Metadata)
+		if err != nil {
+			return fmt.Errorf("error encoding chunk metadata: %w", err)
+		}
+		if chunk.Metadata == nil {
+			metadata = []byte("{}")
+		}
+
+		values = append(values, "(?, ?, ?, ?, ?, ?, ?, CAST(? AS jsonb), CAST(? AS vector))")
+		args = append(args,
+			chunk.DataEntityID,
+			chunk.DocumentID,
+			chunk.DocumentGroupID,
+			chunk.Source,
+			chunk.Filename,
+			chunk.ContentOffset,
+			chunk.Content,
+			string(metadata),
+			formatVector(embeddings[idx]),
+		)
+	}
+
+	stmt := fmt.Sprintf(`INSERT INTO %s
+		(data_entity_id, document_id, document_group_id, source, filename, content_offset, content, metadata, embedding)
+		VALUES %s`, p.table, strings.Join(values, ", "))
+
+	err = p.db.WithContext(ctx).Exec(stmt, args...).Error
+	if err != nil {
+		return fmt.Errorf("error inserting chunks: %w", err)
+	}
+
+	return nil
+}
+
+// Query ranks the chunks by fusing the vector similarity and the full-text ranks (reciprocal
+// rank fusion). Vector matches further away than the distance threshold are ignored, keyword
+// matches are kept regardless as they are often exact names or identifiers.
+func (p *PGVector) Query(ctx context.Context, q *types.SessionRAGQuery) ([]*types.SessionRAGResult, error) {
+	if q.Prompt == "" {
+		return nil, fmt.Errorf("prompt cannot be empty")
+	}
+
+	if q.DataEntityID == "" {
+		return nil, fmt.Errorf("data entity ID cannot be empty")
+	}
+
+	operator, err := getPGVectorOperator(q.DistanceFunction)
+	if err != nil {
+		return nil, err
+	}
+
+	maxResults := q.MaxResults
+	if maxResults == 0 {
+		maxResults = DefaultMaxResults
+	}
+
+	threshold := q.DistanceThreshold
+	if threshold == 0 {
+		threshold = DefaultThreshold
+	}
+
+	embeddings, err := p.embedder.Embed(ctx, []string{q.Prompt})
+	if err != nil {
+		return nil, err
+	}
+
+	distance := fmt.Sprintf("embedding %s CAST(@embedding AS vector)", operator)
+
+	params := map[string]interface{}{
+		"embedding":      formatVector(embeddings[0]),
+		"data_entity_id": q.DataEntityID,
+		"threshold":      threshold,
+		"prompt":         q.Prompt,
+		"candidates":     max(maxResults*4, hybridMinCandidates),
+		"rrf":            hybridRRFConstant,
+		"max_results":    maxResults,
+	}
+
+	filters, err := getPGVectorFilters(q.Filters, params)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`WITH vector_matches AS (
+			SELECT id, ROW_NUMBER() OVER (ORDER BY %[2]s) AS rank
+			FROM %[1]s
+			WHERE data_entity_id = @data_entity_id AND %[2]s < @threshold%[3]s
+			ORDER BY %[2]s
+			LIMIT @candidates
+		), text_matches AS (
+			SELECT id, ROW_NUMBER() OVER (ORDER BY ts_rank_cd(content_tsv, query) DESC) AS rank
+			FROM %[1]s, websearch_to_tsquery('english', @prompt) query
+			WHERE data_entity_id = @data_entity_id AND content_tsv @@ query%[3]s
+			ORDER BY rank
+			LIMIT @candidates
+		)
+		SELECT c.document_id, c.document_group_id, c.source, c.filename, c.content_offset, c.content,
+			c.metadata, c.%[2]s AS distance,
+			COALESCE(1.0 / (@rrf + v.rank), 0) + COALESCE(1.0 / (@rrf + t.rank), 0) AS score
+		FROM vector_matches v
+		FULL OUTER JOIN text_matches t ON v.id = t.id
+		JOIN %[1]s c ON c.id = COALESCE(v.id, t.id)
+		ORDER BY score DESC
+		LIMIT @max_results`, p.table, distance, filters)
+
+	var rows []struct {
+		DocumentID      string
+		DocumentGroupID string
+		Source          string
+		Filename        string
+		ContentOffset   int
+		Content         string
+		Metadata        string
+		Distance        float64
+		Score           float64
+	}
+
+	err = p.db.WithContext(ctx).Raw(query, params).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("error querying chunks: %w", err)
+	}
+
+	log.Info().Int("num_results", len(rows)).Msg("pgvector results")
+
+	results := make([]*types.SessionRAGResult, 0, len(rows))
+	for _, row := range rows {
+		var metadata map[string]string
+		if row.Metadata != "" && row.Metadata != "{}" {
+			if err := json.Unmarshal([]byte(row.Metadata), &metadata); err != nil {
+				return nil, fmt.Errorf("error decoding chunk metadata: %w", err)
+			}
+		}
+
+		results = append(results, &types.SessionRAGResult{
+			DocumentID:      row.DocumentID,
+			DocumentGroupID: row.DocumentGroupID,
+			Source:          row.Source,
+			Filename:        row.Filename,
+			ContentOffset:   row.ContentOffset,
+			Content:         row.Content,
+			Distance:        row.Distance,
+			Metadata:        metadata,
+		})
+	}
+
+	return results, nil
+}
+
+func (p *PGVector) Delete(ctx context.Context, r *types.DeleteIndexRequest) error {
+	if r.DataEntityID == "" {
+		return fmt.Errorf("data entity ID cannot be empty")
+	}
+
+	err := p.db.WithContext(ctx).Exec(fmt.Sprintf("DELETE FROM %s WHERE data_entity_id = ?", p.table), r.DataEntityID).Error
+	if err != nil {
+		return fmt.Errorf("error deleting chunks: %w", err)
+	}
+	return nil
+}
+
+// Copy duplicates the rows, embeddings included, under the new data entity ID
+func (p *PGVector) Copy(ctx context.Context, r *types.CopyIndexRequest) error {
+	if len(r.DocumentGroupIDs) == 0 {
+		return nil
+	}
+
+	stmt := fmt.Sprintf(`INSERT INTO %[1]s
+		(data_entity_id, document_id, document_group_id, source, filename, content_offset, content, metadata, embedding)
+		SELECT ?, document_id, document_group_id, source, filename, content_offset, content, metadata, embedding
+		FROM %[1]s
+		WHERE data_entity_id = ? AND document_group_id IN ?`, p.table)
+
+	err := p.db.WithContext(ctx).Exec(stmt, r.ToDataEntityID, r.FromDataEntityID, r.DocumentGroupIDs).Error
+	if err != nil {
+		return fmt.Errorf("error copying chunks: %w", err)
+	}
+	return nil
+}
+
+func (p *PGVector) DeleteDocuments(ctx context.Context, r *types.DeleteDocumentsRequest) error {
+	if r.DataEntityID == "" {
+		return fmt.Errorf("data entity ID cannot be empty")
+	}
+
+	if len(r.DocumentGroupIDs) == 0 {
+		return nil
+	}
+
+	stmt := fmt.Sprintf("DELETE FROM %s WHERE data_entity_id = ? AND document_group_id IN ?", p.table)
+
+	err := p.db.WithContext(ctx).Exec(stmt, r.DataEntityID, r.DocumentGroupIDs).Error
+	if err != nil {
+		return fmt.Errorf("error deleting document chunks: %w", err)
+	}
+	return nil
+}
+
+func (p *PGVector) List(ctx context.Context, r *types.ListIndexRequest) (*types.ListIndexResponse, error) {
+	if r.DataEntityID == "" {
+		return nil, fmt.Errorf("data entity ID cannot be empty")
+	}
+
+	limit := r.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+
+	params := map[string]interface{}{
+		"data_entity_id":    r.DataEntityID,
+		"document_group_id": r.DocumentGroupID,
+		"offset":            max(r.Offset, 0),
+		"limit":             limit,
+	}
+
+	where := "data_entity_id = @data_entity_id"
+	if r.DocumentGroupID != "" {
+		where += " AND document_group_id = @document_group_id"
+	}
+
+	var total int64
+
+	err := p.db.WithContext(ctx).Raw(fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE %s", p.table, where), params).Scan(&total).Error
+	if err != nil {
+		return nil, fmt.Errorf("error counting chunks: %w", err)
+	}
+
+	var rows []struct {
+		DocumentID      string
+		DocumentGroupID string
+		Source          string
+		Filename        string
+		ContentOffset   int
+		Content         string
+		Metadata        string
+	}
+
+	query := fmt.Sprintf(`SELECT document_id, document_group_id, source, filename, content_offset, content, metadata
+		FROM %s
+		WHERE %s
+		ORDER BY document_id, content_offset
+		OFFSET @offset
+		LIMIT @limit`, p.table, where)
+
+	err = p.db.WithContext(ctx).Raw(query, params).Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("error listing chunks: %w", err)
+	}
+
+	resp := &types.ListIndexResponse{
+		Chunks: make([]*types.SessionRAGResult, 0, len(rows)),
+		Total:  int(total),
+	}
+
+	for _, row := range rows {
+		var metadata map[string]string
+		if row.Metadata != "" && row.Metadata != "{}" {
+			if err := json.Unmarshal([]byte(row.Metadata), &metadata); err != nil {
+				return nil, fmt.Errorf("error decoding chunk metadata: %w", err)
+			}
+		}
+
+		resp.Chunks = append(resp.Chunks, &types.SessionRAGResult{
+			DocumentID:      row.DocumentID,
+			DocumentGroupID: row.DocumentGroupID,
+			Source:          row.Source,
+			Filename:        row.Filename,
+			ContentOffset:   row.ContentOffset,
+			Content:         row.Content,
+			Metadata:        metadata,
+		})
+	}
+
+	return resp, nil
+}
+
+// getPGVectorOperator maps the RAG settings distance function to the pgvector
+// operator, inner product operator returns the negative inner product so that
+// lower is better for all of them
+func getPGVectorOperator(distanceFunction string) (string, error) {
+	switch distanceFunction {
+	case "", "cosine":
+		return "<=>", nil
+	case "l2":
+		return "<->", nil
+	case "inner_product":
+		return "<#>", nil
+	default:
+		return "", fmt.Errorf("unknown distance function '%s', use one of cosine, l2 or inner_product", distanceFunction)
+	}
+}
+
+// getPGVectorFilters returns the conditions on the metadata column, the keys and
+// values are passed as named parameters
+func getPGVectorFilters(filters []*types.RAGFilter, params map[string]interface{}) (string, error) {
+	var sb strings.Builder
+
+	for idx, filter := range filters {
+		if err := ValidateFilter(filter); err != nil {
+			return "", err
+		}
+
+		key := fmt.Sprintf("filter_key_%d", idx)
+		value := fmt.Sprintf("filter_value_%d", idx)
+
+		params[key] = filter.Key
+		params[value] = filter.Value
+
+		switch filter.Operator {
+		case types.RAGFilterOperatorEquals:
+			fmt.Fprintf(&sb, " AND metadata->>@%s = @%s", key, value)
+		case types.RAGFilterOperatorNotEquals:
+			fmt.Fprintf(&sb, " AND (metadata->>@%s) IS DISTINCT FROM @%s", key, value)
+		case types.RAGFilterOperatorStartsWith:
+			fmt.Fprintf(&sb, " AND starts_with(metadata->>@%s, @%s)", key, value)
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// formatVector formats the embedding in the pgvector text representation
+func formatVector(embedding []float32) string {
+	var sb strings.Builder
+
+	sb.WriteByte('[')
+	for idx, v := range embedding {
+		if idx > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strconv.FormatFloat(float64(v), 'f', -1, 32))
+	}
+	sb.WriteByte(']')
+
+	return sb.String()
+}
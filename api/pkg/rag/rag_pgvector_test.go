@@ -0,0 +1,236 @@
+package rag
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/kelseyhightower/envconfig"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/mock/gomock"
+
+	"github.com/helixml/helix/api/pkg/config"
+	oai "github.com/helixml/helix/api/pkg/openai"
+	"github.com/helixml/helix/api/pkg/openai/manager"
+	"github.com/helixml/helix/api/pkg/store"
+	"github.com/helixml/helix/api/pkg/system"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+func TestFormatVector(t *testing.T) {
+	require.Equal(t, "[0.5,-1,0.125]", formatVector([]float32{0.5, -1, 0.125}))
+	require.Equal(t, "[]", formatVector(nil))
+}
+
+func TestGetPGVectorOperator(t *testing.T) {
+	for distanceFunction, expected := range map[string]string{
+		"":              "<=>",
+		"cosine":        "<=>",
+		"l2":            "<->",
+		"inner_product": "<#>",
+	} {
+		operator, err := getPGVectorOperator(distanceFunction)
+		require.NoError(t, err)
+		require.Equal(t, expected, operator)
+	}
+
+	_, err := getPGVectorOperator("manhattan")
+	require.Error(t, err)
+}
+
+func TestGetPGVectorFilters(t *testing.T) {
+	params := map[string]interface{}{}
+
+	filters, err := getPGVectorFilters([]*types.RAGFilter{
+		{Key: "extension", Operator: types.RAGFilterOperatorEquals, Value: "pdf"},
+		{Key: "path", Operator: types.RAGFilterOperatorStartsWith, Value: "/docs/"},
+		{Key: "team", Operator: types.RAGFilterOperatorNotEquals, Value: "sales"},
+	}, params)
+	require.NoError(t, err)
+	require.Equal(t, " AND metadata->>@filter_key_0 = @filter_value_0"+
+		" AND starts_with(metadata->>@filter_key_1, @filter_value_1)"+
+		" AND (metadata->>@filter_key_2) IS DISTINCT FROM @filter_value_2", filters)
+	require.Equal(t, "path", params["filter_key_1"])
+	require.Equal(t, "/docs/", params["filter_value_1"])
+
+	_, err = getPGVectorFilters([]*types.RAGFilter{
+		{Key: "bad'key", Operator: types.RAGFilterOperatorEquals},
+	}, params)
+	require.Error(t, err)
+}
+
+type PGVectorTestSuite struct {
+	suite.Suite
+
+	ctx      context.Context
+	pgvector *PGVector
+}
+
+func TestPGVectorTestSuite(t *testing.T) {
+	suite.Run(t, new(PGVectorTestSuite))
+}
+
+func (suite *PGVectorTestSuite) SetupTest() {
+	if os.Getenv("POSTGRES_HOST") == "" {
+		suite.T().Skip("POSTGRES_HOST not set, skipping pgvector tests (requires the pgvector extension)")
+	}
+
+	suite.ctx = context.Background()
+
+	var storeCfg config.Store
+	err := envconfig.Process("", &storeCfg)
+	suite.Require().NoError(err)
+
+	db, err := store.NewPostgresStore(storeCfg)
+	suite.Require().NoError(err)
+
+	ctrl := gomock.NewController(suite.T())
+
+	client := oai.NewMockClient(ctrl)
+	client.EXPECT().CreateEmbeddings(gomock.Any(), gomock.Any()).DoAndReturn(fakeEmbeddings).AnyTimes()
+
+	providerManager := manager.NewMockProviderManager(ctrl)
+	providerManager.EXPECT().GetClient(gomock.Any(), gomock.Any()).Return(client, nil).AnyTimes()
+
+	cfg := &config.ServerConfig{}
+	cfg.RAG.PGVector.Provider = types.ProviderOpenAI
+	cfg.RAG.PGVector.EmbeddingsModel = "fake"
+	cfg.RAG.PGVector.Dimensions = fakeDimensions
+
+	suite.pgvector, err = NewPGVector(cfg, providerManager, db.DB())
+	suite.Require().NoError(err)
+}
+
+const fakeDimensions = 1536
+
+// fakeEmbeddings places the texts along the axes by topic so that the distances are predictable
+func fakeEmbeddings(_ context.Context, req openai.EmbeddingRequest) (openai.EmbeddingResponse, error) {
+	var resp openai.EmbeddingResponse
+
+	for idx, input := range req.Input.([]string) {
+		embedding := make([]float32, fakeDimensions)
+		switch {
+		case strings.Contains(input, "shark"):
+			embedding[0] = 1
+		case strings.Contains(input, "Swift"):
+			embedding[1] = 1
+		default:
+			embedding[2] = 1
+		}
+
+		resp.Data = append(resp.Data, openai.Embedding{
+			Index:     idx,
+			Embedding: embedding,
+		})
+	}
+
+	return resp, nil
+}
+
+func (suite *PGVectorTestSuite) TestIndexQueryDelete() {
+	dataEntityID := system.GenerateDataEntityID()
+
+	err := suite.pgvector.Index(suite.ctx,
+		&types.SessionRAGIndexChunk{
+			DataEntityID:    dataEntityID,
+			Source:          "sharks.txt",
+			DocumentID:      "doc_1",
+			DocumentGroupID: "group_1",
+			Content:         "Tiger sharks are opportunistic predators",
+			Metadata:        map[string]string{"topic": "animals"},
+		},
+		&types.SessionRAGIndexChunk{
+			DataEntityID:    dataEntityID,
+			Source:          "music.txt",
+			DocumentID:      "doc_2",
+			DocumentGroupID: "group_2",
+			Content:         "Taylor Swift released The Tortured Poets Department",
+		},
+	)
+	suite.Require().NoError(err)
+
+	results, err := suite.pgvector.Query(suite.ctx, &types.SessionRAGQuery{
+		Prompt:            "what do sharks eat?",
+		DataEntityID:      dataEntityID,
+		DistanceFunction:  "cosine",
+		DistanceThreshold: 0.4,
+		MaxResults:        3,
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	suite.Equal("sharks.txt", results[0].Source)
+
+	// Keyword matches are returned even when the vectors are far apart
+	results, err = suite.pgvector.Query(suite.ctx, &types.SessionRAGQuery{
+		Prompt:            "tortured poets",
+		DataEntityID:      dataEntityID,
+		DistanceThreshold: 0.4,
+		MaxResults:        3,
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	suite.Equal("music.txt", results[0].Source)
+
+	results, err = suite.pgvector.Query(suite.ctx, &types.SessionRAGQuery{
+		Prompt:       "sharks poets",
+		DataEntityID: dataEntityID,
+		MaxResults:   3,
+		Filters: []*types.RAGFilter{
+			{Key: "topic", Operator: types.RAGFilterOperatorNotEquals, Value: "animals"},
+		},
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	suite.Equal("music.txt", results[0].Source)
+
+	results, err = suite.pgvector.Query(suite.ctx, &types.SessionRAGQuery{
+		Prompt:       "sharks",
+		DataEntityID: dataEntityID,
+		Filters: []*types.RAGFilter{
+			{Key: "topic", Operator: types.RAGFilterOperatorEquals, Value: "animals"},
+		},
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	suite.Equal("animals", results[0].Metadata["topic"])
+
+	err = suite.pgvector.Delete(suite.ctx, &types.DeleteIndexRequest{DataEntityID: dataEntityID})
+	suite.Require().NoError(err)
+
+	results, err = suite.pgvector.Query(suite.ctx, &types.SessionRAGQuery{
+		Prompt:       "what do sharks eat?",
+		DataEntityID: dataEntityID,
+	})
+	suite.Require().NoError(err)
+	suite.Empty(results)
+}
+
+func (suite *PGVectorTestSuite) TestCopy() {
+	from := system.GenerateDataEntityID()
+	to := system.GenerateDataEntityID()
+
+	err := suite.pgvector.Index(suite.ctx,
+		&types.SessionRAGIndexChunk{DataEntityID: from, Source: "a.txt", DocumentGroupID: "group_a", Content: "sharks a"},
+		&types.SessionRAGIndexChunk{DataEntityID: from, Source: "b.txt", DocumentGroupID: "group_b", Content: "sharks b"},
+	)
+	suite.Require().NoError(err)
+
+	err = suite.pgvector.Copy(suite.ctx, &types.CopyIndexRequest{
+		FromDataEntityID: from,
+		ToDataEntityID:   to,
+		DocumentGroupIDs: []string{"group_a"},
+	})
+	suite.Require().NoError(err)
+
+	results, err := suite.pgvector.Query(suite.ctx, &types.SessionRAGQuery{
+		Prompt:       "sharks",
+		DataEntityID: to,
+		MaxResults:   10,
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	suite.Equal("a.txt", results[0].Source)
+}
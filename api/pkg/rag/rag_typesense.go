@@ -3,6 +3,8 @@ package rag
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/helixml/helix/api/pkg/types"
@@ -17,6 +19,9 @@ import (
 const (
 	defaultCollection = "helix-documents"
 	defaultModelName  = "ts/all-MiniLM-L12-v2"
+
+	copyBatchSize = 100 // Document groups per filter
+	copyPageSize  = 250 // Max page size allowed by Typesense
 )
 
 type Typesense struct {
@@ -107,7 +112,7 @@ func (t *Typesense) index(ctx context.Context, indexReqs ...*types.SessionRAGInd
 	}
 
 	if len(indexReqs) == 1 {
-		_, err := t.client.Collection(t.collection).Documents().Create(ctx, indexReqs[0])
+		_, err := t.client.Collection(t.collection).Documents().Create(ctx, newTypesenseDocument(indexReqs[0]))
 		return err
 	}
 
@@ -120,7 +125,7 @@ func (t *Typesense) index(ctx context.Context, indexReqs ...*types.SessionRAGInd
 
 	docs := make([]interface{}, 0, len(indexReqs))
 	for _, indexReq := range indexReqs {
-		docs = append(docs, indexReq)
+		docs = append(docs, newTypesenseDocument(indexReq))
 	}
 
 	_, err := t.client.Collection(t.collection).Documents().Import(ctx, docs, params)
@@ -136,12 +141,17 @@ func (t *Typesense) Query(ctx context.Context, q *types.SessionRAGQuery) ([]*typ
 		return nil, err
 	}
 
+	filterBy, err := getTypesenseFilter(q)
+	if err != nil {
+		return nil, err
+	}
+
 	searchParameters := &api.SearchCollectionParams{
 		Q:       pointer.String(q.Prompt),
 		QueryBy: pointer.String("content,embedding"),
 		// Gives more weight to content matches
 		QueryByWeights: pointer.String("2,1"),
-		FilterBy:       pointer.String("data_entity_id:" + q.DataEntityID),
+		FilterBy:       pointer.String(filterBy),
 		SortBy:         pointer.String("_text_match:desc,_vector_distance:asc"),
 		// Setting this to true will make Typesense consider all variations of prefixes and
 		// typo corrections of the words in the query exhaustively, without stopping early
@@ -175,6 +185,7 @@ func (t *Typesense) Query(ctx context.Context, q *types.SessionRAGQuery) ([]*typ
 			Source:          getStrVariable(&hit, "source"),
 			Content:         getStrVariable(&hit, "content"),
 			ContentOffset:   getIntVariable(&hit, "content_offset"),
+			Metadata:        getMetadataVariable(&hit),
 		}
 		ragResults = append(ragResults, ragResult)
 	}
@@ -194,6 +205,143 @@ func (t *Typesense) Delete(ctx context.Context, r *types.DeleteIndexRequest) err
 	return err
 }
 
+func (t *Typesense) DeleteDocuments(ctx context.Context, r *types.DeleteDocumentsRequest) error {
+	if err := t.ensureReady(ctx); err != nil {
+		return err
+	}
+
+	if len(r.DocumentGroupIDs) == 0 {
+		return nil
+	}
+
+	params := &api.DeleteDocumentsParams{
+		FilterBy: pointer.String(fmt.Sprintf("data_entity_id:=`%s` && document_group_id:=[%s]",
+			r.DataEntityID, strings.Join(r.DocumentGroupIDs, ","))),
+	}
+	_, err := t.client.Collection(t.collection).Documents().Delete(ctx, params)
+	return err
+}
+
+// List pages through the chunks sorted by their offset, document_id isn't a sortable
+// field so the chunks of different documents are interleaved unless filtered by document
+func (t *Typesense) List(ctx context.Context, r *types.ListIndexRequest) (*types.ListIndexResponse, error) {
+	if err := t.ensureReady(ctx); err != nil {
+		return nil, err
+	}
+
+	filter := fmt.Sprintf("data_entity_id:=`%s`", r.DataEntityID)
+	if r.DocumentGroupID != "" {
+		filter += fmt.Sprintf(" && document_group_id:=`%s`", r.DocumentGroupID)
+	}
+
+	limit := r.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+
+	results, err := t.client.Collection(t.collection).Documents().Search(ctx, &api.SearchCollectionParams{
+		Q:             pointer.String("*"),
+		QueryBy:       pointer.String("content"),
+		FilterBy:      pointer.String(filter),
+		SortBy:        pointer.String("content_offset:asc"),
+		Offset:        pointer.Int(max(r.Offset, 0)),
+		Limit:         pointer.Int(limit),
+		ExcludeFields: pointer.String("embedding"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing documents: %w", err)
+	}
+
+	resp := &types.ListIndexResponse{}
+	if results.Found != nil {
+		resp.Total = *results.Found
+	}
+
+	if results.Hits == nil {
+		return resp, nil
+	}
+
+	resp.Chunks = make([]*types.SessionRAGResult, 0, len(*results.Hits))
+	for _, hit := range *results.Hits {
+		resp.Chunks = append(resp.Chunks, &types.SessionRAGResult{
+			DocumentGroupID: getStrVariable(&hit, "document_group_id"),
+			DocumentID:      getStrVariable(&hit, "document_id"),
+			Source:          getStrVariable(&hit, "source"),
+			Content:         getStrVariable(&hit, "content"),
+			ContentOffset:   getIntVariable(&hit, "content_offset"),
+			Metadata:        getMetadataVariable(&hit),
+		})
+	}
+
+	return resp, nil
+}
+
+// Copy searches the chunks of the documents, including their embeddings, and imports
+// them under the new data entity ID. Typesense doesn't re-generate embeddings that
+// are already present in the imported documents.
+func (t *Typesense) Copy(ctx context.Context, r *types.CopyIndexRequest) error {
+	if err := t.ensureReady(ctx); err != nil {
+		return err
+	}
+
+	// Keep the filter expressions reasonably short
+	for start := 0; start < len(r.DocumentGroupIDs); start += copyBatchSize {
+		end := min(start+copyBatchSize, len(r.DocumentGroupIDs))
+
+		filter := fmt.Sprintf("data_entity_id:=`%s` && document_group_id:=[%s]",
+			r.FromDataEntityID, strings.Join(r.DocumentGroupIDs[start:end], ","))
+
+		if err := t.copyFiltered(ctx, filter, r.ToDataEntityID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (t *Typesense) copyFiltered(ctx context.Context, filter, toDataEntityID string) error {
+	for page := 1; ; page++ {
+		results, err := t.client.Collection(t.collection).Documents().Search(ctx, &api.SearchCollectionParams{
+			Q:        pointer.String("*"),
+			QueryBy:  pointer.String("content"),
+			FilterBy: pointer.String(filter),
+			Page:     pointer.Int(page),
+			PerPage:  pointer.Int(copyPageSize),
+		})
+		if err != nil {
+			return fmt.Errorf("error searching documents to copy: %w", err)
+		}
+
+		if results.Hits == nil || len(*results.Hits) == 0 {
+			return nil
+		}
+
+		docs := make([]interface{}, 0, len(*results.Hits))
+		for _, hit := range *results.Hits {
+			doc := *hit.Document
+			delete(doc, "id")
+			doc["data_entity_id"] = toDataEntityID
+			docs = append(docs, doc)
+		}
+
+		imported, err := t.client.Collection(t.collection).Documents().Import(ctx, docs, &api.ImportDocumentsParams{
+			Action:    pointer.String("create"),
+			BatchSize: pointer.Int(len(docs)),
+		})
+		if err != nil {
+			return fmt.Errorf("error importing copied documents: %w", err)
+		}
+
+		if err := checkImportResults(imported); err != nil {
+			return fmt.Errorf("error importing copied documents: %w", err)
+		}
+
+		if len(*results.Hits) < copyPageSize {
+			return nil
+		}
+	}
+}
+
 func getStrVariable(hit *api.SearchResultHit, key string) string {
 	val, ok := (*hit.Document)[key]
 	if !ok {
@@ -208,6 +356,22 @@ func getStrVariable(hit *api.SearchResultHit, key string) string {
 	return str
 }
 
+func getMetadataVariable(hit *api.SearchResultHit) map[string]string {
+	val, ok := (*hit.Document)["metadata"].(map[string]interface{})
+	if !ok || len(val) == 0 {
+		return nil
+	}
+
+	metadata := make(map[string]string, len(val))
+	for k, v := range val {
+		if str, ok := v.(string); ok {
+			metadata[k] = str
+		}
+	}
+
+	return metadata
+}
+
 func getIntVariable(hit *api.SearchResultHit, key string) int {
 	val, ok := (*hit.Document)[key]
 	if !ok {
@@ -229,7 +393,7 @@ func (t *Typesense) ensureCollection(ctx context.Context) error {
 	for _, collection := range collections {
 		if collection.Name == t.collection {
 			log.Info().Str("collection", t.collection).Msg("collection already exists")
-			return nil
+			return t.ensureMetadataField(ctx, collection)
 		}
 	}
 
@@ -262,6 +426,7 @@ func (t *Typesense) ensureCollection(ctx context.Context) error {
 				Name: "content_offset",
 				Type: "int32",
 			},
+			metadataTagsField(),
 			{
 				Name: "embedding",
 				Type: "float[]",
@@ -300,3 +465,101 @@ func (t *Typesense) ensureCollection(ctx context.Context) error {
 
 	return nil
 }
+
+// typesenseDocument adds the metadata as "key=value" tags, Typesense can only
+// filter on the fields declared in the schema. The metadata object itself is
+// stored but not indexed.
+type typesenseDocument struct {
+	*types.SessionRAGIndexChunk
+	MetadataTags []string `json:"metadata_tags,omitempty"`
+}
+
+func newTypesenseDocument(chunk *types.SessionRAGIndexChunk) *typesenseDocument {
+	doc := &typesenseDocument{
+		SessionRAGIndexChunk: chunk,
+	}
+
+	for k, v := range chunk.Metadata {
+		doc.MetadataTags = append(doc.MetadataTags, k+"="+v)
+	}
+	sort.Strings(doc.MetadataTags)
+
+	return doc
+}
+
+func metadataTagsField() api.Field {
+	return api.Field{
+		Name:     "metadata_tags",
+		Type:     "string[]",
+		Optional: pointer.True(),
+	}
+}
+
+// ensureMetadataField adds the metadata tags to the collections created before they existed
+func (t *Typesense) ensureMetadataField(ctx context.Context, collection *api.CollectionResponse) error {
+	for _, field := range collection.Fields {
+		if field.Name == "metadata_tags" {
+			return nil
+		}
+	}
+
+	log.Info().Str("collection", t.collection).Msg("adding metadata tags field to the collection")
+
+	_, err := t.client.Collection(t.collection).Update(ctx, &api.CollectionUpdateSchema{
+		Fields: []api.Field{metadataTagsField()},
+	})
+	return err
+}
+
+// getTypesenseFilter returns the filter_by expression for the data entity and the
+// metadata filters, the tags are compared with backtick escaping
+func getTypesenseFilter(q *types.SessionRAGQuery) (string, error) {
+	conditions := []string{"data_entity_id:" + q.DataEntityID}
+
+	for _, filter := range q.Filters {
+		if err := ValidateFilter(filter); err != nil {
+			return "", err
+		}
+
+		if strings.Contains(filter.Value, "`") {
+			return "", fmt.Errorf("filter value for key '%s' can't contain backticks", filter.Key)
+		}
+
+		tag := filter.Key + "=" + filter.Value
+
+		switch filter.Operator {
+		case types.RAGFilterOperatorEquals:
+			conditions = append(conditions, "metadata_tags:=[`"+tag+"`]")
+		case types.RAGFilterOperatorNotEquals:
+			conditions = append(conditions, "metadata_tags:!=[`"+tag+"`]")
+		case types.RAGFilterOperatorStartsWith:
+			// Prefix filters can't be escaped
+			if strings.ContainsAny(tag, typesenseFilterSpecialChars) {
+				return "", fmt.Errorf("prefix filter value for key '%s' can't contain any of '%s'", filter.Key, typesenseFilterSpecialChars)
+			}
+			conditions = append(conditions, "metadata_tags:"+tag+"*")
+		}
+	}
+
+	return strings.Join(conditions, " && "), nil
+}
+
+const typesenseFilterSpecialChars = " `,:[]()&|*<>!"
+
+// checkImportResults returns an error if any of the documents failed to import,
+// the import itself succeeds even when all documents are rejected
+func checkImportResults(results []*api.ImportDocumentResponse) error {
+	var errs []string
+
+	for _, r := range results {
+		if !r.Success {
+			errs = append(errs, r.Error)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d documents failed: %s", len(errs), len(results), strings.Join(errs, "; "))
+	}
+
+	return nil
+}
@@ -6,11 +6,58 @@ import (
 	"testing"
 	"time"
 
+	"github.com/typesense/typesense-go/v2/typesense/api"
+
 	"github.com/helixml/helix/api/pkg/system"
 	"github.com/helixml/helix/api/pkg/types"
+	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
 
+func TestGetTypesenseFilter(t *testing.T) {
+	filter, err := getTypesenseFilter(&types.SessionRAGQuery{
+		DataEntityID: "entity",
+		Filters: []*types.RAGFilter{
+			{Key: "extension", Operator: types.RAGFilterOperatorEquals, Value: "pdf"},
+			{Key: "team", Operator: types.RAGFilterOperatorNotEquals, Value: "sales, EMEA"},
+			{Key: "path", Operator: types.RAGFilterOperatorStartsWith, Value: "/docs/"},
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "data_entity_id:entity && metadata_tags:=[`extension=pdf`] && "+
+		"metadata_tags:!=[`team=sales, EMEA`] && metadata_tags:path=/docs/*", filter)
+
+	_, err = getTypesenseFilter(&types.SessionRAGQuery{
+		DataEntityID: "entity",
+		Filters: []*types.RAGFilter{
+			{Key: "path", Operator: types.RAGFilterOperatorStartsWith, Value: "/my docs/"},
+		},
+	})
+	require.Error(t, err)
+}
+
+func TestNewTypesenseDocument(t *testing.T) {
+	doc := newTypesenseDocument(&types.SessionRAGIndexChunk{
+		Content:  "hello",
+		Metadata: map[string]string{"path": "/docs/", "extension": "md"},
+	})
+	require.Equal(t, []string{"extension=md", "path=/docs/"}, doc.MetadataTags)
+	require.Equal(t, "hello", doc.Content)
+}
+
+func TestCheckImportResults(t *testing.T) {
+	require.NoError(t, checkImportResults([]*api.ImportDocumentResponse{
+		{Success: true}, {Success: true},
+	}))
+
+	err := checkImportResults([]*api.ImportDocumentResponse{
+		{Success: true},
+		{Success: false, Error: "A document with id 1 already exists."},
+	})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "1 of 2 documents failed: A document with id 1 already exists.")
+}
+
 type TypesenseTestSuite struct {
 	suite.Suite
 	ctx context.Context
@@ -211,3 +258,107 @@ func (suite *TypesenseTestSuite) TestIndexQueryAndDelete() {
 	suite.Require().Len(results, 1, "Expected doc2 to still exist")
 	suite.Equal("3", results[0].DocumentID)
 }
+
+func (suite *TypesenseTestSuite) TestCopy() {
+	sampleDocs := []types.SessionRAGIndexChunk{
+		{
+			DataEntityID:    "v1",
+			DocumentGroupID: "unchanged",
+			DocumentID:      "1",
+			Source:          "test",
+			Content:         "This is a sample document about AI.",
+			ContentOffset:   0,
+		},
+		{
+			DataEntityID:    "v1",
+			DocumentGroupID: "changed",
+			DocumentID:      "2",
+			Source:          "test",
+			Content:         "Machine learning is a subset of AI.",
+			ContentOffset:   0,
+		},
+	}
+
+	for _, doc := range sampleDocs {
+		err := suite.ts.Index(suite.ctx, &doc)
+		suite.Require().NoError(err)
+	}
+
+	// Wait for indexing to complete
+	time.Sleep(2 * time.Second)
+
+	err := suite.ts.Copy(suite.ctx, &types.CopyIndexRequest{
+		FromDataEntityID: "v1",
+		ToDataEntityID:   "v2",
+		DocumentGroupIDs: []string{"unchanged"},
+	})
+	suite.Require().NoError(err)
+
+	time.Sleep(2 * time.Second)
+
+	results, err := suite.ts.Query(suite.ctx, &types.SessionRAGQuery{
+		DataEntityID: "v2",
+		Prompt:       "AI",
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	suite.Equal("1", results[0].DocumentID)
+
+	// Source entity is left untouched
+	results, err = suite.ts.Query(suite.ctx, &types.SessionRAGQuery{
+		DataEntityID: "v1",
+		Prompt:       "AI",
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 2)
+}
+
+func (suite *TypesenseTestSuite) TestQueryFilters() {
+	dataEntityID := "filters-" + system.GenerateID()
+
+	err := suite.ts.Index(suite.ctx,
+		&types.SessionRAGIndexChunk{
+			DataEntityID:    dataEntityID,
+			DocumentGroupID: "1",
+			DocumentID:      "1",
+			Source:          "https://example.com/docs/ai.html",
+			Content:         "This is a sample document about AI.",
+			Metadata:        map[string]string{"path": "/docs/ai.html", "extension": "html"},
+		},
+		&types.SessionRAGIndexChunk{
+			DataEntityID:    dataEntityID,
+			DocumentGroupID: "2",
+			DocumentID:      "2",
+			Source:          "https://example.com/blog/ml.pdf",
+			Content:         "Machine learning is a subset of AI.",
+			Metadata:        map[string]string{"path": "/blog/ml.pdf", "extension": "pdf"},
+		},
+	)
+	suite.Require().NoError(err)
+
+	// Wait for indexing to complete
+	time.Sleep(2 * time.Second)
+
+	results, err := suite.ts.Query(suite.ctx, &types.SessionRAGQuery{
+		DataEntityID: dataEntityID,
+		Prompt:       "AI",
+		Filters: []*types.RAGFilter{
+			{Key: "extension", Operator: types.RAGFilterOperatorEquals, Value: "pdf"},
+		},
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	suite.Equal("2", results[0].DocumentID)
+	suite.Equal("/blog/ml.pdf", results[0].Metadata["path"])
+
+	results, err = suite.ts.Query(suite.ctx, &types.SessionRAGQuery{
+		DataEntityID: dataEntityID,
+		Prompt:       "AI",
+		Filters: []*types.RAGFilter{
+			{Key: "path", Operator: types.RAGFilterOperatorStartsWith, Value: "/docs/"},
+		},
+	})
+	suite.Require().NoError(err)
+	suite.Require().Len(results, 1)
+	suite.Equal("1", results[0].DocumentID)
+}
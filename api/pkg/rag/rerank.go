@@ -0,0 +1,278 @@
+package rag
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/helixml/helix/api/pkg/openai/manager"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+const (
+	// Minimum number of candidates retrieved for reranking when not configured
+	DefaultRerankMinCandidates = 20
+
+	// Passages are truncated before they are sent to the reranker to keep
+	// the prompt within the context window of the model, in bytes
+	rerankMaxPassageLength = 2000
+
+	rerankEndpointTimeout = 30 * time.Second
+)
+
+// Reranker rescores the retrieved chunks against the query, the results are
+// returned sorted by the rerank score, best first
+type Reranker interface {
+	Rerank(ctx context.Context, query string, results []*types.SessionRAGResult) ([]*types.SessionRAGResult, error)
+}
+
+// NewReranker returns the dedicated rerank endpoint client if the URL is set,
+// otherwise the model is used as an LLM reranker through the provider manager
+func NewReranker(providerManager manager.ProviderManager, settings *types.RAGRerankSettings) (Reranker, error) {
+	if settings.URL != "" {
+		return &endpointReranker{
+			url:        settings.URL,
+			apiKey:     settings.APIKey,
+			model:      settings.Model,
+			httpClient: &http.Client{Timeout: rerankEndpointTimeout},
+		}, nil
+	}
+
+	if settings.Model == "" {
+		return nil, fmt.Errorf("rerank model is required")
+	}
+
+	return &llmReranker{
+		providerManager: providerManager,
+		provider:        settings.Provider,
+		model:           settings.Model,
+	}, nil
+}
+
+// GetRerankCandidatesCount returns how many chunks to retrieve before reranking
+// them down to the results count
+func GetRerankCandidatesCount(settings *types.RAGSettings) int {
+	if settings.Rerank.CandidatesCount > 0 {
+		return settings.Rerank.CandidatesCount
+	}
+
+	resultsCount := settings.ResultsCount
+	if resultsCount == 0 {
+		resultsCount = DefaultMaxResults
+	}
+
+	return max(resultsCount*4, DefaultRerankMinCandidates)
+}
+
+// endpointReranker calls a Cohere/Jina compatible rerank API, also
+// implemented by the text-embeddings-inference and vLLM servers
+type endpointReranker struct {
+	url        string
+	apiKey     string
+	model      string
+	httpClient *http.Client
+}
+
+type rerankRequest struct {
+	Model     string   `json:"model,omitempty"`
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	TopN      int      `json:"top_n"`
+}
+
+type rerankResponse struct {
+	Results []struct {
+		Index          int     `json:"index"`
+		RelevanceScore float64 `json:"relevance_score"`
+	} `json:"results"`
+}
+
+func (r *endpointReranker) Rerank(ctx context.Context, query string, results []*types.SessionRAGResult) ([]*types.SessionRAGResult, error) {
+	if len(results) == 0 {
+		return results, nil
+	}
+
+	documents := make([]string, 0, len(results))
+	for _, result := range results {
+		documents = append(documents, truncatePassage(result.Content))
+	}
+
+	bts, err := json.Marshal(&rerankRequest{
+		Model:     r.model,
+		Query:     query,
+		Documents: documents,
+		TopN:      len(documents),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(bts))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	}
+
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error making request to the rerank endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("error response from the rerank endpoint: %s (%s)", resp.Status, string(body))
+	}
+
+	var rerankResp rerankResponse
+	err = json.Unmarshal(body, &rerankResp)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing rerank response: %w", err)
+	}
+
+	scores := make([]float64, len(results))
+	for _, result := range rerankResp.Results {
+		if result.Index < 0 || result.Index >= len(results) {
+			return nil, fmt.Errorf("rerank endpoint returned an unknown document index %d", result.Index)
+		}
+		scores[result.Index] = result.RelevanceScore
+	}
+
+	return applyRerankScores(results, scores), nil
+}
+
+// llmReranker asks a chat model to grade the relevance of the passages
+// in a single request
+type llmReranker struct {
+	providerManager manager.ProviderManager
+	provider        types.Provider
+	model           string
+}
+
+const llmRerankSystemPrompt = `You are a search relevance grader. You will be given a query and a numbered list of passages.
+Grade how well each passage answers the query on a scale from 0 (irrelevant) to 10 (fully answers the query).
+Respond only with a JSON object in the form {"scores": [<score of passage 0>, <score of passage 1>, ...]} with exactly one score per passage, in the same order.`
+
+func (r *llmReranker) Rerank(ctx context.Context, query string, results []*types.SessionRAGResult) ([]*types.SessionRAGResult, error) {
+	if len(results) == 0 {
+		return results, nil
+	}
+
+	client, err := r.providerManager.GetClient(ctx, &manager.GetClientRequest{
+		Provider: r.provider,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rerank client: %w", err)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Query: %s\n\nPassages:\n", query)
+	for idx, result := range results {
+		fmt.Fprintf(&sb, "\n[%d]\n%s\n", idx, truncatePassage(result.Content))
+	}
+
+	resp, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: r.model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: llmRerankSystemPrompt,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: sb.String(),
+			},
+		},
+		Temperature: 0,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rerank scores: %w", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no response from the rerank model")
+	}
+
+	scores, err := parseLLMRerankScores(resp.Choices[0].Message.Content, len(results))
+	if err != nil {
+		return nil, err
+	}
+
+	return applyRerankScores(results, scores), nil
+}
+
+// truncatePassage cuts the passage to the max length without splitting a
+// multi-byte character
+func truncatePassage(content string) string {
+	if len(content) <= rerankMaxPassageLength {
+		return content
+	}
+
+	cut := rerankMaxPassageLength
+	for cut > 0 && !utf8.RuneStart(content[cut]) {
+		cut--
+	}
+
+	return content[:cut]
+}
+
+// parseLLMRerankScores reads the scores from the model answer, ignoring any text or
+// markdown fences around the JSON object. Scores are normalized to 0-1.
+func parseLLMRerankScores(answer string, count int) ([]float64, error) {
+	start := strings.Index(answer, "{")
+	end := strings.LastIndex(answer, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("rerank model didn't return a JSON object: %s", answer)
+	}
+
+	var parsed struct {
+		Scores []float64 `json:"scores"`
+	}
+	err := json.Unmarshal([]byte(answer[start:end+1]), &parsed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rerank scores: %w", err)
+	}
+
+	if len(parsed.Scores) != count {
+		return nil, fmt.Errorf("rerank model returned %d scores, expected %d", len(parsed.Scores), count)
+	}
+
+	for idx, score := range parsed.Scores {
+		parsed.Scores[idx] = min(max(score, 0), 10) / 10
+	}
+
+	return parsed.Scores, nil
+}
+
+// applyRerankScores records the scores on the results and sorts them, the
+// retrieval order is kept for equal scores
+func applyRerankScores(results []*types.SessionRAGResult, scores []float64) []*types.SessionRAGResult {
+	reranked := make([]*types.SessionRAGResult, len(results))
+	copy(reranked, results)
+
+	for idx, result := range reranked {
+		result.RerankScore = scores[idx]
+	}
+
+	sort.SliceStable(reranked, func(i, j int) bool {
+		return reranked[i].RerankScore > reranked[j].RerankScore
+	})
+
+	return reranked
+}
@@ -0,0 +1,78 @@
+package rag
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+func TestParseLLMRerankScores(t *testing.T) {
+	scores, err := parseLLMRerankScores("```json\n{\"scores\": [10, 0, 12, 4.5]}\n```", 4)
+	require.NoError(t, err)
+	require.Equal(t, []float64{1, 0, 1, 0.45}, scores)
+
+	_, err = parseLLMRerankScores(`{"scores": [1, 2]}`, 3)
+	require.Error(t, err)
+
+	_, err = parseLLMRerankScores("no idea", 1)
+	require.Error(t, err)
+}
+
+func TestEndpointReranker(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+		var req rerankRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		require.Equal(t, "rerank-english", req.Model)
+		require.Equal(t, "sharks", req.Query)
+		require.Equal(t, []string{"music", "sharks"}, req.Documents)
+
+		_, _ = w.Write([]byte(`{"results": [{"index": 1, "relevance_score": 0.98}, {"index": 0, "relevance_score": 0.01}]}`))
+	}))
+	defer ts.Close()
+
+	reranker, err := NewReranker(nil, &types.RAGRerankSettings{
+		URL:    ts.URL,
+		APIKey: "secret",
+		Model:  "rerank-english",
+	})
+	require.NoError(t, err)
+
+	results, err := reranker.Rerank(context.Background(), "sharks", []*types.SessionRAGResult{
+		{DocumentID: "doc_1", Content: "music"},
+		{DocumentID: "doc_2", Content: "sharks"},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "doc_2", results[0].DocumentID)
+	require.Equal(t, 0.98, results[0].RerankScore)
+	require.Equal(t, "doc_1", results[1].DocumentID)
+}
+
+func TestTruncatePassage(t *testing.T) {
+	require.Equal(t, "sharks", truncatePassage("sharks"))
+
+	// The multi-byte character crossing the limit is dropped, not split
+	passage := strings.Repeat("a", rerankMaxPassageLength-1) + "żółw"
+	truncated := truncatePassage(passage)
+	require.True(t, utf8.ValidString(truncated))
+	require.Equal(t, strings.Repeat("a", rerankMaxPassageLength-1), truncated)
+}
+
+func TestGetRerankCandidatesCount(t *testing.T) {
+	require.Equal(t, DefaultRerankMinCandidates, GetRerankCandidatesCount(&types.RAGSettings{}))
+	require.Equal(t, 40, GetRerankCandidatesCount(&types.RAGSettings{ResultsCount: 10}))
+
+	settings := &types.RAGSettings{ResultsCount: 10}
+	settings.Rerank.CandidatesCount = 15
+	require.Equal(t, 15, GetRerankCandidatesCount(settings))
+}
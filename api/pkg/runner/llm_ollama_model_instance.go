@@ -619,6 +619,34 @@ func (i *OllamaInferenceModelInstance) processInteraction(inferenceReq *types.Ru
 	defer cancel()
 
 	switch {
+	case inferenceReq.EmbeddingRequest != nil:
+		start := time.Now()
+		resp, err := i.client.Embed(timeoutCtx, &api.EmbedRequest{
+			Model: inferenceReq.Request.Model,
+			Input: inferenceReq.EmbeddingRequest.Input,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get embeddings from inference API: %w", err)
+		}
+
+		embeddingResp := &openai.EmbeddingResponse{
+			Object: "list",
+			Model:  openai.EmbeddingModel(resp.Model),
+			Usage: openai.Usage{
+				PromptTokens: resp.PromptEvalCount,
+				TotalTokens:  resp.PromptEvalCount,
+			},
+		}
+		for idx, embedding := range resp.Embeddings {
+			embeddingResp.Data = append(embeddingResp.Data, openai.Embedding{
+				Object:    "embedding",
+				Embedding: embedding,
+				Index:     idx,
+			})
+		}
+
+		i.embeddingResponseProcessor(inferenceReq, embeddingResp, time.Since(start).Milliseconds())
+		return nil
 	case inferenceReq.Request.Stream:
 		start := time.Now()
 		err := i.client.Chat(timeoutCtx, &req, func(resp api.ChatResponse) error {
@@ -766,6 +794,24 @@ func (i *OllamaInferenceModelInstance) responseProcessor(req *types.RunnerLLMInf
 	}
 }
 
+func (i *OllamaInferenceModelInstance) embeddingResponseProcessor(req *types.RunnerLLMInferenceRequest, resp *openai.EmbeddingResponse, durationMs int64) {
+	inferenceResp := &types.RunnerLLMInferenceResponse{
+		RequestID:         req.RequestID,
+		OwnerID:           req.OwnerID,
+		SessionID:         req.SessionID,
+		InteractionID:     req.InteractionID,
+		EmbeddingResponse: resp,
+		DurationMs:        durationMs,
+		Done:              true,
+	}
+
+	err := i.responseHandler(inferenceResp)
+	if err != nil {
+		log.Error().Msgf("error writing event: %s", err.Error())
+		return
+	}
+}
+
 func (i *OllamaInferenceModelInstance) Done() <-chan bool {
 	return i.finishCh
 }
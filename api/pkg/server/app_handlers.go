@@ -72,6 +72,7 @@ func (s *HelixAPIServer) listApps(_ http.ResponseWriter, r *http.Request) ([]*ty
 				app.Config.Github.WebhookSecret = ""
 			}
 		}
+		redactAppSecrets(app)
 
 		filteredApps = append(filteredApps, app)
 	}
@@ -152,6 +153,13 @@ func (s *HelixAPIServer) createApp(_ http.ResponseWriter, r *http.Request) (*typ
 				}
 			}
 
+			for _, mcp := range assistant.MCP {
+				err = tools.ValidateTool(store.ConvertMCPToTool(mcp), s.Controller.ToolsPlanner, true)
+				if err != nil {
+					return nil, system.NewHTTPError400(err.Error())
+				}
+			}
+
 			for _, k := range assistant.Knowledge {
 				err = s.validateKnowledge(k)
 				if err != nil {
@@ -227,6 +235,8 @@ func (s *HelixAPIServer) createApp(_ http.ResponseWriter, r *http.Request) (*typ
 		return nil, system.NewHTTPError500(err.Error())
 	}
 
+	redactAppSecrets(created)
+
 	return created, nil
 }
 
@@ -253,6 +263,33 @@ func (s *HelixAPIServer) validateTriggers(triggers []types.Trigger) error {
 	return nil
 }
 
+// redactAppSecrets clears the inline secrets of the knowledge sources
+// before the app is returned by the API
+func redactAppSecrets(app *types.App) {
+	for _, assistant := range app.Config.Helix.Assistants {
+		for _, k := range assistant.Knowledge {
+			k.Source.RedactSecrets()
+		}
+	}
+}
+
+// restoreAppSecrets sets the redacted secrets back from the stored app,
+// knowledge is matched by name
+func restoreAppSecrets(update, existing *types.App) {
+	stored := make(map[string]*types.KnowledgeSource)
+	for _, assistant := range existing.Config.Helix.Assistants {
+		for _, k := range assistant.Knowledge {
+			stored[k.Name] = &k.Source
+		}
+	}
+
+	for _, assistant := range update.Config.Helix.Assistants {
+		for _, k := range assistant.Knowledge {
+			k.Source.RestoreSecrets(stored[k.Name])
+		}
+	}
+}
+
 // ensureKnowledge creates or updates knowledge config in the database
 func (s *HelixAPIServer) ensureKnowledge(ctx context.Context, app *types.App) error {
 	var knowledge []*types.AssistantKnowledge
@@ -285,6 +322,7 @@ func (s *HelixAPIServer) ensureKnowledge(ctx context.Context, app *types.App) er
 					Source:          k.Source,
 					RefreshEnabled:  k.RefreshEnabled,
 					RefreshSchedule: k.RefreshSchedule,
+					EvalSet:         k.EvalSet,
 				})
 				if err != nil {
 					return fmt.Errorf("failed to create knowledge '%s': %w", k.Name, err)
@@ -302,6 +340,7 @@ func (s *HelixAPIServer) ensureKnowledge(ctx context.Context, app *types.App) er
 		existing.Source = k.Source
 		existing.RefreshEnabled = k.RefreshEnabled
 		existing.RefreshSchedule = k.RefreshSchedule
+		existing.EvalSet = k.EvalSet
 
 		_, err = s.Store.UpdateKnowledge(ctx, existing)
 		if err != nil {
@@ -369,6 +408,9 @@ func (s *HelixAPIServer) getApp(_ http.ResponseWriter, r *http.Request) (*types.
 	if (!app.Global && !app.Shared) && app.Owner != user.ID {
 		return nil, system.NewHTTPError404(store.ErrNotFound.Error())
 	}
+
+	redactAppSecrets(app)
+
 	return app, nil
 }
 
@@ -432,6 +474,13 @@ func (s *HelixAPIServer) updateApp(_ http.ResponseWriter, r *http.Request) (*typ
 			}
 		}
 
+		for _, mcp := range assistant.MCP {
+			err = tools.ValidateTool(store.ConvertMCPToTool(mcp), s.Controller.ToolsPlanner, true)
+			if err != nil {
+				return nil, system.NewHTTPError400(err.Error())
+			}
+		}
+
 		for _, k := range assistant.Knowledge {
 			err = s.validateKnowledge(k)
 			if err != nil {
@@ -440,6 +489,9 @@ func (s *HelixAPIServer) updateApp(_ http.ResponseWriter, r *http.Request) (*typ
 		}
 	}
 
+	// The deploy keys are not returned to the clients, keep the stored ones
+	restoreAppSecrets(&update, existing)
+
 	// Updating the app
 	updated, err := s.Store.UpdateApp(r.Context(), &update)
 	if err != nil {
@@ -451,6 +503,8 @@ func (s *HelixAPIServer) updateApp(_ http.ResponseWriter, r *http.Request) (*typ
 		return nil, system.NewHTTPError500(err.Error())
 	}
 
+	redactAppSecrets(updated)
+
 	return updated, nil
 }
 
@@ -546,6 +600,8 @@ func (s *HelixAPIServer) updateGithubApp(_ http.ResponseWriter, r *http.Request)
 		return nil, system.NewHTTPError500(err.Error())
 	}
 
+	redactAppSecrets(updated)
+
 	return updated, nil
 }
 
@@ -604,6 +660,8 @@ func (s *HelixAPIServer) deleteApp(_ http.ResponseWriter, r *http.Request) (*typ
 		return nil, system.NewHTTPError500(err.Error())
 	}
 
+	redactAppSecrets(existing)
+
 	return existing, nil
 }
 
@@ -16,9 +16,10 @@ import (
 
 var (
 	// Allowed paths for app API keys. Currently we support
-	// only OpenAI compatible chat completions API
+	// only OpenAI compatible chat completions and embeddings API
 	AppAPIKeyPaths = map[string]bool{
 		"/v1/chat/completions":  true,
+		"/v1/embeddings":        true,
 		"/api/v1/sessions/chat": true,
 	}
 )
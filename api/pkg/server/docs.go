@@ -519,12 +519,14 @@ const docTemplate = `{
             "enum": [
                 "api",
                 "gptscript",
-                "zapier"
+                "zapier",
+                "mcp"
             ],
             "x-enum-varnames": [
                 "ToolTypeAPI",
                 "ToolTypeGPTScript",
-                "ToolTypeZapier"
+                "ToolTypeZapier",
+                "ToolTypeMCP"
             ]
         },
         "github_com_helixml_helix_api_pkg_types.Usage": {
@@ -1175,9 +1177,28 @@ const docTemplate = `{
                 }
             }
         },
+        "types.AssistantAgent": {
+            "type": "object",
+            "properties": {
+                "enabled": {
+                    "type": "boolean"
+                },
+                "max_iterations": {
+                    "description": "MaxIterations is the maximum number of planning steps per answer, defaults to 5",
+                    "type": "integer"
+                },
+                "token_budget": {
+                    "description": "TokenBudget is the maximum number of tokens used by the LLM calls of the planner\nand the tools, the assistant then answers with the results so far. Defaults to 32000",
+                    "type": "integer"
+                }
+            }
+        },
         "types.AssistantConfig": {
             "type": "object",
             "properties": {
+                "agent": {
+                    "$ref": "#/definitions/types.AssistantAgent"
+                },
                 "apis": {
                     "description": "the list of api tools this assistant will use",
                     "type": "array",
@@ -1219,6 +1240,17 @@ const docTemplate = `{
                     "description": "the data entity ID that we have created for the lora fine tune",
                     "type": "string"
                 },
+                "max_parallel_tool_calls": {
+                    "description": "MaxParallelToolCalls limits the tool calls of a turn that run at the same time, defaults to 4",
+                    "type": "integer"
+                },
+                "mcp": {
+                    "description": "the list of MCP servers this assistant will use",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.AssistantMCP"
+                    }
+                },
                 "model": {
                     "type": "string"
                 },
@@ -1240,6 +1272,14 @@ const docTemplate = `{
                 "system_prompt": {
                     "type": "string"
                 },
+                "tool_calling": {
+                    "description": "ToolCalling is how the tools are chosen, 'prompt' (default) or 'native'",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/types.ToolCallingMode"
+                        }
+                    ]
+                },
                 "tools": {
                     "description": "these are populated from the APIs and GPTScripts on create and update\nwe include tools in the JSON that we send to the browser\nbut we don't include it in the yaml which feeds this struct because\nwe populate the tools array from the APIs and GPTScripts arrays\nso - Tools is readonly - hence only JSON for the frontend to see",
                     "type": "array",
@@ -1288,6 +1328,13 @@ const docTemplate = `{
                     "description": "Description of the knowledge, will be used in the prompt\nto explain the knowledge to the assistant",
                     "type": "string"
                 },
+                "eval_set": {
+                    "description": "EvalSet is the golden set of questions used to measure the retrieval\nquality of the knowledge, see 'helix knowledge eval'",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.KnowledgeEvalCase"
+                    }
+                },
                 "name": {
                     "description": "Name of the knowledge, will be unique within the Helix app",
                     "type": "string"
@@ -1318,6 +1365,47 @@ const docTemplate = `{
                 }
             }
         },
+        "types.AssistantMCP": {
+            "type": "object",
+            "properties": {
+                "args": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "command": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "env": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "headers": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "model": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "transport": {
+                    "$ref": "#/definitions/types.MCPTransport"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
         "types.AssistantZapier": {
             "type": "object",
             "properties": {
@@ -1358,6 +1446,29 @@ const docTemplate = `{
                 }
             }
         },
+        "types.Citation": {
+            "type": "object",
+            "properties": {
+                "content_offset": {
+                    "description": "index of the chunk in the document",
+                    "type": "integer"
+                },
+                "document_id": {
+                    "type": "string"
+                },
+                "page": {
+                    "description": "set for the paginated documents such as PDFs",
+                    "type": "integer"
+                },
+                "section": {
+                    "type": "string"
+                },
+                "source": {
+                    "description": "URL or the file the chunk comes from",
+                    "type": "string"
+                }
+            }
+        },
         "types.CreatorType": {
             "type": "string",
             "enum": [
@@ -1448,6 +1559,13 @@ const docTemplate = `{
         "types.Interaction": {
             "type": "object",
             "properties": {
+                "citations": {
+                    "description": "knowledge chunks the response refers to",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.Citation"
+                    }
+                },
                 "completed": {
                     "type": "string"
                 },
@@ -1633,10 +1751,10 @@ const docTemplate = `{
         "types.KeyPair": {
             "type": "object",
             "properties": {
-                "privateKey": {
+                "private_key": {
                     "type": "string"
                 },
-                "publicKey": {
+                "public_key": {
                     "type": "string"
                 },
                 "type": {
@@ -1644,6 +1762,21 @@ const docTemplate = `{
                 }
             }
         },
+        "types.KnowledgeEvalCase": {
+            "type": "object",
+            "properties": {
+                "expected_sources": {
+                    "description": "ExpectedSources are the URLs or the file paths of the relevant documents, a\nretrieved document matches if its source ends with the expected path segments",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "question": {
+                    "type": "string"
+                }
+            }
+        },
         "types.KnowledgeSource": {
             "type": "object",
             "properties": {
@@ -1784,6 +1917,9 @@ const docTemplate = `{
                 "step": {
                     "$ref": "#/definitions/types.LLMCallStep"
                 },
+                "tool_call_id": {
+                    "type": "string"
+                },
                 "totalTokens": {
                     "type": "integer"
                 },
@@ -1800,6 +1936,7 @@ const docTemplate = `{
             "enum": [
                 "default",
                 "is_actionable",
+                "select_tools",
                 "prepare_api_request",
                 "interpret_response",
                 "generate_title"
@@ -1807,11 +1944,25 @@ const docTemplate = `{
             "x-enum-varnames": [
                 "LLMCallStepDefault",
                 "LLMCallStepIsActionable",
+                "LLMCallStepSelectTools",
                 "LLMCallStepPrepareAPIRequest",
                 "LLMCallStepInterpretResponse",
                 "LLMCallStepGenerateTitle"
             ]
         },
+        "types.MCPTransport": {
+            "type": "string",
+            "enum": [
+                "stdio",
+                "sse",
+                "streamable_http"
+            ],
+            "x-enum-varnames": [
+                "MCPTransportStdio",
+                "MCPTransportSSE",
+                "MCPTransportStreamableHTTP"
+            ]
+        },
         "types.Message": {
             "type": "object",
             "properties": {
@@ -2517,11 +2668,22 @@ const docTemplate = `{
             "type": "string",
             "enum": [
                 "markdown",
-                "text"
+                "text",
+                "semantic",
+                "code",
+                "table"
             ],
+            "x-enum-comments": {
+                "TextSplitterTypeCode": "splits the source files by functions and classes, markdown for the rest",
+                "TextSplitterTypeSemantic": "splits where the embeddings of the sentences change the most",
+                "TextSplitterTypeTable": "keeps the table rows together with their header row"
+            },
             "x-enum-varnames": [
                 "TextSplitterTypeMarkdown",
-                "TextSplitterTypeText"
+                "TextSplitterTypeText",
+                "TextSplitterTypeSemantic",
+                "TextSplitterTypeCode",
+                "TextSplitterTypeTable"
             ]
         },
         "types.ToolApiAction": {
@@ -2589,6 +2751,17 @@ const docTemplate = `{
                 }
             }
         },
+        "types.ToolCallingMode": {
+            "type": "string",
+            "enum": [
+                "prompt",
+                "native"
+            ],
+            "x-enum-varnames": [
+                "ToolCallingPrompt",
+                "ToolCallingNative"
+            ]
+        },
         "types.ToolConfig": {
             "type": "object",
             "properties": {
@@ -2598,6 +2771,9 @@ const docTemplate = `{
                 "gptscript": {
                     "$ref": "#/definitions/types.ToolGPTScriptConfig"
                 },
+                "mcp": {
+                    "$ref": "#/definitions/types.ToolMCPConfig"
+                },
                 "zapier": {
                     "$ref": "#/definitions/types.ToolZapierConfig"
                 }
@@ -2616,6 +2792,71 @@ const docTemplate = `{
                 }
             }
         },
+        "types.ToolMCPAction": {
+            "type": "object",
+            "properties": {
+                "description": {
+                    "type": "string"
+                },
+                "input_schema": {
+                    "description": "JSON schema of the arguments",
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "types.ToolMCPConfig": {
+            "type": "object",
+            "properties": {
+                "args": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "command": {
+                    "type": "string"
+                },
+                "env": {
+                    "description": "Environment of the command (credentials, etc)",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "headers": {
+                    "description": "Headers (authentication, etc)",
+                    "type": "object",
+                    "additionalProperties": {
+                        "type": "string"
+                    }
+                },
+                "model": {
+                    "type": "string"
+                },
+                "tools": {
+                    "description": "Read-only, listed from the server when the tool is used",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/types.ToolMCPAction"
+                    }
+                },
+                "transport": {
+                    "description": "Transport defaults to stdio when the command is set, otherwise to streamable_http",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/types.MCPTransport"
+                        }
+                    ]
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
         "types.ToolZapierConfig": {
             "type": "object",
             "properties": {
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/helixml/helix/api/pkg/controller/knowledge"
+	"github.com/helixml/helix/api/pkg/rag"
+	"github.com/helixml/helix/api/pkg/store"
+	"github.com/helixml/helix/api/pkg/system"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+func (s *HelixAPIServer) listKnowledgeDocuments(_ http.ResponseWriter, r *http.Request) ([]*types.KnowledgeDocument, *system.HTTPError) {
+	k, httpErr := s.getOwnedKnowledge(r, "view")
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	sources, httpErr := s.getKnowledgeVersionSources(r, k)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	return knowledge.GetDocuments(k, sources), nil
+}
+
+func (s *HelixAPIServer) listKnowledgeDocumentChunks(_ http.ResponseWriter, r *http.Request) (*types.ListIndexResponse, *system.HTTPError) {
+	k, httpErr := s.getOwnedKnowledge(r, "view")
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	version := r.URL.Query().Get("version")
+	if version == "" {
+		version = k.Version
+	}
+
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil {
+		offset = 0 // Default value if offset is not provided or conversion fails
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil {
+		limit = 0 // Default value if limit is not provided or conversion fails
+	}
+
+	ragClient, err := s.Controller.GetRagClient(r.Context(), k)
+	if err != nil {
+		return nil, system.NewHTTPError500(err.Error())
+	}
+
+	resp, err := ragClient.List(r.Context(), &types.ListIndexRequest{
+		DataEntityID:    types.GetDataEntityID(k.ID, version),
+		DocumentGroupID: mux.Vars(r)["document_id"],
+		Offset:          offset,
+		Limit:           limit,
+	})
+	if err != nil {
+		if errors.Is(err, rag.ErrNotSupported) {
+			return nil, system.NewHTTPError400("listing the chunks is not supported by the RAG server of this knowledge")
+		}
+		return nil, system.NewHTTPError500(err.Error())
+	}
+
+	return resp, nil
+}
+
+// deleteKnowledgeDocument removes the document from the current version, with
+// exclude=true the document is also skipped by the following refreshes
+func (s *HelixAPIServer) deleteKnowledgeDocument(_ http.ResponseWriter, r *http.Request) (*types.KnowledgeDocument, *system.HTTPError) {
+	k, httpErr := s.getIdleKnowledge(r, "delete documents of")
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	documentID := mux.Vars(r)["document_id"]
+	exclude := r.URL.Query().Get("exclude") == "true"
+
+	err := s.knowledgeManager.DeleteDocument(r.Context(), k, documentID, exclude)
+	if err != nil {
+		return nil, getKnowledgeDocumentError(err)
+	}
+
+	return getKnowledgeDocument(k, documentID), nil
+}
+
+// reindexKnowledgeDocument fetches the document from the knowledge source again, the knowledge
+// is in the indexing state until its chunks are replaced
+func (s *HelixAPIServer) reindexKnowledgeDocument(_ http.ResponseWriter, r *http.Request) (*types.KnowledgeDocument, *system.HTTPError) {
+	k, httpErr := s.getIdleKnowledge(r, "re-index documents of")
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	documentID := mux.Vars(r)["document_id"]
+
+	err := s.knowledgeManager.ReindexDocument(r.Context(), k, documentID)
+	if err != nil {
+		return nil, getKnowledgeDocumentError(err)
+	}
+
+	return getKnowledgeDocument(k, documentID), nil
+}
+
+func (s *HelixAPIServer) getOwnedKnowledge(r *http.Request, action string) (*types.Knowledge, *system.HTTPError) {
+	user := getRequestUser(r)
+
+	existing, err := s.Store.GetKnowledge(r.Context(), getID(r))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, system.NewHTTPError404(store.ErrNotFound.Error())
+		}
+		return nil, system.NewHTTPError500(err.Error())
+	}
+
+	if existing.Owner != user.ID {
+		return nil, system.NewHTTPError403("you do not have permission to " + action + " this knowledge")
+	}
+
+	return existing, nil
+}
+
+// getIdleKnowledge returns the knowledge if it's not being indexed, the documents
+// can't be changed while the indexer is writing the new version
+func (s *HelixAPIServer) getIdleKnowledge(r *http.Request, action string) (*types.Knowledge, *system.HTTPError) {
+	k, httpErr := s.getOwnedKnowledge(r, action)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	switch k.State {
+	case types.KnowledgeStateIndexing:
+		return nil, system.NewHTTPError400("knowledge is being indexed, please wait")
+	case types.KnowledgeStatePending:
+		return nil, system.NewHTTPError400("knowledge is queued for indexing, please wait")
+	}
+
+	return k, nil
+}
+
+// getKnowledgeVersionSources returns the crawled sources of the requested version,
+// the knowledge has the sources of the current version with the latest changes
+func (s *HelixAPIServer) getKnowledgeVersionSources(r *http.Request, k *types.Knowledge) (*types.CrawledSources, *system.HTTPError) {
+	version := r.URL.Query().Get("version")
+	if version == "" || version == k.Version {
+		return k.CrawledSources, nil
+	}
+
+	versions, err := s.Store.ListKnowledgeVersions(r.Context(), &store.ListKnowledgeVersionQuery{
+		KnowledgeID: k.ID,
+	})
+	if err != nil {
+		return nil, system.NewHTTPError500(err.Error())
+	}
+
+	for _, v := range versions {
+		if v.Version == version {
+			return v.CrawledSources, nil
+		}
+	}
+
+	return nil, system.NewHTTPError404("knowledge version not found")
+}
+
+func getKnowledgeDocument(k *types.Knowledge, documentID string) *types.KnowledgeDocument {
+	for _, document := range knowledge.GetDocuments(k, k.CrawledSources) {
+		if document.ID == documentID {
+			return document
+		}
+	}
+	return nil
+}
+
+func getKnowledgeDocumentError(err error) *system.HTTPError {
+	switch {
+	case errors.Is(err, knowledge.ErrDocumentNotFound):
+		return system.NewHTTPError404(err.Error())
+	case errors.Is(err, knowledge.ErrKnowledgeBusy):
+		return system.NewHTTPError400(err.Error())
+	case errors.Is(err, rag.ErrNotSupported):
+		return system.NewHTTPError400("changing the documents is not supported by the RAG server of this knowledge")
+	default:
+		return system.NewHTTPError500(err.Error())
+	}
+}
@@ -2,9 +2,14 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 
+	"github.com/gorilla/mux"
+
+	"github.com/helixml/helix/api/pkg/controller/knowledge"
 	"github.com/helixml/helix/api/pkg/store"
 	"github.com/helixml/helix/api/pkg/system"
 	"github.com/helixml/helix/api/pkg/types"
@@ -28,6 +33,7 @@ func (s *HelixAPIServer) listKnowledge(_ http.ResponseWriter, r *http.Request) (
 
 	for idx, knowledge := range knowledges {
 		knowledge.Progress = s.knowledgeManager.GetStatus(knowledge.ID)
+		knowledge.Source.RedactSecrets()
 
 		if knowledge.RefreshEnabled && knowledge.RefreshSchedule != "" {
 			nextRun, err := s.knowledgeManager.NextRun(ctx, knowledge.ID)
@@ -59,6 +65,7 @@ func (s *HelixAPIServer) getKnowledge(_ http.ResponseWriter, r *http.Request) (*
 
 	// Ephemeral progress from the knowledge manager
 	existing.Progress = s.knowledgeManager.GetStatus(id)
+	existing.Source.RedactSecrets()
 
 	return existing, nil
 }
@@ -110,6 +117,8 @@ func (s *HelixAPIServer) deleteKnowledge(_ http.ResponseWriter, r *http.Request)
 		return nil, system.NewHTTPError500(err.Error())
 	}
 
+	existing.Source.RedactSecrets()
+
 	return existing, nil
 }
 
@@ -194,5 +203,49 @@ func (s *HelixAPIServer) refreshKnowledge(_ http.ResponseWriter, r *http.Request
 		return nil, system.NewHTTPError500(err.Error())
 	}
 
+	updated.Source.RedactSecrets()
+
 	return updated, nil
 }
+
+// evaluateKnowledge starts the eval job that runs the golden set against the knowledge versions or
+// the RAG settings variants, poll the job for the results
+func (s *HelixAPIServer) evaluateKnowledge(_ http.ResponseWriter, r *http.Request) (*types.KnowledgeEvalJob, *system.HTTPError) {
+	var req types.KnowledgeEvalRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		return nil, system.NewHTTPError400(fmt.Sprintf("failed to decode request body, error: %s", err))
+	}
+
+	existing, httpErr := s.getOwnedKnowledge(r, "evaluate")
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	job, err := s.knowledgeManager.Evaluate(r.Context(), existing, &req)
+	if err != nil {
+		if errors.Is(err, knowledge.ErrInvalidEvalRequest) || errors.Is(err, knowledge.ErrTooManyEvalJobs) {
+			return nil, system.NewHTTPError400(err.Error())
+		}
+		return nil, system.NewHTTPError500(err.Error())
+	}
+
+	return job, nil
+}
+
+func (s *HelixAPIServer) getKnowledgeEvalJob(_ http.ResponseWriter, r *http.Request) (*types.KnowledgeEvalJob, *system.HTTPError) {
+	existing, httpErr := s.getOwnedKnowledge(r, "evaluate")
+	if httpErr != nil {
+		return nil, httpErr
+	}
+
+	job, err := s.knowledgeManager.GetEvalJob(existing.ID, mux.Vars(r)["job_id"])
+	if err != nil {
+		if errors.Is(err, knowledge.ErrEvalJobNotFound) {
+			return nil, system.NewHTTPError404(err.Error())
+		}
+		return nil, system.NewHTTPError500(err.Error())
+	}
+
+	return job, nil
+}
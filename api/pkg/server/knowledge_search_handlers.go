@@ -11,6 +11,7 @@ import (
 
 	"sort"
 
+	"github.com/helixml/helix/api/pkg/rag"
 	"github.com/helixml/helix/api/pkg/store"
 	"github.com/helixml/helix/api/pkg/system"
 	"github.com/helixml/helix/api/pkg/types"
@@ -24,6 +25,16 @@ func (s *HelixAPIServer) knowledgeSearch(_ http.ResponseWriter, r *http.Request)
 	knowledgeID := r.URL.Query().Get("knowledge_id") // Optional knowledge ID to search within
 	prompt := r.URL.Query().Get("prompt")            // Search query
 
+	// Optional metadata filters, e.g. filter=extension=pdf&filter=path^=/docs/
+	var filters []*types.RAGFilter
+	for _, expr := range r.URL.Query()["filter"] {
+		filter, err := rag.ParseFilter(expr)
+		if err != nil {
+			return nil, system.NewHTTPError400(err.Error())
+		}
+		filters = append(filters, filter)
+	}
+
 	knowledges, err := s.Controller.Options.Store.ListKnowledge(ctx, &store.ListKnowledgeQuery{
 		AppID: appID,
 		Owner: user.ID,
@@ -52,21 +63,9 @@ func (s *HelixAPIServer) knowledgeSearch(_ http.ResponseWriter, r *http.Request)
 	for _, knowledge := range knowledges {
 		knowledge := knowledge
 
-		client, err := s.Controller.GetRagClient(ctx, knowledge)
-		if err != nil {
-			log.Error().Err(err).Msgf("error getting RAG client for knowledge %s", knowledge.ID)
-			return nil, system.NewHTTPError500(err.Error())
-		}
-
 		pool.Go(func() error {
 			start := time.Now()
-			resp, err := client.Query(ctx, &types.SessionRAGQuery{
-				Prompt:            prompt,
-				DataEntityID:      knowledge.GetDataEntityID(),
-				DistanceThreshold: knowledge.RAGSettings.Threshold,
-				DistanceFunction:  knowledge.RAGSettings.DistanceFunction,
-				MaxResults:        knowledge.RAGSettings.ResultsCount,
-			})
+			resp, err := s.Controller.QueryKnowledge(ctx, knowledge, filters, prompt)
 			if err != nil {
 				log.Error().Err(err).Msgf("error querying RAG for knowledge %s", knowledge.ID)
 				return fmt.Errorf("error querying RAG for knowledge %s: %w", knowledge.ID, err)
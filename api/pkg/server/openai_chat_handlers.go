@@ -205,6 +205,11 @@ func (s *HelixAPIServer) createChatCompletion(rw http.ResponseWriter, r *http.Re
 	rw.Header().Set("Cache-Control", "no-cache")
 	rw.Header().Set("Connection", "keep-alive")
 
+	var (
+		answer string
+		id     string
+	)
+
 	// Write the stream into the response
 	for {
 		response, err := stream.Recv()
@@ -216,6 +221,12 @@ func (s *HelixAPIServer) createChatCompletion(rw http.ResponseWriter, r *http.Re
 			return
 		}
 
+		// Accumulate the answer for the citations
+		if len(response.Choices) > 0 {
+			answer += response.Choices[0].Delta.Content
+		}
+		id = response.ID
+
 		// Write the response to the client
 		bts, err := json.Marshal(response)
 		if err != nil {
@@ -227,6 +238,34 @@ func (s *HelixAPIServer) createChatCompletion(rw http.ResponseWriter, r *http.Re
 			log.Error().Msgf("failed to write completion chunk: %v", err)
 		}
 	}
+
+	_, citations := stream.Citations(answer)
+	if err := writeCitationsChunk(rw, id, chatCompletionRequest.Model, citations); err != nil {
+		log.Error().Msgf("failed to write citations chunk: %v", err)
+	}
+}
+
+// writeCitationsChunk writes the citations of the streamed answer as the last chunk, the
+// answer is needed as a whole to find the references to the knowledge
+func writeCitationsChunk(rw http.ResponseWriter, id, model string, citations []*types.Citation) error {
+	if len(citations) == 0 {
+		return nil
+	}
+
+	bts, err := json.Marshal(&types.ChatCompletionStreamResponse{
+		ChatCompletionStreamResponse: openai.ChatCompletionStreamResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Model:   model,
+			Choices: []openai.ChatCompletionStreamChoice{},
+		},
+		Citations: citations,
+	})
+	if err != nil {
+		return err
+	}
+
+	return writeChunk(rw, bts)
 }
 
 func (s *HelixAPIServer) getAppLoraAssistant(ctx context.Context, appID string) (*types.AssistantConfig, error) {
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	oai "github.com/helixml/helix/api/pkg/openai"
+	"github.com/helixml/helix/api/pkg/openai/manager"
+	"github.com/helixml/helix/api/pkg/types"
+
+	"github.com/rs/zerolog/log"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// POST https://app.tryhelix.ai/v1/embeddings
+
+// createEmbeddings godoc
+// @Summary Create embeddings
+// @Description Creates an embedding vector representing the input text. Use the provider query parameter to select the provider, defaults to the inference provider.
+// @Tags    embeddings
+// @Success 200 {object} openai.EmbeddingResponse
+// @Param request    body openai.EmbeddingRequest true "Request body with the model and the input to embed.")
+// @Router /v1/embeddings [post]
+// @Security BearerAuth
+// @externalDocs.url https://platform.openai.com/docs/api-reference/embeddings/create
+func (apiServer *HelixAPIServer) createEmbeddings(rw http.ResponseWriter, r *http.Request) {
+	addCorsHeaders(rw)
+	if r.Method == http.MethodOptions {
+		return
+	}
+
+	user := getRequestUser(r)
+
+	if !hasUserOrRunner(user) {
+		http.Error(rw, "unauthorized", http.StatusUnauthorized)
+		log.Error().Msg("unauthorized")
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 10*MEGABYTE))
+	if err != nil {
+		log.Error().Err(err).Msg("error reading body")
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var embeddingRequest openai.EmbeddingRequest
+	err = json.Unmarshal(body, &embeddingRequest)
+	if err != nil {
+		log.Error().Err(err).Msg("error unmarshalling body")
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if embeddingRequest.Model == "" {
+		http.Error(rw, "model is required", http.StatusBadRequest)
+		return
+	}
+
+	if embeddingRequest.Input == nil {
+		http.Error(rw, "input is required", http.StatusBadRequest)
+		return
+	}
+
+	provider := types.Provider(r.URL.Query().Get("provider"))
+	if provider == "" {
+		provider = apiServer.Cfg.Inference.Provider
+	}
+
+	client, err := apiServer.providerManager.GetClient(r.Context(), &manager.GetClientRequest{
+		Provider: provider,
+	})
+	if err != nil {
+		log.Err(err).Msg("error getting client")
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ownerID := user.ID
+	if user.TokenType == types.TokenTypeRunner {
+		ownerID = oai.RunnerID
+	}
+
+	ctx := oai.SetContextValues(r.Context(), &oai.ContextValues{
+		OwnerID:         ownerID,
+		SessionID:       "n/a",
+		InteractionID:   "n/a",
+		OriginalRequest: body,
+	})
+	ctx = oai.SetContextAppID(ctx, user.AppID)
+
+	resp, err := client.CreateEmbeddings(ctx, embeddingRequest)
+	if err != nil {
+		log.Error().Err(err).Msg("error creating embeddings")
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(rw).Encode(resp)
+	if err != nil {
+		log.Error().Err(err).Msg("error writing response")
+	}
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	oai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/mock/gomock"
+
+	"github.com/helixml/helix/api/pkg/config"
+	"github.com/helixml/helix/api/pkg/openai"
+	"github.com/helixml/helix/api/pkg/openai/manager"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+func TestOpenAIEmbeddingsSuite(t *testing.T) {
+	suite.Run(t, new(OpenAIEmbeddingsSuite))
+}
+
+type OpenAIEmbeddingsSuite struct {
+	suite.Suite
+
+	openAiClient    *openai.MockClient
+	providerManager *manager.MockProviderManager
+
+	authCtx context.Context
+
+	server *HelixAPIServer
+}
+
+func (suite *OpenAIEmbeddingsSuite) SetupTest() {
+	ctrl := gomock.NewController(suite.T())
+
+	suite.openAiClient = openai.NewMockClient(ctrl)
+	suite.providerManager = manager.NewMockProviderManager(ctrl)
+
+	suite.authCtx = setRequestUser(context.Background(), types.User{
+		ID: "user_id",
+	})
+
+	cfg := &config.ServerConfig{}
+	cfg.Inference.Provider = types.ProviderTogetherAI
+
+	suite.server = &HelixAPIServer{
+		Cfg:             cfg,
+		providerManager: suite.providerManager,
+	}
+}
+
+func (suite *OpenAIEmbeddingsSuite) TestCreateEmbeddings() {
+	req, err := http.NewRequest("POST", "/v1/embeddings", bytes.NewBufferString(`{
+		"model": "text-embedding-3-small",
+		"input": ["hello", "world"]
+	}`))
+	suite.NoError(err)
+
+	req = req.WithContext(suite.authCtx)
+
+	suite.providerManager.EXPECT().GetClient(gomock.Any(), &manager.GetClientRequest{
+		Provider: types.ProviderTogetherAI,
+	}).Return(suite.openAiClient, nil)
+
+	suite.openAiClient.EXPECT().CreateEmbeddings(gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, req oai.EmbeddingRequest) (oai.EmbeddingResponse, error) {
+			vals, ok := openai.GetContextValues(ctx)
+			suite.True(ok)
+			suite.Equal("user_id", vals.OwnerID)
+
+			suite.Equal(oai.EmbeddingModel("text-embedding-3-small"), req.Model)
+			suite.Equal([]any{"hello", "world"}, req.Input)
+
+			return oai.EmbeddingResponse{
+				Object: "list",
+				Model:  req.Model,
+				Data: []oai.Embedding{
+					{Object: "embedding", Index: 0, Embedding: []float32{0.1, 0.2}},
+					{Object: "embedding", Index: 1, Embedding: []float32{0.3, 0.4}},
+				},
+			}, nil
+		})
+
+	rec := httptest.NewRecorder()
+	suite.server.createEmbeddings(rec, req)
+
+	suite.Require().Equal(http.StatusOK, rec.Code, rec.Body.String())
+
+	var resp oai.EmbeddingResponse
+	suite.NoError(json.NewDecoder(rec.Body).Decode(&resp))
+	suite.Require().Len(resp.Data, 2)
+	suite.Equal([]float32{0.3, 0.4}, resp.Data[1].Embedding)
+}
+
+func (suite *OpenAIEmbeddingsSuite) TestCreateEmbeddings_Provider() {
+	req, err := http.NewRequest("POST", "/v1/embeddings?provider=openai", bytes.NewBufferString(`{
+		"model": "text-embedding-3-small",
+		"input": "hello"
+	}`))
+	suite.NoError(err)
+
+	req = req.WithContext(suite.authCtx)
+
+	suite.providerManager.EXPECT().GetClient(gomock.Any(), &manager.GetClientRequest{
+		Provider: types.ProviderOpenAI,
+	}).Return(suite.openAiClient, nil)
+
+	suite.openAiClient.EXPECT().CreateEmbeddings(gomock.Any(), gomock.Any()).Return(oai.EmbeddingResponse{}, nil)
+
+	rec := httptest.NewRecorder()
+	suite.server.createEmbeddings(rec, req)
+
+	suite.Equal(http.StatusOK, rec.Code, rec.Body.String())
+}
+
+func (suite *OpenAIEmbeddingsSuite) TestCreateEmbeddings_MissingModel() {
+	req, err := http.NewRequest("POST", "/v1/embeddings", bytes.NewBufferString(`{
+		"input": "hello"
+	}`))
+	suite.NoError(err)
+
+	req = req.WithContext(suite.authCtx)
+
+	rec := httptest.NewRecorder()
+	suite.server.createEmbeddings(rec, req)
+
+	suite.Equal(http.StatusBadRequest, rec.Code)
+}
@@ -281,6 +281,7 @@ func (apiServer *HelixAPIServer) registerRoutes(_ context.Context) (*mux.Router,
 	// OpenAI API compatible routes
 	router.HandleFunc("/v1/chat/completions", apiServer.authMiddleware.auth(apiServer.createChatCompletion)).Methods(http.MethodPost, http.MethodOptions)
 	router.HandleFunc("/v1/models", apiServer.authMiddleware.auth(apiServer.listModels)).Methods(http.MethodGet)
+	router.HandleFunc("/v1/embeddings", apiServer.authMiddleware.auth(apiServer.createEmbeddings)).Methods(http.MethodPost, http.MethodOptions)
 	// Azure OpenAI API compatible routes
 	router.HandleFunc("/openai/deployments/{model}/chat/completions", apiServer.authMiddleware.auth(apiServer.createChatCompletion)).Methods(http.MethodPost, http.MethodOptions)
 
@@ -331,6 +332,12 @@ func (apiServer *HelixAPIServer) registerRoutes(_ context.Context) (*mux.Router,
 	authRouter.HandleFunc("/knowledge/{id}", system.Wrapper(apiServer.deleteKnowledge)).Methods(http.MethodDelete)
 	authRouter.HandleFunc("/knowledge/{id}/refresh", system.Wrapper(apiServer.refreshKnowledge)).Methods(http.MethodPost)
 	authRouter.HandleFunc("/knowledge/{id}/versions", system.Wrapper(apiServer.listKnowledgeVersions)).Methods(http.MethodGet)
+	authRouter.HandleFunc("/knowledge/{id}/eval", system.Wrapper(apiServer.evaluateKnowledge)).Methods(http.MethodPost)
+	authRouter.HandleFunc("/knowledge/{id}/eval/{job_id}", system.Wrapper(apiServer.getKnowledgeEvalJob)).Methods(http.MethodGet)
+	authRouter.HandleFunc("/knowledge/{id}/documents", system.Wrapper(apiServer.listKnowledgeDocuments)).Methods(http.MethodGet)
+	authRouter.HandleFunc("/knowledge/{id}/documents/{document_id}", system.Wrapper(apiServer.deleteKnowledgeDocument)).Methods(http.MethodDelete)
+	authRouter.HandleFunc("/knowledge/{id}/documents/{document_id}/chunks", system.Wrapper(apiServer.listKnowledgeDocumentChunks)).Methods(http.MethodGet)
+	authRouter.HandleFunc("/knowledge/{id}/documents/{document_id}/reindex", system.Wrapper(apiServer.reindexKnowledgeDocument)).Methods(http.MethodPost)
 
 	// we know which app this is by the token that is used (which is linked to the app)
 	// this is so frontend devs don't need anything other than their access token
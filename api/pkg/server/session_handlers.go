@@ -486,6 +486,7 @@ func (s *HelixAPIServer) handleBlockingSession(
 
 	// Update the session with the response
 	session.Interactions[len(session.Interactions)-1].Message = chatCompletionResponse.Choices[0].Message.Content
+	session.Interactions[len(session.Interactions)-1].Citations = chatCompletionResponse.Citations
 	session.Interactions[len(session.Interactions)-1].Completed = time.Now()
 	session.Interactions[len(session.Interactions)-1].State = types.InteractionStateComplete
 	session.Interactions[len(session.Interactions)-1].Finished = true
@@ -579,8 +580,14 @@ func (s *HelixAPIServer) handleStreamingSession(ctx context.Context, user *types
 		}
 	}
 
+	fullResponse, citations := stream.Citations(fullResponse)
+	if err := writeCitationsChunk(rw, session.ID, chatCompletionRequest.Model, citations); err != nil {
+		log.Error().Err(err).Msg("failed to write citations chunk")
+	}
+
 	// Update last interaction
 	session.Interactions[len(session.Interactions)-1].Message = fullResponse
+	session.Interactions[len(session.Interactions)-1].Citations = citations
 	session.Interactions[len(session.Interactions)-1].Completed = time.Now()
 	session.Interactions[len(session.Interactions)-1].State = types.InteractionStateComplete
 	session.Interactions[len(session.Interactions)-1].Finished = true
@@ -247,6 +247,10 @@ func (apiServer *HelixAPIServer) getUserInteractionFromDataEntity(
 	}
 
 	for _, file := range files {
+		// Uploaded files are stored flat in the data entity folder
+		if file.Directory {
+			continue
+		}
 		filePaths = append(filePaths, file.Path)
 	}
 
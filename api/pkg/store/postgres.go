@@ -55,6 +55,12 @@ func NewPostgresStore(
 	return store, nil
 }
 
+// DB returns the underlying database connection, used by the components
+// that keep their own tables in the same database (pgvector RAG)
+func (s *PostgresStore) DB() *gorm.DB {
+	return s.gdb
+}
+
 type MigrationScript struct {
 	Name   string `gorm:"primaryKey"`
 	HasRun bool
@@ -15,11 +15,11 @@ import (
 // RectifyApp handles the migration of app configurations from the old format
 // (which used both Tools and specific fields like APIs, GPTScripts, Zapier) to
 // a new canonical AISpec compatible format where tools are only stored in their
-// specific fields (APIs, GPTScripts, Zapier).
+// specific fields (APIs, GPTScripts, Zapier, MCP).
 //
 // This function:
 //  1. Processes any tools found in the deprecated Tools field and converts them
-//     to their appropriate specific fields (APIs, GPTScripts, Zapier)
+//     to their appropriate specific fields (APIs, GPTScripts, Zapier, MCP)
 //  2. Handles deduplication by name - if a tool already exists in a specific
 //     field (e.g., in APIs), it won't be duplicated from the Tools field
 //  3. Gives precedence to tools defined in their specific fields over those in
@@ -37,6 +37,7 @@ func RectifyApp(app *types.App) {
 		existingAPIs := make(map[string]bool)
 		existingGPTScripts := make(map[string]bool)
 		existingZapier := make(map[string]bool)
+		existingMCP := make(map[string]bool)
 
 		// First mark all existing non-Tools items
 		for _, api := range assistant.APIs {
@@ -48,6 +49,9 @@ func RectifyApp(app *types.App) {
 		for _, zapier := range assistant.Zapier {
 			existingZapier[zapier.Name] = true
 		}
+		for _, mcp := range assistant.MCP {
+			existingMCP[mcp.Name] = true
+		}
 
 		// Convert tools to their appropriate fields
 		// but only if they don't already exist in the non-Tools fields
@@ -88,6 +92,20 @@ func RectifyApp(app *types.App) {
 					})
 					existingZapier[tool.Name] = true
 				}
+			case types.ToolTypeMCP:
+				if !existingMCP[tool.Name] && tool.Config.MCP != nil {
+					assistant.MCP = append(assistant.MCP, types.AssistantMCP{
+						Name:        tool.Name,
+						Description: tool.Description,
+						Transport:   tool.Config.MCP.Transport,
+						Server:      tool.Config.MCP.Server,
+						Env:         tool.Config.MCP.Env,
+						URL:         tool.Config.MCP.URL,
+						Headers:     tool.Config.MCP.Headers,
+						Model:       tool.Config.MCP.Model,
+					})
+					existingMCP[tool.Name] = true
+				}
 			}
 		}
 
@@ -233,7 +251,27 @@ func ConvertAPIToTool(api types.AssistantAPI) (*types.Tool, error) {
 	return t, nil
 }
 
-// BACKWARD COMPATIBILITY ONLY: return an app with the apis, gptscripts, and zapier
+// ConvertMCPToTool converts an AssistantMCP to a Tool, the tools of the
+// MCP server are listed when the tool is used
+func ConvertMCPToTool(mcp types.AssistantMCP) *types.Tool {
+	return &types.Tool{
+		Name:        mcp.Name,
+		Description: mcp.Description,
+		ToolType:    types.ToolTypeMCP,
+		Config: types.ToolConfig{
+			MCP: &types.ToolMCPConfig{
+				Transport: mcp.Transport,
+				Server:    mcp.Server,
+				Env:       mcp.Env,
+				URL:       mcp.URL,
+				Headers:   mcp.Headers,
+				Model:     mcp.Model,
+			},
+		},
+	}
+}
+
+// BACKWARD COMPATIBILITY ONLY: return an app with the apis, gptscripts, zapier and mcp
 // transformed into the deprecated (or at least internal) Tools field
 func (s *PostgresStore) GetAppWithTools(ctx context.Context, id string) (*types.App, error) {
 	app, err := s.GetApp(ctx, id)
@@ -271,6 +309,11 @@ func (s *PostgresStore) GetAppWithTools(ctx context.Context, id string) (*types.
 			})
 		}
 
+		// Convert MCP servers to Tools
+		for _, mcp := range assistant.MCP {
+			tools = append(tools, ConvertMCPToTool(mcp))
+		}
+
 		// Convert GPTScripts to Tools
 		for _, script := range assistant.GPTScripts {
 			tools = append(tools, &types.Tool{
@@ -291,6 +334,7 @@ func (s *PostgresStore) GetAppWithTools(ctx context.Context, id string) (*types.
 		assistant.APIs = nil
 		assistant.GPTScripts = nil
 		assistant.Zapier = nil
+		assistant.MCP = nil
 	}
 
 	return app, nil
@@ -212,6 +212,51 @@ func (suite *PostgresStoreTestSuite) TestRectifyApp() {
 				assert.Equal(t, "http://example.com/existing", api.URL)
 			},
 		},
+		{
+			name: "convert tools to mcp",
+			app: &types.App{
+				Owner:     "test-owner",
+				OwnerType: types.OwnerTypeUser,
+				Config: types.AppConfig{
+					Helix: types.AppHelixConfig{
+						Assistants: []types.AssistantConfig{
+							{
+								ID:    "test-assistant",
+								Name:  "Test Assistant",
+								Model: "gpt-4",
+								Tools: []*types.Tool{
+									{
+										Name:        "test-mcp",
+										Description: "Test MCP server",
+										ToolType:    types.ToolTypeMCP,
+										Config: types.ToolConfig{
+											MCP: &types.ToolMCPConfig{
+												Server: "test-mcp-server",
+												Env: map[string]string{
+													"API_KEY": "test",
+												},
+											},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			validateAfter: func(t *testing.T, app *types.App) {
+				require.Len(t, app.Config.Helix.Assistants, 1)
+				assistant := app.Config.Helix.Assistants[0]
+
+				assert.Empty(t, assistant.Tools)
+
+				require.Len(t, assistant.MCP, 1)
+				mcp := assistant.MCP[0]
+				assert.Equal(t, "test-mcp", mcp.Name)
+				assert.Equal(t, "test-mcp-server", mcp.Server)
+				assert.Equal(t, "test", mcp.Env["API_KEY"])
+			},
+		},
 	}
 
 	for _, tc := range testCases {
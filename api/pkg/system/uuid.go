@@ -19,8 +19,10 @@ const (
 	LLMCallPrefix             = "llmc_"
 	KnowledgePrefix           = "kno_"
 	KnowledgeVersionPrefix    = "knov_"
+	KnowledgeEvalPrefix       = "keval_"
 	SecretPrefix              = "sec_"
 	TestRunPrefix             = "testrun_"
+	ToolCallPrefix            = "call_"
 )
 
 func GenerateUUID() string {
@@ -71,10 +73,18 @@ func GenerateKnowledgeVersionID() string {
 	return fmt.Sprintf("%s%s", KnowledgeVersionPrefix, newID())
 }
 
+func GenerateKnowledgeEvalID() string {
+	return fmt.Sprintf("%s%s", KnowledgeEvalPrefix, newID())
+}
+
 func GenerateSecretID() string {
 	return fmt.Sprintf("%s%s", SecretPrefix, newID())
 }
 
+func GenerateToolCallID() string {
+	return fmt.Sprintf("%s%s", ToolCallPrefix, newID())
+}
+
 // GenerateVersion generates a version string for the knowledge
 // This is used to identify the version of the knowledge
 // and to determine if the knowledge has been updated
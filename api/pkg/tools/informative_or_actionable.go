@@ -21,15 +21,28 @@ const (
 )
 
 type IsActionableResponse struct {
-	NeedsTool     string `json:"needs_tool"`
-	API           string `json:"api"`
-	Justification string `json:"justification"`
+	NeedsTool string `json:"needs_tool"`
+	API       string `json:"api"`
+	// APIs are set instead of API when several independent tools are needed
+	APIs          []string `json:"apis,omitempty"`
+	Justification string   `json:"justification"`
 }
 
 func (i *IsActionableResponse) Actionable() bool {
 	return i.NeedsTool == NeedsToolYes
 }
 
+// Actions returns the chosen actions in the order they were listed
+func (i *IsActionableResponse) Actions() []string {
+	if len(i.APIs) > 0 {
+		return i.APIs
+	}
+	if i.API != "" {
+		return []string{i.API}
+	}
+	return nil
+}
+
 func (c *ChainStrategy) IsActionable(ctx context.Context, sessionID, interactionID string, tools []*types.Tool, history []*types.ToolHistoryMessage, options ...Option) (*IsActionableResponse, error) {
 	return retry.DoWithData(
 		func() (*IsActionableResponse, error) {
@@ -82,6 +95,8 @@ func (c *ChainStrategy) isActionable(ctx context.Context, sessionID, interaction
 
 	started := time.Now()
 
+	c.loadMCPTools(ctx, tools)
+
 	systemPrompt, err := c.getActionableSystemPrompt(tools, opts)
 	if err != nil {
 		return nil, fmt.Errorf("failed to prepare system prompt: %w", err)
@@ -144,7 +159,7 @@ func (c *ChainStrategy) isActionable(ctx context.Context, sessionID, interaction
 		Step: types.LLMCallStepIsActionable,
 	})
 
-	resp, err := c.apiClient.CreateChatCompletion(ctx, req)
+	resp, err := c.createChatCompletion(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get response from inference API: %w", err)
 	}
@@ -165,7 +180,7 @@ func (c *ChainStrategy) isActionable(ctx context.Context, sessionID, interaction
 		Str("history", fmt.Sprintf("%+v", history)).
 		Str("justification", actionableResponse.Justification).
 		Str("needs_tool", actionableResponse.NeedsTool).
-		Str("chosen_tool", actionableResponse.API).
+		Strs("chosen_tools", actionableResponse.Actions()).
 		Dur("time_taken", time.Since(started)).
 		Msg("is_actionable")
 
@@ -206,6 +221,18 @@ func (c *ChainStrategy) getActionableSystemPrompt(tools []*types.Tool, options O
 				Description: tool.Description,
 				ToolType:    string(tool.ToolType),
 			})
+		case types.ToolTypeMCP:
+			// Each tool of the MCP server is a separate action
+			if tool.Config.MCP == nil {
+				continue
+			}
+			for _, action := range tool.Config.MCP.Tools {
+				modelTools = append(modelTools, &modelTool{
+					Name:        action.Name,
+					Description: action.Description,
+					ToolType:    string(tool.ToolType),
+				})
+			}
 		}
 
 	}
@@ -308,6 +335,8 @@ Examples:
 }
 ` + "```" + `
 
+If the user input needs several tools that don't depend on each other's results, list all of them in "apis" instead of "api", for example "apis": ["getVisaStatus", "listJobVacancies"].
+
 **Response Format:** Always respond with JSON without any commentary, wrapped in markdown json tags (` + "```" + `json at the start and ` + "```" + `at the end), for example:
 
 ` + "```" + `json
@@ -231,3 +231,20 @@ func (suite *ActionTestSuite) TestIsActionable_NotActionable() {
 	suite.Equal("no", resp.NeedsTool)
 	suite.Equal("", resp.API)
 }
+
+func TestIsActionableResponse_Actions(t *testing.T) {
+	resp := &IsActionableResponse{NeedsTool: NeedsToolYes, API: "getWeather"}
+	if actions := resp.Actions(); len(actions) != 1 || actions[0] != "getWeather" {
+		t.Errorf("expected [getWeather], got %v", actions)
+	}
+
+	resp = &IsActionableResponse{NeedsTool: NeedsToolYes, APIs: []string{"getWeather", "getProductDetails"}}
+	if actions := resp.Actions(); len(actions) != 2 || actions[1] != "getProductDetails" {
+		t.Errorf("expected [getWeather getProductDetails], got %v", actions)
+	}
+
+	resp = &IsActionableResponse{NeedsTool: NeedsToolNo}
+	if actions := resp.Actions(); len(actions) != 0 {
+		t.Errorf("expected no actions, got %v", actions)
+	}
+}
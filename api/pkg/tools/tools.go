@@ -18,12 +18,18 @@ import (
 	"github.com/helixml/helix/api/pkg/types"
 )
 
+//go:generate mockgen -source $GOFILE -destination tools_mocks.go -package $GOPACKAGE
+
 // TODO: probably move planner into a separate package so we can decide when we want to call APIs, when to go with RAG, etc.
 type Planner interface {
 	IsActionable(ctx context.Context, sessionID, interactionID string, tools []*types.Tool, history []*types.ToolHistoryMessage, options ...Option) (*IsActionableResponse, error)
+	// Native function calling, used instead of IsActionable by the models that support tools
+	SelectToolCalls(ctx context.Context, sessionID, interactionID string, tools []*types.Tool, history []*types.ToolHistoryMessage, options ...Option) ([]oai.ToolCall, map[string]*ToolFunction, error)
 	// TODO: RAG lookup
 	RunAction(ctx context.Context, sessionID, interactionID string, tool *types.Tool, history []*types.ToolHistoryMessage, action string) (*RunActionResponse, error)
 	RunActionStream(ctx context.Context, sessionID, interactionID string, tool *types.Tool, history []*types.ToolHistoryMessage, action string) (*oai.ChatCompletionStream, error)
+	RunToolCall(ctx context.Context, sessionID, interactionID string, tool *types.Tool, history []*types.ToolHistoryMessage, call oai.ToolCall) (*RunActionResponse, error)
+	RunToolCallStream(ctx context.Context, sessionID, interactionID string, tool *types.Tool, history []*types.ToolHistoryMessage, call oai.ToolCall) (*oai.ChatCompletionStream, error)
 	// Validation and defaulting
 	ValidateAndDefault(ctx context.Context, tool *types.Tool) (*types.Tool, error)
 
@@ -42,6 +48,7 @@ type ChainStrategy struct {
 	httpClient           *http.Client
 	gptScriptExecutor    gptscript.Executor
 	isActionableTemplate string
+	mcpClients           mcpClients
 	wg                   sync.WaitGroup
 }
 
@@ -64,6 +71,19 @@ func NewChainStrategy(cfg *config.ServerConfig, store store.Store, gptScriptExec
 	}, nil
 }
 
+// createChatCompletion reports the usage of the call to the usage counter of the context,
+// the agent limits the tokens used by the planner and the tools
+func (c *ChainStrategy) createChatCompletion(ctx context.Context, req oai.ChatCompletionRequest) (oai.ChatCompletionResponse, error) {
+	resp, err := c.apiClient.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+
+	openai.AddUsage(ctx, resp.Usage)
+
+	return resp, nil
+}
+
 func getIsActionablePromptTemplate(cfg *config.ServerConfig) (string, error) {
 	if cfg.Tools.IsActionableTemplate == "" {
 		return isInformativeOrActionablePrompt, nil
@@ -1,10 +1,12 @@
 package tools
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"io"
 	"net/http"
 	"strings"
 
@@ -16,47 +18,24 @@ import (
 	openai "github.com/sashabaranov/go-openai"
 )
 
-func (c *ChainStrategy) prepareRequest(ctx context.Context, tool *types.Tool, action string, params map[string]string) (*http.Request, error) {
-	loader := openapi3.NewLoader()
-
-	schema, err := loader.LoadFromData([]byte(tool.Config.API.Schema))
+func (c *ChainStrategy) prepareRequest(ctx context.Context, tool *types.Tool, action string, params map[string]any) (*http.Request, error) {
+	op, err := loadAPIOperation(tool, action)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load openapi spec: %w", err)
+		return nil, err
 	}
 
-	// Based on the operationId get the path and method
-	var path, method string
-
-	queryParams := make(map[string]bool)
-	pathParams := make(map[string]bool)
-
-	for p, pathItem := range schema.Paths.Map() {
-		for m, operation := range pathItem.Operations() {
-			if operation.OperationID == action {
-				path = p
-				method = m
-
-				for _, param := range operation.Parameters {
-
-					switch param.Value.In {
-					case "query":
-						queryParams[param.Value.Name] = true
-					case "path":
-						pathParams[param.Value.Name] = true
-					}
-				}
+	var body io.Reader
 
-				break
-			}
+	if value, ok := params[requestBodyArgument]; ok && value != nil && op.getJSONRequestBody() != nil {
+		bts, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request body: %w", err)
 		}
-	}
-
-	if path == "" || method == "" {
-		return nil, fmt.Errorf("failed to find path and method for action %s", action)
+		body = bytes.NewReader(bts)
 	}
 
 	// Prepare request
-	req, err := http.NewRequestWithContext(ctx, method, tool.Config.API.URL+path, nil)
+	req, err := http.NewRequestWithContext(ctx, op.method, tool.Config.API.URL+op.path, body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -65,16 +44,32 @@ func (c *ChainStrategy) prepareRequest(ctx context.Context, tool *types.Tool, ac
 		req.Header.Set(k, v)
 	}
 
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
 	q := req.URL.Query()
 
-	// Add path params
-	for k, v := range params {
-		if pathParams[k] {
-			req.URL.Path = strings.Replace(req.URL.Path, "{"+k+"}", v, -1)
+	for _, param := range op.parameters {
+		value, ok := params[param.Value.Name]
+		if !ok || value == nil {
+			continue
 		}
 
-		if queryParams[k] {
-			q.Add(k, v)
+		switch param.Value.In {
+		case openapi3.ParameterInPath:
+			req.URL.Path = strings.ReplaceAll(req.URL.Path, "{"+param.Value.Name+"}", formatParameterValue(value))
+		case openapi3.ParameterInQuery:
+			// Arrays are repeated (form style, exploded)
+			if values, ok := value.([]any); ok {
+				for _, v := range values {
+					q.Add(param.Value.Name, formatParameterValue(v))
+				}
+				continue
+			}
+			q.Add(param.Value.Name, formatParameterValue(value))
+		case openapi3.ParameterInHeader:
+			req.Header.Set(param.Value.Name, formatParameterValue(value))
 		}
 	}
 
@@ -93,12 +88,24 @@ func (c *ChainStrategy) prepareRequest(ctx context.Context, tool *types.Tool, ac
 	req.Header.Set("X-Helix-Tool-Id", tool.ID)
 	req.Header.Set("X-Helix-Action-Id", action)
 
-	// TODO: Add body
-
 	return req, nil
 }
 
-func (c *ChainStrategy) getAPIRequestParameters(ctx context.Context, sessionID, interactionID string, tool *types.Tool, history []*types.ToolHistoryMessage, action string) (map[string]string, error) {
+func (c *ChainStrategy) getAPIRequestParameters(ctx context.Context, sessionID, interactionID string, tool *types.Tool, history []*types.ToolHistoryMessage, action string) (map[string]any, error) {
+	messages, err := c.getAPIRequestMessages(tool, history, action)
+	if err != nil {
+		return nil, err
+	}
+
+	answer, err := c.completeAPIRequestParameters(ctx, sessionID, interactionID, tool, messages)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.validateAPIRequestParameters(ctx, sessionID, interactionID, tool, action, messages, answer)
+}
+
+func (c *ChainStrategy) getAPIRequestMessages(tool *types.Tool, history []*types.ToolHistoryMessage, action string) ([]openai.ChatCompletionMessage, error) {
 	systemPrompt, err := c.getAPISystemPrompt(tool, action)
 	if err != nil {
 		return nil, fmt.Errorf("failed to prepare system prompt: %w", err)
@@ -133,6 +140,11 @@ func (c *ChainStrategy) getAPIRequestParameters(ctx context.Context, sessionID,
 			Content: "Return the corresponding json for the last user input",
 		},
 	)
+
+	return messages, nil
+}
+
+func (c *ChainStrategy) completeAPIRequestParameters(ctx context.Context, sessionID, interactionID string, tool *types.Tool, messages []openai.ChatCompletionMessage) (string, error) {
 	req := openai.ChatCompletionRequest{
 		Stream:   false,
 		Model:    c.cfg.Tools.Model,
@@ -154,42 +166,71 @@ func (c *ChainStrategy) getAPIRequestParameters(ctx context.Context, sessionID,
 		Step: types.LLMCallStepPrepareAPIRequest,
 	})
 
-	resp, err := c.apiClient.CreateChatCompletion(ctx, req)
+	resp, err := c.createChatCompletion(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get response from inference API: %w", err)
+		return "", fmt.Errorf("failed to get response from inference API: %w", err)
 	}
 
 	if len(resp.Choices) == 0 {
-		return nil, fmt.Errorf("no response from inference API")
+		return "", fmt.Errorf("no response from inference API")
 	}
 
-	answer := resp.Choices[0].Message.Content
+	return resp.Choices[0].Message.Content, nil
+}
 
-	// var params map[string]string
-	params, err := unmarshalParams(answer)
+// validateAPIRequestParameters checks the arguments against the operation schema before the
+// API is called, the invalid arguments are sent back to the model together with the errors
+func (c *ChainStrategy) validateAPIRequestParameters(ctx context.Context, sessionID, interactionID string, tool *types.Tool, action string, messages []openai.ChatCompletionMessage, answer string) (map[string]any, error) {
+	op, err := loadAPIOperation(tool, action)
 	if err != nil {
 		return nil, err
 	}
 
-	return params, nil
-}
+	for attempt := 0; ; attempt++ {
+		params, err := unmarshalParams(answer)
+		if err == nil {
+			params, err = op.prepareArguments(params)
+			if err == nil {
+				return params, nil
+			}
+		}
 
-func unmarshalParams(data string) (map[string]string, error) {
-	var initial map[string]interface{}
-	err := unmarshalJSON(data, &initial)
-	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response from inference API: %w (%s)", err, data)
+		if attempt == apiArgumentsRetries {
+			return nil, fmt.Errorf("invalid arguments for action %s: %w", action, err)
+		}
+
+		log.Info().
+			Err(err).
+			Str("tool", tool.Name).
+			Str("action", action).
+			Int("attempt", attempt+1).
+			Msg("invalid API request parameters, asking the model to fix them")
+
+		messages = append(messages,
+			openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleAssistant,
+				Content: answer,
+			},
+			openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleUser,
+				Content: fmt.Sprintf(apiArgumentsRetryPrompt, err),
+			},
+		)
+
+		answer, err = c.completeAPIRequestParameters(ctx, sessionID, interactionID, tool, messages)
+		if err != nil {
+			return nil, err
+		}
 	}
+}
 
-	params := make(map[string]string)
+// unmarshalParams keeps the types of the values, the request body and array
+// parameters are passed on as they are
+func unmarshalParams(data string) (map[string]any, error) {
+	params := make(map[string]any)
 
-	for k, v := range initial {
-		// Convert any type of value to string
-		if v == nil {
-			params[k] = "" // Set empty string if value is nil
-		} else {
-			params[k] = fmt.Sprintf("%v", v)
-		}
+	if err := unmarshalJSON(data, &params); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response from inference API: %w (%s)", err, data)
 	}
 
 	return params, nil
@@ -231,7 +272,13 @@ func (c *ChainStrategy) getAPISystemPrompt(tool *types.Tool, action string) (ope
 	}, nil
 }
 
-const apiSystemPrompt = `You are an intelligent machine learning model that can produce REST API's params / query params in json format, given the json schema, user input, data from previous api calls, and current application state.`
+const apiSystemPrompt = `You are an intelligent machine learning model that can produce REST API's params / query params / request bodies in json format, given the json schema, user input, data from previous api calls, and current application state.`
+
+// apiArgumentsRetries is how many times the model can fix the arguments that don't match the schema
+const apiArgumentsRetries = 2
+
+const apiArgumentsRetryPrompt = `The JSON is not valid for the API operation: %s
+Fix the errors and return the corrected JSON, wrapped in markdown json tags, without any commentary.`
 
 const apiUserPrompt = `
 Your output must be a valid json, without any commentary or additional formatting.
@@ -289,7 +336,30 @@ Examples:
 
 ` + "```" + `json
 {
-  "status": "active"
+  "status": ["active"]
+}
+` + "```" + `
+
+**User Input:** Add a dog called Rex, he is 3 years old
+**OpenAPI schema path:** /pets
+**OpenAPI schema request body:** {
+	"type": "object",
+	"required": ["name"],
+	"properties": {
+		"name": {"type": "string"},
+		"age": {"type": "integer"},
+		"tags": {"type": "array", "items": {"type": "string"}}
+	}
+}
+**Verdict:** response should be:
+
+` + "```" + `json
+{
+  "body": {
+    "name": "Rex",
+    "age": 3,
+    "tags": ["dog"]
+  }
 }
 ` + "```" + `
 
@@ -310,6 +380,7 @@ OpenAPI schema:
 ===END OPENAPI SCHEMA===
 
 Based on conversation below, construct a valid JSON object. In cases where user input does not contain information for a query, DO NOT add that specific query parameter to the output. If a user doesn't provide a required parameter, use sensible defaults for required params, and leave optional params out. Do not pass parameters as null, instead just don't include them.
+If the operation takes a JSON request body, put it under the "body" key. Use the types from the schema: numbers, booleans, arrays and objects must not be passed as strings.
 ONLY use search parameters from the user messages below - do NOT use search parameters provided in the examples.
 `
 
@@ -331,7 +402,7 @@ func filterOpenAPISchema(tool *types.Tool, operationID string) (string, error) {
 	filtered.Paths = &openapi3.Paths{}
 	filtered.Components = &openapi3.Components{}
 
-	var usedRefs []string
+	usedRefs := make(map[string]bool)
 
 	for path, pathItem := range schema.Paths.Map() {
 		for method, operation := range pathItem.Operations() {
@@ -339,22 +410,19 @@ func filterOpenAPISchema(tool *types.Tool, operationID string) (string, error) {
 				// filtered.addOperation(path, method, operation)
 				filtered.AddOperation(path, method, operation)
 
+				if operation.RequestBody != nil && operation.RequestBody.Value != nil {
+					for _, content := range operation.RequestBody.Value.Content {
+						collectSchemaRefs(content.Schema, usedRefs)
+					}
+				}
+
 				for _, resp := range operation.Responses.Map() {
 					jsonBody, ok := resp.Value.Content["application/json"]
 					if !ok {
 						continue
 					}
 
-					if jsonBody.Schema == nil {
-						continue
-					}
-
-					if jsonBody.Schema.Ref != "" {
-						parts := strings.Split(jsonBody.Schema.Ref, "/")
-						if len(parts) > 0 {
-							usedRefs = append(usedRefs, parts[len(parts)-1])
-						}
-					}
+					collectSchemaRefs(jsonBody.Schema, usedRefs)
 				}
 			}
 		}
@@ -363,8 +431,10 @@ func filterOpenAPISchema(tool *types.Tool, operationID string) (string, error) {
 	if len(usedRefs) > 0 {
 		filtered.Components.Schemas = make(map[string]*openapi3.SchemaRef)
 
-		for _, ref := range usedRefs {
-			filtered.Components.Schemas[ref] = schema.Components.Schemas[ref]
+		for ref := range usedRefs {
+			if s, ok := schema.Components.Schemas[ref]; ok {
+				filtered.Components.Schemas[ref] = s
+			}
 		}
 	}
 
@@ -460,6 +530,23 @@ func GetParametersFromSchema(spec string, action string) ([]*Parameter, error) {
 	return parameters, nil
 }
 
+// GetArgumentsSchema returns the JSON schema of the action arguments: the path, query and
+// header parameters by their names and the JSON request body as 'body'
+func GetArgumentsSchema(spec string, action string) (map[string]any, error) {
+	loader := openapi3.NewLoader()
+
+	schema, err := loader.LoadFromData([]byte(spec))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load openapi spec: %w", err)
+	}
+
+	if _, err := getAPIOperation(schema, action); err != nil {
+		return nil, err
+	}
+
+	return getActionParameters(schema, action), nil
+}
+
 func getParameterType(schema *openapi3.SchemaRef) ParameterType {
 	if len(schema.Value.Type.Slice()) > 0 {
 		return ParameterType(schema.Value.Type.Slice()[0])
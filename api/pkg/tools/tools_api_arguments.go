@@ -0,0 +1,375 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+// requestBodyArgument holds the JSON request body of the operation, the other
+// arguments are the path, query and header parameters
+const requestBodyArgument = "body"
+
+// maxInlinedSchemaDepth cuts off the recursive schemas (e.g. a tree of categories)
+const maxInlinedSchemaDepth = 10
+
+// apiOperation is the OpenAPI operation of an API action
+type apiOperation struct {
+	path       string
+	method     string
+	operation  *openapi3.Operation
+	parameters openapi3.Parameters
+}
+
+func loadAPIOperation(tool *types.Tool, action string) (*apiOperation, error) {
+	if tool.Config.API == nil || tool.Config.API.Schema == "" {
+		return nil, fmt.Errorf("tool does not have an API schema")
+	}
+
+	schema, err := openapi3.NewLoader().LoadFromData([]byte(tool.Config.API.Schema))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load openapi spec: %w", err)
+	}
+
+	op, err := getAPIOperation(schema, action)
+	if err != nil {
+		return nil, err
+	}
+
+	// The query parameters and headers set in the tool config are not
+	// chosen by the model
+	var parameters openapi3.Parameters
+	for _, param := range op.parameters {
+		switch param.Value.In {
+		case openapi3.ParameterInQuery:
+			if _, ok := tool.Config.API.Query[param.Value.Name]; ok {
+				continue
+			}
+		case openapi3.ParameterInHeader:
+			if hasHeader(tool.Config.API.Headers, param.Value.Name) {
+				continue
+			}
+		}
+		parameters = append(parameters, param)
+	}
+	op.parameters = parameters
+
+	return op, nil
+}
+
+func hasHeader(headers map[string]string, name string) bool {
+	for k := range headers {
+		if http.CanonicalHeaderKey(k) == http.CanonicalHeaderKey(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func getAPIOperation(schema *openapi3.T, action string) (*apiOperation, error) {
+	for path, pathItem := range schema.Paths.Map() {
+		for method, operation := range pathItem.Operations() {
+			if operation.OperationID != action {
+				continue
+			}
+
+			// The operation parameters override the ones shared by the path
+			var parameters openapi3.Parameters
+			for _, param := range pathItem.Parameters {
+				if param.Value != nil && operation.Parameters.GetByInAndName(param.Value.In, param.Value.Name) == nil {
+					parameters = append(parameters, param)
+				}
+			}
+			for _, param := range operation.Parameters {
+				if param.Value != nil {
+					parameters = append(parameters, param)
+				}
+			}
+
+			return &apiOperation{
+				path:       path,
+				method:     method,
+				operation:  operation,
+				parameters: parameters,
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("failed to find path and method for action %s", action)
+}
+
+// getJSONRequestBody returns the schema of the JSON request body, nil if the
+// operation doesn't take one
+func (o *apiOperation) getJSONRequestBody() *openapi3.SchemaRef {
+	if o.operation.RequestBody == nil || o.operation.RequestBody.Value == nil {
+		return nil
+	}
+
+	for contentType, mediaType := range o.operation.RequestBody.Value.Content {
+		if mediaType.Schema == nil {
+			continue
+		}
+		if contentType == "application/json" || strings.HasSuffix(contentType, "+json") {
+			return mediaType.Schema
+		}
+	}
+
+	return nil
+}
+
+// getArgumentsSchema returns the schema of the arguments of the operation, the
+// parameters by their names and the request body as the 'body' argument
+func (o *apiOperation) getArgumentsSchema() *openapi3.Schema {
+	arguments := openapi3.NewObjectSchema()
+
+	for _, param := range o.parameters {
+		switch param.Value.In {
+		case openapi3.ParameterInPath, openapi3.ParameterInQuery, openapi3.ParameterInHeader:
+		default:
+			continue
+		}
+
+		property := openapi3.NewStringSchema()
+		if param.Value.Schema != nil && param.Value.Schema.Value != nil {
+			copied := *param.Value.Schema.Value
+			property = &copied
+		}
+		if property.Description == "" {
+			property.Description = param.Value.Description
+		}
+
+		arguments.Properties[param.Value.Name] = openapi3.NewSchemaRef("", property)
+
+		if param.Value.Required {
+			arguments.Required = append(arguments.Required, param.Value.Name)
+		}
+	}
+
+	if body := o.getJSONRequestBody(); body != nil && body.Value != nil {
+		property := *body.Value
+		if property.Description == "" {
+			property.Description = o.operation.RequestBody.Value.Description
+		}
+
+		arguments.Properties[requestBodyArgument] = openapi3.NewSchemaRef("", &property)
+
+		if o.operation.RequestBody.Value.Required {
+			arguments.Required = append(arguments.Required, requestBodyArgument)
+		}
+	}
+
+	return arguments
+}
+
+// prepareArguments converts the parameters to the types of their schemas and validates
+// the arguments, the errors are meant to be read by the model that chose the arguments
+func (o *apiOperation) prepareArguments(arguments map[string]any) (map[string]any, error) {
+	prepared := make(map[string]any, len(arguments))
+
+	for k, v := range arguments {
+		// Not set, same as leaving it out
+		if v == nil {
+			continue
+		}
+		prepared[k] = v
+	}
+
+	for _, param := range o.parameters {
+		value, ok := prepared[param.Value.Name]
+		if !ok || param.Value.Schema == nil || param.Value.Schema.Value == nil {
+			continue
+		}
+		prepared[param.Value.Name] = coerceParameterValue(param.Value.Schema.Value, value)
+	}
+
+	err := o.getArgumentsSchema().VisitJSON(prepared, openapi3.MultiErrors(), openapi3.VisitAsRequest())
+	if err != nil {
+		return nil, formatValidationError(err)
+	}
+
+	return prepared, nil
+}
+
+// coerceParameterValue converts the scalar parameters the model often gets wrong, for
+// example numeric IDs that are strings in the schema
+func coerceParameterValue(schema *openapi3.Schema, value any) any {
+	switch {
+	case schema.Type.Is(openapi3.TypeString):
+		switch value.(type) {
+		case float64, bool:
+			return formatParameterValue(value)
+		}
+	case schema.Type.Is(openapi3.TypeInteger), schema.Type.Is(openapi3.TypeNumber):
+		if s, ok := value.(string); ok {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+				return f
+			}
+		}
+	case schema.Type.Is(openapi3.TypeBoolean):
+		if s, ok := value.(string); ok {
+			if b, err := strconv.ParseBool(strings.TrimSpace(s)); err == nil {
+				return b
+			}
+		}
+	case schema.Type.Is(openapi3.TypeArray):
+		if _, ok := value.([]any); !ok {
+			value = []any{value}
+		}
+		if schema.Items != nil && schema.Items.Value != nil {
+			items := value.([]any)
+			coerced := make([]any, len(items))
+			for i, item := range items {
+				coerced[i] = coerceParameterValue(schema.Items.Value, item)
+			}
+			return coerced
+		}
+	}
+
+	return value
+}
+
+// formatParameterValue formats the value for the path, query or header,
+// arrays are comma separated
+func formatParameterValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []any:
+		values := make([]string, len(v))
+		for i, item := range v {
+			values[i] = formatParameterValue(item)
+		}
+		return strings.Join(values, ",")
+	default:
+		bts, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(bts)
+	}
+}
+
+// formatValidationError lists the errors with the paths of the invalid arguments,
+// without the schemas that kin-openapi adds to the messages
+func formatValidationError(err error) error {
+	var errs openapi3.MultiError
+	if !errors.As(err, &errs) {
+		errs = openapi3.MultiError{err}
+	}
+
+	var messages []string
+
+	for _, e := range errs {
+		var nested openapi3.MultiError
+		if errors.As(e, &nested) {
+			messages = append(messages, formatValidationError(nested).Error())
+			continue
+		}
+
+		var schemaErr *openapi3.SchemaError
+		if !errors.As(e, &schemaErr) {
+			messages = append(messages, e.Error())
+			continue
+		}
+
+		reason := schemaErr.Reason
+		if reason == "" {
+			reason = fmt.Sprintf("doesn't match the schema %q", schemaErr.SchemaField)
+		}
+
+		if path := schemaErr.JSONPointer(); len(path) > 0 {
+			messages = append(messages, fmt.Sprintf("%s: %s", strings.Join(path, "."), reason))
+		} else {
+			messages = append(messages, reason)
+		}
+	}
+
+	return errors.New(strings.Join(messages, "; "))
+}
+
+// inlineSchemaRefs copies the schema with the references replaced by the referenced
+// schemas, the function definitions passed to the models can't have references
+func inlineSchemaRefs(ref *openapi3.SchemaRef, depth int) *openapi3.SchemaRef {
+	if ref == nil || ref.Value == nil {
+		return ref
+	}
+
+	if depth > maxInlinedSchemaDepth {
+		return openapi3.NewSchemaRef("", &openapi3.Schema{Description: ref.Value.Description})
+	}
+
+	copied := *ref.Value
+
+	if len(copied.Properties) > 0 {
+		copied.Properties = make(openapi3.Schemas, len(ref.Value.Properties))
+		for name, property := range ref.Value.Properties {
+			copied.Properties[name] = inlineSchemaRefs(property, depth+1)
+		}
+	}
+
+	copied.Items = inlineSchemaRefs(copied.Items, depth+1)
+	copied.Not = inlineSchemaRefs(copied.Not, depth+1)
+	copied.AdditionalProperties.Schema = inlineSchemaRefs(copied.AdditionalProperties.Schema, depth+1)
+	copied.AllOf = inlineSchemaRefsList(copied.AllOf, depth+1)
+	copied.AnyOf = inlineSchemaRefsList(copied.AnyOf, depth+1)
+	copied.OneOf = inlineSchemaRefsList(copied.OneOf, depth+1)
+
+	return openapi3.NewSchemaRef("", &copied)
+}
+
+func inlineSchemaRefsList(refs openapi3.SchemaRefs, depth int) openapi3.SchemaRefs {
+	if len(refs) == 0 {
+		return refs
+	}
+
+	inlined := make(openapi3.SchemaRefs, len(refs))
+	for i, ref := range refs {
+		inlined[i] = inlineSchemaRefs(ref, depth)
+	}
+	return inlined
+}
+
+// collectSchemaRefs adds the names of the component schemas that the schema
+// references, directly or through the referenced schemas
+func collectSchemaRefs(ref *openapi3.SchemaRef, names map[string]bool) {
+	if ref == nil {
+		return
+	}
+
+	if ref.Ref != "" {
+		name := ref.Ref[strings.LastIndex(ref.Ref, "/")+1:]
+		if names[name] {
+			return
+		}
+		names[name] = true
+	}
+
+	if ref.Value == nil {
+		return
+	}
+
+	for _, property := range ref.Value.Properties {
+		collectSchemaRefs(property, names)
+	}
+	collectSchemaRefs(ref.Value.Items, names)
+	collectSchemaRefs(ref.Value.Not, names)
+	collectSchemaRefs(ref.Value.AdditionalProperties.Schema, names)
+	for _, refs := range []openapi3.SchemaRefs{ref.Value.AllOf, ref.Value.AnyOf, ref.Value.OneOf} {
+		for _, r := range refs {
+			collectSchemaRefs(r, names)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/helixml/helix/api/pkg/config"
+	oai "github.com/helixml/helix/api/pkg/openai"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+const searchAPISpec = `openapi: "3.0.0"
+info:
+  version: 1.0.0
+  title: Search
+paths:
+  /orgs/{orgId}/search:
+    parameters:
+      - name: orgId
+        in: path
+        required: true
+        schema:
+          type: integer
+    post:
+      operationId: search
+      parameters:
+        - name: tags
+          in: query
+          schema:
+            type: array
+            items:
+              type: string
+        - name: X-Request-Source
+          in: header
+          schema:
+            type: string
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: "#/components/schemas/Query"
+      responses:
+        '200':
+          description: Search results
+components:
+  schemas:
+    Query:
+      type: object
+      required:
+        - text
+      properties:
+        text:
+          type: string
+        filters:
+          type: object
+          properties:
+            price:
+              type: object
+              properties:
+                max:
+                  type: number
+`
+
+func getSearchTool(url string) *types.Tool {
+	return &types.Tool{
+		Name:     "search",
+		ToolType: types.ToolTypeAPI,
+		Config: types.ToolConfig{
+			API: &types.ToolAPIConfig{
+				URL:    url,
+				Schema: searchAPISpec,
+				Actions: []*types.ToolAPIAction{
+					{Name: "search", Description: "Search the catalog", Method: "POST", Path: "/orgs/{orgId}/search"},
+				},
+			},
+		},
+	}
+}
+
+func Test_prepareArguments(t *testing.T) {
+	op, err := loadAPIOperation(getPetStoreTool(""), "showPetById")
+	require.NoError(t, err)
+
+	// Numeric IDs are converted to the string of the schema
+	params, err := op.prepareArguments(map[string]any{"petId": float64(99944)})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"petId": "99944"}, params)
+
+	_, err = op.prepareArguments(map[string]any{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `property "petId" is missing`)
+
+	op, err = loadAPIOperation(getPetStoreTool(""), "listPets")
+	require.NoError(t, err)
+
+	params, err = op.prepareArguments(map[string]any{"limit": "10"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"limit": float64(10)}, params)
+
+	_, err = op.prepareArguments(map[string]any{"limit": float64(500)})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "limit:")
+}
+
+func Test_prepareArguments_Body(t *testing.T) {
+	op, err := loadAPIOperation(getPetStoreTool(""), "createPets")
+	require.NoError(t, err)
+
+	_, err = op.prepareArguments(map[string]any{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `property "body" is missing`)
+
+	_, err = op.prepareArguments(map[string]any{
+		"body": map[string]any{"id": "one", "tag": "dog"},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `body.id: value must be an integer`)
+	assert.Contains(t, err.Error(), `property "name" is missing`)
+
+	_, err = op.prepareArguments(map[string]any{
+		"body": map[string]any{"id": float64(1), "name": "Rex"},
+	})
+	require.NoError(t, err)
+}
+
+func Test_prepareRequest_Body(t *testing.T) {
+	strategy := &ChainStrategy{cfg: &config.ServerConfig{}}
+
+	req, err := strategy.prepareRequest(context.Background(), getSearchTool("https://example.com"), "search", map[string]any{
+		"orgId":            float64(42),
+		"tags":             []any{"red", "blue"},
+		"X-Request-Source": "helix",
+		"body": map[string]any{
+			"text":    "shoes",
+			"filters": map[string]any{"price": map[string]any{"max": 99.5}},
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "https://example.com/orgs/42/search?tags=red&tags=blue", req.URL.String())
+	assert.Equal(t, "helix", req.Header.Get("X-Request-Source"))
+	assert.Equal(t, "application/json", req.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(req.Body)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"text": "shoes", "filters": {"price": {"max": 99.5}}}`, string(body))
+}
+
+func TestGetToolFunctions_RequestBody(t *testing.T) {
+	functions, _, err := GetToolFunctions([]*types.Tool{getSearchTool("")})
+	require.NoError(t, err)
+	require.Len(t, functions, 1)
+
+	// The path level parameters are included and the body schema is inlined
+	bts, err := json.Marshal(functions[0].Function.Parameters)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"orgId": {"type": "integer"},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"X-Request-Source": {"type": "string"},
+			"body": {
+				"type": "object",
+				"required": ["text"],
+				"properties": {
+					"text": {"type": "string"},
+					"filters": {
+						"type": "object",
+						"properties": {
+							"price": {
+								"type": "object",
+								"properties": {"max": {"type": "number"}}
+							}
+						}
+					}
+				}
+			}
+		},
+		"required": ["orgId"]
+	}`, string(bts))
+}
+
+func TestRunToolCall_InvalidArguments(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/orgs/42/search", r.URL.Path)
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"text": "shoes"}`, string(body))
+
+		_, _ = w.Write([]byte(`[{"name": "running shoes"}]`))
+	}))
+	defer ts.Close()
+
+	ctrl := gomock.NewController(t)
+	apiClient := oai.NewMockClient(ctrl)
+
+	strategy := &ChainStrategy{
+		cfg:        &config.ServerConfig{},
+		apiClient:  apiClient,
+		httpClient: http.DefaultClient,
+	}
+
+	gomock.InOrder(
+		// The arguments of the tool call miss the required text, the model fixes them
+		apiClient.EXPECT().CreateChatCompletion(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+				require.GreaterOrEqual(t, len(req.Messages), 2)
+				assert.Equal(t, `{"orgId": 42, "body": {"query": "shoes"}}`, req.Messages[len(req.Messages)-2].Content)
+				assert.Contains(t, req.Messages[len(req.Messages)-1].Content, `body.text: property "text" is missing`)
+
+				return openai.ChatCompletionResponse{
+					Choices: []openai.ChatCompletionChoice{
+						{Message: openai.ChatCompletionMessage{Content: "```json\n{\"orgId\": 42, \"body\": {\"text\": \"shoes\"}}\n```"}},
+					},
+				}, nil
+			}),
+		apiClient.EXPECT().CreateChatCompletion(gomock.Any(), gomock.Any()).Return(openai.ChatCompletionResponse{
+			Choices: []openai.ChatCompletionChoice{
+				{Message: openai.ChatCompletionMessage{Content: "Found running shoes"}},
+			},
+		}, nil),
+	)
+
+	resp, err := strategy.RunToolCall(context.Background(), "session-123", "i-123", getSearchTool(ts.URL), []*types.ToolHistoryMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "Find shoes"},
+	}, openai.ToolCall{
+		ID:       "call_1",
+		Type:     openai.ToolTypeFunction,
+		Function: openai.FunctionCall{Name: "search", Arguments: `{"orgId": 42, "body": {"query": "shoes"}}`},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Found running shoes", resp.Message)
+}
+
+func TestRunToolCall_InvalidArguments_GiveUp(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	apiClient := oai.NewMockClient(ctrl)
+
+	strategy := &ChainStrategy{
+		cfg:        &config.ServerConfig{},
+		apiClient:  apiClient,
+		httpClient: http.DefaultClient,
+	}
+
+	// The API is not called with the invalid arguments
+	apiClient.EXPECT().CreateChatCompletion(gomock.Any(), gomock.Any()).Return(openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{
+			{Message: openai.ChatCompletionMessage{Content: `{"orgId": "acme"}`}},
+		},
+	}, nil).Times(apiArgumentsRetries)
+
+	_, err := strategy.RunToolCall(context.Background(), "session-123", "i-123", getSearchTool("http://127.0.0.1:0"), nil, openai.ToolCall{
+		ID:       "call_1",
+		Type:     openai.ToolTypeFunction,
+		Function: openai.FunctionCall{Name: "search", Arguments: `{"orgId": "acme"}`},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid arguments for action search")
+}
+
+func Test_loadAPIOperation_ConfiguredParameters(t *testing.T) {
+	tool := getSearchTool("")
+	tool.Config.API.Query = map[string]string{"tags": "featured"}
+	tool.Config.API.Headers = map[string]string{"x-request-source": "helix"}
+
+	op, err := loadAPIOperation(tool, "search")
+	require.NoError(t, err)
+
+	// Set by the tool config, not by the model
+	schema := op.getArgumentsSchema()
+	assert.NotContains(t, schema.Properties, "tags")
+	assert.NotContains(t, schema.Properties, "X-Request-Source")
+	assert.Contains(t, schema.Properties, "orgId")
+}
@@ -32,7 +32,7 @@ func (c *ChainStrategy) handleSuccessResponse(ctx context.Context, sessionID, in
 
 	ctx = c.setContextAndStep(ctx, sessionID, interactionID, types.LLMCallStepInterpretResponse)
 
-	resp, err := c.apiClient.CreateChatCompletion(ctx, req)
+	resp, err := c.createChatCompletion(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get response from inference API: %w", err)
 	}
@@ -102,7 +102,7 @@ func (c *ChainStrategy) handleErrorResponse(ctx context.Context, sessionID, inte
 		Step: types.LLMCallStepInterpretResponse,
 	})
 
-	resp, err := c.apiClient.CreateChatCompletion(ctx, req)
+	resp, err := c.createChatCompletion(ctx, req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get response from inference API: %w", err)
 	}
@@ -136,6 +136,11 @@ func (c *ChainStrategy) prepareSuccessMessages(tool *types.Tool, history []*type
 		systemPrompt = tool.Config.API.ResponseSuccessTemplate
 	}
 
+	return getSuccessMessages(systemPrompt, history, body)
+}
+
+// getSuccessMessages asks the model to present the response of the tool to the user
+func getSuccessMessages(systemPrompt string, history []*types.ToolHistoryMessage, body []byte) []openai.ChatCompletionMessage {
 	messages := []openai.ChatCompletionMessage{
 		{
 			Role:    openai.ChatMessageRoleSystem,
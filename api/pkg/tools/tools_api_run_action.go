@@ -39,6 +39,8 @@ func (c *ChainStrategy) RunAction(ctx context.Context, sessionID, interactionID
 		)
 	case types.ToolTypeZapier:
 		return c.RunZapierAction(ctx, tool, history, action)
+	case types.ToolTypeMCP:
+		return c.RunMCPAction(ctx, sessionID, interactionID, tool, history, action)
 	default:
 		return nil, fmt.Errorf("unknown tool type: %s", tool.ToolType)
 	}
@@ -52,6 +54,8 @@ func (c *ChainStrategy) RunActionStream(ctx context.Context, sessionID, interact
 		return c.runAPIActionStream(ctx, sessionID, interactionID, tool, history, action)
 	case types.ToolTypeZapier:
 		return c.RunZapierActionStream(ctx, tool, history, action)
+	case types.ToolTypeMCP:
+		return c.RunMCPActionStream(ctx, sessionID, interactionID, tool, history, action)
 	default:
 		return nil, fmt.Errorf("unknown tool type: %s", tool.ToolType)
 	}
@@ -78,22 +82,8 @@ func (c *ChainStrategy) runAPIActionStream(ctx context.Context, sessionID, inter
 }
 
 func (c *ChainStrategy) callAPI(ctx context.Context, sessionID, interactionID string, tool *types.Tool, history []*types.ToolHistoryMessage, action string) (*http.Response, error) {
-	// Validate whether action is valid
-	if action == "" {
-		return nil, fmt.Errorf("action is required")
-	}
-
-	found := false
-
-	for _, ac := range tool.Config.API.Actions {
-		if ac.Name == action {
-			found = true
-			break
-		}
-	}
-
-	if !found {
-		return nil, fmt.Errorf("action %s is not found in the tool %s", action, tool.Name)
+	if err := checkAPIAction(tool, action); err != nil {
+		return nil, err
 	}
 
 	started := time.Now()
@@ -110,7 +100,27 @@ func (c *ChainStrategy) callAPI(ctx context.Context, sessionID, interactionID st
 		Dur("time_taken", time.Since(started)).
 		Msg("API request parameters prepared")
 
-	started = time.Now()
+	return c.doAPIRequest(ctx, tool, action, params)
+}
+
+// checkAPIAction validates whether the action is one of the tool actions
+func checkAPIAction(tool *types.Tool, action string) error {
+	if action == "" {
+		return fmt.Errorf("action is required")
+	}
+
+	for _, ac := range tool.Config.API.Actions {
+		if ac.Name == action {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("action %s is not found in the tool %s", action, tool.Name)
+}
+
+// doAPIRequest makes the API call with the parameters that were prepared for the action
+func (c *ChainStrategy) doAPIRequest(ctx context.Context, tool *types.Tool, action string, params map[string]any) (*http.Response, error) {
+	started := time.Now()
 
 	req, err := c.prepareRequest(ctx, tool, action, params)
 	if err != nil {
@@ -155,7 +165,17 @@ func (c *ChainStrategy) RunAPIActionWithParameters(ctx context.Context, req *typ
 
 	if req.Parameters == nil {
 		// Initialize empty parameters map, some API actions don't require parameters
-		req.Parameters = make(map[string]string)
+		req.Parameters = make(map[string]any)
+	}
+
+	op, err := loadAPIOperation(req.Tool, req.Action)
+	if err != nil {
+		return nil, err
+	}
+
+	params, err := op.prepareArguments(req.Parameters)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameters for action %s: %w", req.Action, err)
 	}
 
 	log.Info().
@@ -163,7 +183,7 @@ func (c *ChainStrategy) RunAPIActionWithParameters(ctx context.Context, req *typ
 		Str("action", req.Action).
 		Msg("API request parameters prepared")
 
-	httpRequest, err := c.prepareRequest(ctx, req.Tool, req.Action, req.Parameters)
+	httpRequest, err := c.prepareRequest(ctx, req.Tool, req.Action, params)
 	if err != nil {
 		return nil, fmt.Errorf("failed to prepare request: %w", err)
 	}
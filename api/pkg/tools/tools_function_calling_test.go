@@ -0,0 +1,199 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/helixml/helix/api/pkg/config"
+	oai "github.com/helixml/helix/api/pkg/openai"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+func getPetStoreTool(url string) *types.Tool {
+	return &types.Tool{
+		Name:     "petStore",
+		ToolType: types.ToolTypeAPI,
+		Config: types.ToolConfig{
+			API: &types.ToolAPIConfig{
+				URL:    url,
+				Schema: petStoreAPISpec,
+				Actions: []*types.ToolAPIAction{
+					{Name: "listPets", Description: "List all pets", Method: "GET", Path: "/pets"},
+					{Name: "showPetById", Description: "Info for a specific pet", Method: "GET", Path: "/pets/{petId}"},
+				},
+			},
+		},
+	}
+}
+
+func TestGetToolFunctions(t *testing.T) {
+	petStore := getPetStoreTool("")
+	report := &types.Tool{
+		Name:        "pet report",
+		Description: "Writes a report about the pets",
+		ToolType:    types.ToolTypeGPTScript,
+	}
+
+	functions, toolFunctions, err := GetToolFunctions([]*types.Tool{petStore, report})
+	require.NoError(t, err)
+	require.Len(t, functions, 3)
+
+	assert.Equal(t, map[string]*ToolFunction{
+		"listPets":    {Tool: petStore, Action: "listPets"},
+		"showPetById": {Tool: petStore, Action: "showPetById"},
+		"pet_report":  {Tool: report, Action: "pet report"},
+	}, toolFunctions)
+
+	bts, err := json.Marshal(functions[1].Function.Parameters)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"petId": {"type": "string", "description": "The id of the pet to retrieve"}
+		},
+		"required": ["petId"]
+	}`, string(bts))
+
+	bts, err = json.Marshal(functions[0].Function.Parameters)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"type": "object",
+		"properties": {
+			"limit": {
+				"type": "integer",
+				"format": "int32",
+				"maximum": 100,
+				"description": "How many items to return at one time (max 100)"
+			}
+		}
+	}`, string(bts))
+
+	assert.Equal(t, "pet_report", functions[2].Function.Name)
+}
+
+func TestGetToolFunctions_UniqueNames(t *testing.T) {
+	long := strings.Repeat("a", maxFunctionNameLength+10)
+
+	functions, toolFunctions, err := GetToolFunctions([]*types.Tool{
+		{Name: "pet report", ToolType: types.ToolTypeGPTScript},
+		{Name: "pet/report", ToolType: types.ToolTypeGPTScript},
+		{Name: "pet_report_2", ToolType: types.ToolTypeGPTScript},
+		{Name: long + "-one", ToolType: types.ToolTypeGPTScript},
+		{Name: long + "-two", ToolType: types.ToolTypeGPTScript},
+	})
+	require.NoError(t, err)
+	require.Len(t, functions, 5)
+
+	truncated := long[:maxFunctionNameLength]
+
+	actions := make(map[string]string, len(toolFunctions))
+	for name, function := range toolFunctions {
+		actions[name] = function.Action
+	}
+
+	assert.Equal(t, map[string]string{
+		"pet_report":     "pet report",
+		"pet_report_2":   "pet/report",
+		"pet_report_2_2": "pet_report_2",
+		truncated:        long + "-one",
+		truncated[:maxFunctionNameLength-2] + "_2": long + "-two",
+	}, actions)
+
+	// The model sees every function once
+	for idx, f := range functions {
+		assert.LessOrEqual(t, len(f.Function.Name), maxFunctionNameLength)
+		for _, other := range functions[:idx] {
+			assert.NotEqual(t, other.Function.Name, f.Function.Name)
+		}
+	}
+}
+
+func TestSelectToolCalls(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	apiClient := oai.NewMockClient(ctrl)
+
+	strategy := &ChainStrategy{
+		cfg:       &config.ServerConfig{},
+		apiClient: apiClient,
+	}
+
+	apiClient.EXPECT().CreateChatCompletion(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+			assert.Equal(t, "assistant-model", req.Model)
+			assert.Len(t, req.Tools, 3)
+
+			return openai.ChatCompletionResponse{
+				Choices: []openai.ChatCompletionChoice{
+					{
+						Message: openai.ChatCompletionMessage{
+							ToolCalls: []openai.ToolCall{
+								{
+									ID:       "call_1",
+									Type:     openai.ToolTypeFunction,
+									Function: openai.FunctionCall{Name: "pet_report", Arguments: "{}"},
+								},
+							},
+						},
+					},
+				},
+			}, nil
+		})
+
+	report := &types.Tool{Name: "pet report", ToolType: types.ToolTypeGPTScript}
+
+	calls, functions, err := strategy.SelectToolCalls(context.Background(), "session-123", "i-123", []*types.Tool{
+		getPetStoreTool(""),
+		report,
+	}, []*types.ToolHistoryMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "Write a report about my pets"},
+	}, WithModel("assistant-model"))
+	require.NoError(t, err)
+	require.Len(t, calls, 1)
+	assert.Equal(t, "pet_report", calls[0].Function.Name)
+	assert.Equal(t, &ToolFunction{Tool: report, Action: "pet report"}, functions["pet_report"])
+}
+
+func TestRunToolCall(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/pets/99944", r.URL.Path)
+		fmt.Fprintln(w, `{"id": 99944, "name": "doggie"}`)
+	}))
+	defer ts.Close()
+
+	ctrl := gomock.NewController(t)
+	apiClient := oai.NewMockClient(ctrl)
+
+	strategy := &ChainStrategy{
+		cfg:        &config.ServerConfig{},
+		apiClient:  apiClient,
+		httpClient: http.DefaultClient,
+	}
+
+	// Only the response is interpreted, the arguments come from the tool call
+	apiClient.EXPECT().CreateChatCompletion(gomock.Any(), gomock.Any()).Return(openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{
+			{Message: openai.ChatCompletionMessage{Content: "Your pet is doggie"}},
+		},
+	}, nil)
+
+	resp, err := strategy.RunToolCall(context.Background(), "session-123", "i-123", getPetStoreTool(ts.URL), []*types.ToolHistoryMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "What's the name of pet 99944?"},
+	}, openai.ToolCall{
+		ID:       "call_1",
+		Type:     openai.ToolTypeFunction,
+		Function: openai.FunctionCall{Name: "showPetById", Arguments: `{"petId": "99944"}`},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Your pet is doggie", resp.Message)
+	assert.JSONEq(t, `{"id": 99944, "name": "doggie"}`, resp.RawMessage)
+}
@@ -0,0 +1,331 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	mcpSessionIDHeader = "Mcp-Session-Id"
+
+	// maxMCPEventSize limits the size of a single event of the streamed responses
+	maxMCPEventSize = 10 * 1024 * 1024
+)
+
+// streamableHTTPMCPClient talks to the MCP servers over the streamable HTTP transport, each
+// request is posted to the server endpoint which answers with JSON or an event stream.
+// mcp-go only comes with the stdio and SSE clients.
+type streamableHTTPMCPClient struct {
+	url        string
+	headers    map[string]string
+	httpClient *http.Client
+	requestID  atomic.Int64
+
+	mu        sync.RWMutex
+	sessionID string
+}
+
+func newStreamableHTTPMCPClient(url string, headers map[string]string) *streamableHTTPMCPClient {
+	return &streamableHTTPMCPClient{
+		url:     url,
+		headers: headers,
+		// Not retried, the tool calls are not idempotent
+		httpClient: &http.Client{},
+	}
+}
+
+type jsonRPCResponse struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (r *jsonRPCResponse) unmarshalResult(method string, result any) error {
+	if r.Error != nil {
+		return fmt.Errorf("request %s failed: %s (code %d)", method, r.Error.Message, r.Error.Code)
+	}
+
+	if err := json.Unmarshal(r.Result, result); err != nil {
+		return fmt.Errorf("failed to unmarshal %s result: %w", method, err)
+	}
+
+	return nil
+}
+
+func marshalMCPRequest(id int64, method string, params any) ([]byte, error) {
+	body, err := json.Marshal(struct {
+		JSONRPC string `json:"jsonrpc"`
+		ID      int64  `json:"id"`
+		Method  string `json:"method"`
+		Params  any    `json:"params,omitempty"`
+	}{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		ID:      id,
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return body, nil
+}
+
+func marshalMCPNotification(method string) ([]byte, error) {
+	body, err := json.Marshal(mcp.JSONRPCNotification{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		Notification: mcp.Notification{
+			Method: method,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal notification: %w", err)
+	}
+	return body, nil
+}
+
+func (c *streamableHTTPMCPClient) Initialize(ctx context.Context, request mcp.InitializeRequest) (*mcp.InitializeResult, error) {
+	var result mcp.InitializeResult
+	if err := c.sendRequest(ctx, "initialize", request.Params, &result); err != nil {
+		return nil, err
+	}
+
+	if err := c.sendNotification(ctx, "notifications/initialized"); err != nil {
+		return nil, fmt.Errorf("failed to send initialized notification: %w", err)
+	}
+
+	return &result, nil
+}
+
+func (c *streamableHTTPMCPClient) ListTools(ctx context.Context, request mcp.ListToolsRequest) (*mcp.ListToolsResult, error) {
+	var result mcp.ListToolsResult
+	if err := c.sendRequest(ctx, "tools/list", request.Params, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *streamableHTTPMCPClient) CallTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var result mcp.CallToolResult
+	if err := c.sendRequest(ctx, "tools/call", request.Params, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close ends the session on the server, the servers that don't keep
+// sessions don't return a session ID
+func (c *streamableHTTPMCPClient) Close() error {
+	sessionID := c.getSessionID()
+	if sessionID == "" {
+		return nil
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, c.url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	c.setHeaders(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to end session: %w", err)
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func (c *streamableHTTPMCPClient) sendRequest(ctx context.Context, method string, params, result any) error {
+	body, err := marshalMCPRequest(c.requestID.Add(1), method, params)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.post(ctx, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bts, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("request %s failed with status %d: %s", method, resp.StatusCode, string(bts))
+	}
+
+	if sessionID := resp.Header.Get(mcpSessionIDHeader); sessionID != "" {
+		c.setSessionID(sessionID)
+	}
+
+	var response *jsonRPCResponse
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		response, err = readMCPEventStream(resp.Body)
+	} else {
+		response = &jsonRPCResponse{}
+		err = json.NewDecoder(resp.Body).Decode(response)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s response: %w", method, err)
+	}
+
+	return response.unmarshalResult(method, result)
+}
+
+func (c *streamableHTTPMCPClient) sendNotification(ctx context.Context, method string) error {
+	body, err := marshalMCPNotification(method)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.post(ctx, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		bts, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("notification %s failed with status %d: %s", method, resp.StatusCode, string(bts))
+	}
+
+	return nil
+}
+
+func (c *streamableHTTPMCPClient) post(ctx context.Context, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	c.setHeaders(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (c *streamableHTTPMCPClient) setHeaders(req *http.Request) {
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+
+	if sessionID := c.getSessionID(); sessionID != "" {
+		req.Header.Set(mcpSessionIDHeader, sessionID)
+	}
+}
+
+func (c *streamableHTTPMCPClient) getSessionID() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.sessionID
+}
+
+func (c *streamableHTTPMCPClient) setSessionID(sessionID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sessionID = sessionID
+}
+
+// readMCPEventStream returns the response of the posted request, the server
+// can send its own requests and notifications on the stream before it
+func readMCPEventStream(body io.Reader) (*jsonRPCResponse, error) {
+	var (
+		response *jsonRPCResponse
+		parseErr error
+	)
+
+	err := scanMCPEvents(body, func(_, data string) bool {
+		var message jsonRPCResponse
+		if err := json.Unmarshal([]byte(data), &message); err != nil {
+			parseErr = fmt.Errorf("failed to parse event: %w", err)
+			return false
+		}
+
+		if message.Method != "" {
+			log.Debug().Str("method", message.Method).Msg("skipping MCP server message")
+			return true
+		}
+
+		response = &message
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if parseErr != nil {
+		return nil, parseErr
+	}
+	if response == nil {
+		return nil, fmt.Errorf("event stream ended without a response")
+	}
+
+	return response, nil
+}
+
+// scanMCPEvents calls handle for each event of the stream until it returns false
+func scanMCPEvents(body io.Reader, handle func(event, data string) bool) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMCPEventSize)
+
+	var (
+		event string
+		data  strings.Builder
+	)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			continue
+		case strings.HasPrefix(line, "data:"):
+			data.WriteString(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+			continue
+		}
+
+		// Events end with an empty line
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+
+		if !handle(event, data.String()) {
+			return nil
+		}
+		event = ""
+		data.Reset()
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// The last event isn't always followed by an empty line
+	if data.Len() > 0 {
+		handle(event, data.String())
+	}
+
+	return nil
+}
@@ -0,0 +1,280 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/rs/zerolog/log"
+)
+
+// sseMCPClient talks to the MCP servers over the SSE transport, the client keeps an
+// event stream open and posts the requests to the endpoint the server sends on it.
+// The responses come back on the stream. The mcp-go SSE client drops the request
+// params and can't set headers, so it's not used.
+type sseMCPClient struct {
+	headers    map[string]string
+	httpClient *http.Client
+	requestID  atomic.Int64
+	endpoint   string
+	cancel     context.CancelFunc
+
+	mu        sync.Mutex
+	responses map[int64]chan *jsonRPCResponse // nil once the stream ended
+}
+
+func newSSEMCPClient(ctx context.Context, serverURL string, headers map[string]string) (*sseMCPClient, error) {
+	c := &sseMCPClient{
+		headers: headers,
+		// Not retried, the tool calls are not idempotent
+		httpClient: &http.Client{},
+		responses:  make(map[int64]chan *jsonRPCResponse),
+	}
+
+	// The event stream outlives the request that connected it
+	streamCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	c.cancel = cancel
+
+	req, err := http.NewRequestWithContext(streamCtx, http.MethodGet, serverURL, nil)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	c.setHeaders(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to connect to SSE stream: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		bts, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		cancel()
+		return nil, fmt.Errorf("SSE stream failed with status %d: %s", resp.StatusCode, string(bts))
+	}
+
+	endpointCh := make(chan string, 1)
+	go c.readEvents(resp.Body, endpointCh)
+
+	var endpoint string
+
+	select {
+	case <-ctx.Done():
+		cancel()
+		return nil, ctx.Err()
+	case e, ok := <-endpointCh:
+		if !ok {
+			cancel()
+			return nil, fmt.Errorf("SSE stream ended before the endpoint was received")
+		}
+		endpoint = e
+	}
+
+	base, err := url.Parse(serverURL)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	// The endpoint is usually relative to the stream URL
+	endpointURL, err := base.Parse(endpoint)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to parse endpoint %s: %w", endpoint, err)
+	}
+
+	if endpointURL.Host != base.Host {
+		cancel()
+		return nil, fmt.Errorf("endpoint %s does not match the server host %s", endpoint, base.Host)
+	}
+
+	c.endpoint = endpointURL.String()
+
+	return c, nil
+}
+
+func (c *sseMCPClient) Initialize(ctx context.Context, request mcp.InitializeRequest) (*mcp.InitializeResult, error) {
+	var result mcp.InitializeResult
+	if err := c.sendRequest(ctx, "initialize", request.Params, &result); err != nil {
+		return nil, err
+	}
+
+	if err := c.sendNotification(ctx, "notifications/initialized"); err != nil {
+		return nil, fmt.Errorf("failed to send initialized notification: %w", err)
+	}
+
+	return &result, nil
+}
+
+func (c *sseMCPClient) ListTools(ctx context.Context, request mcp.ListToolsRequest) (*mcp.ListToolsResult, error) {
+	var result mcp.ListToolsResult
+	if err := c.sendRequest(ctx, "tools/list", request.Params, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *sseMCPClient) CallTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var result mcp.CallToolResult
+	if err := c.sendRequest(ctx, "tools/call", request.Params, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Close ends the event stream, the server drops the session with it
+func (c *sseMCPClient) Close() error {
+	c.cancel()
+	return nil
+}
+
+func (c *sseMCPClient) sendRequest(ctx context.Context, method string, params, result any) error {
+	id := c.requestID.Add(1)
+
+	body, err := marshalMCPRequest(id, method, params)
+	if err != nil {
+		return err
+	}
+
+	responseCh := make(chan *jsonRPCResponse, 1)
+
+	c.mu.Lock()
+	if c.responses == nil {
+		c.mu.Unlock()
+		return fmt.Errorf("request %s failed: SSE stream closed", method)
+	}
+	c.responses[id] = responseCh
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		if c.responses != nil {
+			delete(c.responses, id)
+		}
+		c.mu.Unlock()
+	}()
+
+	if err := c.post(ctx, body); err != nil {
+		return fmt.Errorf("request %s failed: %w", method, err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case response, ok := <-responseCh:
+		if !ok {
+			return fmt.Errorf("request %s failed: SSE stream closed", method)
+		}
+		return response.unmarshalResult(method, result)
+	}
+}
+
+func (c *sseMCPClient) sendNotification(ctx context.Context, method string) error {
+	body, err := marshalMCPNotification(method)
+	if err != nil {
+		return err
+	}
+
+	return c.post(ctx, body)
+}
+
+// post sends the message to the endpoint, the response comes on the event stream
+func (c *sseMCPClient) post(ctx context.Context, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	c.setHeaders(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		bts, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(bts))
+	}
+
+	return nil
+}
+
+func (c *sseMCPClient) setHeaders(req *http.Request) {
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+}
+
+// readEvents passes the endpoint and the responses on until the stream ends,
+// the pending requests fail then
+func (c *sseMCPClient) readEvents(body io.ReadCloser, endpointCh chan<- string) {
+	defer body.Close()
+
+	endpointSent := false
+
+	err := scanMCPEvents(body, func(event, data string) bool {
+		switch event {
+		case "endpoint":
+			if !endpointSent {
+				endpointCh <- data
+				endpointSent = true
+			}
+		case "", "message":
+			c.handleMessage(data)
+		}
+		return true
+	})
+	if err != nil {
+		log.Debug().Err(err).Msg("MCP SSE stream ended")
+	}
+
+	if !endpointSent {
+		close(endpointCh)
+	}
+
+	c.mu.Lock()
+	for _, ch := range c.responses {
+		close(ch)
+	}
+	c.responses = nil
+	c.mu.Unlock()
+}
+
+func (c *sseMCPClient) handleMessage(data string) {
+	var message jsonRPCResponse
+	if err := json.Unmarshal([]byte(data), &message); err != nil {
+		log.Debug().Err(err).Msg("failed to parse MCP server message")
+		return
+	}
+
+	if message.Method != "" {
+		log.Debug().Str("method", message.Method).Msg("skipping MCP server message")
+		return
+	}
+
+	var id int64
+	if err := json.Unmarshal(message.ID, &id); err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ch, ok := c.responses[id]; ok {
+		ch <- &message
+		delete(c.responses, id)
+	}
+}
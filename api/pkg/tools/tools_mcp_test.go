@@ -0,0 +1,348 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+
+	"github.com/helixml/helix/api/pkg/config"
+	oai "github.com/helixml/helix/api/pkg/openai"
+	"github.com/helixml/helix/api/pkg/types"
+)
+
+func newWeatherMCPServer() *server.MCPServer {
+	s := server.NewMCPServer("weather", "1.0.0")
+
+	s.AddTool(mcp.NewTool("getWeather",
+		mcp.WithDescription("Get the current weather for a city"),
+		mcp.WithString("city", mcp.Required(), mcp.Description("Name of the city")),
+	), func(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		city, _ := request.Params.Arguments["city"].(string)
+		return mcp.NewToolResultText("Sunny in " + city), nil
+	})
+
+	return s
+}
+
+// newStreamableHTTPServer serves the MCP server over the streamable HTTP transport,
+// the requests must carry the API key and the session ID
+func newStreamableHTTPServer(t *testing.T, s *server.MCPServer, respondWithEvents bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		var message struct {
+			Method string `json:"method"`
+		}
+		require.NoError(t, json.Unmarshal(body, &message))
+
+		if message.Method == "initialize" {
+			w.Header().Set(mcpSessionIDHeader, "session-1")
+		} else {
+			assert.Equal(t, "session-1", r.Header.Get(mcpSessionIDHeader))
+		}
+
+		response := s.HandleMessage(r.Context(), body)
+		if response == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+
+		bts, err := json.Marshal(response)
+		require.NoError(t, err)
+
+		if respondWithEvents {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte("event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/message\"}\n\n"))
+			_, _ = w.Write([]byte("event: message\ndata: " + string(bts) + "\n\n"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(bts)
+	}))
+}
+
+func getWeatherMCPTool(cfg *types.ToolMCPConfig) *types.Tool {
+	return &types.Tool{
+		Name:     "weather",
+		ToolType: types.ToolTypeMCP,
+		Config: types.ToolConfig{
+			MCP: cfg,
+		},
+	}
+}
+
+func TestMCP_StreamableHTTP(t *testing.T) {
+	for _, respondWithEvents := range []bool{false, true} {
+		ts := newStreamableHTTPServer(t, newWeatherMCPServer(), respondWithEvents)
+
+		strategy := &ChainStrategy{cfg: &config.ServerConfig{}}
+
+		tool := getWeatherMCPTool(&types.ToolMCPConfig{
+			URL:     ts.URL,
+			Headers: map[string]string{"Authorization": "Bearer secret"},
+		})
+
+		strategy.loadMCPTools(context.Background(), []*types.Tool{tool})
+		require.Len(t, tool.Config.MCP.Tools, 1)
+		assert.Equal(t, "getWeather", tool.Config.MCP.Tools[0].Name)
+		assert.Equal(t, []string{"city"}, tool.Config.MCP.Tools[0].InputSchema["required"])
+
+		result, isError, err := strategy.callMCPTool(context.Background(), tool, "getWeather", map[string]any{"city": "London"})
+		require.NoError(t, err)
+		assert.False(t, isError)
+		assert.Equal(t, "Sunny in London", result)
+
+		strategy.mcpClients.remove(context.Background(), tool)
+		ts.Close()
+	}
+}
+
+func TestMCP_SSE(t *testing.T) {
+	ts := server.NewTestServer(newWeatherMCPServer())
+	defer ts.Close()
+
+	strategy := &ChainStrategy{cfg: &config.ServerConfig{}}
+
+	tool := getWeatherMCPTool(&types.ToolMCPConfig{
+		Transport: types.MCPTransportSSE,
+		URL:       ts.URL + "/sse",
+	})
+	defer strategy.mcpClients.remove(context.Background(), tool)
+
+	result, _, err := strategy.callMCPTool(context.Background(), tool, "getWeather", map[string]any{"city": "Paris"})
+	require.NoError(t, err)
+	assert.Equal(t, "Sunny in Paris", result)
+}
+
+func TestMCP_RunAction(t *testing.T) {
+	ts := newStreamableHTTPServer(t, newWeatherMCPServer(), false)
+	defer ts.Close()
+
+	ctrl := gomock.NewController(t)
+	apiClient := oai.NewMockClient(ctrl)
+
+	strategy := &ChainStrategy{
+		cfg:       &config.ServerConfig{},
+		apiClient: apiClient,
+	}
+
+	tool := getWeatherMCPTool(&types.ToolMCPConfig{
+		URL:     ts.URL,
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+		Model:   "assistant-model",
+	})
+	defer strategy.mcpClients.remove(context.Background(), tool)
+
+	gomock.InOrder(
+		apiClient.EXPECT().CreateChatCompletion(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+				assert.Equal(t, "assistant-model", req.Model)
+				assert.Contains(t, req.Messages[0].Content, "Name of the city")
+
+				return openai.ChatCompletionResponse{
+					Choices: []openai.ChatCompletionChoice{
+						{Message: openai.ChatCompletionMessage{Content: "```json\n{\"city\": \"Berlin\"}\n```"}},
+					},
+				}, nil
+			}),
+		apiClient.EXPECT().CreateChatCompletion(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+				assert.Contains(t, req.Messages[len(req.Messages)-2].Content, "Sunny in Berlin")
+
+				return openai.ChatCompletionResponse{
+					Choices: []openai.ChatCompletionChoice{
+						{Message: openai.ChatCompletionMessage{Content: "It's sunny in Berlin"}},
+					},
+				}, nil
+			}),
+	)
+
+	resp, err := strategy.RunAction(context.Background(), "session-123", "i-123", tool, []*types.ToolHistoryMessage{
+		{Role: openai.ChatMessageRoleUser, Content: "What's the weather in Berlin?"},
+	}, "getWeather")
+	require.NoError(t, err)
+	assert.Equal(t, "It's sunny in Berlin", resp.Message)
+	assert.Equal(t, "Sunny in Berlin", resp.RawMessage)
+
+	functions, toolFunctions, err := GetToolFunctions([]*types.Tool{tool})
+	require.NoError(t, err)
+	require.Len(t, functions, 1)
+	assert.Equal(t, &ToolFunction{Tool: tool, Action: "getWeather"}, toolFunctions["getWeather"])
+
+	selected, ok := GetToolFromAction([]*types.Tool{tool}, "getWeather")
+	require.True(t, ok)
+	assert.Equal(t, "weather", selected.Name)
+}
+
+func TestValidateMCPConfig(t *testing.T) {
+	stdioServers := config.MCPStdioServers{
+		"github": {"npx", "-y", "@modelcontextprotocol/server-github"},
+		"time":   {"uvx", "mcp-server-time"},
+	}
+
+	assert.NoError(t, validateMCPConfig(&types.ToolMCPConfig{Server: "github", Env: map[string]string{"GITHUB_PERSONAL_ACCESS_TOKEN": "ghp_1"}}, stdioServers))
+	assert.NoError(t, validateMCPConfig(&types.ToolMCPConfig{URL: "http://localhost:8080/mcp"}, nil))
+	assert.Error(t, validateMCPConfig(&types.ToolMCPConfig{}, stdioServers))
+	assert.Error(t, validateMCPConfig(&types.ToolMCPConfig{Transport: types.MCPTransportStdio}, stdioServers))
+	assert.Error(t, validateMCPConfig(&types.ToolMCPConfig{Transport: "websocket", URL: "ws://localhost"}, stdioServers))
+	assert.Error(t, validateMCPConfig(&types.ToolMCPConfig{Transport: types.MCPTransportSSE}, stdioServers))
+
+	// Stdio servers run on the API host, only the registered servers can be launched
+	err := validateMCPConfig(&types.ToolMCPConfig{Server: "github"}, nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stdio MCP servers are disabled")
+
+	err = validateMCPConfig(&types.ToolMCPConfig{Server: "bash"}, stdioServers)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stdio MCP server bash is not registered, available servers: github, time")
+
+	// The environment can't change how the server is loaded
+	for _, key := range []string{"PATH", "LD_PRELOAD", "NODE_OPTIONS", "node_options", "PYTHONPATH", "BASH_ENV", "A=B"} {
+		err = validateMCPConfig(&types.ToolMCPConfig{Server: "github", Env: map[string]string{key: "x"}}, stdioServers)
+		assert.Error(t, err, key)
+	}
+}
+
+func TestMCP_StdioDisabled(t *testing.T) {
+	strategy := &ChainStrategy{cfg: &config.ServerConfig{}}
+
+	tool := getWeatherMCPTool(&types.ToolMCPConfig{Server: "github"})
+
+	_, err := strategy.ValidateAndDefault(context.Background(), tool)
+	require.Error(t, err)
+
+	// Apps created before stdio was restricted are not launched either
+	_, _, err = strategy.callMCPTool(context.Background(), tool, "getWeather", nil)
+	require.Error(t, err)
+
+	_, err = strategy.listMCPTools(context.Background(), tool)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stdio MCP servers are disabled")
+}
+
+func TestMCP_StdioEnv(t *testing.T) {
+	t.Setenv("HELIX_TEST_SECRET", "secret")
+
+	out := t.TempDir() + "/env"
+	stdioServers := config.MCPStdioServers{
+		"env": {"sh", "-c", "env > " + out},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// The command is not an MCP server, it only records its environment
+	// and initializing times out
+	_, _ = newMCPClient(ctx, &types.ToolMCPConfig{
+		Server: "env",
+		Env:    map[string]string{"GITHUB_PERSONAL_ACCESS_TOKEN": "ghp_1"},
+	}, stdioServers)
+
+	var env string
+	require.Eventually(t, func() bool {
+		bts, err := os.ReadFile(out)
+		env = string(bts)
+		return err == nil && strings.Contains(env, "GITHUB_PERSONAL_ACCESS_TOKEN")
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Contains(t, env, "GITHUB_PERSONAL_ACCESS_TOKEN=ghp_1")
+	assert.Contains(t, env, "PATH=")
+	assert.NotContains(t, env, "HELIX_TEST_SECRET")
+}
+
+// newClosedSessionsServer counts the MCP sessions that the clients closed
+func newClosedSessionsServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	inner := newStreamableHTTPServer(t, newWeatherMCPServer(), false)
+	t.Cleanup(inner.Close)
+
+	var closed atomic.Int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			closed.Add(1)
+		}
+		inner.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	return ts, &closed
+}
+
+func TestMCPClients_ConfigChanged(t *testing.T) {
+	ts, closed := newClosedSessionsServer(t)
+
+	var clients mcpClients
+	ctx := oai.SetContextAppID(context.Background(), "app_1")
+
+	tool := getWeatherMCPTool(&types.ToolMCPConfig{
+		URL:     ts.URL,
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+	})
+
+	first, err := clients.get(ctx, tool, nil)
+	require.NoError(t, err)
+
+	same, err := clients.get(ctx, tool, nil)
+	require.NoError(t, err)
+	assert.Same(t, first, same)
+
+	// The app updated the server config, the old session is closed
+	tool.Config.MCP.Headers["X-Version"] = "2"
+
+	second, err := clients.get(ctx, tool, nil)
+	require.NoError(t, err)
+	assert.NotSame(t, first, second)
+	assert.Equal(t, int32(1), closed.Load())
+	assert.Len(t, clients.clients, 1)
+
+	clients.remove(ctx, tool)
+	assert.Equal(t, int32(2), closed.Load())
+	assert.Empty(t, clients.clients)
+}
+
+func TestMCPClients_IdleTimeout(t *testing.T) {
+	ts, closed := newClosedSessionsServer(t)
+
+	clients := mcpClients{idleTimeout: 50 * time.Millisecond}
+
+	tool := getWeatherMCPTool(&types.ToolMCPConfig{
+		URL:     ts.URL,
+		Headers: map[string]string{"Authorization": "Bearer secret"},
+	})
+
+	_, err := clients.get(context.Background(), tool, nil)
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		return closed.Load() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	clients.mu.Lock()
+	assert.Empty(t, clients.clients)
+	clients.mu.Unlock()
+}
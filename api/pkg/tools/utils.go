@@ -45,6 +45,15 @@ func GetToolFromAction(tools []*types.Tool, action string) (*types.Tool, bool) {
 			if tool.Name == action {
 				return tool, true
 			}
+		case types.ToolTypeMCP:
+			if tool.Config.MCP == nil {
+				continue
+			}
+			for _, a := range tool.Config.MCP.Tools {
+				if a.Name == action {
+					return tool, true
+				}
+			}
 		}
 	}
 	return nil, false
@@ -15,6 +15,11 @@ func (c *ChainStrategy) ValidateAndDefault(ctx context.Context, tool *types.Tool
 	switch tool.ToolType {
 	case types.ToolTypeAPI:
 		return c.validateAndDefaultAPI(ctx, tool)
+	case types.ToolTypeMCP:
+		if err := validateMCPConfig(tool.Config.MCP, c.cfg.Tools.MCPStdioServers); err != nil {
+			return nil, err
+		}
+		return tool, nil
 	default:
 		return tool, nil
 	}
@@ -126,6 +131,15 @@ func ValidateTool(tool *types.Tool, planner Planner, strict bool) error {
 		if tool.Config.Zapier.APIKey == "" {
 			return system.NewHTTPError400("API key is required for Zapier tools")
 		}
+	case types.ToolTypeMCP:
+		if tool.Config.MCP == nil {
+			return system.NewHTTPError400("MCP config is required for MCP tools")
+		}
+
+		// The planner checks the stdio commands against the server config
+		if _, err := planner.ValidateAndDefault(context.Background(), tool); err != nil {
+			return system.NewHTTPError400(err.Error())
+		}
 	default:
 		return system.NewHTTPError400(fmt.Sprintf("invalid tool type %s, only API tools are supported at the moment", tool.ToolType))
 	}
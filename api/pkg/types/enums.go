@@ -336,4 +336,5 @@ type Extractor string
 const (
 	ExtractorTika         Extractor = "tika"
 	ExtractorUnstructured Extractor = "unstructured"
+	ExtractorBuiltin      Extractor = "builtin"
 )
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -31,6 +32,10 @@ type AssistantKnowledge struct {
 	// It can be specified in cron format or as a duration for example '@every 2h'
 	// or 'every 5m' or '0 0 * * *' for daily at midnight.
 	RefreshSchedule string `json:"refresh_schedule" yaml:"refresh_schedule"`
+
+	// EvalSet is the golden set of questions used to measure the retrieval
+	// quality of the knowledge, see 'helix knowledge eval'
+	EvalSet KnowledgeEvalSet `json:"eval_set,omitempty" yaml:"eval_set,omitempty"`
 }
 
 type Knowledge struct {
@@ -83,6 +88,52 @@ type Knowledge struct {
 
 	// URLs crawled in the last run (should match last knowledge version)
 	CrawledSources *CrawledSources `json:"crawled_sources" gorm:"jsonb"`
+
+	// ExcludedDocuments are the sources (URLs or file paths) that are
+	// not indexed, set by the user for the documents they don't want
+	ExcludedDocuments ExcludedDocuments `json:"excluded_documents" gorm:"jsonb"`
+
+	// EvalSet is the golden set of questions used to measure the retrieval quality
+	EvalSet KnowledgeEvalSet `json:"eval_set" gorm:"jsonb"`
+}
+
+type ExcludedDocuments []string
+
+func (e ExcludedDocuments) Value() (driver.Value, error) {
+	j, err := json.Marshal(e)
+	return j, err
+}
+
+func (e *ExcludedDocuments) Scan(src interface{}) error {
+	// Knowledge created before the documents could be excluded
+	if src == nil {
+		*e = nil
+		return nil
+	}
+	source, ok := src.([]byte)
+	if !ok {
+		return errors.New("type assertion .([]byte) failed")
+	}
+	var result ExcludedDocuments
+	if err := json.Unmarshal(source, &result); err != nil {
+		return err
+	}
+	*e = result
+	return nil
+}
+
+func (ExcludedDocuments) GormDataType() string {
+	return "json"
+}
+
+// Contains returns true if the source is excluded
+func (e ExcludedDocuments) Contains(source string) bool {
+	for _, excluded := range e {
+		if excluded == source {
+			return true
+		}
+	}
+	return false
 }
 
 func (k *Knowledge) GetDataEntityID() string {
@@ -125,6 +176,7 @@ type KnowledgeSource struct {
 	Filestore *KnowledgeSourceHelixFilestore `json:"filestore" yaml:"filestore"`
 	S3        *KnowledgeSourceS3             `json:"s3"`
 	GCS       *KnowledgeSourceGCS            `json:"gcs"`
+	Git       *KnowledgeSourceGithub         `json:"git"`
 	Web       *KnowledgeSourceWeb            `json:"web"`
 	Content   *string                        `json:"text"`
 }
@@ -152,7 +204,10 @@ func (KnowledgeSource) GormDataType() string {
 }
 
 type KnowledgeSourceWeb struct {
+	// Excludes and Includes are regular expressions, or globs prefixed with "glob:".
+	// When includes are set, only the matching pages are crawled besides the URLs.
 	Excludes []string               `json:"excludes" yaml:"excludes"`
+	Includes []string               `json:"includes" yaml:"includes"`
 	URLs     []string               `json:"urls" yaml:"urls"`
 	Auth     KnowledgeSourceWebAuth `json:"auth" yaml:"auth"`
 	// Additional options for the crawler
@@ -168,6 +223,15 @@ type WebsiteCrawler struct {
 	Readability bool   `json:"readability" yaml:"readability"` // Apply readability middleware to the HTML content
 
 	IgnoreRobotsTxt bool `json:"ignore_robots_txt" yaml:"ignore_robots_txt"`
+
+	// Sitemaps to crawl, by default they are discovered through robots.txt or /sitemap.xml
+	Sitemaps      []string `json:"sitemaps" yaml:"sitemaps"`
+	IgnoreSitemap bool     `json:"ignore_sitemap" yaml:"ignore_sitemap"` // Don't discover the sitemaps
+
+	// Pages at least this similar to an already crawled page are skipped as near duplicates (print
+	// views, tag listings, paginated archives). Between 0 and 1, defaults to 0.95.
+	DuplicateSimilarity float64 `json:"duplicate_similarity" yaml:"duplicate_similarity"`
+	KeepDuplicates      bool    `json:"keep_duplicates" yaml:"keep_duplicates"` // Index the near duplicates too
 }
 
 type Firecrawl struct {
@@ -175,33 +239,248 @@ type Firecrawl struct {
 	APIURL string `json:"api_url" yaml:"api_url"`
 }
 
+// KnowledgeSourceWebAuth is used for the sites behind authentication, the values
+// can reference Helix secrets, for example ${WIKI_PASSWORD}. The credentials are
+// only sent to the domains of the URLs.
 type KnowledgeSourceWebAuth struct {
-	Username string
-	Password string
+	// Username and Password for basic auth, also available to the login steps
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password"`
+	// Headers sent with every request, for example Authorization: Bearer ${WIKI_TOKEN}
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	// Cookies set before crawling, for example an existing session cookie
+	Cookies []*KnowledgeSourceWebCookie `json:"cookies,omitempty" yaml:"cookies,omitempty"`
+	// Login is a form login performed in the browser before crawling, the resulting
+	// session cookies are used for the whole crawl
+	Login *KnowledgeSourceWebLogin `json:"login,omitempty" yaml:"login,omitempty"`
+}
+
+type KnowledgeSourceWebCookie struct {
+	Name  string `json:"name" yaml:"name"`
+	Value string `json:"value" yaml:"value"`
+	// Domain defaults to the domain of the first URL
+	Domain string `json:"domain,omitempty" yaml:"domain,omitempty"`
+	Path   string `json:"path,omitempty" yaml:"path,omitempty"`
+}
+
+type KnowledgeSourceWebLogin struct {
+	URL   string                         `json:"url" yaml:"url"`
+	Steps []*KnowledgeSourceWebLoginStep `json:"steps" yaml:"steps"`
+}
+
+type WebLoginAction string
+
+const (
+	WebLoginActionFill  WebLoginAction = "fill"  // Type the value into the element
+	WebLoginActionClick WebLoginAction = "click" // Click the element
+	WebLoginActionWait  WebLoginAction = "wait"  // Wait for the element to appear
+)
+
+// KnowledgeSourceWebLoginStep is a single action on the login page, the value of the
+// fill action can use ${username} and ${password} besides the secrets
+type KnowledgeSourceWebLoginStep struct {
+	Action   WebLoginAction `json:"action" yaml:"action"`
+	Selector string         `json:"selector" yaml:"selector"` // CSS selector
+	Value    string         `json:"value,omitempty" yaml:"value,omitempty"`
 }
 
 type KnowledgeSourceHelixFilestore struct {
 	Path string `json:"path" yaml:"path"`
 }
 
-// KnowledgeSourceS3 authentication through AWS IAM role
+// KnowledgeSourceS3 authentication through static credentials, which can reference
+// Helix secrets, for example ${AWS_SECRET_ACCESS_KEY}. The AWS credentials of the
+// server are only used if RAG_AMBIENT_CREDENTIALS is enabled.
 type KnowledgeSourceS3 struct {
-	Bucket string `json:"bucket"`
-	Path   string `json:"path"`
+	Bucket string `json:"bucket" yaml:"bucket"`
+	Path   string `json:"path" yaml:"path"`
+	// Endpoint is optional, set it when using S3-compatible storage such as MinIO,
+	// for example http://minio:9000
+	Endpoint        string `json:"endpoint" yaml:"endpoint"`
+	Region          string `json:"region" yaml:"region"`
+	AccessKeyID     string `json:"access_key_id" yaml:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key" yaml:"secret_access_key"`
 }
 
 // KnowledgeSourceGCS authentication through GCP service account
 type KnowledgeSourceGCS struct {
-	Bucket string `json:"bucket"`
-	Path   string `json:"path"`
+	Bucket string `json:"bucket" yaml:"bucket"`
+	Path   string `json:"path" yaml:"path"`
+	// ServiceAccountKey is the service account key JSON, normally a reference
+	// to a Helix secret, for example ${GCS_SERVICE_ACCOUNT_KEY}. The application
+	// default credentials of the server are only used if RAG_AMBIENT_CREDENTIALS
+	// is enabled.
+	ServiceAccountKey string `json:"service_account_key" yaml:"service_account_key"`
 }
 
+// KnowledgeSourceGithub indexes files from a git repository. Despite the name it
+// works with any git server, set the URL to clone from GitLab, Gitea, etc.
 type KnowledgeSourceGithub struct {
-	Owner            string   `json:"owner"`
-	Repository       string   `json:"repository"`
-	Branch           string   `json:"branch"`
-	FilterPaths      []string `json:"filter_paths"`
-	FilterExtensions []string `json:"filter_extensions"`
+	// URL of the repository, for example https://github.com/helixml/helix.git or
+	// git@github.com:helixml/helix.git. If not set, it's built from the owner and
+	// repository.
+	URL        string `json:"url" yaml:"url"`
+	Owner      string `json:"owner" yaml:"owner"`
+	Repository string `json:"repository" yaml:"repository"`
+	// Branch to index, defaults to the default branch of the repository
+	Branch string `json:"branch" yaml:"branch"`
+	// FilterPaths limits indexing to the files under these paths, for example docs/
+	FilterPaths []string `json:"filter_paths" yaml:"filter_paths"`
+	// FilterExtensions limits indexing to the files with these extensions, for example .md
+	FilterExtensions []string `json:"filter_extensions" yaml:"filter_extensions"`
+	// KeyPair is the SSH deploy key for private repositories, the private key
+	// can reference a Helix secret, for example ${DEPLOY_KEY}
+	KeyPair *KeyPair `json:"key_pair,omitempty" yaml:"key_pair,omitempty"`
+	// KnownHosts verifies the SSH host key of the server, same format as the
+	// known_hosts file (ssh-keyscan github.com). If not set, the known_hosts of
+	// the Helix server are used.
+	KnownHosts string `json:"known_hosts,omitempty" yaml:"known_hosts,omitempty"`
+	// InsecureSkipHostKeyCheck disables the SSH host key verification
+	InsecureSkipHostKeyCheck bool `json:"insecure_skip_host_key_check,omitempty" yaml:"insecure_skip_host_key_check,omitempty"`
+}
+
+// RedactSecrets clears the inline SSH private key, S3 secret access key, GCS
+// service account key and web authentication values before the source is returned
+// by the API, references to Helix secrets such as ${DEPLOY_KEY} are kept
+func (s *KnowledgeSource) RedactSecrets() {
+	if s.Git != nil && s.Git.KeyPair != nil && !isSecretReference(s.Git.KeyPair.PrivateKey) {
+		keyPair := *s.Git.KeyPair
+		keyPair.PrivateKey = ""
+
+		git := *s.Git
+		git.KeyPair = &keyPair
+		s.Git = &git
+	}
+
+	if s.S3 != nil && !isSecretReference(s.S3.SecretAccessKey) {
+		s3 := *s.S3
+		s3.SecretAccessKey = ""
+		s.S3 = &s3
+	}
+
+	if s.GCS != nil && !isSecretReference(s.GCS.ServiceAccountKey) {
+		gcs := *s.GCS
+		gcs.ServiceAccountKey = ""
+		s.GCS = &gcs
+	}
+
+	if s.Web != nil {
+		web := *s.Web
+		web.Auth = web.Auth.redactSecrets()
+		s.Web = &web
+	}
+}
+
+// RestoreSecrets sets the redacted secrets back from the stored source so
+// updates don't drop them
+func (s *KnowledgeSource) RestoreSecrets(stored *KnowledgeSource) {
+	if stored == nil {
+		return
+	}
+
+	if s.Git != nil && s.Git.KeyPair != nil && s.Git.KeyPair.PrivateKey == "" &&
+		stored.Git != nil && stored.Git.KeyPair != nil {
+		s.Git.KeyPair.PrivateKey = stored.Git.KeyPair.PrivateKey
+	}
+
+	if s.S3 != nil && s.S3.SecretAccessKey == "" && stored.S3 != nil {
+		s.S3.SecretAccessKey = stored.S3.SecretAccessKey
+	}
+
+	if s.GCS != nil && s.GCS.ServiceAccountKey == "" && stored.GCS != nil {
+		s.GCS.ServiceAccountKey = stored.GCS.ServiceAccountKey
+	}
+
+	if s.Web != nil && stored.Web != nil {
+		s.Web.Auth.restoreSecrets(&stored.Web.Auth)
+	}
+}
+
+// redactSecrets returns a copy of the authentication without the inline password,
+// header and cookie values and login step values
+func (a KnowledgeSourceWebAuth) redactSecrets() KnowledgeSourceWebAuth {
+	a.Password = redactSecret(a.Password)
+
+	if a.Headers != nil {
+		headers := make(map[string]string, len(a.Headers))
+		for name, value := range a.Headers {
+			headers[name] = redactSecret(value)
+		}
+		a.Headers = headers
+	}
+
+	if a.Cookies != nil {
+		cookies := make([]*KnowledgeSourceWebCookie, 0, len(a.Cookies))
+		for _, c := range a.Cookies {
+			cookie := *c
+			cookie.Value = redactSecret(c.Value)
+			cookies = append(cookies, &cookie)
+		}
+		a.Cookies = cookies
+	}
+
+	if a.Login != nil {
+		login := *a.Login
+		login.Steps = make([]*KnowledgeSourceWebLoginStep, 0, len(a.Login.Steps))
+		for _, s := range a.Login.Steps {
+			step := *s
+			step.Value = redactSecret(s.Value)
+			login.Steps = append(login.Steps, &step)
+		}
+		a.Login = &login
+	}
+
+	return a
+}
+
+// restoreSecrets sets the redacted values back, headers are matched by name,
+// cookies by name and login steps by position and selector
+func (a *KnowledgeSourceWebAuth) restoreSecrets(stored *KnowledgeSourceWebAuth) {
+	if a.Password == "" {
+		a.Password = stored.Password
+	}
+
+	for name, value := range a.Headers {
+		if value == "" {
+			a.Headers[name] = stored.Headers[name]
+		}
+	}
+
+	for _, c := range a.Cookies {
+		if c.Value != "" {
+			continue
+		}
+		for _, storedCookie := range stored.Cookies {
+			if storedCookie.Name == c.Name {
+				c.Value = storedCookie.Value
+				break
+			}
+		}
+	}
+
+	if a.Login == nil || stored.Login == nil {
+		return
+	}
+
+	for idx, step := range a.Login.Steps {
+		if step.Value != "" || idx >= len(stored.Login.Steps) {
+			continue
+		}
+		if storedStep := stored.Login.Steps[idx]; storedStep.Selector == step.Selector {
+			step.Value = storedStep.Value
+		}
+	}
+}
+
+func redactSecret(value string) string {
+	if isSecretReference(value) {
+		return value
+	}
+	return ""
+}
+
+func isSecretReference(value string) bool {
+	return strings.HasPrefix(value, "${") && strings.HasSuffix(value, "}") && !strings.ContainsAny(value, " \n")
 }
 
 // CrawledDocument used internally to work with the crawled data
@@ -214,6 +493,11 @@ type CrawledDocument struct {
 	StatusCode  int
 	DurationMs  int64
 	Message     string
+	// LastModified is the lastmod of the page in the sitemap, if any
+	LastModified *time.Time
+	// Unchanged is set when the page wasn't fetched as its lastmod is not newer
+	// than in the previous crawl, the previous contents are kept
+	Unchanged bool
 }
 
 type KnowledgeSearchResult struct {
@@ -224,6 +508,10 @@ type KnowledgeSearchResult struct {
 
 type CrawledSources struct {
 	URLs []*CrawledURL `json:"urls"`
+	// Commit is set for git sources, it's the commit that was indexed
+	Commit string `json:"commit,omitempty"`
+	// RAGSettingsHash of the settings used to index the version
+	RAGSettingsHash string `json:"rag_settings_hash,omitempty"`
 	// TODO: files?
 }
 
@@ -254,6 +542,35 @@ type CrawledURL struct {
 	StatusCode int    `json:"status_code"`
 	Message    string `json:"message"`
 	DurationMs int64  `json:"duration_ms"`
+	// DocumentID is the hash of the indexed contents, used to detect
+	// unchanged documents when the knowledge is refreshed
+	DocumentID string `json:"document_id,omitempty"`
+	// MetadataHash is the hash of the sidecar metadata of the document, if any
+	MetadataHash string `json:"metadata_hash,omitempty"`
+	// LastModified is the sitemap lastmod of the page, if any
+	LastModified *time.Time `json:"last_modified,omitempty"`
+	// SkipReason is set for the pages that were crawled but not indexed
+	SkipReason string `json:"skip_reason,omitempty"`
+	// DuplicateOf is the indexed page a near duplicate page was merged into
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	// Fingerprint is the SimHash of the page, unchanged pages that are not
+	// fetched again are compared with it to find the near duplicates
+	Fingerprint string `json:"fingerprint,omitempty"`
+}
+
+// KnowledgeDocument is a document crawled or read from the knowledge source
+type KnowledgeDocument struct {
+	// ID is the document group ID, it stays the same across the versions
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	// DocumentID is the hash of the indexed contents, empty if not indexed
+	DocumentID  string `json:"document_id,omitempty"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	Message     string `json:"message,omitempty"`
+	SkipReason  string `json:"skip_reason,omitempty"`
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	// Excluded is set when the user excluded the document from the knowledge
+	Excluded bool `json:"excluded"`
 }
 
 type KnowledgeProgress struct {
@@ -262,4 +579,121 @@ type KnowledgeProgress struct {
 	StartedAt      time.Time `json:"started_at"`
 	ElapsedSeconds int       `json:"elapsed_seconds"`
 	Message        string    `json:"message"`
+	// ExtractionCache is set once the files were run through the text extractor
+	ExtractionCache *ExtractionCacheStats `json:"extraction_cache,omitempty"`
+}
+
+// ExtractionCacheStats counts the files whose text was found in the
+// extraction cache and the files that had to be extracted
+type ExtractionCacheStats struct {
+	Hits   int `json:"hits"`
+	Misses int `json:"misses"`
+}
+
+// KnowledgeEvalCase is a question of the golden set together with
+// the documents that are expected to be retrieved for it
+type KnowledgeEvalCase struct {
+	Question string `json:"question" yaml:"question"`
+	// ExpectedSources are the URLs or the file paths of the relevant documents, a
+	// retrieved document matches if its source ends with the expected path segments
+	ExpectedSources []string `json:"expected_sources" yaml:"expected_sources"`
+}
+
+type KnowledgeEvalSet []*KnowledgeEvalCase
+
+func (e KnowledgeEvalSet) Value() (driver.Value, error) {
+	j, err := json.Marshal(e)
+	return j, err
+}
+
+func (e *KnowledgeEvalSet) Scan(src interface{}) error {
+	// Knowledge created before the golden sets
+	if src == nil {
+		*e = nil
+		return nil
+	}
+	source, ok := src.([]byte)
+	if !ok {
+		return errors.New("type assertion .([]byte) failed")
+	}
+	var result KnowledgeEvalSet
+	if err := json.Unmarshal(source, &result); err != nil {
+		return err
+	}
+	*e = result
+	return nil
+}
+
+func (KnowledgeEvalSet) GormDataType() string {
+	return "json"
+}
+
+// KnowledgeEvalVariant is a RAG settings variant indexed side by side with
+// the current version, so that it can be evaluated before it's applied
+type KnowledgeEvalVariant struct {
+	Name        string      `json:"name" yaml:"name"`
+	RAGSettings RAGSettings `json:"rag_settings" yaml:"rag_settings"`
+}
+
+type KnowledgeEvalRequest struct {
+	// Cases to run, the golden set of the knowledge if empty
+	Cases KnowledgeEvalSet `json:"cases"`
+	// K is the number of retrieved chunks that are considered,
+	// defaults to the results count of the knowledge
+	K int `json:"k"`
+	// Versions to compare, the current version if neither
+	// the versions nor the variants are set
+	Versions []string `json:"versions"`
+	// Variants are indexed into temporary indexes that are
+	// deleted once they are evaluated
+	Variants []*KnowledgeEvalVariant `json:"variants"`
+}
+
+type KnowledgeEvalJobState string
+
+const (
+	KnowledgeEvalJobStateRunning  KnowledgeEvalJobState = "running"
+	KnowledgeEvalJobStateComplete KnowledgeEvalJobState = "complete"
+	KnowledgeEvalJobStateError    KnowledgeEvalJobState = "error"
+)
+
+// KnowledgeEvalJob runs the evaluation in the background, the variants are indexed
+// from a copy of the knowledge so the knowledge itself is not changed
+type KnowledgeEvalJob struct {
+	ID          string                `json:"id"`
+	KnowledgeID string                `json:"knowledge_id"`
+	Owner       string                `json:"owner"`
+	Created     time.Time             `json:"created"`
+	Updated     time.Time             `json:"updated"`
+	State       KnowledgeEvalJobState `json:"state"`
+	Error       string                `json:"error,omitempty"`
+	// Progress of the variant being indexed
+	Progress KnowledgeProgress      `json:"progress"`
+	Result   *KnowledgeEvalResponse `json:"result,omitempty"`
+}
+
+type KnowledgeEvalResponse struct {
+	K       int                    `json:"k"`
+	Results []*KnowledgeEvalResult `json:"results"`
+}
+
+// KnowledgeEvalResult has the metrics of a version or a variant averaged over the cases
+type KnowledgeEvalResult struct {
+	Version string `json:"version,omitempty"`
+	Variant string `json:"variant,omitempty"`
+	// RecallAtK is the share of the expected documents found in the top k
+	RecallAtK float64 `json:"recall_at_k"`
+	// MRR is the mean reciprocal rank of the first expected document
+	MRR float64 `json:"mrr"`
+	// HitRate is the share of the questions with any expected document in the top k
+	HitRate float64                    `json:"hit_rate"`
+	Cases   []*KnowledgeEvalCaseResult `json:"cases"`
+}
+
+type KnowledgeEvalCaseResult struct {
+	Question       string  `json:"question"`
+	Recall         float64 `json:"recall"`
+	ReciprocalRank float64 `json:"reciprocal_rank"`
+	// Retrieved are the sources of the retrieved documents in the rank order
+	Retrieved []string `json:"retrieved"`
 }
@@ -198,3 +198,17 @@ type OpenAIMessage struct {
 	// For Role=tool prompts this should be set to the ID given in the assistant's prior request to call a tool.
 	ToolCallID string `json:"tool_call_id,omitempty"`
 }
+
+// ChatCompletionResponse is the OpenAI chat completion response extended with
+// the citations of the knowledge used in the answer
+type ChatCompletionResponse struct {
+	openai.ChatCompletionResponse
+	Citations []*Citation `json:"citations,omitempty"`
+}
+
+// ChatCompletionStreamResponse is the last chunk of the chat completion stream when
+// the answer refers to the knowledge, it has no choices
+type ChatCompletionStreamResponse struct {
+	openai.ChatCompletionStreamResponse
+	Citations []*Citation `json:"citations,omitempty"`
+}
@@ -48,6 +48,7 @@ type Interaction struct {
 	DataPrepTotalChunks int                        `json:"data_prep_total_chunks"`
 
 	RagResults []*SessionRAGResult `json:"rag_results"`
+	Citations  []*Citation         `json:"citations,omitempty"` // knowledge chunks the response refers to
 
 	// Model function calling, not to be mistaken with Helix tools
 	Tools []openai.Tool `json:"tools"`
@@ -92,6 +93,9 @@ type TextSplitterType string
 const (
 	TextSplitterTypeMarkdown TextSplitterType = "markdown"
 	TextSplitterTypeText     TextSplitterType = "text"
+	TextSplitterTypeSemantic TextSplitterType = "semantic" // splits where the embeddings of the sentences change the most
+	TextSplitterTypeCode     TextSplitterType = "code"     // splits the source files by functions and classes, markdown for the rest
+	TextSplitterTypeTable    TextSplitterType = "table"    // keeps the table rows together with their header row
 )
 
 type RAGSettings struct {
@@ -99,7 +103,7 @@ type RAGSettings struct {
 	Threshold        float64 `json:"threshold" yaml:"threshold"`                 // this is the threshold for a "good" answer - will default to 0.2
 	ResultsCount     int     `json:"results_count" yaml:"results_count"`         // this is the max number of results to return - will default to 3
 
-	TextSplitter       TextSplitterType `json:"text_splitter" yaml:"text_splitter"`             // Markdown if empty or 'text'
+	TextSplitter       TextSplitterType `json:"text_splitter" yaml:"text_splitter"`             // Markdown if empty, or 'text', 'semantic', 'code', 'table'
 	ChunkSize          int              `json:"chunk_size" yaml:"chunk_size"`                   // the size of each text chunk - will default to 2000 bytes
 	ChunkOverflow      int              `json:"chunk_overflow" yaml:"chunk_overflow"`           // the amount of overlap between chunks - will default to 32 bytes
 	DisableChunking    bool             `json:"disable_chunking" yaml:"disable_chunking"`       // if true, we will not chunk the text and send the entire file to the RAG indexing endpoint
@@ -116,6 +120,30 @@ type RAGSettings struct {
 		APIKey     string `json:"api_key" yaml:"api_key"`
 		Collection string `json:"collection" yaml:"collection"`
 	} `json:"typesense" yaml:"typesense"`
+
+	QueryRewrite RAGQueryRewriteSettings `json:"query_rewrite" yaml:"query_rewrite"` // optional rewriting of the conversation into standalone search queries
+	Rerank       RAGRerankSettings       `json:"rerank" yaml:"rerank"`               // optional second stage that rescores the retrieved chunks
+}
+
+// RAGQueryRewriteSettings configures the rewriting of the last user message into a
+// standalone search query using the conversation history, so that follow-up questions
+// retrieve the right chunks. The results of the sub-queries are fused with reciprocal rank fusion.
+type RAGQueryRewriteSettings struct {
+	Enabled    bool     `json:"enabled" yaml:"enabled"`
+	Provider   Provider `json:"provider" yaml:"provider"`       // will default to the provider of the chat request
+	Model      string   `json:"model" yaml:"model"`             // will default to the model of the chat request
+	SubQueries int      `json:"sub_queries" yaml:"sub_queries"` // number of additional queries to generate, 0 to only rewrite the question
+}
+
+// RAGRerankSettings configures the reranking of the retrieved chunks. A larger set of
+// candidates is retrieved, rescored with the rerank model and the best results_count are kept.
+type RAGRerankSettings struct {
+	Enabled         bool     `json:"enabled" yaml:"enabled"`
+	CandidatesCount int      `json:"candidates_count" yaml:"candidates_count"` // number of chunks to retrieve before reranking - will default to 4x results_count (at least 20)
+	Provider        Provider `json:"provider" yaml:"provider"`                 // provider of the LLM reranker - will default to the inference provider
+	Model           string   `json:"model" yaml:"model"`                       // LLM used as the reranker, or the model name passed to the rerank endpoint
+	URL             string   `json:"url" yaml:"url"`                           // Cohere/Jina compatible rerank endpoint, used instead of the LLM reranker if set
+	APIKey          string   `json:"api_key" yaml:"api_key"`                   // API key for the rerank endpoint
 }
 
 func (r RAGSettings) Value() (driver.Value, error) {
@@ -149,6 +177,9 @@ type SessionRAGIndexChunk struct {
 	DocumentGroupID string `json:"document_group_id"`
 	ContentOffset   int    `json:"content_offset"`
 	Content         string `json:"content"`
+	// Metadata can be used to filter the chunks when querying, for example
+	// the extension of the file or the path of the URL
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 // the query we post to llamaindex to get results back from a user
@@ -160,12 +191,58 @@ type SessionRAGQuery struct {
 	DistanceFunction  string  `json:"distance_function"`
 	MaxResults        int     `json:"max_results"`
 	ExhaustiveSearch  bool    `json:"exhaustive_search"`
+	// Filters on the chunk metadata, all of them have to match. The llamaindex
+	// backend filters an over-fetched top of the results, so it can return fewer
+	// than MaxResults even if more chunks match.
+	Filters []*RAGFilter `json:"filters,omitempty"`
+}
+
+type RAGFilterOperator string
+
+const (
+	RAGFilterOperatorEquals     RAGFilterOperator = "="
+	RAGFilterOperatorNotEquals  RAGFilterOperator = "!="
+	RAGFilterOperatorStartsWith RAGFilterOperator = "^="
+)
+
+// RAGFilter matches the chunks by their metadata, chunks without the key
+// only match the not equals operator
+type RAGFilter struct {
+	Key      string            `json:"key"`
+	Operator RAGFilterOperator `json:"operator"`
+	Value    string            `json:"value"`
 }
 
 type DeleteIndexRequest struct {
 	DataEntityID string `json:"data_entity_id"`
 }
 
+type CopyIndexRequest struct {
+	FromDataEntityID string   `json:"from_data_entity_id"`
+	ToDataEntityID   string   `json:"to_data_entity_id"`
+	DocumentGroupIDs []string `json:"document_group_ids"`
+}
+
+// DeleteDocumentsRequest deletes the chunks of the documents from a data entity
+type DeleteDocumentsRequest struct {
+	DataEntityID     string   `json:"data_entity_id"`
+	DocumentGroupIDs []string `json:"document_group_ids"`
+}
+
+// ListIndexRequest pages through the indexed chunks of a data entity, the chunks
+// of each document are ordered by their offset in the document
+type ListIndexRequest struct {
+	DataEntityID    string `json:"data_entity_id"`
+	DocumentGroupID string `json:"document_group_id"` // Only the chunks of this document if set
+	Offset          int    `json:"offset"`
+	Limit           int    `json:"limit"`
+}
+
+type ListIndexResponse struct {
+	Chunks []*SessionRAGResult `json:"chunks"`
+	Total  int                 `json:"total"` // Number of chunks matching the request
+}
+
 // the thing we load from llamaindex when we send the user prompt
 // there and it does a lookup
 type SessionRAGResult struct {
@@ -179,6 +256,18 @@ type SessionRAGResult struct {
 	ContentOffset   int     `json:"content_offset"`
 	Content         string  `json:"content"`
 	Distance        float64 `json:"distance"`
+	RerankScore     float64 `json:"rerank_score,omitempty"` // relevance score from 0 to 1, set when the results are reranked
+
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Citation is a retrieved chunk that the response refers to with a [DOC_ID:...] marker
+type Citation struct {
+	DocumentID    string `json:"document_id"`
+	Source        string `json:"source"`         // URL or the file the chunk comes from
+	ContentOffset int    `json:"content_offset"` // index of the chunk in the document
+	Section       string `json:"section,omitempty"`
+	Page          int    `json:"page,omitempty"` // set for the paginated documents such as PDFs
 }
 
 // gives us a quick way to add settings
@@ -611,6 +700,8 @@ type StepInfo struct {
 	Name    string       `json:"name"`
 	Type    StepInfoType `json:"type"`
 	Message string       `json:"message"`
+	// ToolCallID tells apart the steps of the tool calls running in parallel
+	ToolCallID string `json:"tool_call_id,omitempty"`
 }
 
 // the context of a long running python process
@@ -883,6 +974,7 @@ const (
 	ToolTypeAPI       ToolType = "api"
 	ToolTypeGPTScript ToolType = "gptscript"
 	ToolTypeZapier    ToolType = "zapier"
+	ToolTypeMCP       ToolType = "mcp"
 )
 
 type Tool struct {
@@ -904,6 +996,7 @@ type ToolConfig struct {
 	API       *ToolAPIConfig       `json:"api"`
 	GPTScript *ToolGPTScriptConfig `json:"gptscript"`
 	Zapier    *ToolZapierConfig    `json:"zapier"`
+	MCP       *ToolMCPConfig       `json:"mcp"`
 }
 
 func (t ToolConfig) Value() (driver.Value, error) {
@@ -962,6 +1055,40 @@ type ToolZapierConfig struct {
 	MaxIterations int    `json:"max_iterations"`
 }
 
+// MCPTransport is how Helix connects to the MCP server
+type MCPTransport string
+
+const (
+	// MCPTransportStdio launches the server command and talks to it over stdin/stdout
+	MCPTransportStdio MCPTransport = "stdio"
+	// MCPTransportSSE connects to the server's SSE endpoint
+	MCPTransportSSE MCPTransport = "sse"
+	// MCPTransportStreamableHTTP posts the requests to the server's MCP endpoint
+	MCPTransportStreamableHTTP MCPTransport = "streamable_http"
+)
+
+type ToolMCPConfig struct {
+	// Transport defaults to stdio when the server is set, otherwise to streamable_http
+	Transport MCPTransport `json:"transport" yaml:"transport"`
+
+	Server string            `json:"server,omitempty" yaml:"server,omitempty"` // Name of the stdio server registered by the admin
+	Env    map[string]string `json:"env,omitempty" yaml:"env,omitempty"`       // Environment of the server (credentials, etc)
+
+	URL     string            `json:"url,omitempty" yaml:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"` // Headers (authentication, etc)
+
+	Model string `json:"model,omitempty" yaml:"model,omitempty"`
+
+	Tools []*ToolMCPAction `json:"tools,omitempty" yaml:"-"` // Read-only, listed from the server when the tool is used
+}
+
+// ToolMCPAction is a tool of the MCP server
+type ToolMCPAction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"input_schema"` // JSON schema of the arguments
+}
+
 type AppSource string
 
 const (
@@ -986,6 +1113,46 @@ type AssistantZapier struct {
 	MaxIterations int    `json:"max_iterations" yaml:"max_iterations"`
 }
 
+// AssistantMCP is an external MCP server, its tools are offered to the assistant.
+// Use secrets (${SECRET_NAME}) in the env, headers or URL for the credentials.
+type AssistantMCP struct {
+	Name        string       `json:"name" yaml:"name"`
+	Description string       `json:"description" yaml:"description"`
+	Transport   MCPTransport `json:"transport,omitempty" yaml:"transport,omitempty"`
+
+	Server string            `json:"server,omitempty" yaml:"server,omitempty"`
+	Env    map[string]string `json:"env,omitempty" yaml:"env,omitempty"`
+
+	URL     string            `json:"url,omitempty" yaml:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+
+	Model string `json:"model,omitempty" yaml:"model,omitempty"`
+}
+
+// ToolCallingMode is how the assistant chooses the tools to call
+type ToolCallingMode string
+
+const (
+	// ToolCallingPrompt asks the model with the is_actionable prompt and parses
+	// the JSON answer, works with any model
+	ToolCallingPrompt ToolCallingMode = "prompt"
+	// ToolCallingNative passes the actions as functions with the OpenAI 'tools', the
+	// model and the provider must support function calling. The prompt is used as a
+	// fallback when the function calling request fails.
+	ToolCallingNative ToolCallingMode = "native"
+)
+
+// AssistantAgent configures the agent mode, the assistant keeps calling the tools
+// with the results of the previous calls until it can answer the user
+type AssistantAgent struct {
+	Enabled bool `json:"enabled" yaml:"enabled"`
+	// MaxIterations is the maximum number of planning steps per answer, defaults to 5
+	MaxIterations int `json:"max_iterations,omitempty" yaml:"max_iterations,omitempty"`
+	// TokenBudget is the maximum number of tokens used by the LLM calls of the planner
+	// and the tools, the assistant then answers with the results so far. Defaults to 32000
+	TokenBudget int `json:"token_budget,omitempty" yaml:"token_budget,omitempty"`
+}
+
 type AssistantAPI struct {
 	Name        string            `json:"name" yaml:"name"`
 	Description string            `json:"description" yaml:"description"`
@@ -1020,9 +1187,18 @@ type AssistantConfig struct {
 
 	IsActionableTemplate string `json:"is_actionable_template,omitempty" yaml:"is_actionable_template,omitempty"`
 
+	// ToolCalling is how the tools are chosen, 'prompt' (default) or 'native'
+	ToolCalling ToolCallingMode `json:"tool_calling,omitempty" yaml:"tool_calling,omitempty"`
+
+	// MaxParallelToolCalls limits the tool calls of a turn that run at the same time, defaults to 4
+	MaxParallelToolCalls int `json:"max_parallel_tool_calls,omitempty" yaml:"max_parallel_tool_calls,omitempty"`
+
+	Agent *AssistantAgent `json:"agent,omitempty" yaml:"agent,omitempty"`
+
 	APIs       []AssistantAPI       `json:"apis,omitempty" yaml:"apis,omitempty"`
 	GPTScripts []AssistantGPTScript `json:"gptscripts,omitempty" yaml:"gptscripts,omitempty"`
 	Zapier     []AssistantZapier    `json:"zapier,omitempty" yaml:"zapier,omitempty"`
+	MCP        []AssistantMCP       `json:"mcp,omitempty" yaml:"mcp,omitempty"`
 	Tools      []*Tool              `json:"tools,omitempty" yaml:"tools,omitempty"`
 
 	Tests []struct {
@@ -1176,9 +1352,36 @@ type App struct {
 }
 
 type KeyPair struct {
-	Type       string
-	PrivateKey string
-	PublicKey  string
+	Type       string `json:"type" yaml:"type"`
+	PrivateKey string `json:"private_key" yaml:"private_key"`
+	PublicKey  string `json:"public_key" yaml:"public_key"`
+}
+
+// UnmarshalJSON also reads the key pairs stored before the fields had
+// JSON tags (PrivateKey, PublicKey)
+func (k *KeyPair) UnmarshalJSON(b []byte) error {
+	kp := struct {
+		Type             string `json:"type"`
+		PrivateKey       string `json:"private_key"`
+		PublicKey        string `json:"public_key"`
+		LegacyPrivateKey string `json:"PrivateKey"`
+		LegacyPublicKey  string `json:"PublicKey"`
+	}{}
+	if err := json.Unmarshal(b, &kp); err != nil {
+		return err
+	}
+
+	k.Type = kp.Type
+	k.PrivateKey = kp.PrivateKey
+	if k.PrivateKey == "" {
+		k.PrivateKey = kp.LegacyPrivateKey
+	}
+	k.PublicKey = kp.PublicKey
+	if k.PublicKey == "" {
+		k.PublicKey = kp.LegacyPublicKey
+	}
+
+	return nil
 }
 
 // the low level "please run me a gptsript" request
@@ -1391,6 +1594,10 @@ type RunnerLLMInferenceRequest struct {
 	InteractionID string
 
 	Request *openai.ChatCompletionRequest
+
+	// EmbeddingRequest is set for the embeddings requests, Request
+	// then only carries the model name used for scheduling
+	EmbeddingRequest *openai.EmbeddingRequest
 }
 
 type RunnerLLMInferenceResponse struct {
@@ -1402,8 +1609,9 @@ type RunnerLLMInferenceResponse struct {
 	SessionID     string
 	InteractionID string
 
-	Response       *openai.ChatCompletionResponse
-	StreamResponse *openai.ChatCompletionStreamResponse
+	Response          *openai.ChatCompletionResponse
+	StreamResponse    *openai.ChatCompletionStreamResponse
+	EmbeddingResponse *openai.EmbeddingResponse
 
 	// Error is set if there was an error
 	Error string
@@ -1420,6 +1628,7 @@ type LLMCallStep string
 const (
 	LLMCallStepDefault           LLMCallStep = "default"
 	LLMCallStepIsActionable      LLMCallStep = "is_actionable"
+	LLMCallStepSelectTools       LLMCallStep = "select_tools"
 	LLMCallStepPrepareAPIRequest LLMCallStep = "prepare_api_request"
 	LLMCallStepInterpretResponse LLMCallStep = "interpret_response"
 	LLMCallStepGenerateTitle     LLMCallStep = "generate_title"
@@ -1438,6 +1647,7 @@ type LLMCall struct {
 	Model            string         `json:"model"`
 	Provider         string         `json:"provider"`
 	Step             LLMCallStep    `json:"step" gorm:"index"`
+	ToolCallID       string         `json:"tool_call_id,omitempty"`
 	OriginalRequest  datatypes.JSON `json:"original_request" gorm:"type:jsonb"`
 	Request          datatypes.JSON `json:"request" gorm:"type:jsonb"`
 	Response         datatypes.JSON `json:"response" gorm:"type:jsonb"`
@@ -1507,8 +1717,8 @@ type RunnerActualSlotAttributes struct {
 }
 
 type RunAPIActionRequest struct {
-	Action     string            `json:"action"`
-	Parameters map[string]string `json:"parameters"`
+	Action     string         `json:"action"`
+	Parameters map[string]any `json:"parameters"` // Path, query and header parameters, the JSON request body under 'body'
 
 	Tool *Tool `json:"-"` // Set internally
 }
@@ -190,6 +190,15 @@ export interface IInteraction {
   data_prep_stage: ITextDataPrepStage,
   data_prep_limited: boolean,
   data_prep_limit: number,
+  citations?: ICitation[],
+}
+
+export interface ICitation {
+  document_id: string,
+  source: string,
+  content_offset: number,
+  section?: string,
+  page?: number,
 }
 
 export interface ISessionOrigin {
@@ -469,7 +478,7 @@ export interface IShareSessionInstructions {
   addDocumentsMode?: boolean,
 }
 
-export type IToolType = 'api' | 'gptscript' | 'zapier'
+export type IToolType = 'api' | 'gptscript' | 'zapier' | 'mcp'
 
 export interface IToolApiAction {
   name: string,
@@ -500,11 +509,29 @@ export interface IToolZapierConfig {
   max_iterations?: number,
 }
 
+export type IMCPTransport = 'stdio' | 'sse' | 'streamable_http'
+
+export interface IToolMCPAction {
+  name: string,
+  description: string,
+  input_schema: Record<string, any>,
+}
+
+export interface IToolMCPConfig {
+  transport?: IMCPTransport,
+  server?: string, // Name of the stdio server registered by the admin
+  env?: Record<string, string>,
+  url?: string,
+  headers?: Record<string, string>,
+  model?: string,
+  tools?: IToolMCPAction[], // Listed from the server when the tool is used
+}
 
 export interface IToolConfig {
   api?: IToolApiConfig,
   gptscript?: IToolGptScriptConfig,
   zapier?: IToolZapierConfig,
+  mcp?: IToolMCPConfig,
 }
 
 export interface ITool {
@@ -567,6 +594,23 @@ export interface IAssistantZapier {
   max_iterations?: number,
 }
 
+export interface IAssistantMCP {
+  name: string,
+  description: string,
+  transport?: IMCPTransport,
+  server?: string, // Name of the stdio server registered by the admin
+  env?: Record<string, string>,
+  url?: string,
+  headers?: Record<string, string>,
+  model?: string,
+}
+
+export interface IAssistantAgent {
+  enabled: boolean,
+  max_iterations?: number,
+  token_budget?: number,
+}
+
 export interface IAssistantConfig {
   id?: string;
   name?: string;
@@ -579,9 +623,13 @@ export interface IAssistantConfig {
   rag_source_id?: string;
   lora_id?: string;
   is_actionable_template?: string;
+  tool_calling?: 'prompt' | 'native';
+  max_parallel_tool_calls?: number;
+  agent?: IAssistantAgent;
   apis?: IAssistantApi[];
   gptscripts?: IAssistantGPTScript[];
   zapier?: IAssistantZapier[];
+  mcp?: IAssistantMCP[];
   tools?: ITool[];
   knowledge?: IKnowledgeSource[];
 }
@@ -592,6 +640,12 @@ export interface IKnowledgeProgress {
   elapsed_seconds: number;
   message?: string;
   started_at?: Date;
+  extraction_cache?: IExtractionCacheStats;
+}
+
+export interface IExtractionCacheStats {
+  hits: number;
+  misses: number;
 }
 
 export interface IKnowledgeSource {
@@ -608,6 +662,7 @@ export interface IKnowledgeSource {
   message?: string;
   progress?: IKnowledgeProgress;
   crawled_sources?: ICrawledSources;
+  excluded_documents?: string[];
   source: {
     helix_drive?: {
       path: string;
@@ -626,9 +681,25 @@ export interface IKnowledgeSource {
     web?: {
       urls?: string[];
       excludes?: string[];
+      includes?: string[];
       auth?: {
         username: string;
         password: string;
+        headers?: Record<string, string>;
+        cookies?: {
+          name: string;
+          value: string;
+          domain?: string;
+          path?: string;
+        }[];
+        login?: {
+          url: string;
+          steps: {
+            action: 'fill' | 'click' | 'wait';
+            selector: string;
+            value?: string;
+          }[];
+        };
       };
       crawler?: {
         firecrawl?: {
@@ -640,12 +711,22 @@ export interface IKnowledgeSource {
         max_pages?: number;
         user_agent?: string;
         readability?: boolean;
+        sitemaps?: string[];
+        ignore_sitemap?: boolean;
+        duplicate_similarity?: number;
+        keep_duplicates?: boolean;
       };
     };
     text?: string;
   };
   refresh_enabled?: boolean;
   refresh_schedule?: string;
+  eval_set?: IKnowledgeEvalCase[];
+}
+
+export interface IKnowledgeEvalCase {
+  question: string;
+  expected_sources: string[];
 }
 
 export interface ICrawledURL {
@@ -653,10 +734,34 @@ export interface ICrawledURL {
   status_code: number;
   message: string;
   duration_ms: number;
+  document_id?: string;
+  metadata_hash?: string;
+  last_modified?: string;
+  skip_reason?: string;
+  duplicate_of?: string;
+  fingerprint?: string;
 }
 
 export interface ICrawledSources {
   urls: ICrawledURL[];
+  commit?: string;
+  rag_settings_hash?: string;
+}
+
+export interface IKnowledgeDocument {
+  id: string;
+  source: string;
+  document_id?: string;
+  status_code?: number;
+  message?: string;
+  skip_reason?: string;
+  duplicate_of?: string;
+  excluded: boolean;
+}
+
+export interface IKnowledgeChunksResponse {
+  chunks: ISessionRAGResult[];
+  total: number;
 }
 
 export interface IKnowledgeSearchResult {
@@ -670,6 +775,9 @@ export interface ISessionRAGResult {
   source: string;
   document_id: string;
   document_group_id: string;
+  distance?: number;
+  rerank_score?: number;
+  metadata?: Record<string, string>;
   // Add any other properties that your API returns
 }
 
@@ -858,6 +966,7 @@ export interface LLMCall {
   model: string;
   provider: string;
   step: string;
+  tool_call_id?: string;
   request: any;
   response: any;
   original_request: any;